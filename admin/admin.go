@@ -0,0 +1,542 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package admin serves a small web UI on an internal listener to look into a running bean service: the
+// routes and their middleware chains, the redacted config, the tenant connections, the pool metrics, the recent
+// server errors, the history of the async tasks and the dependency statuses of the `degrade` package, which
+// can be forced down as a maintenance switch.
+//
+// The UI is protected by the API keys with the `admin` scope. (see `middleware.APIKeyAuth`)
+package admin
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/degrade"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/middleware"
+	broute "github.com/retail-ai-inc/bean/route"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"github.com/spf13/viper"
+)
+
+// Scope is the API key scope required by the UI.
+const Scope = "admin"
+
+const keyCookie = "bean_admin_key"
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// Config defines the config of the admin UI.
+type Config struct {
+	// Host and Port of the internal listener, never expose it to the internet.
+	// Optional. Default value `admin.host` and `admin.port` of env.json, else "127.0.0.1" and "8889".
+	Host string
+	Port string
+
+	// Store finds the API keys allowed to use the UI, they need the `admin` scope.
+	// Optional. Default value a `middleware.StaticKeyStore` of `admin.apiKeys` in env.json.
+	Store middleware.KeyStore
+
+	// PingTimeout is the deadline of the connection checks of the tenants page.
+	// Optional. Default value 2s.
+	PingTimeout time.Duration
+}
+
+type server struct {
+	b        *bean.Bean
+	config   Config
+	template *template.Template
+}
+
+// Start serves the admin UI in a goroutine and returns the server, which is also shut down in the intake
+// stage of `bean.Shutdown`. It returns an error if no API key is configured, an admin UI without
+// authentication is never started.
+func Start(b *bean.Bean, config Config) (*http.Server, error) {
+	e, err := New(b, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Host == "" {
+		config.Host = b.Config.Admin.Host
+	}
+	if config.Host == "" {
+		config.Host = "127.0.0.1"
+	}
+	if config.Port == "" {
+		config.Port = b.Config.Admin.Port
+	}
+	if config.Port == "" {
+		config.Port = "8889"
+	}
+
+	s := &http.Server{Addr: config.Host + ":" + config.Port, Handler: e}
+	if err := b.ShutdownOrchestrator().Register(shutdown.Component{Name: "admin", Stage: shutdown.StageIntake, Stop: s.Shutdown}); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			b.Echo.Logger.Error("admin: ", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// New returns the echo instance of the admin UI, for the applications which serve it themselves.
+func New(b *bean.Bean, config Config) (*echo.Echo, error) {
+	if config.Store == nil {
+		if len(b.Config.Admin.APIKeys) == 0 {
+			return nil, errors.New("admin: no api key configured, set `admin.apiKeys` in env.json")
+		}
+
+		keys := make(map[string]middleware.APIKey, len(b.Config.Admin.APIKeys))
+		for i, key := range b.Config.Admin.APIKeys {
+			keys[key] = middleware.APIKey{ID: "admin-" + strconv.Itoa(i), Name: "admin", Scopes: []string{Scope}}
+		}
+		config.Store = middleware.NewStaticKeyStore(keys)
+	}
+	if config.PingTimeout <= 0 {
+		config.PingTimeout = 2 * time.Second
+	}
+
+	tmpl, err := template.New("admin").Funcs(template.FuncMap{
+		"since": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+		"inc":   func(i int) int { return i + 1 },
+		// level returns the CSS class of a dependency level.
+		"level": func(l degrade.Level) string {
+			switch l {
+			case degrade.LevelOK:
+				return "ok"
+			case degrade.LevelDegraded:
+				return "warn"
+			}
+			return "ko"
+		},
+		"percent": func(f float64) string { return strconv.FormatFloat(f*100, 'f', 1, 64) + "%" },
+		"outcomes": func() []async.Outcome {
+			return []async.Outcome{async.OutcomeSucceeded, async.OutcomeFailed, async.OutcomePanicked}
+		},
+	}).ParseFS(templatesFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &server{b: b, config: config, template: tmpl}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Renderer = s
+	e.HTTPErrorHandler = s.errorHandler
+
+	e.GET("/login", s.login)
+	e.POST("/login", s.login)
+
+	g := e.Group("", middleware.APIKeyAuthWithConfig(middleware.APIKeyAuthConfig{
+		Store:     config.Store,
+		KeyLookup: "header:X-API-Key,cookie:" + keyCookie,
+		Scopes:    []string{Scope},
+	}))
+	g.GET("/", s.index)
+	g.GET("/routes", s.routes)
+	g.GET("/routes/chain", s.chain)
+	g.GET("/config", s.configPage)
+	g.GET("/tenants", s.tenants)
+	g.GET("/metrics", s.metrics)
+	g.GET("/errors", s.errors)
+	g.GET("/tasks", s.tasks)
+	g.GET("/health", s.health)
+	g.POST("/health", s.forceHealth)
+	g.POST("/logout", s.logout)
+
+	return e, nil
+}
+
+func (s *server) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return s.template.ExecuteTemplate(w, name, map[string]interface{}{
+		"Project":     s.b.Config.ProjectName,
+		"Environment": s.b.Config.Environment,
+		"Data":        data,
+	})
+}
+
+func (s *server) errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	var apiErr *berror.APIError
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &httpErr):
+		status = httpErr.Code
+	}
+
+	if status == http.StatusUnauthorized && c.Request().Method == http.MethodGet {
+		_ = c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	_ = c.String(status, http.StatusText(status))
+}
+
+// login keeps the key in an HTTP only cookie, so that the browser sends it with every page.
+func (s *server) login(c echo.Context) error {
+	if c.Request().Method == http.MethodGet {
+		return c.Render(http.StatusOK, "login.html", nil)
+	}
+
+	key := c.FormValue("key")
+	apiKey, err := s.config.Store.Find(c.Request().Context(), key)
+	if err != nil || !apiKey.HasScope(Scope) || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		return c.Render(http.StatusUnauthorized, "login.html", "invalid key")
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     keyCookie,
+		Value:    key,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		// The UI changes the state with forms, a strict cookie is never sent by another site.
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int((8 * time.Hour).Seconds()),
+	})
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (s *server) logout(c echo.Context) error {
+	c.SetCookie(&http.Cookie{Name: keyCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func (s *server) index(c echo.Context) error {
+	return c.Render(http.StatusOK, "index.html", map[string]interface{}{
+		"Routes":   len(broute.Routes),
+		"Errors":   len(bean.RecentErrors()),
+		"Statuses": degrade.Statuses(),
+	})
+}
+
+func (s *server) routes(c echo.Context) error {
+	routes := append([]broute.Route(nil), broute.Routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+
+	return c.Render(http.StatusOK, "routes.html", routes)
+}
+
+// chain shows the middlewares executed before the handler of a route, or returns them as JSON with
+// `format=json`. The path can be a registered path or a request path.
+func (s *server) chain(c echo.Context) error {
+	method := strings.ToUpper(c.QueryParam("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := c.QueryParam("path")
+
+	if s.b.Echo == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no route matches "+method+" "+path)
+	}
+
+	chain, ok := s.b.MiddlewareChain(method, path)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "no route matches "+method+" "+path)
+	}
+
+	if c.QueryParam("format") == "json" {
+		return c.JSON(http.StatusOK, chain)
+	}
+
+	return c.Render(http.StatusOK, "chain.html", chain)
+}
+
+// configPage shows the settings loaded by viper, which are the env.json values and their overrides.
+func (s *server) configPage(c echo.Context) error {
+	b, err := json.MarshalIndent(Redact(viper.AllSettings()), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "config.html", string(b))
+}
+
+type tenantStatus struct {
+	Tenant string
+	MySQL  string
+	Mongo  string
+	Redis  string
+}
+
+func (s *server) tenants(c echo.Context) error {
+	deps := s.b.DBConn
+	if deps == nil {
+		return c.Render(http.StatusOK, "tenants.html", nil)
+	}
+
+	ctx := c.Request().Context()
+	rows := map[uint64]*tenantStatus{}
+	row := func(id uint64) *tenantStatus {
+		if _, ok := rows[id]; !ok {
+			rows[id] = &tenantStatus{Tenant: strconv.FormatUint(id, 10)}
+		}
+		return rows[id]
+	}
+
+	master := &tenantStatus{Tenant: "master"}
+	if deps.MasterMySQLDB != nil {
+		master.MySQL = s.ping(ctx, func(c context.Context) error {
+			sqlDB, err := deps.MasterMySQLDB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(c)
+		})
+	}
+	if deps.MasterMongoDB != nil {
+		master.Mongo = s.ping(ctx, func(c context.Context) error { return deps.MasterMongoDB.Ping(c, nil) })
+	}
+	if conn, ok := deps.MasterRedisDB[0]; ok && conn != nil {
+		master.Redis = s.ping(ctx, func(c context.Context) error { return conn.Client().Ping(c).Err() })
+	}
+
+	for id, db := range deps.TenantMySQLDBs {
+		db := db
+		row(id).MySQL = s.ping(ctx, func(c context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(c)
+		})
+	}
+	for id, client := range deps.TenantMongoDBs {
+		if client == nil {
+			continue
+		}
+		client := client
+		row(id).Mongo = s.ping(ctx, func(c context.Context) error { return client.Ping(c, nil) })
+	}
+	for id, conn := range deps.TenantRedisDBs {
+		if conn == nil {
+			continue
+		}
+		conn := conn
+		row(id).Redis = s.ping(ctx, func(c context.Context) error { return conn.Client().Ping(c).Err() })
+	}
+
+	list := []*tenantStatus{master}
+	ids := make([]uint64, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		list = append(list, rows[id])
+	}
+
+	return c.Render(http.StatusOK, "tenants.html", list)
+}
+
+func (s *server) ping(c context.Context, ping func(c context.Context) error) string {
+	ctx, cancel := context.WithTimeout(c, s.config.PingTimeout)
+	defer cancel()
+
+	if err := ping(ctx); err != nil {
+		return err.Error()
+	}
+
+	return "ok"
+}
+
+type metric struct {
+	Name   string
+	Labels string
+	Value  float64
+}
+
+// metrics shows the gauges and counters of bean from the default prometheus registry, which include the
+// database and goroutine pools.
+func (s *server) metrics(c echo.Context) error {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var list []metric
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "bean_") {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+
+			labels := make([]string, 0, len(m.GetLabel()))
+			for _, label := range m.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+
+			list = append(list, metric{Name: family.GetName(), Labels: strings.Join(labels, ", "), Value: value})
+		}
+	}
+
+	return c.Render(http.StatusOK, "metrics.html", list)
+}
+
+func (s *server) errors(c echo.Context) error {
+	return c.Render(http.StatusOK, "errors.html", bean.RecentErrors())
+}
+
+type taskHistory struct {
+	Query     url.Values          `json:"-"`
+	Summaries []async.TaskSummary `json:"summaries"`
+	Runs      []async.TaskRun     `json:"runs"`
+}
+
+// tasks shows the runs of the async tasks and their summary by task, or returns them as JSON with
+// `format=json`. They are filtered by `name`, `kind`, `outcome`, `since` (a duration like `24h` or a RFC
+// 3339 time) and `limit`.
+func (s *server) tasks(c echo.Context) error {
+	query := async.HistoryQuery{
+		Name:    c.QueryParam("name"),
+		Kind:    c.QueryParam("kind"),
+		Outcome: async.Outcome(c.QueryParam("outcome")),
+	}
+
+	if since := c.QueryParam("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			query.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			query.Since = t
+		} else {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid since")
+		}
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		query.Limit = n
+	}
+
+	runs, err := async.History(query)
+	if err != nil {
+		return err
+	}
+
+	history := taskHistory{Query: c.QueryParams(), Summaries: async.Summarize(runs), Runs: runs}
+	if c.QueryParam("format") == "json" {
+		return c.JSON(http.StatusOK, history)
+	}
+
+	return c.Render(http.StatusOK, "tasks.html", history)
+}
+
+type dependencyStatus struct {
+	Name string `json:"name"`
+	degrade.Status
+}
+
+// health shows the level of the dependencies, or returns them as JSON with `format=json`.
+func (s *server) health(c echo.Context) error {
+	statuses := degrade.Statuses()
+
+	list := make([]dependencyStatus, 0, len(statuses))
+	for name, status := range statuses {
+		list = append(list, dependencyStatus{Name: name, Status: status})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	if c.QueryParam("format") == "json" {
+		return c.JSON(http.StatusOK, list)
+	}
+
+	return c.Render(http.StatusOK, "health.html", list)
+}
+
+// forceHealth forces a dependency down, degraded or up, or gives it back to its checks.
+func (s *server) forceHealth(c echo.Context) error {
+	dependency := c.FormValue("dependency")
+	if dependency == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+
+	switch c.FormValue("action") {
+	case "down":
+		degrade.Force(dependency, false)
+	case "degraded":
+		degrade.ForceLevel(dependency, degrade.LevelDegraded)
+	case "up":
+		degrade.Force(dependency, true)
+	default:
+		degrade.Unforce(dependency)
+	}
+
+	if apiKey, ok := middleware.GetAPIKey(c); ok {
+		c.Logger().Warnf("admin: %s set %q to %q", apiKey.ID, dependency, c.FormValue("action"))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/health")
+}
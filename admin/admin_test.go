@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/degrade"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin(t *testing.T) {
+	b := &bean.Bean{}
+	b.Config.ProjectName = "test"
+	b.Config.Admin.APIKeys = []string{"admin-key"}
+
+	e, err := New(b, Config{})
+	assert.NoError(t, err)
+
+	// Without a key the pages redirect to the login.
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/login", rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"key": {"wrong"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"key": {"admin-key"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	cookie := rec.Result().Cookies()[0]
+	assert.Equal(t, keyCookie, cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/errors", nil)
+	req.AddCookie(cookie)
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Recent server errors")
+
+	// Force a dependency down with the header key.
+	defer degrade.Unforce("admin_test")
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/health", strings.NewReader(url.Values{"dependency": {"admin_test"}, "action": {"down"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.False(t, degrade.Healthy("admin_test"))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/health", strings.NewReader(url.Values{"dependency": {"admin_test"}, "action": {"degraded"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, degrade.LevelDegraded, degrade.LevelOf("admin_test"))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/health?format=json", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"admin_test","healthy":true,"level":"degraded"`)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), `<span class="warn">degraded</span> (forced)`)
+
+	// The history of the async tasks.
+	defer async.SetHistory(async.NewMemoryHistory(0))
+	async.SetHistory(async.NewMemoryHistory(10))
+	async.Record(async.TaskRun{Name: "nightly-sync", Kind: "execute", StartedAt: time.Now().Add(-time.Hour), Outcome: async.OutcomeSucceeded})
+	async.Record(async.TaskRun{Name: "nightly-sync", Kind: "execute", StartedAt: time.Now(), Outcome: async.OutcomeFailed, Error: "timeout"})
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/tasks?name=nightly&since=24h&format=json", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"nightly-sync","runs":2,"failures":1`)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/tasks?outcome=failed", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<option selected>failed</option>")
+	assert.Contains(t, rec.Body.String(), "timeout")
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/tasks?since=yesterday", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminRequiresKeys(t *testing.T) {
+	_, err := New(&bean.Bean{}, Config{})
+	assert.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	redacted := Redact(map[string]interface{}{
+		"secret": "s3cr3t",
+		"database": map[string]interface{}{
+			"mysql": map[string]interface{}{"master": map[string]interface{}{"password": "p", "host": "127.0.0.1"}},
+		},
+		"admin": map[string]interface{}{"apikeys": []interface{}{"k"}},
+		"jwt":   map[string]interface{}{"secret": ""},
+	})
+
+	assert.Equal(t, "****", redacted["secret"])
+	assert.Equal(t, map[string]interface{}{"password": "****", "host": "127.0.0.1"},
+		redacted["database"].(map[string]interface{})["mysql"].(map[string]interface{})["master"])
+	assert.Equal(t, "****", redacted["admin"].(map[string]interface{})["apikeys"])
+	assert.Equal(t, "", redacted["jwt"].(map[string]interface{})["secret"])
+}
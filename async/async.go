@@ -27,122 +27,251 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 	"github.com/retail-ai-inc/bean"
 	"github.com/retail-ai-inc/bean/gopool"
 	"github.com/retail-ai-inc/bean/helpers"
-	"github.com/spf13/viper"
 )
 
 type Task func(c echo.Context)
 
+// Options are the settings of the bean instance which the tasks use to log and to report to sentry.
+type Options struct {
+	Logger              echo.Logger
+	Sentry              bool
+	TracesSampleRate    float64
+	SkipTracesEndpoints []string
+}
+
+// OptionsOf returns the options of the bean instance `b`.
+func OptionsOf(b *bean.Bean) Options {
+	return Options{
+		Logger:              b.Logger(),
+		Sentry:              b.Config.Sentry.On,
+		TracesSampleRate:    b.Config.Sentry.TracesSampleRate,
+		SkipTracesEndpoints: b.Config.Sentry.SkipTracesEndpoints,
+	}
+}
+
+// options returns the options of the bean instance of the echo context `c`, or of the context `ctx`
+// otherwise. (see `bean.Of` and `bean.FromContext`) They fall back to the global config and logger of bean,
+// which is the case of the echo instances not created by `bean.New`.
+func options(c echo.Context, ctx context.Context) Options {
+	if c != nil {
+		if b := bean.Of(c.Echo()); b != nil {
+			return OptionsOf(b)
+		}
+	}
+
+	if b := bean.FromContext(ctx); b != nil {
+		return OptionsOf(b)
+	}
+
+	opts := Options{
+		Logger:              bean.BeanLogger,
+		Sentry:              bean.BeanConfig.Sentry.On,
+		TracesSampleRate:    bean.BeanConfig.Sentry.TracesSampleRate,
+		SkipTracesEndpoints: bean.BeanConfig.Sentry.SkipTracesEndpoints,
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New("async")
+	}
+
+	return opts
+}
+
 // `Execute` provides a safe way to execute a function asynchronously without any context, recovering if they panic
 // and provides all error stack aiming to facilitate fail causes discovery.
 func Execute(fn func(), poolName ...string) {
-	var asyncFunc = func(task func()) {
-		go func() {
-			defer recoverPanic(nil)
-			task()
-		}()
+	opts := options(nil, nil)
+	defer recoverPanic(nil, opts)
+
+	name := taskName(fn)
+	if err := submit(func() {
+		defer finishRun(nil, opts, name, KindExecute, time.Now())
+		fn()
+	}, opts, poolName...); err != nil {
+		panic(err)
+	}
+}
+
+// submit executes `fn` in a new goroutine, or in the goroutine pool if it's registered. It returns an error
+// if the pool refused the task. (example: the pool is closed or too many tasks are waiting)
+func submit(fn func(), opts Options, poolName ...string) error {
+	task := func() {
+		defer recoverPanic(nil, opts)
+		fn()
 	}
 
 	if len(poolName) > 0 {
 		pool, err := gopool.GetPool(poolName[0])
 		if err == nil && pool != nil {
-			asyncFunc = func(task func()) {
-				defer recoverPanic(nil)
-				err = pool.Submit(task)
-				if err != nil {
-					panic(err)
-				}
-			}
-		} else {
-			bean.Logger().Warnf("async func will execute without goroutine pool, the pool name is %q\n", poolName[0])
+			return pool.Submit(task)
 		}
+
+		opts.Logger.Warnf("async func will execute without goroutine pool, the pool name is %q\n", poolName[0])
 	}
 
-	asyncFunc(fn)
+	go task()
+
+	return nil
 }
 
 // `ExecuteWithContext` provides a safe way to execute a function asynchronously with a context, recovering if they panic
 // and provides all error stack aiming to facilitate fail causes discovery.
+//
+// The context is acquired from the pool of echo and released when `fn` returns, so `fn` must not keep it,
+// for example in another goroutine. The acquired contexts are tracked by `StartLeakDetector`, use
+// `ExecuteDetached` if the lifecycle of the task is not under control.
 func ExecuteWithContext(fn Task, c echo.Context, poolName ...string) {
+	opts := options(c, c.Request().Context())
+
 	// Acquire a context from echo.
 	ec := c.Echo().AcquireContext()
 
 	// IMPORTANT: Must reset before use.
 	ec.Reset(c.Request().WithContext(context.TODO()), nil)
+	name := taskName(fn)
+	track(ec, name, opts.Logger)
 
-	Execute(func() {
+	err := submit(func() {
+		// Release the acquired context, even if the sentry initialization panics. This defer will be executed last.
+		defer release(ec)
 
-		// IMPORTANT - Set the sentry hub key into the context so that `SentryCaptureException` and `SentryCaptureMessage`
-		// can pull the right hub and send the exception message to sentry.
-		if bean.BeanConfig.Sentry.On {
-			ctx := ec.Request().Context()
-			hub := sentry.GetHubFromContext(ctx)
-			if hub == nil {
-				hub = sentry.CurrentHub().Clone()
-			}
+		finish := startSentry(ec, opts)
+		defer finish()
 
-			hub.Scope().SetRequest(ec.Request())
-			ctx = sentry.SetHubOnContext(ctx, hub)
-			ec.Set(bean.SentryHubContextKey, hub)
+		// This defer will be executed first.
+		defer finishRun(ec, opts, name, KindContext, time.Now())
 
-			if helpers.FloatInRange(viper.GetFloat64("sentry.tracesSampleRate"), 0.0, 1.0) > 0.0 {
-				path := ec.Request().URL.Path
+		fn(ec)
+	}, opts, poolName...)
+
+	// The task will never be executed.
+	if err != nil {
+		release(ec)
+		opts.Logger.Error(err)
+	}
+}
 
-				span := sentry.StartSpan(ctx, "http",
-					sentry.TransactionName(fmt.Sprintf("%s %s ASYNC", ec.Request().Method, path)),
-					sentry.ContinueFromRequest(ec.Request()),
-				)
-				span.Description = helpers.CurrFuncName()
+// `ExecuteDetached` is same as `ExecuteWithContext` but `fn` gets its own echo context, which is not taken from
+// the pool of echo, with the path parameters of the request. The context of its request is canceled when `fn`
+// returns. The echo context can't be reused by another request, so it's safe even if `fn` leaves goroutines
+// using it behind.
+func ExecuteDetached(fn Task, c echo.Context, poolName ...string) {
+	opts := options(c, c.Request().Context())
+	ctx, cancel := context.WithCancel(context.Background())
 
-				// If `skipTracesEndpoints` has some path(s) then let's skip performance sample for those URI.
-				skipTracesEndpoints := viper.GetStringSlice("sentry.skipTracesEndpoints")
+	ec := c.Echo().NewContext(c.Request().Clone(ctx), nil)
+	ec.SetPath(c.Path())
+	ec.SetParamNames(c.ParamNames()...)
+	ec.SetParamValues(c.ParamValues()...)
 
-				for _, endpoint := range skipTracesEndpoints {
-					if regexp.MustCompile(endpoint).MatchString(path) {
-						span.Sampled = sentry.SampledFalse
-						break
-					}
-				}
+	name := taskName(fn)
+	err := submit(func() {
+		defer cancel()
 
-				defer span.Finish()
-				r := ec.Request().WithContext(span.Context())
-				ec.SetRequest(r)
+		finish := startSentry(ec, opts)
+		defer finish()
+
+		defer finishRun(ec, opts, name, KindDetached, time.Now())
+
+		fn(ec)
+	}, opts, poolName...)
+
+	if err != nil {
+		cancel()
+		opts.Logger.Error(err)
+	}
+}
+
+// startSentry sets the sentry hub into the context of the task and starts its transaction. The returned
+// function finishes the transaction.
+func startSentry(ec echo.Context, opts Options) (finish func()) {
+	finish = func() {}
+
+	// IMPORTANT - Set the sentry hub key into the context so that `SentryCaptureException` and `SentryCaptureMessage`
+	// can pull the right hub and send the exception message to sentry.
+	if !opts.Sentry {
+		return
+	}
+
+	ctx := ec.Request().Context()
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+
+	hub.Scope().SetRequest(ec.Request())
+	ctx = sentry.SetHubOnContext(ctx, hub)
+	ec.Set(bean.SentryHubContextKey, hub)
+
+	if helpers.FloatInRange(opts.TracesSampleRate, 0.0, 1.0) > 0.0 {
+		path := ec.Request().URL.Path
+
+		span := sentry.StartSpan(ctx, "http",
+			sentry.TransactionName(fmt.Sprintf("%s %s ASYNC", ec.Request().Method, path)),
+			sentry.ContinueFromRequest(ec.Request()),
+		)
+		span.Description = helpers.CurrFuncName()
+
+		// If `skipTracesEndpoints` has some path(s) then let's skip performance sample for those URI.
+		for _, endpoint := range opts.SkipTracesEndpoints {
+			if regexp.MustCompile(endpoint).MatchString(path) {
+				span.Sampled = sentry.SampledFalse
+				break
 			}
 		}
 
-		// Release the acquired context. This defer will be executed second.
-		defer ec.Echo().ReleaseContext(ec)
+		r := ec.Request().WithContext(span.Context())
+		ec.SetRequest(r)
 
-		// This defer will be executed first.
-		defer recoverPanic(ec)
+		return span.Finish
+	}
 
-		fn(ec)
-	}, poolName...)
+	return
 }
 
 // Recover the panic and send the exception to sentry.
-func recoverPanic(c echo.Context) {
+func recoverPanic(c echo.Context, opts Options) {
 	if err := recover(); err != nil {
-		// Create a new Hub by cloning the existing one.
-		if bean.BeanConfig.Sentry.On {
-			localHub := sentry.CurrentHub().Clone()
+		capturePanic(c, err, opts)
+		opts.Logger.Error(err)
+	}
+}
 
-			if c != nil {
-				localHub.Scope().SetRequest(c.Request())
-			}
+// finishRun recovers the panic of a task like `recoverPanic` and records its run in the history.
+func finishRun(c echo.Context, opts Options, name, kind string, start time.Time) {
+	var err error
+	if r := recover(); r != nil {
+		capturePanic(c, r, opts)
+		opts.Logger.Error(r)
+		err = &PanicError{Value: r}
+	}
 
-			localHub.ConfigureScope(func(scope *sentry.Scope) {
-				scope.SetTag("goroutine", "true")
-			})
+	recordRun(opts, name, kind, start, err)
+}
 
-			localHub.Recover(err)
-		}
+// capturePanic sends the recovered panic `err` to sentry.
+func capturePanic(c echo.Context, err interface{}, opts Options) {
+	if !opts.Sentry {
+		return
+	}
 
-		bean.Logger().Error(err)
+	// Create a new Hub by cloning the existing one.
+	localHub := sentry.CurrentHub().Clone()
+
+	if c != nil {
+		localHub.Scope().SetRequest(c.Request())
 	}
+
+	localHub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("goroutine", "true")
+	})
+
+	localHub.Recover(err)
 }
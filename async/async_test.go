@@ -0,0 +1,32 @@
+package async
+
+import (
+	"context"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	e := echo.New()
+	out := new(logBuffer)
+	e.Logger.SetOutput(out)
+
+	b := &bean.Bean{Echo: e}
+	b.Config.Sentry.TracesSampleRate = 0.5
+	ctx := bean.WithContext(context.Background(), b)
+
+	opts := options(nil, ctx)
+	assert.Same(t, e.Logger, opts.Logger)
+	assert.Equal(t, 0.5, opts.TracesSampleRate)
+
+	// Without a bean instance, the global logger is used.
+	assert.Same(t, bean.BeanLogger, options(nil, context.Background()).Logger)
+
+	_, err := Go(ctx, func(ctx context.Context) (int, error) { panic("instance") }).Wait()
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "instance")
+	assert.NotContains(t, testLog.String(), "instance")
+}
@@ -0,0 +1,131 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package async
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/retail-ai-inc/bean"
+)
+
+// PanicError is the error of a `Future` whose function panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("async: panic: %v", e.Value)
+}
+
+// Future is the handle of a function executed by `Go`.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Go executes `fn` in a safe goroutine, or in the goroutine pool if it's registered, and returns its
+// future. A panic of `fn` is recovered, sent to sentry and returned as a `*PanicError` by `Wait`.
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error), poolName ...string) *Future[T] {
+	return goTask(ctx, taskName(fn), fn, poolName...)
+}
+
+// goTask is `Go` recording the run of `fn` in the history under `name`.
+func goTask[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error), poolName ...string) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	opts := options(nil, ctx)
+
+	err := submit(func() {
+		defer close(f.done)
+
+		start := time.Now()
+		defer func() { recordRun(opts, name, KindFuture, start, f.err) }()
+
+		defer func() {
+			if r := recover(); r != nil {
+				f.err = &PanicError{Value: r, Stack: debug.Stack()}
+				capturePanic(nil, r, opts)
+				bean.LoggerWithContext(ctx).Error(f.err)
+			}
+		}()
+
+		f.value, f.err = fn(ctx)
+	}, opts, poolName...)
+
+	// The task will never be executed.
+	if err != nil {
+		f.err = err
+		close(f.done)
+	}
+
+	return f
+}
+
+// Done returns a channel which is closed when the function of the future returns.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the function of the future returns and returns its result.
+func (f *Future[T]) Wait() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// WaitContext is same as `Wait` but returns the error of `ctx` if it's done before the function returns.
+func (f *Future[T]) WaitContext(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Err blocks until the function of the future returns and returns its error.
+func (f *Future[T]) Err() error {
+	<-f.done
+	return f.err
+}
+
+// ExecuteWithTimeout executes `fn` in a safe goroutine and waits for it at most `d`. The context of `fn` is
+// canceled after `d` or when `ctx` is done, then `context.DeadlineExceeded` or `context.Canceled` is returned
+// without waiting for `fn` any longer, so `fn` must respect its context. A panic of `fn` is returned as a
+// `*PanicError`.
+func ExecuteWithTimeout(ctx context.Context, fn func(ctx context.Context) error, d time.Duration, poolName ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	f := goTask(ctx, taskName(fn), func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, poolName...)
+
+	_, err := f.WaitContext(ctx)
+
+	return err
+}
@@ -0,0 +1,91 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGo(t *testing.T) {
+	f := Go(context.Background(), func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+
+	v, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.NoError(t, f.Err())
+
+	errFailed := errors.New("failed")
+	f = Go(context.Background(), func(ctx context.Context) (int, error) {
+		return 0, errFailed
+	})
+	assert.ErrorIs(t, f.Err(), errFailed)
+}
+
+func TestGoPanic(t *testing.T) {
+	f := Go(context.Background(), func(ctx context.Context) (string, error) {
+		panic("boom")
+	})
+
+	_, err := f.Wait()
+
+	var panicErr *PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+	assert.Contains(t, testLog.String(), "async: panic: boom")
+}
+
+func TestFutureWaitContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	f := Go(context.Background(), func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := f.WaitContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case <-f.Done():
+		t.Fatal("the future must not be done yet")
+	default:
+	}
+}
+
+func TestExecuteWithTimeout(t *testing.T) {
+	err := ExecuteWithTimeout(context.Background(), func(ctx context.Context) error {
+		return nil
+	}, time.Second)
+	assert.NoError(t, err)
+
+	canceled := make(chan struct{})
+	err = ExecuteWithTimeout(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}, 10*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("the context of the function must be canceled")
+	}
+
+	err = ExecuteWithTimeout(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	}, time.Second)
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr)
+}
@@ -0,0 +1,227 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/trace"
+)
+
+// GroupConfig defines the config for `NewGroup`.
+type GroupConfig struct {
+	// Limit is the number of tasks running at the same time, `Go` blocks until a task finishes if it's reached.
+	// Optional. Default value 0, no limit.
+	Limit int
+
+	// Pool is the name of the goroutine pool which executes the tasks.
+	// Optional. Default value "", a new goroutine per task.
+	Pool string
+
+	// AllErrors makes `Wait` return the errors of all the tasks as a `*GroupError`. Otherwise the first error
+	// cancels the context of the group, like errgroup, and is the only one returned.
+	// Optional. Default value false.
+	AllErrors bool
+
+	// Operation of the tracing span of each task.
+	// Optional. Default value "async.task".
+	Operation string
+}
+
+// GroupError holds the errors of the tasks of a group in `AllErrors` mode.
+type GroupError struct {
+	Errors []error
+}
+
+func (e *GroupError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Is makes `errors.Is` match any of the errors of the tasks.
+func (e *GroupError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As makes `errors.As` match the first matching error of the tasks.
+func (e *GroupError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Group runs tasks in safe goroutines and waits for them. A panic of a task is recovered, sent to sentry
+// and returned as a `*PanicError`. Each task has its own clone of the sentry hub of the context and a
+// tracing span.
+type Group struct {
+	config GroupConfig
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewGroup returns a group and its context, which is canceled when a task fails unless `AllErrors` is on,
+// or when `Wait` returns.
+func NewGroup(ctx context.Context, config GroupConfig) (*Group, context.Context) {
+	if config.Operation == "" {
+		config.Operation = "async.task"
+	}
+
+	g := &Group{config: config, opts: options(nil, ctx)}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+
+	if config.Limit > 0 {
+		g.sem = make(chan struct{}, config.Limit)
+	}
+
+	return g, g.ctx
+}
+
+// Go runs `fn` with the context of the group.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+
+	err := submit(func() {
+		defer g.done()
+		g.fail(g.run(fn))
+	}, g.opts, g.poolName()...)
+
+	// The task will never be executed.
+	if err != nil {
+		g.fail(err)
+		g.done()
+	}
+}
+
+// Wait blocks until all the tasks return and returns their error(s).
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.errs) == 0 {
+		return nil
+	}
+
+	if !g.config.AllErrors {
+		return g.errs[0]
+	}
+
+	return &GroupError{Errors: append([]error{}, g.errs...)}
+}
+
+func (g *Group) run(fn func(ctx context.Context) error) (err error) {
+	ctx := g.ctx
+
+	var hub *sentry.Hub
+	if g.opts.Sentry {
+		hub = sentry.GetHubFromContext(ctx)
+		if hub == nil {
+			hub = sentry.CurrentHub()
+		}
+		hub = hub.Clone()
+		ctx = sentry.SetHubOnContext(ctx, hub)
+	}
+
+	tctx := trace.NewTraceableContext(ctx)
+	finish := trace.Start(tctx, g.config.Operation)
+	defer finish()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+
+			if hub != nil {
+				hub.ConfigureScope(func(scope *sentry.Scope) {
+					scope.SetTag("goroutine", "true")
+				})
+				hub.Recover(r)
+			}
+
+			bean.LoggerWithContext(ctx).Error(err)
+		}
+	}()
+
+	return fn(tctx)
+}
+
+func (g *Group) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+
+	if !g.config.AllErrors {
+		g.cancel()
+	}
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+
+	g.wg.Done()
+}
+
+func (g *Group) poolName() []string {
+	if g.config.Pool == "" {
+		return nil
+	}
+
+	return []string{g.config.Pool}
+}
@@ -0,0 +1,77 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupLimit(t *testing.T) {
+	g, _ := NewGroup(context.Background(), GroupConfig{Limit: 2})
+
+	var running, max int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+
+	assert.NoError(t, g.Wait())
+	assert.LessOrEqual(t, max, int32(2))
+}
+
+func TestGroupFirstError(t *testing.T) {
+	errFailed := errors.New("failed")
+	g, ctx := NewGroup(context.Background(), GroupConfig{})
+
+	g.Go(func(ctx context.Context) error {
+		return errFailed
+	})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.ErrorIs(t, g.Wait(), errFailed)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestGroupAllErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	g, _ := NewGroup(context.Background(), GroupConfig{AllErrors: true})
+
+	g.Go(func(ctx context.Context) error {
+		return errFailed
+	})
+	g.Go(func(ctx context.Context) error {
+		panic("boom")
+	})
+	g.Go(func(ctx context.Context) error {
+		return nil
+	})
+
+	err := g.Wait()
+
+	var groupErr *GroupError
+	if assert.ErrorAs(t, err, &groupErr) {
+		assert.Len(t, groupErr.Errors, 2)
+	}
+
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.ErrorIs(t, err, errFailed)
+}
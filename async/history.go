@@ -0,0 +1,378 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package async
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo/v4"
+)
+
+// Outcome is the result of a task run.
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "succeeded"
+	OutcomeFailed    Outcome = "failed"
+	OutcomePanicked  Outcome = "panicked"
+)
+
+// The kinds of the task runs recorded by the package, and by the `History` middleware of `messaging` for
+// `KindQueue`.
+const (
+	KindExecute  = "execute"
+	KindContext  = "context"
+	KindDetached = "detached"
+	KindFuture   = "future"
+	KindQueue    = "queue"
+)
+
+// TaskRun is a run of a task kept in the history.
+type TaskRun struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Kind is how the task was executed, e.g. `execute` or `queue`.
+	Kind      string        `json:"kind"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Outcome   Outcome       `json:"outcome"`
+	// Attempt is 1 for the first run of a task, more for the retries.
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error,omitempty"`
+	// Fingerprint groups the errors which only differ by their IDs and numbers. (see `Fingerprint`)
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// HistoryQuery filters the task runs of `History`.
+type HistoryQuery struct {
+	// Name matches the task names containing it.
+	Name    string
+	Kind    string
+	Outcome Outcome
+	Since   time.Time
+	// Limit is the maximum number of runs, the most recent first.
+	// Optional. Default value 100.
+	Limit int
+}
+
+func (q HistoryQuery) match(run TaskRun) bool {
+	return (q.Name == "" || strings.Contains(run.Name, q.Name)) &&
+		(q.Kind == "" || run.Kind == q.Kind) &&
+		(q.Outcome == "" || run.Outcome == q.Outcome) &&
+		(q.Since.IsZero() || !run.StartedAt.Before(q.Since))
+}
+
+func (q HistoryQuery) limit() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return q.Limit
+}
+
+// HistoryStore keeps the task runs.
+type HistoryStore interface {
+	Add(run TaskRun) error
+	// Query returns the runs matching `q`, the most recent first.
+	Query(q HistoryQuery) ([]TaskRun, error)
+}
+
+var (
+	historyMu    sync.RWMutex
+	historyStore HistoryStore = NewMemoryHistory(0)
+	runSeq       uint64
+)
+
+// SetHistory replaces the store of the task runs, a `MemoryHistory` of 1000 runs by default. A nil store
+// disables the history.
+func SetHistory(store HistoryStore) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	historyStore = store
+}
+
+// Record adds a run to the history, e.g. the runs of the queue handlers or of the scheduled jobs. The ID,
+// the attempt and the fingerprint are set if they are empty.
+func Record(run TaskRun) {
+	record(run, options(nil, nil).Logger)
+}
+
+// record adds a run to the history, the failure of the store is logged by `logger`.
+func record(run TaskRun, logger echo.Logger) {
+	historyMu.RLock()
+	store := historyStore
+	historyMu.RUnlock()
+
+	if store == nil {
+		return
+	}
+
+	if run.ID == "" {
+		run.ID = fmt.Sprintf("%x-%x", run.StartedAt.UnixNano(), atomic.AddUint64(&runSeq, 1))
+	}
+	if run.Attempt <= 0 {
+		run.Attempt = 1
+	}
+	if run.Error != "" && run.Fingerprint == "" {
+		run.Fingerprint = Fingerprint(run.Error)
+	}
+
+	if err := store.Add(run); err != nil {
+		logger.Errorf("async: failed to record the run of %s: %v", run.Name, err)
+	}
+}
+
+// History returns the task runs matching `q`, the most recent first.
+func History(q HistoryQuery) ([]TaskRun, error) {
+	historyMu.RLock()
+	store := historyStore
+	historyMu.RUnlock()
+
+	if store == nil {
+		return nil, nil
+	}
+
+	return store.Query(q)
+}
+
+// recordRun records the run of `name` started at `start` with its error, a `*PanicError` if it panicked.
+// The failure of the store is logged by the logger of `opts`.
+func recordRun(opts Options, name, kind string, start time.Time, err error) {
+	run := TaskRun{Name: name, Kind: kind, StartedAt: start, Duration: time.Since(start), Outcome: OutcomeSucceeded}
+
+	if err != nil {
+		run.Outcome = OutcomeFailed
+		run.Error = err.Error()
+		if panicErr, ok := err.(*PanicError); ok {
+			run.Outcome = OutcomePanicked
+			run.Error = fmt.Sprint(panicErr.Value)
+		}
+	}
+
+	record(run, opts.Logger)
+}
+
+// TaskSummary sums up the runs of a task, e.g. to check that a nightly job has run.
+type TaskSummary struct {
+	Name        string    `json:"name"`
+	Runs        int       `json:"runs"`
+	Failures    int       `json:"failures"`
+	LastRun     time.Time `json:"lastRun"`
+	LastOutcome Outcome   `json:"lastOutcome"`
+	// LastSuccess is zero if no run has succeeded.
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Summarize sums up `runs` by task name, ordered by name.
+func Summarize(runs []TaskRun) []TaskSummary {
+	summaries := map[string]*TaskSummary{}
+	for _, run := range runs {
+		s, ok := summaries[run.Name]
+		if !ok {
+			s = &TaskSummary{Name: run.Name}
+			summaries[run.Name] = s
+		}
+
+		s.Runs++
+		if run.StartedAt.After(s.LastRun) {
+			s.LastRun, s.LastOutcome = run.StartedAt, run.Outcome
+		}
+		if run.Outcome == OutcomeSucceeded {
+			if run.StartedAt.After(s.LastSuccess) {
+				s.LastSuccess = run.StartedAt
+			}
+			continue
+		}
+
+		s.Failures++
+		if s.LastError == "" || run.StartedAt.Equal(s.LastRun) {
+			s.LastError = run.Error
+		}
+	}
+
+	list := make([]TaskSummary, 0, len(summaries))
+	for _, s := range summaries {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// variableParts matches the parts of an error message which change between the runs: the UUIDs, the hex
+// IDs and the numbers.
+var variableParts = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|\b[0-9a-fA-F]*[0-9][0-9a-fA-F]*\b|\d+`)
+
+// Fingerprint returns a short hash of an error message without its IDs and numbers, so that the same
+// failure of different runs has the same fingerprint.
+func Fingerprint(message string) string {
+	sum := sha1.Sum([]byte(variableParts.ReplaceAllString(message, "#")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// MemoryHistory keeps the last runs in a ring buffer.
+type MemoryHistory struct {
+	mu   sync.Mutex
+	runs []TaskRun
+	next int
+	full bool
+}
+
+// NewMemoryHistory returns a history of the last `size` runs, 1000 if `size` is 0.
+func NewMemoryHistory(size int) *MemoryHistory {
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &MemoryHistory{runs: make([]TaskRun, size)}
+}
+
+// Add implements `HistoryStore`.
+func (h *MemoryHistory) Add(run TaskRun) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs[h.next] = run
+	h.next = (h.next + 1) % len(h.runs)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	return nil
+}
+
+// Query implements `HistoryStore`.
+func (h *MemoryHistory) Query(q HistoryQuery) ([]TaskRun, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.runs)
+	}
+
+	var runs []TaskRun
+	for i := 1; i <= n && len(runs) < q.limit(); i++ {
+		run := h.runs[(h.next-i+len(h.runs))%len(h.runs)]
+		if q.match(run) {
+			runs = append(runs, run)
+		}
+	}
+
+	// The runs are added when they finish, order them by start.
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+
+	return runs, nil
+}
+
+// BadgerHistory keeps the runs in the memory database for `ttl`, so that they survive a restart of the
+// process. The runs are not shared between the replicas.
+type BadgerHistory struct {
+	db     *badger.DB
+	prefix string
+	ttl    time.Duration
+}
+
+// NewBadgerHistory returns a history in the memory database `db`. The prefix is "async:history:" if
+// `prefix` is empty, the runs are kept for 7 days if `ttl` is 0.
+func NewBadgerHistory(db *badger.DB, prefix string, ttl time.Duration) *BadgerHistory {
+	if prefix == "" {
+		prefix = "async:history:"
+	}
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	return &BadgerHistory{db: db, prefix: prefix, ttl: ttl}
+}
+
+// key orders the runs by start, then by ID.
+func (h *BadgerHistory) key(run TaskRun) []byte {
+	var start [8]byte
+	binary.BigEndian.PutUint64(start[:], uint64(run.StartedAt.UnixNano()))
+
+	key := make([]byte, 0, len(h.prefix)+len(start)+len(run.ID))
+	key = append(key, h.prefix...)
+	key = append(key, start[:]...)
+
+	return append(key, run.ID...)
+}
+
+// Add implements `HistoryStore`.
+func (h *BadgerHistory) Add(run TaskRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(h.key(run), data).WithTTL(h.ttl))
+	})
+}
+
+// Query implements `HistoryStore`.
+func (h *BadgerHistory) Query(q HistoryQuery) ([]TaskRun, error) {
+	var runs []TaskRun
+
+	err := h.db.View(func(txn *badger.Txn) error {
+		options := badger.DefaultIteratorOptions
+		options.Reverse = true
+		options.Prefix = []byte(h.prefix)
+
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		// The reverse iteration starts from the greatest key of the prefix.
+		for it.Seek(append([]byte(h.prefix), 0xff)); it.Valid() && len(runs) < q.limit(); it.Next() {
+			var run TaskRun
+			if err := it.Item().Value(func(data []byte) error {
+				return json.Unmarshal(data, &run)
+			}); err != nil {
+				return err
+			}
+
+			if !q.Since.IsZero() && run.StartedAt.Before(q.Since) {
+				break
+			}
+			if q.match(run) {
+				runs = append(runs, run)
+			}
+		}
+
+		return nil
+	})
+
+	return runs, err
+}
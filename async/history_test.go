@@ -0,0 +1,120 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useHistory(t *testing.T, store HistoryStore) {
+	SetHistory(store)
+	t.Cleanup(func() { SetHistory(NewMemoryHistory(0)) })
+}
+
+func nightlySync() {}
+
+func TestHistoryRecordsTasks(t *testing.T) {
+	useHistory(t, NewMemoryHistory(10))
+
+	done := make(chan struct{})
+	Execute(func() {
+		defer close(done)
+		nightlySync()
+	})
+	<-done
+
+	_, err := Go(context.Background(), func(ctx context.Context) (int, error) { return 0, errors.New("order 42 not found") }).Wait()
+	require.Error(t, err)
+	_, err = Go(context.Background(), func(ctx context.Context) (int, error) { panic("boom") }).Wait()
+	require.Error(t, err)
+
+	assert.Eventually(t, func() bool {
+		runs, _ := History(HistoryQuery{})
+		return len(runs) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	runs, err := History(HistoryQuery{Kind: KindFuture, Outcome: OutcomeFailed})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "order 42 not found", runs[0].Error)
+	assert.Equal(t, Fingerprint("order 7 not found"), runs[0].Fingerprint)
+	assert.Equal(t, 1, runs[0].Attempt)
+	assert.Contains(t, runs[0].Name, "async.TestHistoryRecordsTasks")
+
+	runs, err = History(HistoryQuery{Outcome: OutcomePanicked})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "boom", runs[0].Error)
+
+	runs, err = History(HistoryQuery{Kind: KindExecute})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, OutcomeSucceeded, runs[0].Outcome)
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, Fingerprint("user 12 timeout after 30s"), Fingerprint("user 345 timeout after 31s"))
+	assert.Equal(t, Fingerprint("job 3f2a1c9e-8d4b-4c1a-9e2f-1a2b3c4d5e6f failed"), Fingerprint("job 00000000-8d4b-4c1a-9e2f-1a2b3c4d5e6f failed"))
+	assert.NotEqual(t, Fingerprint("connection refused"), Fingerprint("connection reset"))
+	assert.Len(t, Fingerprint("connection refused"), 12)
+}
+
+func testHistoryStore(t *testing.T, store HistoryStore) {
+	now := time.Now()
+	for i, name := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Add(TaskRun{ID: name, Name: "task-" + name, StartedAt: now.Add(time.Duration(i) * time.Minute), Outcome: OutcomeSucceeded}))
+	}
+
+	runs, err := store.Query(HistoryQuery{})
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, []string{"task-c", "task-b", "task-a"}, []string{runs[0].Name, runs[1].Name, runs[2].Name})
+
+	runs, err = store.Query(HistoryQuery{Name: "task-a"})
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	runs, err = store.Query(HistoryQuery{Since: now.Add(time.Minute), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "task-c", runs[0].Name)
+}
+
+func TestMemoryHistory(t *testing.T) {
+	testHistoryStore(t, NewMemoryHistory(0))
+
+	// The oldest runs are dropped by the ring buffer.
+	store := NewMemoryHistory(2)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Add(TaskRun{Name: name, StartedAt: time.Now()}))
+	}
+	runs, err := store.Query(HistoryQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, []string{runs[0].Name, runs[1].Name})
+}
+
+func TestBadgerHistory(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	testHistoryStore(t, NewBadgerHistory(db, "", 0))
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Now()
+	summaries := Summarize([]TaskRun{
+		{Name: "sync", StartedAt: now, Outcome: OutcomeFailed, Error: "timeout"},
+		{Name: "sync", StartedAt: now.Add(-24 * time.Hour), Outcome: OutcomeSucceeded},
+		{Name: "mail", StartedAt: now, Outcome: OutcomeSucceeded},
+	})
+
+	require.Len(t, summaries, 2)
+	assert.Equal(t, TaskSummary{Name: "mail", Runs: 1, LastRun: now, LastOutcome: OutcomeSucceeded, LastSuccess: now}, summaries[0])
+	assert.Equal(t, TaskSummary{Name: "sync", Runs: 2, Failures: 1, LastRun: now, LastOutcome: OutcomeFailed, LastSuccess: now.Add(-24 * time.Hour), LastError: "timeout"}, summaries[1])
+}
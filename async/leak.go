@@ -0,0 +1,215 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package async
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LeakDetectorConfig defines the config for `StartLeakDetector`.
+type LeakDetectorConfig struct {
+	// Threshold is the age after which a context acquired by `ExecuteWithContext` and not released yet is
+	// reported as leaked.
+	// Optional. Default value 1 minute.
+	Threshold time.Duration
+
+	// Interval between two checks.
+	// Optional. Default value 30 seconds.
+	Interval time.Duration
+}
+
+// DefaultLeakDetectorConfig is the default config of `StartLeakDetector`.
+var DefaultLeakDetectorConfig = LeakDetectorConfig{
+	Threshold: time.Minute,
+	Interval:  30 * time.Second,
+}
+
+// Acquisition is an echo context acquired from the pool of echo by `ExecuteWithContext` and not released yet.
+type Acquisition struct {
+	Task       string
+	Method     string
+	Path       string
+	AcquiredAt time.Time
+}
+
+// ContextStats are the counters of the echo contexts acquired by `ExecuteWithContext`.
+type ContextStats struct {
+	Acquired uint64
+	Released uint64
+	InFlight int
+}
+
+type acquisition struct {
+	Acquisition
+	reported bool
+	logger   echo.Logger // The logger of the bean instance of the task.
+}
+
+var (
+	acquisitionsMu sync.Mutex
+	acquisitions   = map[echo.Context]*acquisition{}
+	acquiredTotal  uint64
+	releasedTotal  uint64
+)
+
+// track records a context acquired from the pool of echo.
+func track(ec echo.Context, task string, logger echo.Logger) {
+	acquisitionsMu.Lock()
+	defer acquisitionsMu.Unlock()
+
+	acquiredTotal++
+	acquisitions[ec] = &acquisition{Acquisition: Acquisition{
+		Task:       task,
+		Method:     ec.Request().Method,
+		Path:       ec.Request().URL.Path,
+		AcquiredAt: time.Now(),
+	}, logger: logger}
+}
+
+// release puts the context back into the pool of echo. A context released twice would be handed to two
+// requests at the same time, so the second release is ignored.
+func release(ec echo.Context) {
+	acquisitionsMu.Lock()
+	a, ok := acquisitions[ec]
+	if ok {
+		delete(acquisitions, ec)
+		releasedTotal++
+	}
+	acquisitionsMu.Unlock()
+
+	if !ok {
+		options(ec, nil).Logger.Errorf("async: echo context released twice or not acquired by `ExecuteWithContext`")
+		return
+	}
+
+	if a.reported {
+		a.logger.Warnf("async: leaked echo context of task %s (%s %s) released after %s",
+			a.Task, a.Method, a.Path, time.Since(a.AcquiredAt).Round(time.Millisecond))
+	}
+
+	ec.Echo().ReleaseContext(ec)
+}
+
+// Leaks returns the contexts acquired by `ExecuteWithContext` for longer than `threshold`, oldest first.
+func Leaks(threshold time.Duration) []Acquisition {
+	acquisitionsMu.Lock()
+	defer acquisitionsMu.Unlock()
+
+	var leaks []Acquisition
+	for _, a := range acquisitions {
+		if time.Since(a.AcquiredAt) >= threshold {
+			leaks = append(leaks, a.Acquisition)
+		}
+	}
+
+	sort.Slice(leaks, func(i, j int) bool {
+		return leaks[i].AcquiredAt.Before(leaks[j].AcquiredAt)
+	})
+
+	return leaks
+}
+
+// Stats returns the counters of the contexts acquired by `ExecuteWithContext`.
+func Stats() ContextStats {
+	acquisitionsMu.Lock()
+	defer acquisitionsMu.Unlock()
+
+	return ContextStats{
+		Acquired: acquiredTotal,
+		Released: releasedTotal,
+		InFlight: len(acquisitions),
+	}
+}
+
+// StartLeakDetector logs the contexts acquired by `ExecuteWithContext` for longer than the threshold, once
+// per context, until `ctx` is done. A leaked context is never reused by echo, but a task which keeps
+// using its context after the release corrupts the next request, use `ExecuteDetached` for such tasks.
+func StartLeakDetector(ctx context.Context, config LeakDetectorConfig) {
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultLeakDetectorConfig.Threshold
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultLeakDetectorConfig.Interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				detectLeaks(config.Threshold)
+			}
+		}
+	}()
+}
+
+// detectLeaks logs the contexts older than `threshold` which haven't been reported yet.
+func detectLeaks(threshold time.Duration) int {
+	acquisitionsMu.Lock()
+	var leaks []*acquisition
+	for _, a := range acquisitions {
+		if !a.reported && time.Since(a.AcquiredAt) >= threshold {
+			a.reported = true
+			leaks = append(leaks, a)
+		}
+	}
+	acquisitionsMu.Unlock()
+
+	for _, leak := range leaks {
+		leak.logger.Warnf("async: echo context of task %s (%s %s) not released after %s",
+			leak.Task, leak.Method, leak.Path, time.Since(leak.AcquiredAt).Round(time.Second))
+	}
+
+	return len(leaks)
+}
+
+// closureSuffix matches the suffix of the anonymous functions, like `.func1.2`.
+var closureSuffix = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+// taskName returns the name of the function of a task, like `main.(*service).SendMail`. The anonymous
+// functions are named after the function declaring them.
+func taskName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "unknown"
+	}
+
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return "unknown"
+	}
+
+	return closureSuffix.ReplaceAllString(f.Name(), "")
+}
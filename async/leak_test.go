@@ -0,0 +1,133 @@
+package async
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/retail-ai-inc/bean"
+	"github.com/stretchr/testify/assert"
+)
+
+// logBuffer is the output of the logger, written by the tasks while the tests read it.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+var testLog = new(logBuffer)
+
+func init() {
+	e := echo.New()
+	e.Logger.SetOutput(testLog)
+	e.Logger.SetLevel(log.DEBUG)
+	bean.BeanLogger = e.Logger
+}
+
+func newTestContext() (echo.Context, *logBuffer) {
+	e := echo.New()
+	out := testLog
+
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/orders/1", nil), httptest.NewRecorder())
+	c.SetPath("/orders/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	return c, out
+}
+
+func sendMail(c echo.Context) {}
+
+func TestExecuteWithContextReleases(t *testing.T) {
+	c, _ := newTestContext()
+	before := Stats()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	ExecuteWithContext(func(c echo.Context) { defer wg.Done() }, c)
+	ExecuteWithContext(func(c echo.Context) {
+		defer wg.Done()
+		panic("boom")
+	}, c)
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		stats := Stats()
+		return stats.Acquired-before.Acquired == 2 && stats.Released-before.Released == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestLeakDetector(t *testing.T) {
+	c, out := newTestContext()
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	ExecuteWithContext(func(c echo.Context) {
+		defer close(finished)
+		<-done
+	}, c)
+
+	assert.Eventually(t, func() bool { return len(Leaks(0)) == 1 }, time.Second, time.Millisecond)
+	leak := Leaks(0)[0]
+	assert.Equal(t, "github.com/retail-ai-inc/bean/async.TestLeakDetector", leak.Task)
+	assert.Equal(t, "/orders/1", leak.Path)
+	assert.Empty(t, Leaks(time.Hour))
+
+	assert.Equal(t, 1, detectLeaks(0))
+	assert.Equal(t, 0, detectLeaks(0), "a leak is reported once")
+	assert.Contains(t, out.String(), "TestLeakDetector (POST /orders/1) not released")
+
+	close(done)
+	<-finished
+	assert.Eventually(t, func() bool { return strings.Contains(out.String(), "released after") }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, Stats().InFlight)
+}
+
+func TestExecuteDetached(t *testing.T) {
+	c, _ := newTestContext()
+	before := Stats()
+
+	type result struct {
+		id, path string
+		canceled bool
+	}
+	got := make(chan result, 1)
+	var detached echo.Context
+
+	ExecuteDetached(func(ec echo.Context) {
+		detached = ec
+		go func() {
+			<-ec.Request().Context().Done()
+			got <- result{id: ec.Param("id"), path: ec.Path(), canceled: true}
+		}()
+	}, c)
+
+	r := <-got
+	assert.Equal(t, result{id: "1", path: "/orders/:id", canceled: true}, r)
+	assert.NotSame(t, c, detached)
+	assert.Equal(t, before, Stats(), "the detached contexts are not taken from the pool")
+}
+
+func TestTaskName(t *testing.T) {
+	assert.Equal(t, "github.com/retail-ai-inc/bean/async.sendMail", taskName(Task(sendMail)))
+	assert.True(t, strings.HasSuffix(taskName(func() {}), "async.TestTaskName"))
+	assert.Equal(t, "unknown", taskName(nil))
+}
@@ -24,35 +24,50 @@ package bean
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
+	"fmt"
 	"html/template"
+	"io"
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/getsentry/sentry-go"
 	sentryecho "github.com/getsentry/sentry-go/echo"
 	validatorV10 "github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
-	"github.com/labstack/echo-contrib/prometheus"
+	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
 	"github.com/panjf2000/ants/v2"
+	"github.com/pkg/errors"
 	"github.com/retail-ai-inc/bean/binder"
 	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/retail-ai-inc/bean/degrade"
+	"github.com/retail-ai-inc/bean/di"
 	"github.com/retail-ai-inc/bean/echoview"
 	berror "github.com/retail-ai-inc/bean/error"
 	"github.com/retail-ai-inc/bean/gopool"
 	"github.com/retail-ai-inc/bean/goview"
 	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/i18n"
+	"github.com/retail-ai-inc/bean/logwriter"
 	"github.com/retail-ai-inc/bean/middleware"
+	"github.com/retail-ai-inc/bean/openapi"
+	"github.com/retail-ai-inc/bean/precondition"
 	broute "github.com/retail-ai-inc/bean/route"
+	"github.com/retail-ai-inc/bean/secrets"
+	"github.com/retail-ai-inc/bean/session"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"github.com/retail-ai-inc/bean/storage"
 	"github.com/retail-ai-inc/bean/validator"
 	"github.com/rs/dnscache"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -71,7 +86,158 @@ type DBDeps struct {
 	TenantMongoDBNames map[uint64]string
 	MasterRedisDB      map[uint64]*dbdrivers.RedisDBConn
 	TenantRedisDBs     map[uint64]*dbdrivers.RedisDBConn
-	MemoryDB           *badger.DB
+	// MemoryDB is the badger database of `MemoryKV`, nil if the engine of the memory database is not badger.
+	MemoryDB *badger.DB
+	MemoryKV dbdrivers.KV
+}
+
+// RedisConn returns the redis connection of the tenant if tenant mode is on, otherwise the master connection.
+func (d *DBDeps) RedisConn(tenantID uint64) (*dbdrivers.RedisDBConn, error) {
+	return dbdrivers.GetRedisConn(d.MasterRedisDB, d.TenantRedisDBs, tenantID)
+}
+
+// MySQLConn returns the MySQL connection of the tenant if tenant mode is on, otherwise the master connection.
+func (d *DBDeps) MySQLConn(tenantID uint64) (*gorm.DB, error) {
+	if len(d.TenantMySQLDBs) == 0 {
+		return d.MasterMySQLConn()
+	}
+
+	db, ok := d.TenantMySQLDBs[tenantID]
+	if !ok || db == nil {
+		return nil, errors.Errorf("mysql: connection of tenant %d is not initialized", tenantID)
+	}
+
+	return db, nil
+}
+
+// MasterMySQLConn returns the master MySQL connection.
+func (d *DBDeps) MasterMySQLConn() (*gorm.DB, error) {
+	if d.MasterMySQLDB == nil {
+		return nil, errors.New("mysql: master connection is not initialized")
+	}
+
+	return d.MasterMySQLDB, nil
+}
+
+// MongoConn returns the mongo database of the tenant if tenant mode is on, otherwise the master database.
+func (d *DBDeps) MongoConn(tenantID uint64) (*mongo.Database, error) {
+	if len(d.TenantMongoDBs) == 0 {
+		return d.MasterMongoConn()
+	}
+
+	client, ok := d.TenantMongoDBs[tenantID]
+	if !ok || client == nil {
+		return nil, errors.Errorf("mongo: connection of tenant %d is not initialized", tenantID)
+	}
+
+	return client.Database(d.TenantMongoDBNames[tenantID]), nil
+}
+
+// MasterMongoConn returns the master mongo database.
+func (d *DBDeps) MasterMongoConn() (*mongo.Database, error) {
+	if d.MasterMongoDB == nil {
+		return nil, errors.New("mongo: master connection is not initialized")
+	}
+
+	return d.MasterMongoDB.Database(d.MasterMongoDBName), nil
+}
+
+// SQL returns the `SQLExecutor` of the MySQL connection of `MySQLConn`.
+func (d *DBDeps) SQL(tenantID uint64) (dbdrivers.SQLExecutor, error) {
+	db, err := d.MySQLConn(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbdrivers.NewSQLExecutor(db), nil
+}
+
+// Mongo returns the `MongoOps` of the mongo database of `MongoConn`.
+func (d *DBDeps) Mongo(tenantID uint64) (dbdrivers.MongoOps, error) {
+	db, err := d.MongoConn(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbdrivers.NewMongoOps(db), nil
+}
+
+// Redis returns the `RedisOps` of the redis connection of `RedisConn`.
+func (d *DBDeps) Redis(tenantID uint64) (dbdrivers.RedisOps, error) {
+	conn, err := d.RedisConn(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// KV returns the memory database, nil if it's not initialized.
+func (d *DBDeps) KV() dbdrivers.KVStore {
+	return d.MemoryKV
+}
+
+// Close closes the pools of the master and tenant databases and the memory database, it's called by the
+// "databases" component of the close stage of `Shutdown`.
+func (d *DBDeps) Close(c context.Context) error {
+	var errs []string
+	collect := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+
+	closeMySQL := func(name string, db *gorm.DB) {
+		if db == nil {
+			return
+		}
+		sqlDB, err := db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		collect(name, err)
+	}
+	closeMongo := func(name string, client *mongo.Client) {
+		if client != nil {
+			collect(name, client.Disconnect(c))
+		}
+	}
+	closeRedis := func(name string, conn *dbdrivers.RedisDBConn) {
+		if conn == nil {
+			return
+		}
+		if client := conn.Client(); client != nil {
+			collect(name, client.Close())
+		}
+		for _, client := range conn.Read {
+			collect(name, client.Close())
+		}
+	}
+
+	closeMySQL("mysql", d.MasterMySQLDB)
+	for tenantID, db := range d.TenantMySQLDBs {
+		closeMySQL(fmt.Sprintf("mysql tenant %d", tenantID), db)
+	}
+	closeMongo("mongo", d.MasterMongoDB)
+	for tenantID, client := range d.TenantMongoDBs {
+		closeMongo(fmt.Sprintf("mongo tenant %d", tenantID), client)
+	}
+	for _, conn := range d.MasterRedisDB {
+		closeRedis("redis", conn)
+	}
+	for tenantID, conn := range d.TenantRedisDBs {
+		closeRedis(fmt.Sprintf("redis tenant %d", tenantID), conn)
+	}
+	if d.MemoryKV != nil {
+		collect("memory", d.MemoryKV.Close())
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New("close databases: " + strings.Join(errs, "; "))
+	}
+
+	return nil
 }
 
 type Bean struct {
@@ -80,7 +246,42 @@ type Bean struct {
 	BeforeServe       func()
 	errorHandlerFuncs []berror.ErrorHandlerFunc
 	validate          *validatorV10.Validate
+	translator        *validator.Translator
 	Config            Config
+
+	// RouteAuth, RouteRateLimiter and RouteCacheStore are used by the route options. (see `WithAuth`,
+	// `WithRateLimit` and `WithCache`) If they are nil then `middleware.RequireAPIKeyScopes` is used for
+	// the auth, and the master redis or the memory of the process for the limits and the cache.
+	RouteAuth        func(scopes ...string) echo.MiddlewareFunc
+	RouteRateLimiter middleware.RateLimiter
+	RouteCacheStore  middleware.CacheStore
+
+	// SessionKeys loads the keys encrypting the session cookies from a secrets provider, so that they are
+	// rotated without a deployment. If it's nil then `session.keys` of `env.json` is used.
+	SessionKeys session.KeyProvider
+
+	// Container provides the handlers, the services and the repositories from their constructors, with
+	// the request scope of `di.Middleware`. Bean provides `*Bean`, `*DBDeps`, `echo.Logger` and the
+	// scoped `*TenantDB`.
+	Container *di.Container
+
+	// TenantID returns the tenant of a request for `TenantDB`. If it's nil then the tenant is 0, the
+	// master databases if tenant mode is off.
+	TenantID func(c echo.Context) uint64
+
+	// NewHTTP3Server creates the HTTP/3 server of `http.http3`. (see `NewHTTP3ServerFunc`)
+	NewHTTP3Server NewHTTP3ServerFunc
+
+	// The modules registered by `RegisterModules`.
+	modules   []Module
+	modulesMu sync.Mutex
+
+	reload configReload
+
+	// The orchestrator of the components of the instance, see `ShutdownOrchestrator`.
+	instanceID       uint64
+	orchestrator     *shutdown.Orchestrator
+	orchestratorOnce sync.Once
 }
 
 type SentryConfig struct {
@@ -98,32 +299,182 @@ type Config struct {
 	ProjectName  string
 	Environment  string
 	DebugLogPath string
-	Secret       string
-	AccessLog    struct {
+	DebugLog     struct {
+		Path     string
+		Outputs  []string
+		Rotation logwriter.RotationConfig
+		// Level is `debug`, `info`, `warn`, `error` or `off`. It's applied again on the config reload.
+		// Optional. Default value `debug`.
+		Level string
+	}
+	Secret    string
+	AccessLog struct {
 		On                bool
 		BodyDump          bool
 		Path              string
+		Outputs           []string
+		Rotation          logwriter.RotationConfig
+		Format            string
+		TenantHeader      string
+		UserIDClaim       string
 		BodyDumpMaskParam []string
+		MaskHeaderParam   []string
+		MaskStrategy      string
 		ReqHeaderParam    []string
+		ResHeaderParam    []string
 		SkipEndpoints     []string
+		CompletionLog     bool
+		// Connection adds the TLS session and the socket addresses of the connection to the fields of the
+		// access log. (see `LogConnection`)
+		// Optional. Default value false.
+		Connection bool
 	}
 	Prometheus struct {
+		On bool
+		// MetricsPath is the endpoint of the metrics, it's also served without `http.basePath`.
+		// Optional. Default value "/metrics".
+		MetricsPath   string
+		SkipEndpoints []string
+		// Tenant bounds the `tenant` label of the HTTP and the pool metrics when tenant mode is on. (see
+		// `middleware.TenantLabels`)
+		Tenant struct {
+			// TopN is the number of the busiest tenants which have their own label.
+			// Optional. Default value 20.
+			TopN int
+			// Pinned are the tenants which always have their own label.
+			// Optional. Default value nil.
+			Pinned []string
+			// Interval between two rankings of the tenants.
+			// Optional. Default value 10m.
+			Interval time.Duration
+		}
+	}
+	AllocSampling struct {
 		On            bool
+		SampleRate    float64
 		SkipEndpoints []string
 	}
 	HTTP struct {
-		Port            string
-		Host            string
+		Port string
+		Host string
+		// BasePath is the prefix the service is mounted under by the ingress, like "/api/catalog". The
+		// routes are registered without it. (see `middleware.BasePath`)
+		// Optional. Default value "".
+		BasePath string
+		// BasePathRewritten is true if the proxy strips `BasePath` before forwarding the requests.
+		// Optional. Default value false.
+		BasePathRewritten bool
+		// ExternalURL is the scheme and the host of the service for the absolute URLs, like
+		// "https://shop.example.com". (see `AbsoluteURLFor`)
+		// Optional. Default value "", the scheme and the host of the request.
+		ExternalURL     string
 		BodyLimit       string
 		IsHttpsRedirect bool
 		Timeout         time.Duration
+		TimeoutGroups   map[string]time.Duration
 		KeepAlive       bool
 		AllowedMethod   []string
-		SSL             struct {
+		CORS            struct {
+			AllowOrigins        []string
+			AllowOriginPatterns []string
+			AllowHeaders        []string
+			AllowCredentials    bool
+			ExposeHeaders       []string
+			MaxAge              int
+		}
+		Compression struct {
+			On               bool
+			Level            int
+			MinSize          int
+			SkipContentTypes []string
+			SkipEndpoints    []string
+		}
+		// Decompression decompresses the `gzip` and `deflate` request bodies, like the compressed webhooks.
+		Decompression struct {
+			On            bool
+			MaxBodyBytes  int64
+			MaxRatio      int64
+			SkipEndpoints []string
+		}
+		Static struct {
+			On            bool
+			Root          string
+			Prefix        string
+			Index         string
+			SPA           bool
+			MaxAge        int
+			Precompressed bool
+		}
+		AutoMethods struct {
+			Options bool
+			Head    bool
+			Groups  map[string]struct {
+				Options bool
+				Head    bool
+			}
+		}
+		SSL struct {
 			On            bool
 			CertFile      string
 			PrivFile      string
 			MinTLSVersion uint16
+			// Reload serves the new certificate of `CertFile` and `PrivFile` when they change, without a restart.
+			Reload bool
+			// Autocert gets the certificates from an ACME server instead of `CertFile` and `PrivFile`.
+			Autocert struct {
+				On bool
+				// Hosts allowed to get a certificate.
+				// Required.
+				Hosts []string
+				Email string
+				// CacheDir is the directory of the badger database keeping the certificates and the account key.
+				// Required.
+				CacheDir string
+				// DirectoryURL of the ACME server.
+				// Optional. Default value Let's Encrypt.
+				DirectoryURL string
+				// HTTPPort serves the HTTP challenges and redirects the other requests to HTTPS.
+				// Optional. Default value "" means only the TLS challenges.
+				HTTPPort string
+			}
+			// MTLS requires the certificates of the clients, for the traffic between the internal services.
+			MTLS struct {
+				On bool
+				// ClientCAFile is the PEM bundle of the CAs of the client certificates.
+				// Required.
+				ClientCAFile string
+				// VerifyMode is `require`, `verify-if-given` or `request`, which doesn't verify the certificate.
+				// Optional. Default value `require`.
+				VerifyMode string
+			}
+		}
+		// H2C serves HTTP/2 without TLS, for the gRPC-gateway and gRPC-web traffic behind a load balancer
+		// terminating TLS. It's ignored if `ssl.on` is true, HTTP/2 is negotiated by TLS then.
+		H2C bool
+		// Contracts validates the bodies of the routes against their types. (see `WithContract`)
+		Contracts struct {
+			On bool
+			// SampleRate is the ratio of the requests validated in the production environments, all of
+			// them are validated in the other environments.
+			// Optional. Default value 0, no validation in production.
+			SampleRate float64
+		}
+		// Socket is the path of a unix socket the server listens on instead of `host:port`, like behind a
+		// proxy on the same host.
+		// Optional. Default value "".
+		Socket string
+		// SocketMode is the octal permissions of `Socket`, like "0660".
+		// Optional. Default value "", the umask of the process.
+		SocketMode string
+		// Listeners serve the routes on more addresses, with their own TLS. (see `ListenerConfig`)
+		Listeners []ListenerConfig
+		// HTTP3 serves HTTP/3 on a UDP listener next to the TLS server, with the server of `Bean.NewHTTP3Server`.
+		// Experimental, it requires `ssl.on`.
+		HTTP3 struct {
+			On bool
+			// Port of the UDP listener, advertised by the `Alt-Svc` header of the TLS server.
+			// Optional. Default value the port of the server.
+			Port string
 		}
 	}
 	NetHttpFastTransporter struct {
@@ -135,7 +486,25 @@ type Config struct {
 		DNSCacheTimeout     *time.Duration
 	}
 	HTML struct {
+		// Root, Extension, Master, Partials and Delims configure the view templates, the defaults are
+		// the ones of `goview.DefaultConfig`.
+		Root               string
+		Extension          string
+		Master             string
+		Partials           []string
+		Delims             struct{ Left, Right string }
 		ViewsTemplateCache bool
+		// HotReload discards the cached templates when a file of the root changes, for development
+		// with `ViewsTemplateCache` on.
+		HotReload bool
+		// FragmentCache caches the `{{cache key ttl}}...{{end}}` blocks of the views in memory, or in the
+		// master redis with `Store` "redis".
+		FragmentCache struct {
+			On         bool
+			Store      string
+			Prefix     string
+			MaxEntries int
+		}
 	}
 	Database struct {
 		Tenant struct {
@@ -145,8 +514,43 @@ type Config struct {
 		Mongo  dbdrivers.MongoConfig
 		Redis  dbdrivers.RedisConfig
 		Memory dbdrivers.MemoryConfig
+		Region dbdrivers.RegionConfig
+		// Secrets configures the secret stores of the credentials which are references to secrets, like
+		// "secretRef://aws/prod/mysql#password". (see `secrets`)
+		Secrets secrets.Config
+	}
+	Sentry  SentryConfig
+	Session struct {
+		On         bool
+		CookieName string
+		Domain     string
+		Path       string
+		MaxAge     time.Duration
+		Secure     bool
+		HTTPOnly   *bool
+		SameSite   string
+		Rolling    bool
+		Prefix     string
+		// Keys encrypt the session cookies, the first one encrypts and all of them decrypt. They are
+		// replaced by the keys of `Bean.SessionKeys` if it's set, refreshed every `KeyRefresh`.
+		Keys       []session.Key
+		KeyRefresh time.Duration
+	}
+	Validation struct {
+		DefaultLocale string
+		Locales       []string
+		Messages      map[string]map[string]string
+	}
+	// I18n translates the messages of the application from the bundles of `Dir`, see the `i18n` package.
+	I18n struct {
+		On            bool
+		Dir           string
+		DefaultLocale string
+		QueryParam    string
+		CookieName    string
+		// HotReload reloads the bundles when their files change, for development.
+		HotReload bool
 	}
-	Sentry   SentryConfig
 	Security struct {
 		HTTP struct {
 			Header struct {
@@ -157,17 +561,170 @@ type Config struct {
 				ContentSecurityPolicy string
 			}
 		}
+		CSRF struct {
+			On             bool
+			Mode           string
+			CookieName     string
+			HeaderName     string
+			FormField      string
+			CookieDomain   string
+			CookiePath     string
+			CookieMaxAge   int
+			CookieSecure   bool
+			CookieSameSite string
+			SkipEndpoints  []string
+		}
 	}
+	// Deprecated: use `Pools`.
 	AsyncPool []struct {
 		Name       string
 		Size       *int
 		BlockAfter *int
 	}
+	// Pools are the goroutine pools registered into `gopool`, used by `async.Execute`.
+	Pools []gopool.Config
+	// PoolDrainTimeout is how long `Cleanup` waits for the running tasks of the pools.
+	// Optional. Default value 10 seconds.
+	PoolDrainTimeout time.Duration
+	// Shutdown configures how `Cleanup` stops the subsystems. (see `shutdown`)
+	Shutdown struct {
+		// Signals makes `ServeAt` stop the server and the subsystems on SIGINT and SIGTERM, it returns
+		// once they are stopped.
+		// Optional. Default value false.
+		Signals bool
+		// Timeouts of the stages "intake", "drain", "flush" and "close".
+		// Optional. Default value 10 seconds, `PoolDrainTimeout` for "drain".
+		Timeouts map[string]time.Duration
+	}
+	AsyncLeakDetector struct {
+		On        bool
+		Threshold time.Duration
+		Interval  time.Duration
+	}
+	// AsyncHistory keeps the runs of the async tasks for the admin UI. (see `async.History`)
+	AsyncHistory struct {
+		// Store is `memory`, a ring buffer of `Size` runs, or `badger`, the memory database for `TTL`.
+		// Optional. Default value `memory`.
+		Store string
+		// Optional. Default value 1000.
+		Size int
+		// Optional. Default value 168h.
+		TTL time.Duration
+	}
+	Debug struct {
+		Pprof struct {
+			On       bool
+			Username string
+			Password string
+			AllowIPs []string
+		}
+	}
+	Preflight PreflightConfig
+	// Middlewares enables or disables the built-in middlewares by name per environment, like
+	// `"HTTPSRedirect": {"off": ["local"]}`, so that the environments differ by config only. `BodyDump`
+	// toggles the body dump of the access logger.
+	Middlewares map[string]MiddlewareToggle
+	// OpenAPI serves the OpenAPI document of the routes, see the `openapi` package.
+	OpenAPI struct {
+		On            bool
+		Title         string
+		Description   string
+		Version       string
+		Path          string
+		UI            string
+		UIPath        string
+		Username      string
+		Password      string
+		SkipEndpoints []string
+		// Mock serves the responses of the routes which are not implemented yet from the document, and of
+		// the operations of the design first `Document` without route. It's off in the production
+		// environments. (see `openapi.Mock`)
+		Mock struct {
+			On       bool
+			Document string
+		}
+	}
+	// Storage configures the `Storage` filesystem, it's not initialized if the driver is empty.
+	Storage storage.Config
+	Admin   struct {
+		On      bool
+		Host    string
+		Port    string
+		APIKeys []string
+	}
+	Degradation struct {
+		CheckInterval time.Duration
+		CheckTimeout  time.Duration
+		// Dependencies are the thresholds from which a dependency is degraded or down. (see `degrade.Thresholds`)
+		Dependencies map[string]struct {
+			Latency       time.Duration
+			ErrorRate     float64
+			DownErrorRate float64
+			Window        time.Duration
+			MinCalls      int
+		}
+		Features map[string]struct {
+			Dependencies []string
+			// DegradeAt is `degraded` or `down`, the default.
+			DegradeAt string
+			Fallback  string
+			Warning   string
+			StaleTTL  time.Duration
+		}
+	}
+	// ConfigReload watches `env.json` and the remote sources, and calls the hooks of `OnConfigChange`
+	// when they change. (see `WatchConfig`)
+	ConfigReload struct {
+		On bool
+		// Debounce waits for the writes to settle before reloading.
+		// Optional. Default value 1s.
+		Debounce time.Duration
+		// Consul merges the JSON of a consul KV key over `env.json` if `Addr` and `Key` are set.
+		Consul struct {
+			Addr  string
+			Key   string
+			Token string
+		}
+		// Etcd merges the JSON of an etcd v3 key over `env.json` if `Addr` and `Key` are set.
+		Etcd struct {
+			Addr string
+			Key  string
+			// Optional. Default value 30s.
+			Interval time.Duration
+		}
+	}
+}
+
+// PreflightConfig lists the environments where the insecure settings found by `Preflight` are fatal.
+type PreflightConfig struct {
+	// ProductionEnvironments enables the production only checks, like TLS.
+	// Optional. Default value "production" and "prod".
+	ProductionEnvironments []string
+	// StrictEnvironments refuse to start with an insecure setting, the others only log a warning.
+	// Optional. Default value `ProductionEnvironments`.
+	StrictEnvironments []string
+	// SkipChecks disables some checks, like `tls` when TLS is terminated by a load balancer.
+	SkipChecks []string
 }
 
 // This is a global variable to hold the debug logger so that we can log data from service, repository or anywhere.
+// Deprecated: it's the logger of the last bean instance, use `Bean.Logger` or `LoggerWithContext`.
 var BeanLogger echo.Logger
 
+// ViewFragments is the cache of the view fragments, nil unless `html.fragmentCache.on` is true. Use it to
+// invalidate the fragments when their data changes.
+var ViewFragments *goview.FragmentCache
+
+// Storage is the filesystem of `storage` in env.json, nil if its driver is empty.
+var Storage storage.Filesystem
+
+// OpenAPI is the spec of the routes described by `WithDoc`, nil unless `openapi.on` is true. Describe the
+// routes registered without bean with `OpenAPI.Describe`.
+var OpenAPI *openapi.Spec
+
+// I18n is the message bundle of `i18n.dir` in env.json, nil unless `i18n.on` is true.
+var I18n *i18n.Bundle
+
 // This key is inherited from `sentryecho` package as the package doesn't support the key for external use.
 const SentryHubContextKey = "sentry"
 
@@ -176,7 +733,33 @@ const SentryHubContextKey = "sentry"
 // Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
 var TenantAlterDbHostParam string
 
+// Applications can append computed fields to the access log or classify the responses into business
+// outcomes by setting these variables before calling `bean.New()`.
+var (
+	AccessLogEnrichers  []middleware.AccessLogEnricher
+	AccessLogClassifier middleware.ResponseClassifier
+)
+
+// CORSAllowOriginFunc allows the origins which can't be listed in `http.cors.allowOrigins` or
+// `http.cors.allowOriginPatterns` of `env.json`, like the origins of the tenants stored in a database.
+// Set it before calling `bean.New()`.
+var CORSAllowOriginFunc func(origin string) (bool, error)
+
+// The writers of the access and debug logs, closed by `Cleanup`.
+var (
+	logOutputs   []io.Closer
+	logOutputsMu sync.Mutex
+)
+
+// The functions registered by `OnCleanup`.
+var (
+	cleanups   []func()
+	cleanupsMu sync.Mutex
+)
+
 // Hold the useful configuration settings of bean so that we can use it quickly from anywhere.
+// Deprecated: it's shared by all the bean instances of the process, use `Bean.Config` from `Of` or
+// `FromContext`. It's still read by `New` and `NewEcho`.
 var BeanConfig Config
 
 // Support a DNS cache version of the net/http Transport.
@@ -193,6 +776,15 @@ func New() (b *Bean) {
 		Config:   BeanConfig,
 	}
 
+	// The packages get the config and the logger of the instance serving the request instead of the globals.
+	register(b)
+	b.OnConfigChange(b.applyConfigChange)
+	useMiddleware(e, "Bean", nil, nil, b.contextMiddleware())
+
+	// Create the request scope of the dependency injection container.
+	b.Container = b.newContainer()
+	useMiddleware(e, "DI", nil, nil, di.Middleware(b.Container))
+
 	// If `NetHttpFastTransporter` is on from env.json then initialize it.
 	if BeanConfig.NetHttpFastTransporter.On {
 		resolver := &dnscache.Resolver{}
@@ -249,6 +841,25 @@ func New() (b *Bean) {
 		}()
 	}
 
+	// Localize the validation error messages if a default locale is set from env.json.
+	if BeanConfig.Validation.DefaultLocale != "" {
+		translator, err := newTranslator(b.validate)
+		if err != nil {
+			e.Logger.Error("validation translator: ", err)
+		}
+		b.translator = translator
+	}
+
+	// Initialize the file storage if a driver is set from env.json.
+	Storage = nil
+	if BeanConfig.Storage.Driver != "" {
+		fs, err := storage.New(BeanConfig.Storage)
+		if err != nil {
+			e.Logger.Fatal("storage initialization failed: ", err, ". Server 🚀  crash landed. Exiting...")
+		}
+		Storage = fs
+	}
+
 	// If `memory` database is on and `delKeyAPI` end point along with bearer token are properly set.
 	if BeanConfig.Database.Memory.On && BeanConfig.Database.Memory.DelKeyAPI.EndPoint != "" {
 		e.DELETE(BeanConfig.Database.Memory.DelKeyAPI.EndPoint, func(c echo.Context) error {
@@ -263,9 +874,7 @@ func New() (b *Bean) {
 			}
 
 			key := c.Param("key")
-			err := b.DBConn.MemoryDB.Update(func(txn *badger.Txn) error {
-				return txn.Delete([]byte(key))
-			})
+			err := b.DBConn.MemoryKV.Delete(key)
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 					"message": err.Error(),
@@ -285,6 +894,11 @@ func NewEcho() *echo.Echo {
 
 	e := echo.New()
 
+	// The routes of the last echo instance are used by `URLFor` without a request.
+	urlEchoMu.Lock()
+	urlEcho = e
+	urlEchoMu.Unlock()
+
 	// Hide default `Echo` banner during startup.
 	e.HideBanner = true
 
@@ -293,43 +907,99 @@ func NewEcho() *echo.Echo {
 
 	// Setup HTML view templating engine.
 	viewsTemplateCache := BeanConfig.HTML.ViewsTemplateCache
-	e.Renderer = echoview.New(goview.Config{
-		Root:         "views",
-		Extension:    ".html",
-		Master:       "templates/master",
-		Partials:     []string{},
-		Funcs:        make(template.FuncMap),
-		DisableCache: !viewsTemplateCache,
-		Delims:       goview.Delims{Left: "{{", Right: "}}"},
-	})
+	ViewFragments = nil
+	if BeanConfig.HTML.FragmentCache.On {
+		ViewFragments = goview.NewFragmentCache(goview.NewMemoryFragmentStore(BeanConfig.HTML.FragmentCache.MaxEntries))
+	}
+	// Load the message bundles before the view engine, which translates by the `t` template func.
+	funcs := middleware.CSRFTemplateFuncs(BeanConfig.Security.CSRF.FormField)
+	for name, f := range urlTemplateFuncs(BeanConfig.HTTP.BasePath) {
+		funcs[name] = f
+	}
+	I18n = nil
+	if BeanConfig.I18n.On {
+		bundle, err := i18n.Load(BeanConfig.I18n.Dir, BeanConfig.I18n.DefaultLocale)
+		if err != nil {
+			e.Logger.Fatal("i18n bundles loading failed: ", err, ". Server 🚀  crash landed. Exiting...")
+		}
+		I18n = bundle
 
-	// IMPORTANT: Configure debug log.
-	if BeanConfig.DebugLogPath != "" {
-		if file, err := openFile(BeanConfig.DebugLogPath); err != nil {
-			e.Logger.Fatalf("Unable to open log file: %v Server 🚀  crash landed. Exiting...\n", err)
-		} else {
-			e.Logger.SetOutput(file)
+		for name, f := range i18n.TemplateFuncs(bundle) {
+			funcs[name] = f
+		}
+
+		if BeanConfig.I18n.HotReload {
+			go bundle.Watch(context.Background(), time.Second, func(err error) {
+				e.Logger.Error("i18n bundles reloading failed: ", err)
+			})
 		}
 	}
-	e.Logger.SetLevel(log.DEBUG)
+
+	views := echoview.New(viewConfig(funcs, !viewsTemplateCache))
+	e.Renderer = newRenderers(views)
+
+	if BeanConfig.HTML.HotReload {
+		go views.Watch(context.Background(), time.Second, func(err error) {
+			e.Logger.Error("views hot reload failed: ", err)
+		})
+	}
+
+	// IMPORTANT: Configure debug log.
+	debugLogPath := BeanConfig.DebugLog.Path
+	if debugLogPath == "" {
+		debugLogPath = BeanConfig.DebugLogPath
+	}
+	if output, err := openLog(debugLogPath, BeanConfig.DebugLog.Outputs, BeanConfig.DebugLog.Rotation); err != nil {
+		e.Logger.Fatalf("Unable to open log file: %v Server 🚀  crash landed. Exiting...\n", err)
+	} else if output != nil {
+		e.Logger.SetOutput(output)
+	}
+	e.Logger.SetLevel(logLevel(BeanConfig.DebugLog.Level))
 
 	// Initialize `BeanLogger` global variable using `e.Logger`.
 	BeanLogger = e.Logger
 
 	// Adds a `Server` header to the response.
-	e.Use(middleware.ServerHeader(BeanConfig.ProjectName, helpers.CurrVersion()))
+	useMiddleware(e, "ServerHeader", nil, nil, middleware.ServerHeader(BeanConfig.ProjectName, helpers.CurrVersion()))
 
 	// Sets the maximum allowed size for a request body, return `413 - Request Entity Too Large` if the size exceeds the limit.
-	e.Use(echomiddleware.BodyLimit(BeanConfig.HTTP.BodyLimit))
+	useMiddleware(e, "BodyLimit", map[string]interface{}{
+		"bodyLimit": BeanConfig.HTTP.BodyLimit,
+	}, nil, echomiddleware.BodyLimit(BeanConfig.HTTP.BodyLimit))
+
+	// Decompress the request bodies sent with a `Content-Encoding`, the body limit above applies to the
+	// compressed body.
+	if BeanConfig.HTTP.Decompression.On {
+		useMiddleware(e, "Decompress", map[string]interface{}{
+			"maxBodyBytes": BeanConfig.HTTP.Decompression.MaxBodyBytes,
+			"maxRatio":     BeanConfig.HTTP.Decompression.MaxRatio,
+		}, BeanConfig.HTTP.Decompression.SkipEndpoints, middleware.Decompress(middleware.DecompressConfig{
+			Skipper:      endPointsSkipper(BeanConfig.HTTP.Decompression.SkipEndpoints),
+			MaxBodyBytes: BeanConfig.HTTP.Decompression.MaxBodyBytes,
+			MaxRatio:     BeanConfig.HTTP.Decompression.MaxRatio,
+		}))
+	}
 
 	// CORS initialization and support only HTTP methods which are configured under `http.allowedMethod` parameters in `env.json`.
-	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: BeanConfig.HTTP.AllowedMethod,
-	}))
+	// All origins are allowed unless `http.cors` restricts them.
+	cors := corsConfig()
+	useMiddleware(e, "CORS", map[string]interface{}{
+		"allowOrigins":        cors.AllowOrigins,
+		"allowOriginPatterns": BeanConfig.HTTP.CORS.AllowOriginPatterns,
+		"allowOriginFunc":     CORSAllowOriginFunc != nil,
+		"allowMethods":        cors.AllowMethods,
+		"allowHeaders":        cors.AllowHeaders,
+		"allowCredentials":    cors.AllowCredentials,
+	}, nil, echomiddleware.CORSWithConfig(cors))
 
 	// Basic HTTP headers security like XSS protection...
-	e.Use(echomiddleware.SecureWithConfig(echomiddleware.SecureConfig{
+	useMiddleware(e, "Secure", map[string]interface{}{
+		"xssProtection":         BeanConfig.Security.HTTP.Header.XssProtection,
+		"contentTypeNosniff":    BeanConfig.Security.HTTP.Header.ContentTypeNosniff,
+		"xFrameOptions":         BeanConfig.Security.HTTP.Header.XFrameOptions,
+		"hstsMaxAge":            BeanConfig.Security.HTTP.Header.HstsMaxAge,
+		"contentSecurityPolicy": BeanConfig.Security.HTTP.Header.ContentSecurityPolicy,
+	}, nil, echomiddleware.SecureWithConfig(echomiddleware.SecureConfig{
 		XSSProtection:         BeanConfig.Security.HTTP.Header.XssProtection,         // Adds the X-XSS-Protection header with the value `1; mode=block`.
 		ContentTypeNosniff:    BeanConfig.Security.HTTP.Header.ContentTypeNosniff,    // Adds the X-Content-Type-Options header with the value `nosniff`.
 		XFrameOptions:         BeanConfig.Security.HTTP.Header.XFrameOptions,         // The X-Frame-Options header value to be set with a custom value.
@@ -337,30 +1007,82 @@ func NewEcho() *echo.Echo {
 		ContentSecurityPolicy: BeanConfig.Security.HTTP.Header.ContentSecurityPolicy, // Allows the Content-Security-Policy header value to be set with a custom value.
 	}))
 
+	// Serve the front-end bundles. It has to be before the `404 Not Found` of the unknown routes.
+	if BeanConfig.HTTP.Static.On {
+		useMiddleware(e, "Static", map[string]interface{}{
+			"root":   BeanConfig.HTTP.Static.Root,
+			"prefix": BeanConfig.HTTP.Static.Prefix,
+			"spa":    BeanConfig.HTTP.Static.SPA,
+		}, nil, middleware.Static(middleware.StaticConfig{
+			Root:          BeanConfig.HTTP.Static.Root,
+			Prefix:        BeanConfig.HTTP.Static.Prefix,
+			Index:         BeanConfig.HTTP.Static.Index,
+			SPA:           BeanConfig.HTTP.Static.SPA,
+			MaxAge:        BeanConfig.HTTP.Static.MaxAge,
+			Precompressed: BeanConfig.HTTP.Static.Precompressed,
+		}))
+	}
+
 	// Return `405 Method Not Allowed` if a wrong HTTP method been called for an API route.
 	// Return `404 Not Found` if a wrong API route been called.
-	e.Use(middleware.MethodNotAllowedAndRouteNotFound())
+	useMiddleware(e, "MethodNotAllowedAndRouteNotFound", nil, nil, middleware.MethodNotAllowedAndRouteNotFoundWithConfig(middleware.MethodNotAllowedAndRouteNotFoundConfig{
+		AllowedMethods: BeanConfig.HTTP.AllowedMethod,
+	}))
+
+	// Compress the responses. It has to be registered before the access logger so that the body dumper
+	// logs the uncompressed body.
+	if BeanConfig.HTTP.Compression.On {
+		useMiddleware(e, "Compress", map[string]interface{}{
+			"level":   BeanConfig.HTTP.Compression.Level,
+			"minSize": BeanConfig.HTTP.Compression.MinSize,
+		}, BeanConfig.HTTP.Compression.SkipEndpoints, middleware.Compress(middleware.CompressConfig{
+			Skipper:          endPointsSkipper(BeanConfig.HTTP.Compression.SkipEndpoints),
+			Level:            BeanConfig.HTTP.Compression.Level,
+			MinSize:          BeanConfig.HTTP.Compression.MinSize,
+			SkipContentTypes: BeanConfig.HTTP.Compression.SkipContentTypes,
+		}))
+	}
 
 	// IMPORTANT: Configure access log and body dumper. (can be turn off)
 	if BeanConfig.AccessLog.On {
+		bodyDump := BeanConfig.AccessLog.BodyDump && !toggledOff(e, "BodyDump")
+		enrichers := AccessLogEnrichers
+		if BeanConfig.AccessLog.Connection {
+			enrichers = append(append([]middleware.AccessLogEnricher(nil), enrichers...), LogConnection)
+		}
 		accessLogConfig := middleware.LoggerConfig{
 			Skipper:       endPointsSkipper(BeanConfig.AccessLog.SkipEndpoints),
-			BodyDump:      BeanConfig.AccessLog.BodyDump,
+			BodyDump:      bodyDump,
 			RequestHeader: BeanConfig.AccessLog.ReqHeaderParam,
+			Enrichers:     enrichers,
+			Classifier:    AccessLogClassifier,
+			CompletionLog: BeanConfig.AccessLog.CompletionLog,
+			Format:        BeanConfig.AccessLog.Format,
+			TenantHeader:  BeanConfig.AccessLog.TenantHeader,
+			UserIDClaim:   BeanConfig.AccessLog.UserIDClaim,
+
+			// The secrets are masked whatever the output of the logs.
+			MaskedParameters: BeanConfig.AccessLog.BodyDumpMaskParam,
+			MaskedHeaders:    BeanConfig.AccessLog.MaskHeaderParam,
+			MaskStrategy:     BeanConfig.AccessLog.MaskStrategy,
+			ResponseHeader:   BeanConfig.AccessLog.ResHeaderParam,
 		}
 
-		if BeanConfig.AccessLog.Path != "" {
-			if file, err := openFile(BeanConfig.AccessLog.Path); err != nil {
-				e.Logger.Fatalf("Unable to open log file: %v Server 🚀  crash landed. Exiting...\n", err)
-			} else {
-				accessLogConfig.Output = file
-			}
-			if len(BeanConfig.AccessLog.BodyDumpMaskParam) > 0 {
-				accessLogConfig.MaskedParameters = BeanConfig.AccessLog.BodyDumpMaskParam
-			}
+		if output, err := openLog(BeanConfig.AccessLog.Path, BeanConfig.AccessLog.Outputs, BeanConfig.AccessLog.Rotation); err != nil {
+			e.Logger.Fatalf("Unable to open log file: %v Server 🚀  crash landed. Exiting...\n", err)
+		} else if output != nil {
+			accessLogConfig.Output = output
 		}
 		accessLogger := middleware.AccessLoggerWithConfig(accessLogConfig)
-		e.Use(accessLogger)
+		useMiddleware(e, "AccessLogger", map[string]interface{}{
+			"bodyDump":      bodyDump,
+			"path":          BeanConfig.AccessLog.Path,
+			"outputs":       BeanConfig.AccessLog.Outputs,
+			"format":        BeanConfig.AccessLog.Format,
+			"maskStrategy":  BeanConfig.AccessLog.MaskStrategy,
+			"completionLog": BeanConfig.AccessLog.CompletionLog,
+			"connection":    BeanConfig.AccessLog.Connection,
+		}, BeanConfig.AccessLog.SkipEndpoints, accessLogger)
 	}
 
 	// IMPORTANT: Capturing error and send to sentry if needed.
@@ -371,7 +1093,15 @@ func NewEcho() *echo.Echo {
 			e.Logger.Fatal("Sentry initialization failed: client options is empty")
 		}
 
-		if err := sentry.Init(*BeanConfig.Sentry.ClientOptions); err != nil {
+		// The traces sample rate can be changed by the config reload if there is no custom sampler.
+		options := *BeanConfig.Sentry.ClientOptions
+		if options.TracesSampler == nil {
+			setTracesSampleRate(options.TracesSampleRate)
+			options.TracesSampler = sentry.TracesSamplerFunc(sampleTraces)
+			options.TracesSampleRate = 0
+		}
+
+		if err := sentry.Init(options); err != nil {
 			e.Logger.Fatal("Sentry initialization failed: ", err, ". Server 🚀  crash landed. Exiting...")
 		}
 
@@ -380,37 +1110,222 @@ func NewEcho() *echo.Echo {
 			sentry.ConfigureScope(BeanConfig.Sentry.ConfigureScope)
 		}
 
-		e.Use(sentryecho.New(sentryecho.Options{
+		useMiddleware(e, "Sentry", map[string]interface{}{
+			"timeout": BeanConfig.Sentry.Timeout.String(),
+		}, nil, sentryecho.New(sentryecho.Options{
 			Repanic: true,
 			Timeout: BeanConfig.Sentry.Timeout,
 		}))
 
 		if helpers.FloatInRange(BeanConfig.Sentry.TracesSampleRate, 0.0, 1.0) > 0.0 {
-			e.Pre(middleware.Tracer())
+			preMiddleware(e, "Tracer", map[string]interface{}{
+				"tracesSampleRate": BeanConfig.Sentry.TracesSampleRate,
+			}, middleware.TracerWithConfig(middleware.TracerConfig{
+				SkipEndpoints: BeanConfig.Sentry.SkipTracesEndpoints,
+			}))
 		}
 	}
 
 	// Some pre-build middleware initialization.
-	e.Pre(echomiddleware.RemoveTrailingSlash())
+	// Strip the prefix of the ingress before the routing and add it back to the redirects.
+	if basePath := middleware.NormalizeBasePath(BeanConfig.HTTP.BasePath); basePath != "" {
+		var unprefixed []string
+		if BeanConfig.Prometheus.On {
+			unprefixed = append(unprefixed, metricsPath())
+		}
+		preMiddleware(e, "BasePath", map[string]interface{}{
+			"basePath":   basePath,
+			"rewritten":  BeanConfig.HTTP.BasePathRewritten,
+			"unprefixed": unprefixed,
+		}, middleware.BasePath(middleware.BasePathConfig{
+			Prefix:     basePath,
+			Rewritten:  BeanConfig.HTTP.BasePathRewritten,
+			Unprefixed: unprefixed,
+		}))
+	}
+	preMiddleware(e, "RemoveTrailingSlash", nil, echomiddleware.RemoveTrailingSlash())
 	if BeanConfig.HTTP.IsHttpsRedirect {
-		e.Pre(echomiddleware.HTTPSRedirect())
+		preMiddleware(e, "HTTPSRedirect", nil, echomiddleware.HTTPSRedirect())
 	}
-	e.Use(echomiddleware.Recover())
+
+	// Answer `OPTIONS` with the `Allow` header and `HEAD` with the `GET` handler of the routes which
+	// don't register these methods.
+	if BeanConfig.HTTP.AutoMethods.Options || BeanConfig.HTTP.AutoMethods.Head || len(BeanConfig.HTTP.AutoMethods.Groups) > 0 {
+		autoMethodsConfig := middleware.AutoMethodsConfig{
+			Options: BeanConfig.HTTP.AutoMethods.Options,
+			Head:    BeanConfig.HTTP.AutoMethods.Head,
+			Groups:  make(map[string]middleware.AutoMethodsGroup),
+		}
+		for prefix, group := range BeanConfig.HTTP.AutoMethods.Groups {
+			autoMethodsConfig.Groups[prefix] = middleware.AutoMethodsGroup{Options: group.Options, Head: group.Head}
+		}
+		preMiddleware(e, "AutoMethods", map[string]interface{}{
+			"options": autoMethodsConfig.Options,
+			"head":    autoMethodsConfig.Head,
+			"groups":  BeanConfig.HTTP.AutoMethods.Groups,
+		}, middleware.AutoMethods(autoMethodsConfig))
+	}
+	useMiddleware(e, "Recover", nil, nil, echomiddleware.Recover())
 
 	// IMPORTANT: Request related middleware.
-	// Set the `X-Request-ID` header field if it doesn't exist.
-	e.Use(echomiddleware.RequestIDWithConfig(echomiddleware.RequestIDConfig{
-		Generator: uuid.NewString,
-	}))
+	// Set the `X-Request-ID` header field if it doesn't exist and propagate it into the request context.
+	useMiddleware(e, "RequestID", nil, nil, middleware.RequestID())
 
-	// Enable prometheus metrics middleware. Metrics data should be accessed via `/metrics` endpoint.
+	// Enable prometheus metrics middleware. Metrics data should be accessed via `prometheus.metricsPath`, `/metrics` by default.
 	// This will help us to integrate `bean's` health into `k8s`.
-	if BeanConfig.Prometheus.On {
-		p := prometheus.NewPrometheus("echo", endPointsSkipper(BeanConfig.Prometheus.SkipEndpoints))
+	if BeanConfig.Prometheus.On && !toggledOff(e, "Prometheus") {
+		// IMPORTANT: If the tracing is on then the trace ID of sampled requests is attached to the latency
+		// histogram as an exemplar, so that Grafana can jump from a spike to the trace.
+		prometheusConfig := middleware.PrometheusConfig{
+			Skipper:     endPointsSkipper(BeanConfig.Prometheus.SkipEndpoints),
+			MetricsPath: metricsPath(),
+			Exemplars:   BeanConfig.Sentry.On && helpers.FloatInRange(BeanConfig.Sentry.TracesSampleRate, 0.0, 1.0) > 0.0,
+		}
+
+		// Label the metrics with the tenant of the request, only the busiest tenants individually so that
+		// the number of series stays bounded.
+		tenantLabels = nil
+		if BeanConfig.Database.Tenant.On {
+			tenantLabels = middleware.NewTenantLabels(middleware.TenantLabelsConfig{
+				TopN:     BeanConfig.Prometheus.Tenant.TopN,
+				Pinned:   BeanConfig.Prometheus.Tenant.Pinned,
+				Interval: BeanConfig.Prometheus.Tenant.Interval,
+			})
+			prometheusConfig.Tenant = requestTenant
+			prometheusConfig.TenantLabels = tenantLabels
+		}
+
+		p := middleware.NewPrometheus(prometheusConfig)
+		recordMiddleware(e, MiddlewareInfo{Name: "Prometheus", Stage: MiddlewareStageGlobal, BuiltIn: true}, BeanConfig.Prometheus.SkipEndpoints)
 		p.Use(e)
 	}
 
+	// Record the heap allocation of a sample of requests as metrics and access log fields to find
+	// the endpoints whose memory use is the problem.
+	if BeanConfig.AllocSampling.On {
+		useMiddleware(e, "AllocSampler", map[string]interface{}{
+			"sampleRate": BeanConfig.AllocSampling.SampleRate,
+		}, BeanConfig.AllocSampling.SkipEndpoints, middleware.AllocSamplerWithConfig(middleware.AllocSamplerConfig{
+			Skipper:    endPointsSkipper(BeanConfig.AllocSampling.SkipEndpoints),
+			SampleRate: helpers.FloatInRange(BeanConfig.AllocSampling.SampleRate, 0.0, 1.0),
+		}))
+	}
+
+	// Detect the locale of the request from the query parameter, the cookie or the `Accept-Language` header.
+	if I18n != nil {
+		useMiddleware(e, "I18n", map[string]interface{}{
+			"locales":       I18n.Locales(),
+			"defaultLocale": I18n.DefaultLocale(),
+		}, nil, i18n.MiddlewareWithConfig(i18n.Config{
+			Bundle:     I18n,
+			QueryParam: BeanConfig.I18n.QueryParam,
+			CookieName: BeanConfig.I18n.CookieName,
+		}))
+	}
+
+	// CSRF protection with the double-submit cookie. The `session` mode is enabled by `InitDB` after
+	// the session middleware.
+	if BeanConfig.Security.CSRF.On && BeanConfig.Security.CSRF.Mode != middleware.CSRFModeSession {
+		useMiddleware(e, "CSRF", csrfInfo(), BeanConfig.Security.CSRF.SkipEndpoints, middleware.CSRF(csrfConfig()))
+	}
+
+	// Cancel the request context at `http.timeout`, so that the database queries of a slow request stop.
+	if BeanConfig.HTTP.Timeout > 0 {
+		groups := BeanConfig.HTTP.TimeoutGroups
+		if BeanConfig.Debug.Pprof.On {
+			// A CPU profile or a trace takes as long as the `seconds` parameter asks.
+			groups = make(map[string]time.Duration, len(BeanConfig.HTTP.TimeoutGroups)+1)
+			groups["/debug/"] = 0
+			for prefix, timeout := range BeanConfig.HTTP.TimeoutGroups {
+				groups[prefix] = timeout
+			}
+		}
+
+		useMiddleware(e, "Timeout", map[string]interface{}{
+			"timeout": BeanConfig.HTTP.Timeout.String(),
+			"groups":  groups,
+		}, nil, middleware.Timeout(middleware.TimeoutConfig{
+			Timeout: BeanConfig.HTTP.Timeout,
+			Groups:  groups,
+		}))
+	}
+
+	// Profile the production incidents with `go tool pprof`. The endpoints are not mounted without a
+	// basic auth or an IP allowlist.
+	if BeanConfig.Debug.Pprof.On {
+		err := middleware.RegisterDebugRoutes(e, middleware.DebugConfig{
+			Username: BeanConfig.Debug.Pprof.Username,
+			Password: BeanConfig.Debug.Pprof.Password,
+			AllowIPs: BeanConfig.Debug.Pprof.AllowIPs,
+		})
+		if err != nil {
+			e.Logger.Error("debug endpoints: ", err)
+		}
+	}
+
+	// Serve the OpenAPI document of the routes and its UI, behind a basic auth if it's set.
+	OpenAPI = nil
+	if BeanConfig.OpenAPI.On {
+		OpenAPI = openapi.NewSpec()
+
+		var guards []echo.MiddlewareFunc
+		if BeanConfig.OpenAPI.Username != "" {
+			guards = append(guards, echomiddleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
+				return subtle.ConstantTimeCompare([]byte(username), []byte(BeanConfig.OpenAPI.Username)) == 1 &&
+					subtle.ConstantTimeCompare([]byte(password), []byte(BeanConfig.OpenAPI.Password)) == 1, nil
+			}))
+		}
+
+		version := BeanConfig.OpenAPI.Version
+		if version == "" {
+			version = helpers.CurrVersion()
+		}
+		title := BeanConfig.OpenAPI.Title
+		if title == "" {
+			title = BeanConfig.ProjectName
+		}
+
+		err := openapi.Register(e, OpenAPI, openapi.Config{
+			Info:        openapi.Info{Title: title, Description: BeanConfig.OpenAPI.Description, Version: version},
+			BasePath:    BeanConfig.HTTP.BasePath,
+			Path:        BeanConfig.OpenAPI.Path,
+			UI:          BeanConfig.OpenAPI.UI,
+			UIPath:      BeanConfig.OpenAPI.UIPath,
+			Skip:        BeanConfig.OpenAPI.SkipEndpoints,
+			Middlewares: guards,
+		})
+		if err != nil {
+			e.Logger.Error("openapi endpoints: ", err)
+		}
+
+		if BeanConfig.OpenAPI.Mock.On {
+			if BeanConfig.IsProduction() {
+				e.Logger.Error("openapi mock: disabled in the production environment ", BeanConfig.Environment)
+			} else {
+				var design *openapi.Document
+				if BeanConfig.OpenAPI.Mock.Document != "" {
+					design, err = openapi.LoadDocument(BeanConfig.OpenAPI.Mock.Document)
+					if err != nil {
+						e.Logger.Error("openapi mock: ", err)
+					}
+				}
+
+				openapi.Mock(e, OpenAPI, openapi.MockConfig{Document: design, Skip: BeanConfig.OpenAPI.SkipEndpoints})
+			}
+		}
+	}
+
 	// Register goroutine pool
+	for _, config := range BeanConfig.Pools {
+		if config.Name == "" {
+			continue
+		}
+
+		if _, err := gopool.RegisterConfig(config); err != nil {
+			e.Logger.Fatal("goroutine pool register failed: ", err, ". Server 🚀  crash landed. Exiting...")
+		}
+	}
+
 	for _, asyncPool := range BeanConfig.AsyncPool {
 		if asyncPool.Name == "" {
 			continue
@@ -441,16 +1356,19 @@ func NewEcho() *echo.Echo {
 }
 
 func (b *Bean) ServeAt(host, port string) {
-	b.Echo.Logger.Info("Starting " + b.Config.Environment + " " + b.Config.ProjectName + " at " + host + ":" + port + "...🚀")
+	b.Echo.Logger.Info("Starting " + b.Config.Environment + " " + b.Config.ProjectName + " at " + b.address(host, port) + "...🚀")
+	b.logMiddlewares()
 
-	b.UseErrorHandlerFuncs(berror.DefaultErrorHanderFunc)
+	b.UseErrorHandlerFuncs(precondition.ErrorHanderFunc, berror.DBErrorHanderFunc, berror.DefaultErrorHanderFunc)
 	b.Echo.HTTPErrorHandler = b.DefaultHTTPErrorHandler()
 
-	b.Echo.Validator = &validator.DefaultValidator{Validator: b.validate}
+	b.Echo.Validator = &validator.DefaultValidator{Validator: b.validate, Translator: b.translator}
+
+	// Refuse to start with an insecure configuration in the strict environments.
+	b.preflight()
 
 	s := http.Server{
-		Addr:    host + ":" + port,
-		Handler: b.Echo,
+		Handler: routePrefixes(b.handler(), nil, b.exclusivePrefixes("")),
 	}
 
 	// IMPORTANT: Keep-alive is default true but I kept this here to let you guys no that there is a settings
@@ -462,27 +1380,101 @@ func (b *Bean) ServeAt(host, port string) {
 		b.BeforeServe()
 	}
 
+	// Fail at the startup rather than at the first request if a dependency is not provided, once `BeforeServe`
+	// had a chance to provide the remaining ones.
+	if b.Container != nil {
+		if err := b.Container.Validate(); err != nil {
+			b.Echo.Logger.Fatal("dependency injection: ", err, ". Server 🚀  crash landed. Exiting...")
+		}
+	}
+
+	// Watch the config after `BeforeServe`, where the hooks of `OnConfigChange` are registered.
+	if b.Config.ConfigReload.On {
+		if err := b.WatchConfig(); err != nil {
+			b.Echo.Logger.Error("config reload: ", err)
+		}
+	}
+
 	// Keep all the route information in route.Routes
 	broute.Init(b.Echo)
 
+	// The server stops accepting requests in the intake stage of the shutdown.
+	if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+		Name:  "http",
+		Stage: shutdown.StageIntake,
+		Stop:  s.Shutdown,
+	}); err != nil {
+		b.Echo.Logger.Fatal(err)
+	}
+
+	if b.Config.Shutdown.Signals {
+		go func() {
+			quit := make(chan os.Signal, 1)
+			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+			sig := <-quit
+			signal.Stop(quit)
+
+			b.Echo.Logger.Info("Received " + sig.String() + ", shutting down " + b.Config.ProjectName + "...")
+			Shutdown(context.Background())
+		}()
+	}
+
+	// The TLS config is shared with the listeners without their own certificate.
+	var tlsConfig *tls.Config
+	serverTLS := func() (*tls.Config, error) {
+		if tlsConfig != nil {
+			return tlsConfig, nil
+		}
+		var err error
+		tlsConfig, err = b.TLSConfig()
+		return tlsConfig, err
+	}
+
+	if err := b.serveListeners(serverTLS); err != nil {
+		b.Echo.Logger.Fatal(err, ". Server 🚀  crash landed. Exiting...")
+	}
+
+	ln, err := listen(b.address(host, port), b.Config.HTTP.SocketMode)
+	if err != nil {
+		b.Echo.Logger.Fatal(err, ". Server 🚀  crash landed. Exiting...")
+	}
+
 	// Start the server
 	if b.Config.HTTP.SSL.On {
-		s.TLSConfig = &tls.Config{
-			MinVersion: b.Config.HTTP.SSL.MinTLSVersion,
+		if _, err := serverTLS(); err != nil {
+			b.Echo.Logger.Fatal(err, ". Server 🚀  crash landed. Exiting...")
 		}
+		s.TLSConfig = tlsConfig
 
-		if err := s.ListenAndServeTLS(b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile); err != nil && err != http.ErrServerClosed {
+		if b.Config.HTTP.HTTP3.On {
+			if http3Port, err := b.serveHTTP3(host, port, tlsConfig); err != nil {
+				b.Echo.Logger.Error("http3: ", err)
+			} else {
+				s.Handler = altSvc(s.Handler, http3Port)
+			}
+		}
+
+		// The certificates are in the TLS config.
+		if err := s.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
 			b.Echo.Logger.Fatal(err)
 		}
 
 	} else {
-		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.Serve(ln); err != nil && err != http.ErrServerClosed {
 			b.Echo.Logger.Fatal(err)
 		}
 	}
+
+	// Wait for the other subsystems if the server is closed by a signal.
+	if b.Config.Shutdown.Signals {
+		Shutdown(context.Background())
+	}
 }
 
 func (b *Bean) UseMiddlewares(middlewares ...echo.MiddlewareFunc) {
+	for _, m := range middlewares {
+		recordMiddleware(b.Echo, MiddlewareInfo{Name: funcName(m), Stage: MiddlewareStageGlobal}, nil)
+	}
 	b.Echo.Use(middlewares...)
 }
 
@@ -501,6 +1493,36 @@ func (b *Bean) UseValidation(validateFuncs ...validator.ValidatorFunc) {
 	}
 }
 
+// newTranslator registers the locales and the message overrides of `validation` in env.json.
+func newTranslator(validate *validatorV10.Validate) (*validator.Translator, error) {
+	translator, err := validator.NewTranslator(validate, BeanConfig.Validation.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, locale := range BeanConfig.Validation.Locales {
+		if err := translator.RegisterLocale(locale); err != nil {
+			return translator, err
+		}
+	}
+
+	for locale, messages := range BeanConfig.Validation.Messages {
+		for tag, message := range messages {
+			if err := translator.Override(locale, tag, message); err != nil {
+				return translator, err
+			}
+		}
+	}
+
+	return translator, nil
+}
+
+// Translator returns the translator of the validation error messages, to register more locales or
+// override the messages of a locale. It is nil if `validation.defaultLocale` is not set in env.json.
+func (b *Bean) Translator() *validator.Translator {
+	return b.translator
+}
+
 func (b *Bean) DefaultHTTPErrorHandler() echo.HTTPErrorHandler {
 	return func(err error, c echo.Context) {
 
@@ -521,6 +1543,9 @@ func (b *Bean) DefaultHTTPErrorHandler() echo.HTTPErrorHandler {
 				break
 			}
 		}
+
+		// Keep the server errors for the admin UI.
+		recordRecentError(c, err)
 	}
 }
 
@@ -537,6 +1562,15 @@ func (b *Bean) InitDB() {
 	var tenantMongoDBNames map[uint64]string
 	var tenantRedisDBs map[uint64]*dbdrivers.RedisDBConn
 	var masterMemoryDB *badger.DB
+	var memoryKV dbdrivers.KV
+
+	dbdrivers.Region = b.Config.Database.Region
+	secrets.Configure(b.Config.Database.Secrets)
+
+	// The pools of the master and tenant databases and the goroutine pools are exported to prometheus.
+	if b.Config.Prometheus.On {
+		b.registerPoolMetrics()
+	}
 
 	if b.Config.Database.Tenant.On {
 		masterMySQLDB, masterMySQLDBName = dbdrivers.InitMysqlMasterConn(b.Config.Database.MySQL)
@@ -551,7 +1585,10 @@ func (b *Bean) InitDB() {
 	}
 
 	if b.Config.Database.Memory.On {
-		masterMemoryDB = dbdrivers.InitMemoryConn(b.Config.Database.Memory)
+		memoryKV = dbdrivers.InitMemoryKV(b.Config.Database.Memory)
+		if badgerKV, ok := memoryKV.(*dbdrivers.BadgerKV); ok {
+			masterMemoryDB = badgerKV.DB
+		}
 	}
 
 	b.DBConn = &DBDeps{
@@ -566,10 +1603,235 @@ func (b *Bean) InitDB() {
 		MasterRedisDB:      masterRedisDB,
 		TenantRedisDBs:     tenantRedisDBs,
 		MemoryDB:           masterMemoryDB,
+		MemoryKV:           memoryKV,
+	}
+
+	// The databases are closed last, before the log files.
+	dbConn := b.DBConn
+	if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+		Name:      "databases",
+		Stage:     shutdown.StageClose,
+		DependsOn: []string{"logs"},
+		Stop:      dbConn.Close,
+	}); err != nil {
+		panic(err)
+	}
+
+	// The rotated secrets refresh the connections until the databases are closed.
+	if secrets.Watching() {
+		stop := secrets.Start(b.Config.Database.Secrets.RefreshInterval, func(err error) {
+			b.Logger().Error(err)
+		})
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+			Name:      "secrets",
+			Stage:     shutdown.StageClose,
+			DependsOn: []string{"databases"},
+			Stop: func(context.Context) error {
+				stop()
+				return nil
+			},
+		}); err != nil {
+			panic(err)
+		}
+	}
+
+	// The view fragments move to the master redis to be shared by all the servers.
+	if ViewFragments != nil && b.Config.HTML.FragmentCache.Store == "redis" {
+		if client := b.masterRedisClient(); client != nil {
+			ViewFragments.SetStore(goview.NewRedisFragmentStore(client, b.Config.HTML.FragmentCache.Prefix))
+		}
+	}
+
+	if b.Config.Database.Mongo.SyncIndexes {
+		if err := b.SyncMongoIndexes(context.Background(), false); err != nil {
+			panic(err)
+		}
+	}
+
+	// The sessions are stored in the master redis, or in the memory database if redis is not configured.
+	if b.Config.Session.On {
+		store, err := b.sessionStore()
+		if err != nil {
+			panic(err)
+		}
+
+		keyRing, err := b.sessionKeyRing()
+		if err != nil {
+			panic(err)
+		}
+
+		useMiddleware(b.Echo, "Session", map[string]interface{}{
+			"cookieName": b.Config.Session.CookieName,
+			"maxAge":     b.Config.Session.MaxAge,
+			"rolling":    b.Config.Session.Rolling,
+			"encrypted":  keyRing != nil,
+		}, nil, session.Middleware(session.Config{
+			Store:      store,
+			CookieName: b.Config.Session.CookieName,
+			Domain:     b.Config.Session.Domain,
+			Path:       b.Config.Session.Path,
+			MaxAge:     b.Config.Session.MaxAge,
+			Secure:     b.Config.Session.Secure,
+			HTTPOnly:   b.Config.Session.HTTPOnly,
+			SameSite:   b.Config.Session.SameSite,
+			Rolling:    b.Config.Session.Rolling,
+			KeyRing:    keyRing,
+		}))
+	}
+
+	// The synchronizer token of the CSRF protection is stored in the session.
+	if b.Config.Security.CSRF.On && b.Config.Security.CSRF.Mode == middleware.CSRFModeSession {
+		if !b.Config.Session.On {
+			panic("csrf session mode requires the session to be on")
+		}
+		useMiddleware(b.Echo, "CSRF", csrfInfo(), b.Config.Security.CSRF.SkipEndpoints, middleware.CSRF(csrfConfig()))
+	}
+
+	// The features degrade when the master databases they depend on are degraded or down.
+	for dependency, t := range b.Config.Degradation.Dependencies {
+		degrade.SetThresholds(dependency, degrade.Thresholds{
+			Latency:       t.Latency,
+			ErrorRate:     t.ErrorRate,
+			DownErrorRate: t.DownErrorRate,
+			Window:        t.Window,
+			MinCalls:      t.MinCalls,
+		})
+	}
+	for feature, policy := range b.Config.Degradation.Features {
+		degradeAt, err := degrade.ParseLevel(policy.DegradeAt)
+		if err != nil {
+			panic(err)
+		}
+		degrade.RegisterFeature(feature, degrade.Policy{
+			Dependencies: policy.Dependencies,
+			DegradeAt:    degradeAt,
+			Fallback:     policy.Fallback,
+			Warning:      policy.Warning,
+			StaleTTL:     policy.StaleTTL,
+		})
+	}
+	if b.Config.Degradation.CheckInterval > 0 {
+		b.registerHealthChecks()
+
+		timeout := b.Config.Degradation.CheckTimeout
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		c, cancel := context.WithCancel(context.Background())
+		degrade.StartMonitor(c, b.Config.Degradation.CheckInterval, timeout)
+
+		// The checks stop pinging the databases before they are closed.
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+			Name:  "degrade",
+			Stage: shutdown.StageIntake,
+			Stop: func(context.Context) error {
+				cancel()
+				return nil
+			},
+		}); err != nil {
+			cancel()
+			panic(err)
+		}
 	}
 }
 
+// registerHealthChecks registers the ping of the master databases as the "mysql", "mongo" and "redis"
+// dependencies of the degradation policies.
+func (b *Bean) registerHealthChecks() {
+	if db := b.DBConn.MasterMySQLDB; db != nil {
+		degrade.RegisterCheck("mysql", func(c context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(c)
+		})
+	}
+
+	if client := b.DBConn.MasterMongoDB; client != nil {
+		degrade.RegisterCheck("mongo", func(c context.Context) error {
+			return client.Ping(c, nil)
+		})
+	}
+
+	if client := b.masterRedisClient(); client != nil {
+		degrade.RegisterCheck("redis", func(c context.Context) error {
+			return client.Ping(c).Err()
+		})
+	}
+}
+
+// sessionKeyRing returns the key ring of `Bean.SessionKeys` or of `session.keys`, nil if there isn't any key.
+func (b *Bean) sessionKeyRing() (*session.KeyRing, error) {
+	provider := b.SessionKeys
+	if provider == nil {
+		if len(b.Config.Session.Keys) == 0 {
+			return nil, nil
+		}
+		return session.NewKeyRing(b.Config.Session.Keys...)
+	}
+
+	keys, err := provider(context.Background())
+	if err != nil {
+		return nil, errors.WithMessage(err, "session keys")
+	}
+	ring, err := session.NewKeyRing(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Config.Session.KeyRefresh > 0 {
+		go ring.Watch(context.Background(), provider, b.Config.Session.KeyRefresh, func(err error) {
+			b.Echo.Logger.Error("session keys refresh failed: ", err)
+		})
+	}
+
+	return ring, nil
+}
+
+func (b *Bean) sessionStore() (session.Store, error) {
+	if client := b.masterRedisClient(); client != nil {
+		return session.NewRedisStore(client, b.Config.Session.Prefix), nil
+	}
+
+	if b.DBConn.MemoryKV != nil {
+		return session.NewKVStore(b.DBConn.MemoryKV, b.Config.Session.Prefix), nil
+	}
+
+	return nil, errors.New("session requires the master redis or the memory database")
+}
+
+// SyncMongoIndexes creates the registered mongo collections, validators and indexes (see
+// `dbdrivers.RegisterMongoCollection`) on master and all tenant databases. With `dryRun` the
+// missing objects are only logged. The tenants restricted to another region are skipped.
+func (b *Bean) SyncMongoIndexes(c context.Context, dryRun bool) error {
+	if b.DBConn == nil {
+		return errors.New("database is not initialized, call `InitDB` first")
+	}
+
+	logger := b.LoggerWithContext(c)
+	opts := dbdrivers.MongoSyncOptions{DryRun: dryRun, Logf: logger.Infof}
+
+	if _, err := dbdrivers.SyncMongoCollections(c, b.DBConn.MasterMongoDB, b.DBConn.MasterMongoDBName, opts); err != nil {
+		return err
+	}
+
+	for tenantID, client := range b.DBConn.TenantMongoDBs {
+		if err := dbdrivers.CheckResidency(tenantID); err != nil {
+			logger.Warnf("skip the mongo sync of tenant %d: %v", tenantID, err)
+			continue
+		}
+
+		if _, err := dbdrivers.SyncMongoCollections(c, client, b.DBConn.TenantMongoDBNames[tenantID], opts); err != nil {
+			return errors.Wrapf(err, "tenant %d", tenantID)
+		}
+	}
+
+	return nil
+}
+
 // The bean Logger to have debug log from anywhere.
+// Deprecated: use `Bean.Logger` or `LoggerWithContext`.
 func Logger() echo.Logger {
 	return BeanLogger
 }
@@ -612,13 +1874,168 @@ func SentryCaptureMessage(c echo.Context, msg string) {
 	sentry.CurrentHub().Clone().CaptureMessage(msg)
 }
 
+// AddTemplateFunc adds a function to the view templates, like `b.AddTemplateFunc("price", formatPrice)`.
+// It can be called at any time, the templates are parsed again with the function.
+func (b *Bean) AddTemplateFunc(name string, fn interface{}) {
+	if views := b.goviewRenderer(); views != nil {
+		views.AddFunc(name, fn)
+	}
+}
+
+// viewConfig returns the goview config of `html` in env.json, the empty fields are the defaults of
+// `goview.DefaultConfig`.
+func viewConfig(funcs template.FuncMap, disableCache bool) goview.Config {
+	config := goview.DefaultConfig
+	config.Funcs = funcs
+	config.DisableCache = disableCache
+	config.Fragments = ViewFragments
+	config.Partials = []string{}
+
+	html := BeanConfig.HTML
+	if html.Root != "" {
+		config.Root = html.Root
+	}
+	if html.Extension != "" {
+		config.Extension = html.Extension
+	}
+	if html.Master != "" {
+		config.Master = html.Master
+	}
+	if len(html.Partials) > 0 {
+		config.Partials = html.Partials
+	}
+	if html.Delims.Left != "" && html.Delims.Right != "" {
+		config.Delims = goview.Delims{Left: html.Delims.Left, Right: html.Delims.Right}
+	}
+
+	return config
+}
+
+// AddBreadcrumb records a business step of the request, like `AddBreadcrumb(c, "cart", "coupon applied", data)`.
+// The breadcrumbs are attached to the sentry events of the request if sentry is on, otherwise they are
+// written to the access log of the request if it fails, so that the error logs tell the steps before the failure.
+func AddBreadcrumb(c echo.Context, category, msg string, data map[string]interface{}) {
+	middleware.AddBreadcrumb(c, category, msg, data)
+}
+
 // To clean up any bean resources before the program terminates.
 // Call this function using `defer` like `defer Cleanup()`
 func Cleanup() {
+	Shutdown(context.Background())
+}
+
+// Shutdown stops the subsystems registered into `shutdown` in dependency order and returns the report,
+// the components which didn't stop cleanly are written to stderr as the log files are closed by then.
+// Bean stops the http servers of the instances and the `OnCleanup` functions in the intake stage, drains
+// the goroutine pools, flushes the sentry events then closes the databases of the instances and the log
+// files. It runs once, the next calls wait for the first one.
+func Shutdown(c context.Context) shutdown.Report {
+	for _, component := range shutdownComponents() {
+		// The components are already registered if the shutdown has started.
+		_ = shutdown.Register(component)
+	}
+
+	setShutdownTimeouts(BeanConfig, shutdown.SetTimeout)
+
+	report := shutdown.Shutdown(c)
+	if !report.Clean() {
+		fmt.Fprintln(os.Stderr, report)
+	}
+
+	return report
+}
+
+// setShutdownTimeouts sets the stage timeouts of `shutdown` of the config with `set`.
+func setShutdownTimeouts(config Config, set func(stage shutdown.Stage, timeout time.Duration)) {
+	for name, timeout := range config.Shutdown.Timeouts {
+		stage, err := shutdown.ParseStage(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		set(stage, timeout)
+	}
+	if _, ok := config.Shutdown.Timeouts["drain"]; !ok {
+		set(shutdown.StageDrain, config.PoolDrainTimeout)
+	}
+}
+
+// shutdownComponents returns the components of the global subsystems of bean.
+func shutdownComponents() []shutdown.Component {
+	components := []shutdown.Component{
+		{
+			// Stop the registered subsystems first, last registered first, so that their tasks are drained.
+			Name:  "cleanups",
+			Stage: shutdown.StageIntake,
+			Stop: func(c context.Context) error {
+				cleanupsMu.Lock()
+				fns := cleanups
+				cleanups = nil
+				cleanupsMu.Unlock()
+
+				for i := len(fns) - 1; i >= 0; i-- {
+					fns[i]()
+				}
+				return nil
+			},
+		},
+		{
+			// Wait for the running tasks of the goroutine pools.
+			Name:  "gopool",
+			Stage: shutdown.StageDrain,
+			Stop: func(c context.Context) error {
+				timeout := shutdown.DefaultStageTimeout
+				if deadline, ok := c.Deadline(); ok {
+					timeout = time.Until(deadline)
+				}
+				return gopool.Drain(timeout)
+			},
+		},
+		{
+			// Close the log files and the syslog connections, after the databases which may log on close.
+			Name:  "logs",
+			Stage: shutdown.StageClose,
+			Stop: func(c context.Context) error {
+				logOutputsMu.Lock()
+				defer logOutputsMu.Unlock()
+
+				for _, output := range logOutputs {
+					_ = output.Close()
+				}
+				logOutputs = nil
+				return nil
+			},
+		},
+	}
+
 	if BeanConfig.Sentry.On {
-		// Flush buffered sentry events if any.
-		sentry.Flush(BeanConfig.Sentry.Timeout)
+		components = append(components, shutdown.Component{
+			// Flush buffered sentry events if any.
+			Name:  "sentry",
+			Stage: shutdown.StageFlush,
+			Stop: func(c context.Context) error {
+				timeout := BeanConfig.Sentry.Timeout
+				if deadline, ok := c.Deadline(); ok && time.Until(deadline) < timeout {
+					timeout = time.Until(deadline)
+				}
+				if !sentry.Flush(timeout) {
+					return errors.New("sentry: flush timed out")
+				}
+				return nil
+			},
+		})
 	}
+
+	return components
+}
+
+// OnCleanup registers `fn` to be called by `Cleanup` before the goroutine pools are drained. (example: to
+// stop a subscriber which submits tasks to the pools)
+func OnCleanup(fn func()) {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+
+	cleanups = append(cleanups, fn)
 }
 
 // Modify event through beforeSend function.
@@ -634,6 +2051,7 @@ func DefaultBeforeSend(event *sentry.Event, hint *sentry.EventHint) *sentry.Even
 		event.Contexts["Error"] = map[string]interface{}{
 			"HTTPStatusCode": err.HTTPStatusCode,
 			"GlobalErrCode":  err.GlobalErrCode,
+			"Retryable":      err.Retryable,
 			"Message":        err.Error(),
 		}
 		return event
@@ -653,6 +2071,97 @@ func DefaultBeforeBreadcrumb(breadcrumb *sentry.Breadcrumb, hint *sentry.Breadcr
 	return breadcrumb
 }
 
+// masterRedisClient returns the client of the master redis or nil if it's not configured.
+func (b *Bean) masterRedisClient() redis.UniversalClient {
+	if b.DBConn == nil {
+		return nil
+	}
+
+	if conn, ok := b.DBConn.MasterRedisDB[0]; ok && conn != nil {
+		return conn.Client()
+	}
+
+	return nil
+}
+
+func corsConfig() echomiddleware.CORSConfig {
+	cors := BeanConfig.HTTP.CORS
+
+	config := echomiddleware.CORSConfig{
+		AllowOrigins:     cors.AllowOrigins,
+		AllowMethods:     BeanConfig.HTTP.AllowedMethod,
+		AllowHeaders:     cors.AllowHeaders,
+		AllowCredentials: cors.AllowCredentials,
+		ExposeHeaders:    cors.ExposeHeaders,
+		MaxAge:           cors.MaxAge,
+	}
+
+	if len(config.AllowOrigins) == 0 && len(cors.AllowOriginPatterns) == 0 && CORSAllowOriginFunc == nil {
+		config.AllowOrigins = []string{"*"}
+	}
+
+	// IMPORTANT: echo ignores `AllowOrigins` when `AllowOriginFunc` is set, so the function has to check
+	// the listed origins as well.
+	if len(cors.AllowOriginPatterns) > 0 || CORSAllowOriginFunc != nil {
+		patterns := make([]*regexp.Regexp, 0, len(cors.AllowOriginPatterns))
+		for _, pattern := range cors.AllowOriginPatterns {
+			patterns = append(patterns, regexp.MustCompile(pattern))
+		}
+
+		origins := config.AllowOrigins
+		config.AllowOriginFunc = func(origin string) (bool, error) {
+			for _, o := range origins {
+				if o == "*" || strings.EqualFold(o, origin) {
+					return true, nil
+				}
+			}
+
+			for _, pattern := range patterns {
+				if pattern.MatchString(origin) {
+					return true, nil
+				}
+			}
+
+			if CORSAllowOriginFunc != nil {
+				return CORSAllowOriginFunc(origin)
+			}
+
+			return false, nil
+		}
+	}
+
+	return config
+}
+
+func csrfConfig() middleware.CSRFConfig {
+	csrf := BeanConfig.Security.CSRF
+
+	return middleware.CSRFConfig{
+		Skipper:        endPointsSkipper(csrf.SkipEndpoints),
+		Mode:           csrf.Mode,
+		CookieName:     csrf.CookieName,
+		HeaderName:     csrf.HeaderName,
+		FormField:      csrf.FormField,
+		CookieDomain:   csrf.CookieDomain,
+		CookiePath:     csrf.CookiePath,
+		CookieMaxAge:   csrf.CookieMaxAge,
+		CookieSecure:   csrf.CookieSecure,
+		CookieSameSite: csrf.CookieSameSite,
+	}
+}
+
+// csrfInfo is the config of the CSRF middleware shown by `MiddlewareChain`.
+func csrfInfo() map[string]interface{} {
+	csrf := BeanConfig.Security.CSRF
+
+	return map[string]interface{}{
+		"mode":       csrf.Mode,
+		"cookieName": csrf.CookieName,
+		"headerName": csrf.HeaderName,
+		"formField":  csrf.FormField,
+	}
+}
+
 // endPointsSkipper ignores endpoints which are listed in skipEndpoints for logging or
 // metrics data collection.
 func endPointsSkipper(skipEndpoints []string) func(c echo.Context) bool {
@@ -668,16 +2177,30 @@ func endPointsSkipper(skipEndpoints []string) func(c echo.Context) bool {
 	}
 }
 
-// openFile opens and return the file, if doesn't exist, create it, or append to the file with the directory.
-func openFile(path string) (*os.File, error) {
-	if _, err := os.Stat(path); err != nil {
-		if os.IsNotExist(err) {
-			if err := os.MkdirAll(filepath.Dir(path), 0764); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+// metricsPath returns the endpoint of the prometheus metrics.
+func metricsPath() string {
+	if BeanConfig.Prometheus.MetricsPath != "" {
+		return BeanConfig.Prometheus.MetricsPath
 	}
-	return os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0664)
+	return middleware.DefaultPrometheusConfig.MetricsPath
+}
+
+// openLog opens the writer of a log with its outputs and rotation. It returns nil if neither a path
+// nor an output is configured. The writer is closed by `Cleanup`.
+func openLog(path string, outputs []string, rotation logwriter.RotationConfig) (io.Writer, error) {
+	output, err := logwriter.New(logwriter.Config{
+		Path:      path,
+		Outputs:   outputs,
+		Rotation:  rotation,
+		SyslogTag: BeanConfig.ProjectName,
+	})
+	if err != nil || output == nil {
+		return nil, err
+	}
+
+	logOutputsMu.Lock()
+	logOutputs = append(logOutputs, output)
+	logOutputsMu.Unlock()
+
+	return output, nil
 }
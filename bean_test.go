@@ -85,3 +85,27 @@ func newFakeError(msg string) error {
 		Message: msg,
 	}
 }
+
+func TestCorsConfig(t *testing.T) {
+	defer func(config Config) { BeanConfig = config }(BeanConfig)
+
+	BeanConfig = Config{}
+	assert.Equal(t, []string{"*"}, corsConfig().AllowOrigins)
+
+	BeanConfig.HTTP.CORS.AllowOrigins = []string{"https://example.com"}
+	BeanConfig.HTTP.CORS.AllowOriginPatterns = []string{`^https://[a-z0-9-]+\.example\.com$`}
+	BeanConfig.HTTP.CORS.AllowCredentials = true
+
+	config := corsConfig()
+	assert.True(t, config.AllowCredentials)
+	for origin, allowed := range map[string]bool{
+		"https://example.com":         true,
+		"https://shop.example.com":    true,
+		"https://example.com.evil.io": false,
+		"http://shop.example.com":     false,
+	} {
+		ok, err := config.AllowOriginFunc(origin)
+		assert.NoError(t, err)
+		assert.Equal(t, allowed, ok, origin)
+	}
+}
@@ -0,0 +1,158 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package beantest spins up a bean instance for the handler tests of the services: an in-memory config,
+// fake or throwaway databases, JWT tokens and the assertions of the requests and the responses. So that a
+// handler test doesn't need its own scaffolding.
+//
+//	h := beantest.New(t, beantest.WithRedis(), beantest.WithSQLite())
+//	h.Bean.GET("/users/:id", handler.Show)
+//
+//	res := h.GET("/users/1", beantest.Bearer(beantest.JWT{Secret: "secret"}.Token(t, jwt.MapClaims{"sub": "1"})))
+//	res.AssertStatus(http.StatusOK).AssertJSONPath("data.id", "1")
+package beantest
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/retail-ai-inc/bean"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/precondition"
+	"github.com/spf13/viper"
+)
+
+// DefaultConfig is the config of the harness, `WithConfig` overrides its settings. The access log, the
+// metrics and sentry are off so that the tests only have the debug log, which is kept in `Harness.Log`.
+const DefaultConfig = `{
+	"projectName": "beantest",
+	"environment": "test",
+	"secret": "beantest",
+	"http": {
+		"bodyLimit": "1M",
+		"allowedMethod": ["DELETE", "GET", "POST", "PUT", "PATCH", "HEAD", "OPTIONS"],
+		"timeout": "0s"
+	},
+	"accessLog": {"on": false},
+	"prometheus": {"on": false},
+	"sentry": {"on": false}
+}`
+
+// Harness is a bean instance for the handler tests with its fake databases.
+type Harness struct {
+	T    testing.TB
+	Bean *bean.Bean
+
+	// Log is the output of the debug logger.
+	Log *bytes.Buffer
+
+	// Redis is the fake redis of `WithRedis`, the master redis connection of `Bean.DBConn`.
+	Redis *miniredis.Miniredis
+
+	// SQLMock is the mock of `WithSQLMock`, the master MySQL connection of `Bean.DBConn`.
+	SQLMock sqlmock.Sqlmock
+
+	config []string
+	setups []func(h *Harness)
+}
+
+// Option configures the harness of `New`.
+type Option func(h *Harness)
+
+// WithConfig overrides the settings of `DefaultConfig` with the JSON `config`, formatted like `env.json`.
+// The options are merged in order.
+func WithConfig(config string) Option {
+	return func(h *Harness) {
+		h.config = append(h.config, config)
+	}
+}
+
+// WithSetup calls `fn` once the bean instance is created, to register the routes or the middlewares.
+func WithSetup(fn func(h *Harness)) Option {
+	return func(h *Harness) {
+		h.setups = append(h.setups, fn)
+	}
+}
+
+// `bean.New` reads the global config, so the harnesses are created one at a time.
+var newMu sync.Mutex
+
+// New returns a harness with a new bean instance configured by `DefaultConfig` and `options`. The global
+// config of bean is restored and the databases are closed when the test finishes.
+func New(t testing.TB, options ...Option) *Harness {
+	t.Helper()
+
+	h := &Harness{T: t, Log: new(bytes.Buffer), config: []string{DefaultConfig}}
+	for _, option := range options {
+		option(h)
+	}
+
+	config, err := LoadConfig(h.config...)
+	if err != nil {
+		t.Fatalf("beantest: %v", err)
+	}
+
+	newMu.Lock()
+	previous := bean.BeanConfig
+	bean.BeanConfig = config
+	h.Bean = bean.New()
+	newMu.Unlock()
+
+	t.Cleanup(func() { bean.BeanConfig = previous })
+
+	h.Bean.Echo.Logger.SetOutput(h.Log)
+	h.Bean.DBConn = &bean.DBDeps{}
+
+	// The error handlers of `ServeAt`.
+	h.Bean.UseErrorHandlerFuncs(precondition.ErrorHanderFunc, berror.DBErrorHanderFunc, berror.DefaultErrorHanderFunc)
+	h.Bean.Echo.HTTPErrorHandler = h.Bean.DefaultHTTPErrorHandler()
+
+	for _, setup := range h.setups {
+		setup(h)
+	}
+
+	return h
+}
+
+// LoadConfig parses the JSON `configs`, formatted like `env.json`, into a bean config. The later configs
+// override the settings of the former ones.
+func LoadConfig(configs ...string) (bean.Config, error) {
+	v := viper.New()
+	v.SetConfigType("json")
+
+	for _, config := range configs {
+		if err := v.MergeConfig(strings.NewReader(config)); err != nil {
+			return bean.Config{}, err
+		}
+	}
+
+	var config bean.Config
+	if err := v.Unmarshal(&config); err != nil {
+		return bean.Config{}, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,100 @@
+package beantest
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/response"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name"`
+}
+
+func TestHarness(t *testing.T) {
+	factory := JWT{Secret: "secret", Issuer: "beantest"}
+
+	h := New(t, WithConfig(`{"projectName": "users"}`), WithRedis(), WithSQLite(&user{}), WithSetup(func(h *Harness) {
+		h.Bean.GET("/users/:name", func(c echo.Context) error {
+			var claims jwt.MapClaims
+			if err := helpers.DecodeJWTWithOptions(c, &claims, "secret", helpers.JWTOptions{Issuer: "beantest"}); err != nil {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+
+			db, err := h.Bean.DBConn.MasterMySQLConn()
+			if err != nil {
+				return err
+			}
+
+			var u user
+			if err := db.Where("name = ?", c.Param("name")).First(&u).Error; err != nil {
+				return err
+			}
+
+			conn, err := h.Bean.DBConn.RedisConn(0)
+			if err != nil {
+				return err
+			}
+			visits, err := conn.Host.Incr(context.Background(), "visits").Result()
+			if err != nil {
+				return err
+			}
+
+			return response.OK(c, map[string]interface{}{"user": u, "visits": visits, "sub": claims["sub"]})
+		})
+	}))
+
+	assert.Equal(t, "users", h.Bean.Config.ProjectName)
+	assert.Equal(t, "test", h.Bean.Config.Environment)
+
+	assert.NoError(t, h.Bean.DBConn.MasterMySQLDB.Create(&user{Name: "alice"}).Error)
+
+	h.GET("/users/alice", Bearer(factory.Token(t, jwt.MapClaims{"sub": "42"}))).
+		AssertStatus(http.StatusOK).
+		AssertJSONPath("data.user.name", "alice").
+		AssertJSONPath("data.visits", 1.0).
+		AssertJSONPath("data.sub", "42")
+
+	visits, err := h.Redis.Get("visits")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", visits)
+
+	h.GET("/users/alice", Bearer(factory.ExpiredToken(t, nil))).AssertStatus(http.StatusUnauthorized)
+	h.GET("/users/alice").AssertStatus(http.StatusUnauthorized)
+}
+
+func TestSQLMock(t *testing.T) {
+	h := New(t, WithSQLMock())
+	h.SQLMock.ExpectExec("DELETE FROM `users`").WillReturnResult(sqlmockResult(1))
+
+	h.Bean.DELETE("/users/:id", func(c echo.Context) error {
+		if err := h.Bean.DBConn.MasterMySQLDB.Delete(&user{}, c.Param("id")).Error; err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	h.DELETE("/users/1").AssertStatus(http.StatusNoContent)
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(DefaultConfig, `{"http": {"bodyLimit": "2M"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "2M", config.HTTP.BodyLimit)
+	assert.Contains(t, config.HTTP.AllowedMethod, http.MethodGet)
+
+	_, err = LoadConfig(`{`)
+	assert.Error(t, err)
+}
+
+func sqlmockResult(affected int64) driver.Result {
+	return sqlmock.NewResult(0, affected)
+}
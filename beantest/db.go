@@ -0,0 +1,156 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package beantest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// MongoURIEnv is the environment variable of the URI of the mongo server of `WithMongo`, like the one of a
+// container started by the CI: `docker run -d -p 27017:27017 mongo`.
+const MongoURIEnv = "BEANTEST_MONGO_URI"
+
+// WithRedis starts a fake redis, `Harness.Redis`, as the master redis connection.
+func WithRedis() Option {
+	return WithSetup(func(h *Harness) {
+		h.Redis = miniredis.RunT(h.T)
+
+		client := redis.NewClient(&redis.Options{Addr: h.Redis.Addr()})
+		h.T.Cleanup(func() { client.Close() })
+
+		h.Bean.DBConn.MasterRedisDB = map[uint64]*dbdrivers.RedisDBConn{0: {Host: client}}
+	})
+}
+
+// WithSQLite opens an in-memory sqlite database, migrated with `models`, as the master MySQL connection.
+// The SQL specific to MySQL is not supported, use `WithSQLMock` for such queries.
+func WithSQLite(models ...interface{}) Option {
+	return WithSetup(func(h *Harness) {
+		// Every harness has its own database, shared by the connections of the pool.
+		dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", uuid.NewString())
+
+		db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			h.T.Fatalf("beantest: sqlite: %v", err)
+		}
+		closeGorm(h, db)
+
+		if len(models) > 0 {
+			if err := db.AutoMigrate(models...); err != nil {
+				h.T.Fatalf("beantest: sqlite migration: %v", err)
+			}
+		}
+
+		h.Bean.DBConn.MasterMySQLDB = db
+		h.Bean.DBConn.MasterMySQLDBName = "beantest"
+	})
+}
+
+// WithSQLMock opens a mocked MySQL connection, `Harness.SQLMock`, as the master MySQL connection. The
+// expectations are checked when the test finishes. The writes of gorm are not wrapped in a transaction so
+// that only the queries of the handler are expected.
+func WithSQLMock() Option {
+	return WithSetup(func(h *Harness) {
+		conn, mock, err := sqlmock.New()
+		if err != nil {
+			h.T.Fatalf("beantest: sqlmock: %v", err)
+		}
+
+		db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+			Logger:                 logger.Discard,
+			SkipDefaultTransaction: true,
+		})
+		if err != nil {
+			h.T.Fatalf("beantest: sqlmock: %v", err)
+		}
+		closeGorm(h, db)
+
+		h.T.Cleanup(func() {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				h.T.Errorf("beantest: sqlmock: %v", err)
+			}
+		})
+
+		h.SQLMock = mock
+		h.Bean.DBConn.MasterMySQLDB = db
+		h.Bean.DBConn.MasterMySQLDBName = "beantest"
+	})
+}
+
+// WithMongo connects to the mongo server of `MongoURIEnv` and uses a new database, dropped when the test
+// finishes, as the master mongo database. The test is skipped if `MongoURIEnv` is not set.
+func WithMongo() Option {
+	return WithSetup(func(h *Harness) {
+		uri := os.Getenv(MongoURIEnv)
+		if uri == "" {
+			h.T.Skipf("beantest: %s is not set", MongoURIEnv)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err == nil {
+			err = client.Ping(ctx, nil)
+		}
+		if err != nil {
+			h.T.Fatalf("beantest: mongo: %v", err)
+		}
+
+		name := "beantest_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+		h.T.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			_ = client.Database(name).Drop(ctx)
+			_ = client.Disconnect(ctx)
+		})
+
+		h.Bean.DBConn.MasterMongoDB = client
+		h.Bean.DBConn.MasterMongoDBName = name
+	})
+}
+
+func closeGorm(h *Harness, db *gorm.DB) {
+	h.T.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,211 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package beantest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	broute "github.com/retail-ai-inc/bean/route"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RequestOption sets the request of `Harness.Do`.
+type RequestOption func(req *http.Request)
+
+// Header sets the header `key` of the request.
+func Header(key, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// Bearer sets the bearer `token` as the `Authorization` header of the request.
+func Bearer(token string) RequestOption {
+	return Header(echo.HeaderAuthorization, "Bearer "+token)
+}
+
+// Query adds the query `values` to the URL of the request.
+func Query(values url.Values) RequestOption {
+	return func(req *http.Request) {
+		q := req.URL.Query()
+		for k, vs := range values {
+			for _, v := range vs {
+				q.Add(k, v)
+			}
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// Do serves the request `method` `target` with `body` by the bean instance. The body is sent as is if
+// it's a string, a `[]byte` or an `io.Reader`, and encoded as JSON otherwise. A nil body sends no body.
+// The `Content-Type` is JSON unless it's set by `Header`, so that the errors are JSON too.
+func (h *Harness) Do(method, target string, body interface{}, options ...RequestOption) *Response {
+	h.T.Helper()
+
+	var reader io.Reader
+
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case []byte:
+		reader = bytes.NewReader(b)
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		require.NoError(h.T, err, "beantest: request body")
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	for _, option := range options {
+		option(req)
+	}
+
+	// The route table of `ServeAt`, the routes can be added until the request.
+	broute.Init(h.Bean.Echo)
+
+	rec := httptest.NewRecorder()
+	h.Bean.Echo.ServeHTTP(rec, req)
+
+	return &Response{ResponseRecorder: rec, t: h}
+}
+
+// GET serves a GET request.
+func (h *Harness) GET(target string, options ...RequestOption) *Response {
+	h.T.Helper()
+	return h.Do(http.MethodGet, target, nil, options...)
+}
+
+// POST serves a POST request with `body`.
+func (h *Harness) POST(target string, body interface{}, options ...RequestOption) *Response {
+	h.T.Helper()
+	return h.Do(http.MethodPost, target, body, options...)
+}
+
+// PUT serves a PUT request with `body`.
+func (h *Harness) PUT(target string, body interface{}, options ...RequestOption) *Response {
+	h.T.Helper()
+	return h.Do(http.MethodPut, target, body, options...)
+}
+
+// PATCH serves a PATCH request with `body`.
+func (h *Harness) PATCH(target string, body interface{}, options ...RequestOption) *Response {
+	h.T.Helper()
+	return h.Do(http.MethodPatch, target, body, options...)
+}
+
+// DELETE serves a DELETE request.
+func (h *Harness) DELETE(target string, options ...RequestOption) *Response {
+	h.T.Helper()
+	return h.Do(http.MethodDelete, target, nil, options...)
+}
+
+// Response is the recorded response of `Harness.Do`, its assertions fail the test and return the
+// response so that they can be chained.
+type Response struct {
+	*httptest.ResponseRecorder
+	t *Harness
+}
+
+// AssertStatus asserts the status code of the response.
+func (r *Response) AssertStatus(status int) *Response {
+	r.t.T.Helper()
+	assert.Equal(r.t.T, status, r.Code, "beantest: status of the response %s", r.Body.String())
+	return r
+}
+
+// AssertHeader asserts the header `key` of the response.
+func (r *Response) AssertHeader(key, value string) *Response {
+	r.t.T.Helper()
+	assert.Equal(r.t.T, value, r.Header().Get(key), "beantest: header %s of the response", key)
+	return r
+}
+
+// AssertJSON asserts that the body of the response is the JSON `expected`, whatever the order of the
+// keys and the spaces.
+func (r *Response) AssertJSON(expected string) *Response {
+	r.t.T.Helper()
+	assert.JSONEq(r.t.T, expected, r.Body.String())
+	return r
+}
+
+// AssertJSONPath asserts the value at the dotted `path` of the JSON body, like `data.items.0.id`. The
+// numbers of the body are float64.
+func (r *Response) AssertJSONPath(path string, expected interface{}) *Response {
+	r.t.T.Helper()
+
+	value, ok := r.JSONPath(path)
+	if assert.True(r.t.T, ok, "beantest: no %q in the response %s", path, r.Body.String()) {
+		assert.Equal(r.t.T, expected, value, "beantest: %q of the response", path)
+	}
+
+	return r
+}
+
+// JSON decodes the body of the response into `v`.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.T.Helper()
+	require.NoError(r.t.T, json.Unmarshal(r.Body.Bytes(), v), "beantest: response body %s", r.Body.String())
+	return r
+}
+
+// JSONPath returns the value at the dotted `path` of the JSON body, false if it doesn't exist.
+func (r *Response) JSONPath(path string) (interface{}, bool) {
+	var value interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &value); err != nil {
+		return nil, false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
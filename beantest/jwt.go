@@ -0,0 +1,98 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package beantest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// JWT signs the tokens of the tests with HS256, like `helpers.EncodeJWT`.
+type JWT struct {
+	// Required.
+	Secret string
+
+	// Issuer is the `iss` claim of the tokens.
+	// Optional. Default value "", no `iss` claim.
+	Issuer string
+
+	// Audience is the `aud` claim of the tokens.
+	// Optional. Default value nil, no `aud` claim.
+	Audience []string
+
+	// TTL is the lifetime of the tokens.
+	// Optional. Default value 1h.
+	TTL time.Duration
+}
+
+// Token returns a token with `claims` and the `iat`, `exp`, `iss` and `aud` claims of the factory, unless
+// `claims` sets them.
+func (f JWT) Token(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+
+	ttl := f.TTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+
+	now := time.Now()
+
+	return f.sign(t, claims, now, now.Add(ttl))
+}
+
+// ExpiredToken returns a token with `claims` which expired a minute ago.
+func (f JWT) ExpiredToken(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+
+	now := time.Now()
+
+	return f.sign(t, claims, now.Add(-time.Hour), now.Add(-time.Minute))
+}
+
+func (f JWT) sign(t testing.TB, claims jwt.MapClaims, issuedAt, expiresAt time.Time) string {
+	t.Helper()
+
+	all := jwt.MapClaims{
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
+	}
+	if f.Issuer != "" {
+		all["iss"] = f.Issuer
+	}
+	if len(f.Audience) > 0 {
+		all["aud"] = f.Audience
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	token, err := helpers.EncodeJWT(all, f.Secret)
+	if err != nil {
+		t.Fatalf("beantest: jwt: %v", err)
+	}
+
+	return token
+}
@@ -0,0 +1,343 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package breaker provides a circuit breaker for the calls to the upstream dependencies, like a database
+// or another service, so that a failing dependency is given time to recover instead of being flooded with
+// requests which will fail anyway. The state can be shared between the replicas through redis.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// ErrOpen is returned without calling the dependency while the circuit is open.
+var ErrOpen = errors.New("breaker: circuit is open")
+
+// State of a circuit.
+type State int
+
+const (
+	// Closed lets all the calls through.
+	Closed State = iota
+	// Open rejects all the calls with `ErrOpen` until the cooldown is over.
+	Open
+	// HalfOpen lets a probe call through, its result closes or opens the circuit again.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Config defines the config of a breaker.
+type Config struct {
+	// Threshold is the number of failures within `Interval` which opens the circuit.
+	// Optional. Default value 5.
+	Threshold int
+
+	// Interval is the window in which the failures are counted, a success resets the count.
+	// Optional. Default value 1m.
+	Interval time.Duration
+
+	// Cooldown is how long the circuit stays open before the probes are allowed.
+	// Optional. Default value 30s.
+	Cooldown time.Duration
+
+	// HalfOpenProbes is the number of consecutive successful probes which closes the circuit. The probes
+	// are sent one at a time.
+	// Optional. Default value 1.
+	HalfOpenProbes int
+
+	// IsFailure decides whether an error counts as a failure of the dependency.
+	// Optional. Default value `IsFailure`.
+	IsFailure func(err error) bool
+
+	// Store holds the state of the circuit. Use a `RedisStore` to trip the circuit on all the replicas
+	// at the same time.
+	// Optional. Default value a `MemoryStore` local to the process.
+	Store Store
+}
+
+// DefaultConfig is the default config of a breaker.
+var DefaultConfig = Config{
+	Threshold:      5,
+	Interval:       time.Minute,
+	Cooldown:       30 * time.Second,
+	HalfOpenProbes: 1,
+	IsFailure:      IsFailure,
+}
+
+// IsFailure counts all the errors as failures except the cancellation by the caller and the not found
+// errors of gorm and mongo, which mean the dependency is healthy.
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// Breaker is a named circuit, safe for the concurrent use. Create one per dependency and reuse it.
+type Breaker struct {
+	name   string
+	config Config
+
+	mu        sync.Mutex
+	failures  int64 // Last known number of failures, to skip the store when there is nothing to reset.
+	successes int   // Consecutive successful probes.
+	probing   bool
+
+	now func() time.Time
+}
+
+// New returns the breaker `name`, the zero fields of `config` are set from `DefaultConfig`. Breakers with
+// the same name share their state when they use the same `RedisStore`.
+func New(name string, config Config) *Breaker {
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultConfig.Threshold
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultConfig.Cooldown
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = DefaultConfig.HalfOpenProbes
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = DefaultConfig.IsFailure
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+
+	registerMetrics()
+	stateGauge.WithLabelValues(name).Set(float64(Closed))
+
+	return &Breaker{name: name, config: config, now: time.Now}
+}
+
+// Name returns the name of the breaker.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Execute calls `fn` if the circuit allows it and records its result. It returns `ErrOpen` without
+// calling `fn` while the circuit is open.
+// Example:
+//
+//	err := dbBreaker.Execute(ctx, func(ctx context.Context) error {
+//		return db.WithContext(ctx).First(&user, id).Error
+//	})
+func (b *Breaker) Execute(c context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow(c)
+	if err != nil {
+		return err
+	}
+
+	err = fn(c)
+	done(err)
+
+	return err
+}
+
+// Allow is the two steps version of `Execute` for the calls whose result is not a simple error, like an
+// HTTP response status. If the call is allowed, `done` must be called exactly once with the error which
+// decides whether the call failed, passing nil for a success.
+func (b *Breaker) Allow(c context.Context) (done func(err error), err error) {
+	state, err := b.state(c)
+	if err != nil {
+		// Fail open, an unavailable store must not take the dependency down with it.
+		state = Closed
+	}
+
+	probe := false
+	switch state {
+	case Open:
+		requestsTotal.WithLabelValues(b.name, "rejected").Inc()
+		return nil, ErrOpen
+	case HalfOpen:
+		if !b.startProbe(c) {
+			requestsTotal.WithLabelValues(b.name, "rejected").Inc()
+			return nil, ErrOpen
+		}
+		probe = true
+	}
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			if b.config.IsFailure(err) {
+				b.failure(c, probe)
+			} else {
+				b.success(c, probe)
+			}
+		})
+	}, nil
+}
+
+// State returns the current state of the circuit.
+func (b *Breaker) State(c context.Context) State {
+	state, err := b.state(c)
+	if err != nil {
+		return Closed
+	}
+
+	return state
+}
+
+// Reset closes the circuit and forgets the failures.
+func (b *Breaker) Reset(c context.Context) error {
+	b.mu.Lock()
+	b.failures, b.successes, b.probing = 0, 0, false
+	b.mu.Unlock()
+
+	b.setState(Closed)
+
+	return b.config.Store.Reset(c, b.name)
+}
+
+func (b *Breaker) state(c context.Context) (State, error) {
+	openUntil, err := b.config.Store.OpenUntil(c, b.name)
+	if err != nil {
+		return Closed, err
+	}
+
+	var state State
+	switch {
+	case openUntil.IsZero():
+		state = Closed
+	case b.now().Before(openUntil):
+		state = Open
+	default:
+		state = HalfOpen
+	}
+	b.setState(state)
+
+	return state, nil
+}
+
+func (b *Breaker) startProbe(c context.Context) bool {
+	b.mu.Lock()
+	if b.probing {
+		b.mu.Unlock()
+		return false
+	}
+	b.probing = true
+	b.mu.Unlock()
+
+	// Only one replica probes at a time, the lock expires if the probe never finishes.
+	ok, err := b.config.Store.TryProbe(c, b.name, b.config.Cooldown)
+	if err != nil || !ok {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return false
+	}
+
+	return true
+}
+
+func (b *Breaker) failure(c context.Context, probe bool) {
+	requestsTotal.WithLabelValues(b.name, "failure").Inc()
+
+	b.mu.Lock()
+	b.successes = 0
+	if probe {
+		b.probing = false
+	}
+	b.mu.Unlock()
+
+	if probe {
+		b.open(c)
+		return
+	}
+
+	failures, err := b.config.Store.Failure(c, b.name, b.config.Interval)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.failures = failures
+	b.mu.Unlock()
+
+	if failures >= int64(b.config.Threshold) {
+		b.open(c)
+	}
+}
+
+func (b *Breaker) success(c context.Context, probe bool) {
+	requestsTotal.WithLabelValues(b.name, "success").Inc()
+
+	b.mu.Lock()
+	if !probe {
+		failures := b.failures
+		b.failures = 0
+		b.mu.Unlock()
+
+		if failures > 0 {
+			_ = b.config.Store.Reset(c, b.name)
+		}
+		return
+	}
+
+	b.probing = false
+	b.successes++
+	closed := b.successes >= b.config.HalfOpenProbes
+	if closed {
+		b.successes, b.failures = 0, 0
+	}
+	b.mu.Unlock()
+
+	if closed {
+		_ = b.config.Store.Reset(c, b.name)
+		b.setState(Closed)
+		return
+	}
+
+	// Release the probe lock for the next probe.
+	_ = b.config.Store.EndProbe(c, b.name)
+}
+
+func (b *Breaker) open(c context.Context) {
+	if err := b.config.Store.Open(c, b.name, b.now().Add(b.config.Cooldown)); err != nil {
+		return
+	}
+
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(state State) {
+	stateGauge.WithLabelValues(b.name).Set(float64(state))
+}
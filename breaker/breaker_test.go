@@ -0,0 +1,65 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestBreaker(t *testing.T) {
+	c := context.Background()
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	store := NewMemoryStore()
+	store.now = clock
+	b := New("test", Config{Threshold: 2, Cooldown: time.Minute, HalfOpenProbes: 1, Store: store})
+	b.now = clock
+
+	failing := func(context.Context) error { return errors.New("down") }
+	healthy := func(context.Context) error { return nil }
+
+	// A not found error doesn't count.
+	assert.ErrorIs(t, b.Execute(c, func(context.Context) error { return gorm.ErrRecordNotFound }), gorm.ErrRecordNotFound)
+	assert.Error(t, b.Execute(c, failing))
+	assert.Equal(t, Closed, b.State(c))
+	assert.Error(t, b.Execute(c, failing))
+	assert.Equal(t, Open, b.State(c))
+
+	called := false
+	err := b.Execute(c, func(context.Context) error { called = true; return nil })
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.False(t, called)
+
+	// After the cooldown a failed probe opens the circuit again.
+	now = now.Add(time.Minute)
+	assert.Equal(t, HalfOpen, b.State(c))
+	assert.EqualError(t, b.Execute(c, failing), "down")
+	assert.Equal(t, Open, b.State(c))
+
+	// Only one probe at a time.
+	now = now.Add(time.Minute)
+	done, err := b.Allow(c)
+	assert.NoError(t, err)
+	_, err = b.Allow(c)
+	assert.ErrorIs(t, err, ErrOpen)
+	done(nil)
+	assert.Equal(t, Closed, b.State(c))
+	assert.NoError(t, b.Execute(c, healthy))
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	c := context.Background()
+	b := New("reset", Config{Threshold: 2})
+
+	failing := func(context.Context) error { return errors.New("down") }
+
+	_ = b.Execute(c, failing)
+	_ = b.Execute(c, func(context.Context) error { return nil })
+	_ = b.Execute(c, failing)
+	assert.Equal(t, Closed, b.State(c))
+}
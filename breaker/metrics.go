@@ -0,0 +1,56 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package breaker
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bean",
+		Name:      "breaker_state",
+		Help:      "State of the circuit breakers seen by this instance: 0 closed, 1 open, 2 half-open.",
+	}, []string{"name"})
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "breaker_requests_total",
+		Help:      "How many calls went through the circuit breakers, partitioned by name and result (success, failure, rejected).",
+	}, []string{"name", "result"})
+
+	metricsOnce sync.Once
+)
+
+// registerMetrics registers the breaker metrics into the default prometheus registry when the first
+// breaker is created, so that they are served by the `/metrics` endpoint.
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		stateGauge = helpers.RegisterCollector(prometheus.DefaultRegisterer, stateGauge)
+		requestsTotal = helpers.RegisterCollector(prometheus.DefaultRegisterer, requestsTotal)
+	})
+}
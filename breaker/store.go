@@ -0,0 +1,209 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+// Store holds the state of the circuits by name.
+type Store interface {
+	// Failure records a failure and returns the number of failures within `interval`.
+	Failure(c context.Context, name string, interval time.Duration) (int64, error)
+	// Open opens the circuit until `until`.
+	Open(c context.Context, name string, until time.Time) error
+	// OpenUntil returns the end of the cooldown, or the zero time if the circuit is closed.
+	OpenUntil(c context.Context, name string) (time.Time, error)
+	// TryProbe takes the probe lock for `ttl` and reports whether it was free.
+	TryProbe(c context.Context, name string, ttl time.Duration) (bool, error)
+	// EndProbe releases the probe lock.
+	EndProbe(c context.Context, name string) error
+	// Reset closes the circuit and forgets the failures.
+	Reset(c context.Context, name string) error
+}
+
+// MemoryStore is a `Store` local to the process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	circuits map[string]*memoryCircuit
+	now      func() time.Time
+}
+
+type memoryCircuit struct {
+	failures    int64
+	windowEnd   time.Time
+	openUntil   time.Time
+	probeExpiry time.Time
+}
+
+// NewMemoryStore returns an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{circuits: make(map[string]*memoryCircuit), now: time.Now}
+}
+
+func (s *MemoryStore) circuit(name string) *memoryCircuit {
+	circuit, ok := s.circuits[name]
+	if !ok {
+		circuit = &memoryCircuit{}
+		s.circuits[name] = circuit
+	}
+
+	return circuit
+}
+
+func (s *MemoryStore) Failure(_ context.Context, name string, interval time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	circuit, now := s.circuit(name), s.now()
+	if now.After(circuit.windowEnd) {
+		circuit.failures, circuit.windowEnd = 0, now.Add(interval)
+	}
+	circuit.failures++
+
+	return circuit.failures, nil
+}
+
+func (s *MemoryStore) Open(_ context.Context, name string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	circuit := s.circuit(name)
+	circuit.openUntil, circuit.probeExpiry = until, time.Time{}
+
+	return nil
+}
+
+func (s *MemoryStore) OpenUntil(_ context.Context, name string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.circuit(name).openUntil, nil
+}
+
+func (s *MemoryStore) TryProbe(_ context.Context, name string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	circuit, now := s.circuit(name), s.now()
+	if now.Before(circuit.probeExpiry) {
+		return false, nil
+	}
+	circuit.probeExpiry = now.Add(ttl)
+
+	return true, nil
+}
+
+func (s *MemoryStore) EndProbe(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.circuit(name).probeExpiry = time.Time{}
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.circuits, name)
+
+	return nil
+}
+
+// RedisStore is a `Store` shared by all the replicas which use the same redis.
+type RedisStore struct {
+	redis  *dbdrivers.RedisDBConn
+	prefix string
+}
+
+// NewRedisStore returns a redis store, the keys are prefixed by `dbdrivers.GetRedisCachePrefix() + ":breaker"`.
+func NewRedisStore(redisConn *dbdrivers.RedisDBConn) *RedisStore {
+	return &RedisStore{redis: redisConn, prefix: dbdrivers.GetRedisCachePrefix() + ":breaker:"}
+}
+
+func (s *RedisStore) Failure(c context.Context, name string, interval time.Duration) (int64, error) {
+	key := s.prefix + name + ":failures"
+
+	failures, err := s.redis.Client().Incr(c, key).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	// The window starts with the first failure, like the memory store.
+	if failures == 1 {
+		if err := s.redis.Client().Expire(c, key, interval).Err(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	return failures, nil
+}
+
+func (s *RedisStore) Open(c context.Context, name string, until time.Time) error {
+	_, err := s.redis.Client().TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Set(c, s.prefix+name+":open", until.UnixMilli(), 0)
+		pipe.Del(c, s.prefix+name+":failures", s.prefix+name+":probe")
+		return nil
+	})
+
+	return errors.WithStack(err)
+}
+
+func (s *RedisStore) OpenUntil(c context.Context, name string) (time.Time, error) {
+	value, err := s.redis.Client().Get(c, s.prefix+name+":open").Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+
+	return time.UnixMilli(ms), nil
+}
+
+func (s *RedisStore) TryProbe(c context.Context, name string, ttl time.Duration) (bool, error) {
+	ok, err := s.redis.Client().SetNX(c, s.prefix+name+":probe", 1, ttl).Result()
+	return ok, errors.WithStack(err)
+}
+
+func (s *RedisStore) EndProbe(c context.Context, name string) error {
+	return errors.WithStack(s.redis.Client().Del(c, s.prefix+name+":probe").Err())
+}
+
+func (s *RedisStore) Reset(c context.Context, name string) error {
+	return errors.WithStack(s.redis.Client().Del(c, s.prefix+name+":open", s.prefix+name+":failures", s.prefix+name+":probe").Err())
+}
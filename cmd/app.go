@@ -0,0 +1,506 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/masking"
+	"github.com/retail-ai-inc/bean/migrate"
+	"github.com/spf13/cobra"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// The generator templates are embedded here as well so that `NewGenCommand` works without
+// the `bean` binary.
+//
+//go:embed bean/internal/_tpl
+var generatorFS embed.FS
+
+// AppConfig defines the config of the commands which a bean project can add to its own binary.
+type AppConfig struct {
+	// Use is the usage line of the root command returned by `NewAppCommand`.
+	// Optional. Default value "app command [args...]".
+	Use string
+
+	// Setup configures a new bean instance (middlewares, validators, error handlers...). Optional.
+	Setup func(b *bean.Bean)
+
+	// Routes registers the routes of the project. It's called after `InitDB` by `serve` and
+	// without any database connection by `routes`.
+	Routes func(b *bean.Bean)
+
+	// MasterMigrations and TenantMigrations are the sources of `migrate`.
+	// Optional. Default value `os.DirFS("migrations/master")` and `os.DirFS("migrations/tenant")`.
+	MasterMigrations fs.FS
+	TenantMigrations fs.FS
+}
+
+// NewAppCommand returns a root command with the `serve`, `routes`, `migrate`, `mask` and `gen` sub commands.
+// `bean.BeanConfig` must be loaded from env.json before executing it. Example:
+//
+//	root := cmd.NewAppCommand(cmd.AppConfig{Use: "myapp", Setup: setup, Routes: routers.Init})
+//	if err := root.Execute(); err != nil {
+//		os.Exit(1)
+//	}
+func NewAppCommand(config AppConfig) *cobra.Command {
+	if config.Use == "" {
+		config.Use = "app command [args...]"
+	}
+
+	root := &cobra.Command{
+		Use:     config.Use,
+		Version: helpers.CurrVersion(),
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+
+	root.AddCommand(
+		NewServeCommand(config),
+		NewRoutesCommand(config),
+		NewMigrateCommand(config),
+		NewMaskCommand(),
+		NewGenCommand(),
+	)
+
+	return root
+}
+
+// NewServeCommand returns the `serve` command which starts the web service.
+func NewServeCommand(config AppConfig) *cobra.Command {
+	var host, port string
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the web service",
+		Long:  `Start the web service base on the configs in env.json`,
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			b := newAppBean(config)
+
+			b.BeforeServe = func() {
+				b.InitDB()
+
+				if config.Routes != nil {
+					config.Routes(b)
+				}
+			}
+
+			b.ServeAt(host, port)
+		},
+	}
+
+	serveCmd.Flags().StringVar(&host, "host", bean.BeanConfig.HTTP.Host, "host address")
+	serveCmd.Flags().StringVar(&port, "port", bean.BeanConfig.HTTP.Port, "port number")
+
+	return serveCmd
+}
+
+// NewRoutesCommand returns the `routes` command which displays the registered routes.
+func NewRoutesCommand(config AppConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "routes",
+		Short: "Display the route list.",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			b := newAppBean(config)
+
+			// Create an empty database dependency.
+			b.DBConn = &bean.DBDeps{}
+
+			if config.Routes != nil {
+				config.Routes(b)
+			}
+
+			allowedMethod := make(map[string]bool, len(bean.BeanConfig.HTTP.AllowedMethod))
+			for _, m := range bean.BeanConfig.HTTP.AllowedMethod {
+				allowedMethod[m] = true
+			}
+
+			routes := b.Echo.Routes()
+			sort.Slice(routes, func(i, j int) bool {
+				if routes[i].Path == routes[j].Path {
+					return routes[i].Method < routes[j].Method
+				}
+				return routes[i].Path < routes[j].Path
+			})
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PATH\tMETHOD\tHANDLER")
+
+			for _, r := range routes {
+				if strings.Contains(r.Name, "glob..func1") {
+					continue
+				}
+
+				if len(allowedMethod) > 0 && !allowedMethod[r.Method] {
+					continue
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.Path, r.Method, strings.TrimSuffix(r.Name, "-fm"))
+			}
+
+			w.Flush()
+		},
+	}
+}
+
+// NewMigrateCommand returns the `migrate` command with the `up`, `down` and `status` sub commands.
+func NewMigrateCommand(config AppConfig) *cobra.Command {
+	var steps int
+	var masterOnly, tenantsOnly bool
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [command]",
+		Short: "Apply or revert the SQL migrations.",
+		Long: `This command applies the master migrations to the master database and the tenant
+migrations to all tenant databases (if tenant mode is on).`,
+		// The failures of the migrations are already printed.
+		SilenceUsage: true,
+	}
+
+	sets := func() ([]migrationSet, error) {
+		var sets []migrationSet
+
+		var master, tenant *migrate.Migrator
+		var err error
+		if !tenantsOnly {
+			if master, err = newMigrator(config.MasterMigrations, "migrations/master"); err != nil {
+				return nil, err
+			}
+		}
+		if !masterOnly && bean.BeanConfig.Database.Tenant.On {
+			if tenant, err = newMigrator(config.TenantMigrations, "migrations/tenant"); err != nil {
+				return nil, err
+			}
+		}
+
+		b := bean.New()
+		b.InitDB()
+
+		if master != nil {
+			sets = append(sets, migrationSet{master, migrate.MasterTarget(b.DBConn)})
+		}
+		if tenant != nil {
+			sets = append(sets, migrationSet{tenant, migrate.TenantTargets(b.DBConn)})
+		}
+
+		return sets, nil
+	}
+
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, err := sets()
+			if err != nil {
+				return err
+			}
+
+			failed := false
+			for _, set := range sets {
+				failed = printMigrateResults(cmd.OutOrStdout(), "applied", set.migrator.UpAll(context.Background(), set.targets, steps)) || failed
+			}
+			if failed {
+				return errMigrationFailed
+			}
+
+			return nil
+		},
+	}
+	upCmd.Flags().IntVarP(&steps, "steps", "n", 0, "number of migrations to apply (0 means all)")
+
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the latest migrations. (default 1 step)",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, err := sets()
+			if err != nil {
+				return err
+			}
+
+			failed := false
+			for _, set := range sets {
+				failed = printMigrateResults(cmd.OutOrStdout(), "reverted", set.migrator.DownAll(context.Background(), set.targets, steps)) || failed
+			}
+			if failed {
+				return errMigrationFailed
+			}
+
+			return nil
+		},
+	}
+	downCmd.Flags().IntVarP(&steps, "steps", "n", 1, "number of migrations to revert (0 means all)")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Display the status of every migration.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, err := sets()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tVERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+			for _, set := range sets {
+				statuses := set.migrator.StatusAll(context.Background(), set.targets)
+
+				for _, t := range set.targets {
+					for _, s := range statuses[t.Name] {
+						status, appliedAt := "pending", ""
+						if s.Dirty {
+							status = "dirty"
+						} else if s.Applied {
+							status = "applied"
+						}
+						if s.AppliedAt != nil {
+							appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+						}
+
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, strconv.FormatUint(s.Version, 10), s.Name, status, appliedAt)
+					}
+				}
+			}
+
+			return w.Flush()
+		},
+	}
+
+	migrateCmd.PersistentFlags().BoolVar(&masterOnly, "master", false, "only migrate the master database")
+	migrateCmd.PersistentFlags().BoolVar(&tenantsOnly, "tenants", false, "only migrate the tenant databases")
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd)
+
+	return migrateCmd
+}
+
+// NewMaskCommand returns the `mask` command with the `copy` and `verify` sub commands, which copy the tables of
+// a masking profile from a source MySQL database, like a production replica, to the master database of the
+// environment with the personal data masked. (see `masking.Profile`) It refuses to write to a production
+// environment.
+func NewMaskCommand() *cobra.Command {
+	var profilePath, source string
+	var tables []string
+	var options masking.Options
+
+	maskCmd := &cobra.Command{
+		Use:   "mask [command]",
+		Short: "Copy the data of another database with the personal data masked.",
+		// The failures of the verification are already printed.
+		SilenceUsage: true,
+	}
+
+	// open returns the profile, the source database and the master database of the environment.
+	open := func() (*masking.Profile, *gorm.DB, *gorm.DB, error) {
+		if bean.BeanConfig.IsProduction() {
+			return nil, nil, nil, fmt.Errorf("refusing to copy masked data into the %q environment", bean.BeanConfig.Environment)
+		}
+
+		profile, err := masking.LoadProfile(profilePath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		src, err := gorm.Open(mysql.Open(source), &gorm.Config{})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("source database: %w", err)
+		}
+
+		b := bean.New()
+		b.InitDB()
+		if b.DBConn.MasterMySQLDB == nil {
+			return nil, nil, nil, errors.New("the master MySQL database is not configured")
+		}
+
+		return profile, src, b.DBConn.MasterMySQLDB, nil
+	}
+
+	printReport := func(cmd *cobra.Command, report *masking.Report) error {
+		fmt.Fprint(cmd.OutOrStdout(), report.String())
+		if !report.Passed() {
+			return errMaskingLeaked
+		}
+
+		return nil
+	}
+
+	copyCmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy the tables of the profile with their columns masked, then verify them.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profile, src, dst, err := open()
+			if err != nil {
+				return err
+			}
+
+			options.Tables = tables
+			report, err := masking.Copy(cmd.Context(), src, dst, profile, options)
+			if err != nil {
+				return err
+			}
+
+			return printReport(cmd, report)
+		},
+	}
+	copyCmd.Flags().IntVar(&options.BatchSize, "batch-size", 500, "number of rows inserted at once")
+	copyCmd.Flags().BoolVar(&options.Truncate, "truncate", false, "delete the rows of the destination tables before the copy")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that no raw value of a masked column is in the master database.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profile, src, dst, err := open()
+			if err != nil {
+				return err
+			}
+
+			report, err := masking.Verify(cmd.Context(), src, dst, profile, tables...)
+			if err != nil {
+				return err
+			}
+
+			return printReport(cmd, report)
+		},
+	}
+
+	maskCmd.PersistentFlags().StringVar(&profilePath, "profile", "", "path of the masking profile (JSON or YAML)")
+	maskCmd.PersistentFlags().StringVar(&source, "source", "", "DSN of the source MySQL database")
+	maskCmd.PersistentFlags().StringSliceVar(&tables, "tables", nil, "tables to copy or verify (default all the tables of the profile)")
+	_ = maskCmd.MarkPersistentFlagRequired("profile")
+	_ = maskCmd.MarkPersistentFlagRequired("source")
+	maskCmd.AddCommand(copyCmd, verifyCmd)
+
+	return maskCmd
+}
+
+// NewGenCommand returns the `gen` command which scaffolds a handler, service, repository, command or
+// resource in the current project from the embedded templates, same as `bean create`.
+func NewGenCommand() *cobra.Command {
+	// The embedded directory always exists.
+	templates, _ := fs.Sub(generatorFS, "bean")
+	run := func(generate func(internalFS fs.FS, cmd *cobra.Command, args []string)) func(cmd *cobra.Command, args []string) {
+		return func(cmd *cobra.Command, args []string) {
+			generate(templates, cmd, args)
+		}
+	}
+
+	genCmd := &cobra.Command{
+		Use:   "gen [command]",
+		Short: "Generate a new handler, service, repository or command file.",
+	}
+
+	genCmd.AddCommand(
+		&cobra.Command{Use: "handler <handler-name>", Short: "Create a new handler file", Args: cobra.ExactArgs(1), Run: run(generateHandler)},
+		&cobra.Command{Use: "service <service-name>", Short: "Create a new service file", Args: cobra.ExactArgs(1), Run: run(generateService)},
+		&cobra.Command{Use: "repo <repo-name>", Short: "Create a new repository file", Args: cobra.ExactArgs(1), Run: run(generateRepo)},
+		&cobra.Command{Use: "command <command-name>", Short: "Create a new command file", Args: cobra.ExactArgs(1), Run: run(generateCommand)},
+	)
+
+	resourceGenCmd := &cobra.Command{Use: "resource <resource-name>", Short: "Create a new handler, service and repository of a resource", Args: cobra.ExactArgs(1), Run: run(generateResource)}
+	resourceGenCmd.Flags().Bool("tenant", false, "generate a tenant aware repository")
+	genCmd.AddCommand(resourceGenCmd, newAccessorsCommand())
+
+	return genCmd
+}
+
+// errMigrationFailed is returned by `migrate up` and `migrate down` when a migration failed.
+var errMigrationFailed = errors.New("some migrations failed")
+
+// errMaskingLeaked is returned by `mask copy` and `mask verify` when a raw value is in the destination.
+var errMaskingLeaked = errors.New("some masked columns have raw values")
+
+type migrationSet struct {
+	migrator *migrate.Migrator
+	targets  []migrate.Target
+}
+
+func newAppBean(config AppConfig) *bean.Bean {
+	// Prepare a default sentry option if the project didn't set one.
+	if bean.BeanConfig.Sentry.On && bean.BeanConfig.Sentry.ClientOptions == nil {
+		bean.BeanConfig.Sentry.ClientOptions = &sentry.ClientOptions{
+			Debug:            bean.BeanConfig.Sentry.Debug,
+			Dsn:              bean.BeanConfig.Sentry.Dsn,
+			Environment:      bean.BeanConfig.Environment,
+			BeforeSend:       bean.DefaultBeforeSend,
+			AttachStacktrace: true,
+			TracesSampleRate: helpers.FloatInRange(bean.BeanConfig.Sentry.TracesSampleRate, 0.0, 1.0),
+		}
+	}
+
+	b := bean.New()
+
+	if config.Setup != nil {
+		config.Setup(b)
+	}
+
+	return b
+}
+
+func newMigrator(source fs.FS, dir string) (*migrate.Migrator, error) {
+	if source == nil {
+		source = os.DirFS(dir)
+	}
+
+	m, err := migrate.New(source, migrate.DefaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	return m, nil
+}
+
+func printMigrateResults(w io.Writer, verb string, results []migrate.Result) (failed bool) {
+	for _, r := range results {
+		for _, m := range r.Migrations {
+			fmt.Fprintf(w, "%s: %s %d_%s\n", r.Target.Name, verb, m.Version, m.Name)
+		}
+
+		if r.Err != nil {
+			fmt.Fprintf(w, "%s: failed: %v\n", r.Target.Name, r.Err)
+			failed = true
+		} else if len(r.Migrations) == 0 {
+			fmt.Fprintf(w, "%s: no change\n", r.Target.Name)
+		}
+	}
+
+	return failed
+}
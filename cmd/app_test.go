@@ -0,0 +1,69 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/retail-ai-inc/bean"
+)
+
+func Test_NewAppCommand(t *testing.T) {
+	root := NewAppCommand(AppConfig{})
+
+	for _, name := range []string{"serve", "routes", "migrate", "mask", "gen"} {
+		if c, _, err := root.Find([]string{name}); err != nil || c.Name() != name {
+			t.Errorf("sub command %q not found", name)
+		}
+	}
+
+	// Building the commands must not touch the `bean` binary's globals.
+	if InternalFS != nil || rootCmd.HasSubCommands() {
+		t.Error("NewAppCommand mutated the bean root command")
+	}
+
+	// The generator templates must be available without the `bean` binary.
+	for _, name := range []string{"handler.go", "service.go", "repo.go", "command.go", "resource/handler.go"} {
+		if _, err := fs.Stat(generatorFS, "bean/internal/_tpl/"+name); err != nil {
+			t.Errorf("template %q not embedded: %v", name, err)
+		}
+	}
+}
+
+func Test_NewMaskCommand(t *testing.T) {
+	environment := bean.BeanConfig.Environment
+	defer func() { bean.BeanConfig.Environment = environment }()
+	bean.BeanConfig.Environment = "production"
+
+	mask := NewMaskCommand()
+	mask.SetArgs([]string{"copy", "--profile", "masking.yml", "--source", "root@tcp(127.0.0.1:3306)/app"})
+	mask.SetOut(io.Discard)
+	mask.SetErr(io.Discard)
+
+	if err := mask.Execute(); err == nil || !strings.Contains(err.Error(), "production") {
+		t.Errorf("mask copy into production: got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"{{.ProjectObject.PkgPath}}/services"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/trace"
+)
+
+type {{.NameUpper}}Handler interface {
+	Get{{.NameUpper}}(c echo.Context) error    // GET /{{.NameLower}}s/:id
+	Create{{.NameUpper}}(c echo.Context) error // POST /{{.NameLower}}s
+}
+
+// create{{.NameUpper}}Request is validated by the default validator. Add your custom validations in the
+// `validations` package and use them in the `validate` tag.
+type create{{.NameUpper}}Request struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type {{.NameLower}}Handler struct {
+	{{.NameLower}}Service services.{{.NameUpper}}Service
+}
+
+func New{{.NameUpper}}Handler({{.NameLower}}Svc services.{{.NameUpper}}Service) *{{.NameLower}}Handler {
+	return &{{.NameLower}}Handler{ {{- .NameLower}}Svc}
+}
+
+func (handler *{{.NameLower}}Handler) Get{{.NameUpper}}(c echo.Context) error {
+	tctx := trace.NewTraceableContext(c.Request().Context())
+	finish := trace.Start(tctx, "http.handler")
+	defer finish()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return berror.NewAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, err)
+	}
+
+	{{.NameLower}}, err := handler.{{.NameLower}}Service.Get{{.NameUpper}}(tctx{{if .Tenant}}, tenantID(c){{end}}, id)
+	if err == services.Err{{.NameUpper}}NotFound {
+		return berror.NewIgnorableAPIError(http.StatusNotFound, berror.RESOURCE_NOT_FOUND, err)
+	} else if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, {{.NameLower}})
+}
+
+func (handler *{{.NameLower}}Handler) Create{{.NameUpper}}(c echo.Context) error {
+	tctx := trace.NewTraceableContext(c.Request().Context())
+	finish := trace.Start(tctx, "http.handler")
+	defer finish()
+
+	var req create{{.NameUpper}}Request
+	if err := c.Bind(&req); err != nil {
+		return berror.NewAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, err)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	{{.NameLower}}, err := handler.{{.NameLower}}Service.Create{{.NameUpper}}(tctx{{if .Tenant}}, tenantID(c){{end}}, services.Create{{.NameUpper}}Input{Name: req.Name})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, {{.NameLower}})
+}
+{{- if .Tenant}}
+
+// tenantID returns the tenant of the request.
+// IMPORTANT: Replace it with the tenant ID of your authentication. (example: JWT claims)
+func tenantID(c echo.Context) uint64 {
+	id, _ := strconv.ParseUint(c.Request().Header.Get("X-Tenant-ID"), 10, 64)
+	return id
+}
+{{- end}}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"{{.ProjectObject.PkgPath}}/models"
+	"{{.ProjectObject.PkgPath}}/services"
+
+	validatorV10 "github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/validator"
+)
+
+type fake{{.NameUpper}}Service struct {
+	result *models.{{.NameUpper}}
+	err    error
+}
+
+func (service *fake{{.NameUpper}}Service) Get{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error) {
+	return service.result, service.err
+}
+
+func (service *fake{{.NameUpper}}Service) Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, input services.Create{{.NameUpper}}Input) (*models.{{.NameUpper}}, error) {
+	return &models.{{.NameUpper}}{ID: 1, Name: input.Name}, service.err
+}
+
+func Test{{.NameUpper}}Handler_Get{{.NameUpper}}(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		service    *fake{{.NameUpper}}Service
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "found", id: "1", service: &fake{{.NameUpper}}Service{result: &models.{{.NameUpper}}{ID: 1}}, wantStatus: http.StatusOK},
+		{name: "invalid id", id: "abc", service: &fake{{.NameUpper}}Service{}, wantErr: true},
+		{name: "not found", id: "2", service: &fake{{.NameUpper}}Service{err: services.Err{{.NameUpper}}NotFound}, wantErr: true},
+		{name: "internal error", id: "3", service: &fake{{.NameUpper}}Service{err: errors.New("internal")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			err := New{{.NameUpper}}Handler(tt.service).Get{{.NameUpper}}(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get{{.NameUpper}}() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && rec.Code != tt.wantStatus {
+				t.Errorf("Get{{.NameUpper}}() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test{{.NameUpper}}Handler_Create{{.NameUpper}}(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErr    interface{}
+	}{
+		{name: "created", body: `{"name":"name"}`, wantStatus: http.StatusCreated},
+		{name: "invalid json", body: `{"name":`, wantErr: &berror.APIError{}},
+		{name: "validation failed", body: `{"name":""}`, wantErr: &validator.ValidationError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = &validator.DefaultValidator{Validator: validatorV10.New()}
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			err := New{{.NameUpper}}Handler(&fake{{.NameUpper}}Service{}).Create{{.NameUpper}}(e.NewContext(req, rec))
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("Create{{.NameUpper}}() error = nil, want %T", tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create{{.NameUpper}}() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Create{{.NameUpper}}() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type {{.NameUpper}} struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
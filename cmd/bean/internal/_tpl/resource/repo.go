@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+{{- if .Tenant}}
+	"fmt"
+{{- end}}
+
+	"{{.ProjectObject.PkgPath}}/models"
+
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/trace"
+	"gorm.io/gorm"
+)
+
+type {{.NameUpper}}Repository interface {
+	Find{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error)
+	Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, {{.NameLower}} *models.{{.NameUpper}}) error
+}
+
+type {{.NameLower}}Repository struct {
+	dbDeps *bean.DBDeps
+}
+
+func New{{.NameUpper}}Repository(dbDeps *bean.DBDeps) *{{.NameLower}}Repository {
+	return &{{.NameLower}}Repository{dbDeps}
+}
+
+func (repo *{{.NameLower}}Repository) Find{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error) {
+	finish := trace.Start(ctx, "db")
+	defer finish()
+
+	db, err := repo.db({{if .Tenant}}tenantID{{end}})
+	if err != nil {
+		return nil, err
+	}
+
+	var {{.NameLower}} models.{{.NameUpper}}
+	if err := db.WithContext(ctx).First(&{{.NameLower}}, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &{{.NameLower}}, nil
+}
+
+func (repo *{{.NameLower}}Repository) Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, {{.NameLower}} *models.{{.NameUpper}}) error {
+	finish := trace.Start(ctx, "db")
+	defer finish()
+
+	db, err := repo.db({{if .Tenant}}tenantID{{end}})
+	if err != nil {
+		return err
+	}
+
+	return db.WithContext(ctx).Create({{.NameLower}}).Error
+}
+{{if .Tenant}}
+// db returns the MySQL connection of the tenant.
+func (repo *{{.NameLower}}Repository) db(tenantID uint64) (*gorm.DB, error) {
+	db, ok := repo.dbDeps.TenantMySQLDBs[tenantID]
+	if !ok || db == nil {
+		return nil, fmt.Errorf("tenant %d has no MySQL connection", tenantID)
+	}
+
+	return db, nil
+}
+{{- else}}
+// db returns the master MySQL connection.
+func (repo *{{.NameLower}}Repository) db() (*gorm.DB, error) {
+	return repo.dbDeps.MasterMySQLDB, nil
+}
+{{- end}}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"{{.ProjectObject.PkgPath}}/models"
+	"{{.ProjectObject.PkgPath}}/repositories"
+
+	"github.com/retail-ai-inc/bean/trace"
+	"gorm.io/gorm"
+)
+
+var Err{{.NameUpper}}NotFound = errors.New("{{.NameLower}} not found")
+
+type {{.NameUpper}}Service interface {
+	Get{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error)
+	Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, input Create{{.NameUpper}}Input) (*models.{{.NameUpper}}, error)
+}
+
+// Create{{.NameUpper}}Input holds the validated parameters to create a {{.NameLower}}.
+type Create{{.NameUpper}}Input struct {
+	Name string
+}
+
+type {{.NameLower}}Service struct {
+	{{.NameLower}}Repository repositories.{{.NameUpper}}Repository
+}
+
+func New{{.NameUpper}}Service({{.NameLower}}Repo repositories.{{.NameUpper}}Repository) *{{.NameLower}}Service {
+	return &{{.NameLower}}Service{
+		{{.NameLower}}Repository: {{.NameLower}}Repo,
+	}
+}
+
+func (service *{{.NameLower}}Service) Get{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error) {
+	finish := trace.Start(ctx, "http.service")
+	defer finish()
+
+	{{.NameLower}}, err := service.{{.NameLower}}Repository.Find{{.NameUpper}}(ctx{{if .Tenant}}, tenantID{{end}}, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, Err{{.NameUpper}}NotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return {{.NameLower}}, nil
+}
+
+func (service *{{.NameLower}}Service) Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, input Create{{.NameUpper}}Input) (*models.{{.NameUpper}}, error) {
+	finish := trace.Start(ctx, "http.service")
+	defer finish()
+
+	{{.NameLower}} := &models.{{.NameUpper}}{Name: input.Name}
+	if err := service.{{.NameLower}}Repository.Create{{.NameUpper}}(ctx{{if .Tenant}}, tenantID{{end}}, {{.NameLower}}); err != nil {
+		return nil, err
+	}
+
+	return {{.NameLower}}, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"{{.ProjectObject.PkgPath}}/models"
+
+	"gorm.io/gorm"
+)
+
+type fake{{.NameUpper}}Repository struct {
+	result *models.{{.NameUpper}}
+	err    error
+}
+
+func (repo *fake{{.NameUpper}}Repository) Find{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, id uint64) (*models.{{.NameUpper}}, error) {
+	return repo.result, repo.err
+}
+
+func (repo *fake{{.NameUpper}}Repository) Create{{.NameUpper}}(ctx context.Context{{if .Tenant}}, tenantID uint64{{end}}, {{.NameLower}} *models.{{.NameUpper}}) error {
+	{{.NameLower}}.ID = 1
+	return repo.err
+}
+
+func Test{{.NameUpper}}Service_Get{{.NameUpper}}(t *testing.T) {
+	dbErr := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		repo    *fake{{.NameUpper}}Repository
+		want    *models.{{.NameUpper}}
+		wantErr error
+	}{
+		{
+			name: "found",
+			repo: &fake{{.NameUpper}}Repository{result: &models.{{.NameUpper}}{ID: 1, Name: "name"}},
+			want: &models.{{.NameUpper}}{ID: 1, Name: "name"},
+		},
+		{
+			name:    "not found",
+			repo:    &fake{{.NameUpper}}Repository{err: gorm.ErrRecordNotFound},
+			wantErr: Err{{.NameUpper}}NotFound,
+		},
+		{
+			name:    "database error",
+			repo:    &fake{{.NameUpper}}Repository{err: dbErr},
+			wantErr: dbErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New{{.NameUpper}}Service(tt.repo).Get{{.NameUpper}}(context.Background(){{if .Tenant}}, 1{{end}}, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get{{.NameUpper}}() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && (got == nil || got.ID != tt.want.ID || got.Name != tt.want.Name) {
+				t.Errorf("Get{{.NameUpper}}() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test{{.NameUpper}}Service_Create{{.NameUpper}}(t *testing.T) {
+	got, err := New{{.NameUpper}}Service(&fake{{.NameUpper}}Repository{}).Create{{.NameUpper}}(context.Background(){{if .Tenant}}, 1{{end}}, Create{{.NameUpper}}Input{Name: "name"})
+	if err != nil {
+		t.Fatalf("Create{{.NameUpper}}() error = %v", err)
+	}
+	if got.ID != 1 || got.Name != "name" {
+		t.Errorf("Create{{.NameUpper}}() = %v", got)
+	}
+}
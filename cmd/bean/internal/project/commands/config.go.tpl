@@ -0,0 +1,27 @@
+{{ .Copyright }}
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configSourcesCmd represents the config:sources command.
+	configSourcesCmd = &cobra.Command{
+		Use:   "config:sources",
+		Short: "Print which config file set each key",
+		Long: `This command will print the environment, the config files merged in order (env.json, env.<environment>.json
+		and env.local.json) and the file which set each key.`,
+		Run: configSources,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configSourcesCmd)
+}
+
+func configSources(cmd *cobra.Command, args []string) {
+	fmt.Print(configProvenance)
+}
@@ -0,0 +1,12 @@
+{{ .Copyright }}
+package commands
+
+import (
+	beancmd "github.com/retail-ai-inc/bean/cmd"
+)
+
+func init() {
+	// `mask copy|verify --profile masking.yml --source <dsn>` copies the tables of the masking profile from
+	// the source MySQL database to the master database with the personal data masked.
+	rootCmd.AddCommand(beancmd.NewMaskCommand())
+}
@@ -0,0 +1,12 @@
+{{ .Copyright }}
+package commands
+
+import (
+	beancmd "github.com/retail-ai-inc/bean/cmd"
+)
+
+func init() {
+	// `migrate up|down|status` applies the SQL migrations in the migrations/master directory to the master
+	// database and the migrations in the migrations/tenant directory to all tenant databases.
+	rootCmd.AddCommand(beancmd.NewMigrateCommand(beancmd.AppConfig{}))
+}
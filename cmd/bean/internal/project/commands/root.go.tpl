@@ -10,9 +10,11 @@ import (
 	"github.com/retail-ai-inc/bean"
 	"github.com/retail-ai-inc/bean/helpers"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
+// configProvenance reports which config file set each key.
+var configProvenance *bean.ConfigProvenance
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "{{ .PkgName }} command [args...]",
@@ -43,16 +45,10 @@ func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.Version = helpers.CurrVersion()
 
-	viper.AddConfigPath(".")
-	viper.SetConfigType("json")
-	viper.SetConfigName("env")
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalln(err)
-	}
-
-	// IMPORTANT: Unmarshal the env.json into global BeanConfig object.
-	if err := viper.Unmarshal(&bean.BeanConfig); err != nil {
+	// IMPORTANT: Merge env.json, env.<environment>.json and env.local.json into global BeanConfig object.
+	// The environment is `BEAN_ENV` or `environment` of env.json.
+	var err error
+	if configProvenance, err = bean.LoadConfig("."); err != nil {
 		log.Fatalln(err)
 	}
 
@@ -2,6 +2,7 @@
 package commands
 
 import (
+	"context"
 
 	"{{ .PkgPath }}/middlewares"
 	"{{ .PkgPath }}/routers"
@@ -10,8 +11,12 @@ import (
 	"github.com/getsentry/sentry-go"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/admin"
+	"github.com/retail-ai-inc/bean/async"
 	berror "github.com/retail-ai-inc/bean/error"
 	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/refdata"
+	"github.com/retail-ai-inc/bean/shutdown"
 	"github.com/spf13/cobra"
 )
 
@@ -70,12 +75,9 @@ func start(cmd *cobra.Command, args []string) {
 	)
 
 	// Set custom middleware in here.
+	// IMPORTANT: `http.timeout` of `env.json` is already applied by bean, use `http.timeoutGroups` or
+	// `bean.WithTimeout` to override it.
 	b.UseMiddlewares(
-		echomiddleware.TimeoutWithConfig(echomiddleware.TimeoutConfig{
-			ErrorMessage:               `{"errorCode": "100004", "errorMsg": "timeout"}`,
-			OnTimeoutRouteErrorHandler: berror.OnTimeoutRouteErrorHandler,
-			Timeout:                    bean.BeanConfig.HTTP.Timeout,
-		}),
 		// Example:
 		middlewares.Example("example middleware"),
 		// IMPORTANT: The following line will produce a proper stack trace if error occurred. Keep it as the last parameter/middleware here.
@@ -102,6 +104,45 @@ func start(cmd *cobra.Command, args []string) {
 		// Init different routes.
 		routers.Init(b)
 
+		// Load the reference data registered with `refdata.Register` and keep it fresh until the shutdown.
+		if err := refdata.Warmup(context.Background()); err != nil {
+			panic(err)
+		}
+		refdataCtx, stopRefdata := context.WithCancel(context.Background())
+		refdata.Start(refdataCtx)
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+			Name:  "refdata",
+			Stage: shutdown.StageIntake,
+			Stop: func(context.Context) error {
+				stopRefdata()
+				return nil
+			},
+		}); err != nil {
+			panic(err)
+		}
+
+		// Report the echo contexts of `async.ExecuteWithContext` which are not released after `asyncLeakDetector.threshold`.
+		if bean.BeanConfig.AsyncLeakDetector.On {
+			async.StartLeakDetector(context.Background(), async.LeakDetectorConfig{
+				Threshold: bean.BeanConfig.AsyncLeakDetector.Threshold,
+				Interval:  bean.BeanConfig.AsyncLeakDetector.Interval,
+			})
+		}
+
+		// Keep the runs of the async tasks in the memory database if `asyncHistory.store` is `badger`.
+		if bean.BeanConfig.AsyncHistory.Store == "badger" && b.DBConn.MemoryDB != nil {
+			async.SetHistory(async.NewBadgerHistory(b.DBConn.MemoryDB, "", bean.BeanConfig.AsyncHistory.TTL))
+		} else if bean.BeanConfig.AsyncHistory.Size > 0 {
+			async.SetHistory(async.NewMemoryHistory(bean.BeanConfig.AsyncHistory.Size))
+		}
+
+		// Serve the admin UI on the internal listener of `admin.host` and `admin.port`.
+		if bean.BeanConfig.Admin.On {
+			if _, err := admin.Start(b, admin.Config{}); err != nil {
+				panic(err)
+			}
+		}
+
 		// You can also replace the default error handler:
 		// b.Echo.HTTPErrorHandler = YourErrorHandler()
 
@@ -2,12 +2,12 @@
 package jwt
 
 import (
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // UserJWTTokenData Stores the user information
 type UserJWTTokenData struct {
 	ID uint64
 	/* Add your own data here */
-	jwt.StandardClaims
+	jwt.RegisteredClaims
 }
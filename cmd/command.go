@@ -64,6 +64,11 @@ Example :- "bean create command test" will create a command test in the commands
 )
 
 func command(cmd *cobra.Command, args []string) {
+	generateCommand(InternalFS, cmd, args)
+}
+
+// generateCommand creates the command files from the templates of `internalFS`.
+func generateCommand(internalFS fs.FS, cmd *cobra.Command, args []string) {
 	beanCheck := beanInitialisationCheck()
 	if !beanCheck {
 		log.Fatalln("env.json for bean not found!!")
@@ -95,7 +100,7 @@ func command(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the relative root path of the internal templates folder.
-	if p.RootFS, err = fs.Sub(InternalFS, "internal/_tpl"); err != nil {
+	if p.RootFS, err = fs.Sub(internalFS, "internal/_tpl"); err != nil {
 		log.Fatalln(err)
 	}
 
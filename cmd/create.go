@@ -31,7 +31,6 @@ import (
 
 func init() {
 	createCmd.DisableFlagsInUseLine = true
-	rootCmd.AddCommand(createCmd)
 }
 
 var createCmd = &cobra.Command{
@@ -39,7 +38,7 @@ var createCmd = &cobra.Command{
 	Short:     "Enable user to create new handler, service, repository and command file",
 	Long:      `This command requires a sub command parameter to create a new command, repository, service and handler template.`,
 	Args:      cobra.ExactValidArgs(1),
-	ValidArgs: []string{"repo", "service", "handler", "command"},
+	ValidArgs: []string{"repo", "service", "handler", "command", "resource"},
 }
 
 func beanInitialisationCheck() bool {
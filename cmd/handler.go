@@ -70,6 +70,11 @@ Example :- "bean create handler post" will create a handler Post in handlers fol
 )
 
 func handler(cmd *cobra.Command, args []string) {
+	generateHandler(InternalFS, cmd, args)
+}
+
+// generateHandler creates the handler files from the templates of `internalFS`.
+func generateHandler(internalFS fs.FS, cmd *cobra.Command, args []string) {
 	beanCheck := beanInitialisationCheck()
 	if !beanCheck {
 		log.Fatalln("env.json for bean not found!!")
@@ -101,7 +106,7 @@ func handler(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the relative root path of the internal templates folder.
-	if p.RootFS, err = fs.Sub(InternalFS, "internal/_tpl"); err != nil {
+	if p.RootFS, err = fs.Sub(internalFS, "internal/_tpl"); err != nil {
 		log.Fatalln(err)
 	}
 
@@ -118,7 +118,6 @@ directory. the suffix of the package_name should match the current directory.`,
 
 func init() {
 	initCmd.DisableFlagsInUseLine = true
-	rootCmd.AddCommand(initCmd)
 }
 
 func getProjectName(pkgPath string) (string, error) {
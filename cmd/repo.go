@@ -68,6 +68,11 @@ Example :- "bean create repo post" will create a repository Post in repositories
 )
 
 func repo(cmd *cobra.Command, args []string) {
+	generateRepo(InternalFS, cmd, args)
+}
+
+// generateRepo creates the repo files from the templates of `internalFS`.
+func generateRepo(internalFS fs.FS, cmd *cobra.Command, args []string) {
 	beanCheck := beanInitialisationCheck()
 	if !beanCheck {
 		log.Fatalln("env.json for bean not found!!")
@@ -99,7 +104,7 @@ func repo(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the relative root path of the internal templates folder.
-	if p.RootFS, err = fs.Sub(InternalFS, "internal/_tpl"); err != nil {
+	if p.RootFS, err = fs.Sub(internalFS, "internal/_tpl"); err != nil {
 		log.Fatalln(err)
 	}
 
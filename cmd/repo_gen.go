@@ -0,0 +1,542 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	repoGenCmd.AddCommand(newAccessorsCommand())
+}
+
+// repoAnnotation marks a repository interface whose DB wiring is generated by `bean gen accessors`.
+const repoAnnotation = "//bean:repo"
+
+var repoGenCmd = &cobra.Command{
+	Use:   "gen [command]",
+	Short: "Generate code from the annotated source files of a project",
+}
+
+func newAccessorsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "accessors <file.go>",
+		Short: "Generate the DB wiring of the annotated repository interfaces",
+		Long: `Generate the DB wiring of the repository interfaces annotated with ` + "`//bean:repo`" + ` in <file.go>
+into <file>_gen.go. Put the following line in the repository file and run ` + "`go generate ./...`" + `:
+
+    //go:generate bean gen accessors $GOFILE
+
+The annotation takes the options below:
+
+    //bean:repo db=mysql|mongo tenant=true|false timeout=3s
+
+For every method of the interface the generated method resolves the (tenant) connection, sets the
+context deadline, starts a tracing span, maps the DB error into an API error and calls the unexported
+method of the same name which has the connection in place of the tenant ID, for example:
+
+    FindOrder(ctx context.Context, tenantID uint64, id uint64) (*models.Order, error)
+
+is backed by
+
+    func (repo *orderRepository) findOrder(ctx context.Context, db *gorm.DB, id uint64) (*models.Order, error)`,
+		Args: cobra.ExactArgs(1),
+		Run:  accessors,
+	}
+}
+
+func accessors(cmd *cobra.Command, args []string) {
+	out, err := generateAccessors(args[0])
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("%s was created successfully.\n", out)
+}
+
+// generateAccessors writes the wiring of the annotated interfaces of `file` into `<file>_gen.go`
+// and returns the path of the generated file.
+func generateAccessors(file string) (string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := renderAccessors(filepath.Base(file), src)
+	if err != nil {
+		return "", err
+	}
+
+	out := strings.TrimSuffix(file, ".go") + "_gen.go"
+	if err := os.WriteFile(out, code, 0644); err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
+
+// repoSpec holds the data to generate the wiring of one annotated repository interface.
+type repoSpec struct {
+	Name    string
+	Impl    string
+	DB      string
+	Tenant  bool
+	Timeout time.Duration
+	Methods []repoMethod
+}
+
+type repoMethod struct {
+	Name     string
+	Core     string
+	Ctx      string
+	TenantID string
+	Params   string
+	Results  string
+	Args     string
+}
+
+// renderAccessors parses the go source `src` and returns the formatted code of the generated file.
+func renderAccessors(name string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []repoSpec
+	usedPkgs := map[string]bool{}
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			iface, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				continue
+			}
+
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+
+			opts, ok := repoOptions(doc)
+			if !ok {
+				continue
+			}
+
+			repo, err := newRepoSpec(fset, ts.Name.Name, iface, opts, usedPkgs)
+			if err != nil {
+				return nil, err
+			}
+
+			repos = append(repos, repo)
+		}
+	}
+
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("%s: no interface is annotated with `%s`", name, repoAnnotation)
+	}
+
+	data := struct {
+		Source  string
+		Package string
+		Imports []string
+		Repos   []repoSpec
+	}{
+		Source:  name,
+		Package: f.Name.Name,
+		Imports: accessorImports(f, repos, usedPkgs),
+		Repos:   repos,
+	}
+
+	var buf bytes.Buffer
+	if err := accessorsTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// repoOptions returns the `key=value` options of the `//bean:repo` line in `doc`.
+func repoOptions(doc *ast.CommentGroup) (map[string]string, bool) {
+	if doc == nil {
+		return nil, false
+	}
+
+	for _, c := range doc.List {
+		if c.Text != repoAnnotation && !strings.HasPrefix(c.Text, repoAnnotation+" ") {
+			continue
+		}
+
+		opts := map[string]string{}
+		for _, field := range strings.Fields(strings.TrimPrefix(c.Text, repoAnnotation)) {
+			key, value, _ := strings.Cut(field, "=")
+			opts[key] = value
+		}
+
+		return opts, true
+	}
+
+	return nil, false
+}
+
+func newRepoSpec(fset *token.FileSet, name string, iface *ast.InterfaceType, opts map[string]string, usedPkgs map[string]bool) (repoSpec, error) {
+	repo := repoSpec{
+		Name: name,
+		Impl: lowerFirst(name),
+		DB:   "mysql",
+	}
+
+	for key, value := range opts {
+		switch key {
+		case "db":
+			if value != "mysql" && value != "mongo" {
+				return repo, fmt.Errorf("%s: unsupported db %q, must be `mysql` or `mongo`", name, value)
+			}
+			repo.DB = value
+
+		case "tenant":
+			tenant, err := strconv.ParseBool(value)
+			if err != nil {
+				return repo, fmt.Errorf("%s: invalid tenant %q: %w", name, value, err)
+			}
+			repo.Tenant = tenant
+
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return repo, fmt.Errorf("%s: invalid timeout %q: %w", name, value, err)
+			}
+			repo.Timeout = timeout
+
+		default:
+			return repo, fmt.Errorf("%s: unknown option %q", name, key)
+		}
+	}
+
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return repo, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+
+		method, err := newRepoMethod(fset, field.Names[0].Name, fn, repo.Tenant)
+		if err != nil {
+			return repo, fmt.Errorf("%s.%s: %w", name, field.Names[0].Name, err)
+		}
+
+		repo.Methods = append(repo.Methods, method)
+	}
+
+	ast.Inspect(iface, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				usedPkgs[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	return repo, nil
+}
+
+// reservedNames are the local variables of the generated methods which the parameters must not shadow.
+var reservedNames = map[string]bool{
+	"repo": true, "conn": true, "db": true, "err": true, "cancel": true, "finish": true,
+	"context": true, "time": true, "trace": true, "berror": true, "bean": true,
+}
+
+func newRepoMethod(fset *token.FileSet, name string, fn *ast.FuncType, tenant bool) (repoMethod, error) {
+	method := repoMethod{Name: name, Core: lowerFirst(name)}
+
+	type param struct {
+		name string
+		typ  string
+	}
+
+	var params []param
+	for _, field := range fn.Params.List {
+		typ := exprString(fset, field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, param{"", typ})
+			continue
+		}
+		for _, ident := range field.Names {
+			params = append(params, param{ident.Name, typ})
+		}
+	}
+
+	fixed := 1
+	if tenant {
+		fixed = 2
+	}
+
+	if len(params) < fixed || params[0].typ != "context.Context" {
+		return method, errors.New("the first parameter must be a `context.Context`")
+	}
+	if tenant && params[1].typ != "uint64" {
+		return method, errors.New("the second parameter must be the `uint64` tenant ID")
+	}
+
+	var decls, args []string
+	for i := range params {
+		p := &params[i]
+		switch {
+		case p.name == "" || p.name == "_":
+			p.name = "p" + strconv.Itoa(i)
+		case reservedNames[p.name] || strings.HasPrefix(p.name, "r") && isDigits(p.name[1:]):
+			p.name = p.name + "_"
+		}
+
+		decls = append(decls, p.name+" "+p.typ)
+
+		switch {
+		case i == 0:
+			method.Ctx = p.name
+		case i == 1 && tenant:
+			method.TenantID = p.name
+		case strings.HasPrefix(p.typ, "..."):
+			args = append(args, p.name+"...")
+		default:
+			args = append(args, p.name)
+		}
+	}
+
+	var results []string
+	if fn.Results != nil {
+		for _, field := range fn.Results.List {
+			typ := exprString(fset, field.Type)
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				results = append(results, typ)
+			}
+		}
+	}
+
+	if len(results) == 0 || results[len(results)-1] != "error" {
+		return method, errors.New("the last result must be an `error`")
+	}
+
+	for i := range results[:len(results)-1] {
+		results[i] = "r" + strconv.Itoa(i) + " " + results[i]
+	}
+	results[len(results)-1] = "err error"
+
+	method.Params = strings.Join(decls, ", ")
+	method.Results = strings.Join(results, ", ")
+	method.Args = strings.Join(append([]string{method.Ctx, "db"}, args...), ", ")
+
+	return method, nil
+}
+
+// accessorImports returns the imports of the generated file: the ones of the source file used by the
+// method signatures plus the ones of the wiring itself, the standard library first.
+func accessorImports(f *ast.File, repos []repoSpec, usedPkgs map[string]bool) []string {
+	imports := map[string]bool{
+		strconv.Quote("context"):                                         true,
+		strconv.Quote("github.com/retail-ai-inc/bean"):                   true,
+		"berror " + strconv.Quote("github.com/retail-ai-inc/bean/error"): true,
+		strconv.Quote("github.com/retail-ai-inc/bean/trace"):             true,
+	}
+
+	for _, repo := range repos {
+		if repo.Timeout > 0 {
+			imports[strconv.Quote("time")] = true
+		}
+	}
+
+	for _, imp := range f.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+
+		name := importName(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if !usedPkgs[name] {
+			continue
+		}
+
+		if imp.Name != nil {
+			imports[imp.Name.Name+" "+imp.Path.Value] = true
+		} else {
+			imports[imp.Path.Value] = true
+		}
+	}
+
+	var std, others []string
+	for imp := range imports {
+		importPath, _ := strconv.Unquote(imp[strings.Index(imp, `"`):])
+		if strings.Contains(strings.Split(importPath, "/")[0], ".") {
+			others = append(others, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+
+	if len(others) > 0 {
+		std = append(std, "")
+	}
+
+	return append(std, others...)
+}
+
+// importName guesses the package name of `importPath` from its last element, skipping a major
+// version suffix (example: `github.com/go-redis/redis/v8` → `redis`).
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && isDigits(name[1:]) {
+		name = path.Base(path.Dir(importPath))
+	}
+
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexAny(name, ".-"); i >= 0 {
+		name = name[:i]
+	}
+
+	return name
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// durationExpr returns the go expression of `d` in its largest exact unit (example: `3 * time.Second`).
+func durationExpr(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("%d * time.Nanosecond", d)
+}
+
+var accessorsTmpl = template.Must(template.New("accessors").Funcs(template.FuncMap{"durationExpr": durationExpr}).Parse(`// Code generated by bean gen accessors from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+{{if .}}	{{.}}{{end}}
+{{- end}}
+)
+{{range $repo := .Repos}}
+type {{$repo.Impl}} struct {
+	dbDeps *bean.DBDeps
+}
+
+// New{{$repo.Name}} returns the ` + "`{{$repo.Name}}`" + ` backed by the connections of ` + "`dbDeps`" + `.
+func New{{$repo.Name}}(dbDeps *bean.DBDeps) {{$repo.Name}} {
+	return &{{$repo.Impl}}{dbDeps: dbDeps}
+}
+{{range $repo.Methods}}
+func (repo *{{$repo.Impl}}) {{.Name}}({{.Params}}) ({{.Results}}) {
+	finish := trace.Start({{.Ctx}}, "db")
+	defer finish()
+{{if $repo.Timeout}}
+	{{.Ctx}}, cancel := context.WithTimeout({{.Ctx}}, {{durationExpr $repo.Timeout}})
+	defer cancel()
+{{end}}
+	defer func() {
+		if apiErr := berror.MapDBError(err); apiErr != nil {
+			err = apiErr
+		}
+	}()
+
+	{{if eq $repo.DB "mongo"}}db, err := repo.dbDeps.{{if $repo.Tenant}}MongoConn({{.TenantID}}){{else}}MasterMongoConn(){{end}}
+	if err != nil {
+		return
+	}
+
+	return repo.{{.Core}}({{.Args}}){{else}}conn, err := repo.dbDeps.{{if $repo.Tenant}}MySQLConn({{.TenantID}}){{else}}MasterMySQLConn(){{end}}
+	if err != nil {
+		return
+	}
+	db := conn.WithContext({{.Ctx}})
+
+	return repo.{{.Core}}({{.Args}}){{end}}
+}
+{{end}}{{end}}`))
@@ -0,0 +1,118 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func Test_renderAccessors(t *testing.T) {
+	src := `package repositories
+
+import (
+	"context"
+
+	"demo/models"
+	"github.com/go-redis/redis/v8"
+)
+
+// OrderRepository reads the orders of a tenant.
+//
+//bean:repo db=mysql tenant=true timeout=3s
+type OrderRepository interface {
+	FindOrder(ctx context.Context, tenantID uint64, id uint64) (*models.Order, error)
+	ListOrders(ctx context.Context, tenantID uint64, db string, ids ...uint64) ([]models.Order, int64, error)
+}
+
+//bean:repo db=mongo
+type EventRepository interface {
+	CountEvents(context.Context) (int64, error)
+}
+
+type Unrelated interface {
+	Do() error
+}
+`
+
+	out, err := renderAccessors("order.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := string(out)
+	if _, err := parser.ParseFile(token.NewFileSet(), "order_gen.go", out, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+
+	for _, want := range []string{
+		"// Code generated by bean gen accessors from order.go. DO NOT EDIT.",
+		`"demo/models"`,
+		`"time"`,
+		`berror "github.com/retail-ai-inc/bean/error"`,
+		"func NewOrderRepository(dbDeps *bean.DBDeps) OrderRepository {",
+		"func (repo *orderRepository) FindOrder(ctx context.Context, tenantID uint64, id uint64) (r0 *models.Order, err error) {",
+		"ctx, cancel := context.WithTimeout(ctx, 3*time.Second)",
+		"conn, err := repo.dbDeps.MySQLConn(tenantID)",
+		"return repo.findOrder(ctx, db, id)",
+		"(r0 []models.Order, r1 int64, err error)",
+		"return repo.listOrders(ctx, db, db_, ids...)",
+		"func (repo *eventRepository) CountEvents(p0 context.Context) (r0 int64, err error) {",
+		"db, err := repo.dbDeps.MasterMongoConn()",
+		"return repo.countEvents(p0, db)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %q\n%s", want, code)
+		}
+	}
+
+	for _, unwanted := range []string{"redis", "Unrelated", "eventRepository) CountEvents(p0 context.Context) (r0 int64, err error) {\n\tfinish := trace.Start(p0, \"db\")\n\tdefer finish()\n\n\tp0, cancel"} {
+		if strings.Contains(code, unwanted) {
+			t.Errorf("generated code contains %q\n%s", unwanted, code)
+		}
+	}
+}
+
+func Test_renderAccessorsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no context":     "FindOrder(tenantID uint64) error",
+		"no tenant ID":   "FindOrder(ctx context.Context, id string) error",
+		"no error":       "FindOrder(ctx context.Context, tenantID uint64) int",
+		"embedded iface": "fmt.Stringer",
+	}
+
+	for name, method := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := "package repositories\n\n//bean:repo tenant=true\ntype OrderRepository interface {\n\t" + method + "\n}\n"
+			if _, err := renderAccessors("order.go", []byte(src)); err == nil {
+				t.Errorf("expected an error for %q", method)
+			}
+		})
+	}
+
+	if _, err := renderAccessors("order.go", []byte("package repositories\n")); err == nil {
+		t.Error("expected an error without annotated interface")
+	}
+}
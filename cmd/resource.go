@@ -0,0 +1,253 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	resourceCmd.Flags().Bool("tenant", false, "generate a tenant aware repository which uses the tenant MySQL databases")
+	createCmd.AddCommand(resourceCmd)
+}
+
+// Resource holds the data to generate a handler → service → repository triplet.
+type Resource struct {
+	ProjectObject Project
+	NameUpper     string
+	NameLower     string
+	Tenant        bool
+}
+
+// resourceFiles maps the templates under `internal/_tpl/resource` to the generated files.
+var resourceFiles = []struct {
+	tpl string
+	dir string
+	ext string
+}{
+	{"model.go", "models", ".go"},
+	{"repo.go", "repositories", ".go"},
+	{"service.go", "services", ".go"},
+	{"service_test.go", "services", "_test.go"},
+	{"handler.go", "handlers", ".go"},
+	{"handler_test.go", "handlers", "_test.go"},
+}
+
+var (
+	resourceCmd = &cobra.Command{
+		Use:   "resource <resource-name>",
+		Short: "Create a new handler, service and repository of a resource with tests",
+		Long: `Command takes one argument that is the name of user-defined resource
+Example :- "bean create resource order" will create a model Order, repository, service and handler
+with table-driven tests and wire them in routers/route.go.
+Use "--tenant" to generate a repository which reads and writes the tenant MySQL databases.
+
+It can be used with go generate as well, the project root is found by the nearest env.json:
+//go:generate bean create resource order`,
+		Args: cobra.ExactArgs(1),
+		Run:  resource,
+	}
+)
+
+func resource(cmd *cobra.Command, args []string) {
+	generateResource(InternalFS, cmd, args)
+}
+
+// generateResource creates the resource files from the templates of `internalFS`.
+func generateResource(internalFS fs.FS, cmd *cobra.Command, args []string) {
+	wd, err := findProjectRoot()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	resourceName, err := getHandlerName(args[0])
+	if err != nil {
+		log.Fatalln(handlerValidationRule)
+	}
+
+	tenant, _ := cmd.Flags().GetBool("tenant")
+
+	res := Resource{
+		NameUpper: resourceName,
+		NameLower: strings.ToLower(resourceName),
+		Tenant:    tenant,
+	}
+	fileName := strings.ToLower(resourceName)
+
+	for _, f := range resourceFiles {
+		path := filepath.Join(wd, f.dir, fileName+f.ext)
+		if _, err := os.Stat(path); err == nil {
+			log.Fatalln("File " + path + " already exists.")
+		}
+	}
+
+	p := &Project{
+		Copyright: copyright,
+		RootDir:   wd,
+	}
+
+	// Set the relative root path of the internal templates folder.
+	if p.RootFS, err = fs.Sub(internalFS, "internal/_tpl/resource"); err != nil {
+		log.Fatalln(err)
+	}
+
+	p.PkgPath, err = getPackagePathNameFromEnv(p)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	res.ProjectObject = *p
+
+	for _, f := range resourceFiles {
+		if err := generateResourceFile(p.RootFS, f.tpl, filepath.Join(wd, f.dir, fileName+f.ext), res); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if err := wireResource(filepath.Join(wd, "routers", "route.go"), res); err != nil {
+		fmt.Println("unable to wire the resource in routers/route.go:", err)
+	}
+
+	fmt.Printf("resource %s created with model, repository, service, handler and tests\n", resourceName)
+}
+
+// findProjectRoot returns the nearest directory from the current directory which contains env.json,
+// so that the generator works from `go generate` in any package of the project.
+func findProjectRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "env.json")); err == nil {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("env.json for bean not found")
+		}
+		dir = parent
+	}
+}
+
+func generateResourceFile(rootFS fs.FS, tplName, path string, res Resource) error {
+	fileData, err := fs.ReadFile(rootFS, tplName)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(tplName).Parse(string(fileData))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0754); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return tmpl.Execute(file, res)
+}
+
+// wireResource adds the repository, service and handler of the resource in the route file and
+// registers the routes at the end of the `Init` function.
+func wireResource(routeFile string, res Resource) error {
+	inserts := []struct {
+		needle string
+		text   string
+	}{
+		{"type Repositories struct {", `	` + res.NameLower + `Repo repositories.` + res.NameUpper + `Repository // added by bean`},
+		{"repos := &Repositories{", `		` + res.NameLower + `Repo: repositories.New` + res.NameUpper + `Repository(b.DBConn), // added by bean`},
+		{"type Services struct {", `	` + res.NameLower + `Svc services.` + res.NameUpper + `Service // added by bean`},
+		{"svcs := &Services{", `		` + res.NameLower + `Svc: services.New` + res.NameUpper + `Service(repos.` + res.NameLower + `Repo), // added by bean`},
+		{"type Handlers struct {", `	` + res.NameLower + `Hdlr handlers.` + res.NameUpper + `Handler // added by bean`},
+		{"hdlrs := &Handlers{", `		` + res.NameLower + `Hdlr: handlers.New` + res.NameUpper + `Handler(svcs.` + res.NameLower + `Svc), // added by bean`},
+	}
+
+	for _, insert := range inserts {
+		lineNumber, err := matchTextInFileAndReturnFirstOccurrenceLineNumber(routeFile, insert.needle)
+		if err != nil {
+			return err
+		}
+		if lineNumber == 0 {
+			return fmt.Errorf("%q not found", insert.needle)
+		}
+
+		if err := insertStringToNthLineOfFile(routeFile, insert.text, lineNumber); err != nil {
+			return err
+		}
+	}
+
+	lineNumber, err := lastLineNumberOfText(routeFile, "}")
+	if err != nil {
+		return err
+	}
+	if lineNumber == 0 {
+		return errors.New("end of the Init function not found")
+	}
+
+	routes := "\n" +
+		`	e.GET("/` + res.NameLower + `s/:id", hdlrs.` + res.NameLower + `Hdlr.Get` + res.NameUpper + `) // added by bean` + "\n" +
+		`	e.POST("/` + res.NameLower + `s", hdlrs.` + res.NameLower + `Hdlr.Create` + res.NameUpper + `) // added by bean`
+
+	return insertStringToNthLineOfFile(routeFile, routes, lineNumber-1)
+}
+
+// lastLineNumberOfText returns the line number of the last line which is exactly `text`.
+func lastLineNumberOfText(filePath string, text string) (int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	line, found := 1, 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if scanner.Text() == text {
+			found = line
+		}
+
+		line++
+	}
+
+	return found, scanner.Err()
+}
@@ -0,0 +1,79 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_wireResource(t *testing.T) {
+	routeFile := filepath.Join(t.TempDir(), "route.go")
+	route := `package routers
+
+type Repositories struct {
+}
+
+type Services struct {
+}
+
+type Handlers struct {
+}
+
+func Init(b *bean.Bean) {
+	repos := &Repositories{
+	}
+
+	svcs := &Services{
+	}
+
+	hdlrs := &Handlers{
+	}
+}
+`
+	if err := os.WriteFile(routeFile, []byte(route), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wireResource(routeFile, Resource{NameUpper: "Order", NameLower: "order"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(routeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"type Repositories struct {\n\torderRepo repositories.OrderRepository // added by bean\n}",
+		"svcs := &Services{\n\t\torderSvc: services.NewOrderService(repos.orderRepo), // added by bean\n\t}",
+		"hdlrs := &Handlers{\n\t\torderHdlr: handlers.NewOrderHandler(svcs.orderSvc), // added by bean\n\t}",
+		"\te.POST(\"/orders\", hdlrs.orderHdlr.CreateOrder) // added by bean\n}\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("route file does not contain %q:\n%s", want, data)
+		}
+	}
+}
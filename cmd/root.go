@@ -98,6 +98,11 @@ func Execute(internalFS fs.FS) {
 	// Set up global FS variable.
 	InternalFS = internalFS
 
+	// The sub commands are only attached here so that importing the package for
+	// `NewAppCommand` leaves the `bean` root command untouched.
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(createCmd, initCmd, repoGenCmd)
+
 	if bi, ok := debug.ReadBuildInfo(); ok {
 		rootCmd.Version = bi.Main.Version
 	} else {
@@ -109,13 +114,3 @@ func Execute(internalFS fs.FS) {
 		os.Exit(1)
 	}
 }
-
-func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.CompletionOptions.DisableDefaultCmd = true
-}
@@ -74,6 +74,11 @@ Example :- "bean create service post" will create a service Post in the services
 )
 
 func service(cmd *cobra.Command, args []string) {
+	generateService(InternalFS, cmd, args)
+}
+
+// generateService creates the service files from the templates of `internalFS`.
+func generateService(internalFS fs.FS, cmd *cobra.Command, args []string) {
 	beanCheck := beanInitialisationCheck()
 	if !beanCheck {
 		log.Fatalln("env.json for bean not found!!")
@@ -120,7 +125,7 @@ func service(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the relative root path of the internal templates folder.
-	if p.RootFS, err = fs.Sub(InternalFS, "internal/_tpl"); err != nil {
+	if p.RootFS, err = fs.Sub(internalFS, "internal/_tpl"); err != nil {
 		log.Fatalln(err)
 	}
 
@@ -0,0 +1,260 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// EnvironmentVariable selects the environment overlay of `LoadConfig` instead of `environment` of the config
+// files.
+const EnvironmentVariable = "BEAN_ENV"
+
+var (
+	configDirMu sync.RWMutex
+	configDir   string
+)
+
+// ConfigProvenance reports the layers loaded by `LoadConfig` and which layer set each key.
+type ConfigProvenance struct {
+	Environment string
+	// Files are the layers in the order of the merge.
+	Files   []string
+	sources map[string]configSource
+}
+
+type configSource struct {
+	key  string
+	file string
+}
+
+// LoadConfig merges the layers of the config in `dir` into the global viper and unmarshals them into
+// `BeanConfig`. The layers are merged in this order, the maps key by key and the other values replaced:
+//
+//  1. `env.json`, the base shared by all the environments.
+//  2. `env.<environment>.json`, the overlay of the environment, if it exists. The environment is
+//     `BEAN_ENV`, or `environment` of `env.local.json` or `env.json`.
+//  3. `env.local.json`, the local override which should not be committed, if it exists.
+//
+// The config reload reads the same layers again.
+func LoadConfig(dir string) (*ConfigProvenance, error) {
+	provenance, err := loadConfigLayers(viper.GetViper(), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := viper.Unmarshal(&BeanConfig); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	configDirMu.Lock()
+	configDir = dir
+	configDirMu.Unlock()
+
+	return provenance, nil
+}
+
+// loadedConfigDir returns the directory of `LoadConfig`, or "" if the config was read otherwise.
+func loadedConfigDir() string {
+	configDirMu.RLock()
+	defer configDirMu.RUnlock()
+
+	return configDir
+}
+
+func loadConfigLayers(v *viper.Viper, dir string) (*ConfigProvenance, error) {
+	base, err := readConfigLayer(filepath.Join(dir, "env.json"))
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return nil, errors.Errorf("config: %s not found", filepath.Join(dir, "env.json"))
+	}
+
+	local, err := readConfigLayer(filepath.Join(dir, "env.local.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	environment := os.Getenv(EnvironmentVariable)
+	if environment == "" {
+		environment = stringSetting(local, "environment")
+	}
+	if environment == "" {
+		environment = stringSetting(base, "environment")
+	}
+
+	provenance := &ConfigProvenance{Environment: environment, sources: map[string]configSource{}}
+	names := []string{"env.json", "env." + environment + ".json", "env.local.json"}
+	layers := []map[string]interface{}{base, nil, local}
+
+	if environment != "" {
+		if strings.ContainsAny(environment, `/\`) {
+			return nil, errors.Errorf("config: invalid environment %q", environment)
+		}
+		if layers[1], err = readConfigLayer(filepath.Join(dir, names[1])); err != nil {
+			return nil, err
+		}
+	}
+
+	settings := map[string]interface{}{}
+	for i, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		provenance.Files = append(provenance.Files, names[i])
+		provenance.add(names[i], layer, "")
+		mergeSettings(settings, layer)
+	}
+
+	if err := v.MergeConfigMap(settings); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The environment variable wins over the files so that the config matches the overlay.
+	if name := os.Getenv(EnvironmentVariable); name != "" {
+		v.Set("environment", name)
+		provenance.add("$"+EnvironmentVariable, map[string]interface{}{"environment": name}, "")
+	}
+
+	return provenance, nil
+}
+
+// readConfigLayer returns the settings of the JSON file `path`, or nil if it doesn't exist.
+func readConfigLayer(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, errors.Wrapf(err, "config: %s", path)
+	}
+
+	return settings, nil
+}
+
+// mergeSettings merges `src` into `dst`, the maps key by key and the other values replaced. The keys are case
+// insensitive like the keys of viper.
+func mergeSettings(dst, src map[string]interface{}) {
+	for key, value := range src {
+		for k := range dst {
+			if k != key && strings.EqualFold(k, key) {
+				dst[key] = dst[k]
+				delete(dst, k)
+			}
+		}
+
+		from, ok := value.(map[string]interface{})
+		if to, isMap := dst[key].(map[string]interface{}); ok && isMap {
+			mergeSettings(to, from)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+func stringSetting(settings map[string]interface{}, key string) string {
+	for k, v := range settings {
+		if strings.EqualFold(k, key) {
+			s, _ := v.(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// add records `file` as the source of the keys of `settings`. A value which is not a map replaces the keys
+// under it, like the merge of viper.
+func (p *ConfigProvenance) add(file string, settings map[string]interface{}, prefix string) {
+	for key, value := range settings {
+		key = prefix + key
+		lower := strings.ToLower(key)
+
+		if m, ok := value.(map[string]interface{}); ok {
+			delete(p.sources, lower)
+			if len(m) == 0 && !p.hasKeysUnder(lower) {
+				p.sources[lower] = configSource{key: key, file: file}
+			}
+			p.add(file, m, key+".")
+			continue
+		}
+
+		for k := range p.sources {
+			if strings.HasPrefix(k, lower+".") {
+				delete(p.sources, k)
+			}
+		}
+		p.sources[lower] = configSource{key: key, file: file}
+	}
+}
+
+func (p *ConfigProvenance) hasKeysUnder(key string) bool {
+	for k := range p.sources {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Source returns the layer which set the key, e.g. `http.port`, or "" if no layer has set it.
+func (p *ConfigProvenance) Source(key string) string {
+	return p.sources[strings.ToLower(key)].file
+}
+
+// Keys returns the keys set by the layers in order.
+func (p *ConfigProvenance) Keys() []string {
+	keys := make([]string, 0, len(p.sources))
+	for _, source := range p.sources {
+		keys = append(keys, source.key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return strings.ToLower(keys[i]) < strings.ToLower(keys[j]) })
+
+	return keys
+}
+
+func (p *ConfigProvenance) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "environment: %s\n", p.Environment)
+	fmt.Fprintf(&b, "layers: %s\n", strings.Join(p.Files, ", "))
+	for _, key := range p.Keys() {
+		fmt.Fprintf(&b, "%s = %s\n", key, p.Source(key))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,117 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigLayers(t *testing.T, layers map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range layers {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	viper.Reset()
+	saved := BeanConfig
+	t.Cleanup(func() {
+		viper.Reset()
+		BeanConfig = saved
+		configDirMu.Lock()
+		configDir = ""
+		configDirMu.Unlock()
+	})
+
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := writeConfigLayers(t, map[string]string{
+		"env.json":         `{"environment": "staging", "projectName": "bean", "http": {"port": "8888", "host": "localhost", "allowedMethod": ["GET", "POST"]}, "debugLog": {"level": "debug"}}`,
+		"env.staging.json": `{"http": {"host": "0.0.0.0", "allowedMethod": ["GET"]}, "debugLog": {"level": "info"}}`,
+		"env.local.json":   `{"debugLog": {"level": "error"}}`,
+	})
+
+	provenance, err := LoadConfig(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "staging", BeanConfig.Environment)
+	assert.Equal(t, "8888", BeanConfig.HTTP.Port)
+	assert.Equal(t, "0.0.0.0", BeanConfig.HTTP.Host)
+	assert.Equal(t, []string{"GET"}, BeanConfig.HTTP.AllowedMethod)
+	assert.Equal(t, "error", BeanConfig.DebugLog.Level)
+
+	assert.Equal(t, "staging", provenance.Environment)
+	assert.Equal(t, []string{"env.json", "env.staging.json", "env.local.json"}, provenance.Files)
+	assert.Equal(t, "env.json", provenance.Source("http.port"))
+	assert.Equal(t, "env.staging.json", provenance.Source("HTTP.Host"))
+	assert.Equal(t, "env.local.json", provenance.Source("debugLog.level"))
+	assert.Equal(t, "", provenance.Source("http"))
+	assert.Equal(t, []string{"debugLog.level", "environment", "http.allowedMethod", "http.host", "http.port", "projectName"}, provenance.Keys())
+	assert.Contains(t, provenance.String(), "http.host = env.staging.json\n")
+	assert.Equal(t, dir, loadedConfigDir())
+}
+
+func TestLoadConfigEnvironmentVariable(t *testing.T) {
+	dir := writeConfigLayers(t, map[string]string{
+		"env.json":      `{"environment": "local", "http": {"port": "8888"}, "extra": {"mysql": {"master": {"host": "127.0.0.1"}}}}`,
+		"env.prod.json": `{"http": {"port": "80"}, "extra": {"mysql": "none"}}`,
+	})
+	t.Setenv(EnvironmentVariable, "prod")
+
+	provenance, err := LoadConfig(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "prod", BeanConfig.Environment)
+	assert.Equal(t, "80", BeanConfig.HTTP.Port)
+	assert.Equal(t, []string{"env.json", "env.prod.json"}, provenance.Files)
+	assert.Equal(t, "$"+EnvironmentVariable, provenance.Source("environment"))
+
+	// A value replaces the keys under it.
+	assert.Equal(t, "env.prod.json", provenance.Source("extra.mysql"))
+	assert.Equal(t, "", provenance.Source("extra.mysql.master.host"))
+	assert.Equal(t, "none", viper.GetString("extra.mysql"))
+
+	t.Setenv(EnvironmentVariable, "../prod")
+	_, err = LoadConfig(dir)
+	assert.Error(t, err)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := writeConfigLayers(t, map[string]string{"env.staging.json": `{}`})
+	_, err := LoadConfig(dir)
+	assert.ErrorContains(t, err, "not found")
+
+	dir = writeConfigLayers(t, map[string]string{"env.json": `{"environment": "staging"}`, "env.staging.json": `{`})
+	_, err = LoadConfig(dir)
+	assert.ErrorContains(t, err, "env.staging.json")
+}
+
+func TestReloadConfigLayers(t *testing.T) {
+	dir := writeConfigLayers(t, map[string]string{
+		"env.json":         `{"environment": "staging", "debugLog": {"level": "debug"}}`,
+		"env.staging.json": `{"debugLog": {"level": "info"}}`,
+	})
+	_, err := LoadConfig(dir)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	b := &Bean{Echo: e, Config: BeanConfig}
+	b.reload.settings = viper.AllSettings()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "env.local.json"), []byte(`{"debugLog": {"level": "warn"}}`), 0o600))
+
+	var level string
+	b.OnConfigChange(func(_, new Config) { level = new.DebugLog.Level })
+	require.NoError(t, b.ReloadConfig(context.Background()))
+	assert.Equal(t, "warn", level)
+}
@@ -0,0 +1,355 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"github.com/spf13/viper"
+)
+
+// configReload is the state of the config reload of a bean instance.
+type configReload struct {
+	mu       sync.RWMutex
+	current  *Config
+	settings map[string]interface{}
+	hooks    []func(old, new Config)
+	sources  []ConfigSource
+	watching bool
+}
+
+// The sample rate of the sentry traces, as the bits of a float64, changed by the config reload.
+var tracesSampleRate uint64
+
+// OnConfigChange registers `fn` to be called with the old and the new config when `env.json` or a remote
+// source changes, e.g. to adjust the rate limits. The log level and the sentry traces sample rate are applied
+// by bean. The hooks are called one by one by the reload, so they must not block.
+//
+//	b.OnConfigChange(func(old, new bean.Config) {
+//		if old.HTTP.RateLimit != new.HTTP.RateLimit {
+//			limiter.SetLimit(new.HTTP.RateLimit)
+//		}
+//	})
+func (b *Bean) OnConfigChange(fn func(old, new Config)) {
+	b.reload.mu.Lock()
+	defer b.reload.mu.Unlock()
+
+	b.reload.hooks = append(b.reload.hooks, fn)
+}
+
+// CurrentConfig returns the last config loaded by the config reload. `b.Config` and `BeanConfig` keep the
+// config of the boot.
+func (b *Bean) CurrentConfig() Config {
+	b.reload.mu.RLock()
+	defer b.reload.mu.RUnlock()
+
+	if b.reload.current == nil {
+		return b.Config
+	}
+
+	return *b.reload.current
+}
+
+// ReloadConfig reads `env.json`, or the layers of `LoadConfig`, and merges the remote sources of `WatchConfig` over it. If the settings have
+// changed then it calls the hooks of `OnConfigChange`. The sentry client options and the scope of the old
+// config are kept as they can't be read from a file.
+func (b *Bean) ReloadConfig(c context.Context) error {
+	b.reload.mu.RLock()
+	sources := b.reload.sources
+	b.reload.mu.RUnlock()
+
+	v := viper.New()
+	if dir := loadedConfigDir(); dir != "" {
+		if _, err := loadConfigLayers(v, dir); err != nil {
+			return err
+		}
+	} else if file := viper.ConfigFileUsed(); file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	v.SetConfigType("json")
+	for _, source := range sources {
+		data, err := source.Fetch(c)
+		if err != nil {
+			return errors.Wrap(err, source.Name())
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		if err := v.MergeConfig(bytes.NewReader(data)); err != nil {
+			return errors.Wrap(err, source.Name())
+		}
+	}
+
+	settings := v.AllSettings()
+
+	b.reload.mu.Lock()
+	if reflect.DeepEqual(settings, b.reload.settings) {
+		b.reload.mu.Unlock()
+		return nil
+	}
+
+	old := b.Config
+	if b.reload.current != nil {
+		old = *b.reload.current
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		b.reload.mu.Unlock()
+		return errors.WithStack(err)
+	}
+
+	config.Sentry.ClientOptions = old.Sentry.ClientOptions
+	config.Sentry.ConfigureScope = old.Sentry.ConfigureScope
+
+	b.reload.current = &config
+	b.reload.settings = settings
+	hooks := append([]func(old, new Config){}, b.reload.hooks...)
+	b.reload.mu.Unlock()
+
+	b.Logger().Info("config reloaded")
+
+	for _, hook := range hooks {
+		hook(old, config)
+	}
+
+	return nil
+}
+
+// WatchConfig reloads the config when `env.json`, or one of the consul and etcd sources of `configReload`
+// and `sources`, changes. The changes are debounced by `configReload.debounce`. `ServeAt` calls it if
+// `configReload.on` is true; the watch stops with the shutdown.
+func (b *Bean) WatchConfig(sources ...ConfigSource) error {
+	b.reload.mu.Lock()
+	if b.reload.watching {
+		b.reload.mu.Unlock()
+		return errors.New("the config is already watched")
+	}
+
+	sources = append(b.configSources(), sources...)
+	b.reload.sources = sources
+	b.reload.watching = true
+
+	// Only the changes from the boot config call the hooks, unless the remote sources differ.
+	if b.reload.settings == nil && len(sources) == 0 {
+		b.reload.settings = viper.AllSettings()
+	}
+	b.reload.mu.Unlock()
+
+	debounce := b.Config.ConfigReload.Debounce
+	if debounce <= 0 {
+		debounce = time.Second
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	dir := loadedConfigDir()
+	if file := viper.ConfigFileUsed(); dir == "" && file != "" {
+		dir = filepath.Dir(file)
+	}
+
+	var watcher *fsnotify.Watcher
+	if dir != "" {
+		var err error
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			cancel()
+			return errors.WithStack(err)
+		}
+
+		// Watch the directory rather than the file, so that the symbolic links of the kubernetes config maps
+		// are followed when they are swapped.
+		if err := watcher.Add(dir); err != nil {
+			cancel()
+			watcher.Close()
+			return errors.WithStack(err)
+		}
+
+		go func() {
+			for {
+				select {
+				case _, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+					notify()
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
+					}
+					b.Logger().Error("config reload: ", err)
+				}
+			}
+		}()
+	}
+
+	for _, source := range sources {
+		go func(source ConfigSource) {
+			for {
+				err := source.Wait(c)
+				if c.Err() != nil {
+					return
+				}
+
+				if err != nil {
+					b.Logger().Error("config reload: ", source.Name(), ": ", err)
+					select {
+					case <-c.Done():
+						return
+					case <-time.After(debounce):
+					}
+				}
+
+				notify()
+			}
+		}(source)
+	}
+
+	go func() {
+		// Load the remote sources once at the start.
+		if len(sources) > 0 {
+			notify()
+		}
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-changes:
+			}
+
+			select {
+			case <-c.Done():
+				return
+			case <-time.After(debounce):
+			}
+
+			if err := b.ReloadConfig(c); err != nil && c.Err() == nil {
+				b.Logger().Error("config reload: ", err)
+			}
+		}
+	}()
+
+	return b.ShutdownOrchestrator().Register(shutdown.Component{
+		Name:  "config",
+		Stage: shutdown.StageIntake,
+		Stop: func(context.Context) error {
+			cancel()
+			if watcher != nil {
+				return watcher.Close()
+			}
+			return nil
+		},
+	})
+}
+
+// configSources returns the remote sources of `configReload`.
+func (b *Bean) configSources() (sources []ConfigSource) {
+	config := b.Config.ConfigReload
+	if config.Consul.Addr != "" && config.Consul.Key != "" {
+		sources = append(sources, &ConsulSource{Addr: config.Consul.Addr, Key: config.Consul.Key, Token: config.Consul.Token})
+	}
+
+	if config.Etcd.Addr != "" && config.Etcd.Key != "" {
+		sources = append(sources, &EtcdSource{Addr: config.Etcd.Addr, Key: config.Etcd.Key, Interval: config.Etcd.Interval})
+	}
+
+	return sources
+}
+
+// applyConfigChange applies the settings which can change without a restart.
+func (b *Bean) applyConfigChange(old, new Config) {
+	if old.DebugLog.Level != new.DebugLog.Level {
+		b.Echo.Logger.SetLevel(logLevel(new.DebugLog.Level))
+		b.Logger().Info("log level changed to ", new.DebugLog.Level)
+	}
+
+	// The sentry middleware of the traces is only added at the boot if the rate is not 0.
+	if old.Sentry.TracesSampleRate != new.Sentry.TracesSampleRate {
+		setTracesSampleRate(new.Sentry.TracesSampleRate)
+		b.Logger().Info("sentry traces sample rate changed to ", new.Sentry.TracesSampleRate)
+	}
+}
+
+// logLevel returns the level of the echo logger from `debugLog.level`.
+func logLevel(level string) log.Lvl {
+	switch strings.ToLower(level) {
+	case "info":
+		return log.INFO
+	case "warn":
+		return log.WARN
+	case "error":
+		return log.ERROR
+	case "off":
+		return log.OFF
+	default:
+		return log.DEBUG
+	}
+}
+
+func setTracesSampleRate(rate float64) {
+	if rate < 0 {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+
+	atomic.StoreUint64(&tracesSampleRate, math.Float64bits(rate))
+}
+
+// sampleTraces samples the transactions with the current rate, or inherits the decision of the parent like
+// the sampling of sentry without a sampler.
+func sampleTraces(c sentry.SamplingContext) sentry.Sampled {
+	if c.Parent != nil {
+		return c.Parent.Sampled
+	}
+
+	rate := math.Float64frombits(atomic.LoadUint64(&tracesSampleRate))
+
+	return sentry.UniformTracesSampler(rate).Sample(c)
+}
@@ -0,0 +1,174 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource []byte
+
+func (s staticSource) Name() string                          { return "static" }
+func (s staticSource) Fetch(context.Context) ([]byte, error) { return s, nil }
+func (s staticSource) Wait(c context.Context) error          { <-c.Done(); return c.Err() }
+
+func newReloadBean(t *testing.T, config string) (*Bean, string) {
+	file := filepath.Join(t.TempDir(), "env.json")
+	require.NoError(t, os.WriteFile(file, []byte(config), 0o600))
+
+	viper.Reset()
+	viper.SetConfigFile(file)
+	require.NoError(t, viper.ReadInConfig())
+	t.Cleanup(viper.Reset)
+
+	e := echo.New()
+	e.Logger.SetOutput(&bytes.Buffer{})
+	b := &Bean{Echo: e}
+	require.NoError(t, viper.Unmarshal(&b.Config))
+	b.OnConfigChange(b.applyConfigChange)
+
+	return b, file
+}
+
+func TestReloadConfig(t *testing.T) {
+	b, file := newReloadBean(t, `{"debugLog": {"level": "debug"}, "http": {"port": "8888"}}`)
+	b.Config.Sentry.ConfigureScope = func(*sentry.Scope) {}
+
+	var calls [][2]Config
+	b.OnConfigChange(func(old, new Config) {
+		calls = append(calls, [2]Config{old, new})
+	})
+
+	// The first reload has no settings to compare with.
+	require.NoError(t, b.ReloadConfig(context.Background()))
+	require.Len(t, calls, 1)
+
+	require.NoError(t, b.ReloadConfig(context.Background()))
+	assert.Len(t, calls, 1)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"debugLog": {"level": "error"}, "http": {"port": "8888"}}`), 0o600))
+	require.NoError(t, b.ReloadConfig(context.Background()))
+	require.Len(t, calls, 2)
+	assert.Equal(t, "debug", calls[1][0].DebugLog.Level)
+	assert.Equal(t, "error", calls[1][1].DebugLog.Level)
+	assert.NotNil(t, calls[1][1].Sentry.ConfigureScope)
+	assert.Equal(t, log.ERROR, b.Echo.Logger.Level())
+	assert.Equal(t, "error", b.CurrentConfig().DebugLog.Level)
+	assert.Equal(t, "debug", b.Config.DebugLog.Level)
+
+	// The remote sources are merged over the file.
+	b.reload.sources = []ConfigSource{staticSource(`{"debugLog": {"level": "warn"}}`)}
+	require.NoError(t, b.ReloadConfig(context.Background()))
+	require.Len(t, calls, 3)
+	assert.Equal(t, "warn", b.CurrentConfig().DebugLog.Level)
+	assert.Equal(t, "8888", b.CurrentConfig().HTTP.Port)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{`), 0o600))
+	assert.Error(t, b.ReloadConfig(context.Background()))
+	assert.Equal(t, "warn", b.CurrentConfig().DebugLog.Level)
+}
+
+func TestWatchConfig(t *testing.T) {
+	b, file := newReloadBean(t, `{"debugLog": {"level": "debug"}, "configReload": {"debounce": "10ms"}}`)
+	defer b.Shutdown(context.Background())
+
+	var mu sync.Mutex
+	var levels []string
+	b.OnConfigChange(func(_, new Config) {
+		mu.Lock()
+		defer mu.Unlock()
+		levels = append(levels, new.DebugLog.Level)
+	})
+
+	require.NoError(t, b.WatchConfig())
+	assert.Error(t, b.WatchConfig())
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"debugLog": {"level": "info"}, "configReload": {"debounce": "10ms"}}`), 0o600))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(levels) == 1 && levels[0] == "info"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, log.INFO, b.Echo.Logger.Level())
+}
+
+func TestConsulSource(t *testing.T) {
+	var mu sync.Mutex
+	index, value := 1, `{"debugLog": {"level": "info"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/kv/bean/env", r.URL.Path)
+		assert.Equal(t, "token", r.Header.Get("X-Consul-Token"))
+
+		if r.URL.Query().Get("index") != "" {
+			// A blocking query returns at the change.
+			mu.Lock()
+			index, value = 2, `{"debugLog": {"level": "warn"}}`
+			mu.Unlock()
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		_, _ = w.Write([]byte(value))
+	}))
+	defer server.Close()
+
+	source := &ConsulSource{Addr: server.URL, Key: "bean/env", Token: "token"}
+	data, err := source.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"debugLog": {"level": "info"}}`, string(data))
+
+	require.NoError(t, source.Wait(context.Background()))
+	data, err = source.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"debugLog": {"level": "warn"}}`, string(data))
+}
+
+func TestEtcdSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/kv/range", r.URL.Path)
+		value := base64.StdEncoding.EncodeToString([]byte(`{"debugLog": {"level": "info"}}`))
+		_, _ = w.Write([]byte(`{"kvs": [{"value": "` + value + `", "mod_revision": "3"}]}`))
+	}))
+	defer server.Close()
+
+	source := &EtcdSource{Addr: server.URL, Key: "bean/env", Interval: time.Millisecond}
+	data, err := source.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"debugLog": {"level": "info"}}`, string(data))
+
+	// The revision has not changed.
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, source.Wait(c), context.DeadlineExceeded)
+}
+
+func TestSampleTraces(t *testing.T) {
+	defer setTracesSampleRate(0)
+
+	setTracesSampleRate(1)
+	assert.Equal(t, sentry.SampledTrue, sampleTraces(sentry.SamplingContext{}))
+
+	setTracesSampleRate(0)
+	assert.Equal(t, sentry.SampledFalse, sampleTraces(sentry.SamplingContext{}))
+
+	parent := &sentry.Span{Sampled: sentry.SampledTrue}
+	assert.Equal(t, sentry.SampledTrue, sampleTraces(sentry.SamplingContext{Parent: parent}))
+}
@@ -0,0 +1,248 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigSource is a remote source of the config, merged over `env.json` by the config reload.
+type ConfigSource interface {
+	// Name identifies the source in the logs.
+	Name() string
+	// Fetch returns the JSON of the config, or nil if there is none.
+	Fetch(c context.Context) ([]byte, error)
+	// Wait blocks until the config may have changed, or `c` is done.
+	Wait(c context.Context) error
+}
+
+// ConsulSource reads the JSON of the config from a consul KV key, and waits for its changes with the blocking
+// queries of consul.
+type ConsulSource struct {
+	Addr  string
+	Key   string
+	Token string
+	// Optional. Default value 5m.
+	WaitTime time.Duration
+
+	mu    sync.Mutex
+	index uint64
+}
+
+func (s *ConsulSource) Name() string {
+	return "consul " + s.Key
+}
+
+func (s *ConsulSource) Fetch(c context.Context) ([]byte, error) {
+	data, _, err := s.get(c, 0)
+	return data, err
+}
+
+func (s *ConsulSource) Wait(c context.Context) error {
+	for {
+		s.mu.Lock()
+		index := s.index
+		s.mu.Unlock()
+
+		_, next, err := s.get(c, index)
+		if err != nil {
+			return err
+		}
+
+		if next != index {
+			return nil
+		}
+	}
+}
+
+// get reads the key, blocking until its index is greater than `index` if it's not 0.
+func (s *ConsulSource) get(c context.Context, index uint64) ([]byte, uint64, error) {
+	query := url.Values{"raw": {""}}
+	if index > 0 {
+		wait := s.WaitTime
+		if wait <= 0 {
+			wait = 5 * time.Minute
+		}
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", wait.String())
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet, strings.TrimRight(s.Addr, "/")+"/v1/kv/"+strings.TrimLeft(s.Key, "/")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return nil, 0, errors.Errorf("GET %s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	// The index can go backwards, e.g. after a restore of consul, then the blocking query starts again.
+	s.mu.Lock()
+	if next < s.index {
+		next = 0
+	}
+	s.index = next
+	s.mu.Unlock()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, next, nil
+	}
+
+	return data, next, nil
+}
+
+// EtcdSource reads the JSON of the config from an etcd v3 key through the JSON gateway of etcd, and polls it
+// for its changes.
+type EtcdSource struct {
+	Addr string
+	Key  string
+	// Optional. Default value 30s.
+	Interval time.Duration
+
+	mu       sync.Mutex
+	revision string
+}
+
+func (s *EtcdSource) Name() string {
+	return "etcd " + s.Key
+}
+
+func (s *EtcdSource) Fetch(c context.Context) ([]byte, error) {
+	data, revision, err := s.get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+
+	return data, nil
+}
+
+func (s *EtcdSource) Wait(c context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-time.After(interval):
+		}
+
+		_, revision, err := s.get(c)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		changed := revision != s.revision
+		s.mu.Unlock()
+
+		if changed {
+			return nil
+		}
+	}
+}
+
+// get returns the value of the key and its revision.
+func (s *EtcdSource) get(c context.Context) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(s.Key))})
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, strings.TrimRight(s.Addr, "/")+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.Errorf("POST %s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Kvs []struct {
+			Value       string `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	if len(result.Kvs) == 0 {
+		return nil, "", nil
+	}
+
+	value, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return value, result.Kvs[0].ModRevision, nil
+}
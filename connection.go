@@ -0,0 +1,157 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Connection describes the connection of a request, for the security audits and the debugging of the
+// TLS handshakes with the partner systems.
+type Connection struct {
+	// Network of the listener, "tcp" or "unix".
+	Network string `json:"network,omitempty"`
+	// RemoteAddr is the peer of the socket, the proxy if there is one unlike `echo.Context.RealIP`.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	// LocalAddr is the address of the listener which accepted the connection.
+	LocalAddr string `json:"localAddr,omitempty"`
+	// Proto is the protocol of the request, like "HTTP/2.0".
+	Proto string `json:"proto"`
+	// TLS is nil if the connection is not encrypted.
+	TLS *ConnectionTLS `json:"tls,omitempty"`
+}
+
+// ConnectionTLS describes the TLS session of a connection.
+type ConnectionTLS struct {
+	// Version is like "TLS 1.3".
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	// NegotiatedProtocol is the ALPN protocol, like "h2".
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	Resumed            bool   `json:"resumed"`
+	// ClientSubject, ClientIssuer, ClientSerial and ClientNotAfter describe the certificate presented by the
+	// client, they are empty without mutual TLS. They are not trustworthy unless `ClientVerified` is true,
+	// the client can present any certificate with the `request` verify mode.
+	ClientSubject  string     `json:"clientSubject,omitempty"`
+	ClientIssuer   string     `json:"clientIssuer,omitempty"`
+	ClientSerial   string     `json:"clientSerial,omitempty"`
+	ClientNotAfter *time.Time `json:"clientNotAfter,omitempty"`
+	// ClientVerified is true if the certificate of the client is verified by the client CAs, it's false
+	// with the `request` verify mode. (see `http.ssl.mtls.verifyMode`)
+	ClientVerified bool `json:"clientVerified"`
+}
+
+// ConnectionInfo returns the connection of the request.
+// Example:
+//
+//	conn := bean.ConnectionInfo(c)
+//	if conn.TLS == nil || !conn.TLS.ClientVerified || conn.TLS.ClientSubject != "CN=partner-gateway" {
+//		return echo.ErrForbidden
+//	}
+func ConnectionInfo(c echo.Context) Connection {
+	req := c.Request()
+
+	conn := Connection{RemoteAddr: req.RemoteAddr, Proto: req.Proto}
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		conn.Network = addr.Network()
+		conn.LocalAddr = addr.String()
+	}
+
+	state := req.TLS
+	if state == nil {
+		return conn
+	}
+
+	conn.TLS = &ConnectionTLS{
+		Version:            tlsVersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		ServerName:         state.ServerName,
+		Resumed:            state.DidResume,
+		ClientVerified:     len(state.VerifiedChains) > 0,
+	}
+	// The leaf of the verified chain is the certificate presented by the client.
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		if conn.TLS.ClientVerified {
+			cert = state.VerifiedChains[0][0]
+		}
+		notAfter := cert.NotAfter
+		conn.TLS.ClientSubject = cert.Subject.String()
+		conn.TLS.ClientIssuer = cert.Issuer.String()
+		conn.TLS.ClientSerial = cert.SerialNumber.Text(16)
+		conn.TLS.ClientNotAfter = &notAfter
+	}
+
+	return conn
+}
+
+// LogConnection is an access log enricher adding the `connection` field, see `ConnectionInfo`. It's added to
+// `AccessLogEnrichers` if `accessLog.connection` of env.json is true.
+func LogConnection(c echo.Context, fields map[string]interface{}) {
+	conn := ConnectionInfo(c)
+
+	field := map[string]interface{}{
+		"remoteAddr": conn.RemoteAddr,
+		"proto":      conn.Proto,
+	}
+	if conn.LocalAddr != "" {
+		field["network"] = conn.Network
+		field["localAddr"] = conn.LocalAddr
+	}
+	if conn.TLS != nil {
+		field["tlsVersion"] = conn.TLS.Version
+		field["tlsCipherSuite"] = conn.TLS.CipherSuite
+		field["alpn"] = conn.TLS.NegotiatedProtocol
+		if conn.TLS.ClientSubject != "" {
+			field["clientSubject"] = conn.TLS.ClientSubject
+			field["clientIssuer"] = conn.TLS.ClientIssuer
+			field["clientSerial"] = conn.TLS.ClientSerial
+			field["clientVerified"] = conn.TLS.ClientVerified
+		}
+	}
+
+	fields["connection"] = field
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+
+	return "0x" + strconv.FormatUint(uint64(version), 16)
+}
@@ -0,0 +1,103 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionInfo(t *testing.T) {
+	t.Run("request", func(t *testing.T) { testConnectionInfo(t, "request") })
+	t.Run("require", func(t *testing.T) { testConnectionInfo(t, "require") })
+}
+
+func testConnectionInfo(t *testing.T, verifyMode string) {
+	b, dir := newTLSBean(t)
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "localhost", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+	ca.write(t, filepath.Join(dir, "ca.pem"), "")
+	b.Config.HTTP.SSL.MTLS.On = true
+	b.Config.HTTP.SSL.MTLS.ClientCAFile = filepath.Join(dir, "ca.pem")
+	b.Config.HTTP.SSL.MTLS.VerifyMode = verifyMode
+
+	config, err := b.TLSConfig()
+	require.NoError(t, err)
+
+	b.Echo.GET("/", func(c echo.Context) error {
+		fields := map[string]interface{}{}
+		LogConnection(c, fields)
+		return c.JSON(http.StatusOK, map[string]interface{}{"info": ConnectionInfo(c), "fields": fields})
+	})
+	server := httptest.NewUnstartedServer(b.Echo)
+	server.TLS = config
+	server.EnableHTTP2 = true
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true, TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{newTestCert(t, "partner-gateway", ca).tls()},
+		ServerName:   "localhost",
+		MinVersion:   tls.VersionTLS13,
+	}}}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Info   Connection
+		Fields map[string]map[string]interface{}
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	info := body.Info
+	assert.Equal(t, "tcp", info.Network)
+	assert.Equal(t, server.Listener.Addr().String(), info.LocalAddr)
+	assert.NotEmpty(t, info.RemoteAddr)
+	assert.Equal(t, "HTTP/2.0", info.Proto)
+	require.NotNil(t, info.TLS)
+	assert.Equal(t, "TLS 1.3", info.TLS.Version)
+	assert.NotEmpty(t, info.TLS.CipherSuite)
+	assert.Equal(t, "h2", info.TLS.NegotiatedProtocol)
+	assert.Equal(t, "localhost", info.TLS.ServerName)
+	assert.Equal(t, "CN=partner-gateway", info.TLS.ClientSubject)
+	assert.Equal(t, "CN=ca", info.TLS.ClientIssuer)
+	assert.NotEmpty(t, info.TLS.ClientSerial)
+	assert.NotNil(t, info.TLS.ClientNotAfter)
+	assert.Equal(t, verifyMode != "request", info.TLS.ClientVerified, "the certificate is not verified in the request mode")
+
+	fields := body.Fields["connection"]
+	assert.Equal(t, "TLS 1.3", fields["tlsVersion"])
+	assert.Equal(t, "CN=partner-gateway", fields["clientSubject"])
+	assert.Equal(t, "tcp", fields["network"])
+}
+
+func TestConnectionInfoPlainText(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	info := ConnectionInfo(c)
+	assert.Equal(t, Connection{RemoteAddr: "192.0.2.1:1234", Proto: "HTTP/1.1"}, info)
+
+	fields := map[string]interface{}{}
+	LogConnection(c, fields)
+	assert.Equal(t, map[string]interface{}{"remoteAddr": "192.0.2.1:1234", "proto": "HTTP/1.1"}, fields["connection"])
+
+	assert.Equal(t, "TLS 1.2", tlsVersionName(tls.VersionTLS12))
+	assert.Equal(t, "0x300", tlsVersionName(0x0300))
+}
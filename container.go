@@ -0,0 +1,90 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/retail-ai-inc/bean/di"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// TenantDB holds the databases of the tenant of a request, resolve it from the request scope of
+// `Bean.Container` instead of passing the global `DBConn` and the tenant around.
+// Example:
+//
+//	b.Container.Provide(func(db *bean.TenantDB) (repositories.OrderRepository, error) {
+//		conn, err := db.MySQL()
+//		if err != nil {
+//			return nil, err
+//		}
+//		return repositories.NewOrderRepository(conn), nil
+//	}, di.AsScoped())
+type TenantDB struct {
+	TenantID uint64
+	deps     *DBDeps
+}
+
+// MySQL returns the mysql connection of the tenant.
+func (t *TenantDB) MySQL() (*gorm.DB, error) {
+	return t.deps.MySQLConn(t.TenantID)
+}
+
+// Mongo returns the mongo database of the tenant.
+func (t *TenantDB) Mongo() (*mongo.Database, error) {
+	return t.deps.MongoConn(t.TenantID)
+}
+
+// Redis returns the redis connection of the tenant.
+func (t *TenantDB) Redis() (*dbdrivers.RedisDBConn, error) {
+	return t.deps.RedisConn(t.TenantID)
+}
+
+// newContainer returns the container providing the bean dependencies.
+func (b *Bean) newContainer() *di.Container {
+	container := di.New()
+	container.Supply(b)
+
+	_ = container.Provide(func() echo.Logger {
+		return b.Echo.Logger
+	})
+	// Lazily, because the databases are initialized by `InitDB` after `New`.
+	_ = container.Provide(func() (*DBDeps, error) {
+		if b.DBConn == nil {
+			return nil, errors.New("the databases are not initialized, call `InitDB`")
+		}
+		return b.DBConn, nil
+	})
+	_ = container.Provide(func(c echo.Context, deps *DBDeps) *TenantDB {
+		db := &TenantDB{deps: deps}
+		if b.TenantID != nil {
+			db.TenantID = b.TenantID(c)
+		}
+		return db
+	}, di.AsScoped())
+
+	return container
+}
@@ -0,0 +1,44 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/di"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBean_Container(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+	b.TenantID = func(c echo.Context) uint64 {
+		id, _ := strconv.ParseUint(c.Request().Header.Get("X-Tenant-ID"), 10, 64)
+		return id
+	}
+	b.Container = b.newContainer()
+	require.NoError(t, b.Container.Validate())
+	assert.Same(t, b, di.MustResolve[*Bean](b.Container))
+
+	// The databases are resolved lazily, once `InitDB` is called.
+	_, err := di.Resolve[*DBDeps](b.Container)
+	assert.Error(t, err)
+	b.DBConn = &DBDeps{}
+
+	b.Echo.Use(di.Middleware(b.Container))
+	b.Echo.GET("/orders", di.Handler(func(c echo.Context, db *TenantDB) error {
+		_, err := db.MySQL()
+		assert.Error(t, err)
+		return c.String(http.StatusOK, strconv.FormatUint(db.TenantID, 10))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("X-Tenant-ID", "7")
+	rec := httptest.NewRecorder()
+	b.Echo.ServeHTTP(rec, req)
+	assert.Equal(t, "7", rec.Body.String())
+}
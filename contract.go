@@ -0,0 +1,522 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// The request and response bodies bigger than this are not validated against the contract of the route.
+const maxContractBody = 1 << 20
+
+var (
+	contractViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "contract_violations_total",
+		Help:      "How many request and response bodies didn't conform to the contract of their route, partitioned by route and direction.",
+	}, []string{"method", "path", "direction"})
+
+	contractMetricsOnce sync.Once
+)
+
+var (
+	jsonMarshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType   = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	contractInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// ContractViolation is a field of a body not conforming to the contract of its route.
+type ContractViolation struct {
+	// Path of the field, like "data.items[2].price", empty for the whole body.
+	Path    string
+	Problem string
+}
+
+func (v ContractViolation) String() string {
+	if v.Path == "" {
+		return v.Problem
+	}
+	return v.Path + ": " + v.Problem
+}
+
+// Contract direction, the body checked by `ValidateContract`.
+const (
+	// ContractRequest checks the fields having a `validate:"required"` tag are present.
+	ContractRequest = "request"
+	// ContractResponse checks the fields without `omitempty` are present, as `encoding/json` always writes them.
+	ContractResponse = "response"
+)
+
+// WithContract validates the JSON request body and the successful JSON responses of the route against the
+// struct types of `request` and `response`, if `http.contracts.on` of `env.json` is true. It's a lighter
+// alternative to a full OpenAPI document to catch the contract drift before the clients do: the unknown
+// fields, the missing fields and the fields of the wrong type are logged with their path and counted by
+// the `bean_contract_violations_total` metric, the traffic itself is never changed. Every request is
+// checked outside of the production environments and `http.contracts.sampleRate` of them in production.
+// `request` or `response` may be nil to check only one direction. The typed routes have a contract of
+// their `Req` and `Resp` types by default. (see `Handle`)
+// Example:
+//
+//	b.POST("/products", hdlrs.productHdlr.Create, bean.WithContract(CreateProductRequest{}, response.TypedEnvelope[Product]{}))
+func WithContract(request, response interface{}) RouteOption {
+	return func(o *routeOptions) {
+		o.contract = &routeContract{request: contractType(request), response: contractType(response)}
+	}
+}
+
+type routeContract struct {
+	request  reflect.Type
+	response reflect.Type
+}
+
+func contractType(v interface{}) reflect.Type {
+	if v == nil {
+		return nil
+	}
+	return reflect.TypeOf(v)
+}
+
+// ValidateContract checks the JSON `body` against the type of `v` and returns the violations, sorted by path.
+// `direction` is `ContractRequest` or `ContractResponse`. It returns an error if `body` isn't JSON.
+func ValidateContract(v interface{}, body []byte, direction string) ([]ContractViolation, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	cv := &contractValidator{request: direction == ContractRequest}
+	cv.check("", reflect.TypeOf(v), value, false)
+
+	sort.SliceStable(cv.violations, func(i, j int) bool {
+		return cv.violations[i].Path < cv.violations[j].Path
+	})
+
+	return cv.violations, nil
+}
+
+type contractValidator struct {
+	request    bool
+	violations []ContractViolation
+}
+
+func (cv *contractValidator) add(path, format string, args ...interface{}) {
+	cv.violations = append(cv.violations, ContractViolation{Path: path, Problem: fmt.Sprintf(format, args...)})
+}
+
+// check checks `value` decoded by `encoding/json` against `t`, `quoted` is the `string` option of the field.
+func (cv *contractValidator) check(path string, t reflect.Type, value interface{}, quoted bool) {
+	if t == nil || t == contractInterfaceType {
+		return
+	}
+
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		default:
+			cv.add(path, "expected %s, got null", jsonKind(t))
+		}
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// IMPORTANT: the shape of a custom encoding is unknown, like `time.Time`.
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		cv.expect(path, t, value, isJSONString(value))
+		return
+	}
+
+	if quoted {
+		if s, ok := value.(string); ok {
+			if t.Kind() == reflect.String || t.Kind() == reflect.Bool {
+				return
+			}
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				value = json.Number(s)
+			}
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		_, ok := value.(bool)
+		cv.expect(path, t, value, ok)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(json.Number); ok && isJSONInteger(n) {
+			if _, err := strconv.ParseInt(n.String(), 10, t.Bits()); err != nil {
+				cv.add(path, "%s overflows %s", n, t.Kind())
+			}
+			return
+		}
+		cv.expect(path, t, value, false)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := value.(json.Number); ok && isJSONInteger(n) {
+			if _, err := strconv.ParseUint(n.String(), 10, t.Bits()); err != nil {
+				cv.add(path, "%s overflows %s", n, t.Kind())
+			}
+			return
+		}
+		cv.expect(path, t, value, false)
+	case reflect.Float32, reflect.Float64:
+		_, ok := value.(json.Number)
+		cv.expect(path, t, value, ok)
+	case reflect.String:
+		cv.expect(path, t, value, isJSONString(value))
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			cv.expect(path, t, value, isJSONString(value))
+			return
+		}
+		items, ok := value.([]interface{})
+		if !cv.expect(path, t, value, ok) {
+			return
+		}
+		for i, item := range items {
+			cv.check(fmt.Sprintf("%s[%d]", path, i), t.Elem(), item, false)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !cv.expect(path, t, value, ok) {
+			return
+		}
+		for key, item := range object {
+			cv.check(joinContractPath(path, key), t.Elem(), item, false)
+		}
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !cv.expect(path, t, value, ok) {
+			return
+		}
+		cv.checkStruct(path, t, object)
+	}
+}
+
+func (cv *contractValidator) checkStruct(path string, t reflect.Type, object map[string]interface{}) {
+	fields := contractFields(t)
+
+	for _, f := range fields {
+		value, ok := object[f.name]
+		if !ok {
+			if f.required(cv.request) {
+				cv.add(joinContractPath(path, f.name), "missing field")
+			}
+			continue
+		}
+		cv.check(joinContractPath(path, f.name), f.typ, value, f.quoted)
+	}
+
+	for key := range object {
+		if _, ok := fields[key]; !ok {
+			cv.add(joinContractPath(path, key), "unknown field")
+		}
+	}
+}
+
+// expect adds a violation if the value isn't `ok`, the JSON kind of `t`.
+func (cv *contractValidator) expect(path string, t reflect.Type, value interface{}, ok bool) bool {
+	if !ok {
+		cv.add(path, "expected %s, got %s", jsonKind(t), jsonValueKind(value))
+	}
+	return ok
+}
+
+type contractField struct {
+	name      string
+	typ       reflect.Type
+	omitEmpty bool
+	quoted    bool
+	validate  string
+}
+
+// required returns true if a request field is validated as `required`, or if a response field is always
+// written by `encoding/json`.
+func (f contractField) required(request bool) bool {
+	if request {
+		for _, rule := range strings.Split(f.validate, ",") {
+			if rule == "required" {
+				return true
+			}
+		}
+		return false
+	}
+	return !f.omitEmpty
+}
+
+// contractFields returns the JSON fields of the struct `t` by name, with the fields of the embedded structs
+// promoted like `encoding/json` does.
+func contractFields(t reflect.Type) map[string]contractField {
+	fields := map[string]contractField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, f := range contractFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = f
+					}
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = contractField{
+			name:      name,
+			typ:       sf.Type,
+			omitEmpty: hasTagOption(options, "omitempty"),
+			quoted:    hasTagOption(options, "string"),
+			validate:  sf.Tag.Get("validate"),
+		}
+	}
+
+	return fields
+}
+
+func hasTagOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func joinContractPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isJSONInteger returns true if the number has no fraction nor exponent, whatever its size.
+func isJSONInteger(n json.Number) bool {
+	return !strings.ContainsAny(n.String(), ".eE")
+}
+
+func isJSONString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+// jsonKind returns the JSON kind of the values of `t`.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// jsonValueKind returns the JSON kind of a value decoded by `encoding/json`.
+func jsonValueKind(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if isJSONInteger(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// contractMiddleware validates the bodies of the route `method` `path` against `contract`.
+func (b *Bean) contractMiddleware(method, path string, contract *routeContract) echo.MiddlewareFunc {
+	contractMetricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		contractViolations = helpers.RegisterCollector(prometheus.DefaultRegisterer, contractViolations)
+	})
+
+	production := b.Config.IsProduction()
+	sampleRate := b.Config.HTTP.Contracts.SampleRate
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if production && (sampleRate <= 0 || rand.Float64() >= sampleRate) {
+				return next(c)
+			}
+
+			req := c.Request()
+			if contract.request != nil && req.ContentLength != 0 && isJSONContentType(req.Header.Get(echo.HeaderContentType)) {
+				body, err := io.ReadAll(io.LimitReader(req.Body, maxContractBody+1))
+				req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+				if err == nil && len(body) <= maxContractBody {
+					logContractViolations(c, method, path, ContractRequest, contract.request, body)
+				}
+			}
+
+			if contract.response == nil {
+				return next(c)
+			}
+
+			res := c.Response()
+			recorder := &contractRecorder{ResponseWriter: res.Writer}
+			res.Writer = recorder
+			defer func() {
+				res.Writer = recorder.ResponseWriter
+			}()
+
+			err := next(c)
+
+			if res.Status >= 200 && res.Status < 300 && res.Status != http.StatusNoContent && !recorder.truncated &&
+				recorder.body.Len() > 0 && isJSONContentType(res.Header().Get(echo.HeaderContentType)) {
+				logContractViolations(c, method, path, ContractResponse, contract.response, recorder.body.Bytes())
+			}
+
+			return err
+		}
+	}
+}
+
+func logContractViolations(c echo.Context, method, path, direction string, t reflect.Type, body []byte) {
+	violations, err := ValidateContract(reflect.Zero(t).Interface(), body, direction)
+	if err != nil {
+		violations = []ContractViolation{{Problem: "invalid JSON: " + err.Error()}}
+	}
+	if len(violations) == 0 {
+		return
+	}
+
+	contractViolations.WithLabelValues(method, path, direction).Inc()
+
+	problems := make([]string, len(violations))
+	for i, v := range violations {
+		problems[i] = v.String()
+	}
+	c.Logger().Warnf("%s %s: the %s doesn't conform to %s: %s", method, path, direction, t, strings.Join(problems, "; "))
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == echo.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contractRecorder keeps a copy of the response body, up to `maxContractBody`.
+type contractRecorder struct {
+	http.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *contractRecorder) Write(p []byte) (int, error) {
+	if !r.truncated {
+		if r.body.Len()+len(p) > maxContractBody {
+			r.truncated = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *contractRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *contractRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,131 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type contractAudit struct {
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type contractItem struct {
+	SKU   string  `json:"sku"`
+	Price float64 `json:"price"`
+}
+
+type contractOrder struct {
+	contractAudit
+	ID     uint64            `json:"id"`
+	Items  []contractItem    `json:"items"`
+	Tags   map[string]int    `json:"tags,omitempty"`
+	Note   *string           `json:"note"`
+	Total  int64             `json:"total,string"`
+	Extras map[string]string `json:"-"`
+}
+
+type createContractOrderRequest struct {
+	ID    uint64 `param:"id" json:"-"`
+	Name  string `json:"name" validate:"required"`
+	Count int    `json:"count" validate:"min=0"`
+}
+
+func TestValidateContract(t *testing.T) {
+	violations, err := ValidateContract(contractOrder{}, []byte(`{
+		"createdAt": "2024-01-02T03:04:05Z",
+		"id": 1,
+		"items": [{"sku": "A", "price": 1.5}, {"sku": "B", "price": "2"}, {"price": 3}],
+		"tags": {"sale": 1, "new": "yes"},
+		"note": null,
+		"total": "10",
+		"discount": 5
+	}`), ContractResponse)
+	require.NoError(t, err)
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	assert.Equal(t, []string{
+		"discount: unknown field",
+		"items[1].price: expected number, got string",
+		"items[2].sku: missing field",
+		"tags.new: expected integer, got string",
+	}, got)
+
+	violations, err = ValidateContract(contractOrder{}, []byte(`{"id": -1, "items": null, "total": "x"}`), ContractResponse)
+	require.NoError(t, err)
+	require.Len(t, violations, 4)
+	assert.Equal(t, "createdAt: missing field", violations[0].String())
+	assert.Equal(t, "id: -1 overflows uint64", violations[1].String())
+	assert.Equal(t, "note: missing field", violations[2].String())
+	assert.Equal(t, "total: expected integer, got string", violations[3].String())
+
+	violations, err = ValidateContract(createContractOrderRequest{}, []byte(`{"count": 1}`), ContractRequest)
+	require.NoError(t, err)
+	assert.Equal(t, []ContractViolation{{Path: "name", Problem: "missing field"}}, violations)
+
+	_, err = ValidateContract(contractOrder{}, []byte(`{`), ContractResponse)
+	assert.Error(t, err)
+}
+
+func TestWithContract(t *testing.T) {
+	e := echo.New()
+	var logs bytes.Buffer
+	e.Logger.SetOutput(&logs)
+	e.Logger.SetLevel(log.WARN)
+	b := &Bean{Echo: e}
+	b.Config.HTTP.Contracts.On = true
+
+	POST(b, "/orders/:id", func(c echo.Context, req createContractOrderRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{"id": req.ID}, nil
+	})
+	b.GET("/orders", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, []map[string]interface{}{{"id": "1", "items": []interface{}{}, "createdAt": "", "note": nil, "total": "1"}})
+	}, WithContract(nil, []contractOrder{}))
+	b.GET("/missing", func(c echo.Context) error {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "not found"})
+	}, WithContract(nil, contractOrder{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader(`{"nmae": "typo"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, logs.String(), "POST /orders/:id: the request doesn't conform to bean.createContractOrderRequest: name: missing field; nmae: unknown field")
+	assert.NotContains(t, logs.String(), "the response doesn't conform")
+
+	logs.Reset()
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":"1"`)
+	assert.Contains(t, logs.String(), "GET /orders: the response doesn't conform to []bean.contractOrder: [0].id: expected integer, got string")
+
+	logs.Reset()
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, logs.String())
+
+	b.Config.Environment = "production"
+	logs.Reset()
+	b.GET("/sampled", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "oops")
+	}, WithContract(nil, contractOrder{}))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sampled", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, logs.String())
+}
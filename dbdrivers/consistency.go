@@ -0,0 +1,108 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type primaryReadKey struct{}
+
+// WithPrimaryRead returns a context which forces the reads to the primary instead of the read replicas,
+// so that a caller can read its own writes before the replicas catch up.
+func WithPrimaryRead(c context.Context) context.Context {
+	return context.WithValue(c, primaryReadKey{}, true)
+}
+
+// IsPrimaryRead reports whether the reads of the context must go to the primary. The redis helpers,
+// `SQLExecutor` and `MongoOps` follow it; the repositories routing their own reads should check it as well.
+func IsPrimaryRead(c context.Context) bool {
+	if c == nil {
+		return false
+	}
+
+	primary, _ := c.Value(primaryReadKey{}).(bool)
+	return primary
+}
+
+// RecentWriteTracker keeps a marker with a TTL in redis for every scope (example: a user or a tenant)
+// which has written recently. While the marker exists, the reads of the scope should go to the primary.
+// The TTL should be longer than the usual replication lag.
+type RecentWriteTracker struct {
+	conn   *RedisDBConn
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRecentWriteTracker returns a tracker storing the markers in `conn`. The default TTL is 5 seconds.
+func NewRecentWriteTracker(conn *RedisDBConn, ttl time.Duration) *RecentWriteTracker {
+	if ttl <= 0 {
+		ttl = 5 * time.Second
+	}
+
+	return &RecentWriteTracker{conn: conn, prefix: cachePrefix + "_rw_", ttl: ttl}
+}
+
+// MarkWrite records a write of the scope and extends the marker TTL.
+func (t *RecentWriteTracker) MarkWrite(c context.Context, scope string) error {
+	if err := t.conn.Client().Set(c, t.prefix+scope, 1, t.ttl).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// HasRecentWrite reports whether the scope has written within the TTL. The marker is always read from the
+// primary since a replica may not have it yet.
+func (t *RecentWriteTracker) HasRecentWrite(c context.Context, scope string) (bool, error) {
+	n, err := t.conn.Client().Exists(c, t.prefix+scope).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return n > 0, nil
+}
+
+// Context returns `WithPrimaryRead(c)` if the scope has written recently, otherwise `c`. If redis is not
+// reachable, the primary is used to stay on the safe side.
+func (t *RecentWriteTracker) Context(c context.Context, scope string) (context.Context, error) {
+	recent, err := t.HasRecentWrite(c, scope)
+	if err != nil || recent {
+		return WithPrimaryRead(c), err
+	}
+
+	return c, nil
+}
+
+// readReplicaCount returns the number of the read replicas which can serve the context, 0 if the reads
+// are forced to the primary.
+func (clients *RedisDBConn) readReplicaCount(c context.Context) int {
+	if IsPrimaryRead(c) {
+		return 0
+	}
+
+	return len(clients.Read)
+}
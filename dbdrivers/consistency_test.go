@@ -0,0 +1,126 @@
+package dbdrivers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPrimaryRead(t *testing.T) {
+	assert.False(t, IsPrimaryRead(nil))
+	assert.False(t, IsPrimaryRead(context.Background()))
+	assert.True(t, IsPrimaryRead(WithPrimaryRead(context.Background())))
+}
+
+func TestRecentWriteTracker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewRecentWriteTracker(&RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}, time.Second)
+	c := context.Background()
+
+	ctx, err := tracker.Context(c, "user:1")
+	require.NoError(t, err)
+	assert.False(t, IsPrimaryRead(ctx))
+
+	require.NoError(t, tracker.MarkWrite(c, "user:1"))
+	ctx, err = tracker.Context(c, "user:1")
+	require.NoError(t, err)
+	assert.True(t, IsPrimaryRead(ctx))
+
+	// The other scopes still read from the replicas.
+	recent, err := tracker.HasRecentWrite(c, "user:2")
+	require.NoError(t, err)
+	assert.False(t, recent)
+
+	mr.FastForward(time.Second)
+	recent, err = tracker.HasRecentWrite(c, "user:1")
+	require.NoError(t, err)
+	assert.False(t, recent)
+
+	// The primary is used if the markers can't be read.
+	mr.Close()
+	ctx, err = tracker.Context(c, "user:1")
+	assert.Error(t, err)
+	assert.True(t, IsPrimaryRead(ctx))
+}
+
+func TestRedisPrimaryRead(t *testing.T) {
+	primary, replica := miniredis.RunT(t), miniredis.RunT(t)
+	conn := &RedisDBConn{
+		Host: redis.NewClient(&redis.Options{Addr: primary.Addr()}),
+		Read: map[uint64]*redis.Client{0: redis.NewClient(&redis.Options{Addr: replica.Addr()})},
+	}
+	c := context.Background()
+	require.NoError(t, conn.Set(c, "key", "value", 0))
+	require.NoError(t, replica.Set("key", "stale"))
+
+	val, err := conn.Get(c, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "stale", val)
+
+	val, err = conn.Get(WithPrimaryRead(c), "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+}
+
+func TestSQLExecutorPrimaryRead(t *testing.T) {
+	open := func(name string) *gorm.DB {
+		db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+		require.NoError(t, err)
+		sqlDB, _ := db.DB()
+		t.Cleanup(func() { sqlDB.Close() })
+		require.NoError(t, db.AutoMigrate(&opsUser{}))
+		return db
+	}
+	primary, replica := open("consistency_primary"), open("consistency_replica")
+
+	c := context.Background()
+	sql := NewSQLExecutor(primary, replica)
+	require.NoError(t, sql.Create(c, &opsUser{ID: 1, Name: "alice"}))
+
+	// The replica hasn't caught up yet.
+	assert.ErrorIs(t, sql.First(c, &opsUser{}, 1), gorm.ErrRecordNotFound)
+
+	var user opsUser
+	require.NoError(t, sql.First(WithPrimaryRead(c), &user, 1))
+	assert.Equal(t, "alice", user.Name)
+
+	var users []opsUser
+	require.NoError(t, sql.Find(WithPrimaryRead(c), &users))
+	assert.Len(t, users, 1)
+	require.NoError(t, sql.Find(c, &users))
+	assert.Empty(t, users)
+}
+
+func TestMongoOpsPrimaryRead(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("read preference", func(mt *mtest.T) {
+		db := mt.Client.Database("app", options.Database().SetReadPreference(readpref.SecondaryPreferred()))
+		ops := NewMongoOps(db)
+
+		readPreference := func(c context.Context) string {
+			mt.ClearEvents()
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "app.users", mtest.FirstBatch))
+			var users []bson.M
+			require.NoError(mt, ops.Find(c, "users", bson.M{}, &users))
+
+			mode, _ := mt.GetStartedEvent().Command.Lookup("$readPreference", "mode").StringValueOK()
+			return mode
+		}
+
+		assert.Equal(mt, "secondaryPreferred", readPreference(context.Background()))
+		assert.NotEqual(mt, "secondaryPreferred", readPreference(WithPrimaryRead(context.Background())))
+	})
+}
@@ -0,0 +1,128 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/go-redis/redis/v8"
+	sqldriver "github.com/go-sql-driver/mysql"
+	"github.com/retail-ai-inc/bean/aes"
+	"github.com/retail-ai-inc/bean/secrets"
+)
+
+// watchSecret resolves a credential of the config, which may be a reference to a secret. (see `secrets`)
+func watchSecret(value string) *secrets.Value {
+	secret, err := secrets.Watch(context.Background(), value)
+	if err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+// resolveSecret resolves a credential of the config once, for the clients which can't change their
+// credentials.
+func resolveSecret(value string) string {
+	secret, err := secrets.Resolve(context.Background(), value)
+	if err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+// tenantPassword returns the password of the `TenantConnections`, which is either a reference to a secret
+// or encrypted by the pass phrase key if it's set.
+func tenantPassword(password, tenantDBPassPhraseKey string) *secrets.Value {
+	if secrets.IsRef(password) || tenantDBPassPhraseKey == "" {
+		return watchSecret(password)
+	}
+
+	password, err := aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
+	if err != nil {
+		panic(err)
+	}
+
+	return secrets.Static(password)
+}
+
+// credentialConnector opens the mysql connections with the current credentials, so that the new
+// connections use the rotated secrets.
+type credentialConnector struct {
+	cfg      *sqldriver.Config
+	user     *secrets.Value
+	password *secrets.Value
+}
+
+func (cc *credentialConnector) Connect(c context.Context) (driver.Conn, error) {
+	cfg := cc.cfg.Clone()
+	cfg.User = cc.user.Get()
+	cfg.Passwd = cc.password.Get()
+
+	connector, err := sqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return connector.Connect(c)
+}
+
+func (cc *credentialConnector) Driver() driver.Driver {
+	return sqldriver.MySQLDriver{}
+}
+
+// refreshMysqlOnRotation closes the idle connections when the credentials are rotated, the connections
+// in use are closed when they reach `maxConnectionLifeTime`.
+func refreshMysqlOnRotation(sqlDB *sql.DB, maxIdleConnections int, credentials ...*secrets.Value) {
+	for _, credential := range credentials {
+		credential.OnChange(func(string) {
+			sqlDB.SetMaxIdleConns(0)
+			sqlDB.SetMaxIdleConns(maxIdleConnections)
+		})
+	}
+}
+
+// redisAuth returns the password, the database and the `OnConnect` hook of the redis options. If the
+// password is rotating, the hook authenticates the new connections with the current password and selects
+// the database after, as the options can't change.
+func redisAuth(password *secrets.Value, db int) (string, int, func(c context.Context, cn *redis.Conn) error) {
+	if !password.Rotating() {
+		return password.Get(), db, nil
+	}
+
+	return "", 0, func(c context.Context, cn *redis.Conn) error {
+		_, err := cn.Pipelined(c, func(pipe redis.Pipeliner) error {
+			if current := password.Get(); current != "" {
+				pipe.Auth(c, current)
+			}
+			if db > 0 {
+				pipe.Select(c, db)
+			}
+			return nil
+		})
+		return err
+	}
+}
@@ -0,0 +1,44 @@
+package dbdrivers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/retail-ai-inc/bean/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisPasswordRotation(t *testing.T) {
+	c := context.Background()
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("v1")
+
+	current := "v1"
+	secrets.Register("dbdrivers-test", secrets.ProviderFunc(func(context.Context, string) (string, error) {
+		return current, nil
+	}))
+
+	password := watchSecret("secretRef://dbdrivers-test/redis")
+	client, _ := connectRedisDB(password, mr.Host(), mr.Port(), 2, 0, 1, 0, 0, 0, 0, 0)
+	defer client.Close()
+
+	// The connections authenticate with the password of the time they're opened.
+	current = "v2"
+	mr.RequireAuth("v2")
+	assert.NoError(t, secrets.Refresh(c))
+
+	assert.NoError(t, client.Set(c, "key", "value", 0).Err())
+	assert.True(t, mr.DB(2).Exists("key"))
+
+	static, _ := connectRedisDB(secrets.Static("v1"), mr.Host(), mr.Port(), 0, 0, 1, 0, 0, 0, 0, 0)
+	defer static.Close()
+	assert.Error(t, static.Ping(c).Err())
+}
+
+func TestTenantPassword(t *testing.T) {
+	t.Setenv("BEAN_TENANT_PASSWORD", "s3cret")
+
+	assert.Equal(t, "plain", tenantPassword("plain", "").Get())
+	assert.Equal(t, "s3cret", tenantPassword("secretRef://env/BEAN_TENANT_PASSWORD", "key").Get())
+}
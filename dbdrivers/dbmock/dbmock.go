@@ -0,0 +1,267 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package dbmock provides the testify mocks of the database interfaces of `dbdrivers`, to unit test the
+// repositories without any database.
+//
+//	sql := &dbmock.SQLExecutor{}
+//	sql.On("First", mock.Anything, mock.AnythingOfType("*models.User"), uint64(1)).Return(gorm.ErrRecordNotFound)
+//	repo := NewUserRepository(sql)
+package dbmock
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+var (
+	_ dbdrivers.SQLExecutor = (*SQLExecutor)(nil)
+	_ dbdrivers.MongoOps    = (*MongoOps)(nil)
+	_ dbdrivers.RedisOps    = (*RedisOps)(nil)
+	_ dbdrivers.KVStore     = (*KVStore)(nil)
+)
+
+// SQLExecutor is the mock of `dbdrivers.SQLExecutor`. `Transaction` calls its function with the mock itself,
+// so the calls in the transaction are expected on the same mock.
+type SQLExecutor struct {
+	mock.Mock
+}
+
+func (m *SQLExecutor) Create(c context.Context, value interface{}) error {
+	return m.Called(c, value).Error(0)
+}
+
+func (m *SQLExecutor) Save(c context.Context, value interface{}) error {
+	return m.Called(c, value).Error(0)
+}
+
+func (m *SQLExecutor) First(c context.Context, dest interface{}, conds ...interface{}) error {
+	return m.Called(append([]interface{}{c, dest}, conds...)...).Error(0)
+}
+
+func (m *SQLExecutor) Find(c context.Context, dest interface{}, conds ...interface{}) error {
+	return m.Called(append([]interface{}{c, dest}, conds...)...).Error(0)
+}
+
+func (m *SQLExecutor) Delete(c context.Context, value interface{}, conds ...interface{}) (int64, error) {
+	args := m.Called(append([]interface{}{c, value}, conds...)...)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+func (m *SQLExecutor) Exec(c context.Context, sql string, values ...interface{}) (int64, error) {
+	args := m.Called(append([]interface{}{c, sql}, values...)...)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+func (m *SQLExecutor) Raw(c context.Context, dest interface{}, sql string, values ...interface{}) error {
+	return m.Called(append([]interface{}{c, dest, sql}, values...)...).Error(0)
+}
+
+func (m *SQLExecutor) Transaction(c context.Context, fn func(tx dbdrivers.SQLExecutor) error) error {
+	if err := m.Called(c).Error(0); err != nil {
+		return err
+	}
+
+	return fn(m)
+}
+
+// DB returns the database of `On("DB")`, or nil if it's not expected.
+func (m *SQLExecutor) DB() *gorm.DB {
+	if !expected(&m.Mock, "DB") {
+		return nil
+	}
+	db, _ := m.Called().Get(0).(*gorm.DB)
+	return db
+}
+
+// MongoOps is the mock of `dbdrivers.MongoOps`.
+type MongoOps struct {
+	mock.Mock
+}
+
+func (m *MongoOps) FindOne(c context.Context, collection string, filter interface{}, dest interface{}) error {
+	return m.Called(c, collection, filter, dest).Error(0)
+}
+
+func (m *MongoOps) Find(c context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error {
+	args := []interface{}{c, collection, filter, dest}
+	for _, opt := range opts {
+		args = append(args, opt)
+	}
+	return m.Called(args...).Error(0)
+}
+
+func (m *MongoOps) InsertOne(c context.Context, collection string, document interface{}) (interface{}, error) {
+	args := m.Called(c, collection, document)
+	return args.Get(0), args.Error(1)
+}
+
+func (m *MongoOps) UpdateOne(c context.Context, collection string, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	args := m.Called(c, collection, filter, update)
+	result, _ := args.Get(0).(*mongo.UpdateResult)
+	return result, args.Error(1)
+}
+
+func (m *MongoOps) DeleteOne(c context.Context, collection string, filter interface{}) (int64, error) {
+	args := m.Called(c, collection, filter)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+func (m *MongoOps) DeleteMany(c context.Context, collection string, filter interface{}) (int64, error) {
+	args := m.Called(c, collection, filter)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+func (m *MongoOps) CountDocuments(c context.Context, collection string, filter interface{}) (int64, error) {
+	args := m.Called(c, collection, filter)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+func (m *MongoOps) Aggregate(c context.Context, collection string, pipeline interface{}, dest interface{}) error {
+	return m.Called(c, collection, pipeline, dest).Error(0)
+}
+
+// Database returns the database of `On("Database")`, or nil if it's not expected.
+func (m *MongoOps) Database() *mongo.Database {
+	if !expected(&m.Mock, "Database") {
+		return nil
+	}
+	db, _ := m.Called().Get(0).(*mongo.Database)
+	return db
+}
+
+// RedisOps is the mock of `dbdrivers.RedisOps`.
+type RedisOps struct {
+	mock.Mock
+}
+
+func (m *RedisOps) Get(c context.Context, key string) (string, error) {
+	args := m.Called(c, key)
+	return args.String(0), args.Error(1)
+}
+
+func (m *RedisOps) Set(c context.Context, key string, data interface{}, ttl time.Duration) error {
+	return m.Called(c, key, data, ttl).Error(0)
+}
+
+func (m *RedisOps) Exists(c context.Context, key string) (bool, error) {
+	args := m.Called(c, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *RedisOps) Del(c context.Context, keys ...string) error {
+	args := []interface{}{c}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return m.Called(args...).Error(0)
+}
+
+func (m *RedisOps) Expire(c context.Context, key string, ttl time.Duration) error {
+	return m.Called(c, key, ttl).Error(0)
+}
+
+func (m *RedisOps) GetJSON(c context.Context, key string, dst interface{}) (bool, error) {
+	args := m.Called(c, key, dst)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *RedisOps) SetJSON(c context.Context, key string, data interface{}, ttl time.Duration) error {
+	return m.Called(c, key, data, ttl).Error(0)
+}
+
+func (m *RedisOps) MGet(c context.Context, keys ...string) ([]interface{}, error) {
+	args := []interface{}{c}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	ret := m.Called(args...)
+	values, _ := ret.Get(0).([]interface{})
+	return values, ret.Error(1)
+}
+
+func (m *RedisOps) IncrWithExpiry(c context.Context, key string, value int64, ttl time.Duration) (int64, error) {
+	args := m.Called(c, key, value, ttl)
+	return int64Arg(args, 0), args.Error(1)
+}
+
+// Client returns the client of `On("Client")`, or nil if it's not expected.
+func (m *RedisOps) Client() redis.UniversalClient {
+	if !expected(&m.Mock, "Client") {
+		return nil
+	}
+	client, _ := m.Called().Get(0).(redis.UniversalClient)
+	return client
+}
+
+// KVStore is the mock of `dbdrivers.KVStore`.
+type KVStore struct {
+	mock.Mock
+}
+
+func (m *KVStore) Get(key string) ([]byte, error) {
+	args := m.Called(key)
+	val, _ := args.Get(0).([]byte)
+	return val, args.Error(1)
+}
+
+func (m *KVStore) Set(key string, val []byte, ttl time.Duration) error {
+	return m.Called(key, val, ttl).Error(0)
+}
+
+func (m *KVStore) Delete(key string) error {
+	return m.Called(key).Error(0)
+}
+
+func (m *KVStore) Close() error {
+	return m.Called().Error(0)
+}
+
+// int64Arg accepts the int literals of `Return`, `Return(1, nil)` as well as `Return(int64(1), nil)`.
+func int64Arg(args mock.Arguments, index int) int64 {
+	switch v := args.Get(index).(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// expected returns true if the method has an expectation, so that the accessors of the concrete clients
+// don't fail the tests which don't use them.
+func expected(m *mock.Mock, method string) bool {
+	for _, call := range m.ExpectedCalls {
+		if call.Method == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package dbmock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type user struct {
+	ID   uint64
+	Name string
+}
+
+// findName is a repository function written against the interfaces.
+func findName(c context.Context, sql dbdrivers.SQLExecutor, redis dbdrivers.RedisOps, id uint64) (string, error) {
+	name, err := redis.Get(c, "user")
+	if err != nil || name != "" {
+		return name, err
+	}
+
+	var u user
+	if err := sql.First(c, &u, id); err != nil {
+		return "", err
+	}
+
+	return u.Name, redis.Set(c, "user", u.Name, time.Minute)
+}
+
+func TestMocks(t *testing.T) {
+	c := context.Background()
+	sql := &SQLExecutor{}
+	redis := &RedisOps{}
+
+	redis.On("Get", c, "user").Return("", nil).Once()
+	sql.On("First", c, mock.AnythingOfType("*dbmock.user"), uint64(1)).
+		Run(func(args mock.Arguments) { args.Get(1).(*user).Name = "alice" }).
+		Return(nil)
+	redis.On("Set", c, "user", "alice", time.Minute).Return(nil)
+
+	name, err := findName(c, sql, redis, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", name)
+
+	sql.On("First", c, mock.Anything, uint64(2)).Return(gorm.ErrRecordNotFound)
+	redis.On("Get", c, "user").Return("", nil).Once()
+	_, err = findName(c, sql, redis, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	sql.AssertExpectations(t)
+	redis.AssertExpectations(t)
+	assert.Nil(t, sql.DB())
+}
+
+func TestSQLExecutorTransaction(t *testing.T) {
+	c := context.Background()
+	sql := &SQLExecutor{}
+	sql.On("Transaction", c).Return(nil)
+	sql.On("Exec", c, "DELETE FROM users WHERE id = ?", 1).Return(1, nil)
+
+	err := sql.Transaction(c, func(tx dbdrivers.SQLExecutor) error {
+		affected, err := tx.Exec(c, "DELETE FROM users WHERE id = ?", 1)
+		assert.Equal(t, int64(1), affected)
+		return err
+	})
+	assert.NoError(t, err)
+	sql.AssertExpectations(t)
+}
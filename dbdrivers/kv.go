@@ -0,0 +1,308 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrKVNotFound is returned by `KV.Get` if the key doesn't exist or has expired.
+var ErrKVNotFound = errors.New("kv: key not found")
+
+// KV is the local key value database of the process, backed by the engine of `MemoryConfig.Engine`.
+type KV interface {
+	Get(key string) ([]byte, error)
+	// Set saves the key forever if `ttl` is 0.
+	Set(key string, val []byte, ttl time.Duration) error
+	Delete(key string) error
+	Close() error
+}
+
+// KVOpener opens the local key value database of an engine.
+type KVOpener func(config MemoryConfig) (KV, error)
+
+var (
+	kvEnginesMu sync.RWMutex
+	kvEngines   = map[string]KVOpener{
+		"badger": openBadgerKV,
+		"bbolt":  openBoltKV,
+	}
+)
+
+// RegisterKVEngine adds an engine which can be selected by `MemoryConfig.Engine` (example: a pebble
+// database implementing `KV`), or replaces the builtin `badger` and `bbolt` engines.
+func RegisterKVEngine(name string, open KVOpener) {
+	kvEnginesMu.Lock()
+	defer kvEnginesMu.Unlock()
+
+	kvEngines[name] = open
+}
+
+// KVEngines returns the names of the registered engines.
+func KVEngines() []string {
+	kvEnginesMu.RLock()
+	defer kvEnginesMu.RUnlock()
+
+	names := make([]string, 0, len(kvEngines))
+	for name := range kvEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// memoryKV is a singleton local key value database.
+var memoryKV KV
+var memoryKVOnce sync.Once
+
+// InitMemoryKV opens the local key value database of the engine of the config, `badger` by default.
+func InitMemoryKV(config MemoryConfig) KV {
+	memoryKVOnce.Do(func() {
+		engine := config.Engine
+		if engine == "" {
+			engine = "badger"
+		}
+
+		kvEnginesMu.RLock()
+		open, ok := kvEngines[engine]
+		kvEnginesMu.RUnlock()
+
+		if !ok {
+			panic(errors.Errorf("kv: unknown engine %q, must be one of %v", engine, KVEngines()))
+		}
+
+		var err error
+		memoryKV, err = open(config)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	return memoryKV
+}
+
+// BadgerKV is the `KV` of a badger database.
+type BadgerKV struct {
+	DB *badger.DB
+}
+
+func openBadgerKV(config MemoryConfig) (KV, error) {
+	return &BadgerKV{DB: connectMemoryDB(config)}, nil
+}
+
+// Get implements `KV`.
+func (kv *BadgerKV) Get(key string) ([]byte, error) {
+	var data []byte
+
+	err := kv.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrKVNotFound
+	}
+
+	return data, errors.WithStack(err)
+}
+
+// Set implements `KV`.
+func (kv *BadgerKV) Set(key string, val []byte, ttl time.Duration) error {
+	return errors.WithStack(MemorySetBytes(kv.DB, key, val, ttl))
+}
+
+// Delete implements `KV`.
+func (kv *BadgerKV) Delete(key string) error {
+	return MemoryDelKey(kv.DB, key)
+}
+
+// Close implements `KV`.
+func (kv *BadgerKV) Close() error {
+	return kv.DB.Close()
+}
+
+// boltBucket is the bucket of the keys in the bbolt database.
+var boltBucket = []byte("bean")
+
+// boltSweepInterval is the interval between two deletions of the expired keys of the bbolt database.
+var boltSweepInterval = time.Minute
+
+// BoltKV is the `KV` of a bbolt database. The value of each key is prefixed by its expiration time in unix
+// nanoseconds, 0 if the key never expires. The expired keys are not returned and deleted every minute.
+type BoltKV struct {
+	DB   *bolt.DB
+	path string
+	temp bool
+	stop chan struct{}
+	once sync.Once
+}
+
+// openBoltKV opens the `bean.db` file of `config.Dir`. bbolt has no in-memory mode so a temporary file,
+// removed by `Close`, is used if the directory is empty.
+func openBoltKV(config MemoryConfig) (KV, error) {
+	path := filepath.Join(config.Dir, "bean.db")
+	temp := config.Dir == ""
+
+	if temp {
+		f, err := os.CreateTemp("", "bean-*.db")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		path = f.Name()
+		f.Close()
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	kv := &BoltKV{DB: db, path: path, temp: temp, stop: make(chan struct{})}
+	go kv.sweep()
+
+	return kv, nil
+}
+
+// Get implements `KV`.
+func (kv *BoltKV) Get(key string) ([]byte, error) {
+	var data []byte
+
+	err := kv.DB.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(boltBucket).Get([]byte(key))
+		if val == nil || boltExpired(val, time.Now()) {
+			return ErrKVNotFound
+		}
+
+		data = append([]byte{}, val[8:]...)
+		return nil
+	})
+	if errors.Is(err, ErrKVNotFound) {
+		return nil, ErrKVNotFound
+	}
+
+	return data, errors.WithStack(err)
+}
+
+// Set implements `KV`.
+func (kv *BoltKV) Set(key string, val []byte, ttl time.Duration) error {
+	data := make([]byte, 8+len(val))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(data, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(data[8:], val)
+
+	err := kv.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), data)
+	})
+
+	return errors.WithStack(err)
+}
+
+// Delete implements `KV`.
+func (kv *BoltKV) Delete(key string) error {
+	err := kv.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+
+	return errors.WithStack(err)
+}
+
+// Close implements `KV`.
+func (kv *BoltKV) Close() error {
+	kv.once.Do(func() { close(kv.stop) })
+
+	err := kv.DB.Close()
+	if kv.temp {
+		os.Remove(kv.path)
+	}
+
+	return errors.WithStack(err)
+}
+
+func (kv *BoltKV) sweep() {
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-kv.stop:
+			return
+		case <-ticker.C:
+			_ = kv.deleteExpired(time.Now())
+		}
+	}
+}
+
+// deleteExpired deletes the keys expired at `now`.
+func (kv *BoltKV) deleteExpired(now time.Time) error {
+	return kv.DB.Update(func(tx *bolt.Tx) error {
+		var expired [][]byte
+
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if boltExpired(v, now) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+		}
+
+		for _, k := range expired {
+			if err := tx.Bucket(boltBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func boltExpired(val []byte, now time.Time) bool {
+	if len(val) < 8 {
+		return true
+	}
+
+	expiresAt := binary.BigEndian.Uint64(val)
+	return expiresAt != 0 && int64(expiresAt) <= now.UnixNano()
+}
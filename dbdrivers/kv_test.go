@@ -0,0 +1,70 @@
+package dbdrivers
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+)
+
+func TestBoltKV(t *testing.T) {
+	kv, err := openBoltKV(MemoryConfig{Dir: t.TempDir()})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer kv.Close()
+
+	_, err = kv.Get("missing")
+	assert.ErrorIs(t, err, ErrKVNotFound)
+
+	assert.NoError(t, kv.Set("forever", []byte("value"), 0))
+	assert.NoError(t, kv.Set("expiring", []byte("value"), time.Millisecond))
+
+	val, err := kv.Get("forever")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), val)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = kv.Get("expiring")
+	assert.ErrorIs(t, err, ErrKVNotFound)
+
+	bolt := kv.(*BoltKV)
+	assert.NoError(t, bolt.deleteExpired(time.Now()))
+	_ = bolt.DB.View(func(tx *bbolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket(boltBucket).Stats().KeyN)
+		return nil
+	})
+
+	assert.NoError(t, kv.Delete("forever"))
+	_, err = kv.Get("forever")
+	assert.ErrorIs(t, err, ErrKVNotFound)
+}
+
+func TestBoltKVTemporaryFile(t *testing.T) {
+	kv, err := openBoltKV(MemoryConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	path := kv.(*BoltKV).DB.Path()
+	assert.FileExists(t, path)
+
+	assert.NoError(t, kv.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRegisterKVEngine(t *testing.T) {
+	RegisterKVEngine("test", func(config MemoryConfig) (KV, error) {
+		return openBoltKV(config)
+	})
+	defer func() {
+		kvEnginesMu.Lock()
+		delete(kvEngines, "test")
+		kvEnginesMu.Unlock()
+	}()
+
+	assert.Equal(t, []string{"badger", "bbolt", "test"}, KVEngines())
+}
@@ -31,8 +31,12 @@ import (
 )
 
 type MemoryConfig struct {
-	On        bool
-	Dir       string
+	On  bool
+	Dir string
+	// Engine of the local key value database, `badger`, `bbolt` or an engine added by `RegisterKVEngine`.
+	// bbolt needs far less memory than badger but writes to a file in `Dir`.
+	// Optional. Default value "badger".
+	Engine    string
 	DelKeyAPI struct {
 		EndPoint        string
 		AuthBearerToken string
@@ -25,15 +25,20 @@ package dbdrivers
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/retail-ai-inc/bean/aes"
+	"github.com/retail-ai-inc/bean/secrets"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gorm.io/gorm"
 )
 
 type MongoConfig struct {
+	// The `Username` and `Password` can be references to secrets. (see `secrets`) They are resolved once when
+	// connecting, as the credentials of a mongo client can't change, a rotation takes effect on restart.
 	Master *struct {
 		Database string
 		Username string
@@ -44,8 +49,15 @@ type MongoConfig struct {
 	ConnectTimeout        time.Duration
 	MaxConnectionPoolSize uint64
 	MaxConnectionLifeTime time.Duration
+	// SyncIndexes creates the registered collections and indexes (see `RegisterMongoCollection`)
+	// on master and all tenant databases during `InitDB`.
+	SyncIndexes bool
 }
 
+// MongoPoolMonitor returns the pool monitor of a connection, `tenant` is the tenant ID or "master".
+// It must be set before the connections are initialized. (`bean` sets it when prometheus is on)
+var MongoPoolMonitor func(tenant string) *event.PoolMonitor
+
 // Init the mongo database connection map.
 func InitMongoTenantConns(config MongoConfig, master *gorm.DB, tenantAlterDbHostParam, tenantDBPassPhraseKey string) (map[uint64]*mongo.Client, map[uint64]string) {
 
@@ -58,7 +70,7 @@ func InitMongoMasterConn(config MongoConfig) (*mongo.Client, string) {
 
 	masterCfg := config.Master
 	if masterCfg != nil && masterCfg.Database != "" {
-		return connectMongoDB(masterCfg.Username, masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
+		return connectMongoDB("master", resolveSecret(masterCfg.Username), resolveSecret(masterCfg.Password), masterCfg.Host, masterCfg.Port, masterCfg.Database,
 			config.MaxConnectionPoolSize, config.ConnectTimeout, config.MaxConnectionLifeTime)
 	}
 
@@ -82,11 +94,14 @@ func getAllMongoTenantDB(config MongoConfig, tenantCfgs []*TenantConnections, te
 
 		// IMPORTANT: Check the `mongodb` object exist in the Connections column or not.
 		if mongoCfg, ok := cfgsMap["mongodb"]; ok {
-			userName := mongoCfg["username"].(string)
+			mongoCfg = tenantConfig(t.TenantID, mongoCfg)
+			userName := resolveSecret(mongoCfg["username"].(string))
 			password := mongoCfg["password"].(string)
 
 			// IMPORTANT: If tenant database password is encrypted in master db config.
-			if tenantDBPassPhraseKey != "" {
+			if secrets.IsRef(password) {
+				password = resolveSecret(password)
+			} else if tenantDBPassPhraseKey != "" {
 				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
 				if err != nil {
 					panic(err)
@@ -106,7 +121,7 @@ func getAllMongoTenantDB(config MongoConfig, tenantCfgs []*TenantConnections, te
 			dbName := mongoCfg["database"].(string)
 
 			mongoConns[t.TenantID], mongoDBNames[t.TenantID] = connectMongoDB(
-				userName, password, host, port, dbName, config.MaxConnectionPoolSize,
+				strconv.FormatUint(t.TenantID, 10), userName, password, host, port, dbName, config.MaxConnectionPoolSize,
 				config.ConnectTimeout, config.MaxConnectionLifeTime)
 
 		} else {
@@ -117,7 +132,7 @@ func getAllMongoTenantDB(config MongoConfig, tenantCfgs []*TenantConnections, te
 	return mongoConns, mongoDBNames
 }
 
-func connectMongoDB(userName, password, host, port, dbName string, maxConnectionPoolSize uint64,
+func connectMongoDB(tenant, userName, password, host, port, dbName string, maxConnectionPoolSize uint64,
 	connectTimeout, maxConnectionLifeTime time.Duration) (*mongo.Client, string) {
 
 	connStr := "mongodb://" + host + ":" + port
@@ -131,6 +146,10 @@ func connectMongoDB(userName, password, host, port, dbName string, maxConnection
 		SetMaxPoolSize(maxConnectionPoolSize).
 		SetMaxConnIdleTime(maxConnectionLifeTime)
 
+	if MongoPoolMonitor != nil {
+		opts.SetPoolMonitor(MongoPoolMonitor(tenant))
+	}
+
 	if userName != "" && password != "" {
 		credential := options.Credential{Username: userName, Password: password, AuthSource: dbName}
 		opts.SetAuth(credential)
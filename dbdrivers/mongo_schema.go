@@ -0,0 +1,312 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoIndex declares an index of a collection. If `Name` is empty then the default mongo name is
+// used (example: `tenant_id_1_created_at_-1`).
+type MongoIndex struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	Sparse bool
+	// ExpireAfterSeconds makes a TTL index. Keep it nil for a regular index.
+	ExpireAfterSeconds      *int32
+	PartialFilterExpression interface{}
+}
+
+// MongoCollection declares a collection, it's validator and indexes.
+type MongoCollection struct {
+	Name string
+	// Validator is the document validator. (example: `bson.M{"$jsonSchema": ...}`)
+	Validator interface{}
+	// ValidationLevel is `strict` (mongo default) or `moderate`.
+	ValidationLevel string
+	// ValidationAction is `error` (mongo default) or `warn`.
+	ValidationAction string
+	Indexes          []MongoIndex
+}
+
+// MongoSyncAction describes a change which has been (or would be in dry-run) applied by `SyncMongoCollections`.
+type MongoSyncAction struct {
+	Database   string
+	Collection string
+	// Kind is one of `create_collection`, `update_validator`, `create_index` or `conflict`.
+	Kind   string
+	Index  string
+	Detail string
+}
+
+func (a MongoSyncAction) String() string {
+	s := a.Kind + " " + a.Database + "." + a.Collection
+	if a.Index != "" {
+		s += " index " + a.Index
+	}
+	if a.Detail != "" {
+		s += " (" + a.Detail + ")"
+	}
+	return s
+}
+
+// MongoSyncOptions defines the options of `SyncMongoCollections`.
+type MongoSyncOptions struct {
+	// DryRun only reports the actions without changing anything.
+	DryRun bool
+	// Logf is called for every action. Optional.
+	Logf func(format string, args ...interface{})
+}
+
+var (
+	mongoCollections   = make(map[string]MongoCollection)
+	mongoCollectionsMu sync.RWMutex
+)
+
+// RegisterMongoCollection declares a collection to be synchronized by `SyncMongoCollections`.
+// It's usually called from an `init` function of the repository package.
+func RegisterMongoCollection(collection MongoCollection) error {
+	mongoCollectionsMu.Lock()
+	defer mongoCollectionsMu.Unlock()
+
+	if collection.Name == "" {
+		return errors.New("mongo collection name is empty")
+	}
+
+	if _, ok := mongoCollections[collection.Name]; ok {
+		return errors.Errorf("mongo collection `%s` is already registered", collection.Name)
+	}
+
+	mongoCollections[collection.Name] = collection
+
+	return nil
+}
+
+// RegisteredMongoCollections returns the registered collections ordered by name.
+func RegisteredMongoCollections() []MongoCollection {
+	mongoCollectionsMu.RLock()
+	defer mongoCollectionsMu.RUnlock()
+
+	collections := make([]MongoCollection, 0, len(mongoCollections))
+	for _, col := range mongoCollections {
+		collections = append(collections, col)
+	}
+
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Name < collections[j].Name
+	})
+
+	return collections
+}
+
+// SyncMongoCollections makes sure that every registered collection, validator and index exist in the
+// database `dbName`. Existing indexes with the same name but a different definition are never dropped,
+// they are reported as a `conflict` action instead.
+func SyncMongoCollections(c context.Context, client *mongo.Client, dbName string, opts MongoSyncOptions) ([]MongoSyncAction, error) {
+	if client == nil || dbName == "" {
+		return nil, nil
+	}
+
+	db := client.Database(dbName)
+
+	existing, err := db.ListCollectionNames(c, bson.D{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	existingSet := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		existingSet[name] = true
+	}
+
+	var actions []MongoSyncAction
+
+	report := func(action MongoSyncAction) {
+		actions = append(actions, action)
+		if opts.Logf != nil {
+			prefix := ""
+			if opts.DryRun {
+				prefix = "[dry-run] "
+			}
+			opts.Logf("mongo sync: %s%s", prefix, action)
+		}
+	}
+
+	for _, col := range RegisteredMongoCollections() {
+		if !existingSet[col.Name] {
+			report(MongoSyncAction{Database: dbName, Collection: col.Name, Kind: "create_collection"})
+
+			if !opts.DryRun {
+				createOpts := options.CreateCollection()
+				if col.Validator != nil {
+					createOpts.SetValidator(col.Validator)
+				}
+				if col.ValidationLevel != "" {
+					createOpts.SetValidationLevel(col.ValidationLevel)
+				}
+				if col.ValidationAction != "" {
+					createOpts.SetValidationAction(col.ValidationAction)
+				}
+
+				if err := db.CreateCollection(c, col.Name, createOpts); err != nil {
+					return actions, errors.WithStack(err)
+				}
+			}
+		} else if col.Validator != nil {
+			// IMPORTANT: `collMod` is idempotent, so the validator is always applied for existing collections.
+			report(MongoSyncAction{Database: dbName, Collection: col.Name, Kind: "update_validator"})
+
+			if !opts.DryRun {
+				cmd := bson.D{{Key: "collMod", Value: col.Name}, {Key: "validator", Value: col.Validator}}
+				if col.ValidationLevel != "" {
+					cmd = append(cmd, bson.E{Key: "validationLevel", Value: col.ValidationLevel})
+				}
+				if col.ValidationAction != "" {
+					cmd = append(cmd, bson.E{Key: "validationAction", Value: col.ValidationAction})
+				}
+
+				if err := db.RunCommand(c, cmd).Err(); err != nil {
+					return actions, errors.WithStack(err)
+				}
+			}
+		}
+
+		if len(col.Indexes) == 0 {
+			continue
+		}
+
+		current := map[string]bson.M{}
+		if existingSet[col.Name] {
+			cursor, err := db.Collection(col.Name).Indexes().List(c)
+			if err != nil {
+				return actions, errors.WithStack(err)
+			}
+
+			var specs []bson.M
+			if err := cursor.All(c, &specs); err != nil {
+				return actions, errors.WithStack(err)
+			}
+
+			for _, spec := range specs {
+				if name, ok := spec["name"].(string); ok {
+					current[name] = spec
+				}
+			}
+		}
+
+		var models []mongo.IndexModel
+		for _, index := range col.Indexes {
+			name := index.Name
+			if name == "" {
+				name = mongoIndexName(index.Keys)
+			}
+
+			if spec, ok := current[name]; ok {
+				if diff := diffMongoIndex(index, spec); diff != "" {
+					report(MongoSyncAction{Database: dbName, Collection: col.Name, Kind: "conflict", Index: name, Detail: diff})
+				}
+				continue
+			}
+
+			report(MongoSyncAction{Database: dbName, Collection: col.Name, Kind: "create_index", Index: name})
+
+			indexOpts := options.Index().SetName(name)
+			if index.Unique {
+				indexOpts.SetUnique(true)
+			}
+			if index.Sparse {
+				indexOpts.SetSparse(true)
+			}
+			if index.ExpireAfterSeconds != nil {
+				indexOpts.SetExpireAfterSeconds(*index.ExpireAfterSeconds)
+			}
+			if index.PartialFilterExpression != nil {
+				indexOpts.SetPartialFilterExpression(index.PartialFilterExpression)
+			}
+
+			models = append(models, mongo.IndexModel{Keys: index.Keys, Options: indexOpts})
+		}
+
+		if len(models) > 0 && !opts.DryRun {
+			if _, err := db.Collection(col.Name).Indexes().CreateMany(c, models); err != nil {
+				return actions, errors.WithStack(err)
+			}
+		}
+	}
+
+	return actions, nil
+}
+
+// mongoIndexName returns the same default name as the mongo server.
+func mongoIndexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// diffMongoIndex compares the declared index with the spec returned by `listIndexes`.
+func diffMongoIndex(index MongoIndex, spec bson.M) string {
+	var diffs []string
+
+	if key, ok := spec["key"].(bson.M); ok {
+		want := make(map[string]string, len(index.Keys))
+		for _, k := range index.Keys {
+			want[k.Key] = fmt.Sprint(k.Value)
+		}
+
+		got := make(map[string]string, len(key))
+		for k, v := range key {
+			got[k] = fmt.Sprint(v)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			diffs = append(diffs, "keys")
+		}
+	}
+
+	if unique, _ := spec["unique"].(bool); unique != index.Unique {
+		diffs = append(diffs, "unique")
+	}
+
+	ttl, hasTTL := spec["expireAfterSeconds"]
+	if hasTTL != (index.ExpireAfterSeconds != nil) ||
+		(hasTTL && fmt.Sprint(ttl) != fmt.Sprint(*index.ExpireAfterSeconds)) {
+		diffs = append(diffs, "expireAfterSeconds")
+	}
+
+	return strings.Join(diffs, ", ")
+}
@@ -0,0 +1,134 @@
+package dbdrivers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMongoIndexName(t *testing.T) {
+	tests := []struct {
+		keys bson.D
+		want string
+	}{
+		{bson.D{{Key: "email", Value: 1}}, "email_1"},
+		{bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}, "tenant_id_1_created_at_-1"},
+		{bson.D{{Key: "title", Value: "text"}}, "title_text"},
+		{bson.D{{Key: "location", Value: "2dsphere"}}, "location_2dsphere"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mongoIndexName(tt.keys))
+	}
+}
+
+func TestDiffMongoIndex(t *testing.T) {
+	ttl := int32(3600)
+	otherTTL := int32(60)
+
+	tests := []struct {
+		name  string
+		index MongoIndex
+		spec  bson.M
+		want  string
+	}{
+		{
+			name:  "same",
+			index: MongoIndex{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+			spec:  bson.M{"key": bson.M{"email": int32(1)}, "unique": true},
+			want:  "",
+		},
+		{
+			name:  "keys",
+			index: MongoIndex{Keys: bson.D{{Key: "email", Value: 1}}},
+			spec:  bson.M{"key": bson.M{"email": int32(-1)}},
+			want:  "keys",
+		},
+		{
+			name:  "unique",
+			index: MongoIndex{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+			spec:  bson.M{"key": bson.M{"email": int32(1)}},
+			want:  "unique",
+		},
+		{
+			name:  "ttl added",
+			index: MongoIndex{Keys: bson.D{{Key: "expires_at", Value: 1}}, ExpireAfterSeconds: &ttl},
+			spec:  bson.M{"key": bson.M{"expires_at": int32(1)}},
+			want:  "expireAfterSeconds",
+		},
+		{
+			name:  "ttl changed",
+			index: MongoIndex{Keys: bson.D{{Key: "expires_at", Value: 1}}, ExpireAfterSeconds: &otherTTL},
+			spec:  bson.M{"key": bson.M{"expires_at": int32(1)}, "expireAfterSeconds": int32(3600)},
+			want:  "expireAfterSeconds",
+		},
+		{
+			name:  "all",
+			index: MongoIndex{Keys: bson.D{{Key: "a", Value: 1}}, Unique: true},
+			spec:  bson.M{"key": bson.M{"b": int32(1)}, "expireAfterSeconds": int32(3600)},
+			want:  "keys, unique, expireAfterSeconds",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, diffMongoIndex(tt.index, tt.spec), tt.name)
+	}
+}
+
+func TestSyncMongoCollectionsDryRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	require.NoError(t, RegisterMongoCollection(MongoCollection{
+		Name:    "orders",
+		Indexes: []MongoIndex{{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}}},
+	}))
+	require.NoError(t, RegisterMongoCollection(MongoCollection{
+		Name: "users",
+		Indexes: []MongoIndex{
+			{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+			{Name: "by_name", Keys: bson.D{{Key: "name", Value: 1}}},
+		},
+	}))
+	defer func() {
+		mongoCollectionsMu.Lock()
+		delete(mongoCollections, "orders")
+		delete(mongoCollections, "users")
+		mongoCollectionsMu.Unlock()
+	}()
+
+	// The mock deployment only answers the listings, a write would fail.
+	mt.Run("dry-run", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "app.$cmd.listCollections", mtest.FirstBatch, bson.D{{Key: "name", Value: "users"}}),
+			mtest.CreateCursorResponse(0, "app.users", mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "email_1"}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}},
+			),
+		)
+
+		var logs []string
+		actions, err := SyncMongoCollections(context.Background(), mt.Client, "app", MongoSyncOptions{
+			DryRun: true,
+			Logf: func(format string, args ...interface{}) {
+				logs = append(logs, format)
+			},
+		})
+		require.NoError(t, err)
+
+		var got []string
+		for _, action := range actions {
+			got = append(got, action.String())
+		}
+		assert.Equal(t, []string{
+			"create_collection app.orders",
+			"create_index app.orders index tenant_id_1_created_at_-1",
+			"conflict app.users index email_1 (unique)",
+			"create_index app.users index by_name",
+		}, got)
+		assert.Len(t, logs, 4)
+	})
+}
@@ -23,11 +23,15 @@
 package dbdrivers
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/retail-ai-inc/bean/aes"
+	sqldriver "github.com/go-sql-driver/mysql"
+	"github.com/retail-ai-inc/bean/secrets"
 	"gorm.io/datatypes"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -35,6 +39,8 @@ import (
 )
 
 type SQLConfig struct {
+	// The `Username` and `Password` can be references to secrets. (see `secrets`) The new connections use the
+	// rotated secrets and the idle connections are closed on rotation.
 	Master *struct {
 		Database string
 		Username string
@@ -42,6 +48,9 @@ type SQLConfig struct {
 		Host     string
 		Port     string
 	}
+	// Regions are the endpoints of the master database per region, which replace `Master.Host` and
+	// `Master.Port`. (see `RegionConfig`)
+	Regions                   map[string]SQLEndpoint
 	MaxIdleConnections        int
 	MaxOpenConnections        int
 	MaxConnectionLifeTime     time.Duration
@@ -49,6 +58,12 @@ type SQLConfig struct {
 	Debug                     bool
 }
 
+// SQLEndpoint is the address of a database in a region.
+type SQLEndpoint struct {
+	Host string
+	Port string
+}
+
 // TenantConnections represent a tenant database configuration record in master database
 type TenantConnections struct {
 	ID          uint64         `gorm:"primary_key;AUTO_INCREMENT;column:Id"`
@@ -74,8 +89,13 @@ func InitMysqlMasterConn(config SQLConfig) (*gorm.DB, string) {
 	masterCfg := config.Master
 
 	if masterCfg != nil && masterCfg.Database != "" {
+		user, password := watchSecret(masterCfg.Username), watchSecret(masterCfg.Password)
+		if len(config.Regions) > 0 {
+			return connectMysqlRegions(config, user, password)
+		}
+
 		return connectMysqlDB(
-			masterCfg.Username, masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
+			user, password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
 			config.MaxIdleConnections, config.MaxOpenConnections, config.MaxConnectionLifeTime, config.MaxIdleConnectionLifeTime,
 			config.Debug,
 		)
@@ -106,6 +126,8 @@ func GetAllTenantCfgs(db *gorm.DB) []*TenantConnections {
 		panic(err)
 	}
 
+	loadResidencies(tt)
+
 	// TODO: save the config in memory
 
 	return tt
@@ -130,16 +152,11 @@ func getAllMysqlTenantDB(config SQLConfig, tenantCfgs []*TenantConnections,
 
 		// IMPORTANT: Check the `mysql` object exist in the Connections column or not.
 		if mysqlCfg, ok := cfgsMap["mysql"]; ok {
-			userName := mysqlCfg["username"].(string)
-			password := mysqlCfg["password"].(string)
+			mysqlCfg = tenantConfig(t.TenantID, mysqlCfg)
+			userName := watchSecret(mysqlCfg["username"].(string))
 
 			// IMPORTANT: If tenant database password is encrypted in master db config.
-			if tenantDBPassPhraseKey != "" {
-				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
-				if err != nil {
-					panic(err)
-				}
-			}
+			password := tenantPassword(mysqlCfg["password"].(string), tenantDBPassPhraseKey)
 
 			host := mysqlCfg["host"].(string)
 
@@ -167,25 +184,31 @@ func getAllMysqlTenantDB(config SQLConfig, tenantCfgs []*TenantConnections,
 	return mysqlConns, mysqlDBNames
 }
 
-func connectMysqlDB(userName, password, host, port, dbName string,
+// connectMysqlDB connects to a database, the connections are opened with the current credentials if they
+// are rotating secrets.
+func connectMysqlDB(user, password *secrets.Value, host, port, dbName string,
 	maxIdleConnections, maxOpenConnections int, maxConnectionLifeTime, maxIdleConnectionLifeTime time.Duration,
 	debug bool) (*gorm.DB, string) {
 
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?parseTime=true&multiStatements=true",
-		userName, password, host, port, dbName,
-	)
-
 	var db *gorm.DB
-	var err error
-
-	if debug {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
+	if user.Rotating() || password.Rotating() {
+		cfg := sqldriver.NewConfig()
+		cfg.Net = "tcp"
+		cfg.Addr = host + ":" + port
+		cfg.DBName = dbName
+		cfg.ParseTime = true
+		cfg.MultiStatements = true
+
+		sqlDB := sql.OpenDB(&credentialConnector{cfg: cfg, user: user, password: password})
+		refreshMysqlOnRotation(sqlDB, maxIdleConnections, user, password)
+		db = openMysqlDB(mysql.New(mysql.Config{Conn: sqlDB}), debug)
 	} else {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
-	}
-	if err != nil {
-		panic(err)
+		dsn := fmt.Sprintf(
+			"%s:%s@tcp(%s:%s)/%s?parseTime=true&multiStatements=true",
+			user.Get(), password.Get(), host, port, dbName,
+		)
+
+		db = openMysqlDB(mysql.Open(dsn), debug)
 	}
 
 	sqlDB, err := db.DB()
@@ -207,6 +230,94 @@ func connectMysqlDB(userName, password, host, port, dbName string,
 	return db, dbName
 }
 
+func openMysqlDB(dialector gorm.Dialector, debug bool) *gorm.DB {
+	var db *gorm.DB
+	var err error
+
+	if debug {
+		db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
+	} else {
+		db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if err := db.Use(RequestIDPlugin{}); err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+// connectMysqlRegions connects to the master database of the nearest healthy region. The connections are
+// opened to the active region of the `RegionSelector`, so the pool moves to another region on failover.
+func connectMysqlRegions(config SQLConfig, user, password *secrets.Value) (*gorm.DB, string) {
+	masterCfg := config.Master
+
+	connectors := make(map[string]driver.Connector, len(config.Regions))
+	regions := make([]string, 0, len(config.Regions))
+	for region, endpoint := range config.Regions {
+		cfg := sqldriver.NewConfig()
+		cfg.Net = "tcp"
+		cfg.Addr = endpoint.Host + ":" + endpoint.Port
+		cfg.DBName = masterCfg.Database
+		cfg.ParseTime = true
+		cfg.MultiStatements = true
+
+		connectors[region] = &credentialConnector{cfg: cfg, user: user, password: password}
+		regions = append(regions, region)
+	}
+
+	selector := newRegionSelector("mysql", regions, func(c context.Context, region string) error {
+		conn, err := connectors[region].Connect(c)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+
+	sqlDB := sql.OpenDB(&regionConnector{selector: selector, connectors: connectors})
+
+	// IMPORTANT: Close the idle connections to the previous region, the connections in use are closed when
+	// they fail or reach `maxConnectionLifeTime`.
+	selector.onSwitch = func(from, to string) {
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(config.MaxIdleConnections)
+	}
+	selector.start(context.Background())
+	refreshMysqlOnRotation(sqlDB, config.MaxIdleConnections, user, password)
+
+	db := openMysqlDB(mysql.New(mysql.Config{Conn: sqlDB}), config.Debug)
+
+	sqlDB.SetMaxIdleConns(config.MaxIdleConnections)
+	sqlDB.SetMaxOpenConns(config.MaxOpenConnections)
+
+	if config.MaxConnectionLifeTime > 0 {
+		sqlDB.SetConnMaxLifetime(config.MaxConnectionLifeTime)
+	}
+
+	if config.MaxIdleConnectionLifeTime > 0 {
+		sqlDB.SetConnMaxIdleTime(config.MaxIdleConnectionLifeTime)
+	}
+
+	return db, masterCfg.Database
+}
+
+// regionConnector opens the connections to the active region.
+type regionConnector struct {
+	selector   *RegionSelector
+	connectors map[string]driver.Connector
+}
+
+func (rc *regionConnector) Connect(c context.Context) (driver.Conn, error) {
+	return rc.connectors[rc.selector.Active()].Connect(c)
+}
+
+func (rc *regionConnector) Driver() driver.Driver {
+	return sqldriver.MySQLDriver{}
+}
+
 func createTenantConnectionsTableIfNotExist(masterDb *gorm.DB) error {
 
 	if !masterDb.Migrator().HasTable("TenantConnections") {
@@ -0,0 +1,271 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/gorm"
+)
+
+// The small interfaces of the databases, so that the repositories can be unit tested with the mocks of
+// the `dbmock` package. The concrete clients are still available from `DB`, `Database` and `Client` for the
+// features not covered by the interfaces.
+
+// SQLExecutor runs the common gorm operations, the errors are the ones of gorm. (example:
+// `gorm.ErrRecordNotFound`)
+type SQLExecutor interface {
+	Create(c context.Context, value interface{}) error
+	Save(c context.Context, value interface{}) error
+	First(c context.Context, dest interface{}, conds ...interface{}) error
+	Find(c context.Context, dest interface{}, conds ...interface{}) error
+	Delete(c context.Context, value interface{}, conds ...interface{}) (int64, error)
+	// Exec runs a raw statement and returns the number of affected rows.
+	Exec(c context.Context, sql string, values ...interface{}) (int64, error)
+	// Raw runs a raw query and scans its rows into `dest`.
+	Raw(c context.Context, dest interface{}, sql string, values ...interface{}) error
+	// Transaction runs `fn` in a transaction, committed if `fn` returns nil.
+	Transaction(c context.Context, fn func(tx SQLExecutor) error) error
+	DB() *gorm.DB
+}
+
+// MongoOps runs the common operations on the collections of a mongo database. `FindOne` returns
+// `mongo.ErrNoDocuments` if no document matches.
+type MongoOps interface {
+	FindOne(c context.Context, collection string, filter interface{}, dest interface{}) error
+	Find(c context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error
+	InsertOne(c context.Context, collection string, document interface{}) (interface{}, error)
+	UpdateOne(c context.Context, collection string, filter interface{}, update interface{}) (*mongo.UpdateResult, error)
+	DeleteOne(c context.Context, collection string, filter interface{}) (int64, error)
+	DeleteMany(c context.Context, collection string, filter interface{}) (int64, error)
+	CountDocuments(c context.Context, collection string, filter interface{}) (int64, error)
+	Aggregate(c context.Context, collection string, pipeline interface{}, dest interface{}) error
+	Database() *mongo.Database
+}
+
+// RedisOps runs the common redis operations, `*RedisDBConn` implements it. `Get` returns "" if the key
+// doesn't exist.
+type RedisOps interface {
+	Get(c context.Context, key string) (string, error)
+	Set(c context.Context, key string, data interface{}, ttl time.Duration) error
+	Exists(c context.Context, key string) (bool, error)
+	Del(c context.Context, keys ...string) error
+	Expire(c context.Context, key string, ttl time.Duration) error
+	GetJSON(c context.Context, key string, dst interface{}) (bool, error)
+	SetJSON(c context.Context, key string, data interface{}, ttl time.Duration) error
+	MGet(c context.Context, keys ...string) ([]interface{}, error)
+	IncrWithExpiry(c context.Context, key string, value int64, ttl time.Duration) (int64, error)
+	Client() redis.UniversalClient
+}
+
+// KVStore is the interface of the memory database, the badger or the bbolt `KV`.
+type KVStore = KV
+
+var _ RedisOps = (*RedisDBConn)(nil)
+
+// Get returns the string value of the key, from a read replica if there is any.
+func (clients *RedisDBConn) Get(c context.Context, key string) (string, error) {
+	return RedisGetString(c, clients, key)
+}
+
+// Set saves the key, forever if `ttl` is 0.
+func (clients *RedisDBConn) Set(c context.Context, key string, data interface{}, ttl time.Duration) error {
+	return RedisSet(c, clients, key, data, ttl)
+}
+
+// Exists returns true if the key exists.
+func (clients *RedisDBConn) Exists(c context.Context, key string) (bool, error) {
+	return RedisIsKeyExists(c, clients, key)
+}
+
+// Del deletes the keys.
+func (clients *RedisDBConn) Del(c context.Context, keys ...string) error {
+	return RedisDelKey(c, clients, keys...)
+}
+
+// Expire sets the expiry of the key.
+func (clients *RedisDBConn) Expire(c context.Context, key string, ttl time.Duration) error {
+	return RedisExpireKey(c, clients, key, ttl)
+}
+
+// Client returns the client of the master, or of the cluster in cluster mode. It's nil if there is none.
+func (clients *RedisDBConn) Client() redis.UniversalClient {
+	if clients.cluster != nil {
+		return clients.cluster
+	}
+	if clients.Host == nil {
+		return nil
+	}
+
+	return clients.Host
+}
+
+// NewSQLExecutor returns the `SQLExecutor` of a gorm database. `First`, `Find` and `Raw` read from a random
+// read replica if there is any, unless the reads of the context are forced to the primary. (see
+// `WithPrimaryRead`)
+func NewSQLExecutor(db *gorm.DB, replicas ...*gorm.DB) SQLExecutor {
+	return gormExecutor{db: db, replicas: replicas}
+}
+
+type gormExecutor struct {
+	db       *gorm.DB
+	replicas []*gorm.DB
+}
+
+// reader returns a random read replica if any, otherwise the primary.
+func (g gormExecutor) reader(c context.Context) *gorm.DB {
+	if len(g.replicas) == 0 || IsPrimaryRead(c) {
+		return g.db
+	}
+
+	return g.replicas[rand.Intn(len(g.replicas))]
+}
+
+func (g gormExecutor) Create(c context.Context, value interface{}) error {
+	return g.db.WithContext(c).Create(value).Error
+}
+
+func (g gormExecutor) Save(c context.Context, value interface{}) error {
+	return g.db.WithContext(c).Save(value).Error
+}
+
+func (g gormExecutor) First(c context.Context, dest interface{}, conds ...interface{}) error {
+	return g.reader(c).WithContext(c).First(dest, conds...).Error
+}
+
+func (g gormExecutor) Find(c context.Context, dest interface{}, conds ...interface{}) error {
+	return g.reader(c).WithContext(c).Find(dest, conds...).Error
+}
+
+func (g gormExecutor) Delete(c context.Context, value interface{}, conds ...interface{}) (int64, error) {
+	result := g.db.WithContext(c).Delete(value, conds...)
+	return result.RowsAffected, result.Error
+}
+
+func (g gormExecutor) Exec(c context.Context, sql string, values ...interface{}) (int64, error) {
+	result := g.db.WithContext(c).Exec(sql, values...)
+	return result.RowsAffected, result.Error
+}
+
+func (g gormExecutor) Raw(c context.Context, dest interface{}, sql string, values ...interface{}) error {
+	return g.reader(c).WithContext(c).Raw(sql, values...).Scan(dest).Error
+}
+
+func (g gormExecutor) Transaction(c context.Context, fn func(tx SQLExecutor) error) error {
+	return g.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return fn(gormExecutor{db: tx})
+	})
+}
+
+func (g gormExecutor) DB() *gorm.DB {
+	return g.db
+}
+
+// NewMongoOps returns the `MongoOps` of a mongo database. The reads use the read preference of the database,
+// or the primary if the reads of the context are forced to the primary. (see `WithPrimaryRead`)
+func NewMongoOps(db *mongo.Database) MongoOps {
+	return mongoOps{db: db}
+}
+
+type mongoOps struct {
+	db *mongo.Database
+}
+
+// reader returns the collection to read from.
+func (m mongoOps) reader(c context.Context, collection string) *mongo.Collection {
+	if IsPrimaryRead(c) {
+		return m.db.Collection(collection, options.Collection().SetReadPreference(readpref.Primary()))
+	}
+
+	return m.db.Collection(collection)
+}
+
+func (m mongoOps) FindOne(c context.Context, collection string, filter interface{}, dest interface{}) error {
+	return m.reader(c, collection).FindOne(c, filter).Decode(dest)
+}
+
+func (m mongoOps) Find(c context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error {
+	cursor, err := m.reader(c, collection).Find(c, filter, opts...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(cursor.All(c, dest))
+}
+
+func (m mongoOps) InsertOne(c context.Context, collection string, document interface{}) (interface{}, error) {
+	result, err := m.db.Collection(collection).InsertOne(c, document)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return result.InsertedID, nil
+}
+
+func (m mongoOps) UpdateOne(c context.Context, collection string, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	result, err := m.db.Collection(collection).UpdateOne(c, filter, update)
+	return result, errors.WithStack(err)
+}
+
+func (m mongoOps) DeleteOne(c context.Context, collection string, filter interface{}) (int64, error) {
+	result, err := m.db.Collection(collection).DeleteOne(c, filter)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (m mongoOps) DeleteMany(c context.Context, collection string, filter interface{}) (int64, error) {
+	result, err := m.db.Collection(collection).DeleteMany(c, filter)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (m mongoOps) CountDocuments(c context.Context, collection string, filter interface{}) (int64, error) {
+	count, err := m.reader(c, collection).CountDocuments(c, filter)
+	return count, errors.WithStack(err)
+}
+
+func (m mongoOps) Aggregate(c context.Context, collection string, pipeline interface{}, dest interface{}) error {
+	cursor, err := m.reader(c, collection).Aggregate(c, pipeline)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(cursor.All(c, dest))
+}
+
+func (m mongoOps) Database() *mongo.Database {
+	return m.db
+}
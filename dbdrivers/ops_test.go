@@ -0,0 +1,86 @@
+package dbdrivers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type opsUser struct {
+	ID   uint64
+	Name string
+}
+
+func TestSQLExecutor(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:ops_test?mode=memory&cache=shared"), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	assert.NoError(t, db.AutoMigrate(&opsUser{}))
+
+	c := context.Background()
+	sql := NewSQLExecutor(db)
+	assert.Same(t, db, sql.DB())
+
+	assert.NoError(t, sql.Create(c, &opsUser{ID: 1, Name: "alice"}))
+
+	var user opsUser
+	assert.NoError(t, sql.First(c, &user, 1))
+	assert.Equal(t, "alice", user.Name)
+	assert.ErrorIs(t, sql.First(c, &opsUser{}, 2), gorm.ErrRecordNotFound)
+
+	err = sql.Transaction(c, func(tx SQLExecutor) error {
+		assert.NoError(t, tx.Create(c, &opsUser{ID: 2, Name: "bob"}))
+		return errors.New("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+	assert.ErrorIs(t, sql.First(c, &opsUser{}, 2), gorm.ErrRecordNotFound)
+
+	affected, err := sql.Exec(c, "UPDATE ops_users SET name = ?", "carol")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	var names []string
+	assert.NoError(t, sql.Raw(c, &names, "SELECT name FROM ops_users"))
+	assert.Equal(t, []string{"carol"}, names)
+
+	affected, err = sql.Delete(c, &opsUser{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+}
+
+func TestRedisOps(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	var ops RedisOps = &RedisDBConn{Host: client}
+	c := context.Background()
+
+	val, err := ops.Get(c, "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, val)
+
+	assert.NoError(t, ops.Set(c, "key", "value", 0))
+	val, err = ops.Get(c, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	assert.NoError(t, ops.Expire(c, "key", time.Minute))
+	exists, err := ops.Exists(c, "key")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.NoError(t, ops.Del(c, "key"))
+	exists, err = ops.Exists(c, "key")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Same(t, client, ops.Client())
+}
@@ -25,31 +25,52 @@ package dbdrivers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math/rand"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
-	"github.com/retail-ai-inc/bean/aes"
+	"github.com/retail-ai-inc/bean/secrets"
 	"gorm.io/gorm"
 )
 
 // IMPORTANT: This structure is holding any kind of redis connection using a map in bean.go.
+// `Host` is the client of the master in standalone and sentinel mode and nil in cluster mode.
+// Use `Client` to get the client of the master or of the cluster and `ClusterClient` for the cluster one.
 type RedisDBConn struct {
-	Host *redis.Client
-	Read map[uint64]*redis.Client
-	Name int
+	Host    *redis.Client
+	Read    map[uint64]*redis.Client
+	Name    int
+	cluster *redis.ClusterClient
 }
 
+// Supported redis topologies. Use `RedisModeStandalone` (default) for a single instance with optional
+// read replicas, `RedisModeSentinel` for a master/replica set monitored by sentinels and `RedisModeCluster`
+// for a redis cluster.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 type RedisConfig struct {
+	// The `Password` and `SentinelPassword` can be references to secrets. (see `secrets`) The new connections
+	// authenticate with the rotated password, except in cluster mode which keeps the password of the boot.
 	Master *struct {
 		Database int
 		Password string
 		Host     string
 		Port     string
 		Read     []string
+
+		RedisTopology `mapstructure:",squash"`
 	}
+	// Regions are the endpoints of the master redis per region, which replace `Master.Host`, `Master.Port`
+	// and `Master.Read` in the standalone mode. (see `RegionConfig`)
+	Regions            map[string]RedisEndpoint
 	Prefix             string
 	Maxretries         int
 	PoolSize           int
@@ -60,6 +81,27 @@ type RedisConfig struct {
 	PoolTimeout        time.Duration
 }
 
+// RedisEndpoint is the address of a redis and its read replicas in a region.
+type RedisEndpoint struct {
+	Host string
+	Port string
+	Read []string
+}
+
+// RedisTopology holds the sentinel and cluster specific parameters. In sentinel mode, the client asks the
+// sentinels for the current master and reconnects automatically on failover. In cluster mode, the nodes are
+// discovered from `ClusterAddrs` and the slots are refreshed automatically on `MOVED`/`ASK` redirection.
+type RedisTopology struct {
+	Mode             string
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+	ClusterAddrs     []string
+	// ReplicaRead routes the read only commands to the replicas. In sentinel mode, a replica only
+	// failover client is added to `RedisDBConn.Read`. In cluster mode, the reads are routed randomly.
+	ReplicaRead bool
+}
+
 type KeyFieldPair struct {
 	Key   string `json:"key"`
 	Field string `json:"field"`
@@ -91,9 +133,22 @@ func InitRedisMasterConn(config RedisConfig) map[uint64]*RedisDBConn {
 	if masterCfg != nil {
 
 		masterRedisDB[0] = &RedisDBConn{}
+		password := watchSecret(masterCfg.Password)
+
+		if masterCfg.Mode != "" && masterCfg.Mode != RedisModeStandalone {
+			masterRedisDB[0] = connectRedisTopology(config, masterCfg.RedisTopology, password, masterCfg.Database)
+
+			return masterRedisDB
+		}
+
+		if len(config.Regions) > 0 {
+			masterRedisDB[0].Host, masterRedisDB[0].Read, masterRedisDB[0].Name = connectRedisRegions(config, password)
+
+			return masterRedisDB
+		}
 
 		masterRedisDB[0].Host, masterRedisDB[0].Name = connectRedisDB(
-			masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
+			password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
 			config.Maxretries, config.PoolSize, config.MinIdleConnections, config.DialTimeout,
 			config.ReadTimeout, config.WriteTimeout, config.PoolTimeout,
 		)
@@ -113,7 +168,7 @@ func InitRedisMasterConn(config RedisConfig) map[uint64]*RedisDBConn {
 				}
 
 				redisReadConn[uint64(i)], _ = connectRedisDB(
-					masterCfg.Password, host, port, masterCfg.Database,
+					password, host, port, masterCfg.Database,
 					config.Maxretries, config.PoolSize, config.MinIdleConnections, config.DialTimeout,
 					config.ReadTimeout, config.WriteTimeout, config.PoolTimeout,
 				)
@@ -128,7 +183,7 @@ func InitRedisMasterConn(config RedisConfig) map[uint64]*RedisDBConn {
 }
 
 func RedisIsKeyExists(c context.Context, clients *RedisDBConn, key string) (bool, error) {
-	result, err := clients.Host.Exists(c, key).Result()
+	result, err := clients.Client().Exists(c, key).Result()
 	if err != nil {
 		return false, errors.WithStack(err)
 	}
@@ -146,13 +201,13 @@ func RedisGetString(c context.Context, clients *RedisDBConn, key string) (string
 	var err error
 	var str string
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		str, err = clients.Read[0].Get(c, key).Result()
 		if err != nil {
-			str, err = clients.Host.Get(c, key).Result()
+			str, err = clients.Client().Get(c, key).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -161,11 +216,11 @@ func RedisGetString(c context.Context, clients *RedisDBConn, key string) (string
 
 		str, err = clients.Read[uint64(readHost)].Get(c, key).Result()
 		if err != nil {
-			str, err = clients.Host.Get(c, key).Result()
+			str, err = clients.Client().Get(c, key).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		str, err = clients.Host.Get(c, key).Result()
+		str, err = clients.Client().Get(c, key).Result()
 	}
 
 	if err == redis.Nil {
@@ -181,13 +236,13 @@ func RedisMGet(c context.Context, clients *RedisDBConn, keys ...string) ([]inter
 	var err error
 	var result []interface{}
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		result, err = clients.Read[0].MGet(c, keys...).Result()
 		if err != nil {
-			result, err = clients.Host.MGet(c, keys...).Result()
+			result, err = clients.Client().MGet(c, keys...).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -196,11 +251,11 @@ func RedisMGet(c context.Context, clients *RedisDBConn, keys ...string) ([]inter
 
 		result, err = clients.Read[uint64(readHost)].MGet(c, keys...).Result()
 		if err != nil {
-			result, err = clients.Host.MGet(c, keys...).Result()
+			result, err = clients.Client().MGet(c, keys...).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		result, err = clients.Host.MGet(c, keys...).Result()
+		result, err = clients.Client().MGet(c, keys...).Result()
 	}
 
 	if err != nil {
@@ -215,12 +270,12 @@ func RedisHGet(c context.Context, clients *RedisDBConn, key string, field string
 	var err error
 	var result string
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		result, err = clients.Read[0].HGet(c, key, field).Result()
 		if err != nil {
-			result, err = clients.Host.HGet(c, key, field).Result()
+			result, err = clients.Client().HGet(c, key, field).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -229,11 +284,11 @@ func RedisHGet(c context.Context, clients *RedisDBConn, key string, field string
 
 		result, err = clients.Read[uint64(readHost)].HGet(c, key, field).Result()
 		if err != nil {
-			result, err = clients.Host.HGet(c, key, field).Result()
+			result, err = clients.Client().HGet(c, key, field).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		result, err = clients.Host.HGet(c, key, field).Result()
+		result, err = clients.Client().HGet(c, key, field).Result()
 	}
 
 	if err == redis.Nil {
@@ -250,7 +305,7 @@ func RedisHGet(c context.Context, clients *RedisDBConn, key string, field string
 // Output is a map of keys and the respective values for those keys in redis.
 func RedisHgets(c context.Context, clients *RedisDBConn, redisKeysWithField map[string]string) (map[string]string, error) {
 	// Check the read replicas are available or not.
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	var pipe redis.Pipeliner
 	if noOfReadReplica == 1 {
@@ -262,7 +317,7 @@ func RedisHgets(c context.Context, clients *RedisDBConn, redisKeysWithField map[
 		pipe = clients.Read[uint64(readHost)].Pipeline()
 	} else {
 		// If there is no read replica then just hit the host server.
-		pipe = clients.Host.Pipeline()
+		pipe = clients.Client().Pipeline()
 	}
 
 	commandMapper := map[string]*redis.StringCmd{}
@@ -291,13 +346,13 @@ func RedisGetLRange(c context.Context, clients *RedisDBConn, key string, start,
 	var err error
 	var str []string
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		str, err = clients.Read[0].LRange(c, key, start, stop).Result()
 		if err != nil {
-			str, err = clients.Host.LRange(c, key, start, stop).Result()
+			str, err = clients.Client().LRange(c, key, start, stop).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -306,11 +361,11 @@ func RedisGetLRange(c context.Context, clients *RedisDBConn, key string, start,
 
 		str, err = clients.Read[uint64(readHost)].LRange(c, key, start, stop).Result()
 		if err != nil {
-			str, err = clients.Host.LRange(c, key, start, stop).Result()
+			str, err = clients.Client().LRange(c, key, start, stop).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		str, err = clients.Host.LRange(c, key, start, stop).Result()
+		str, err = clients.Client().LRange(c, key, start, stop).Result()
 	}
 
 	if err == redis.Nil {
@@ -326,13 +381,13 @@ func RedisSMembers(c context.Context, clients *RedisDBConn, key string) ([]strin
 	var err error
 	var str []string
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		str, err = clients.Read[0].SMembers(c, key).Result()
 		if err != nil {
-			str, err = clients.Host.SMembers(c, key).Result()
+			str, err = clients.Client().SMembers(c, key).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -341,11 +396,11 @@ func RedisSMembers(c context.Context, clients *RedisDBConn, key string) ([]strin
 
 		str, err = clients.Read[uint64(readHost)].SMembers(c, key).Result()
 		if err != nil {
-			str, err = clients.Host.SMembers(c, key).Result()
+			str, err = clients.Client().SMembers(c, key).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		str, err = clients.Host.SMembers(c, key).Result()
+		str, err = clients.Client().SMembers(c, key).Result()
 	}
 
 	if err == redis.Nil {
@@ -361,13 +416,13 @@ func RedisSIsMember(c context.Context, clients *RedisDBConn, key string, element
 	var err error
 	var found bool
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
 		found, err = clients.Read[0].SIsMember(c, key, element).Result()
 		if err != nil {
-			found, err = clients.Host.SIsMember(c, key, element).Result()
+			found, err = clients.Client().SIsMember(c, key, element).Result()
 		}
 	} else if noOfReadReplica > 1 {
 		// Select a read replica between 0 ~ noOfReadReplica-1 randomly.
@@ -376,11 +431,11 @@ func RedisSIsMember(c context.Context, clients *RedisDBConn, key string, element
 
 		found, err = clients.Read[uint64(readHost)].SIsMember(c, key, element).Result()
 		if err != nil {
-			found, err = clients.Host.SIsMember(c, key, element).Result()
+			found, err = clients.Client().SIsMember(c, key, element).Result()
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		found, err = clients.Host.SIsMember(c, key, element).Result()
+		found, err = clients.Client().SIsMember(c, key, element).Result()
 	}
 
 	if err != nil {
@@ -394,7 +449,7 @@ func RedisSRandMemberN(c context.Context, clients *RedisDBConn, key string, coun
 	var err error
 	var result []string
 
-	noOfReadReplica := len(clients.Read)
+	noOfReadReplica := clients.readReplicaCount(c)
 
 	// Check the read replicas are available or not.
 	if noOfReadReplica == 1 {
@@ -412,7 +467,7 @@ func RedisSRandMemberN(c context.Context, clients *RedisDBConn, key string, coun
 		}
 	} else {
 		// If there is no read replica then just hit the host server.
-		result, err = clients.Host.SRandMemberN(c, key, count).Result()
+		result, err = clients.Client().SRandMemberN(c, key, count).Result()
 	}
 
 	return result, err
@@ -424,7 +479,7 @@ func RedisSetJSON(c context.Context, clients *RedisDBConn, key string, data inte
 		return errors.WithStack(err)
 	}
 
-	if err := clients.Host.Set(c, key, string(jsonBytes), ttl).Err(); err != nil {
+	if err := clients.Client().Set(c, key, string(jsonBytes), ttl).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -432,7 +487,7 @@ func RedisSetJSON(c context.Context, clients *RedisDBConn, key string, data inte
 }
 
 func RedisSet(c context.Context, clients *RedisDBConn, key string, data interface{}, ttl time.Duration) error {
-	if err := clients.Host.Set(c, key, data, ttl).Err(); err != nil {
+	if err := clients.Client().Set(c, key, data, ttl).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -445,12 +500,12 @@ func RedisHSet(c context.Context, clients *RedisDBConn, key string, field string
 		return errors.WithStack(err)
 	}
 
-	if err := clients.Host.HSet(c, key, field, jsonBytes).Err(); err != nil {
+	if err := clients.Client().HSet(c, key, field, jsonBytes).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
 	if ttl > 0 {
-		if err := clients.Host.Expire(c, key, ttl).Err(); err != nil {
+		if err := clients.Client().Expire(c, key, ttl).Err(); err != nil {
 			return errors.WithStack(err)
 		}
 	}
@@ -459,7 +514,7 @@ func RedisHSet(c context.Context, clients *RedisDBConn, key string, field string
 }
 
 func RedisRPush(c context.Context, clients *RedisDBConn, key string, valueList []string) error {
-	if err := clients.Host.RPush(c, key, &valueList).Err(); err != nil {
+	if err := clients.Client().RPush(c, key, &valueList).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -467,7 +522,7 @@ func RedisRPush(c context.Context, clients *RedisDBConn, key string, valueList [
 }
 
 func RedisIncrementValue(c context.Context, clients *RedisDBConn, key string) error {
-	if err := clients.Host.Incr(c, key).Err(); err != nil {
+	if err := clients.Client().Incr(c, key).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -475,7 +530,7 @@ func RedisIncrementValue(c context.Context, clients *RedisDBConn, key string) er
 }
 
 func RedisSAdd(c context.Context, clients *RedisDBConn, key string, elements interface{}) error {
-	if err := clients.Host.SAdd(c, key, elements).Err(); err != nil {
+	if err := clients.Client().SAdd(c, key, elements).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -483,7 +538,7 @@ func RedisSAdd(c context.Context, clients *RedisDBConn, key string, elements int
 }
 
 func RedisSRem(c context.Context, clients *RedisDBConn, key string, elements interface{}) error {
-	if err := clients.Host.SRem(c, key, elements).Err(); err != nil {
+	if err := clients.Client().SRem(c, key, elements).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -491,7 +546,7 @@ func RedisSRem(c context.Context, clients *RedisDBConn, key string, elements int
 }
 
 func RedisDelKey(c context.Context, clients *RedisDBConn, keys ...string) error {
-	if err := clients.Host.Del(c, keys...).Err(); err != nil {
+	if err := clients.Client().Del(c, keys...).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -499,7 +554,7 @@ func RedisDelKey(c context.Context, clients *RedisDBConn, keys ...string) error
 }
 
 func RedisExpireKey(c context.Context, clients *RedisDBConn, key string, ttl time.Duration) error {
-	if err := clients.Host.Expire(c, key, ttl).Err(); err != nil {
+	if err := clients.Client().Expire(c, key, ttl).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -523,14 +578,29 @@ func getAllRedisTenantDB(config RedisConfig, tenantCfgs []*TenantConnections, te
 
 		// IMPORTANT: Check the `redis` object exist in the Connections column or not.
 		if redisCfg, ok := cfgsMap["redis"]; ok {
-			password := redisCfg["password"].(string)
-
+			redisCfg = tenantConfig(t.TenantID, redisCfg)
 			// IMPORTANT: If tenant database password is encrypted in master db config.
-			if tenantDBPassPhraseKey != "" {
-				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
-				if err != nil {
-					panic(err)
+			password := tenantPassword(redisCfg["password"].(string), tenantDBPassPhraseKey)
+
+			var dbName int
+			if dbName, ok = redisCfg["database"].(int); !ok {
+				dbName = 0
+			}
+
+			// IMPORTANT: Sentinel or cluster topology doesn't use the `host`, `port` and `read` parameters.
+			if mode, _ := redisCfg["mode"].(string); mode != "" && mode != RedisModeStandalone {
+				topology := RedisTopology{
+					Mode:          mode,
+					SentinelAddrs: toStringSlice(redisCfg["sentinelAddrs"]),
+					ClusterAddrs:  toStringSlice(redisCfg["clusterAddrs"]),
 				}
+				topology.MasterName, _ = redisCfg["masterName"].(string)
+				topology.SentinelPassword, _ = redisCfg["sentinelPassword"].(string)
+				topology.ReplicaRead, _ = redisCfg["replicaRead"].(bool)
+
+				tenantRedisDB[t.TenantID] = connectRedisTopology(config, topology, password, dbName)
+
+				continue
 			}
 
 			host := redisCfg["host"].(string)
@@ -543,10 +613,6 @@ func getAllRedisTenantDB(config RedisConfig, tenantCfgs []*TenantConnections, te
 			}
 
 			port := redisCfg["port"].(string)
-			var dbName int
-			if dbName, ok = redisCfg["database"].(int); !ok {
-				dbName = 0
-			}
 
 			tenantRedisDB[t.TenantID] = &RedisDBConn{}
 
@@ -592,14 +658,16 @@ func getAllRedisTenantDB(config RedisConfig, tenantCfgs []*TenantConnections, te
 }
 
 func connectRedisDB(
-	password, host, port string, dbName int, maxretries, poolsize, minIdleConnections int,
+	password *secrets.Value, host, port string, dbName int, maxretries, poolsize, minIdleConnections int,
 	dialTimeout, readTimeout, writeTimeout, poolTimeout time.Duration,
 ) (*redis.Client, int) {
 
+	authPassword, db, onConnect := redisAuth(password, dbName)
 	rdb := redis.NewClient(&redis.Options{
 		Addr:         host + ":" + port,
-		Password:     password,
-		DB:           dbName,
+		Password:     authPassword,
+		DB:           db,
+		OnConnect:    onConnect,
 		MaxRetries:   maxretries,
 		PoolSize:     poolsize,
 		MinIdleConns: minIdleConnections,
@@ -612,6 +680,158 @@ func connectRedisDB(
 	return rdb, dbName
 }
 
+// connectRedisRegions connects to the redis of the nearest healthy region. The connections are dialed to
+// the active region of the `RegionSelector`, so the pool moves to another region on failover. The read
+// replicas of the region selected at boot are kept for the reads.
+func connectRedisRegions(config RedisConfig, password *secrets.Value) (*redis.Client, map[uint64]*redis.Client, int) {
+	masterCfg := config.Master
+	authPassword, db, onConnect := redisAuth(password, masterCfg.Database)
+
+	probes := make(map[string]*redis.Client, len(config.Regions))
+	regions := make([]string, 0, len(config.Regions))
+	for region, endpoint := range config.Regions {
+		probes[region] = redis.NewClient(&redis.Options{
+			Addr:        endpoint.Host + ":" + endpoint.Port,
+			Password:    authPassword,
+			DB:          db,
+			OnConnect:   onConnect,
+			PoolSize:    1,
+			DialTimeout: config.DialTimeout,
+			ReadTimeout: config.ReadTimeout,
+		})
+		regions = append(regions, region)
+	}
+
+	selector := newRegionSelector("redis", regions, func(c context.Context, region string) error {
+		return probes[region].Ping(c).Err()
+	})
+	selector.start(context.Background())
+
+	bootRegion := selector.Active()
+
+	dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: 5 * time.Minute}
+	host := redis.NewClient(&redis.Options{
+		Addr: "region:" + bootRegion,
+		Dialer: func(c context.Context, network, _ string) (net.Conn, error) {
+			endpoint := config.Regions[selector.Active()]
+			return dialer.DialContext(c, network, endpoint.Host+":"+endpoint.Port)
+		},
+		Password:     authPassword,
+		DB:           db,
+		OnConnect:    onConnect,
+		MaxRetries:   config.Maxretries,
+		PoolSize:     config.PoolSize,
+		MinIdleConns: config.MinIdleConnections,
+		DialTimeout:  config.DialTimeout,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		PoolTimeout:  config.PoolTimeout,
+	})
+
+	var read map[uint64]*redis.Client
+	if endpoint := config.Regions[bootRegion]; len(endpoint.Read) > 0 {
+		read = make(map[uint64]*redis.Client, len(endpoint.Read))
+		for i, readHost := range endpoint.Read {
+			host, port := readHost, endpoint.Port
+			if s := strings.Split(readHost, ":"); len(s) == 2 {
+				host, port = s[0], s[1]
+			}
+
+			read[uint64(i)], _ = connectRedisDB(
+				password, host, port, masterCfg.Database,
+				config.Maxretries, config.PoolSize, config.MinIdleConnections, config.DialTimeout,
+				config.ReadTimeout, config.WriteTimeout, config.PoolTimeout,
+			)
+		}
+	}
+
+	return host, read, masterCfg.Database
+}
+
+// connectRedisTopology connects to a sentinel monitored master or to a redis cluster. The read replica
+// map is only filled in sentinel mode when `ReplicaRead` is true.
+func connectRedisTopology(config RedisConfig, topology RedisTopology, password *secrets.Value, dbName int) *RedisDBConn {
+
+	switch topology.Mode {
+	case RedisModeSentinel:
+		if topology.MasterName == "" || len(topology.SentinelAddrs) == 0 {
+			panic("redis sentinel mode requires `masterName` and `sentinelAddrs`")
+		}
+
+		authPassword, db, onConnect := redisAuth(password, dbName)
+		sentinelPassword := resolveSecret(topology.SentinelPassword)
+		failoverOptions := func(replicaOnly bool) *redis.FailoverOptions {
+			return &redis.FailoverOptions{
+				MasterName:       topology.MasterName,
+				SentinelAddrs:    topology.SentinelAddrs,
+				SentinelPassword: sentinelPassword,
+				SlaveOnly:        replicaOnly,
+				Password:         authPassword,
+				DB:               db,
+				OnConnect:        onConnect,
+				MaxRetries:       config.Maxretries,
+				PoolSize:         config.PoolSize,
+				MinIdleConns:     config.MinIdleConnections,
+				DialTimeout:      config.DialTimeout,
+				ReadTimeout:      config.ReadTimeout,
+				WriteTimeout:     config.WriteTimeout,
+				PoolTimeout:      config.PoolTimeout,
+			}
+		}
+
+		var read map[uint64]*redis.Client
+		if topology.ReplicaRead {
+			read = map[uint64]*redis.Client{0: redis.NewFailoverClient(failoverOptions(true))}
+		}
+
+		return &RedisDBConn{Host: redis.NewFailoverClient(failoverOptions(false)), Read: read, Name: dbName}
+
+	case RedisModeCluster:
+		if len(topology.ClusterAddrs) == 0 {
+			panic("redis cluster mode requires `clusterAddrs`")
+		}
+
+		// IMPORTANT: Redis cluster only supports the database 0, another one would silently share its keys.
+		if dbName != 0 {
+			panic(fmt.Sprintf("redis cluster mode only supports the database 0, not %d", dbName))
+		}
+
+		// The password is not rotated, the read only command of the replica reads is sent before `OnConnect`
+		// could authenticate.
+		return &RedisDBConn{cluster: redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:         topology.ClusterAddrs,
+			Password:      password.Get(),
+			ReadOnly:      topology.ReplicaRead,
+			RouteRandomly: topology.ReplicaRead,
+			MaxRetries:    config.Maxretries,
+			PoolSize:      config.PoolSize,
+			MinIdleConns:  config.MinIdleConnections,
+			DialTimeout:   config.DialTimeout,
+			ReadTimeout:   config.ReadTimeout,
+			WriteTimeout:  config.WriteTimeout,
+			PoolTimeout:   config.PoolTimeout,
+		})}
+	}
+
+	panic("unsupported redis mode: " + topology.Mode)
+}
+
+func toStringSlice(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	s := make([]string, 0, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			s = append(s, str)
+		}
+	}
+
+	return s
+}
+
 func GetRedisCachePrefix() string {
 	return cachePrefix
 }
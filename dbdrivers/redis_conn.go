@@ -0,0 +1,279 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRedisLockNotObtained = errors.New("redis: lock not obtained")
+	ErrRedisLockNotHeld     = errors.New("redis: lock not held")
+)
+
+// redisFencingTTL is how long the fencing counter of a lock is kept after the last acquisition. The tokens
+// start again from 1 if the key is not locked during this period.
+const redisFencingTTL = 7 * 24 * time.Hour
+
+// RedisLock is a distributed lock acquired by `RedisDBConn.Lock`. Every successful acquisition gets a
+// monotonically increasing fencing token which should be passed to the protected resource so that it
+// can reject writes coming from an older lock holder.
+type RedisLock struct {
+	conn  *RedisDBConn
+	key   string
+	token int64
+}
+
+// Increment the key and set the expiry only if the key has been created by this increment.
+var incrWithExpiryScript = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// Increment the fencing counter and extend its expiry.
+var fencingScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return v
+`)
+
+// Delete the lock key only if the token matches.
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Extend the lock expiry only if the token matches.
+var refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// GetRedisConn returns the redis connection of a tenant from the tenant connection map. If the map is empty
+// (tenant mode is off), the master connection is returned instead.
+func GetRedisConn(master, tenants map[uint64]*RedisDBConn, tenantID uint64) (*RedisDBConn, error) {
+	if len(tenants) == 0 {
+		if conn, ok := master[0]; ok && conn != nil {
+			return conn, nil
+		}
+
+		return nil, errors.New("redis: master connection is not initialized")
+	}
+
+	conn, ok := tenants[tenantID]
+	if !ok || conn == nil {
+		return nil, errors.Errorf("redis: connection of tenant %d is not initialized", tenantID)
+	}
+
+	return conn, nil
+}
+
+// GetJSON gets the key and unmarshal the JSON value into `dst`. It returns `false` if the key doesn't exist.
+func (clients *RedisDBConn) GetJSON(c context.Context, key string, dst interface{}) (bool, error) {
+	str, err := RedisGetString(c, clients, key)
+	if err != nil {
+		return false, err
+	}
+
+	if str == "" {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(str), dst); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// SetJSON marshals `data` into JSON and sets it with a `ttl`. Pass `ttl` as 0 to keep the key forever.
+func (clients *RedisDBConn) SetJSON(c context.Context, key string, data interface{}, ttl time.Duration) error {
+	return RedisSetJSON(c, clients, key, data, ttl)
+}
+
+// HGetAllInto gets all the fields of a hash and scan them into the struct `dst` using the `redis` field tag.
+// Example:
+//
+//	var user struct {
+//		Name string `redis:"name"`
+//		Age  int    `redis:"age"`
+//	}
+//	found, err := conn.HGetAllInto(c, "user:1", &user)
+func (clients *RedisDBConn) HGetAllInto(c context.Context, key string, dst interface{}) (bool, error) {
+	cmd := clients.Reader(c).HGetAll(c, key)
+	if err := cmd.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if len(cmd.Val()) == 0 {
+		return false, nil
+	}
+
+	if err := cmd.Scan(dst); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// MGet gets the values of all the given keys. The value is `nil` if the key doesn't exist.
+func (clients *RedisDBConn) MGet(c context.Context, keys ...string) ([]interface{}, error) {
+	return RedisMGet(c, clients, keys...)
+}
+
+// IncrWithExpiry increments the key by `value` and sets the `ttl` when the key is newly created, so
+// the counter expires `ttl` after the first increment. (example: fixed window rate limit counters)
+func (clients *RedisDBConn) IncrWithExpiry(c context.Context, key string, value int64, ttl time.Duration) (int64, error) {
+	result, err := incrWithExpiryScript.Run(c, clients.Client(), []string{key}, value, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return result, nil
+}
+
+// Pipelined sends all the commands queued by `fn` to the master in one round trip.
+func (clients *RedisDBConn) Pipelined(c context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	cmds, err := clients.Client().Pipelined(c, fn)
+	if err != nil && err != redis.Nil {
+		return cmds, errors.WithStack(err)
+	}
+
+	return cmds, nil
+}
+
+// TxPipelined is same as `Pipelined` but wraps the queued commands with MULTI/EXEC.
+func (clients *RedisDBConn) TxPipelined(c context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	cmds, err := clients.Client().TxPipelined(c, fn)
+	if err != nil && err != redis.Nil {
+		return cmds, errors.WithStack(err)
+	}
+
+	return cmds, nil
+}
+
+// Lock tries to acquire a distributed lock on `key` for `ttl` using SET NX. It returns
+// `ErrRedisLockNotObtained` if the lock is already held by someone else.
+func (clients *RedisDBConn) Lock(c context.Context, key string, ttl time.Duration) (*RedisLock, error) {
+	fencingTTL := redisFencingTTL
+	if ttl > fencingTTL {
+		fencingTTL = ttl
+	}
+
+	token, err := fencingScript.Run(c, clients.Client(), []string{key + ":fencing"}, fencingTTL.Milliseconds()).Int64()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ok, err := clients.Client().SetNX(c, key, token, ttl).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !ok {
+		return nil, ErrRedisLockNotObtained
+	}
+
+	return &RedisLock{conn: clients, key: key, token: token}, nil
+}
+
+// LockWithRetry is same as `Lock` but keeps retrying in every `interval` until the lock is obtained
+// or the context is done.
+func (clients *RedisDBConn) LockWithRetry(c context.Context, key string, ttl, interval time.Duration) (*RedisLock, error) {
+	for {
+		lock, err := clients.Lock(c, key, ttl)
+		if err != ErrRedisLockNotObtained {
+			return lock, err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-c.Done():
+			return nil, ErrRedisLockNotObtained
+		}
+	}
+}
+
+// Token returns the fencing token of the lock.
+func (l *RedisLock) Token() int64 {
+	return l.token
+}
+
+// Refresh extends the lock expiry. It returns `ErrRedisLockNotHeld` if the lock has already expired.
+func (l *RedisLock) Refresh(c context.Context, ttl time.Duration) error {
+	result, err := refreshLockScript.Run(c, l.conn.Client(), []string{l.key}, strconv.FormatInt(l.token, 10), ttl.Milliseconds()).Int64()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if result == 0 {
+		return ErrRedisLockNotHeld
+	}
+
+	return nil
+}
+
+// Release releases the lock. It returns `ErrRedisLockNotHeld` if the lock has already expired.
+func (l *RedisLock) Release(c context.Context) error {
+	result, err := unlockScript.Run(c, l.conn.Client(), []string{l.key}, strconv.FormatInt(l.token, 10)).Int64()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if result == 0 {
+		return ErrRedisLockNotHeld
+	}
+
+	return nil
+}
+
+// ClusterClient returns the client of the cluster in cluster mode, or nil otherwise.
+func (clients *RedisDBConn) ClusterClient() *redis.ClusterClient {
+	return clients.cluster
+}
+
+// Reader returns a random read replica if any, otherwise the master. The master is returned if the reads
+// of the context are forced to the primary. (see `WithPrimaryRead`)
+func (clients *RedisDBConn) Reader(c context.Context) redis.Cmdable {
+	noOfReadReplica := clients.readReplicaCount(c)
+
+	if noOfReadReplica == 0 {
+		return clients.Client()
+	}
+
+	return clients.Read[uint64(rand.Intn(noOfReadReplica))]
+}
@@ -0,0 +1,179 @@
+package dbdrivers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisConn(t *testing.T) (*RedisDBConn, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	return &RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}, mr
+}
+
+func TestRedisJSON(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	var got user
+	found, err := conn.GetJSON(c, "user:1", &got)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, conn.SetJSON(c, "user:1", user{Name: "alice", Age: 30}, time.Minute))
+	assert.Equal(t, time.Minute, mr.TTL("user:1"))
+
+	found, err = conn.GetJSON(c, "user:1", &got)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, user{Name: "alice", Age: 30}, got)
+
+	require.NoError(t, mr.Set("broken", "{"))
+	_, err = conn.GetJSON(c, "broken", &got)
+	assert.Error(t, err)
+}
+
+func TestRedisHGetAllInto(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	var user struct {
+		Name string `redis:"name"`
+		Age  int    `redis:"age"`
+	}
+
+	found, err := conn.HGetAllInto(c, "user:1", &user)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	mr.HSet("user:1", "name", "alice", "age", "30")
+	found, err = conn.HGetAllInto(c, "user:1", &user)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "alice", user.Name)
+	assert.Equal(t, 30, user.Age)
+}
+
+func TestRedisMGet(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	require.NoError(t, mr.Set("a", "1"))
+	require.NoError(t, mr.Set("c", "3"))
+
+	values, err := conn.MGet(context.Background(), "a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1", nil, "3"}, values)
+}
+
+func TestRedisIncrWithExpiry(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	n, err := conn.IncrWithExpiry(c, "counter", 2, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// The expiry is not extended by the next increments.
+	mr.FastForward(30 * time.Second)
+	n, err = conn.IncrWithExpiry(c, "counter", 1, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, 30*time.Second, mr.TTL("counter"))
+
+	mr.FastForward(30 * time.Second)
+	n, err = conn.IncrWithExpiry(c, "counter", 1, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestRedisPipelined(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	cmds, err := conn.Pipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Set(c, "a", "1", 0)
+		pipe.Get(c, "missing")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, cmds, 2)
+	mr.CheckGet(t, "a", "1")
+
+	_, err = conn.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Incr(c, "b")
+		pipe.Incr(c, "b")
+		return nil
+	})
+	assert.NoError(t, err)
+	mr.CheckGet(t, "b", "2")
+}
+
+func TestRedisLock(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	lock, err := conn.Lock(c, "job", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), lock.Token())
+	assert.Equal(t, redisFencingTTL, mr.TTL("job:fencing"))
+
+	_, err = conn.Lock(c, "job", time.Minute)
+	assert.Equal(t, ErrRedisLockNotObtained, err)
+
+	mr.FastForward(50 * time.Second)
+	assert.NoError(t, lock.Refresh(c, time.Minute))
+	assert.Equal(t, time.Minute, mr.TTL("job"))
+
+	assert.NoError(t, lock.Release(c))
+	assert.Equal(t, ErrRedisLockNotHeld, lock.Release(c))
+	assert.Equal(t, ErrRedisLockNotHeld, lock.Refresh(c, time.Minute))
+
+	// The fencing token keeps increasing for the next holders.
+	next, err := conn.Lock(c, "job", time.Second)
+	require.NoError(t, err)
+	assert.Greater(t, next.Token(), lock.Token())
+
+	// An expired lock can't be released by its former holder.
+	mr.FastForward(2 * time.Second)
+	assert.Equal(t, ErrRedisLockNotHeld, next.Release(c))
+
+	ctx, cancel := context.WithTimeout(c, 50*time.Millisecond)
+	defer cancel()
+	_, err = conn.Lock(c, "busy", time.Minute)
+	require.NoError(t, err)
+	_, err = conn.LockWithRetry(ctx, "busy", time.Minute, 10*time.Millisecond)
+	assert.Equal(t, ErrRedisLockNotObtained, err)
+}
+
+func TestRedisConcreteClients(t *testing.T) {
+	conn, _ := newTestRedisConn(t)
+	assert.Same(t, conn.Host, conn.Client())
+	assert.Nil(t, conn.ClusterClient())
+
+	conn = connectRedisTopology(RedisConfig{}, RedisTopology{Mode: RedisModeCluster, ClusterAddrs: []string{"127.0.0.1:0"}}, secrets.Static(""), 0)
+	defer conn.Client().Close()
+	assert.Nil(t, conn.Host)
+	assert.NotNil(t, conn.ClusterClient())
+	assert.Same(t, conn.ClusterClient(), conn.Client())
+
+	assert.Nil(t, (&RedisDBConn{}).Client())
+}
+
+func TestRedisClusterDatabase(t *testing.T) {
+	topology := RedisTopology{Mode: RedisModeCluster, ClusterAddrs: []string{"127.0.0.1:0"}}
+	assert.PanicsWithValue(t, "redis cluster mode only supports the database 0, not 1", func() {
+		connectRedisTopology(RedisConfig{}, topology, nil, 1)
+	})
+}
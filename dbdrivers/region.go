@@ -0,0 +1,305 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// RegionConfig selects the endpoints of the master MySQL and redis by region, when `Regions` is set
+// in their config. The service connects to the nearest healthy region at boot and fails over to the
+// next one when the active region keeps failing the health checks.
+type RegionConfig struct {
+	// Current is the region of the service.
+	// Optional. Default value the environment variable `EnvVar`.
+	Current string
+
+	// EnvVar is the environment variable of the region of the service.
+	// Optional. Default value "BEAN_REGION".
+	EnvVar string
+
+	// Preferences are the other regions from the nearest to the farthest, per region. The regions which
+	// are not listed are tried last, in alphabetical order.
+	// Optional. Default value {}.
+	Preferences map[string][]string
+
+	// FailureThreshold is the number of consecutive failed health checks of the active region before
+	// failing over to the next region.
+	// Optional. Default value 3.
+	FailureThreshold int
+
+	// CheckInterval is the interval of the health checks.
+	// Optional. Default value 10 seconds.
+	CheckInterval time.Duration
+
+	// CheckTimeout is the timeout of a health check.
+	// Optional. Default value 2 seconds.
+	CheckTimeout time.Duration
+}
+
+// DefaultRegionConfig is the default config of the region selection.
+var DefaultRegionConfig = RegionConfig{
+	EnvVar:           "BEAN_REGION",
+	FailureThreshold: 3,
+	CheckInterval:    10 * time.Second,
+	CheckTimeout:     2 * time.Second,
+}
+
+// Region is the region config used by `InitMysqlMasterConn` and `InitRedisMasterConn`, set by bean
+// before connecting the databases.
+var Region = DefaultRegionConfig
+
+var (
+	regionActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bean",
+		Name:      "region_active",
+		Help:      "1 for the region the database is connected to, 0 for the other regions.",
+	}, []string{"database", "region"})
+
+	regionFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "region_fallbacks_total",
+		Help:      "How many times the database switched to another region, partitioned by the regions.",
+	}, []string{"database", "from", "to"})
+
+	regionMetricsOnce sync.Once
+
+	regionSelectorsMu sync.Mutex
+	regionSelectors   = map[string]*RegionSelector{}
+)
+
+// RegionSelector keeps track of the active region of a database.
+type RegionSelector struct {
+	database string
+	config   RegionConfig
+	order    []string
+	probe    func(c context.Context, region string) error
+	onSwitch func(from, to string)
+
+	mu       sync.RWMutex
+	active   string
+	failures int
+}
+
+// newRegionSelector orders the regions from the nearest to the farthest and selects the first healthy
+// one, or the nearest one if none of them is healthy.
+func newRegionSelector(database string, regions []string, probe func(c context.Context, region string) error) *RegionSelector {
+	config := Region
+	config.Current = CurrentRegion()
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultRegionConfig.FailureThreshold
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DefaultRegionConfig.CheckInterval
+	}
+	if config.CheckTimeout <= 0 {
+		config.CheckTimeout = DefaultRegionConfig.CheckTimeout
+	}
+
+	s := &RegionSelector{
+		database: database,
+		config:   config,
+		order:    regionOrder(config.Current, config.Preferences[config.Current], regions),
+		probe:    probe,
+	}
+
+	s.active = s.order[0]
+	for _, region := range s.order {
+		if s.check(region) == nil {
+			s.active = region
+			break
+		}
+	}
+
+	regionMetrics()
+	s.setActiveMetric()
+
+	regionSelectorsMu.Lock()
+	regionSelectors[database] = s
+	regionSelectorsMu.Unlock()
+
+	return s
+}
+
+// regionOrder returns the current region, its preferences and then the other regions. The regions which
+// have no endpoint are ignored.
+func regionOrder(current string, preferences, regions []string) []string {
+	known := make(map[string]bool, len(regions))
+	for _, region := range regions {
+		known[region] = true
+	}
+
+	order := make([]string, 0, len(regions))
+	added := make(map[string]bool, len(regions))
+	add := func(region string) {
+		if known[region] && !added[region] {
+			order = append(order, region)
+			added[region] = true
+		}
+	}
+
+	add(current)
+	for _, region := range preferences {
+		add(region)
+	}
+
+	rest := append([]string(nil), regions...)
+	sort.Strings(rest)
+	for _, region := range rest {
+		add(region)
+	}
+
+	return order
+}
+
+// ActiveRegion returns the region `database` ("mysql" or "redis") is connected to, or "" if the regions
+// are not configured.
+func ActiveRegion(database string) string {
+	regionSelectorsMu.Lock()
+	s := regionSelectors[database]
+	regionSelectorsMu.Unlock()
+
+	if s == nil {
+		return ""
+	}
+
+	return s.Active()
+}
+
+// Active returns the active region.
+func (s *RegionSelector) Active() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.active
+}
+
+// Regions returns the regions from the nearest to the farthest.
+func (s *RegionSelector) Regions() []string {
+	return append([]string(nil), s.order...)
+}
+
+// Check probes the regions once. The nearer regions are probed first so that the database fails back as
+// soon as they recover. The farther regions are only probed after `FailureThreshold` consecutive failures
+// of the active region.
+func (s *RegionSelector) Check() {
+	active := s.Active()
+	activeErr := s.check(active)
+
+	s.mu.Lock()
+	if activeErr == nil {
+		s.failures = 0
+	} else {
+		s.failures++
+	}
+	failures := s.failures
+	s.mu.Unlock()
+
+	nearer := true
+	for _, region := range s.order {
+		if region == active {
+			if activeErr == nil {
+				return
+			}
+			nearer = false
+			continue
+		}
+
+		if !nearer && failures < s.config.FailureThreshold {
+			return
+		}
+
+		if s.check(region) == nil {
+			s.switchTo(active, region)
+			return
+		}
+	}
+}
+
+func (s *RegionSelector) check(region string) error {
+	c, cancel := context.WithTimeout(context.Background(), s.config.CheckTimeout)
+	defer cancel()
+
+	return s.probe(c, region)
+}
+
+func (s *RegionSelector) switchTo(from, to string) {
+	s.mu.Lock()
+	if s.active != from {
+		s.mu.Unlock()
+		return
+	}
+	s.active = to
+	s.failures = 0
+	s.mu.Unlock()
+
+	regionFallbacks.WithLabelValues(s.database, from, to).Inc()
+	s.setActiveMetric()
+
+	if s.onSwitch != nil {
+		s.onSwitch(from, to)
+	}
+}
+
+func (s *RegionSelector) setActiveMetric() {
+	active := s.Active()
+	for _, region := range s.order {
+		v := 0.0
+		if region == active {
+			v = 1
+		}
+		regionActive.WithLabelValues(s.database, region).Set(v)
+	}
+}
+
+// start runs the health checks until `c` is done.
+func (s *RegionSelector) start(c context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+				s.Check()
+			}
+		}
+	}()
+}
+
+// regionMetrics registers the region metrics into the default prometheus registry.
+func regionMetrics() {
+	regionMetricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		regionActive = helpers.RegisterCollector(prometheus.DefaultRegisterer, regionActive)
+		regionFallbacks = helpers.RegisterCollector(prometheus.DefaultRegisterer, regionFallbacks)
+	})
+}
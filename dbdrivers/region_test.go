@@ -0,0 +1,66 @@
+package dbdrivers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRegions struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+func (f *fakeRegions) set(region string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[region] = down
+}
+
+func (f *fakeRegions) probe(_ context.Context, region string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down[region] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func TestRegionOrder(t *testing.T) {
+	order := regionOrder("tokyo", []string{"osaka", "unknown"}, []string{"virginia", "osaka", "tokyo", "frankfurt"})
+	assert.Equal(t, []string{"tokyo", "osaka", "frankfurt", "virginia"}, order)
+
+	order = regionOrder("", nil, []string{"b", "a"})
+	assert.Equal(t, []string{"a", "b"}, order)
+}
+
+func TestRegionSelectorFailover(t *testing.T) {
+	Region = RegionConfig{
+		Current:          "tokyo",
+		Preferences:      map[string][]string{"tokyo": {"osaka"}},
+		FailureThreshold: 2,
+	}
+	defer func() { Region = DefaultRegionConfig }()
+
+	regions := &fakeRegions{down: map[string]bool{"tokyo": true}}
+	s := newRegionSelector("test", []string{"tokyo", "osaka", "virginia"}, regions.probe)
+	assert.Equal(t, "osaka", s.Active(), "nearest healthy region at boot")
+	assert.Equal(t, "osaka", ActiveRegion("test"))
+
+	s.Check()
+	assert.Equal(t, "osaka", s.Active(), "stays while the nearer region is down")
+
+	regions.set("tokyo", false)
+	s.Check()
+	assert.Equal(t, "tokyo", s.Active(), "fails back to the nearer region")
+
+	regions.set("tokyo", true)
+	regions.set("osaka", true)
+	s.Check()
+	assert.Equal(t, "tokyo", s.Active(), "below the failure threshold")
+	s.Check()
+	assert.Equal(t, "virginia", s.Active(), "fails over after the failure threshold")
+}
@@ -0,0 +1,136 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/retail-ai-inc/bean/helpers"
+	"gorm.io/gorm"
+)
+
+// RequestIDPlugin is a gorm plugin which appends the request ID of the statement context (see
+// `helpers.WithRequestID`) to the SQL as a comment, `/* req:<id> */`, so that the slow query log and
+// the process list can be correlated with the access log. The IDs which are not made of letters, digits,
+// `-`, `_`, `.` and `:` are ignored, since they come from a request header. The prepared statement mode
+// of gorm is left untouched to not cache a statement per request.
+type RequestIDPlugin struct{}
+
+// Name implements the `gorm.Plugin` interface.
+func (RequestIDPlugin) Name() string {
+	return "bean:request_id"
+}
+
+// Initialize implements the `gorm.Plugin` interface. The connection pool of the statement is wrapped
+// only around the main callback of each processor, since the transaction callbacks need the original one.
+func (p RequestIDPlugin) Initialize(db *gorm.DB) error {
+	wrap, unwrap := p.Name()+":wrap", p.Name()+":unwrap"
+
+	for _, err := range []error{
+		db.Callback().Create().Before("gorm:create").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Create().Before("gorm:save_after_associations").Register(unwrap, unwrapRequestIDConnPool),
+		db.Callback().Query().Before("gorm:query").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Query().Before("gorm:preload").Register(unwrap, unwrapRequestIDConnPool),
+		db.Callback().Update().Before("gorm:update").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Update().Before("gorm:save_after_associations").Register(unwrap, unwrapRequestIDConnPool),
+		db.Callback().Delete().Before("gorm:delete").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Delete().Before("gorm:after_delete").Register(unwrap, unwrapRequestIDConnPool),
+		db.Callback().Row().Before("gorm:row").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Row().After("gorm:row").Register(unwrap, unwrapRequestIDConnPool),
+		db.Callback().Raw().Before("gorm:raw").Register(wrap, wrapRequestIDConnPool),
+		db.Callback().Raw().After("gorm:raw").Register(unwrap, unwrapRequestIDConnPool),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func wrapRequestIDConnPool(db *gorm.DB) {
+	if db.Statement == nil || db.Statement.ConnPool == nil {
+		return
+	}
+
+	switch db.Statement.ConnPool.(type) {
+	case *gorm.PreparedStmtDB, *gorm.PreparedStmtTX, *requestIDConnPool:
+		return
+	}
+
+	id := helpers.RequestIDFromContext(db.Statement.Context)
+	if !validRequestID(id) {
+		return
+	}
+
+	db.Statement.ConnPool = &requestIDConnPool{ConnPool: db.Statement.ConnPool, comment: " /* req:" + id + " */"}
+}
+
+func unwrapRequestIDConnPool(db *gorm.DB) {
+	if db.Statement == nil {
+		return
+	}
+
+	if pool, ok := db.Statement.ConnPool.(*requestIDConnPool); ok {
+		db.Statement.ConnPool = pool.ConnPool
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestIDConnPool appends the request ID comment to the SQL sent through the connection pool.
+type requestIDConnPool struct {
+	gorm.ConnPool
+	comment string
+}
+
+func (p *requestIDConnPool) PrepareContext(c context.Context, query string) (*sql.Stmt, error) {
+	return p.ConnPool.PrepareContext(c, query+p.comment)
+}
+
+func (p *requestIDConnPool) ExecContext(c context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.ConnPool.ExecContext(c, query+p.comment, args...)
+}
+
+func (p *requestIDConnPool) QueryContext(c context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.ConnPool.QueryContext(c, query+p.comment, args...)
+}
+
+func (p *requestIDConnPool) QueryRowContext(c context.Context, query string, args ...interface{}) *sql.Row {
+	return p.ConnPool.QueryRowContext(c, query+p.comment, args...)
+}
@@ -0,0 +1,103 @@
+package dbdrivers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingConn is a database/sql driver connection which records the SQL and returns no rows.
+type recordingConn struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *recordingConn) Open(string) (driver.Conn, error) { return c, nil }
+func (c *recordingConn) Close() error                     { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)        { return c, nil }
+func (c *recordingConn) Commit() error                    { return nil }
+func (c *recordingConn) Rollback() error                  { return nil }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	c.mu.Lock()
+	c.queries = append(c.queries, query)
+	c.mu.Unlock()
+
+	return recordingStmt{}, nil
+}
+
+func (c *recordingConn) last() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queries[len(c.queries)-1]
+}
+
+type recordingStmt struct{}
+
+func (recordingStmt) Close() error                               { return nil }
+func (recordingStmt) NumInput() int                              { return -1 }
+func (recordingStmt) Exec([]driver.Value) (driver.Result, error) { return recordingResult{}, nil }
+func (recordingStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type recordingResult struct{}
+
+func (recordingResult) LastInsertId() (int64, error) { return 1, nil }
+func (recordingResult) RowsAffected() (int64, error) { return 1, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return []string{"id"} }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+type requestIDUser struct {
+	ID   uint64
+	Name string
+}
+
+func TestRequestIDPlugin(t *testing.T) {
+	conn := &recordingConn{}
+	sql.Register("bean_request_id_test", conn)
+	sqlDB, err := sql.Open("bean_request_id_test", "")
+	require.NoError(t, err)
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(RequestIDPlugin{}))
+
+	ctx := helpers.WithRequestID(context.Background(), "abc-123")
+
+	require.NoError(t, db.WithContext(ctx).Create(&requestIDUser{Name: "a"}).Error)
+	assert.True(t, strings.HasSuffix(conn.last(), " /* req:abc-123 */"), conn.last())
+
+	var users []requestIDUser
+	require.NoError(t, db.WithContext(ctx).Find(&users).Error)
+	assert.True(t, strings.HasSuffix(conn.last(), " /* req:abc-123 */"), conn.last())
+
+	require.NoError(t, db.WithContext(ctx).Exec("UPDATE users SET name = ?", "b").Error)
+	assert.Equal(t, "UPDATE users SET name = ? /* req:abc-123 */", conn.last())
+
+	require.NoError(t, db.WithContext(ctx).Model(&requestIDUser{ID: 1}).Update("name", "c").Error)
+	assert.True(t, strings.HasSuffix(conn.last(), " /* req:abc-123 */"), conn.last())
+
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Equal(t, "SELECT 1", conn.last(), "no request ID")
+
+	evil := helpers.WithRequestID(context.Background(), "x */ DROP TABLE users; /*")
+	require.NoError(t, db.WithContext(evil).Exec("SELECT 1").Error)
+	assert.Equal(t, "SELECT 1", conn.last(), "invalid request ID")
+}
@@ -0,0 +1,242 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ErrResidency is returned when an operation would move the data of a restricted tenant out of its region.
+var ErrResidency = errors.New("data residency violation")
+
+// Residency is the data residency of a tenant, the `residency` object in `TenantConnections.Connections`.
+// The connection objects of a tenant with a residency must be located in its region, either with a
+// `region` field or with a `regions` object which overrides the fields (`host`, `port`, etc.) per region:
+//
+//	{
+//	  "residency": {"region": "eu-west-1", "restricted": true},
+//	  "mysql": {"database": "...", "regions": {"eu-west-1": {"host": "...", "port": "3306"}}},
+//	  "redis": {"region": "eu-west-1", "host": "...", "port": "6379"}
+//	}
+type Residency struct {
+	Region string `json:"region"`
+	// Restricted tenants are skipped by the operations over all tenants (migrations, index syncs, etc.)
+	// running in another region.
+	Restricted bool `json:"restricted"`
+}
+
+var (
+	residenciesMu sync.RWMutex
+	residencies   = map[uint64]Residency{}
+)
+
+// BeforeSave validates the data residency of the tenant when it is provisioned or updated using gorm.
+func (t *TenantConnections) BeforeSave(_ *gorm.DB) error {
+	return ValidateTenantConnections(t.Connections)
+}
+
+// ValidateTenantConnections checks that every connection object in `connections` is located in the region
+// of the tenant residency, if any.
+func ValidateTenantConnections(connections []byte) error {
+	if len(connections) == 0 {
+		return nil
+	}
+
+	var cfgsMap map[string]map[string]interface{}
+	if err := json.Unmarshal(connections, &cfgsMap); err != nil {
+		return errors.WithStack(err)
+	}
+
+	residency, err := parseResidency(cfgsMap)
+	if err != nil {
+		return err
+	}
+
+	if residency.Region == "" {
+		if residency.Restricted {
+			return errors.Wrap(ErrResidency, "restricted tenant without a residency region")
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(cfgsMap))
+	for name := range cfgsMap {
+		if name != "residency" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := residentConfig(residency, cfgsMap[name]); err != nil {
+			return errors.Wrapf(err, "`%s` connection", name)
+		}
+	}
+
+	return nil
+}
+
+// TenantResidency returns the data residency of a tenant loaded with the tenant connections.
+func TenantResidency(tenantID uint64) (Residency, bool) {
+	residenciesMu.RLock()
+	defer residenciesMu.RUnlock()
+
+	residency, ok := residencies[tenantID]
+
+	return residency, ok
+}
+
+// CheckResidency returns `ErrResidency` if the tenant is restricted to a region other than the current
+// region of the service. Call it before an operation over all tenants.
+func CheckResidency(tenantID uint64) error {
+	residency, ok := TenantResidency(tenantID)
+	if !ok || !residency.Restricted {
+		return nil
+	}
+
+	if current := CurrentRegion(); current != residency.Region {
+		return errors.Wrapf(ErrResidency, "tenant %d is restricted to the region `%s`, the current region is `%s`",
+			tenantID, residency.Region, current)
+	}
+
+	return nil
+}
+
+// CurrentRegion returns the region of the service. (see `RegionConfig.Current`)
+func CurrentRegion() string {
+	if Region.Current != "" {
+		return Region.Current
+	}
+
+	envVar := Region.EnvVar
+	if envVar == "" {
+		envVar = DefaultRegionConfig.EnvVar
+	}
+
+	return os.Getenv(envVar)
+}
+
+// loadResidencies validates and keeps the data residency of every tenant. An invalid residency panics
+// like the other invalid tenant connections.
+func loadResidencies(tenantCfgs []*TenantConnections) {
+	loaded := make(map[uint64]Residency, len(tenantCfgs))
+
+	for _, t := range tenantCfgs {
+		if t.Connections == nil {
+			continue
+		}
+
+		if err := ValidateTenantConnections(t.Connections); err != nil {
+			panic(errors.Wrapf(err, "tenant %d", t.TenantID))
+		}
+
+		var cfgsMap map[string]map[string]interface{}
+		if err := json.Unmarshal(t.Connections, &cfgsMap); err != nil {
+			panic(err)
+		}
+
+		if residency, _ := parseResidency(cfgsMap); residency.Region != "" {
+			loaded[t.TenantID] = residency
+		}
+	}
+
+	residenciesMu.Lock()
+	residencies = loaded
+	residenciesMu.Unlock()
+}
+
+// tenantConfig returns the connection object of a tenant with the endpoint of its residency region.
+func tenantConfig(tenantID uint64, cfg map[string]interface{}) map[string]interface{} {
+	residency, ok := TenantResidency(tenantID)
+	if !ok {
+		return cfg
+	}
+
+	resident, err := residentConfig(residency, cfg)
+	if err != nil {
+		panic(errors.Wrapf(err, "tenant %d", tenantID))
+	}
+
+	return resident
+}
+
+func parseResidency(cfgsMap map[string]map[string]interface{}) (Residency, error) {
+	var residency Residency
+
+	cfg, ok := cfgsMap["residency"]
+	if !ok {
+		return residency, nil
+	}
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return residency, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(b, &residency); err != nil {
+		return residency, errors.Wrap(err, "invalid `residency`")
+	}
+	residency.Region = strings.TrimSpace(residency.Region)
+
+	return residency, nil
+}
+
+// residentConfig overrides the fields of `cfg` with the ones of its `regions` entry of the residency region.
+func residentConfig(residency Residency, cfg map[string]interface{}) (map[string]interface{}, error) {
+	if residency.Region == "" {
+		return cfg, nil
+	}
+
+	if regions, ok := cfg["regions"].(map[string]interface{}); ok {
+		override, ok := regions[residency.Region].(map[string]interface{})
+		if !ok {
+			return nil, errors.Wrapf(ErrResidency, "no endpoint in the region `%s`", residency.Region)
+		}
+
+		resident := make(map[string]interface{}, len(cfg)+len(override))
+		for k, v := range cfg {
+			if k != "regions" {
+				resident[k] = v
+			}
+		}
+		for k, v := range override {
+			resident[k] = v
+		}
+		resident["region"] = residency.Region
+
+		return resident, nil
+	}
+
+	if region, _ := cfg["region"].(string); region != residency.Region {
+		return nil, errors.Wrapf(ErrResidency, "located in the region `%s` instead of `%s`", region, residency.Region)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,64 @@
+package dbdrivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestValidateTenantConnections(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections string
+		wantErr     bool
+	}{
+		{"no residency", `{"mysql": {"host": "a"}}`, false},
+		{"region field", `{"residency": {"region": "eu"}, "redis": {"region": "eu", "host": "a"}}`, false},
+		{"regions object", `{"residency": {"region": "eu"}, "mysql": {"regions": {"eu": {"host": "a"}}}}`, false},
+		{"other region", `{"residency": {"region": "eu"}, "redis": {"region": "us", "host": "a"}}`, true},
+		{"no region", `{"residency": {"region": "eu"}, "storage": {"bucket": "a"}}`, true},
+		{"missing regions entry", `{"residency": {"region": "eu"}, "mysql": {"regions": {"us": {"host": "a"}}}}`, true},
+		{"restricted without region", `{"residency": {"restricted": true}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTenantConnections([]byte(tt.connections))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrResidency)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTenantResidency(t *testing.T) {
+	Region = RegionConfig{Current: "us"}
+	defer func() {
+		Region = DefaultRegionConfig
+		loadResidencies(nil)
+	}()
+
+	loadResidencies([]*TenantConnections{
+		{TenantID: 1, Connections: datatypes.JSON(`{"residency": {"region": "eu", "restricted": true}, "mysql": {"host": "default", "port": "3306", "regions": {"eu": {"host": "eu-host"}}}}`)},
+		{TenantID: 2, Connections: datatypes.JSON(`{"residency": {"region": "eu"}, "mysql": {"region": "eu", "host": "eu-host"}}`)},
+		{TenantID: 3, Connections: datatypes.JSON(`{"mysql": {"host": "any"}}`)},
+	})
+
+	residency, ok := TenantResidency(1)
+	require.True(t, ok)
+	assert.Equal(t, Residency{Region: "eu", Restricted: true}, residency)
+
+	cfg := tenantConfig(1, map[string]interface{}{"host": "default", "port": "3306", "regions": map[string]interface{}{"eu": map[string]interface{}{"host": "eu-host"}}})
+	assert.Equal(t, map[string]interface{}{"host": "eu-host", "port": "3306", "region": "eu"}, cfg)
+
+	assert.ErrorIs(t, CheckResidency(1), ErrResidency)
+	assert.NoError(t, CheckResidency(2), "not restricted")
+	assert.NoError(t, CheckResidency(3), "no residency")
+
+	Region.Current = "eu"
+	assert.NoError(t, CheckResidency(1))
+}
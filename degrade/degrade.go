@@ -0,0 +1,266 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package degrade declares how a feature behaves when one of its dependencies is unhealthy: serve the last
+// good data, return a partial response with a warning or hide the section. So that a redis outage degrades
+// the recommendations block of a page instead of answering 500 to the whole page.
+package degrade
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/breaker"
+	"github.com/retail-ai-inc/bean/middleware"
+)
+
+// Fallbacks of a degraded feature.
+const (
+	// FallbackCached serves the last good result of the same request if it's not older than `StaleTTL`,
+	// otherwise it falls back to `FallbackPartial`.
+	FallbackCached = "cached"
+	// FallbackPartial returns no data for the feature and adds the warning to the response.
+	FallbackPartial = "partial"
+	// FallbackHide returns no data for the feature without a warning, the section is just not shown.
+	FallbackHide = "hide"
+)
+
+const (
+	warningsKey = "degrade.warnings"
+	featuresKey = "degrade.features"
+)
+
+// Policy defines the fallback of a feature.
+type Policy struct {
+	// Dependencies are the names of the health checks the feature needs. (see `RegisterCheck`)
+	// Optional. Default value nil, the feature only degrades when it fails.
+	Dependencies []string
+
+	// DegradeAt is the level of a dependency from which the feature degrades, `LevelDegraded` to spare
+	// a slow dependency before it's down.
+	// Optional. Default value `LevelDown`.
+	DegradeAt Level
+
+	// Fallback is `FallbackCached`, `FallbackPartial` or `FallbackHide`.
+	// Optional. Default value `FallbackPartial`.
+	Fallback string
+
+	// Warning is added to the response when the degraded feature returns no data, with `FallbackPartial`
+	// or when `FallbackCached` has no good result to serve.
+	// Optional. Default value "<feature> is temporarily unavailable".
+	Warning string
+
+	// StaleTTL is how long a good result can be served by `FallbackCached`.
+	// Optional. Default value 10m.
+	StaleTTL time.Duration
+
+	// CacheKey identifies the request for `FallbackCached`, it must contain the user or the tenant if the
+	// result depends on them.
+	// Optional. Default value the method, the host and the URI of the request, and the API key or a hash
+	// of the `Authorization` and `Cookie` headers of the caller.
+	CacheKey func(c echo.Context) string
+
+	// IsFailure decides whether an error of the feature degrades it instead of being returned.
+	// Optional. Default value `breaker.IsFailure`.
+	IsFailure func(err error) bool
+}
+
+var (
+	policiesMu sync.RWMutex
+	policies   = make(map[string]Policy)
+)
+
+// RegisterFeature declares the fallback of a feature, the zero fields of `policy` are set to the defaults.
+func RegisterFeature(feature string, policy Policy) {
+	if policy.DegradeAt == LevelOK {
+		policy.DegradeAt = LevelDown
+	}
+	if policy.Fallback == "" {
+		policy.Fallback = FallbackPartial
+	}
+	if policy.Warning == "" {
+		policy.Warning = feature + " is temporarily unavailable"
+	}
+	if policy.StaleTTL <= 0 {
+		policy.StaleTTL = 10 * time.Minute
+	}
+	if policy.CacheKey == nil {
+		policy.CacheKey = defaultCacheKey
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = breaker.IsFailure
+	}
+
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+
+	policies[feature] = policy
+}
+
+// Run calls `fn` unless a dependency of the feature is at its `DegradeAt` level, and applies the fallback
+// of the feature if a dependency is at that level or `fn` fails. A nil result without an error means the feature is degraded
+// and the handler must render the response without it. A feature without a policy just calls `fn`.
+// Example:
+//
+//	recommendations, err := degrade.Run(c, "recommendations", func() (interface{}, error) {
+//		return svc.Recommendations(c.Request().Context(), userID)
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	page.Recommendations, _ = recommendations.([]Product)
+func Run(c echo.Context, feature string, fn func() (interface{}, error)) (interface{}, error) {
+	policiesMu.RLock()
+	policy, ok := policies[feature]
+	policiesMu.RUnlock()
+	if !ok {
+		return fn()
+	}
+
+	cause := ""
+	for _, dependency := range policy.Dependencies {
+		if level := LevelOf(dependency); level >= policy.DegradeAt {
+			cause = dependency + " is " + level.String()
+			break
+		}
+	}
+
+	if cause == "" {
+		result, err := fn()
+		if err == nil {
+			if policy.Fallback == FallbackCached {
+				stale.set(feature+"|"+policy.CacheKey(c), result, policy.StaleTTL)
+			}
+			return result, nil
+		}
+		if !policy.IsFailure(err) {
+			return nil, err
+		}
+		cause = err.Error()
+	}
+
+	return degraded(c, feature, policy, cause), nil
+}
+
+// defaultCacheKey identifies the request and its caller, so that `FallbackCached` never serves the result
+// of a user to another.
+func defaultCacheKey(c echo.Context) string {
+	req := c.Request()
+	key := req.Method + " " + req.Host + req.RequestURI
+
+	if apiKey, ok := middleware.GetAPIKey(c); ok {
+		return key + "|key:" + apiKey.ID
+	}
+
+	authorization, cookie := req.Header.Get(echo.HeaderAuthorization), req.Header.Get("Cookie")
+	if authorization == "" && cookie == "" {
+		return key
+	}
+	sum := sha256.Sum256([]byte(authorization + "\n" + cookie))
+
+	return key + "|" + hex.EncodeToString(sum[:])
+}
+
+// Warnings returns the warnings of the features degraded by the request. The `response` package adds
+// them to the envelope.
+func Warnings(c echo.Context) []string {
+	warnings, _ := c.Get(warningsKey).([]string)
+	return warnings
+}
+
+// Features returns the names of the features degraded by the request.
+func Features(c echo.Context) []string {
+	features, _ := c.Get(featuresKey).([]string)
+	return features
+}
+
+func degraded(c echo.Context, feature string, policy Policy, cause string) interface{} {
+	features := append(Features(c), feature)
+	c.Set(featuresKey, features)
+	middleware.SetLogField(c, "degraded", features)
+
+	if c.Logger() != nil {
+		c.Logger().Warnf("feature %q degraded (%s): %s", feature, policy.Fallback, cause)
+	}
+
+	switch policy.Fallback {
+	case FallbackHide:
+		return nil
+	case FallbackCached:
+		if result, ok := stale.get(feature + "|" + policy.CacheKey(c)); ok {
+			return result
+		}
+	}
+
+	c.Set(warningsKey, append(Warnings(c), policy.Warning))
+
+	return nil
+}
+
+// staleCache keeps the last good results in the memory of the process, since the shared cache can be the
+// unhealthy dependency.
+type staleCache struct {
+	mu         sync.Mutex
+	entries    map[string]staleEntry
+	maxEntries int
+}
+
+type staleEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+var stale = &staleCache{entries: make(map[string]staleEntry), maxEntries: 10000}
+
+func (s *staleCache) set(key string, value interface{}, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		for k, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) >= s.maxEntries {
+			return
+		}
+	}
+
+	s.entries[key] = staleEntry{value: value, expiresAt: now.Add(ttl)}
+}
+
+func (s *staleCache) get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.value, true
+}
@@ -0,0 +1,81 @@
+package degrade
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCacheKey(t *testing.T) {
+	e := echo.New()
+	key := func(header, value string) string {
+		req := httptest.NewRequest(http.MethodGet, "/me/recommendations", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		return defaultCacheKey(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	assert.Equal(t, "GET example.com/me/recommendations", key("", ""))
+	assert.NotEqual(t, key(echo.HeaderAuthorization, "Bearer alice"), key(echo.HeaderAuthorization, "Bearer bob"))
+	assert.NotEqual(t, key("Cookie", "session=alice"), key("Cookie", "session=bob"))
+	assert.Equal(t, key("Cookie", "session=alice"), key("Cookie", "session=alice"))
+}
+
+func TestRun(t *testing.T) {
+	e := echo.New()
+	newContext := func() echo.Context {
+		return e.NewContext(httptest.NewRequest(http.MethodGet, "/products/1", nil), httptest.NewRecorder())
+	}
+
+	RegisterFeature("recommendations", Policy{Dependencies: []string{"redis"}, Fallback: FallbackCached})
+	RegisterFeature("reviews", Policy{Fallback: FallbackHide, IsFailure: func(err error) bool {
+		return !errors.Is(err, errNotFailure)
+	}})
+	defer SetHealthy("redis", true, nil)
+
+	// A good result is kept for the cached fallback.
+	c := newContext()
+	result, err := Run(c, "recommendations", func() (interface{}, error) { return []string{"a"}, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, result)
+
+	SetHealthy("redis", false, errors.New("connection refused"))
+	assert.False(t, Healthy("redis"))
+
+	c = newContext()
+	called := false
+	result, err = Run(c, "recommendations", func() (interface{}, error) { called = true; return nil, nil })
+	assert.NoError(t, err)
+	assert.False(t, called)
+	assert.Equal(t, []string{"a"}, result)
+	assert.Equal(t, []string{"recommendations"}, Features(c))
+	assert.Empty(t, Warnings(c))
+
+	// A cache miss falls back to a partial response.
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/products/2", nil), httptest.NewRecorder())
+	result, err = Run(c, "recommendations", func() (interface{}, error) { return nil, nil })
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Equal(t, []string{"recommendations is temporarily unavailable"}, Warnings(c))
+
+	// A failure of the feature hides it, without a warning.
+	c = newContext()
+	result, err = Run(c, "reviews", func() (interface{}, error) { return nil, errors.New("timeout") })
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Empty(t, Warnings(c))
+	assert.Equal(t, []string{"reviews"}, Features(c))
+
+	// An error which is not a failure is returned, an unknown feature just runs.
+	_, err = Run(c, "reviews", func() (interface{}, error) { return nil, errNotFailure })
+	assert.ErrorIs(t, err, errNotFailure)
+	result, _ = Run(c, "unknown", func() (interface{}, error) { return 1, nil })
+	assert.Equal(t, 1, result)
+}
+
+var errNotFailure = errors.New("not a failure")
@@ -0,0 +1,428 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package degrade
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/breaker"
+)
+
+// Check returns an error when the dependency is unhealthy, like a failed ping.
+type Check func(c context.Context) error
+
+// Level is the health of a dependency, from the best to the worst.
+type Level int
+
+// Levels of a dependency.
+const (
+	// LevelOK is a dependency which works normally.
+	LevelOK Level = iota
+	// LevelDegraded is a dependency which is up but slow or failing some calls, above its `Thresholds`.
+	LevelDegraded
+	// LevelDown is a dependency whose check fails.
+	LevelDown
+)
+
+var levelNames = []string{"ok", "degraded", "down"}
+
+func (l Level) String() string {
+	if l < LevelOK || l > LevelDown {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// MarshalText implements `encoding.TextMarshaler`, the levels are `ok`, `degraded` and `down` in JSON.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements `encoding.TextUnmarshaler`.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel returns the level of `ok`, `degraded` or `down`. An empty string is `LevelOK`.
+func ParseLevel(s string) (Level, error) {
+	if s == "" {
+		return LevelOK, nil
+	}
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelOK, errors.Errorf("degrade: unknown level %q", s)
+}
+
+// Thresholds degrade a dependency which is up but slow or failing, from the latency of its check and
+// the calls reported by `Observe`.
+type Thresholds struct {
+	// Latency above which the dependency is degraded, compared to the latency of the last check and to
+	// the average latency of the recent calls.
+	// Optional. Default value 0, the latency is ignored.
+	Latency time.Duration
+
+	// ErrorRate of the recent calls above which the dependency is degraded, between 0 and 1.
+	// Optional. Default value 0, the error rate is ignored.
+	ErrorRate float64
+
+	// DownErrorRate of the recent calls above which the dependency is down even if its check succeeds.
+	// Optional. Default value 0, the dependency is only down when its check fails.
+	DownErrorRate float64
+
+	// Window is how long the calls are recent.
+	// Optional. Default value 1m.
+	Window time.Duration
+
+	// MinCalls is the number of recent calls under which the error rate is ignored.
+	// Optional. Default value 10.
+	MinCalls int
+}
+
+// Status is the last known health of a dependency.
+type Status struct {
+	// Healthy is false when the dependency is down, a degraded dependency is still healthy.
+	Healthy   bool      `json:"healthy"`
+	Level     Level     `json:"level"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+
+	// Latency is the duration of the last check.
+	Latency time.Duration `json:"latency"`
+
+	// Calls, ErrorRate and CallLatency are the recent calls reported by `Observe`, and their error rate
+	// and average latency.
+	Calls       int           `json:"calls"`
+	ErrorRate   float64       `json:"errorRate"`
+	CallLatency time.Duration `json:"callLatency"`
+
+	// Forced is true when the status is set by `Force` and ignores the checks.
+	Forced bool `json:"forced"`
+}
+
+var (
+	healthMu   sync.RWMutex
+	checks     = make(map[string]Check)
+	statuses   = make(map[string]Status)
+	forced     = make(map[string]Level)
+	thresholds = make(map[string]Thresholds)
+	calls      = make(map[string]*callWindow)
+)
+
+// RegisterCheck registers the health check of a dependency, run by `StartMonitor`. The dependency names
+// are the ones used in `Policy.Dependencies`, like "redis" or "mysql".
+func RegisterCheck(dependency string, check Check) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	checks[dependency] = check
+}
+
+// SetThresholds sets when the dependency is degraded, the zero fields of `t` are set to the defaults.
+func SetThresholds(dependency string, t Thresholds) {
+	if t.Window <= 0 {
+		t.Window = time.Minute
+	}
+	if t.MinCalls <= 0 {
+		t.MinCalls = 10
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	thresholds[dependency] = t
+	calls[dependency] = newCallWindow(t.Window)
+}
+
+// Observe reports a call to the dependency, like a query in a repository, so that its error rate and
+// latency are compared to its `Thresholds`. The calls of a dependency without thresholds are ignored.
+func Observe(dependency string, latency time.Duration, err error) {
+	healthMu.RLock()
+	window := calls[dependency]
+	healthMu.RUnlock()
+
+	if window != nil {
+		window.add(time.Now(), latency, err != nil)
+	}
+}
+
+// SetHealthy sets the status of a dependency from an external signal, like a failed call in a handler.
+// It's overwritten by the next run of the registered check, if any.
+func SetHealthy(dependency string, healthy bool, err error) {
+	setStatus(dependency, healthy, 0, err)
+}
+
+func setStatus(dependency string, healthy bool, latency time.Duration, err error) {
+	status := Status{Healthy: healthy, CheckedAt: time.Now(), Latency: latency}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	statuses[dependency] = status
+}
+
+// Force pins the status of a dependency until `Unforce`, whatever its checks say. Forcing a dependency
+// unhealthy degrades all the features using it, like a maintenance switch.
+func Force(dependency string, healthy bool) {
+	if healthy {
+		ForceLevel(dependency, LevelOK)
+	} else {
+		ForceLevel(dependency, LevelDown)
+	}
+}
+
+// ForceLevel pins the level of a dependency until `Unforce`, whatever its checks and calls say.
+func ForceLevel(dependency string, level Level) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	forced[dependency] = level
+}
+
+// Unforce gives the status of a dependency back to its checks.
+func Unforce(dependency string) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	delete(forced, dependency)
+}
+
+// Healthy reports whether the dependency is not down. A dependency which was never checked is healthy.
+func Healthy(dependency string) bool {
+	return LevelOf(dependency) != LevelDown
+}
+
+// LevelOf returns the level of the dependency. A dependency which was never checked nor called is ok.
+func LevelOf(dependency string) Level {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+
+	return statusOf(dependency, time.Now()).Level
+}
+
+// Statuses returns the status of all the checked, observed and forced dependencies.
+func Statuses() map[string]Status {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+
+	now := time.Now()
+	result := make(map[string]Status, len(statuses)+len(forced)+len(calls))
+	for dependency := range statuses {
+		result[dependency] = statusOf(dependency, now)
+	}
+	for dependency := range forced {
+		result[dependency] = statusOf(dependency, now)
+	}
+	for dependency := range calls {
+		result[dependency] = statusOf(dependency, now)
+	}
+
+	return result
+}
+
+// statusOf computes the level of a dependency from its last check, its recent calls and its thresholds.
+// The caller must hold `healthMu`.
+func statusOf(dependency string, now time.Time) Status {
+	status, checked := statuses[dependency]
+	if !checked {
+		status.Healthy = true
+	}
+
+	if !status.Healthy {
+		status.Level = LevelDown
+	}
+
+	t, ok := thresholds[dependency]
+	if ok {
+		status.Calls, status.ErrorRate, status.CallLatency = calls[dependency].stats(now)
+
+		level := LevelOK
+		if t.Latency > 0 && (status.Latency > t.Latency || status.CallLatency > t.Latency) {
+			level = LevelDegraded
+		}
+		if status.Calls >= t.MinCalls {
+			if t.DownErrorRate > 0 && status.ErrorRate >= t.DownErrorRate {
+				level = LevelDown
+			} else if t.ErrorRate > 0 && status.ErrorRate >= t.ErrorRate && level < LevelDegraded {
+				level = LevelDegraded
+			}
+		}
+		if level > status.Level {
+			status.Level = level
+		}
+	}
+
+	if level, ok := forced[dependency]; ok {
+		status.Level, status.Forced = level, true
+	}
+	status.Healthy = status.Level != LevelDown
+
+	return status
+}
+
+// RunChecks runs all the registered checks concurrently, each with `timeout`, and updates the statuses.
+func RunChecks(c context.Context, timeout time.Duration) {
+	healthMu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	healthMu.RUnlock()
+	sort.Strings(names)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		healthMu.RLock()
+		check := checks[name]
+		healthMu.RUnlock()
+
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runCheck(ctx, check)
+			setStatus(name, err == nil, time.Since(start), err)
+		}(name, check)
+	}
+	wg.Wait()
+}
+
+// StartMonitor runs the registered checks every `interval` until `c` is done. The first run is
+// synchronous, so that the statuses are known when the server starts.
+func StartMonitor(c context.Context, interval, timeout time.Duration) {
+	RunChecks(c, timeout)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+				RunChecks(c, timeout)
+			}
+		}
+	}()
+}
+
+// BreakerCheck reports a dependency as unhealthy while its circuit breaker is open, so that the features
+// degrade as soon as the breaker trips instead of waiting for the next ping.
+func BreakerCheck(b *breaker.Breaker) Check {
+	return func(c context.Context) error {
+		if b.State(c) == breaker.Open {
+			return errors.Errorf("circuit breaker %q is open", b.Name())
+		}
+		return nil
+	}
+}
+
+func runCheck(c context.Context, check Check) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("health check panicked: %v", r)
+		}
+	}()
+
+	return check(c)
+}
+
+// callWindow counts the calls of the last `window` in 10 buckets, the oldest bucket is reused as the
+// time goes.
+type callWindow struct {
+	mu      sync.Mutex
+	width   time.Duration
+	buckets [10]callBucket
+}
+
+type callBucket struct {
+	start   time.Time
+	calls   int
+	errors  int
+	latency time.Duration
+}
+
+func newCallWindow(window time.Duration) *callWindow {
+	return &callWindow{width: window / 10}
+}
+
+func (w *callWindow) add(now time.Time, latency time.Duration, failed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	start := now.Truncate(w.width)
+	b := &w.buckets[int(start.UnixNano()/int64(w.width))%len(w.buckets)]
+	if !b.start.Equal(start) {
+		*b = callBucket{start: start}
+	}
+
+	b.calls++
+	b.latency += latency
+	if failed {
+		b.errors++
+	}
+}
+
+// stats returns the number of calls of the window, their error rate and their average latency.
+func (w *callWindow) stats(now time.Time) (int, float64, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var calls, errors int
+	var latency time.Duration
+	oldest := now.Truncate(w.width).Add(-w.width * time.Duration(len(w.buckets)-1))
+	for _, b := range w.buckets {
+		if b.start.Before(oldest) {
+			continue
+		}
+		calls += b.calls
+		errors += b.errors
+		latency += b.latency
+	}
+
+	if calls == 0 {
+		return 0, 0, 0
+	}
+
+	return calls, float64(errors) / float64(calls), latency / time.Duration(calls)
+}
@@ -0,0 +1,95 @@
+package degrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevels(t *testing.T) {
+	SetThresholds("search", Thresholds{Latency: 100 * time.Millisecond, ErrorRate: 0.1, DownErrorRate: 0.5, MinCalls: 4})
+	defer func() {
+		healthMu.Lock()
+		delete(thresholds, "search")
+		delete(calls, "search")
+		delete(statuses, "search")
+		healthMu.Unlock()
+	}()
+
+	assert.Equal(t, LevelOK, LevelOf("search"))
+
+	// The error rate is ignored under `MinCalls`.
+	Observe("search", time.Millisecond, errors.New("timeout"))
+	assert.Equal(t, LevelOK, LevelOf("search"))
+
+	for i := 0; i < 7; i++ {
+		Observe("search", time.Millisecond, nil)
+	}
+	status := Statuses()["search"]
+	assert.Equal(t, LevelDegraded, status.Level)
+	assert.True(t, status.Healthy)
+	assert.Equal(t, 8, status.Calls)
+	assert.Equal(t, 0.125, status.ErrorRate)
+
+	for i := 0; i < 8; i++ {
+		Observe("search", time.Millisecond, errors.New("timeout"))
+	}
+	assert.Equal(t, LevelDown, LevelOf("search"))
+	assert.False(t, Healthy("search"))
+
+	// A slow check degrades the dependency even without calls.
+	SetThresholds("search", Thresholds{Latency: 100 * time.Millisecond})
+	RegisterCheck("search", func(c context.Context) error {
+		time.Sleep(110 * time.Millisecond)
+		return nil
+	})
+	defer func() {
+		healthMu.Lock()
+		delete(checks, "search")
+		healthMu.Unlock()
+	}()
+	RunChecks(context.Background(), time.Second)
+	assert.Equal(t, LevelDegraded, LevelOf("search"))
+
+	ForceLevel("search", LevelOK)
+	assert.Equal(t, LevelOK, LevelOf("search"))
+	Unforce("search")
+
+	b, err := json.Marshal(Statuses()["search"])
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"level":"degraded"`)
+}
+
+func TestRunDegradeAt(t *testing.T) {
+	RegisterFeature("suggestions", Policy{Dependencies: []string{"suggest"}, DegradeAt: LevelDegraded, Fallback: FallbackHide})
+	RegisterFeature("cart", Policy{Dependencies: []string{"suggest"}})
+	ForceLevel("suggest", LevelDegraded)
+	defer Unforce("suggest")
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	result, err := Run(c, "suggestions", func() (interface{}, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, err = Run(c, "cart", func() (interface{}, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("Degraded")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelDegraded, level)
+
+	_, err = ParseLevel("broken")
+	assert.Error(t, err)
+}
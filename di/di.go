@@ -0,0 +1,453 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package di is a lightweight dependency injection container. The handlers, services and repositories
+// are provided by their constructors, plain functions whose parameters are their dependencies, and
+// resolved lazily: once for the application, once per request or on every use. The constructors don't
+// depend on the container, so the same ones can be given to `fx.Provide` or to a `wire.NewSet`.
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Lifetime is how long an instance is reused.
+type Lifetime int
+
+const (
+	// Singleton instances are created on the first resolve and reused by the whole application.
+	Singleton Lifetime = iota
+	// Scoped instances are created once per scope, a request for `Middleware`. (example: a repository
+	// of the database of the tenant of the request)
+	Scoped
+	// Transient instances are created on every resolve.
+	Transient
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case Singleton:
+		return "singleton"
+	case Scoped:
+		return "scoped"
+	case Transient:
+		return "transient"
+	}
+	return fmt.Sprintf("lifetime(%d)", int(l))
+}
+
+var (
+	// ErrNotProvided is returned when no constructor provides a type.
+	ErrNotProvided = errors.New("di: not provided")
+	// ErrCycle is returned when the dependencies of a constructor depend on its type.
+	ErrCycle = errors.New("di: dependency cycle")
+	// ErrOutOfScope is returned when a scoped type is resolved outside of a scope, or by a singleton.
+	ErrOutOfScope = errors.New("di: scoped type resolved outside of a scope")
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ProvideOption configures a constructor.
+type ProvideOption func(p *provider)
+
+// AsScoped creates one instance of the constructor per scope.
+func AsScoped() ProvideOption {
+	return func(p *provider) {
+		p.lifetime = Scoped
+	}
+}
+
+// AsTransient creates an instance of the constructor on every resolve.
+func AsTransient() ProvideOption {
+	return func(p *provider) {
+		p.lifetime = Transient
+	}
+}
+
+type provider struct {
+	constructor interface{}
+	fn          reflect.Value
+	out         reflect.Type
+	params      []reflect.Type
+	hasErr      bool
+	lifetime    Lifetime
+
+	// The instance of a singleton, created under `mu`.
+	mu       sync.Mutex
+	instance *reflect.Value
+}
+
+// Container holds the constructors and the singletons, `Scope` returns a child container holding the
+// scoped instances.
+type Container struct {
+	root *Container
+
+	mu        sync.RWMutex
+	providers map[reflect.Type]*provider
+	order     []*provider
+
+	// The scoped instances and the values supplied to the scope.
+	scopeMu   sync.Mutex
+	instances map[reflect.Type]reflect.Value
+}
+
+// New returns an empty container.
+func New() *Container {
+	return &Container{providers: make(map[reflect.Type]*provider)}
+}
+
+// Provide registers a constructor, a function returning the provided type and optionally an error. Its
+// parameters are resolved from the container. The instances are singletons unless `AsScoped` or
+// `AsTransient` is given. A constructor of the same type replaces the previous one.
+// Example:
+//
+//	container.Provide(repositories.NewOrderRepository, di.AsScoped())
+//	container.Provide(services.NewOrderService, di.AsScoped())
+//	container.Provide(handlers.NewOrderHandler, di.AsScoped())
+func (c *Container) Provide(constructor interface{}, opts ...ProvideOption) error {
+	if c.root != nil {
+		return errors.New("di: the constructors are provided to the root container")
+	}
+
+	fn := reflect.ValueOf(constructor)
+	t := fn.Type()
+	if t.Kind() != reflect.Func {
+		return fmt.Errorf("di: constructor must be a function, got %s", t)
+	}
+	if t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return fmt.Errorf("di: constructor %s must return a value and optionally an error", t)
+	}
+	if t.IsVariadic() {
+		return fmt.Errorf("di: constructor %s can't be variadic", t)
+	}
+
+	p := &provider{constructor: constructor, fn: fn, out: t.Out(0), hasErr: t.NumOut() == 2}
+	for i := 0; i < t.NumIn(); i++ {
+		p.params = append(p.params, t.In(i))
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.providers[p.out]; ok {
+		for i, o := range c.order {
+			if o == old {
+				c.order = append(c.order[:i:i], c.order[i+1:]...)
+				break
+			}
+		}
+	}
+	c.providers[p.out] = p
+	c.order = append(c.order, p)
+
+	return nil
+}
+
+// Supply provides the values as singletons of their types, to a scope the values are scoped. Use
+// `Provide` with a function for an interface type. (example: `func() echo.Logger { return e.Logger }`)
+func (c *Container) Supply(values ...interface{}) {
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+		if c.root != nil {
+			c.scopeMu.Lock()
+			c.instances[v.Type()] = v
+			c.scopeMu.Unlock()
+			continue
+		}
+
+		fn := reflect.MakeFunc(reflect.FuncOf(nil, []reflect.Type{v.Type()}, false), func([]reflect.Value) []reflect.Value {
+			return []reflect.Value{v}
+		})
+		_ = c.Provide(fn.Interface())
+	}
+}
+
+// Scope returns a child container of the root container for the scoped instances, like a request.
+func (c *Container) Scope() *Container {
+	root := c
+	if c.root != nil {
+		root = c.root
+	}
+
+	return &Container{root: root, instances: make(map[reflect.Type]reflect.Value)}
+}
+
+// Resolve returns the instance of the type `T`.
+func Resolve[T any](c *Container) (T, error) {
+	var zero T
+	v, err := c.resolve(reflect.TypeOf((*T)(nil)).Elem(), nil)
+	if err != nil {
+		return zero, err
+	}
+
+	return v.Interface().(T), nil
+}
+
+// MustResolve returns the instance of the type `T`, it panics on an error. (example: at the startup)
+func MustResolve[T any](c *Container) T {
+	v, err := Resolve[T](c)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// Invoke calls `fn` with its parameters resolved from the container and returns its error if the last
+// result of `fn` is an error.
+func (c *Container) Invoke(fn interface{}) error {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		return fmt.Errorf("di: invoke expects a function, got %T", fn)
+	}
+
+	args, err := c.args(f.Type(), 0)
+	if err != nil {
+		return err
+	}
+
+	out := f.Call(args)
+	if n := len(out); n > 0 && f.Type().Out(n-1) == errorType && !out[n-1].IsNil() {
+		return out[n-1].Interface().(error)
+	}
+
+	return nil
+}
+
+// Validate checks that the parameters of all the constructors are provided, without a cycle and that
+// no singleton depends on a scoped type, so that a missing constructor fails at the startup rather
+// than at the first request.
+func (c *Container) Validate() error {
+	root := c
+	if c.root != nil {
+		root = c.root
+	}
+
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+
+	var (
+		first error
+		rest  []string
+	)
+	for _, p := range root.order {
+		if err := root.check(p, nil); err != nil {
+			if first == nil {
+				first = err
+				continue
+			}
+			rest = append(rest, err.Error())
+		}
+	}
+
+	// The first error is wrapped so that `errors.Is` finds it.
+	if len(rest) > 0 {
+		return fmt.Errorf("%w; %s", first, strings.Join(rest, "; "))
+	}
+
+	return first
+}
+
+// check validates the dependencies of the provider, `root.mu` is held.
+func (c *Container) check(p *provider, stack []reflect.Type) error {
+	for _, t := range stack {
+		if t == p.out {
+			return fmt.Errorf("%w: %s", ErrCycle, path(append(stack, p.out)))
+		}
+	}
+	stack = append(stack, p.out)
+
+	for _, param := range p.params {
+		dep, ok := c.providers[param]
+		if !ok {
+			if isScopeValue(param) {
+				if p.lifetime == Singleton {
+					return fmt.Errorf("%w: %s needs %s", ErrOutOfScope, p.out, param)
+				}
+				continue
+			}
+			return fmt.Errorf("%w: %s needed by %s", ErrNotProvided, param, p.out)
+		}
+		if p.lifetime == Singleton && dep.lifetime == Scoped {
+			return fmt.Errorf("%w: singleton %s needs %s", ErrOutOfScope, p.out, param)
+		}
+		if err := c.check(dep, stack); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Constructors returns the registered constructors in order, to give them to another container.
+// Example:
+//
+//	fx.New(fx.Provide(container.Constructors()...), fx.Invoke(register))
+func (c *Container) Constructors() []interface{} {
+	root := c
+	if c.root != nil {
+		root = c.root
+	}
+
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+
+	constructors := make([]interface{}, 0, len(root.order))
+	for _, p := range root.order {
+		constructors = append(constructors, p.constructor)
+	}
+
+	return constructors
+}
+
+func (c *Container) resolve(t reflect.Type, stack []reflect.Type) (reflect.Value, error) {
+	for _, s := range stack {
+		if s == t {
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrCycle, path(append(stack, t)))
+		}
+	}
+
+	// The values supplied to the scope win.
+	if c.root != nil {
+		c.scopeMu.Lock()
+		v, ok := c.instances[t]
+		c.scopeMu.Unlock()
+		if ok {
+			return v, nil
+		}
+	}
+
+	root := c
+	if c.root != nil {
+		root = c.root
+	}
+
+	root.mu.RLock()
+	p, ok := root.providers[t]
+	root.mu.RUnlock()
+	if !ok {
+		if c.root == nil && isScopeValue(t) {
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrOutOfScope, t)
+		}
+		return reflect.Value{}, fmt.Errorf("%w: %s", ErrNotProvided, t)
+	}
+
+	stack = append(stack, t)
+
+	switch p.lifetime {
+	case Singleton:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.instance != nil {
+			return *p.instance, nil
+		}
+		// A singleton only depends on the singletons, whatever the container resolving it.
+		v, err := root.construct(p, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p.instance = &v
+		return v, nil
+
+	case Scoped:
+		if c.root == nil {
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrOutOfScope, t)
+		}
+		v, err := c.construct(p, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		// The first instance wins if the type is resolved concurrently.
+		c.scopeMu.Lock()
+		defer c.scopeMu.Unlock()
+		if existing, ok := c.instances[t]; ok {
+			return existing, nil
+		}
+		c.instances[t] = v
+		return v, nil
+
+	default:
+		return c.construct(p, stack)
+	}
+}
+
+func (c *Container) construct(p *provider, stack []reflect.Type) (reflect.Value, error) {
+	args := make([]reflect.Value, len(p.params))
+	for i, param := range p.params {
+		v, err := c.resolve(param, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		args[i] = v
+	}
+
+	out := p.fn.Call(args)
+	if p.hasErr && !out[1].IsNil() {
+		return reflect.Value{}, fmt.Errorf("di: %s: %w", p.out, out[1].Interface().(error))
+	}
+
+	return out[0], nil
+}
+
+func (c *Container) args(t reflect.Type, skip int) ([]reflect.Value, error) {
+	args := make([]reflect.Value, 0, t.NumIn())
+	for i := skip; i < t.NumIn(); i++ {
+		v, err := c.resolve(t.In(i), nil)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	return args, nil
+}
+
+var (
+	echoContextType = reflect.TypeOf((*echo.Context)(nil)).Elem()
+	contextType     = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// isScopeValue returns true for the types supplied to the scope of a request by `Middleware`.
+func isScopeValue(t reflect.Type) bool {
+	return t == echoContextType || t == contextType
+}
+
+func path(stack []reflect.Type) string {
+	names := make([]string, len(stack))
+	for i, t := range stack {
+		names[i] = t.String()
+	}
+
+	return strings.Join(names, " -> ")
+}
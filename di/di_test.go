@@ -0,0 +1,141 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type config struct{ DSN string }
+
+type db struct{ dsn string }
+
+type repository interface{ Tenant() string }
+
+type tenantRepository struct {
+	db     *db
+	tenant string
+}
+
+func (r *tenantRepository) Tenant() string { return r.tenant }
+
+type service struct{ repo repository }
+
+func TestContainer(t *testing.T) {
+	c := New()
+	c.Supply(&config{DSN: "mysql://"})
+
+	var dbCalls int
+	require.NoError(t, c.Provide(func(cfg *config) (*db, error) {
+		dbCalls++
+		return &db{dsn: cfg.DSN}, nil
+	}))
+	require.NoError(t, c.Provide(func(d *db, ec echo.Context) repository {
+		return &tenantRepository{db: d, tenant: ec.Request().Header.Get("X-Tenant-ID")}
+	}, AsScoped()))
+	require.NoError(t, c.Provide(func(r repository) *service { return &service{repo: r} }, AsTransient()))
+	require.NoError(t, c.Validate())
+
+	d1 := MustResolve[*db](c)
+	d2 := MustResolve[*db](c)
+	assert.Same(t, d1, d2)
+	assert.Equal(t, "mysql://", d1.dsn)
+	assert.Equal(t, 1, dbCalls)
+
+	_, err := Resolve[repository](c)
+	assert.ErrorIs(t, err, ErrOutOfScope)
+	_, err = Resolve[*http.Client](c)
+	assert.ErrorIs(t, err, ErrNotProvided)
+
+	e := echo.New()
+	e.Use(Middleware(c))
+	e.GET("/orders", Handler(func(ec echo.Context, s1 *service, s2 *service, r repository) error {
+		assert.NotSame(t, s1, s2)
+		assert.Same(t, s1.repo, r)
+		assert.Same(t, d1, r.(*tenantRepository).db)
+
+		ctx, err := Get[context.Context](ec)
+		require.NoError(t, err)
+		assert.Equal(t, ec.Request().Context(), ctx)
+
+		return ec.String(http.StatusOK, r.Tenant())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("X-Tenant-ID", "42")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "42", rec.Body.String())
+	assert.Len(t, c.Constructors(), 4)
+}
+
+func TestContainerErrors(t *testing.T) {
+	c := New()
+	assert.Error(t, c.Provide("not a function"))
+	assert.Error(t, c.Provide(func() {}))
+	assert.Error(t, c.Provide(func() (int, string) { return 0, "" }))
+
+	require.NoError(t, c.Provide(func(s *service) *db { return nil }))
+	require.NoError(t, c.Provide(func(d *db) *service { return nil }))
+	_, err := Resolve[*db](c)
+	assert.ErrorIs(t, err, ErrCycle)
+	assert.EqualError(t, err, "di: dependency cycle: *di.db -> *di.service -> *di.db")
+	assert.ErrorIs(t, c.Validate(), ErrCycle)
+
+	c = New()
+	require.NoError(t, c.Provide(func(ec echo.Context) repository { return nil }, AsScoped()))
+	require.NoError(t, c.Provide(func(r repository) *service { return nil }))
+	assert.ErrorIs(t, c.Validate(), ErrOutOfScope)
+	_, err = Resolve[*service](c.Scope())
+	assert.ErrorIs(t, err, ErrOutOfScope, "a singleton can't capture a scoped instance")
+
+	c = New()
+	require.NoError(t, c.Provide(func(cfg *config) (*db, error) { return nil, errors.New("connection refused") }))
+	assert.ErrorIs(t, c.Validate(), ErrNotProvided)
+	c.Supply(&config{})
+	assert.NoError(t, c.Validate())
+	_, err = Resolve[*db](c)
+	assert.EqualError(t, err, "di: *di.db: connection refused")
+	assert.Error(t, c.Scope().Provide(func() int { return 1 }))
+}
+
+func TestContainerConcurrentSingleton(t *testing.T) {
+	c := New()
+
+	var calls int
+	require.NoError(t, c.Provide(func() *db {
+		calls++
+		return &db{}
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = MustResolve[*db](c.Scope())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestInvoke(t *testing.T) {
+	c := New()
+	c.Supply(&config{DSN: "redis://"})
+
+	var dsn string
+	assert.NoError(t, c.Invoke(func(cfg *config) { dsn = cfg.DSN }))
+	assert.Equal(t, "redis://", dsn)
+	assert.EqualError(t, c.Invoke(func(cfg *config) error { return errors.New("boom") }), "boom")
+	assert.ErrorIs(t, c.Invoke(func(d *db) {}), ErrNotProvided)
+}
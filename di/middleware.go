@@ -0,0 +1,103 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package di
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key of the scope of the request in the echo context.
+const ContextKey = "di.scope"
+
+// Middleware creates the scope of every request, with the `echo.Context` and the `context.Context` of
+// the request supplied to it.
+func Middleware(container *Container) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scope := container.Scope()
+			scope.instances[echoContextType] = reflect.ValueOf(&c).Elem()
+			scope.instances[contextType] = reflect.ValueOf(c.Request().Context())
+			c.Set(ContextKey, scope)
+
+			return next(c)
+		}
+	}
+}
+
+// FromContext returns the scope of the request, nil without `Middleware`.
+func FromContext(c echo.Context) *Container {
+	scope, _ := c.Get(ContextKey).(*Container)
+	return scope
+}
+
+// Get returns the instance of the type `T` from the scope of the request.
+func Get[T any](c echo.Context) (T, error) {
+	scope := FromContext(c)
+	if scope == nil {
+		var zero T
+		return zero, fmt.Errorf("%w: no scope in the request, use `di.Middleware`", ErrOutOfScope)
+	}
+
+	return Resolve[T](scope)
+}
+
+// Handler returns a handler calling `fn`, a function whose first parameter is the `echo.Context` and
+// the next ones are resolved from the scope of the request, returning an error.
+// Example:
+//
+//	e.GET("/orders", di.Handler(func(c echo.Context, svc services.OrderService) error {
+//		orders, err := svc.List(c.Request().Context())
+//		if err != nil {
+//			return err
+//		}
+//		return c.JSON(http.StatusOK, orders)
+//	}))
+func Handler(fn interface{}) echo.HandlerFunc {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() == 0 || t.In(0) != echoContextType || t.NumOut() != 1 || t.Out(0) != errorType {
+		panic(fmt.Sprintf("di: handler must be a func(echo.Context, ...) error, got %T", fn))
+	}
+
+	return func(c echo.Context) error {
+		scope := FromContext(c)
+		if scope == nil {
+			return fmt.Errorf("%w: no scope in the request, use `di.Middleware`", ErrOutOfScope)
+		}
+
+		args, err := scope.args(t, 1)
+		if err != nil {
+			return err
+		}
+
+		out := f.Call(append([]reflect.Value{reflect.ValueOf(&c).Elem()}, args...))
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
@@ -24,6 +24,7 @@ package echoview
 
 import (
 	"io"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/retail-ai-inc/bean/goview"
@@ -31,9 +32,19 @@ import (
 
 const templateEngineKey = "foolin-goview-echoview"
 
+// csrfContextKey is the same key as `middleware.CSRFContextKey`.
+const csrfContextKey = "csrf"
+
+// localeContextKey is the same key as `i18n.LocaleContextKey`.
+const localeContextKey = "locale"
+
 // ViewEngine view engine for echo
 type ViewEngine struct {
 	*goview.ViewEngine
+
+	// FragmentScope returns the tenant and the locale of the cached fragments of a request. The default
+	// is the `X-Tenant-ID` header and the first language of the `Accept-Language` header.
+	FragmentScope func(c echo.Context) goview.FragmentScope
 }
 
 // New new view engine
@@ -54,8 +65,11 @@ func Default() *ViewEngine {
 }
 
 // Render render template for echo interface
+// The CSRF token of the request is added to the `csrf` key of a map data, if it's not set yet. So are the
+// locale to the `locale` key and the fragment scope to the `fragmentScope` key.
 func (e *ViewEngine) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	return e.RenderWriter(w, name, data)
+	data = withContextValue(withContextValue(data, c, csrfContextKey), c, localeContextKey)
+	return e.RenderWriter(w, name, e.withFragmentScope(data, c))
 }
 
 // Render html render for template
@@ -70,6 +84,73 @@ func Render(ctx echo.Context, code int, name string, data interface{}) error {
 	return ctx.Render(code, name, data)
 }
 
+// withContextValue adds the string value of `key` in the echo context to the same key of a map data.
+func withContextValue(data interface{}, c echo.Context, key string) interface{} {
+	if c == nil {
+		return data
+	}
+
+	value, ok := c.Get(key).(string)
+	if !ok {
+		return data
+	}
+
+	switch m := data.(type) {
+	case echo.Map:
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	case map[string]interface{}:
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	case nil:
+		return echo.Map{key: value}
+	}
+
+	return data
+}
+
+func (e *ViewEngine) withFragmentScope(data interface{}, c echo.Context) interface{} {
+	if c == nil {
+		return data
+	}
+
+	scope := e.FragmentScope
+	if scope == nil {
+		scope = DefaultFragmentScope
+	}
+
+	switch m := data.(type) {
+	case echo.Map:
+		if _, ok := m[goview.FragmentScopeKey]; !ok {
+			m[goview.FragmentScopeKey] = scope(c)
+		}
+	case map[string]interface{}:
+		if _, ok := m[goview.FragmentScopeKey]; !ok {
+			m[goview.FragmentScopeKey] = scope(c)
+		}
+	}
+
+	return data
+}
+
+// DefaultFragmentScope returns the `X-Tenant-ID` header and the first language of the `Accept-Language`
+// header of the request.
+func DefaultFragmentScope(c echo.Context) goview.FragmentScope {
+	req := c.Request()
+
+	locale := req.Header.Get("Accept-Language")
+	if i := strings.IndexAny(locale, ",;"); i >= 0 {
+		locale = locale[:i]
+	}
+
+	return goview.FragmentScope{
+		Tenant: req.Header.Get("X-Tenant-ID"),
+		Locale: strings.ToLower(strings.TrimSpace(locale)),
+	}
+}
+
 // NewMiddleware echo middleware for func `echoview.Render()`
 func NewMiddleware(config goview.Config) echo.MiddlewareFunc {
 	return Middleware(New(config))
@@ -34,6 +34,7 @@ type APIError struct {
 	GlobalErrCode  ErrorCode
 	Err            error
 	Ignorable      bool // An extra option to control the behaviour. (example: push to some error tracker or not)
+	Retryable      bool // The same request may succeed later. (example: deadlock or connection refused)
 	*stacktrace.Stack
 }
 
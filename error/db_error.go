@@ -0,0 +1,174 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package error
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// StatusClientClosedRequest is the non-standard status code (nginx) of a request canceled by the client.
+const StatusClientClosedRequest = 499
+
+// MySQL error numbers which are mapped by `MapDBError`.
+const (
+	mysqlErrTooManyConnections = 1040
+	mysqlErrLockWaitTimeout    = 1205
+	mysqlErrLockDeadlock       = 1213
+	mysqlErrDuplicateEntry     = 1062
+	mysqlErrRowIsReferenced    = 1451
+	mysqlErrNoReferencedRow    = 1452
+)
+
+// Prefixes of the redis errors which mean the server is temporarily unable to serve the command.
+var redisRetryablePrefixes = []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "}
+
+// DBErrorMapper converts a database error into an `APIError`. It returns nil if it doesn't know the error.
+type DBErrorMapper func(err error) *APIError
+
+var (
+	dbErrorMappersMu sync.RWMutex
+	dbErrorMappers   []DBErrorMapper
+)
+
+// RegisterDBErrorMapper adds a mapper which is tried before the builtin mapping of `MapDBError`.
+// (example: to map a custom MySQL error number or a check constraint)
+func RegisterDBErrorMapper(mapper DBErrorMapper) {
+	dbErrorMappersMu.Lock()
+	defer dbErrorMappersMu.Unlock()
+
+	dbErrorMappers = append(dbErrorMappers, mapper)
+}
+
+// MapDBError converts the common MySQL, mongo and redis errors into an `APIError` with the proper HTTP
+// status and retryability, or returns nil if `err` is not a known database error.
+func MapDBError(err error) *APIError {
+	if err == nil {
+		return nil
+	}
+
+	dbErrorMappersMu.RLock()
+	mappers := dbErrorMappers
+	dbErrorMappersMu.RUnlock()
+
+	for _, mapper := range mappers {
+		if apiErr := mapper(err); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return NewIgnorableAPIError(StatusClientClosedRequest, REQUEST_CANCELED, err)
+
+	case errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return newRetryableAPIError(http.StatusGatewayTimeout, TIMEOUT, err)
+
+	case errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, mongo.ErrNoDocuments):
+		return NewIgnorableAPIError(http.StatusNotFound, RESOURCE_NOT_FOUND, err)
+
+	case mongo.IsDuplicateKeyError(err):
+		return NewIgnorableAPIError(http.StatusConflict, RESOURCE_CONFLICT, err)
+
+	case mongo.IsNetworkError(err) || hasMongoErrorLabel(err, "TransientTransactionError"):
+		return newRetryableAPIError(http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrDuplicateEntry, mysqlErrRowIsReferenced, mysqlErrNoReferencedRow:
+			return NewIgnorableAPIError(http.StatusConflict, RESOURCE_CONFLICT, err)
+		case mysqlErrLockDeadlock, mysqlErrLockWaitTimeout, mysqlErrTooManyConnections:
+			return newRetryableAPIError(http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, err)
+		}
+
+		return nil
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range redisRetryablePrefixes {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return newRetryableAPIError(http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, err)
+			}
+		}
+
+		return nil
+	}
+
+	if isConnectionError(err) {
+		return newRetryableAPIError(http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, err)
+	}
+
+	return nil
+}
+
+// DBErrorHanderFunc responds the database errors mapped by `MapDBError` same as `APIErrorHanderFunc`.
+// A `Retry-After` header is added if the request can be retried.
+func DBErrorHanderFunc(e error, c echo.Context) (bool, error) {
+	apiErr := MapDBError(e)
+	if apiErr == nil {
+		return false, nil
+	}
+
+	if apiErr.Retryable && apiErr.HTTPStatusCode == http.StatusServiceUnavailable {
+		c.Response().Header().Set("Retry-After", "1")
+	}
+
+	return APIErrorHanderFunc(apiErr, c)
+}
+
+func newRetryableAPIError(HTTPStatusCode int, globalErrCode ErrorCode, err error) *APIError {
+	e := NewAPIError(HTTPStatusCode, globalErrCode, err)
+	e.Retryable = true
+	return e
+}
+
+func hasMongoErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel(label)
+	}
+
+	return false
+}
+
+func isConnectionError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, redis.ErrClosed)
+}
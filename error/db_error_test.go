@@ -0,0 +1,71 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package error
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+func TestMapDBError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		code      ErrorCode
+		retryable bool
+	}{
+		{"duplicate entry", &mysql.MySQLError{Number: 1062}, http.StatusConflict, RESOURCE_CONFLICT, false},
+		{"foreign key", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1452}), http.StatusConflict, RESOURCE_CONFLICT, false},
+		{"deadlock", &mysql.MySQLError{Number: 1213}, http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, true},
+		{"mongo duplicate key", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, http.StatusConflict, RESOURCE_CONFLICT, false},
+		{"not found", gorm.ErrRecordNotFound, http.StatusNotFound, RESOURCE_NOT_FOUND, false},
+		{"canceled", context.Canceled, StatusClientClosedRequest, REQUEST_CANCELED, false},
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, TIMEOUT, true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), http.StatusServiceUnavailable, SERVICE_UNAVAILABLE, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := MapDBError(tt.err)
+			if assert.NotNil(t, apiErr) {
+				assert.Equal(t, tt.status, apiErr.HTTPStatusCode)
+				assert.Equal(t, tt.code, apiErr.GlobalErrCode)
+				assert.Equal(t, tt.retryable, apiErr.Retryable)
+			}
+		})
+	}
+
+	assert.Nil(t, MapDBError(nil))
+	assert.Nil(t, MapDBError(errors.New("fake")))
+	assert.Nil(t, MapDBError(&mysql.MySQLError{Number: 1064}))
+}
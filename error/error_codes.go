@@ -36,7 +36,15 @@ const (
 	INTERNAL_SERVER_ERROR    ErrorCode = "100004"
 	REQUEST_ENTITY_TOO_LARGE ErrorCode = "100005"
 	METHOD_NOT_ALLOWED       ErrorCode = "100006"
+	RESOURCE_CONFLICT        ErrorCode = "100007"
+	SERVICE_UNAVAILABLE      ErrorCode = "100008"
+	REQUEST_CANCELED         ErrorCode = "100009"
 	TOO_MANY_REQUESTS        ErrorCode = "100010"
+	PRECONDITION_FAILED      ErrorCode = "100011"
+	PRECONDITION_REQUIRED    ErrorCode = "100012"
+	REQUEST_REPLAYED         ErrorCode = "100013"
+	UNSUPPORTED_MEDIA_TYPE   ErrorCode = "100014"
+	FILE_REJECTED            ErrorCode = "100015"
 	UNKNOWN_ERROR_CODE       ErrorCode = "100098"
 	TIMEOUT                  ErrorCode = "100099"
 
@@ -47,7 +47,7 @@ func ValidationErrorHanderFunc(e error, c echo.Context) (bool, error) {
 	}
 	err := c.JSON(http.StatusBadRequest, errorResp{
 		ErrorCode: API_DATA_VALIDATION_FAILED,
-		ErrorMsg:  he.ErrCollection(),
+		ErrorMsg:  he.Fields(validator.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))...),
 	})
 
 	return ok, err
@@ -0,0 +1,152 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+)
+
+// MemoryBackend delivers the messages to the bus of the process only, for a single instance.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	receive func(msg *Message)
+}
+
+// NewMemoryBackend returns an in-process backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+// Publish implements `Backend`.
+func (m *MemoryBackend) Publish(c context.Context, msg *Message) error {
+	m.mu.RLock()
+	receive := m.receive
+	m.mu.RUnlock()
+
+	if receive == nil {
+		return ErrClosed
+	}
+
+	receive(msg)
+
+	return nil
+}
+
+// Start implements `Backend`.
+func (m *MemoryBackend) Start(receive func(msg *Message)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.receive = receive
+
+	return nil
+}
+
+// Close implements `Backend`.
+func (m *MemoryBackend) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.receive = nil
+
+	return nil
+}
+
+// RedisBackend fans the messages out to the buses of all the replicas through redis pub/sub, on the
+// channel `prefix + topic`. Like any redis pub/sub, a message published while a replica is disconnected is
+// lost for that replica.
+type RedisBackend struct {
+	client redis.UniversalClient
+	prefix string
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+// NewRedisBackend returns a redis pub/sub backend, the prefix is "event:" if `prefix` is empty.
+func NewRedisBackend(client redis.UniversalClient, prefix string) *RedisBackend {
+	if prefix == "" {
+		prefix = "event:"
+	}
+
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+// Publish implements `Backend`.
+func (r *RedisBackend) Publish(c context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(r.client.Publish(c, r.prefix+msg.Topic, data).Err())
+}
+
+// Start implements `Backend`.
+func (r *RedisBackend) Start(receive func(msg *Message)) error {
+	ctx := context.Background()
+
+	r.pubsub = r.client.PSubscribe(ctx, r.prefix+"*")
+
+	// Wait for the subscription so that the messages published after `Start` are received.
+	if _, err := r.pubsub.Receive(ctx); err != nil {
+		r.pubsub.Close()
+		return errors.WithStack(err)
+	}
+
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		for m := range r.pubsub.Channel() {
+			var msg Message
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				bean.Logger().Errorf("event: invalid message on channel %s: %v", m.Channel, err)
+				continue
+			}
+
+			receive(&msg)
+		}
+	}()
+
+	return nil
+}
+
+// Close implements `Backend`.
+func (r *RedisBackend) Close() error {
+	if r.pubsub == nil {
+		return nil
+	}
+
+	err := r.pubsub.Close()
+	<-r.done
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,313 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package event publishes events to the handlers subscribed to their topic, in the process with
+// `MemoryBackend` or across the replicas with `RedisBackend`. The handlers run in safe goroutines of
+// the async package, a panic is recovered and sent to sentry.
+//
+// Declare the topics with their payload type next to the code publishing them:
+//
+//	var OrderPlaced = event.NewTopic[OrderPlacedPayload]("order.placed")
+//
+//	bus := event.NewBus(event.NewRedisBackend(client, "myapp:event:"), event.Config{Pool: "events"})
+//	bus.Use(event.Logging(), event.Tracing())
+//	OrderPlaced.Subscribe(bus, func(c context.Context, p OrderPlacedPayload) error {
+//		return mailer.SendReceipt(c, p.OrderID)
+//	})
+//	if err := bus.Start(); err != nil {
+//		panic(err)
+//	}
+//
+//	err := OrderPlaced.Publish(c, bus, OrderPlacedPayload{OrderID: id})
+//
+// The bus is closed by `bean.Cleanup`.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+var (
+	// ErrNotStarted is returned by `Publish` before `Start`.
+	ErrNotStarted = errors.New("event: bus is not started")
+
+	// ErrClosed is returned by `Publish` and `Start` after `Close`.
+	ErrClosed = errors.New("event: bus is closed")
+)
+
+// Message is an event of a topic as transported by the backends.
+type Message struct {
+	ID          string          `json:"id"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+	RequestID   string          `json:"requestId,omitempty"`
+	PublishedAt time.Time       `json:"publishedAt"`
+}
+
+// Handler handles the messages of a topic.
+type Handler func(c context.Context, msg *Message) error
+
+// Middleware wraps the handlers of a bus.
+type Middleware func(next Handler) Handler
+
+// Backend transports the messages to the buses subscribed to their topic.
+type Backend interface {
+	// Publish sends `msg` to all the buses of the backend, including the publishing one.
+	Publish(c context.Context, msg *Message) error
+
+	// Start passes the messages to `receive` until `Close` is called.
+	Start(receive func(msg *Message)) error
+
+	Close() error
+}
+
+// Config defines the config for `NewBus`.
+type Config struct {
+	// Pool is the name of the goroutine pool which executes the handlers.
+	// Optional. Default value "", a new goroutine per handler.
+	Pool string
+
+	// Timeout is the deadline of a handler.
+	// Optional. Default value 30s.
+	Timeout time.Duration
+}
+
+// Bus dispatches the messages of its backend to the subscribed handlers, safe for the concurrent use.
+type Bus struct {
+	backend Backend
+	config  Config
+
+	mu          sync.RWMutex
+	handlers    map[string]map[uint64]Handler
+	nextID      uint64
+	middlewares []Middleware
+	started     bool
+	closed      bool
+
+	running sync.WaitGroup
+}
+
+// NewBus returns a bus transported by `backend`.
+func NewBus(backend Backend, config Config) *Bus {
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &Bus{
+		backend:  backend,
+		config:   config,
+		handlers: map[string]map[uint64]Handler{},
+	}
+}
+
+// Use adds middlewares wrapping all the handlers, the first one is the outermost.
+func (b *Bus) Use(middlewares ...Middleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+// Subscribe adds a handler of `topic` and returns the function removing it.
+func (b *Bus) Subscribe(topic string, h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+
+	if b.handlers[topic] == nil {
+		b.handlers[topic] = map[uint64]Handler{}
+	}
+	b.handlers[topic][id] = h
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.handlers[topic], id)
+	}
+}
+
+// Publish sends `payload` encoded in JSON to the handlers of `topic`. The request ID of `c` is passed to
+// the context of the handlers.
+func (b *Bus) Publish(c context.Context, topic string, payload interface{}) error {
+	b.mu.RLock()
+	started, closed := b.started, b.closed
+	b.mu.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+	if !started {
+		return ErrNotStarted
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return b.backend.Publish(c, &Message{
+		ID:          uuid.NewString(),
+		Topic:       topic,
+		Payload:     data,
+		RequestID:   helpers.RequestIDFromContext(c),
+		PublishedAt: time.Now(),
+	})
+}
+
+// Start starts receiving the messages of the backend. The bus is closed by `bean.Cleanup`.
+func (b *Bus) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.started {
+		return nil
+	}
+
+	if err := b.backend.Start(b.dispatch); err != nil {
+		return err
+	}
+
+	b.started = true
+	bean.OnCleanup(func() {
+		if err := b.Close(); err != nil {
+			bean.Logger().Error(err)
+		}
+	})
+
+	return nil
+}
+
+// Close stops receiving the messages and waits for the running handlers.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	err := b.backend.Close()
+	b.running.Wait()
+
+	return err
+}
+
+// dispatch executes the handlers of the topic of `msg` in safe goroutines.
+func (b *Bus) dispatch(msg *Message) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+
+	handlers := make([]Handler, 0, len(b.handlers[msg.Topic]))
+	for _, h := range b.handlers[msg.Topic] {
+		handlers = append(handlers, b.wrap(h))
+	}
+
+	b.running.Add(len(handlers))
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h := h
+
+		ctx := context.Background()
+		if msg.RequestID != "" {
+			ctx = helpers.WithRequestID(ctx, msg.RequestID)
+		}
+		ctx, cancel := context.WithTimeout(ctx, b.config.Timeout)
+
+		f := async.Go(ctx, func(c context.Context) (struct{}, error) {
+			return struct{}{}, h(c, msg)
+		}, b.poolName()...)
+
+		go func() {
+			defer b.running.Done()
+			defer cancel()
+
+			if err := f.Err(); err != nil {
+				bean.LoggerWithContext(ctx).Errorf("event: handler of topic %s failed: %v", msg.Topic, err)
+			}
+		}()
+	}
+}
+
+// wrap applies the middlewares to `h`, the caller must hold the lock.
+func (b *Bus) wrap(h Handler) Handler {
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		h = b.middlewares[i](h)
+	}
+
+	return h
+}
+
+func (b *Bus) poolName() []string {
+	if b.config.Pool == "" {
+		return nil
+	}
+
+	return []string{b.config.Pool}
+}
+
+// Topic is a topic whose payload is a `T`.
+type Topic[T any] struct {
+	Name string
+}
+
+// NewTopic returns the topic `name` with the payload `T`.
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{Name: name}
+}
+
+// Publish sends `payload` to the handlers of the topic.
+func (t Topic[T]) Publish(c context.Context, bus *Bus, payload T) error {
+	return bus.Publish(c, t.Name, payload)
+}
+
+// Subscribe adds a handler of the topic and returns the function removing it. A payload which can't be
+// decoded into a `T` is an error of the handler.
+func (t Topic[T]) Subscribe(bus *Bus, fn func(c context.Context, payload T) error) (unsubscribe func()) {
+	return bus.Subscribe(t.Name, func(c context.Context, msg *Message) error {
+		var payload T
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return errors.Wrapf(err, "event: invalid payload of topic %s", msg.Topic)
+		}
+
+		return fn(c, payload)
+	})
+}
@@ -0,0 +1,97 @@
+package event
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	bean.BeanLogger = e.Logger
+}
+
+type orderPlaced struct {
+	OrderID uint64 `json:"orderId"`
+}
+
+var testTopic = NewTopic[orderPlaced]("order.placed")
+
+func TestBusPublishSubscribe(t *testing.T) {
+	bus := NewBus(NewMemoryBackend(), Config{})
+
+	assert.ErrorIs(t, testTopic.Publish(context.Background(), bus, orderPlaced{}), ErrNotStarted)
+	assert.NoError(t, bus.Start())
+
+	var (
+		mu        sync.Mutex
+		got       []uint64
+		requestID string
+		calls     []string
+	)
+
+	bus.Use(func(next Handler) Handler {
+		return func(c context.Context, msg *Message) error {
+			mu.Lock()
+			calls = append(calls, "outer")
+			mu.Unlock()
+			return next(c, msg)
+		}
+	})
+
+	testTopic.Subscribe(bus, func(c context.Context, p orderPlaced) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, p.OrderID)
+		requestID = helpers.RequestIDFromContext(c)
+		return nil
+	})
+	unsubscribe := testTopic.Subscribe(bus, func(c context.Context, p orderPlaced) error {
+		panic("boom")
+	})
+
+	c := helpers.WithRequestID(context.Background(), "req-1")
+	assert.NoError(t, testTopic.Publish(c, bus, orderPlaced{OrderID: 1}))
+
+	unsubscribe()
+	assert.NoError(t, testTopic.Publish(c, bus, orderPlaced{OrderID: 2}))
+
+	assert.NoError(t, bus.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []uint64{1, 2}, got)
+	assert.Equal(t, "req-1", requestID)
+	assert.Len(t, calls, 3)
+
+	assert.ErrorIs(t, testTopic.Publish(c, bus, orderPlaced{}), ErrClosed)
+}
+
+func TestBusCloseWaitsForHandlers(t *testing.T) {
+	bus := NewBus(NewMemoryBackend(), Config{Timeout: time.Second})
+	assert.NoError(t, bus.Start())
+
+	done := make(chan struct{})
+	bus.Subscribe("slow", func(c context.Context, msg *Message) error {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+		return nil
+	})
+
+	assert.NoError(t, bus.Publish(context.Background(), "slow", nil))
+	assert.NoError(t, bus.Close())
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("Close must wait for the running handlers")
+	}
+}
@@ -0,0 +1,70 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/trace"
+)
+
+// Logging logs the topic, the ID and the duration of each handled message, and the error if any.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(c context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(c, msg)
+
+			logger := bean.LoggerWithContext(c)
+			if err != nil {
+				logger.Warnf("event: %s %s failed after %s: %v", msg.Topic, msg.ID, time.Since(start), err)
+			} else {
+				logger.Debugf("event: %s %s handled in %s", msg.Topic, msg.ID, time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+// Tracing starts a sentry transaction per handled message, with a clone of the current hub.
+func Tracing() Middleware {
+	return func(next Handler) Handler {
+		return func(c context.Context, msg *Message) error {
+			if !bean.BeanConfig.Sentry.On {
+				return next(c, msg)
+			}
+
+			c = sentry.SetHubOnContext(c, sentry.CurrentHub().Clone())
+			tc := trace.NewTraceableContext(c)
+
+			finish := trace.Start(tc, "event", sentry.TransactionName("EVENT "+msg.Topic))
+			defer finish()
+
+			return next(tc, msg)
+		}
+	}
+}
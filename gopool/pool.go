@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/panjf2000/ants/v2"
 )
@@ -34,8 +35,41 @@ import (
 var (
 	poolsMu sync.RWMutex
 	pools   = make(map[string]*ants.Pool)
+	configs = make(map[string]Config)
 )
 
+// Config declares a goroutine pool.
+type Config struct {
+	Name string
+
+	// Size is the maximum number of goroutines of the pool.
+	// Optional. Default value 0, unlimited.
+	Size int
+
+	// QueueLength is the maximum number of tasks waiting for a free goroutine, the submissions beyond it
+	// fail with `ants.ErrPoolOverload`.
+	// Optional. Default value 0, unlimited.
+	QueueLength int
+
+	// Expiry is the duration after which an idle goroutine is stopped.
+	// Optional. Default value 1 second.
+	Expiry time.Duration
+}
+
+// Stats are the statistics of a pool.
+type Stats struct {
+	Name string
+	// Capacity is the maximum number of goroutines, -1 is unlimited.
+	Capacity int
+	Running  int
+	Free     int
+	Waiting  int
+	// QueueLength is the maximum number of waiting tasks, 0 is unlimited or unknown for the pools not
+	// registered by `RegisterConfig`.
+	QueueLength int
+	Closed      bool
+}
+
 // Register makes a goroutine pool available by the provided name.
 // If Register is called twice with the same name or if pool is nil,
 // it returns error.
@@ -55,6 +89,39 @@ func Register(name string, pool *ants.Pool) error {
 	return nil
 }
 
+// RegisterConfig creates a pool from `config` and registers it by the config name.
+func RegisterConfig(config Config) (*ants.Pool, error) {
+	if config.Name == "" {
+		return nil, errors.New("gopool: RegisterConfig name is empty")
+	}
+
+	size := config.Size
+	if size <= 0 {
+		size = -1
+	}
+
+	options := []ants.Option{ants.WithMaxBlockingTasks(config.QueueLength)}
+	if config.Expiry > 0 {
+		options = append(options, ants.WithExpiryDuration(config.Expiry))
+	}
+
+	pool, err := ants.NewPool(size, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Register(config.Name, pool); err != nil {
+		pool.Release()
+		return nil, err
+	}
+
+	poolsMu.Lock()
+	configs[config.Name] = config
+	poolsMu.Unlock()
+
+	return pool, nil
+}
+
 func UnregisterAllPools() {
 	poolsMu.Lock()
 	defer poolsMu.Unlock()
@@ -64,6 +131,113 @@ func UnregisterAllPools() {
 	}
 
 	pools = make(map[string]*ants.Pool)
+	configs = make(map[string]Config)
+}
+
+// Resize changes the maximum number of goroutines of a pool. The running tasks are not interrupted when
+// the pool shrinks. An unlimited pool can't be resized.
+func Resize(name string, size int) error {
+	pool, err := GetPool(name)
+	if err != nil {
+		return err
+	}
+
+	if size <= 0 {
+		return fmt.Errorf("gopool: invalid size %d for pool %q", size, name)
+	}
+
+	if pool.Cap() == -1 {
+		return fmt.Errorf("gopool: pool %q is unlimited and can't be resized", name)
+	}
+
+	if pool.IsClosed() {
+		return fmt.Errorf("gopool: pool %q is closed", name)
+	}
+
+	pool.Tune(size)
+
+	poolsMu.Lock()
+	if config, ok := configs[name]; ok {
+		config.Size = size
+		configs[name] = config
+	}
+	poolsMu.Unlock()
+
+	return nil
+}
+
+// GetStats returns the statistics of a pool.
+func GetStats(name string) (Stats, error) {
+	pool, err := GetPool(name)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	poolsMu.RLock()
+	config := configs[name]
+	poolsMu.RUnlock()
+
+	return Stats{
+		Name:        name,
+		Capacity:    pool.Cap(),
+		Running:     pool.Running(),
+		Free:        pool.Free(),
+		Waiting:     pool.Waiting(),
+		QueueLength: config.QueueLength,
+		Closed:      pool.IsClosed(),
+	}, nil
+}
+
+// AllStats returns the statistics of all the registered pools sorted by name.
+func AllStats() []Stats {
+	names := Pools()
+
+	list := make([]Stats, 0, len(names))
+	for _, name := range names {
+		if stats, err := GetStats(name); err == nil {
+			list = append(list, stats)
+		}
+	}
+
+	return list
+}
+
+// Drain closes all the pools, so that the new submissions fail, waits up to `timeout` for the running
+// tasks to finish and unregisters the pools. The tasks waiting for a free goroutine are rejected.
+func Drain(timeout time.Duration) error {
+	poolsMu.Lock()
+	drained := pools
+	pools = make(map[string]*ants.Pool)
+	configs = make(map[string]Config)
+	poolsMu.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []string
+	)
+
+	for name, pool := range drained {
+		wg.Add(1)
+		go func(name string, pool *ants.Pool) {
+			defer wg.Done()
+
+			if err := pool.ReleaseTimeout(timeout); err != nil && !errors.Is(err, ants.ErrPoolClosed) {
+				errMu.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %v (%d running)", name, err, pool.Running()))
+				errMu.Unlock()
+			}
+		}(name, pool)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("gopool: drain failed: %v", errs)
+	}
+
+	return nil
 }
 
 // Pools returns a sorted list of the names of the registered pools.
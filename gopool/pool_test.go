@@ -0,0 +1,76 @@
+package gopool
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterConfigResizeStats(t *testing.T) {
+	defer UnregisterAllPools()
+
+	pool, err := RegisterConfig(Config{Name: "test", Size: 2, QueueLength: 1})
+	require.NoError(t, err)
+
+	_, err = RegisterConfig(Config{Name: "test"})
+	assert.Error(t, err, "duplicated name")
+
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, pool.Submit(func() {
+			started.Done()
+			<-release
+		}))
+	}
+	started.Wait()
+
+	stats, err := GetStats("test")
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Name: "test", Capacity: 2, Running: 2, Free: 0, QueueLength: 1}, stats)
+
+	require.NoError(t, Resize("test", 4))
+	stats, _ = GetStats("test")
+	assert.Equal(t, 4, stats.Capacity)
+	assert.Equal(t, 2, stats.Free)
+
+	assert.Error(t, Resize("test", 0))
+	assert.Error(t, Resize("unknown", 1))
+
+	_, err = RegisterConfig(Config{Name: "unlimited"})
+	require.NoError(t, err)
+	assert.Error(t, Resize("unlimited", 1), "unlimited pool")
+
+	assert.Equal(t, []string{"test", "unlimited"}, Pools())
+	assert.Len(t, AllStats(), 2)
+
+	close(release)
+}
+
+func TestDrain(t *testing.T) {
+	defer UnregisterAllPools()
+
+	pool, err := RegisterConfig(Config{Name: "drain", Size: 1})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	require.NoError(t, pool.Submit(func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}))
+
+	require.NoError(t, Drain(time.Second))
+	select {
+	case <-done:
+	default:
+		t.Fatal("the running task is not finished")
+	}
+
+	assert.Empty(t, Pools())
+	assert.ErrorIs(t, pool.Submit(func() {}), ants.ErrPoolClosed)
+}
@@ -0,0 +1,376 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package goview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+)
+
+// FragmentScopeKey is the key of the data map holding the `FragmentScope` of a render. (`echoview` sets it
+// from the request)
+const FragmentScopeKey = "fragmentScope"
+
+// FragmentScope partitions the cached fragments so that a fragment rendered for a tenant or a locale is
+// never served to another one.
+type FragmentScope struct {
+	Tenant string
+	Locale string
+}
+
+// FragmentStore keeps the rendered fragments. The patterns of `Delete` only use `*` as a wildcard, the
+// other glob characters are escaped with `\`, so that they can be passed to redis as they are.
+type FragmentStore interface {
+	Get(c context.Context, key string) (value []byte, ok bool, err error)
+	Set(c context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(c context.Context, pattern string) error
+}
+
+// FragmentCache caches the rendered `{{cache "key" ttl}}...{{end}}` blocks of the templates. The block is
+// rendered with the dot of its position, the variables declared outside of it are not visible. It must
+// be placed where HTML text is expected, not inside a tag or an attribute.
+//
+//	{{cache (printf "product:%d" .product.ID) "10m"}}
+//		{{template "partials/product" .product}}
+//	{{end}}
+type FragmentCache struct {
+	mu    sync.RWMutex
+	store FragmentStore
+}
+
+// NewFragmentCache returns a fragment cache using `store`.
+func NewFragmentCache(store FragmentStore) *FragmentCache {
+	return &FragmentCache{store: store}
+}
+
+// SetStore replaces the store, example: with the redis one once the database is connected.
+func (f *FragmentCache) SetStore(store FragmentStore) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.store = store
+}
+
+func (f *FragmentCache) getStore() FragmentStore {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.store
+}
+
+// Invalidate removes the fragment `key` of all tenants and locales.
+func (f *FragmentCache) Invalidate(c context.Context, key string) error {
+	return f.delete(c, "*:*:"+escapeFragmentPattern(key))
+}
+
+// InvalidateTenant removes the fragments `keys` of a tenant in all locales, or all its fragments if no key
+// is given.
+func (f *FragmentCache) InvalidateTenant(c context.Context, tenant string, keys ...string) error {
+	if len(keys) == 0 {
+		return f.delete(c, escapeFragmentPattern(tenant)+":*")
+	}
+
+	for _, key := range keys {
+		if err := f.delete(c, escapeFragmentPattern(tenant)+":*:"+escapeFragmentPattern(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InvalidateAll removes all fragments.
+func (f *FragmentCache) InvalidateAll(c context.Context) error {
+	return f.delete(c, "*")
+}
+
+func (f *FragmentCache) delete(c context.Context, pattern string) error {
+	store := f.getStore()
+	if store == nil {
+		return nil
+	}
+
+	return store.Delete(c, pattern)
+}
+
+// render returns the cached fragment or executes the template `name` and caches it. The store errors
+// are ignored to render the page anyway.
+func (f *FragmentCache) render(tpl *template.Template, name string, dot interface{}, scope FragmentScope, key string, ttl interface{}) (template.HTML, error) {
+	d, err := fragmentTTL(ttl)
+	if err != nil {
+		return "", fmt.Errorf("ViewEngine cache `%s`: %v", key, err)
+	}
+
+	store := f.getStore()
+	storeKey := scope.Tenant + ":" + scope.Locale + ":" + key
+
+	c := context.Background()
+	if store != nil {
+		if value, ok, err := store.Get(c, storeKey); err == nil && ok {
+			return template.HTML(value), nil
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tpl.ExecuteTemplate(buf, name, dot); err != nil {
+		return "", err
+	}
+
+	if store != nil {
+		_ = store.Set(c, storeKey, buf.Bytes(), d)
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+// fragmentTTL accepts a duration, a duration string ("10m") or a number of seconds.
+func fragmentTTL(ttl interface{}) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	switch v := ttl.(type) {
+	case time.Duration:
+		d = v
+	case string:
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			var seconds int64
+			if seconds, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return 0, fmt.Errorf("invalid ttl %q", v)
+			}
+			d = time.Duration(seconds) * time.Second
+		}
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	default:
+		return 0, fmt.Errorf("invalid ttl type %T", ttl)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %v", ttl)
+	}
+
+	return d, nil
+}
+
+func fragmentScope(data interface{}) FragmentScope {
+	var scope interface{}
+
+	switch m := data.(type) {
+	case map[string]interface{}:
+		scope = m[FragmentScopeKey]
+	case echo.Map:
+		scope = m[FragmentScopeKey]
+	case M:
+		scope = m[FragmentScopeKey]
+	}
+
+	s, _ := scope.(FragmentScope)
+	return s
+}
+
+var fragmentPatternEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+func escapeFragmentPattern(s string) string {
+	return fragmentPatternEscaper.Replace(s)
+}
+
+// matchFragmentPattern matches the `FragmentStore.Delete` patterns.
+func matchFragmentPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for pattern = pattern[1:]; len(pattern) > 0 && pattern[0] == '*'; pattern = pattern[1:] {
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchFragmentPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+
+	return len(s) == 0
+}
+
+// MemoryFragmentStore keeps the fragments in the process memory.
+type MemoryFragmentStore struct {
+	mu         sync.Mutex
+	entries    map[string]memoryFragment
+	maxEntries int
+	now        func() time.Time
+}
+
+type memoryFragment struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryFragmentStore returns a memory store holding up to `maxEntries` fragments. (default 10000)
+func NewMemoryFragmentStore(maxEntries int) *MemoryFragmentStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	return &MemoryFragmentStore{entries: make(map[string]memoryFragment), maxEntries: maxEntries, now: time.Now}
+}
+
+// Get implements the `FragmentStore.Get` function.
+func (s *MemoryFragmentStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !s.now().Before(entry.expires) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+// Set implements the `FragmentStore.Set` function. When the store is full the expired fragments are
+// removed, and the new one is not kept if none has expired.
+func (s *MemoryFragmentStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		for k, entry := range s.entries {
+			if !now.Before(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		if len(s.entries) >= s.maxEntries {
+			return nil
+		}
+	}
+
+	s.entries[key] = memoryFragment{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+
+	return nil
+}
+
+// Delete implements the `FragmentStore.Delete` function.
+func (s *MemoryFragmentStore) Delete(_ context.Context, pattern string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.entries {
+		if matchFragmentPattern(pattern, key) {
+			delete(s.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// RedisFragmentStore keeps the fragments in redis, shared by all the servers. In the cluster mode, `Delete`
+// only scans the node answering the command, so prefer the memory store or the standalone mode.
+type RedisFragmentStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisFragmentStore returns a redis store whose keys start with `prefix`.
+func NewRedisFragmentStore(client redis.UniversalClient, prefix string) *RedisFragmentStore {
+	return &RedisFragmentStore{client: client, prefix: prefix}
+}
+
+// Get implements the `FragmentStore.Get` function.
+func (s *RedisFragmentStore) Get(c context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(c, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set implements the `FragmentStore.Set` function.
+func (s *RedisFragmentStore) Set(c context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(c, s.prefix+key, value, ttl).Err()
+}
+
+// Delete implements the `FragmentStore.Delete` function.
+func (s *RedisFragmentStore) Delete(c context.Context, pattern string) error {
+	iter := s.client.Scan(c, 0, escapeFragmentPattern(s.prefix)+pattern, 500).Iterator()
+
+	keys := make([]string, 0, 500)
+	for iter.Next(c) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			if err := s.client.Del(c, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		return s.client.Del(c, keys...).Err()
+	}
+
+	return nil
+}
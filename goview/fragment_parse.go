@@ -0,0 +1,235 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package goview
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fragmentAction is an action of a template source.
+type fragmentAction struct {
+	start, end          int    // Offsets of the left delimiter and after the right delimiter.
+	body                string // Without the delimiters, the trim markers and the spaces around.
+	keyword             string
+	trimLeft, trimRight bool
+}
+
+// fragmentRewriter replaces the `{{cache key ttl}}...{{end}}` blocks, which `text/template` can't parse,
+// by a `cacheFragment` call rendering the block hoisted into a `{{define}}` at the end of the source.
+type fragmentRewriter struct {
+	left, right string
+	file        string
+	n           int
+	defines     []string
+}
+
+// rewriteFragments returns `src` with the cache blocks rewritten.
+func rewriteFragments(src, file string, delims Delims) (string, error) {
+	left, right := delims.Left, delims.Right
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+
+	if !strings.Contains(src, "cache") {
+		return src, nil
+	}
+
+	r := &fragmentRewriter{left: left, right: right, file: file}
+
+	out, err := r.rewrite(src)
+	if err != nil {
+		return "", fmt.Errorf("ViewEngine cache block in %v: %v", file, err)
+	}
+
+	return out + strings.Join(r.defines, ""), nil
+}
+
+func (r *fragmentRewriter) rewrite(src string) (string, error) {
+	var out strings.Builder
+	pos := 0
+
+	for {
+		a, ok, err := r.next(src, pos)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			out.WriteString(src[pos:])
+			return out.String(), nil
+		}
+
+		if a.keyword != "cache" {
+			out.WriteString(src[pos:a.end])
+			pos = a.end
+			continue
+		}
+
+		args := strings.TrimSpace(strings.TrimPrefix(a.body, "cache"))
+		if args == "" {
+			return "", fmt.Errorf("missing key and ttl at offset %d", a.start)
+		}
+
+		end, err := r.matchEnd(src, a.end)
+		if err != nil {
+			return "", err
+		}
+
+		body, err := r.rewrite(src[a.end:end.start])
+		if err != nil {
+			return "", err
+		}
+
+		name := strconv.Quote(fmt.Sprintf("__fragment:%s:%d", r.file, r.n))
+		r.n++
+
+		r.defines = append(r.defines,
+			r.left+"define "+name+trimRight(a.trimRight)+r.right+body+r.left+trimLeft(end.trimLeft)+"end"+r.right)
+
+		out.WriteString(src[pos:a.start])
+		out.WriteString(r.left + trimLeft(a.trimLeft) + "cacheFragment " + name + " . " + args + trimRight(end.trimRight) + r.right)
+		pos = end.end
+	}
+}
+
+// matchEnd returns the `end` action closing the block opened before `pos`.
+func (r *fragmentRewriter) matchEnd(src string, pos int) (fragmentAction, error) {
+	depth := 0
+
+	for {
+		a, ok, err := r.next(src, pos)
+		if err != nil {
+			return a, err
+		}
+		if !ok {
+			return a, fmt.Errorf("missing %send%s", r.left, r.right)
+		}
+		pos = a.end
+
+		switch a.keyword {
+		case "if", "range", "with", "block", "define", "cache":
+			depth++
+		case "end":
+			if depth == 0 {
+				return a, nil
+			}
+			depth--
+		}
+	}
+}
+
+// next returns the first action from `pos`.
+func (r *fragmentRewriter) next(src string, pos int) (fragmentAction, bool, error) {
+	i := strings.Index(src[pos:], r.left)
+	if i < 0 {
+		return fragmentAction{}, false, nil
+	}
+
+	a := fragmentAction{start: pos + i}
+	inner := a.start + len(r.left)
+
+	var close int
+	if rest := strings.TrimLeft(strings.TrimPrefix(src[inner:], "-"), " \t\r\n"); strings.HasPrefix(rest, "/*") {
+		j := strings.Index(rest, "*/")
+		if j < 0 {
+			return a, false, fmt.Errorf("unclosed comment at offset %d", a.start)
+		}
+		k := strings.Index(rest[j:], r.right)
+		if k < 0 {
+			return a, false, fmt.Errorf("unclosed action at offset %d", a.start)
+		}
+		close = len(src) - len(rest) + j + k
+	} else {
+		var ok bool
+		if close, ok = r.actionEnd(src, inner); !ok {
+			return a, false, fmt.Errorf("unclosed action at offset %d", a.start)
+		}
+	}
+	a.end = close + len(r.right)
+
+	body := src[inner:close]
+	if len(body) >= 2 && body[0] == '-' && isTemplateSpace(body[1]) {
+		a.trimLeft = true
+		body = body[1:]
+	}
+	if len(body) >= 2 && body[len(body)-1] == '-' && isTemplateSpace(body[len(body)-2]) {
+		a.trimRight = true
+		body = body[:len(body)-1]
+	}
+	a.body = strings.TrimSpace(body)
+
+	if fields := strings.FieldsFunc(a.body, func(r rune) bool { return r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '(' }); len(fields) > 0 {
+		a.keyword = fields[0]
+	}
+
+	return a, true, nil
+}
+
+// actionEnd returns the offset of the right delimiter of the action starting at `pos`, skipping the
+// delimiters inside the quoted strings.
+func (r *fragmentRewriter) actionEnd(src string, pos int) (int, bool) {
+	for i := pos; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '"', '\'':
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case '`':
+			j := strings.IndexByte(src[i+1:], '`')
+			if j < 0 {
+				return 0, false
+			}
+			i += j + 1
+		default:
+			if strings.HasPrefix(src[i:], r.right) {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func isTemplateSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func trimLeft(trim bool) string {
+	if trim {
+		return "- "
+	}
+	return ""
+}
+
+func trimRight(trim bool) string {
+	if trim {
+		return " -"
+	}
+	return ""
+}
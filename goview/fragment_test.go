@@ -0,0 +1,80 @@
+package goview
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteFragments(t *testing.T) {
+	src := `a{{if .x}}{{cache "k" "1m" -}}
+  b{{if .y}}c{{end}}{{cache (printf "%s}}" .z) 60}}d{{end}}
+{{- end}}{{end}}e{{/* cache */}}`
+
+	out, err := rewriteFragments(src, "page", Delims{})
+	require.NoError(t, err)
+	assert.Equal(t, `a{{if .x}}{{cacheFragment "__fragment:page:1" . "k" "1m"}}{{end}}e{{/* cache */}}`+
+		`{{define "__fragment:page:0"}}d{{end}}`+
+		`{{define "__fragment:page:1" -}}`+"\n"+`  b{{if .y}}c{{end}}{{cacheFragment "__fragment:page:0" . (printf "%s}}" .z) 60}}`+"\n"+`{{- end}}`, out)
+
+	_, err = rewriteFragments(`{{cache "k" "1m"}}a`, "page", Delims{})
+	assert.Error(t, err)
+
+	_, err = rewriteFragments(`{{cache}}a{{end}}`, "page", Delims{})
+	assert.Error(t, err)
+}
+
+func TestFragmentCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page.html"),
+		[]byte(`<p>{{.name}}</p>{{cache (printf "list:%d" .id) "1m"}}<ul>{{range .items}}<li>{{count}}{{.}}</li>{{end}}</ul>{{end}}`), 0o644))
+
+	var calls int
+	fragments := NewFragmentCache(NewMemoryFragmentStore(0))
+	engine := New(Config{
+		Root:      dir,
+		Extension: ".html",
+		Funcs:     template.FuncMap{"count": func() string { calls++; return "" }},
+		Fragments: fragments,
+	})
+
+	render := func(data M) string {
+		buf := new(bytes.Buffer)
+		require.NoError(t, engine.RenderWriter(buf, "page", map[string]interface{}(data)))
+		return buf.String()
+	}
+
+	scope := FragmentScope{Tenant: "1", Locale: "en"}
+	assert.Equal(t, "<p>a</p><ul><li>x</li><li>y</li></ul>", render(M{"name": "a", "id": 1, "items": []string{"x", "y"}, FragmentScopeKey: scope}))
+	assert.Equal(t, 2, calls)
+
+	assert.Equal(t, "<p>b</p><ul><li>x</li><li>y</li></ul>", render(M{"name": "b", "id": 1, "items": []string{"z"}, FragmentScopeKey: scope}), "cached")
+	assert.Equal(t, 2, calls)
+
+	render(M{"id": 1, "items": []string{"z"}, FragmentScopeKey: FragmentScope{Tenant: "2", Locale: "en"}})
+	assert.Equal(t, 3, calls, "other tenant")
+
+	require.NoError(t, fragments.InvalidateTenant(context.Background(), "1", "list:1"))
+	assert.Equal(t, "<p>c</p><ul><li>z</li></ul>", render(M{"name": "c", "id": 1, "items": []string{"z"}, FragmentScopeKey: scope}))
+	assert.Equal(t, 4, calls)
+
+	require.NoError(t, fragments.Invalidate(context.Background(), "list:1"))
+	render(M{"id": 1, "items": []string{"z"}, FragmentScopeKey: scope})
+	render(M{"id": 1, "items": []string{"z"}, FragmentScopeKey: FragmentScope{Tenant: "2", Locale: "en"}})
+	assert.Equal(t, 6, calls)
+}
+
+func TestMatchFragmentPattern(t *testing.T) {
+	assert.True(t, matchFragmentPattern("*:*:k", "1:en:k"))
+	assert.False(t, matchFragmentPattern("*:*:k", "1:en:k2"))
+	assert.True(t, matchFragmentPattern(`1:*`, "1:en:k"))
+	assert.False(t, matchFragmentPattern(`1:*`, "12:en:k"))
+	assert.True(t, matchFragmentPattern(escapeFragmentPattern("a*")+":*", "a*:en:k"))
+	assert.False(t, matchFragmentPattern(escapeFragmentPattern("a*")+":*", "ab:en:k"))
+}
@@ -24,15 +24,18 @@ package goview
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -68,6 +71,7 @@ type Config struct {
 	Funcs        template.FuncMap //template functions
 	DisableCache bool             //disable cache, debug mode
 	Delims       Delims           //delimeters
+	Fragments    *FragmentCache   //cache of the `{{cache key ttl}}...{{end}}` blocks, nil renders them every time
 }
 
 // M map interface for data
@@ -164,15 +168,20 @@ func (e *ViewEngine) executeTemplate(out io.Writer, name string, data interface{
 		return template.HTML(buf.String()), err
 	}
 
-	// Get the plugin collection
-	for k, v := range e.config.Funcs {
-		allFuncs[k] = v
+	allFuncs["cacheFragment"] = func(fragment string, dot interface{}, key string, ttl interface{}) (template.HTML, error) {
+		return e.config.Fragments.render(tpl, fragment, dot, fragmentScope(data), key, ttl)
 	}
 
 	e.tplMutex.RLock()
+	funcs := e.config.Funcs
 	tpl, ok = e.tplMap[name]
 	e.tplMutex.RUnlock()
 
+	// Get the plugin collection
+	for k, v := range funcs {
+		allFuncs[k] = v
+	}
+
 	exeName := name
 
 	if useMaster && e.config.Master != "" {
@@ -203,6 +212,11 @@ func (e *ViewEngine) executeTemplate(out io.Writer, name string, data interface{
 				return err
 			}
 
+			data, err = rewriteFragments(data, v, e.config.Delims)
+			if err != nil {
+				return err
+			}
+
 			var tmpl *template.Template
 
 			if v == name {
@@ -231,6 +245,99 @@ func (e *ViewEngine) executeTemplate(out io.Writer, name string, data interface{
 	return nil
 }
 
+// AddFunc adds a template function, the parsed templates are discarded so that they can use it.
+func (e *ViewEngine) AddFunc(name string, fn interface{}) {
+	e.tplMutex.Lock()
+	defer e.tplMutex.Unlock()
+
+	// Copy on write, the renders in progress keep reading the previous map.
+	funcs := make(template.FuncMap, len(e.config.Funcs)+1)
+	for k, v := range e.config.Funcs {
+		funcs[k] = v
+	}
+	funcs[name] = fn
+
+	e.config.Funcs = funcs
+	e.tplMap = make(map[string]*template.Template)
+}
+
+// Reset discards the parsed templates, they are parsed again by the next renders.
+func (e *ViewEngine) Reset() {
+	e.tplMutex.Lock()
+	defer e.tplMutex.Unlock()
+
+	e.tplMap = make(map[string]*template.Template)
+}
+
+// Watch discards the parsed templates whenever a file under the root changes, checking every `interval`
+// until `ctx` is done. It's meant for development with the cache enabled, `onError` is called with the
+// failed checks.
+func (e *ViewEngine) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	modTimes, _ := e.modTimes()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		current, err := e.modTimes()
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+
+		if !sameModTimes(modTimes, current) {
+			e.Reset()
+			modTimes = current
+		}
+	}
+}
+
+// modTimes returns the modification time of the template files under the root.
+func (e *ViewEngine) modTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := filepath.WalkDir(e.config.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != e.config.Extension {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ViewEngine watch root:%v, error: %v", e.config.Root, err)
+	}
+
+	return modTimes, nil
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if u, ok := b[path]; !ok || !u.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
 // SetFileHandler set file handler
 func (e *ViewEngine) SetFileHandler(handle FileHandler) {
 
@@ -0,0 +1,54 @@
+package goview
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFunc(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page.tpl"), []byte(`<p>[[upper .name]]</p>`), 0o644))
+
+	engine := New(Config{Root: dir, Extension: ".tpl", Delims: Delims{Left: "[[", Right: "]]"}})
+
+	buf := new(bytes.Buffer)
+	assert.Error(t, engine.RenderWriter(buf, "page", map[string]interface{}{"name": "bean"}))
+
+	engine.AddFunc("upper", strings.ToUpper)
+
+	buf.Reset()
+	require.NoError(t, engine.RenderWriter(buf, "page", map[string]interface{}{"name": "bean"}))
+	assert.Equal(t, "<p>BEAN</p>", buf.String())
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	require.NoError(t, os.WriteFile(file, []byte(`v1`), 0o644))
+
+	engine := New(Config{Root: dir, Extension: ".html"})
+	render := func() string {
+		buf := new(bytes.Buffer)
+		require.NoError(t, engine.RenderWriter(buf, "page", map[string]interface{}{}))
+		return buf.String()
+	}
+	assert.Equal(t, "v1", render())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 10*time.Millisecond, func(err error) { t.Error(err) })
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte(`v2`), 0o644))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+
+	assert.Eventually(t, func() bool { return render() == "v2" }, time.Second, 10*time.Millisecond)
+}
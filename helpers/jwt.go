@@ -23,17 +23,83 @@
 package helpers
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
+// The errors of the JWT helpers, test them with `errors.Is`. The errors of `jwt` are wrapped as well,
+// like `jwt.ErrTokenSignatureInvalid`.
 var (
-	errorMessageInvalidToken = "token is invalid"
-	errorMessageExpiredToken = "token is expired"
+	ErrJWTMissing = errors.New("token is missing")
+	ErrJWTInvalid = errors.New("token is invalid")
+	// ErrJWTExpired is returned when the token is expired or not valid yet.
+	ErrJWTExpired = errors.New("token is expired")
+	// ErrJWTClaims is returned when the audience, the issuer or the subject doesn't match, or when a
+	// required claim is missing.
+	ErrJWTClaims = errors.New("token claims are invalid")
 )
 
+// JWTError is the error of a token which can't be used, its message is the one of `Kind` so that the
+// messages of the previous versions don't change.
+type JWTError struct {
+	// Kind is `ErrJWTMissing`, `ErrJWTInvalid`, `ErrJWTExpired` or `ErrJWTClaims`.
+	Kind error
+	// Err is the error of `jwt`, if any.
+	Err error
+}
+
+func (e *JWTError) Error() string {
+	return e.Kind.Error()
+}
+
+func (e *JWTError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *JWTError) Unwrap() error {
+	return e.Err
+}
+
+// JWTOptions are the validations of a token besides its signature and its `exp` and `nbf` claims.
+type JWTOptions struct {
+	// Leeway tolerates the clock skew between the issuer and the server on `exp`, `nbf` and `iat`.
+	// Optional. Default value 0.
+	Leeway time.Duration
+
+	// Audience must be one of the `aud` claim.
+	// Optional. Default value "", the audience is not checked.
+	Audience string
+
+	// Issuer must be the `iss` claim.
+	// Optional. Default value "", the issuer is not checked.
+	Issuer string
+
+	// Subject must be the `sub` claim.
+	// Optional. Default value "", the subject is not checked.
+	Subject string
+
+	// RequireExpiration rejects the tokens without `exp`, which never expire.
+	// Optional. Default value false.
+	RequireExpiration bool
+
+	// VerifyIssuedAt rejects the tokens whose `iat` is in the future.
+	// Optional. Default value false.
+	VerifyIssuedAt bool
+
+	// RequiredClaims are the names of the claims the token must have, like `sub` or `tenant_id`.
+	// Optional.
+	RequiredClaims []string
+
+	// Methods are the accepted signing algorithms, so that a token can't choose a weaker one.
+	// Optional. Default value the algorithms of the signing method of the key, "HS256" for a secret.
+	Methods []string
+}
+
 // EncodeJWT will encode JWT `claims` using a secret string and return a signed token as string.
 func EncodeJWT(claims jwt.Claims, secret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -43,41 +109,79 @@ func EncodeJWT(claims jwt.Claims, secret string) (string, error) {
 }
 
 // DecodeJWT will decode JWT string into `claims` structure using a secret string.
+// A missing token is `ErrJWTInvalid` and all the HMAC algorithms are accepted, like in the previous versions.
 func DecodeJWT(c echo.Context, claims jwt.Claims, secret string) error {
-
-	tokenString := ExtractJWTFromHeader(c)
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
+	err := DecodeJWTWithOptions(c, claims, secret, JWTOptions{
+		Methods: []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg()},
 	})
+	if errors.Is(err, ErrJWTMissing) {
+		return &JWTError{Kind: ErrJWTInvalid}
+	}
 
-	if err != nil {
+	return err
+}
 
-		if ve, ok := err.(*jwt.ValidationError); ok {
+// DecodeJWTWithOptions decodes the bearer token of the request into `claims`, verified with the HS256
+// `secret` and validated by `opts`. The error is a `*JWTError`.
+func DecodeJWTWithOptions(c echo.Context, claims jwt.Claims, secret string, opts JWTOptions) error {
+	if opts.Methods == nil {
+		opts.Methods = []string{jwt.SigningMethodHS256.Alg()}
+	}
 
-			if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-				return errors.New(errorMessageInvalidToken)
+	_, err := ParseJWT(ExtractJWTFromHeader(c), claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, opts)
 
-			} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-				return errors.New(errorMessageExpiredToken)
+	return err
+}
 
-			} else {
-				return errors.New(errorMessageInvalidToken)
-			}
-		}
+// ParseJWT verifies the token with the key returned by `keyFunc`, like `jwks.Manager.Keyfunc`, decodes
+// it into `claims` and validates it with `opts`. The error is a `*JWTError`.
+func ParseJWT(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, opts JWTOptions) (*jwt.Token, error) {
+	if tokenString == "" {
+		return nil, &JWTError{Kind: ErrJWTMissing}
+	}
 
-		return errors.New(errorMessageInvalidToken)
+	parserOpts := []jwt.ParserOption{jwt.WithLeeway(opts.Leeway)}
+	if len(opts.Methods) > 0 {
+		parserOpts = append(parserOpts, jwt.WithValidMethods(opts.Methods))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
 	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Subject != "" {
+		parserOpts = append(parserOpts, jwt.WithSubject(opts.Subject))
+	}
+	if opts.RequireExpiration {
+		parserOpts = append(parserOpts, jwt.WithExpirationRequired())
+	}
+	if opts.VerifyIssuedAt {
+		parserOpts = append(parserOpts, jwt.WithIssuedAt())
+	}
+	parser := jwt.NewParser(parserOpts...)
 
+	token, err := parser.ParseWithClaims(tokenString, claims, keyFunc)
+	if err != nil {
+		return nil, jwtError(err)
+	}
 	if !token.Valid {
-		return errors.New(errorMessageInvalidToken)
+		return nil, &JWTError{Kind: ErrJWTInvalid}
 	}
 
-	return nil
+	if len(opts.RequiredClaims) > 0 {
+		if err := requireClaims(parser, tokenString, opts.RequiredClaims); err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
 }
 
 // ExtractJWTFromHeader will extract JWT from `Authorization` HTTP header and returns as string.
 func ExtractJWTFromHeader(c echo.Context) string {
-
 	var tokenString string
 
 	authHeader := c.Request().Header.Get("Authorization")
@@ -92,3 +196,43 @@ func ExtractJWTFromHeader(c echo.Context) string {
 
 	return tokenString
 }
+
+// jwtError classifies an error of `jwt`.
+func jwtError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return &JWTError{Kind: ErrJWTExpired, Err: err}
+	case errors.Is(err, jwt.ErrTokenInvalidAudience), errors.Is(err, jwt.ErrTokenInvalidIssuer),
+		errors.Is(err, jwt.ErrTokenInvalidSubject), errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return &JWTError{Kind: ErrJWTClaims, Err: err}
+	}
+
+	return &JWTError{Kind: ErrJWTInvalid, Err: err}
+}
+
+// requireClaims checks the claims of the payload of the token, since the claims struct can't tell a
+// missing claim from a zero value.
+func requireClaims(parser *jwt.Parser, tokenString string, names []string) error {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return &JWTError{Kind: ErrJWTInvalid}
+	}
+
+	payload, err := parser.DecodeSegment(parts[1])
+	if err != nil {
+		return &JWTError{Kind: ErrJWTInvalid, Err: err}
+	}
+
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return &JWTError{Kind: ErrJWTInvalid, Err: err}
+	}
+
+	for _, name := range names {
+		if value, ok := claims[name]; !ok || string(value) == "null" {
+			return &JWTError{Kind: ErrJWTClaims, Err: errors.New("token is missing the " + name + " claim")}
+		}
+	}
+
+	return nil
+}
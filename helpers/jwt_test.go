@@ -29,7 +29,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,7 +38,7 @@ type jwtData struct {
 	Name    string
 	Age     uint
 	Hobbies []string
-	jwt.StandardClaims
+	jwt.RegisteredClaims
 }
 
 func Test_DecodeJWTWithJsonUnmarshalStyle(t *testing.T) {
@@ -52,8 +52,8 @@ func Test_DecodeJWTWithJsonUnmarshalStyle(t *testing.T) {
 		Name:    "raicart",
 		Age:     uint(18),
 		Hobbies: []string{"football", "basketball"},
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(6000 * time.Second).Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(6000 * time.Second)),
 		},
 	}
 	// Create token with claims
@@ -95,8 +95,8 @@ func Test_DecodeJWTWhenExpiredToken(t *testing.T) {
 		Name:    "raicart",
 		Age:     uint(18),
 		Hobbies: []string{"football", "basketball"},
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(1 * time.Second).Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Second)),
 		},
 	}
 	token, err := EncodeJWT(data, "testSecret")
@@ -109,3 +109,79 @@ func Test_DecodeJWTWhenExpiredToken(t *testing.T) {
 	err = DecodeJWT(c, extractedData, "testSecret")
 	assert.Equal(t, "token is expired", err.Error())
 }
+
+func Test_ParseJWTWithOptions(t *testing.T) {
+	secret := "testSecret"
+	keyFunc := func(token *jwt.Token) (interface{}, error) { return []byte(secret), nil }
+	opts := JWTOptions{Methods: []string{"HS256"}}
+
+	encode := func(claims jwt.Claims) string {
+		token, err := EncodeJWT(claims, secret)
+		assert.NoError(t, err)
+		return token
+	}
+
+	// The leeway tolerates a token which has just expired.
+	expired := encode(jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second))})
+	_, err := ParseJWT(expired, &jwt.RegisteredClaims{}, keyFunc, opts)
+	assert.ErrorIs(t, err, ErrJWTExpired)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	_, err = ParseJWT(expired, &jwt.RegisteredClaims{}, keyFunc, JWTOptions{Leeway: time.Minute})
+	assert.NoError(t, err)
+
+	token := encode(jwt.RegisteredClaims{Issuer: "bean", Audience: jwt.ClaimStrings{"api", "admin"}, Subject: "42"})
+	_, err = ParseJWT(token, &jwt.RegisteredClaims{}, keyFunc, JWTOptions{Issuer: "bean", Audience: "admin", Subject: "42"})
+	assert.NoError(t, err)
+
+	_, err = ParseJWT(token, &jwt.RegisteredClaims{}, keyFunc, JWTOptions{Audience: "billing"})
+	assert.ErrorIs(t, err, ErrJWTClaims)
+	assert.Equal(t, "token claims are invalid", err.Error())
+	_, err = ParseJWT(token, &jwt.RegisteredClaims{}, keyFunc, JWTOptions{Issuer: "other"})
+	assert.ErrorIs(t, err, ErrJWTClaims)
+	_, err = ParseJWT(token, &jwt.RegisteredClaims{}, keyFunc, JWTOptions{RequireExpiration: true})
+	assert.ErrorIs(t, err, ErrJWTClaims)
+
+	claims := jwt.MapClaims{"sub": "42", "tenant_id": nil}
+	_, err = ParseJWT(encode(claims), jwt.MapClaims{}, keyFunc, JWTOptions{RequiredClaims: []string{"sub"}})
+	assert.NoError(t, err)
+	_, err = ParseJWT(encode(claims), jwt.MapClaims{}, keyFunc, JWTOptions{RequiredClaims: []string{"sub", "tenant_id"}})
+	assert.ErrorIs(t, err, ErrJWTClaims)
+
+	// A token can't choose another algorithm than the accepted ones.
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{}).SignedString([]byte(secret))
+	assert.NoError(t, err)
+	_, err = ParseJWT(hs512, jwt.MapClaims{}, keyFunc, opts)
+	assert.ErrorIs(t, err, ErrJWTInvalid)
+
+	_, err = ParseJWT("", jwt.MapClaims{}, keyFunc, opts)
+	assert.ErrorIs(t, err, ErrJWTMissing)
+
+	var jwtErr *JWTError
+	_, err = ParseJWT(token+"x", jwt.MapClaims{}, keyFunc, opts)
+	assert.ErrorAs(t, err, &jwtErr)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+}
+
+func Test_DecodeJWTWithOptions(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	assert.Equal(t, "token is invalid", DecodeJWT(c, jwt.MapClaims{}, "testSecret").Error())
+	assert.ErrorIs(t, DecodeJWTWithOptions(c, jwt.MapClaims{}, "testSecret", JWTOptions{}), ErrJWTMissing)
+
+	token, err := EncodeJWT(jwt.RegisteredClaims{Issuer: "bean"}, "testSecret")
+	assert.NoError(t, err)
+	c.Request().Header.Set("Authorization", "Bearer "+token)
+
+	claims := &jwt.RegisteredClaims{}
+	assert.NoError(t, DecodeJWTWithOptions(c, claims, "testSecret", JWTOptions{Issuer: "bean"}))
+	assert.Equal(t, "bean", claims.Issuer)
+
+	// DecodeJWT accepts all the HMAC algorithms, DecodeJWTWithOptions only HS256 by default.
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.RegisteredClaims{Issuer: "bean"}).SignedString([]byte("testSecret"))
+	assert.NoError(t, err)
+	c.Request().Header.Set("Authorization", "Bearer "+hs512)
+
+	assert.NoError(t, DecodeJWT(c, &jwt.RegisteredClaims{}, "testSecret"))
+	assert.ErrorIs(t, DecodeJWTWithOptions(c, &jwt.RegisteredClaims{}, "testSecret", JWTOptions{}), ErrJWTInvalid)
+}
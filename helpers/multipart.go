@@ -0,0 +1,138 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package helpers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MultipartResponse streams a `multipart/mixed` response mixing JSON metadata and binary payloads,
+// instead of base64 encoding the binaries into a JSON. Every part is flushed to the client as soon as
+// it's written.
+// Example:
+//
+//	mr := helpers.NewMultipartResponse(c, http.StatusOK)
+//	if err := mr.JSON("result", result); err != nil {
+//		return err
+//	}
+//	if err := mr.Binary("label", "label.pdf", "application/pdf", pdf); err != nil {
+//		return err
+//	}
+//	return mr.Close()
+type MultipartResponse struct {
+	c      echo.Context
+	code   int
+	writer *multipart.Writer
+}
+
+// NewMultipartResponse returns a multipart response of the status code. The header is sent with the first part.
+func NewMultipartResponse(c echo.Context, code int) *MultipartResponse {
+	return &MultipartResponse{
+		c:      c,
+		code:   code,
+		writer: multipart.NewWriter(c.Response()),
+	}
+}
+
+// Boundary returns the boundary of the parts.
+func (m *MultipartResponse) Boundary() string {
+	return m.writer.Boundary()
+}
+
+// Part writes a part with a custom header and returns the writer of its body. The body must be written
+// before the next part is created.
+func (m *MultipartResponse) Part(header textproto.MIMEHeader) (io.Writer, error) {
+	m.writeHeader()
+
+	return m.writer.CreatePart(header)
+}
+
+// JSON writes a part of the JSON encoding of `v`.
+func (m *MultipartResponse) JSON(name string, v interface{}) error {
+	header := textproto.MIMEHeader{}
+	header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"name": name}))
+
+	w, err := m.Part(header)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return err
+	}
+	m.c.Response().Flush()
+
+	return nil
+}
+
+// Binary writes a part streaming the content of `r`. `filename` is optional.
+func (m *MultipartResponse) Binary(name, filename, contentType string, r io.Reader) error {
+	params := map[string]string{"name": name}
+	if filename != "" {
+		params["filename"] = filename
+	}
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", params))
+
+	w, err := m.Part(header)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	m.c.Response().Flush()
+
+	return nil
+}
+
+// Close writes the closing boundary. A response without any part is sent with only the closing boundary.
+func (m *MultipartResponse) Close() error {
+	m.writeHeader()
+
+	return m.writer.Close()
+}
+
+func (m *MultipartResponse) writeHeader() {
+	if m.c.Response().Committed {
+		return
+	}
+
+	m.c.Response().Header().Set(echo.HeaderContentType, mime.FormatMediaType("multipart/mixed", map[string]string{
+		"boundary": m.writer.Boundary(),
+	}))
+	m.c.Response().WriteHeader(m.code)
+}
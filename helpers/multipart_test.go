@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartResponse(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	mr := NewMultipartResponse(c, http.StatusCreated)
+	assert.NoError(t, mr.JSON("result", map[string]string{"status": "printed"}))
+	assert.NoError(t, mr.Binary("label", "label.pdf", "application/pdf", strings.NewReader("%PDF-1.4")))
+	assert.NoError(t, mr.Close())
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentType))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(rec.Body, params["boundary"])
+
+	part, err := r.NextPart()
+	if assert.NoError(t, err) {
+		_, disposition, _ := mime.ParseMediaType(part.Header.Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "result", disposition["name"])
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, part.Header.Get(echo.HeaderContentType))
+		body, _ := io.ReadAll(part)
+		assert.JSONEq(t, `{"status":"printed"}`, string(body))
+	}
+
+	part, err = r.NextPart()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "label.pdf", part.FileName())
+		assert.Equal(t, "application/pdf", part.Header.Get(echo.HeaderContentType))
+		body, _ := io.ReadAll(part)
+		assert.Equal(t, "%PDF-1.4", string(body))
+	}
+
+	_, err = r.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
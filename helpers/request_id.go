@@ -0,0 +1,45 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package helpers
+
+import (
+	"context"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID, which the context aware logger, the SQL
+// comments and the outbound requests of `httpclient` pick up.
+func WithRequestID(c context.Context, id string) context.Context {
+	return context.WithValue(c, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by the context, or "" if there is none.
+func RequestIDFromContext(c context.Context) string {
+	if c == nil {
+		return ""
+	}
+
+	id, _ := c.Value(requestIDKey{}).(string)
+	return id
+}
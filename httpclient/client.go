@@ -0,0 +1,513 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package httpclient provides an HTTP client for the calls to the other services with the retries using
+// `helpers.JitterBackoff`, a timeout per attempt, a circuit breaker per host, the request/response logs
+// with the sensitive values masked, the sentry breadcrumbs and the trace header propagation.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/breaker"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// Config defines the config of the client.
+type Config struct {
+	// Timeout is the deadline of every attempt, the total time can be up to `MaxAttempts` times longer
+	// plus the backoffs. Use the request context for an overall deadline.
+	// Optional. Default value 10s.
+	Timeout time.Duration
+
+	// MaxAttempts is the maximum number of times a request is sent, including the first one.
+	// Optional. Default value 3.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff are passed to `helpers.JitterBackoff` to calculate the waiting time
+	// between two attempts. A `Retry-After` header of the response has priority if it's not longer than
+	// `MaxBackoff`. Optional. Default value 100ms and 2s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// IsRetryable decides whether a failed attempt should be retried or not. `res` is nil when `err` is not.
+	// Optional. Default value `IsRetryable`.
+	IsRetryable func(req *http.Request, res *http.Response, err error) bool
+
+	// Breaker configures the circuit breaker of every host, named "httpclient:<host>". The transport
+	// errors and the 5xx responses are failures. A negative `Threshold` disables the breakers.
+	// Optional. Default value `breaker.DefaultConfig`.
+	Breaker breaker.Config
+
+	// Logger logs every attempt. Optional. Default value nil, no log.
+	Logger echo.Logger
+
+	// LogBody adds the JSON request and response bodies to the logs, with the `MaskedParameters` masked.
+	// Optional. Default value false.
+	LogBody bool
+
+	// MaskedHeaders are logged as "****".
+	// Optional. Default value `Authorization`, `Cookie`, `Set-Cookie` and `X-Api-Key`.
+	MaskedHeaders []string
+
+	// MaskedParameters are the top level JSON fields logged as "****", like `password`.
+	// Optional. Default value nil.
+	MaskedParameters []string
+
+	// Transport is the underlying round tripper.
+	// Optional. Default value `http.DefaultTransport`.
+	Transport http.RoundTripper
+}
+
+// DefaultConfig is the default config of the client.
+var DefaultConfig = Config{
+	Timeout:       10 * time.Second,
+	MaxAttempts:   3,
+	MinBackoff:    100 * time.Millisecond,
+	MaxBackoff:    2 * time.Second,
+	IsRetryable:   IsRetryable,
+	MaskedHeaders: []string{echo.HeaderAuthorization, echo.HeaderCookie, echo.HeaderSetCookie, "X-Api-Key"},
+}
+
+// ErrServerError is the failure recorded by the circuit breaker for a 5xx response.
+var ErrServerError = errors.New("httpclient: server error")
+
+// Client is safe for the concurrent use and should be reused, like `http.Client`.
+type Client struct {
+	http   *http.Client
+	config Config
+
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker.Breaker
+}
+
+// New returns a client, the zero fields of `config` are set from `DefaultConfig`.
+func New(config Config) *Client {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultConfig.MaxAttempts
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultConfig.MinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultConfig.MaxBackoff
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = DefaultConfig.IsRetryable
+	}
+	if config.MaskedHeaders == nil {
+		config.MaskedHeaders = DefaultConfig.MaskedHeaders
+	}
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+
+	return &Client{
+		http:     &http.Client{Transport: config.Transport},
+		config:   config,
+		breakers: make(map[string]*breaker.Breaker),
+	}
+}
+
+// IsRetryable retries the network errors and the `429`, `502`, `503` and `504` responses of the idempotent
+// methods. `POST` and `PATCH` are retried only when the request has an `Idempotency-Key` header.
+func IsRetryable(req *http.Request, res *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+
+	if err != nil {
+		// The caller gave up, retrying won't help.
+		return !errors.Is(err, context.Canceled)
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// Do sends the request with the retries. The request context carries the sentry hub and span, if any, and
+// the overall deadline. The request ID of the context (see `helpers.WithRequestID`) is sent as the
+// `X-Request-ID` header if it isn't set. A non-2xx response is not an error, only the transport errors
+// and `breaker.ErrOpen` are returned, like `http.Client`. The caller must close the response body.
+func (cl *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// The body must be sent again on every attempt.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	if req.Header.Get(echo.HeaderXRequestID) == "" {
+		if id := helpers.RequestIDFromContext(ctx); id != "" {
+			req.Header.Set(echo.HeaderXRequestID, id)
+		}
+	}
+
+	if span := sentry.TransactionFromContext(ctx); span != nil {
+		child := span.StartChild("http.client")
+		child.Description = req.Method + " " + req.URL.String()
+		defer child.Finish()
+		ctx = child.Context()
+		req.Header.Set("sentry-trace", child.ToSentryTrace())
+	}
+
+	b := cl.breaker(req.URL.Host)
+
+	var (
+		res *http.Response
+		err error
+	)
+	for attempt := 1; ; attempt++ {
+		done := func(error) {}
+		if b != nil {
+			if done, err = b.Allow(ctx); err != nil {
+				cl.breadcrumb(ctx, req, nil, err, attempt)
+				return nil, err
+			}
+		}
+
+		if attempt > 1 && req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		res, err = cl.attempt(ctx, req, attempt)
+		retryable := cl.config.IsRetryable(req, res, err)
+		if err == nil && res.StatusCode >= 500 {
+			done(ErrServerError)
+		} else {
+			done(err)
+		}
+
+		if !retryable || attempt >= cl.config.MaxAttempts {
+			return res, err
+		}
+
+		wait := helpers.JitterBackoff(cl.config.MinBackoff, cl.config.MaxBackoff, attempt-1)
+		if res != nil {
+			if retryAfter := parseRetryAfter(res.Header.Get(echo.HeaderRetryAfter)); retryAfter > 0 && retryAfter <= cl.config.MaxBackoff {
+				wait = retryAfter
+			}
+			// Drain so that the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// breaker returns the circuit breaker of the host, or nil if the breakers are disabled.
+func (cl *Client) breaker(host string) *breaker.Breaker {
+	if cl.config.Breaker.Threshold < 0 {
+		return nil
+	}
+
+	cl.breakersMu.Lock()
+	defer cl.breakersMu.Unlock()
+
+	b, ok := cl.breakers[host]
+	if !ok {
+		b = breaker.New("httpclient:"+host, cl.config.Breaker)
+		cl.breakers[host] = b
+	}
+
+	return b
+}
+
+// DoWithEcho is same as `Do` for a request sent while handling the echo request `c`. The request inherits
+// the context of `c` (sentry span, cancellation) and its `X-Request-ID`, so that the upstream logs can be
+// correlated.
+func (cl *Client) DoWithEcho(c echo.Context, req *http.Request) (*http.Response, error) {
+	ctx := c.Request().Context()
+	if hub := sentryecho.GetHubFromContext(c); hub != nil && sentry.GetHubFromContext(ctx) == nil {
+		ctx = sentry.SetHubOnContext(ctx, hub)
+	}
+
+	req = req.WithContext(ctx)
+
+	if req.Header.Get(echo.HeaderXRequestID) == "" {
+		id := c.Request().Header.Get(echo.HeaderXRequestID)
+		if id == "" {
+			id = c.Response().Header().Get(echo.HeaderXRequestID)
+		}
+		if id != "" {
+			req.Header.Set(echo.HeaderXRequestID, id)
+		}
+	}
+
+	return cl.Do(req)
+}
+
+// JSON sends `in` as a JSON body, if not nil, and decodes a 2xx JSON response into `out`, if not nil.
+// A non-2xx response is returned as a `*StatusError` with the beginning of the body.
+func (cl *Client) JSON(c context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(c, method, url, body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	if in != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return &StatusError{StatusCode: res.StatusCode, Body: b}
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return errors.WithStack(json.NewDecoder(res.Body).Decode(out))
+}
+
+// StatusError is returned by `JSON` for a non-2xx response.
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return "httpclient: unexpected status " + strconv.Itoa(e.StatusCode) + ": " + string(e.Body)
+}
+
+// attempt sends the request once with the per attempt timeout. The timeout context is released when the
+// response body is closed.
+func (cl *Client) attempt(ctx context.Context, req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, cl.config.Timeout)
+
+	var reqBody []byte
+	if cl.config.Logger != nil && cl.config.LogBody && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	start := time.Now()
+	res, err := cl.http.Do(req.WithContext(ctx))
+	latency := time.Since(start)
+
+	if err != nil {
+		cancel()
+	} else {
+		res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	}
+
+	cl.breadcrumb(ctx, req, res, err, attempt)
+	cl.log(req, res, err, attempt, latency, reqBody)
+
+	return res, err
+}
+
+func (cl *Client) breadcrumb(ctx context.Context, req *http.Request, res *http.Response, err error, attempt int) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"url":     req.URL.Redacted(),
+		"method":  req.Method,
+		"attempt": attempt,
+	}
+	level := sentry.LevelInfo
+	if res != nil {
+		data["status_code"] = res.StatusCode
+		if res.StatusCode >= 500 {
+			level = sentry.LevelWarning
+		}
+	}
+	if err != nil {
+		data["error"] = err.Error()
+		level = sentry.LevelError
+	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "http",
+		Category: "http.client",
+		Data:     data,
+		Level:    level,
+	}, nil)
+}
+
+func (cl *Client) log(req *http.Request, res *http.Response, err error, attempt int, latency time.Duration, reqBody []byte) {
+	if cl.config.Logger == nil {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"method":         req.Method,
+		"url":            req.URL.Redacted(),
+		"attempt":        attempt,
+		"latency":        latency.String(),
+		"request_header": cl.maskHeader(req.Header),
+	}
+	if reqBody != nil {
+		fields["request_body"] = cl.maskBody(reqBody)
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+		cl.config.Logger.Errorj(fields)
+		return
+	}
+
+	fields["status"] = res.StatusCode
+	fields["response_header"] = cl.maskHeader(res.Header)
+
+	if cl.config.LogBody && strings.HasPrefix(res.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		// Read the body for the log and give an identical one to the caller.
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+		res.Body = &multiCloser{Reader: io.MultiReader(bytes.NewReader(body), res.Body), Closer: res.Body}
+		fields["response_body"] = cl.maskBody(body)
+	}
+
+	if res.StatusCode >= 500 {
+		cl.config.Logger.Warnj(fields)
+	} else {
+		cl.config.Logger.Infoj(fields)
+	}
+}
+
+func (cl *Client) maskHeader(header http.Header) map[string]string {
+	masked := make(map[string]string, len(header))
+	for k := range header {
+		masked[k] = header.Get(k)
+	}
+
+	for _, k := range cl.config.MaskedHeaders {
+		k = http.CanonicalHeaderKey(k)
+		if _, ok := masked[k]; ok {
+			masked[k] = "****"
+		}
+	}
+
+	return masked
+}
+
+func (cl *Client) maskBody(body []byte) string {
+	if len(cl.config.MaskedParameters) == 0 {
+		return string(body)
+	}
+
+	var unmarshaled map[string]interface{}
+	if err := json.Unmarshal(body, &unmarshaled); err != nil {
+		// Not a JSON object, don't risk logging a sensitive value.
+		return "****"
+	}
+
+	for _, param := range cl.config.MaskedParameters {
+		if _, ok := unmarshaled[param]; ok {
+			unmarshaled[param] = "****"
+		}
+	}
+	masked, _ := json.Marshal(unmarshaled)
+
+	return string(masked)
+}
+
+// parseRetryAfter supports the seconds and the HTTP date formats of `Retry-After`.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type multiCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/retail-ai-inc/bean/breaker"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	client := New(Config{MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+
+	var out struct{ OK bool }
+	err := client.JSON(context.Background(), http.MethodGet, server.URL, nil, &out)
+	assert.NoError(t, err)
+	assert.True(t, out.OK)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// POST without `Idempotency-Key` is not retried.
+	atomic.StoreInt32(&calls, 0)
+	err = client.JSON(context.Background(), http.MethodPost, server.URL, map[string]int{"a": 1}, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*StatusError).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestClientRequestID(t *testing.T) {
+	var got atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get("X-Request-ID"))
+	}))
+	defer server.Close()
+
+	client := New(Config{})
+
+	ctx := helpers.WithRequestID(context.Background(), "req-1")
+	assert.NoError(t, client.JSON(ctx, http.MethodGet, server.URL, nil, nil))
+	assert.Equal(t, "req-1", got.Load())
+
+	assert.NoError(t, client.JSON(context.Background(), http.MethodGet, server.URL, nil, nil))
+	assert.Equal(t, "", got.Load())
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := New(Config{MaxAttempts: 1, Breaker: breaker.Config{Threshold: 2, Cooldown: time.Minute}})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		res, err := client.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.Do(req)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestMaskHeaderAndBody(t *testing.T) {
+	client := New(Config{MaskedParameters: []string{"password"}})
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("Accept", "application/json")
+	masked := client.maskHeader(header)
+	assert.Equal(t, "****", masked["Authorization"])
+	assert.Equal(t, "application/json", masked["Accept"])
+
+	assert.JSONEq(t, `{"user":"a","password":"****"}`, client.maskBody([]byte(`{"user":"a","password":"p"}`)))
+}
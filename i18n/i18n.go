@@ -0,0 +1,445 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package i18n translates the messages of the application from the bundles of a directory, one JSON
+// or TOML file per locale like `locales/en.json` or `locales/ja.toml`.
+//
+// The messages are nested by the dots of their keys and may have plural forms:
+//
+//	{
+//		"greeting": "Hello, {name}!",
+//		"cart": {
+//			"items": {"zero": "Your cart is empty", "one": "{count} item", "other": "{count} items"}
+//		}
+//	}
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// CountArg is the argument selecting the plural form of a message.
+const CountArg = "count"
+
+// pluralCategories are the CLDR plural categories a message may have.
+var pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// message is the text of each plural category of a message, a message without plural forms has
+// only `other`.
+type message map[string]string
+
+// Bundle holds the messages of the locales. It's safe for concurrent use.
+type Bundle struct {
+	dir           string
+	defaultLocale string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]message
+	locales  map[string]string // normalized locale -> locale as it's named
+	modTimes map[string]time.Time
+}
+
+// NewBundle returns an empty bundle falling back to `defaultLocale`, add its messages with `Add`.
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		defaultLocale: defaultLocale,
+		messages:      map[string]map[string]message{},
+		locales:       map[string]string{},
+	}
+}
+
+// Load returns the bundle of the `*.json` and `*.toml` files of `dir`, the name of a file without its
+// extension is the locale of its messages.
+func Load(dir, defaultLocale string) (*Bundle, error) {
+	b := NewBundle(defaultLocale)
+	b.dir = dir
+
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Add merges `messages` into the messages of `locale`. The values are either the strings, the maps of
+// the plural categories or the nested messages.
+func (b *Bundle) Add(locale string, messages map[string]interface{}) error {
+	flat := map[string]message{}
+	if err := flatten(flat, "", messages); err != nil {
+		return errors.WithMessagef(err, "locale %s", locale)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.add(locale, flat)
+
+	return nil
+}
+
+func (b *Bundle) add(locale string, flat map[string]message) {
+	name := normalize(locale)
+	if b.messages[name] == nil {
+		b.messages[name] = map[string]message{}
+	}
+	for key, m := range flat {
+		b.messages[name][key] = m
+	}
+	b.locales[name] = locale
+}
+
+// Reload reads the files of the directory again, the messages are replaced only if all of them are valid.
+func (b *Bundle) Reload() error {
+	if b.dir == "" {
+		return nil
+	}
+
+	files, modTimes, err := b.files()
+	if err != nil {
+		return err
+	}
+
+	loaded := NewBundle(b.defaultLocale)
+	for _, file := range files {
+		flat, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		loaded.add(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), flat)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.messages = loaded.messages
+	b.locales = loaded.locales
+	b.modTimes = modTimes
+
+	return nil
+}
+
+// Watch reloads the bundle whenever a file of the directory changes, checking every `interval` until
+// `ctx` is done. It's meant for development, `onError` is called with the failed reloads.
+func (b *Bundle) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if b.dir == "" {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		_, modTimes, err := b.files()
+		if err == nil {
+			b.mu.RLock()
+			changed := !sameModTimes(b.modTimes, modTimes)
+			b.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			err = b.Reload()
+		}
+
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (b *Bundle) files() ([]string, map[string]time.Time, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var files []string
+	modTimes := map[string]time.Time{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".toml") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		file := filepath.Join(b.dir, entry.Name())
+		files = append(files, file)
+		modTimes[file] = info.ModTime()
+	}
+
+	return files, modTimes, nil
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if u, ok := b[file]; !ok || !u.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func readFile(file string) (map[string]message, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var messages map[string]interface{}
+	if filepath.Ext(file) == ".toml" {
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "i18n file %s", file)
+		}
+		messages = tree.ToMap()
+	} else if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, errors.Wrapf(err, "i18n file %s", file)
+	}
+
+	flat := map[string]message{}
+	if err := flatten(flat, "", messages); err != nil {
+		return nil, errors.WithMessagef(err, "i18n file %s", file)
+	}
+
+	return flat, nil
+}
+
+// flatten adds the messages of `values` to `flat` by their dotted keys.
+func flatten(flat map[string]message, prefix string, values map[string]interface{}) error {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case string:
+			flat[key] = message{"other": v}
+		case map[string]interface{}:
+			if m, ok := pluralMessage(v); ok {
+				flat[key] = m
+				continue
+			}
+			if err := flatten(flat, key, v); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("message %s is a %T, not a string", key, value)
+		}
+	}
+
+	return nil
+}
+
+// pluralMessage returns the message of `values` if all of its keys are the plural categories.
+func pluralMessage(values map[string]interface{}) (message, bool) {
+	if _, ok := values["other"]; !ok {
+		return nil, false
+	}
+
+	m := message{}
+	for category, value := range values {
+		text, ok := value.(string)
+		if !ok || !pluralCategories[category] {
+			return nil, false
+		}
+		m[category] = text
+	}
+
+	return m, true
+}
+
+// Locales returns the locales of the bundle as their files are named, sorted.
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	locales := make([]string, 0, len(b.locales))
+	for _, locale := range b.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// DefaultLocale returns the locale used when no other one matches.
+func (b *Bundle) DefaultLocale() string {
+	return b.defaultLocale
+}
+
+// Match returns the first of `locales` the bundle has, its language is tried as well, like `en` for
+// `en-US`. It returns the default locale if none of them matches.
+func (b *Bundle) Match(locales ...string) string {
+	if locale, ok := b.match(locales...); ok {
+		return locale
+	}
+	return b.defaultLocale
+}
+
+func (b *Bundle) match(locales ...string) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, locale := range locales {
+		name := normalize(locale)
+		if name == "" {
+			continue
+		}
+		if l, ok := b.locales[name]; ok {
+			return l, true
+		}
+		if l, ok := b.locales[language(name)]; ok {
+			return l, true
+		}
+	}
+
+	return "", false
+}
+
+// T translates `key` into `locale`, falling back to the language of the locale and to the default
+// locale. It returns the key itself if no locale has it.
+//
+// `args` are either the name and value pairs or a single map of the values of the `{name}`
+// placeholders. A `count` argument selects the plural form of the message by the rules of the
+// language; the `zero` form, if any, is used for 0 in every language.
+func (b *Bundle) T(locale, key string, args ...interface{}) string {
+	values := argValues(args)
+
+	m, locale := b.lookup(locale, key)
+	if m == nil {
+		return key
+	}
+
+	text := m["other"]
+	if count, ok := values[CountArg]; ok {
+		category := pluralCategory(language(locale), count)
+		if n, ok := integer(count); ok && n == 0 {
+			if _, ok := m["zero"]; ok {
+				category = "zero"
+			}
+		}
+		if t, ok := m[category]; ok {
+			text = t
+		}
+	}
+
+	return interpolate(text, values)
+}
+
+func (b *Bundle) lookup(locale, key string) (message, string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	name := normalize(locale)
+	for _, l := range []string{name, language(name), normalize(b.defaultLocale)} {
+		if m, ok := b.messages[l][key]; ok {
+			return m, l
+		}
+	}
+
+	return nil, ""
+}
+
+// argValues returns the values of the name and value pairs or of the map in `args`.
+func argValues(args []interface{}) map[string]interface{} {
+	if len(args) == 1 {
+		switch m := args[0].(type) {
+		case map[string]interface{}:
+			return m
+		case echo.Map:
+			return m
+		}
+	}
+
+	values := make(map[string]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		values[fmt.Sprint(args[i])] = args[i+1]
+	}
+
+	return values
+}
+
+// interpolate replaces the `{name}` placeholders of `text`, the unknown ones are kept.
+func interpolate(text string, values map[string]interface{}) string {
+	if len(values) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		sb.WriteString(text[:start])
+		if value, ok := values[text[start+1:end]]; ok {
+			sb.WriteString(fmt.Sprint(value))
+		} else {
+			sb.WriteString(text[start : end+1])
+		}
+		text = text[end+1:]
+	}
+	sb.WriteString(text)
+
+	return sb.String()
+}
+
+// normalize returns the lower case locale separated by `-`, so that `en_US` and `en-US` are the same.
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// language returns the language of a normalized locale, like `en` for `en-us`.
+func language(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
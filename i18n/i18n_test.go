@@ -0,0 +1,160 @@
+package i18n
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBundles(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{
+		"greeting": "Hello, {name}!",
+		"cart": {
+			"items": {"zero": "Your cart is empty", "one": "{count} item", "other": "{count} items"}
+		},
+		"only_en": "English"
+	}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ja.toml"), []byte(`
+greeting = "こんにちは、{name}さん"
+
+[cart]
+items = { other = "{count}点の商品" }
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ru.json"), []byte(`{
+		"files": {"one": "{count} файл", "few": "{count} файла", "many": "{count} файлов", "other": "{count} файла"}
+	}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("ignored"), 0o644))
+
+	return dir
+}
+
+func TestBundle(t *testing.T) {
+	b, err := Load(writeBundles(t), "en")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"en", "ja", "ru"}, b.Locales())
+
+	assert.Equal(t, "Hello, Bob!", b.T("en", "greeting", "name", "Bob"))
+	assert.Equal(t, "Hello, Bob!", b.T("en-US", "greeting", map[string]interface{}{"name": "Bob"}))
+	assert.Equal(t, "こんにちは、Bobさん", b.T("ja_JP", "greeting", echo.Map{"name": "Bob"}))
+	assert.Equal(t, "Hello, {name}!", b.T("en", "greeting"))
+
+	assert.Equal(t, "Your cart is empty", b.T("en", "cart.items", "count", 0))
+	assert.Equal(t, "1 item", b.T("en", "cart.items", "count", 1))
+	assert.Equal(t, "2 items", b.T("en", "cart.items", "count", 2))
+	assert.Equal(t, "1.5 items", b.T("en", "cart.items", "count", 1.5))
+	assert.Equal(t, "1点の商品", b.T("ja", "cart.items", "count", 1))
+
+	assert.Equal(t, "1 файл", b.T("ru", "files", "count", 1))
+	assert.Equal(t, "3 файла", b.T("ru", "files", "count", 3))
+	assert.Equal(t, "11 файлов", b.T("ru", "files", "count", 11))
+	assert.Equal(t, "21 файл", b.T("ru", "files", "count", 21))
+
+	// Falls back to the default locale, then to the key.
+	assert.Equal(t, "English", b.T("ja", "only_en"))
+	assert.Equal(t, "missing.key", b.T("ja", "missing.key"))
+
+	assert.Equal(t, "ja", b.Match("fr", "ja-JP"))
+	assert.Equal(t, "en", b.Match("fr"))
+}
+
+func TestBundleInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"count": 1}`), 0o644))
+
+	_, err := Load(dir, "en")
+	assert.ErrorContains(t, err, "message count is a float64")
+
+	_, err = Load(filepath.Join(dir, "missing"), "en")
+	assert.Error(t, err)
+}
+
+func TestBundleWatch(t *testing.T) {
+	dir := writeBundles(t)
+	b, err := Load(dir, "en")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Watch(ctx, 10*time.Millisecond, func(err error) { t.Error(err) })
+
+	file := filepath.Join(dir, "en.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"greeting": "Hi, {name}!"}`), 0o644))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+
+	assert.Eventually(t, func() bool {
+		return b.T("en", "greeting", "name", "Bob") == "Hi, Bob!"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "only_en", b.T("en", "only_en"))
+}
+
+func TestMiddleware(t *testing.T) {
+	b, err := Load(writeBundles(t), "en")
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(Middleware(b))
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, Locale(c)+": "+T(c, "greeting", "name", "Bob"))
+	})
+
+	serve := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/", nil)
+	assert.Equal(t, "en: Hello, Bob!", rec.Body.String())
+	assert.Equal(t, "en", rec.Header().Get("Content-Language"))
+
+	rec = serve("/", http.Header{"Accept-Language": {"fr;q=0.9, ja-JP;q=0.8, en;q=0.1"}})
+	assert.Equal(t, "ja: こんにちは、Bobさん", rec.Body.String())
+
+	// The query parameter wins and is remembered by the cookie.
+	rec = serve("/?lang=ja", http.Header{"Accept-Language": {"en"}})
+	assert.Equal(t, "ja: こんにちは、Bobさん", rec.Body.String())
+	cookie := rec.Result().Cookies()[0]
+	assert.Equal(t, "lang", cookie.Name)
+	assert.Equal(t, "ja", cookie.Value)
+
+	rec = serve("/", http.Header{"Accept-Language": {"en"}, "Cookie": {cookie.String()}})
+	assert.Equal(t, "ja: こんにちは、Bobさん", rec.Body.String())
+
+	// An unsupported locale of the query parameter is ignored.
+	rec = serve("/?lang=fr", http.Header{"Accept-Language": {"ja"}})
+	assert.Equal(t, "ja: こんにちは、Bobさん", rec.Body.String())
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestTWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Equal(t, "greeting", T(c, "greeting"))
+	assert.Empty(t, Locale(c))
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	b, err := Load(writeBundles(t), "en")
+	require.NoError(t, err)
+
+	tpl := template.Must(template.New("").Funcs(TemplateFuncs(b)).Parse(`{{ t .locale "cart.items" "count" .count }}`))
+
+	var buf bytes.Buffer
+	require.NoError(t, tpl.Execute(&buf, map[string]interface{}{"locale": "en", "count": 3}))
+	assert.Equal(t, "3 items", buf.String())
+}
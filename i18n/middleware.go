@@ -0,0 +1,171 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package i18n
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/validator"
+)
+
+const (
+	// LocaleContextKey is the key of the locale of the request in the echo context and in the map
+	// data of the templates.
+	LocaleContextKey = "locale"
+
+	bundleContextKey = "i18n.bundle"
+)
+
+// Config defines the config for the i18n middleware.
+type Config struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Bundle is the messages of the supported locales.
+	// Required.
+	Bundle *Bundle
+
+	// QueryParam is the query parameter selecting the locale, like `?lang=ja`. The selected locale
+	// is remembered in the cookie.
+	// Optional. Default value "lang".
+	QueryParam string
+
+	// CookieName is the cookie remembering the locale selected by the query parameter.
+	// Optional. Default value "lang".
+	CookieName string
+
+	// CookieMaxAge is the max age of the cookie in seconds.
+	// Optional. Default value 1 year.
+	CookieMaxAge int
+}
+
+// DefaultConfig is the default i18n middleware config.
+var DefaultConfig = Config{
+	Skipper:      middleware.DefaultSkipper,
+	QueryParam:   "lang",
+	CookieName:   "lang",
+	CookieMaxAge: 365 * 24 * 60 * 60,
+}
+
+// Middleware returns an i18n middleware translating by `bundle` with the default config.
+func Middleware(bundle *Bundle) echo.MiddlewareFunc {
+	config := DefaultConfig
+	config.Bundle = bundle
+	return MiddlewareWithConfig(config)
+}
+
+// MiddlewareWithConfig returns a middleware which detects the locale of the request from the query
+// parameter, the cookie and the `Accept-Language` header in this order, falling back to the default
+// locale of the bundle. The locale is set to the `Content-Language` response header and is used by `T`.
+func MiddlewareWithConfig(config Config) echo.MiddlewareFunc {
+	if config.Bundle == nil {
+		panic("echo: i18n middleware requires a bundle")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultConfig.Skipper
+	}
+	if config.QueryParam == "" {
+		config.QueryParam = DefaultConfig.QueryParam
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultConfig.CookieName
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = DefaultConfig.CookieMaxAge
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			locale := detect(c, config)
+
+			c.Set(LocaleContextKey, locale)
+			c.Set(bundleContextKey, config.Bundle)
+			c.Response().Header().Set("Content-Language", locale)
+			c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+
+			return next(c)
+		}
+	}
+}
+
+func detect(c echo.Context, config Config) string {
+	bundle := config.Bundle
+
+	if lang := c.QueryParam(config.QueryParam); lang != "" {
+		if locale, ok := bundle.match(lang); ok {
+			c.SetCookie(&http.Cookie{
+				Name:     config.CookieName,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   config.CookieMaxAge,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return locale
+		}
+	}
+
+	if cookie, err := c.Cookie(config.CookieName); err == nil && cookie.Value != "" {
+		return bundle.Match(cookie.Value)
+	}
+
+	return bundle.Match(validator.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))...)
+}
+
+// Locale returns the locale of the request detected by the middleware, empty if it didn't run.
+func Locale(c echo.Context) string {
+	locale, _ := c.Get(LocaleContextKey).(string)
+	return locale
+}
+
+// T translates `key` into the locale of the request, see `Bundle.T` for `args`. It returns the key
+// itself if the middleware didn't run.
+func T(c echo.Context, key string, args ...interface{}) string {
+	bundle, ok := c.Get(bundleContextKey).(*Bundle)
+	if !ok {
+		return key
+	}
+
+	return bundle.T(Locale(c), key, args...)
+}
+
+// TemplateFuncs returns the `t` template func translating by `bundle`, the locale of the request is
+// added to the `locale` key of a map data by the echo view engine.
+//
+// Example:
+//
+//	<p>{{ t .locale "cart.items" "count" .count }}</p>
+func TemplateFuncs(bundle *Bundle) template.FuncMap {
+	return template.FuncMap{
+		"t": func(locale, key string, args ...interface{}) string {
+			return bundle.T(locale, key, args...)
+		},
+	}
+}
@@ -0,0 +1,202 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of the uploaded file.
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// rowDecoder reads the next row into a new struct. It returns `io.EOF` when there are no more rows.
+type rowDecoder func() (interface{}, error)
+
+func newDecoder(format Format, r io.Reader, newRow func() interface{}) (rowDecoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVDecoder(r, newRow)
+	case FormatJSON:
+		return newJSONDecoder(r, newRow)
+	default:
+		return nil, fmt.Errorf("importer: unsupported format %q", format)
+	}
+}
+
+// newJSONDecoder streams a JSON array of objects without loading the whole array in memory.
+func newJSONDecoder(r io.Reader, newRow func() interface{}) (rowDecoder, error) {
+	dec := json.NewDecoder(r)
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := t.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("importer: JSON input must be an array of objects")
+	}
+
+	return func() (interface{}, error) {
+		if !dec.More() {
+			return nil, io.EOF
+		}
+
+		row := newRow()
+		if err := dec.Decode(row); err != nil {
+			return nil, err
+		}
+
+		return row, nil
+	}, nil
+}
+
+// newCSVDecoder streams a CSV file whose first line is the header.
+func newCSVDecoder(r io.Reader, newRow func() interface{}) (rowDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Map every column to the struct field index.
+	rowType := reflect.TypeOf(newRow()).Elem()
+	fieldsByName := map[string]int{}
+	for i := 0; i < rowType.NumField(); i++ {
+		f := rowType.Field(i)
+		name := strings.Split(f.Tag.Get("csv"), ",")[0]
+		if name == "" {
+			name = strings.Split(f.Tag.Get("json"), ",")[0]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name != "-" {
+			fieldsByName[strings.ToLower(name)] = i
+		}
+	}
+
+	columns := make([]int, len(header))
+	for i, h := range header {
+		idx, ok := fieldsByName[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))]
+		if !ok {
+			idx = -1
+		}
+		columns[i] = idx
+	}
+
+	return func() (interface{}, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		row := newRow()
+		v := reflect.ValueOf(row).Elem()
+
+		for i, value := range record {
+			if i >= len(columns) || columns[i] < 0 {
+				continue
+			}
+
+			if err := setField(v.Field(columns[i]), value); err != nil {
+				return nil, fmt.Errorf("column %q: %w", header[i], err)
+			}
+		}
+
+		return row, nil
+	}, nil
+}
+
+// setField converts the CSV string value into the field type.
+func setField(f reflect.Value, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	if f.Kind() == reflect.Ptr {
+		ptr := reflect.New(f.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(ptr)
+		return nil
+	}
+
+	if f.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+
+	return nil
+}
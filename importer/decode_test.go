@@ -0,0 +1,80 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package importer
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRow struct {
+	Name  string  `csv:"name"`
+	Age   int     `json:"age"`
+	Score float64 // Matched by the field name.
+	Admin *bool   `csv:"is_admin"`
+}
+
+func TestCSVDecoder(t *testing.T) {
+	input := "\ufeffName,AGE,score,is_admin\nalice,30,1.5,true\nbob,x,2,\n"
+
+	next, err := newDecoder(FormatCSV, strings.NewReader(input), func() interface{} { return &testRow{} })
+	assert.NoError(t, err)
+
+	row, err := next()
+	assert.NoError(t, err)
+	r := row.(*testRow)
+	assert.Equal(t, "alice", r.Name)
+	assert.Equal(t, 30, r.Age)
+	assert.Equal(t, 1.5, r.Score)
+	if assert.NotNil(t, r.Admin) {
+		assert.True(t, *r.Admin)
+	}
+
+	_, err = next()
+	assert.Error(t, err)
+
+	_, err = next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestJSONDecoder(t *testing.T) {
+	input := `[{"name":"alice","age":30},{"name":"bob","age":40}]`
+
+	next, err := newDecoder(FormatJSON, strings.NewReader(input), func() interface{} { return &testRow{} })
+	assert.NoError(t, err)
+
+	var names []string
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, row.(*testRow).Name)
+	}
+
+	assert.Equal(t, []string{"alice", "bob"}, names)
+}
@@ -0,0 +1,337 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/validator"
+)
+
+// Config defines the config of an `Importer`.
+type Config struct {
+	// Store keeps the job status. Default value is a `MemoryJobStore`.
+	Store JobStore
+	// PoolName is the name of the goroutine pool (see `pools` in env.json) used to run the imports.
+	// Optional. Default value "" means a plain goroutine.
+	PoolName string
+	// MaxRowErrors is the maximum number of row errors kept in a job. Default value is 100.
+	MaxRowErrors int
+	// TempDir is the directory where uploads are spooled. Default value is `os.TempDir()`.
+	TempDir string
+	// FileField is the multipart form field of the uploaded file. Default value is `file`.
+	FileField string
+}
+
+// Importer runs the import jobs.
+type Importer struct {
+	config Config
+}
+
+// New returns an `Importer`.
+func New(config Config) *Importer {
+	if config.Store == nil {
+		config.Store = NewMemoryJobStore(0)
+	}
+	if config.MaxRowErrors <= 0 {
+		config.MaxRowErrors = 100
+	}
+	if config.TempDir == "" {
+		config.TempDir = os.TempDir()
+	}
+	if config.FileField == "" {
+		config.FileField = "file"
+	}
+
+	return &Importer{config: config}
+}
+
+// Start spools `r` into a temporary file and starts importing it asynchronously. The returned job
+// can be polled using `Job`.
+func (im *Importer) Start(c context.Context, schemaName string, format Format, r io.Reader) (*Job, error) {
+	schema, err := getSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(im.config.TempDir, "bean-import-*")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, errors.WithStack(err)
+	}
+
+	job := &Job{
+		ID:        uuid.NewString(),
+		Schema:    schemaName,
+		Format:    format,
+		Status:    JobPending,
+		Size:      size,
+		RowErrors: []RowError{},
+		CreatedAt: time.Now(),
+	}
+
+	if err := im.config.Store.Save(c, job); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, &storeError{err: err}
+	}
+
+	// The job is updated by the import goroutine, so the caller gets its own copy.
+	snapshot := *job
+	snapshot.RowErrors = []RowError{}
+
+	async.Execute(func() {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		im.run(context.Background(), schema, job, tmp)
+	}, im.poolNames()...)
+
+	return &snapshot, nil
+}
+
+// StartFromRequest starts an import from a multipart upload (field `FileField`) or from the raw request body.
+// The format is detected from the file extension or the `Content-Type` header.
+func (im *Importer) StartFromRequest(c echo.Context, schemaName string) (*Job, error) {
+	if fh, err := c.FormFile(im.config.FileField); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer f.Close()
+
+		format := detectFormat(filepath.Ext(fh.Filename), fh.Header.Get(echo.HeaderContentType))
+		return im.Start(c.Request().Context(), schemaName, format, f)
+	}
+
+	format := detectFormat("", c.Request().Header.Get(echo.HeaderContentType))
+	return im.Start(c.Request().Context(), schemaName, format, c.Request().Body)
+}
+
+// Job returns the current status of a job.
+func (im *Importer) Job(c context.Context, id string) (*Job, error) {
+	return im.config.Store.Get(c, id)
+}
+
+// UploadHandler returns an echo handler which starts an import and replies `202 Accepted` with the job.
+func (im *Importer) UploadHandler(schemaName string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := im.StartFromRequest(c, schemaName)
+		var se *storeError
+		if errors.As(err, &se) {
+			return berror.NewAPIError(http.StatusInternalServerError, berror.INTERNAL_SERVER_ERROR, se.err)
+		} else if err != nil {
+			return berror.NewAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, err)
+		}
+
+		return c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// StatusHandler returns an echo handler which replies the job identified by the `:id` path parameter.
+func (im *Importer) StatusHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := im.Job(c.Request().Context(), c.Param("id"))
+		if err == ErrJobNotFound {
+			return berror.NewIgnorableAPIError(http.StatusNotFound, berror.RESOURCE_NOT_FOUND, err)
+		} else if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, job)
+	}
+}
+
+func (im *Importer) run(c context.Context, schema Schema, job *Job, f *os.File) {
+	now := time.Now()
+	job.Status = JobRunning
+	job.StartedAt = &now
+	im.save(c, job)
+
+	counter := &countingReader{r: f}
+	err := im.process(c, schema, job, counter)
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	job.BytesRead = atomic.LoadInt64(&counter.n)
+	job.Progress = 1
+
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		bean.Logger().Errorf("importer: job %s (%s) failed: %v", job.ID, job.Schema, err)
+	} else {
+		job.Status = JobCompleted
+	}
+
+	im.save(c, job)
+}
+
+func (im *Importer) process(c context.Context, schema Schema, job *Job, r *countingReader) error {
+	next, err := newDecoder(job.Format, r, schema.NewRow)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]interface{}, 0, schema.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := schema.Process(c, batch); err != nil {
+			return err
+		}
+
+		job.Succeeded += len(batch)
+		job.BytesRead = atomic.LoadInt64(&r.n)
+		if job.Size > 0 {
+			job.Progress = float64(job.BytesRead) / float64(job.Size)
+		}
+		batch = batch[:0]
+		im.save(c, job)
+
+		return nil
+	}
+
+	for rowNum := 1; ; rowNum++ {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		job.Processed++
+
+		if err != nil {
+			// A broken JSON can not be recovered, but a broken CSV line can be skipped.
+			if job.Format == FormatJSON {
+				return err
+			}
+			im.addRowError(job, rowNum, []map[string]string{{"field": "", "code": "invalid_row", "message": err.Error()}})
+			continue
+		}
+
+		if err := schema.Validate(row); err != nil {
+			if ve, ok := err.(*validator.ValidationError); ok {
+				im.addRowError(job, rowNum, ve.ErrCollection())
+			} else {
+				im.addRowError(job, rowNum, []map[string]string{{"field": "", "code": "invalid_row", "message": err.Error()}})
+			}
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == schema.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+func (im *Importer) addRowError(job *Job, row int, errs []map[string]string) {
+	job.Failed++
+	if len(job.RowErrors) < im.config.MaxRowErrors {
+		job.RowErrors = append(job.RowErrors, RowError{Row: row, Errors: errs})
+	}
+}
+
+func (im *Importer) save(c context.Context, job *Job) {
+	if err := im.config.Store.Save(c, job); err != nil {
+		bean.Logger().Error(err)
+	}
+}
+
+func (im *Importer) poolNames() []string {
+	if im.config.PoolName == "" {
+		return nil
+	}
+	return []string{im.config.PoolName}
+}
+
+func detectFormat(ext, contentType string) Format {
+	switch strings.ToLower(ext) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return FormatCSV
+	case echo.MIMEApplicationJSON:
+		return FormatJSON
+	}
+
+	return Format(fmt.Sprintf("unknown(%s)", contentType))
+}
+
+// storeError is returned by `Start` when the job can not be saved, so that the handler can tell it
+// apart from a bad upload.
+type storeError struct {
+	err error
+}
+
+func (e *storeError) Error() string { return e.err.Error() }
+
+func (e *storeError) Unwrap() error { return e.err }
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(&cr.n, int64(n))
+	return n, err
+}
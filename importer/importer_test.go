@@ -0,0 +1,108 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct{}
+
+func (failingStore) Save(c context.Context, job *Job) error {
+	return errors.New("store is down")
+}
+
+func (failingStore) Get(c context.Context, id string) (*Job, error) {
+	return nil, ErrJobNotFound
+}
+
+func TestStartReturnsSnapshot(t *testing.T) {
+	require.NoError(t, Register("snapshot", Schema{
+		NewRow:    func() interface{} { return &testRow{} },
+		Process:   func(c context.Context, rows []interface{}) error { return nil },
+		BatchSize: 1,
+	}))
+
+	im := New(Config{})
+	input := "name,age\n" + strings.Repeat("alice,30\n", 200)
+
+	job, err := im.Start(context.Background(), "snapshot", FormatCSV, strings.NewReader(input))
+	require.NoError(t, err)
+
+	// Reading the returned job while the import is running must not race (run with -race).
+	var current *Job
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err := json.Marshal(job)
+		require.NoError(t, err)
+
+		current, err = im.Job(context.Background(), job.ID)
+		require.NoError(t, err)
+		if current.Status == JobCompleted {
+			break
+		}
+	}
+
+	assert.Equal(t, JobCompleted, current.Status)
+	assert.Equal(t, 200, current.Succeeded)
+
+	assert.Equal(t, JobPending, job.Status)
+	assert.Equal(t, 0, job.Succeeded)
+}
+
+func TestUploadHandlerStoreError(t *testing.T) {
+	require.NoError(t, Register("store_error", Schema{
+		NewRow:  func() interface{} { return &testRow{} },
+		Process: func(c context.Context, rows []interface{}) error { return nil },
+	}))
+
+	im := New(Config{Store: failingStore{}})
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("name\nalice\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	err := im.UploadHandler("store_error")(c)
+	apiErr, ok := err.(*berror.APIError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.HTTPStatusCode)
+	assert.Equal(t, berror.INTERNAL_SERVER_ERROR, apiErr.GlobalErrCode)
+
+	err = im.UploadHandler("unknown")(c)
+	apiErr, ok = err.(*berror.APIError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
+}
@@ -0,0 +1,142 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package importer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// JobStatus is the state of an import job.
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+var ErrJobNotFound = errors.New("importer: job not found")
+
+// RowError holds the validation or decoding errors of a single row. `Row` starts from 1 (excluding the CSV header).
+type RowError struct {
+	Row    int                 `json:"row"`
+	Errors []map[string]string `json:"errors"`
+}
+
+// Job represents the progress and the result of an import.
+type Job struct {
+	ID         string     `json:"id"`
+	Schema     string     `json:"schema"`
+	Format     Format     `json:"format"`
+	Status     JobStatus  `json:"status"`
+	Size       int64      `json:"size"`
+	BytesRead  int64      `json:"bytesRead"`
+	Progress   float64    `json:"progress"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	RowErrors  []RowError `json:"rowErrors"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobStore persists the import jobs so that the status can be polled, even from another replica if the
+// store is shared (example: redis or MySQL).
+type JobStore interface {
+	Save(c context.Context, job *Job) error
+	Get(c context.Context, id string) (*Job, error)
+}
+
+// MemoryJobStore keeps the jobs in the process memory. The oldest finished jobs are removed when
+// the number of jobs exceeds `Max`.
+type MemoryJobStore struct {
+	Max int
+
+	mu    sync.RWMutex
+	jobs  map[string]*Job
+	order []string
+}
+
+// NewMemoryJobStore returns a job store keeping at most `max` jobs.
+func NewMemoryJobStore(max int) *MemoryJobStore {
+	if max <= 0 {
+		max = 1000
+	}
+
+	return &MemoryJobStore{
+		Max:  max,
+		jobs: make(map[string]*Job),
+	}
+}
+
+// Save implements the `JobStore.Save` function.
+func (s *MemoryJobStore) Save(c context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		s.order = append(s.order, job.ID)
+	}
+
+	cp := *job
+	cp.RowErrors = append([]RowError(nil), job.RowErrors...)
+	s.jobs[job.ID] = &cp
+
+	// Evict the oldest finished jobs.
+	for len(s.order) > s.Max {
+		evicted := false
+		for i, id := range s.order {
+			if j := s.jobs[id]; j.Status == JobCompleted || j.Status == JobFailed {
+				delete(s.jobs, id)
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				evicted = true
+				break
+			}
+		}
+		if !evicted {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Get implements the `JobStore.Get` function.
+func (s *MemoryJobStore) Get(c context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	cp := *job
+	return &cp, nil
+}
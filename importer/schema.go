@@ -0,0 +1,141 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package importer provides a bulk import pipeline for large CSV or JSON uploads. The upload is spooled
+// to a temporary file, streamed row by row, validated against a registered schema and processed in
+// batches asynchronously. The progress of every import is tracked as a job which can be polled.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	validatorV10 "github.com/go-playground/validator/v10"
+	"github.com/retail-ai-inc/bean/validator"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Schema describes how a row is decoded, validated and stored.
+type Schema struct {
+	// NewRow returns a pointer to a new struct which a row will be decoded into. CSV columns are matched
+	// using the `csv` field tag (or `json` tag if there is no `csv` tag). Required.
+	NewRow func() interface{}
+	// Process stores a batch of valid rows. It must be idempotent (example: upsert) because a batch
+	// can be processed again when an import is retried. Required.
+	Process func(c context.Context, rows []interface{}) error
+	// BatchSize is the number of rows passed to `Process`. Default value is 500.
+	BatchSize int
+	// Validate is called for every decoded row. Default value validates the struct with the `validate` tags.
+	Validate func(row interface{}) error
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = make(map[string]Schema)
+
+	defaultValidate = validatorV10.New()
+)
+
+// Register makes an import schema available by the provided name.
+// If Register is called twice with the same name or if the schema is incomplete, it returns error.
+func Register(name string, schema Schema) error {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if schema.NewRow == nil || schema.Process == nil {
+		return errors.New("importer: Register schema must have NewRow and Process")
+	}
+
+	if _, dup := schemas[name]; dup {
+		return errors.New("importer: Register called twice for schema " + name)
+	}
+
+	if schema.BatchSize <= 0 {
+		schema.BatchSize = 500
+	}
+
+	if schema.Validate == nil {
+		schema.Validate = func(row interface{}) error {
+			return (&validator.DefaultValidator{Validator: defaultValidate}).Validate(row)
+		}
+	}
+
+	schemas[name] = schema
+	return nil
+}
+
+// Schemas returns a sorted list of the names of the registered schemas.
+func Schemas() []string {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	list := make([]string, 0, len(schemas))
+	for name := range schemas {
+		list = append(list, name)
+	}
+
+	sort.Strings(list)
+	return list
+}
+
+func getSchema(name string) (Schema, error) {
+	schemasMu.RLock()
+	schema, ok := schemas[name]
+	schemasMu.RUnlock()
+
+	if !ok {
+		return Schema{}, fmt.Errorf("importer: unknown schema name %q", name)
+	}
+
+	return schema, nil
+}
+
+// GormUpsert returns a `Schema.Process` function which inserts the rows or updates all the columns
+// when a row conflicts on the given unique columns, so processing the same batch twice is harmless.
+func GormUpsert(db func(c context.Context) *gorm.DB, conflictColumns ...string) func(c context.Context, rows []interface{}) error {
+	columns := make([]clause.Column, len(conflictColumns))
+	for i, name := range conflictColumns {
+		columns[i] = clause.Column{Name: name}
+	}
+
+	return func(c context.Context, rows []interface{}) error {
+		if len(rows) == 0 {
+			return nil
+		}
+
+		// gorm needs a typed slice to create in batch.
+		slice := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(rows[0])), 0, len(rows))
+		for _, row := range rows {
+			slice = reflect.Append(slice, reflect.ValueOf(row))
+		}
+
+		return db(c).WithContext(c).Clauses(clause.OnConflict{
+			Columns:   columns,
+			UpdateAll: true,
+		}).Create(slice.Interface()).Error
+	}
+}
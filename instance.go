@@ -0,0 +1,157 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/shutdown"
+)
+
+type beanContextKey struct{}
+
+var (
+	instancesMu sync.RWMutex
+	instances   = map[*echo.Echo]*Bean{}
+	instanceSeq uint64
+)
+
+// register makes `b` the bean instance of its echo, for `Of`, and attaches its orchestrator to the
+// shutdown of the process.
+func register(b *Bean) {
+	instancesMu.Lock()
+	instanceSeq++
+	b.instanceID = instanceSeq
+	instances[b.Echo] = b
+	instancesMu.Unlock()
+
+	// The instance is forgotten once it's stopped, so that the process can create and stop instances, like
+	// the tests, without keeping them all. The errors are `shutdown.ErrStarted` if the process is shutting
+	// down already, the instance is then stopped by `Bean.Shutdown` only.
+	_ = b.ShutdownOrchestrator().Register(shutdown.Component{
+		Name:  "instance",
+		Stage: shutdown.StageClose,
+		Stop: func(context.Context) error {
+			unregister(b)
+			return nil
+		},
+	})
+	_ = shutdown.Attach(b.shutdownPrefix(), b.ShutdownOrchestrator())
+}
+
+// unregister removes `b` and the middlewares recorded for its echo.
+func unregister(b *Bean) {
+	instancesMu.Lock()
+	if instances[b.Echo] == b {
+		delete(instances, b.Echo)
+	}
+	instancesMu.Unlock()
+
+	forgetMiddlewares(b.Echo)
+
+	urlEchoMu.Lock()
+	if urlEcho == b.Echo {
+		urlEcho = nil
+	}
+	urlEchoMu.Unlock()
+}
+
+// ShutdownOrchestrator returns the orchestrator of the components of the instance, like its http server,
+// its databases and its modules, so that the instances of a process don't replace the components of each
+// other. They are stopped by the `Shutdown` function with the subsystems of the process, their names
+// prefixed with the instance like "bean1/http", or by `Bean.Shutdown`.
+func (b *Bean) ShutdownOrchestrator() *shutdown.Orchestrator {
+	b.orchestratorOnce.Do(func() {
+		b.orchestrator = shutdown.New()
+	})
+
+	return b.orchestrator
+}
+
+// Shutdown stops the components of the instance only and returns the report, like the instance of a test.
+// The subsystems of the process, like the goroutine pools and the log files, are stopped by the `Shutdown`
+// function. It runs once, the next calls wait for the first one.
+func (b *Bean) Shutdown(c context.Context) shutdown.Report {
+	orchestrator := b.ShutdownOrchestrator()
+	setShutdownTimeouts(b.Config, orchestrator.SetTimeout)
+
+	report := orchestrator.Shutdown(c)
+	shutdown.Detach(b.shutdownPrefix())
+
+	return report
+}
+
+// shutdownPrefix prefixes the names of the components of the instance in the shutdown of the process.
+func (b *Bean) shutdownPrefix() string {
+	return "bean" + strconv.FormatUint(b.instanceID, 10) + "/"
+}
+
+// Of returns the bean instance created by `New` with the echo `e`, e.g. `bean.Of(c.Echo())` in a handler. It
+// returns nil if `e` is not the echo of a bean instance.
+func Of(e *echo.Echo) *Bean {
+	if e == nil {
+		return nil
+	}
+
+	instancesMu.RLock()
+	defer instancesMu.RUnlock()
+
+	return instances[e]
+}
+
+// WithContext returns a copy of `ctx` carrying the bean instance `b`, for `FromContext`.
+func WithContext(ctx context.Context, b *Bean) context.Context {
+	return context.WithValue(ctx, beanContextKey{}, b)
+}
+
+// FromContext returns the bean instance serving the request of `ctx`, or nil if `ctx` doesn't carry one.
+// Every request context of a bean instance carries it.
+func FromContext(ctx context.Context) *Bean {
+	if ctx == nil {
+		return nil
+	}
+
+	b, _ := ctx.Value(beanContextKey{}).(*Bean)
+
+	return b
+}
+
+// contextMiddleware puts the bean instance in the request context.
+func (b *Bean) contextMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(WithContext(req.Context(), b)))
+
+			return next(c)
+		}
+	}
+}
+
+// Logger returns the debug logger of the bean instance.
+func (b *Bean) Logger() echo.Logger {
+	return b.Echo.Logger
+}
@@ -0,0 +1,83 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInstance(out *bytes.Buffer, name string) *Bean {
+	e := echo.New()
+	e.Logger.SetOutput(out)
+
+	b := &Bean{Echo: e}
+	b.Config.ProjectName = name
+	register(b)
+
+	return b
+}
+
+func TestInstances(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	b1, b2 := newInstance(&out1, "one"), newInstance(&out2, "two")
+
+	assert.Same(t, b1, Of(b1.Echo))
+	assert.Same(t, b2, Of(b2.Echo))
+	assert.Nil(t, Of(echo.New()))
+	assert.Nil(t, FromContext(context.Background()))
+
+	for _, b := range []*Bean{b1, b2} {
+		b.Echo.Use(b.contextMiddleware())
+		b.Echo.GET("/", func(c echo.Context) error {
+			ctx := c.Request().Context()
+			LoggerWithContext(ctx).Error(FromContext(ctx).Config.ProjectName)
+			return c.NoContent(http.StatusOK)
+		})
+	}
+
+	b1.Echo.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	b2.Echo.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, out1.String(), `"message":"one"`)
+	assert.NotContains(t, out1.String(), `"message":"two"`)
+	assert.Contains(t, out2.String(), `"message":"two"`)
+}
+
+func TestInstanceShutdown(t *testing.T) {
+	var out bytes.Buffer
+	b1, b2 := newInstance(&out, "one"), newInstance(&out, "two")
+
+	var stopped []string
+	for _, b := range []*Bean{b1, b2} {
+		name := b.Config.ProjectName
+		require.NoError(t, b.ShutdownOrchestrator().Register(shutdown.Component{
+			Name:  "databases",
+			Stage: shutdown.StageClose,
+			Stop: func(context.Context) error {
+				stopped = append(stopped, name)
+				return nil
+			},
+		}))
+	}
+
+	// The components of the same name don't replace each other, and an instance stopped on its own can be
+	// followed by a new one.
+	assert.True(t, b1.Shutdown(context.Background()).Clean())
+	assert.Equal(t, []string{"one"}, stopped)
+	assert.True(t, b2.Shutdown(context.Background()).Clean())
+	assert.Equal(t, []string{"one", "two"}, stopped)
+
+	b3 := newInstance(&out, "three")
+	assert.NoError(t, b3.ShutdownOrchestrator().Register(shutdown.Component{Name: "http", Stop: func(context.Context) error { return nil }}))
+	assert.NotEqual(t, b2.shutdownPrefix(), b3.shutdownPrefix())
+	b3.Shutdown(context.Background())
+}
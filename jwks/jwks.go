@@ -0,0 +1,456 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package jwks signs the tokens issued by bean with rotated RS256 or ES256 keys and publishes their
+// public keys at `/.well-known/jwks.json`, so that the downstream services can verify the tokens.
+//
+// A new key is published before it signs the tokens, until the caches of the key set have expired, so that
+// the downstream services know it when they receive its first token. A key signs the tokens until the next
+// one takes over and is published until `Overlap` after it, which must be longer than the lifetime of the
+// tokens:
+//
+//	keys := jwks.NewManager(jwks.NewRedisKeyStore(client, "myapp:jwks", bean.BeanConfig.Secret), jwks.Config{
+//		Algorithm: "ES256",
+//		Overlap:   2 * viper.GetDuration("jwt.expiration"),
+//	})
+//	if err := keys.Start(ctx); err != nil {
+//		panic(err)
+//	}
+//	e.GET(jwks.Path, keys.Handler())
+//
+//	token, err := keys.Sign(claims)
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+)
+
+// Path is the well-known path of the key set.
+const Path = "/.well-known/jwks.json"
+
+// cacheMaxAge is how long the key set served by `Handler` can be cached.
+const cacheMaxAge = 5 * time.Minute
+
+// ErrUnknownKey is returned by `Keyfunc` if the `kid` of the token is not a published key.
+var ErrUnknownKey = errors.New("jwks: unknown key")
+
+// Config defines the config for `NewManager`.
+type Config struct {
+	// Algorithm of the keys, `RS256` or `ES256`.
+	// Optional. Default value "RS256".
+	Algorithm string
+
+	// RotationInterval is the age after which a new key is added, it signs the tokens once it's published
+	// for the max age of the key set plus `RefreshInterval`.
+	// Optional. Default value 30 days.
+	RotationInterval time.Duration
+
+	// Overlap is how long a rotated key is still published, it must be longer than the lifetime of the tokens.
+	// Optional. Default value 48 hours.
+	Overlap time.Duration
+
+	// RefreshInterval is the interval of `Start` between two loads of the keys of the other replicas.
+	// Optional. Default value 1 minute.
+	RefreshInterval time.Duration
+
+	// RSABits is the size of the RSA keys.
+	// Optional. Default value 2048.
+	RSABits int
+}
+
+// Key is a signing key.
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+}
+
+// StoredKey is a key as saved by a `KeyStore`, the private key is PKCS #8 in PEM.
+type StoredKey struct {
+	ID         string    `json:"id"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey string    `json:"privateKey"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// KeyStore keeps the keys shared by the replicas. The keys are only added or deleted, never updated, so
+// that the replicas rotating at the same time don't lose the key of each other.
+type KeyStore interface {
+	Load(c context.Context) ([]StoredKey, error)
+	Add(c context.Context, key StoredKey) error
+	Delete(c context.Context, id string) error
+}
+
+// Manager signs the tokens with the newest active key and publishes the public keys, safe for the concurrent use.
+type Manager struct {
+	store  KeyStore
+	config Config
+	now    func() time.Time
+
+	mu   sync.RWMutex
+	keys []Key // oldest first
+}
+
+// NewManager returns a manager of the keys of `store`, `Start` or `Load` must be called before signing.
+func NewManager(store KeyStore, config Config) *Manager {
+	if config.Algorithm == "" {
+		config.Algorithm = "RS256"
+	}
+	if config.RotationInterval <= 0 {
+		config.RotationInterval = 30 * 24 * time.Hour
+	}
+	if config.Overlap <= 0 {
+		config.Overlap = 48 * time.Hour
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Minute
+	}
+	if config.RSABits <= 0 {
+		config.RSABits = 2048
+	}
+
+	return &Manager{store: store, config: config, now: time.Now}
+}
+
+// Start loads the keys and keeps reloading and rotating them until `c` is done.
+func (m *Manager) Start(c context.Context) error {
+	if err := m.Load(c); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+				if err := m.Load(c); err != nil {
+					bean.Logger().Errorf("jwks: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Load reloads the keys of the store, deletes the keys rotated for longer than `Overlap` and adds a new key
+// if the newest one is older than `RotationInterval`.
+func (m *Manager) Load(c context.Context) error {
+	keys, err := m.load(c)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 || m.now().Sub(keys[len(keys)-1].CreatedAt) >= m.config.RotationInterval {
+		key, err := m.add(c)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	m.set(keys)
+
+	return nil
+}
+
+// Rotate adds a new key which signs the tokens once it's active. (see `Config.RotationInterval`)
+func (m *Manager) Rotate(c context.Context) error {
+	keys, err := m.load(c)
+	if err != nil {
+		return err
+	}
+
+	key, err := m.add(c)
+	if err != nil {
+		return err
+	}
+
+	m.set(append(keys, key))
+
+	return nil
+}
+
+// Sign returns the token of `claims` signed by the newest active key, with its ID in the `kid` header.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return "", errors.New("jwks: no signing key, call Start or Load first")
+	}
+
+	key := m.keys[m.signingKey(m.keys)]
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc returns the public key of the `kid` of the token, to verify the tokens with `jwt.Parse`.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.ID == kid {
+			if token.Method.Alg() != key.Algorithm {
+				return nil, errors.Errorf("jwks: unexpected algorithm %s of key %s", token.Method.Alg(), kid)
+			}
+			return key.PrivateKey.Public(), nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// JWK is a public key of the key set, as defined by RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// KeySet is the published key set.
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet returns the public keys, newest first.
+func (m *Manager) KeySet() KeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := KeySet{Keys: make([]JWK, 0, len(m.keys))}
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		set.Keys = append(set.Keys, publicJWK(m.keys[i]))
+	}
+
+	return set
+}
+
+// Handler serves the key set, cacheable for 5 minutes.
+func (m *Manager) Handler() echo.HandlerFunc {
+	cacheControl := "public, max-age=" + strconv.Itoa(int(cacheMaxAge/time.Second))
+
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", cacheControl)
+		return c.JSON(http.StatusOK, m.KeySet())
+	}
+}
+
+// load returns the keys of the store still published, oldest first, and deletes the other ones.
+func (m *Manager) load(c context.Context) ([]Key, error) {
+	stored, err := m.store.Load(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+	})
+
+	keys := make([]Key, 0, len(stored))
+	for i, s := range stored {
+		// A key is rotated when the next one is active.
+		if i < len(stored)-1 && m.now().Sub(stored[i+1].CreatedAt.Add(m.activation())) >= m.config.Overlap {
+			if err := m.store.Delete(c, s.ID); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			continue
+		}
+
+		key, err := decodeKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// add generates a key and adds it into the store.
+func (m *Manager) add(c context.Context) (Key, error) {
+	key, err := generateKey(m.config.Algorithm, m.config.RSABits)
+	if err != nil {
+		return Key{}, err
+	}
+	key.CreatedAt = m.now()
+
+	stored, err := encodeKey(key)
+	if err != nil {
+		return Key{}, err
+	}
+
+	if err := m.store.Add(c, stored); err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+
+	return key, nil
+}
+
+// activation is the age from which a key signs the tokens: the other replicas publish it after their next
+// refresh, and the downstream services see it once their cache of the key set has expired.
+func (m *Manager) activation() time.Duration {
+	return cacheMaxAge + m.config.RefreshInterval
+}
+
+// signingKey returns the index of the newest active key of `keys`, oldest first. The first key is active
+// right away as there is no other key to sign with.
+func (m *Manager) signingKey(keys []Key) int {
+	now := m.now()
+	for i := len(keys) - 1; i > 0; i-- {
+		if now.Sub(keys[i].CreatedAt) >= m.activation() {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func (m *Manager) set(keys []Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = keys
+}
+
+func generateKey(alg string, rsaBits int) (Key, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch alg {
+	case "RS256":
+		signer, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return Key{}, errors.Errorf("jwks: unsupported algorithm %q, must be RS256 or ES256", alg)
+	}
+	if err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+	sum := sha256.Sum256(der)
+
+	return Key{
+		ID:         base64.RawURLEncoding.EncodeToString(sum[:12]),
+		Algorithm:  alg,
+		PrivateKey: signer,
+	}, nil
+}
+
+func encodeKey(key Key) (StoredKey, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return StoredKey{}, errors.WithStack(err)
+	}
+
+	return StoredKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  key.CreatedAt,
+	}, nil
+}
+
+func decodeKey(stored StoredKey) (Key, error) {
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil {
+		return Key{}, errors.Errorf("jwks: invalid private key of key %s", stored.ID)
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Key{}, errors.Wrapf(err, "jwks: invalid private key of key %s", stored.ID)
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return Key{}, errors.Errorf("jwks: unsupported private key of key %s", stored.ID)
+	}
+
+	return Key{
+		ID:         stored.ID,
+		Algorithm:  stored.Algorithm,
+		PrivateKey: signer,
+		CreatedAt:  stored.CreatedAt,
+	}, nil
+}
+
+func publicJWK(key Key) JWK {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+
+	switch pub := key.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	}
+
+	return jwk
+}
@@ -0,0 +1,129 @@
+package jwks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(alg string) (*Manager, *time.Time) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewManager(NewMemoryKeyStore(), Config{
+		Algorithm:        alg,
+		RotationInterval: 24 * time.Hour,
+		Overlap:          time.Hour,
+		RSABits:          1024,
+	})
+	m.now = func() time.Time { return now }
+
+	return m, &now
+}
+
+func TestManagerSign(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256"} {
+		t.Run(alg, func(t *testing.T) {
+			m, _ := newTestManager(alg)
+			assert.NoError(t, m.Load(context.Background()))
+
+			signed, err := m.Sign(jwt.RegisteredClaims{Subject: "user-1"})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			claims := &jwt.RegisteredClaims{}
+			token, err := jwt.ParseWithClaims(signed, claims, m.Keyfunc)
+			assert.NoError(t, err)
+			assert.True(t, token.Valid)
+			assert.Equal(t, "user-1", claims.Subject)
+
+			set := m.KeySet()
+			if assert.Len(t, set.Keys, 1) {
+				assert.Equal(t, token.Header["kid"], set.Keys[0].KeyID)
+				assert.Equal(t, alg, set.Keys[0].Algorithm)
+				assert.Equal(t, "sig", set.Keys[0].Use)
+			}
+		})
+	}
+}
+
+func TestManagerRotation(t *testing.T) {
+	m, now := newTestManager("ES256")
+	ctx := context.Background()
+
+	assert.NoError(t, m.Load(ctx))
+	old, err := m.Sign(jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+
+	// Not due yet.
+	*now = now.Add(23 * time.Hour)
+	assert.NoError(t, m.Load(ctx))
+	assert.Len(t, m.KeySet().Keys, 1)
+
+	// Rotated, the new key is published before it signs the tokens.
+	*now = now.Add(time.Hour)
+	assert.NoError(t, m.Load(ctx))
+	set := m.KeySet()
+	assert.Len(t, set.Keys, 2)
+
+	signed, err := m.Sign(jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, kid(t, old), kid(t, signed))
+
+	*now = now.Add(m.activation())
+	signed, err = m.Sign(jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, set.Keys[0].KeyID, kid(t, signed))
+
+	// The old key is still published during the overlap.
+	*now = now.Add(time.Hour - time.Second)
+	assert.NoError(t, m.Load(ctx))
+	assert.Len(t, m.KeySet().Keys, 2)
+
+	_, err = jwt.Parse(old, m.Keyfunc)
+	assert.NoError(t, err)
+
+	// The old key is deleted after the overlap.
+	*now = now.Add(time.Second)
+	assert.NoError(t, m.Load(ctx))
+	assert.Len(t, m.KeySet().Keys, 1)
+
+	_, err = jwt.Parse(old, m.Keyfunc)
+	assert.Error(t, err)
+
+	stored, _ := m.store.Load(ctx)
+	assert.Len(t, stored, 1)
+}
+
+func kid(t *testing.T, signed string) string {
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+	if !assert.NoError(t, err) {
+		return ""
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	return kid
+}
+
+func TestManagerSharedStore(t *testing.T) {
+	m1, _ := newTestManager("ES256")
+	m2 := NewManager(m1.store, m1.config)
+	m2.now = m1.now
+	ctx := context.Background()
+
+	// Both replicas rotate at the same time, none of the keys is lost.
+	assert.NoError(t, m1.Rotate(ctx))
+	assert.NoError(t, m2.Rotate(ctx))
+
+	signed, err := m1.Sign(jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, m2.Load(ctx))
+	_, err = jwt.Parse(signed, m2.Keyfunc)
+	assert.NoError(t, err)
+	assert.Len(t, m2.KeySet().Keys, 2)
+}
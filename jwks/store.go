@@ -0,0 +1,135 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/aes"
+)
+
+// MemoryKeyStore keeps the keys in the process, they are lost on restart so it only suits the tests or
+// a single instance whose tokens are short lived.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]StoredKey
+}
+
+// NewMemoryKeyStore returns an in-process key store.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string]StoredKey{}}
+}
+
+// Load implements `KeyStore`.
+func (s *MemoryKeyStore) Load(c context.Context) ([]StoredKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]StoredKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Add implements `KeyStore`.
+func (s *MemoryKeyStore) Add(c context.Context, key StoredKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+
+	return nil
+}
+
+// Delete implements `KeyStore`.
+func (s *MemoryKeyStore) Delete(c context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, id)
+
+	return nil
+}
+
+// RedisKeyStore keeps the keys in the redis hash `key`, each one encrypted with `BeanAESEncrypt` by the
+// base64 AES key `secret`, `secret` of env.json like the tenant passwords.
+type RedisKeyStore struct {
+	client redis.UniversalClient
+	key    string
+	secret string
+}
+
+// NewRedisKeyStore returns a key store shared by the replicas.
+func NewRedisKeyStore(client redis.UniversalClient, key, secret string) *RedisKeyStore {
+	return &RedisKeyStore{client: client, key: key, secret: secret}
+}
+
+// Load implements `KeyStore`.
+func (s *RedisKeyStore) Load(c context.Context) ([]StoredKey, error) {
+	values, err := s.client.HGetAll(c, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]StoredKey, 0, len(values))
+	for id, value := range values {
+		data, err := aes.BeanAESDecrypt(s.secret, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "jwks: failed to decrypt key %s", id)
+		}
+
+		var key StoredKey
+		if err := json.Unmarshal([]byte(data), &key); err != nil {
+			return nil, errors.Wrapf(err, "jwks: invalid key %s", id)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Add implements `KeyStore`.
+func (s *RedisKeyStore) Add(c context.Context, key StoredKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	value, err := aes.BeanAESEncrypt(s.secret, string(data))
+	if err != nil {
+		return err
+	}
+
+	return s.client.HSet(c, s.key, key.ID, value).Err()
+}
+
+// Delete implements `KeyStore`.
+func (s *RedisKeyStore) Delete(c context.Context, id string) error {
+	return s.client.HDel(c, s.key, id).Err()
+}
@@ -0,0 +1,297 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package leaderboard provides typed helpers on top of the redis sorted sets for the rankings, the
+// trending items and the top-N lists. All the ranks and pages are 1-based, the conversion to the 0-based
+// inclusive ranges of `ZRANGE` is done here once.
+package leaderboard
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+var ErrMemberNotFound = errors.New("leaderboard: member not found")
+
+// Entry is a member of a board with its score and 1-based rank.
+type Entry struct {
+	Member string
+	Score  float64
+	Rank   int64
+}
+
+// Config holds the settings of a `Board`.
+type Config struct {
+	// Prefix is prepended to all redis keys. Default value is `dbdrivers.GetRedisCachePrefix() + ":leaderboard"`.
+	Prefix string
+	// Ascending ranks the lowest score first, like a race time. Default value is false, the highest score first.
+	Ascending bool
+	// MaxSize keeps only the best `MaxSize` members after every write, 0 means unlimited.
+	MaxSize int64
+	// TTL expires the board if it's not written anymore, 0 means never.
+	TTL time.Duration
+}
+
+// Board is a named sorted set, like the ranking of a game or the trending products of a tenant.
+type Board struct {
+	redis  *dbdrivers.RedisDBConn
+	key    string
+	config Config
+}
+
+// New returns the board `name` in the redis connection, which can be a master or a tenant connection.
+func New(redisConn *dbdrivers.RedisDBConn, name string, config Config) *Board {
+	if config.Prefix == "" {
+		config.Prefix = dbdrivers.GetRedisCachePrefix() + ":leaderboard"
+	}
+
+	return &Board{
+		redis:  redisConn,
+		key:    config.Prefix + ":" + name,
+		config: config,
+	}
+}
+
+// Scope returns the board of a sub scope with the same config, like a tenant, a region or a week.
+// Example:
+//
+//	weekly := board.Scope(strconv.FormatUint(tenantID, 10)).Scope("2024-W10")
+func (b *Board) Scope(scope string) *Board {
+	return &Board{redis: b.redis, key: b.key + ":" + scope, config: b.config}
+}
+
+// Key returns the redis key of the board.
+func (b *Board) Key() string {
+	return b.key
+}
+
+// Set sets the score of a member.
+func (b *Board) Set(c context.Context, member string, score float64) error {
+	return b.SetBatch(c, map[string]float64{member: score})
+}
+
+// SetBatch sets the scores of several members in one round trip.
+func (b *Board) SetBatch(c context.Context, scores map[string]float64) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	members := make([]*redis.Z, 0, len(scores))
+	for member, score := range scores {
+		members = append(members, &redis.Z{Score: score, Member: member})
+	}
+
+	_, err := b.redis.Client().TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(c, b.key, members...)
+		b.maintain(c, pipe)
+		return nil
+	})
+
+	return errors.WithStack(err)
+}
+
+// Incr adds `delta` to the score of a member and returns the new score.
+func (b *Board) Incr(c context.Context, member string, delta float64) (float64, error) {
+	var incr *redis.FloatCmd
+
+	_, err := b.redis.Client().TxPipelined(c, func(pipe redis.Pipeliner) error {
+		incr = pipe.ZIncrBy(c, b.key, delta, member)
+		b.maintain(c, pipe)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return incr.Val(), nil
+}
+
+// IncrBatch adds the deltas to the scores of several members in one round trip.
+func (b *Board) IncrBatch(c context.Context, deltas map[string]float64) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	_, err := b.redis.Client().TxPipelined(c, func(pipe redis.Pipeliner) error {
+		for member, delta := range deltas {
+			pipe.ZIncrBy(c, b.key, delta, member)
+		}
+		b.maintain(c, pipe)
+		return nil
+	})
+
+	return errors.WithStack(err)
+}
+
+// Remove removes the members from the board.
+func (b *Board) Remove(c context.Context, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+
+	return errors.WithStack(b.redis.Client().ZRem(c, b.key, values...).Err())
+}
+
+// Get returns the score and the rank of a member, or `ErrMemberNotFound`.
+func (b *Board) Get(c context.Context, member string) (Entry, error) {
+	pipe := b.redis.Client().Pipeline()
+	score := pipe.ZScore(c, b.key, member)
+	var rank *redis.IntCmd
+	if b.config.Ascending {
+		rank = pipe.ZRank(c, b.key, member)
+	} else {
+		rank = pipe.ZRevRank(c, b.key, member)
+	}
+
+	if _, err := pipe.Exec(c); err != nil {
+		if err == redis.Nil {
+			return Entry{}, ErrMemberNotFound
+		}
+		return Entry{}, errors.WithStack(err)
+	}
+
+	return Entry{Member: member, Score: score.Val(), Rank: rank.Val() + 1}, nil
+}
+
+// Top returns the best `n` members.
+func (b *Board) Top(c context.Context, n int64) ([]Entry, error) {
+	if n <= 0 {
+		return []Entry{}, nil
+	}
+
+	return b.rangeByRank(c, 1, n)
+}
+
+// Page returns the members of a 1-based page and the total number of members.
+func (b *Board) Page(c context.Context, page, size int64) ([]Entry, int64, error) {
+	if page <= 0 || size <= 0 {
+		return nil, 0, errors.New("leaderboard: page and size must be positive")
+	}
+
+	total, err := b.Count(c)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	first := (page-1)*size + 1
+	if first > total {
+		return []Entry{}, total, nil
+	}
+
+	entries, err := b.rangeByRank(c, first, first+size-1)
+
+	return entries, total, err
+}
+
+// Around returns the member with up to `n` members before and after it, like "your position" in a ranking.
+func (b *Board) Around(c context.Context, member string, n int64) ([]Entry, error) {
+	entry, err := b.Get(c, member)
+	if err != nil {
+		return nil, err
+	}
+
+	first := entry.Rank - n
+	if first < 1 {
+		first = 1
+	}
+
+	return b.rangeByRank(c, first, entry.Rank+n)
+}
+
+// Count returns the number of members.
+func (b *Board) Count(c context.Context) (int64, error) {
+	count, err := b.redis.Client().ZCard(c, b.key).Result()
+	return count, errors.WithStack(err)
+}
+
+// Decay multiplies all the scores by `factor` (between 0 and 1) and removes the members whose score fell
+// below `minScore`, for the trending lists where the old activity must weigh less than the recent one.
+// Call it periodically, for example every hour with a factor of 0.9.
+func (b *Board) Decay(c context.Context, factor, minScore float64) error {
+	if factor <= 0 || factor >= 1 {
+		return errors.New("leaderboard: decay factor must be between 0 and 1")
+	}
+
+	_, err := b.redis.Client().TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(c, b.key, &redis.ZStore{Keys: []string{b.key}, Weights: []float64{factor}})
+		pipe.ZRemRangeByScore(c, b.key, "-inf", "("+strconv.FormatFloat(minScore, 'g', -1, 64))
+		return nil
+	})
+
+	return errors.WithStack(err)
+}
+
+// Clear deletes the board.
+func (b *Board) Clear(c context.Context) error {
+	return errors.WithStack(b.redis.Client().Del(c, b.key).Err())
+}
+
+// rangeByRank returns the members between the 1-based ranks `first` and `last` inclusive.
+func (b *Board) rangeByRank(c context.Context, first, last int64) ([]Entry, error) {
+	var (
+		zs  []redis.Z
+		err error
+	)
+	if b.config.Ascending {
+		zs, err = b.redis.Client().ZRangeWithScores(c, b.key, first-1, last-1).Result()
+	} else {
+		zs, err = b.redis.Client().ZRevRangeWithScores(c, b.key, first-1, last-1).Result()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entries := make([]Entry, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		entries[i] = Entry{Member: member, Score: z.Score, Rank: first + int64(i)}
+	}
+
+	return entries, nil
+}
+
+// maintain trims the board to `MaxSize` and refreshes its TTL in the same transaction as a write.
+func (b *Board) maintain(c context.Context, pipe redis.Pipeliner) {
+	if b.config.MaxSize > 0 {
+		if b.config.Ascending {
+			// Keep the lowest scores, remove from the rank `MaxSize` (0-based) to the end.
+			pipe.ZRemRangeByRank(c, b.key, b.config.MaxSize, -1)
+		} else {
+			// Keep the highest scores, remove from the start to the rank `MaxSize + 1` from the end.
+			pipe.ZRemRangeByRank(c, b.key, 0, -(b.config.MaxSize + 1))
+		}
+	}
+
+	if b.config.TTL > 0 {
+		pipe.Expire(c, b.key, b.config.TTL)
+	}
+}
@@ -0,0 +1,137 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package leaderboard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBoard(t *testing.T, config Config) (*Board, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	conn := &dbdrivers.RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	config.Prefix = "test"
+
+	return New(conn, "board", config), mr
+}
+
+func TestBoard_SetIncr(t *testing.T) {
+	b, mr := newTestBoard(t, Config{TTL: time.Hour})
+	c := context.Background()
+
+	require.NoError(t, b.Set(c, "alice", 10))
+	require.NoError(t, b.SetBatch(c, map[string]float64{"bob": 5, "carol": 7}))
+
+	score, err := b.Incr(c, "bob", 2.5)
+	require.NoError(t, err)
+	assert.Equal(t, 7.5, score)
+
+	require.NoError(t, b.IncrBatch(c, map[string]float64{"alice": -1, "dave": 1}))
+
+	entry, err := b.Get(c, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, Entry{Member: "alice", Score: 9, Rank: 1}, entry)
+
+	count, err := b.Count(c)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+	assert.Equal(t, time.Hour, mr.TTL("test:board"))
+
+	require.NoError(t, b.Remove(c, "dave"))
+	_, err = b.Get(c, "dave")
+	assert.Equal(t, ErrMemberNotFound, err)
+}
+
+func TestBoard_Rank(t *testing.T) {
+	c := context.Background()
+	scores := map[string]float64{"alice": 10, "bob": 5, "carol": 7}
+
+	desc, _ := newTestBoard(t, Config{})
+	require.NoError(t, desc.SetBatch(c, scores))
+	entry, err := desc.Get(c, "bob")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, entry.Rank)
+
+	asc, _ := newTestBoard(t, Config{Ascending: true})
+	require.NoError(t, asc.SetBatch(c, scores))
+	entry, err = asc.Get(c, "bob")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, entry.Rank)
+
+	around, err := desc.Around(c, "carol", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{"alice", 10, 1}, {"carol", 7, 2}, {"bob", 5, 3}}, around)
+}
+
+func TestBoard_Top(t *testing.T) {
+	b, _ := newTestBoard(t, Config{MaxSize: 3})
+	c := context.Background()
+	require.NoError(t, b.SetBatch(c, map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4}))
+
+	// The lowest score is trimmed by `MaxSize`.
+	top, err := b.Top(c, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{"d", 4, 1}, {"c", 3, 2}, {"b", 2, 3}}, top)
+
+	top, err = b.Top(c, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{"d", 4, 1}, {"c", 3, 2}}, top)
+
+	top, err = b.Top(c, 0)
+	require.NoError(t, err)
+	assert.Empty(t, top)
+
+	page, total, err := b.Page(c, 2, 2)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+	assert.Equal(t, []Entry{{"b", 2, 3}}, page)
+
+	page, _, err = b.Page(c, 3, 2)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+func TestBoard_Ties(t *testing.T) {
+	c := context.Background()
+	scores := map[string]float64{"alice": 5, "bob": 5, "carol": 1}
+
+	// Redis orders the members of the same score lexicographically, reversed for the highest first.
+	desc, _ := newTestBoard(t, Config{})
+	require.NoError(t, desc.SetBatch(c, scores))
+	top, err := desc.Top(c, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{"bob", 5, 1}, {"alice", 5, 2}, {"carol", 1, 3}}, top)
+
+	asc, _ := newTestBoard(t, Config{Ascending: true})
+	require.NoError(t, asc.SetBatch(c, scores))
+	top, err = asc.Top(c, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{"carol", 1, 1}, {"alice", 5, 2}, {"bob", 5, 3}}, top)
+}
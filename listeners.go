@@ -0,0 +1,341 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// handler returns the handler of the server, the echo instance, which also serves HTTP/2 without TLS if
+// `http.h2c` is true and `http.ssl.on` is false.
+func (b *Bean) handler() http.Handler {
+	if b.Config.HTTP.H2C && !b.Config.HTTP.SSL.On {
+		return h2c.NewHandler(b.Echo, &http2.Server{})
+	}
+
+	return b.Echo
+}
+
+// HTTP3Server is a server of HTTP/3, like `*http3.Server` of quic-go.
+type HTTP3Server interface {
+	ListenAndServe() error
+	Close() error
+}
+
+// NewHTTP3ServerFunc creates the server of `http.http3`, which listens on UDP `addr` and serves `handler`,
+// the echo instance. bean doesn't depend on a QUIC implementation, so the application sets it on the
+// instance, e.g. with quic-go:
+//
+//	b.NewHTTP3Server = func(addr string, handler http.Handler, config *tls.Config) bean.HTTP3Server {
+//		return &http3.Server{Addr: addr, Handler: handler, TLSConfig: http3.ConfigureTLSConfig(config)}
+//	}
+//
+// If the server has a `Shutdown(context.Context) error` method then it's called by the shutdown, otherwise
+// `Close`.
+type NewHTTP3ServerFunc func(addr string, handler http.Handler, config *tls.Config) HTTP3Server
+
+// serveHTTP3 starts the HTTP/3 server sharing the echo instance and the TLS config of the TLS server, and
+// returns its port.
+func (b *Bean) serveHTTP3(host, port string, config *tls.Config) (string, error) {
+	if b.NewHTTP3Server == nil {
+		return "", errors.New("`http.http3.on` is true but `NewHTTP3Server` of the bean is not set")
+	}
+
+	if b.Config.HTTP.HTTP3.Port != "" {
+		port = b.Config.HTTP.HTTP3.Port
+	}
+
+	server := b.NewHTTP3Server(host+":"+port, b.Echo, config.Clone())
+
+	stop := func(c context.Context) error { return server.Close() }
+	if s, ok := server.(interface{ Shutdown(context.Context) error }); ok {
+		stop = s.Shutdown
+	}
+
+	// The HTTP/3 server stops accepting requests with the TLS server.
+	if err := b.ShutdownOrchestrator().Register(shutdown.Component{Name: "http3", Stage: shutdown.StageIntake, Stop: stop}); err != nil {
+		return "", err
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			b.Logger().Error("http3: ", err)
+		}
+	}()
+
+	return port, nil
+}
+
+// altSvcMaxAge is how long the clients remember that HTTP/3 is available.
+const altSvcMaxAge = 24 * time.Hour
+
+// altSvc advertises the HTTP/3 listener of `port` to the clients of the TLS server.
+func altSvc(next http.Handler, port string) http.Handler {
+	value := `h3=":` + port + `"; ma=` + formatSeconds(altSvcMaxAge)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			w.Header().Add("Alt-Svc", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// ListenerConfig is a listener of the server next to `host:port`, like an internal port serving the admin
+// routes. (see `http.listeners` of env.json)
+type ListenerConfig struct {
+	// Name of the listener in the logs and the shutdown.
+	// Required.
+	Name string
+	// Address is "host:port", or "unix:" followed by the path of a unix socket.
+	// Required.
+	Address string
+	// SocketMode is the octal permissions of the unix socket, like "0660".
+	// Optional. Default value "", the umask of the process.
+	SocketMode string
+	// Prefixes are the path prefixes of the routes served by the listener, like "/internal".
+	// Optional. Default value nil, all the routes.
+	Prefixes []string
+	// Exclusive removes the routes of `Prefixes` from the server and the other listeners, so that the
+	// internal routes are never reachable from the public port.
+	// Optional. Default value false.
+	Exclusive bool
+	TLS       ListenerTLSConfig
+}
+
+// ListenerTLSConfig is the TLS of a listener, independent of `http.ssl`.
+type ListenerTLSConfig struct {
+	On bool
+	// CertFile and PrivFile are the certificate of the listener.
+	// Optional. Default value the certificate of `http.ssl`.
+	CertFile      string
+	PrivFile      string
+	MinTLSVersion uint16
+	// MTLS requires the certificates of the clients of the listener, see `http.ssl.mtls`.
+	MTLS struct {
+		On           bool
+		ClientCAFile string
+		VerifyMode   string
+	}
+}
+
+const unixAddressPrefix = "unix:"
+
+// address returns the address of the server in the logs, the unix socket of `http.socket` or `host:port`.
+func (b *Bean) address(host, port string) string {
+	if b.Config.HTTP.Socket != "" {
+		return unixAddressPrefix + b.Config.HTTP.Socket
+	}
+	return host + ":" + port
+}
+
+// listen opens a TCP listener on "host:port" or a unix socket on "unix:/path", whose permissions are
+// set to the octal `mode` if it isn't empty.
+func listen(address, mode string) (net.Listener, error) {
+	path := strings.TrimPrefix(address, unixAddressPrefix)
+	if path == address {
+		ln, err := net.Listen("tcp", address)
+		return ln, errors.WithStack(err)
+	}
+
+	// The socket left by a crashed process refuses the new listener, it's removed unless it's still served.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("unix socket %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			ln.Close()
+			return nil, errors.Wrapf(err, "invalid mode %q of the unix socket %s", mode, path)
+		}
+		if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+			ln.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return ln, nil
+}
+
+// serveListeners starts the servers of `http.listeners`, `serverTLS` returns the TLS config of the main
+// server for the listeners without their own certificate.
+func (b *Bean) serveListeners(serverTLS func() (*tls.Config, error)) error {
+	for i, l := range b.Config.HTTP.Listeners {
+		if l.Name == "" || l.Address == "" {
+			return errors.Errorf("http.listeners[%d]: the name and the address are required", i)
+		}
+
+		var config *tls.Config
+		if l.TLS.On {
+			var err error
+			if config, err = listenerTLSConfig(l.TLS, serverTLS); err != nil {
+				return errors.WithMessagef(err, "listener %s", l.Name)
+			}
+		}
+
+		ln, err := listen(l.Address, l.SocketMode)
+		if err != nil {
+			return errors.WithMessagef(err, "listener %s", l.Name)
+		}
+
+		var handler http.Handler = b.Echo
+		if b.Config.HTTP.H2C && config == nil {
+			handler = h2c.NewHandler(b.Echo, &http2.Server{})
+		}
+		s := &http.Server{
+			Handler:   routePrefixes(handler, l.Prefixes, b.exclusivePrefixes(l.Name)),
+			TLSConfig: config,
+		}
+		s.SetKeepAlivesEnabled(b.Config.HTTP.KeepAlive)
+
+		// The listeners stop accepting requests with the server.
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{Name: "http:" + l.Name, Stage: shutdown.StageIntake, Stop: s.Shutdown}); err != nil {
+			ln.Close()
+			return err
+		}
+
+		b.Logger().Info("Listening on " + l.Address + " (" + l.Name + ")")
+
+		go func(name string) {
+			var err error
+			if s.TLSConfig != nil {
+				err = s.ServeTLS(ln, "", "")
+			} else {
+				err = s.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				b.Logger().Error("listener ", name, ": ", err)
+			}
+		}(l.Name)
+	}
+
+	return nil
+}
+
+// listenerTLSConfig returns the TLS config of a listener, with the certificate of the main server if the
+// listener doesn't have one.
+func listenerTLSConfig(config ListenerTLSConfig, serverTLS func() (*tls.Config, error)) (*tls.Config, error) {
+	var c *tls.Config
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.PrivFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		c = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}
+	} else {
+		base, err := serverTLS()
+		if err != nil {
+			return nil, err
+		}
+		c = base.Clone()
+		// IMPORTANT: the client CAs of the server must not override the ones of the listener.
+		c.GetConfigForClient = nil
+		c.ClientAuth = tls.NoClientCert
+		c.ClientCAs = nil
+	}
+
+	if config.MinTLSVersion != 0 {
+		c.MinVersion = config.MinTLSVersion
+	}
+
+	if config.MTLS.On {
+		clientAuth, err := clientAuthType(config.MTLS.VerifyMode)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientAuth = clientAuth
+
+		if c.ClientCAs, err = loadCertPool(config.MTLS.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// exclusivePrefixes returns the prefixes of the exclusive listeners but `except`, empty for the main server.
+func (b *Bean) exclusivePrefixes(except string) []string {
+	var prefixes []string
+	for _, l := range b.Config.HTTP.Listeners {
+		if l.Exclusive && l.Name != except {
+			prefixes = append(prefixes, l.Prefixes...)
+		}
+	}
+	return prefixes
+}
+
+// routePrefixes serves the requests whose path has one of the `allowed` prefixes, all of them if it's
+// empty, and none of the `denied` prefixes. The other requests are not found.
+func routePrefixes(next http.Handler, allowed, denied []string) http.Handler {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (len(allowed) > 0 && !hasPathPrefix(r.URL.Path, allowed)) || hasPathPrefix(r.URL.Path, denied) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasPathPrefix returns true if one of the prefixes is a whole segment prefix of the path, "/internal"
+// matches "/internal/jobs" but not "/internals".
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func newListenerBean() *Bean {
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, strconv.Itoa(c.Request().ProtoMajor))
+	})
+
+	return &Bean{Echo: e}
+}
+
+func TestH2C(t *testing.T) {
+	b := newListenerBean()
+	b.Config.HTTP.H2C = true
+
+	server := httptest.NewServer(b.handler())
+	defer server.Close()
+
+	// HTTP/2 with prior knowledge, like the gRPC clients.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "2", string(body))
+
+	// HTTP/1.1 is still served.
+	resp, err = http.Get(server.URL)
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "1", string(body))
+
+	// TLS negotiates HTTP/2 itself.
+	b.Config.HTTP.SSL.On = true
+	assert.Equal(t, http.Handler(b.Echo), b.handler())
+}
+
+type fakeHTTP3Server struct {
+	addr    string
+	handler http.Handler
+	serving chan struct{}
+}
+
+func (s *fakeHTTP3Server) ListenAndServe() error {
+	close(s.serving)
+	return nil
+}
+
+func (s *fakeHTTP3Server) Close() error { return nil }
+
+func TestHTTP3(t *testing.T) {
+	b := newListenerBean()
+	b.Config.HTTP.HTTP3.Port = "8443"
+
+	_, err := b.serveHTTP3("127.0.0.1", "443", &tls.Config{})
+	assert.ErrorContains(t, err, "NewHTTP3Server")
+
+	server := &fakeHTTP3Server{serving: make(chan struct{})}
+	b.NewHTTP3Server = func(addr string, handler http.Handler, config *tls.Config) HTTP3Server {
+		server.addr, server.handler = addr, handler
+		return server
+	}
+	defer b.Shutdown(context.Background())
+
+	port, err := b.serveHTTP3("127.0.0.1", "443", &tls.Config{})
+	require.NoError(t, err)
+	<-server.serving
+	assert.Equal(t, "8443", port)
+	assert.Equal(t, "127.0.0.1:8443", server.addr)
+	assert.Same(t, b.Echo, server.handler)
+
+	rec := httptest.NewRecorder()
+	altSvc(b.Echo, port).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, `h3=":8443"; ma=86400`, rec.Header().Get("Alt-Svc"))
+
+	plan, err := b.ShutdownOrchestrator().Plan()
+	require.NoError(t, err)
+	assert.Contains(t, plan[0], "http3")
+}
+
+func socketDir(t *testing.T) string {
+	// The path of a unix socket is limited to about 100 bytes, shorter than the test directories.
+	dir, err := os.MkdirTemp("", "bean")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(socketDir(t), "app.sock")
+
+	// The socket of a crashed process.
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:"+path, "0600")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = listen("unix:"+path, "")
+	assert.ErrorContains(t, err, "already in use")
+
+	_, err = listen("unix:"+filepath.Join(filepath.Dir(path), "other.sock"), "rw")
+	assert.ErrorContains(t, err, "invalid mode")
+
+	tcp, err := listen("127.0.0.1:0", "")
+	require.NoError(t, err)
+	tcp.Close()
+}
+
+func TestServeListeners(t *testing.T) {
+	b := newListenerBean()
+	b.Echo.GET("/internal/jobs", func(c echo.Context) error {
+		return c.String(http.StatusOK, "jobs")
+	})
+	path := filepath.Join(socketDir(t), "internal.sock")
+	b.Config.HTTP.Listeners = []ListenerConfig{{Name: "internal", Address: "unix:" + path, Prefixes: []string{"/internal"}, Exclusive: true}}
+
+	require.NoError(t, b.serveListeners(func() (*tls.Config, error) { return nil, nil }))
+
+	get := func(client *http.Client, url string) int {
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	internal := unixClient(path)
+	assert.Equal(t, http.StatusOK, get(internal, "http://internal/internal/jobs"))
+	assert.Equal(t, http.StatusNotFound, get(internal, "http://internal/"))
+
+	// The internal routes are not served by the public server.
+	public := httptest.NewServer(routePrefixes(b.handler(), nil, b.exclusivePrefixes("")))
+	defer public.Close()
+	assert.Equal(t, http.StatusOK, get(http.DefaultClient, public.URL+"/"))
+	assert.Equal(t, http.StatusNotFound, get(http.DefaultClient, public.URL+"/internal/jobs"))
+
+	plan, err := b.ShutdownOrchestrator().Plan()
+	require.NoError(t, err)
+	assert.Contains(t, plan[0], "http:internal")
+
+	report := b.Shutdown(context.Background())
+	assert.True(t, report.Clean())
+	_, err = internal.Get("http://internal/internal/jobs")
+	assert.Error(t, err)
+
+	b.Config.HTTP.Listeners = []ListenerConfig{{Name: "nameless"}}
+	assert.Error(t, b.serveListeners(nil))
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+	b, dir := newTLSBean(t)
+	b.Config.HTTP.SSL.MTLS.On = true
+	b.Config.HTTP.SSL.MTLS.ClientCAFile = filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, b.Config.HTTP.SSL.MTLS.ClientCAFile, "")
+	newTestCert(t, "localhost", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+
+	server, err := b.TLSConfig()
+	require.NoError(t, err)
+
+	// The certificate of the server without its mutual TLS.
+	config, err := listenerTLSConfig(ListenerTLSConfig{On: true, MinTLSVersion: tls.VersionTLS13}, func() (*tls.Config, error) { return server, nil })
+	require.NoError(t, err)
+	assert.Equal(t, server.Certificates, config.Certificates)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, server.ClientAuth)
+
+	listener := ListenerTLSConfig{On: true, CertFile: filepath.Join(dir, "internal.pem"), PrivFile: filepath.Join(dir, "internal-key.pem")}
+	newTestCert(t, "internal", ca).write(t, listener.CertFile, listener.PrivFile)
+	listener.MTLS.On = true
+	listener.MTLS.ClientCAFile = b.Config.HTTP.SSL.MTLS.ClientCAFile
+	listener.MTLS.VerifyMode = "verify-if-given"
+
+	config, err = listenerTLSConfig(listener, nil)
+	require.NoError(t, err)
+	require.Len(t, config.Certificates, 1)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	assert.True(t, hasPathPrefix("/internal", []string{"/internal/"}))
+	assert.True(t, hasPathPrefix("/internal/jobs", []string{"/admin", "/internal"}))
+	assert.False(t, hasPathPrefix("/internals", []string{"/internal"}))
+	assert.False(t, hasPathPrefix("/", nil))
+}
@@ -0,0 +1,406 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package listquery parses and validates the filtering and sorting query parameters of the list endpoints
+// against a whitelist, and compiles them into gorm or mongo conditions without building any query string
+// from the user input:
+//
+//	GET /products?price[gte]=100&status[in]=active,draft&name[like]=bean&sort=-price,name
+package listquery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Operator is a comparison of a filter, written in brackets after the parameter name. A parameter without
+// an operator is an `Eq`.
+type Operator string
+
+const (
+	Eq   Operator = "eq"
+	Ne   Operator = "ne"
+	Gt   Operator = "gt"
+	Gte  Operator = "gte"
+	Lt   Operator = "lt"
+	Lte  Operator = "lte"
+	In   Operator = "in"  // Comma separated values.
+	Nin  Operator = "nin" // Comma separated values.
+	Like Operator = "like"
+	Null Operator = "null" // `true` or `false`.
+)
+
+// Type is the type of the values of a field, the values which can't be parsed are rejected.
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time // RFC 3339
+)
+
+// Field is a filterable field of an endpoint.
+type Field struct {
+	// Column is the SQL column or the mongo field. Default value the parameter name.
+	Column string
+
+	// Type of the values. Default value `String`.
+	Type Type
+
+	// Operators are the allowed operators. Default value `Eq` only.
+	Operators []Operator
+}
+
+// Schema is the whitelist of an endpoint.
+type Schema struct {
+	// Fields are the filterable fields by parameter name.
+	Fields map[string]Field
+
+	// Sortable are the parameter names of `Fields` which can be used in the `sort` parameter.
+	Sortable []string
+
+	// MaxValues is the maximum number of values of `In` and `Nin`. Default value 100.
+	MaxValues int
+}
+
+// Filter is a parsed condition.
+type Filter struct {
+	Param    string
+	Column   string
+	Operator Operator
+	Values   []interface{}
+}
+
+// Sort is a parsed sort order.
+type Sort struct {
+	Param  string
+	Column string
+	Desc   bool
+}
+
+// ListQuery is the parsed filters and sort orders of a request.
+type ListQuery struct {
+	Filters []Filter
+	Sorts   []Sort
+}
+
+// SortParam is the name of the sort parameter, like `sort=-price,name`.
+const SortParam = "sort"
+
+// Error is returned for a filter or a sort order which is not allowed or not valid.
+type Error struct {
+	Param  string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "listquery: " + e.Param + ": " + e.Reason
+}
+
+var paramPattern = regexp.MustCompile(`^([A-Za-z0-9_.]+)(?:\[([a-z]+)\])?$`)
+
+// Parse validates the query parameters against the schema. The parameters which are not in the schema
+// and don't use the bracket syntax are ignored, so that the other parameters (like `limit`) can coexist.
+func Parse(values url.Values, schema Schema) (*ListQuery, error) {
+	if schema.MaxValues <= 0 {
+		schema.MaxValues = 100
+	}
+
+	q := &ListQuery{}
+
+	// IMPORTANT: Sort the parameters to always build the same query.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raws := values[key]
+		if key == SortParam {
+			continue
+		}
+
+		m := paramPattern.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+
+		name, op := m[1], Operator(m[2])
+		field, ok := schema.Fields[name]
+		if !ok {
+			if op != "" {
+				return nil, &Error{Param: key, Reason: "is not filterable"}
+			}
+			continue
+		}
+
+		if op == "" {
+			op = Eq
+		}
+		if !field.allows(op) {
+			return nil, &Error{Param: key, Reason: fmt.Sprintf("operator %q is not allowed", op)}
+		}
+
+		column := field.Column
+		if column == "" {
+			column = name
+		}
+
+		for _, raw := range raws {
+			filter := Filter{Param: name, Column: column, Operator: op}
+
+			switch op {
+			case In, Nin:
+				parts := strings.Split(raw, ",")
+				if len(parts) > schema.MaxValues {
+					return nil, &Error{Param: key, Reason: fmt.Sprintf("has more than %d values", schema.MaxValues)}
+				}
+				for _, part := range parts {
+					v, err := parseValue(field.Type, part)
+					if err != nil {
+						return nil, &Error{Param: key, Reason: err.Error()}
+					}
+					filter.Values = append(filter.Values, v)
+				}
+
+			case Null:
+				v, err := strconv.ParseBool(raw)
+				if err != nil {
+					return nil, &Error{Param: key, Reason: "must be true or false"}
+				}
+				filter.Values = []interface{}{v}
+
+			case Like:
+				if field.Type != String {
+					return nil, &Error{Param: key, Reason: "like is only allowed for strings"}
+				}
+				filter.Values = []interface{}{raw}
+
+			default:
+				v, err := parseValue(field.Type, raw)
+				if err != nil {
+					return nil, &Error{Param: key, Reason: err.Error()}
+				}
+				filter.Values = []interface{}{v}
+			}
+
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+
+	if orders := values.Get(SortParam); orders != "" {
+		for _, part := range strings.Split(orders, ",") {
+			s := Sort{Param: strings.TrimSpace(part)}
+			if strings.HasPrefix(s.Param, "-") {
+				s.Param, s.Desc = s.Param[1:], true
+			}
+
+			if !contains(schema.Sortable, s.Param) {
+				return nil, &Error{Param: SortParam, Reason: fmt.Sprintf("%q is not sortable", s.Param)}
+			}
+
+			s.Column = s.Param
+			if field, ok := schema.Fields[s.Param]; ok && field.Column != "" {
+				s.Column = field.Column
+			}
+
+			q.Sorts = append(q.Sorts, s)
+		}
+	}
+
+	return q, nil
+}
+
+// ParseRequest is same as `Parse` with the query parameters of the request. It returns a `400 Bad Request`
+// `APIError` if the parameters are not valid.
+func ParseRequest(c echo.Context, schema Schema) (*ListQuery, error) {
+	q, err := Parse(c.QueryParams(), schema)
+	if err != nil {
+		return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, err)
+	}
+
+	return q, nil
+}
+
+// Gorm adds the conditions and the sort orders to the query. The columns are quoted by gorm and all the
+// values are bound as parameters.
+func (q *ListQuery) Gorm(db *gorm.DB) *gorm.DB {
+	for _, f := range q.Filters {
+		column := clause.Column{Name: f.Column}
+
+		var expr clause.Expression
+		switch f.Operator {
+		case Eq:
+			expr = clause.Eq{Column: column, Value: f.Values[0]}
+		case Ne:
+			expr = clause.Neq{Column: column, Value: f.Values[0]}
+		case Gt:
+			expr = clause.Gt{Column: column, Value: f.Values[0]}
+		case Gte:
+			expr = clause.Gte{Column: column, Value: f.Values[0]}
+		case Lt:
+			expr = clause.Lt{Column: column, Value: f.Values[0]}
+		case Lte:
+			expr = clause.Lte{Column: column, Value: f.Values[0]}
+		case In:
+			expr = clause.IN{Column: column, Values: f.Values}
+		case Nin:
+			expr = clause.Not(clause.IN{Column: column, Values: f.Values})
+		case Like:
+			expr = clause.Like{Column: column, Value: "%" + escapeLike(f.Values[0].(string)) + "%"}
+		case Null:
+			if f.Values[0].(bool) {
+				expr = clause.Eq{Column: column, Value: nil}
+			} else {
+				expr = clause.Neq{Column: column, Value: nil}
+			}
+		}
+
+		db = db.Where(expr)
+	}
+
+	for _, s := range q.Sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+	}
+
+	return db
+}
+
+// Mongo returns the filter document of the conditions.
+func (q *ListQuery) Mongo() bson.M {
+	filter := bson.M{}
+
+	for _, f := range q.Filters {
+		cond, _ := filter[f.Column].(bson.M)
+		if cond == nil {
+			cond = bson.M{}
+			filter[f.Column] = cond
+		}
+
+		switch f.Operator {
+		case In, Nin:
+			cond["$"+string(f.Operator)] = f.Values
+		case Like:
+			cond["$regex"] = regexp.QuoteMeta(f.Values[0].(string))
+			cond["$options"] = "i"
+		case Null:
+			if f.Values[0].(bool) {
+				cond["$eq"] = nil
+			} else {
+				cond["$ne"] = nil
+			}
+		default:
+			cond["$"+string(f.Operator)] = f.Values[0]
+		}
+	}
+
+	return filter
+}
+
+// MongoSort returns the sort document of the sort orders.
+func (q *ListQuery) MongoSort() bson.D {
+	orders := bson.D{}
+	for _, s := range q.Sorts {
+		order := 1
+		if s.Desc {
+			order = -1
+		}
+		orders = append(orders, bson.E{Key: s.Column, Value: order})
+	}
+
+	return orders
+}
+
+func (f Field) allows(op Operator) bool {
+	if len(f.Operators) == 0 {
+		return op == Eq
+	}
+
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseValue(t Type, raw string) (interface{}, error) {
+	switch t {
+	case Int:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return v, nil
+	case Float:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return v, nil
+	case Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return v, nil
+	case Time:
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, errors.New("must be a RFC 3339 time")
+		}
+		return v, nil
+	default:
+		return raw, nil
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
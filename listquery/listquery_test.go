@@ -0,0 +1,94 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package listquery
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var productSchema = Schema{
+	Fields: map[string]Field{
+		"price":  {Type: Float, Operators: []Operator{Eq, Gte, Lte}},
+		"status": {Operators: []Operator{Eq, In}},
+		"name":   {Operators: []Operator{Like}},
+		"maker":  {Column: "maker_id", Type: Int},
+	},
+	Sortable: []string{"price", "name"},
+}
+
+func TestParse(t *testing.T) {
+	values, _ := url.ParseQuery("price[gte]=100&status[in]=active,draft&name[like]=50%25_off&maker=3&limit=10&sort=-price,name")
+
+	q, err := Parse(values, productSchema)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []Filter{
+		{Param: "maker", Column: "maker_id", Operator: Eq, Values: []interface{}{int64(3)}},
+		{Param: "name", Column: "name", Operator: Like, Values: []interface{}{"50%_off"}},
+		{Param: "price", Column: "price", Operator: Gte, Values: []interface{}{float64(100)}},
+		{Param: "status", Column: "status", Operator: In, Values: []interface{}{"active", "draft"}},
+	}, q.Filters)
+	assert.Equal(t, []Sort{{Param: "price", Column: "price", Desc: true}, {Param: "name", Column: "name"}}, q.Sorts)
+
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	stmt := q.Gorm(db.Table("products")).Find(&[]map[string]interface{}{}).Statement
+	assert.Equal(t, "SELECT * FROM `products` WHERE `maker_id` = ? AND `name` LIKE ? AND `price` >= ? AND `status` IN (?,?) ORDER BY `price` DESC,`name`", stmt.SQL.String())
+	assert.Equal(t, []interface{}{int64(3), `%50\%\_off%`, float64(100), "active", "draft"}, stmt.Vars)
+
+	assert.Equal(t, bson.M{
+		"maker_id": bson.M{"$eq": int64(3)},
+		"name":     bson.M{"$regex": "50%_off", "$options": "i"},
+		"price":    bson.M{"$gte": float64(100)},
+		"status":   bson.M{"$in": []interface{}{"active", "draft"}},
+	}, q.Mongo())
+	assert.Equal(t, bson.D{{Key: "price", Value: -1}, {Key: "name", Value: 1}}, q.MongoSort())
+}
+
+func TestParse_Rejected(t *testing.T) {
+	for _, query := range []string{
+		"price[gt]=100",
+		"price=abc",
+		"secret[eq]=1",
+		"maker[in]=1,2",
+		"sort=password",
+		"name[like]=a&price[like]=1",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err := Parse(values, productSchema)
+
+		var e *Error
+		assert.True(t, errors.As(err, &e), query)
+	}
+}
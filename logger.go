@@ -0,0 +1,114 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// LoggerWithContext returns the bean logger which prefixes every line with the request ID of `c`
+// (`[req:<id>] `, or the `request_id` key for the JSON variants), so that the debug log can be correlated
+// with the access log. Pass `c.Request().Context()` from a handler. The logger is the one of the bean
+// instance serving the request, or `BeanLogger` if `c` doesn't carry one.
+func LoggerWithContext(c context.Context) echo.Logger {
+	if b := FromContext(c); b != nil {
+		return b.LoggerWithContext(c)
+	}
+
+	return withRequestID(c, BeanLogger)
+}
+
+// LoggerWithContext returns the logger of the bean instance which prefixes every line with the request
+// ID of `c`. (see the `LoggerWithContext` function)
+func (b *Bean) LoggerWithContext(c context.Context) echo.Logger {
+	return withRequestID(c, b.Logger())
+}
+
+func withRequestID(c context.Context, logger echo.Logger) echo.Logger {
+	id := helpers.RequestIDFromContext(c)
+	if id == "" || logger == nil {
+		return logger
+	}
+
+	prefix := "[req:" + id + "] "
+
+	return &contextLogger{Logger: logger, id: id, prefix: prefix, format: strings.ReplaceAll(prefix, "%", "%%")}
+}
+
+type contextLogger struct {
+	echo.Logger
+	id     string
+	prefix string
+	format string // The prefix escaped for the `f` variants.
+}
+
+func (l *contextLogger) args(i []interface{}) []interface{} {
+	return append([]interface{}{l.prefix}, i...)
+}
+
+func (l *contextLogger) json(j log.JSON) log.JSON {
+	out := make(log.JSON, len(j)+1)
+	for k, v := range j {
+		out[k] = v
+	}
+	out["request_id"] = l.id
+
+	return out
+}
+
+func (l *contextLogger) Print(i ...interface{}) { l.Logger.Print(l.args(i)...) }
+func (l *contextLogger) Printf(format string, i ...interface{}) {
+	l.Logger.Printf(l.format+format, i...)
+}
+func (l *contextLogger) Printj(j log.JSON)      { l.Logger.Printj(l.json(j)) }
+func (l *contextLogger) Debug(i ...interface{}) { l.Logger.Debug(l.args(i)...) }
+func (l *contextLogger) Debugf(format string, i ...interface{}) {
+	l.Logger.Debugf(l.format+format, i...)
+}
+func (l *contextLogger) Debugj(j log.JSON)                     { l.Logger.Debugj(l.json(j)) }
+func (l *contextLogger) Info(i ...interface{})                 { l.Logger.Info(l.args(i)...) }
+func (l *contextLogger) Infof(format string, i ...interface{}) { l.Logger.Infof(l.format+format, i...) }
+func (l *contextLogger) Infoj(j log.JSON)                      { l.Logger.Infoj(l.json(j)) }
+func (l *contextLogger) Warn(i ...interface{})                 { l.Logger.Warn(l.args(i)...) }
+func (l *contextLogger) Warnf(format string, i ...interface{}) { l.Logger.Warnf(l.format+format, i...) }
+func (l *contextLogger) Warnj(j log.JSON)                      { l.Logger.Warnj(l.json(j)) }
+func (l *contextLogger) Error(i ...interface{})                { l.Logger.Error(l.args(i)...) }
+func (l *contextLogger) Errorf(format string, i ...interface{}) {
+	l.Logger.Errorf(l.format+format, i...)
+}
+func (l *contextLogger) Errorj(j log.JSON)      { l.Logger.Errorj(l.json(j)) }
+func (l *contextLogger) Fatal(i ...interface{}) { l.Logger.Fatal(l.args(i)...) }
+func (l *contextLogger) Fatalf(format string, i ...interface{}) {
+	l.Logger.Fatalf(l.format+format, i...)
+}
+func (l *contextLogger) Fatalj(j log.JSON)      { l.Logger.Fatalj(l.json(j)) }
+func (l *contextLogger) Panic(i ...interface{}) { l.Logger.Panic(l.args(i)...) }
+func (l *contextLogger) Panicf(format string, i ...interface{}) {
+	l.Logger.Panicf(l.format+format, i...)
+}
+func (l *contextLogger) Panicj(j log.JSON) { l.Logger.Panicj(l.json(j)) }
@@ -0,0 +1,43 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerWithContext(t *testing.T) {
+	defer func(l echo.Logger) { BeanLogger = l }(BeanLogger)
+
+	BeanLogger = nil
+
+	assert.Nil(t, LoggerWithContext(context.Background()), "no logger")
+
+	var buf bytes.Buffer
+	l := log.New("test")
+	l.SetOutput(&buf)
+	l.SetHeader("${level}")
+	l.SetLevel(log.DEBUG)
+	BeanLogger = l
+
+	assert.Equal(t, BeanLogger, LoggerWithContext(context.Background()), "no request ID")
+
+	c := helpers.WithRequestID(context.Background(), "abc%d")
+	LoggerWithContext(c).Debugf("user %d", 1)
+	assert.Equal(t, "DEBUG [req:abc%d] user 1\n", buf.String())
+
+	buf.Reset()
+	LoggerWithContext(c).Info("done")
+	assert.Equal(t, "INFO [req:abc%d] done\n", buf.String())
+
+	buf.Reset()
+	LoggerWithContext(c).Warnj(log.JSON{"a": 1})
+	assert.Equal(t, "WARN {\"a\":1,\"request_id\":\"abc%d\"}\n", buf.String())
+}
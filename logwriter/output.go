@@ -0,0 +1,147 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logwriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Supported values of `Config.Outputs`.
+const (
+	OutputFile   = "file"
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputSyslog = "syslog"
+)
+
+// Config defines the destinations of a log.
+type Config struct {
+	// Path of the log file, used by the `file` output.
+	// Optional. Default value "".
+	Path string
+
+	// Outputs is the list of destinations the log is written to. (`file`, `stdout`, `stderr`, `syslog`)
+	// Optional. Default value `["file"]` if `Path` is set, otherwise none. (the caller keeps its default)
+	Outputs []string
+
+	// Rotation of the log file.
+	// Optional. Default value no rotation.
+	Rotation RotationConfig
+
+	// SyslogTag is the tag of the messages sent to the local syslog daemon.
+	// Optional. Default value the program name.
+	SyslogTag string
+}
+
+// New returns a writer which writes to every output of the config. It returns a nil writer and a nil
+// error if there is no output configured, so that the caller can keep its default output.
+// The returned writer must be closed to flush and release the files and the syslog connection.
+func New(config Config) (io.WriteCloser, error) {
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		if config.Path == "" {
+			return nil, nil
+		}
+		outputs = []string{OutputFile}
+	}
+
+	var writers []io.Writer
+	var closers []io.Closer
+
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	for _, output := range outputs {
+		switch strings.ToLower(strings.TrimSpace(output)) {
+		case OutputFile:
+			if config.Path == "" {
+				closeAll()
+				return nil, errors.New("logwriter: the file output requires a path")
+			}
+			file, err := NewRotatingFile(config.Path, config.Rotation)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			writers = append(writers, file)
+			closers = append(closers, file)
+
+		case OutputStdout:
+			writers = append(writers, os.Stdout)
+
+		case OutputStderr:
+			writers = append(writers, os.Stderr)
+
+		case OutputSyslog:
+			w, err := newSyslog(config.SyslogTag)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			writers = append(writers, w)
+			closers = append(closers, w)
+
+		default:
+			closeAll()
+			return nil, fmt.Errorf("logwriter: unknown output %q", output)
+		}
+	}
+
+	return &multiWriter{writers: writers, closers: closers}, nil
+}
+
+// multiWriter writes to all the writers even if some of them fail, unlike `io.MultiWriter`, so that
+// a full disk doesn't stop the logs going to stdout or syslog.
+type multiWriter struct {
+	writers []io.Writer
+	closers []io.Closer
+}
+
+func (m *multiWriter) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, w := range m.writers {
+		if _, err := w.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return len(p), firstErr
+}
+
+func (m *multiWriter) Close() error {
+	var firstErr error
+	for _, c := range m.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
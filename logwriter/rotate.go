@@ -0,0 +1,394 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package logwriter provides the writers behind the access and debug logs: a size and time based
+// rotating file with compression and retention, and a fan-out over several outputs. (file, stdout,
+// stderr, syslog)
+package logwriter
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into the name of a rotated file.
+// Example: `access-2022-05-01T15-04-05.000.log`
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+const megabyte = 1024 * 1024
+
+// RotationConfig defines when a log file is rotated and how long the rotated files are kept.
+type RotationConfig struct {
+	// MaxSize is the maximum size in megabytes of the log file before it gets rotated.
+	// Optional. Default value 0. (no size based rotation)
+	MaxSize int
+
+	// Interval rotates the log file periodically, aligned to the interval. (example: `24h` rotates at midnight UTC)
+	// Optional. Default value 0. (no time based rotation)
+	Interval time.Duration
+
+	// MaxAge is the maximum time to retain the rotated files, based on the timestamp in their name.
+	// Optional. Default value 0. (don't remove old files based on age)
+	MaxAge time.Duration
+
+	// MaxBackups is the maximum number of rotated files to retain.
+	// Optional. Default value 0. (retain all of them)
+	MaxBackups int
+
+	// Compress the rotated files using gzip.
+	// Optional. Default value false.
+	Compress bool
+}
+
+// RotatingFile is an `io.WriteCloser` which writes to `path` and rotates the file according to its config.
+// The rotated files are renamed with a timestamp, like `access-2022-05-01T15-04-05.000.log`, next to the
+// current file. Compression and cleanup of the rotated files are done in the background.
+type RotatingFile struct {
+	path   string
+	config RotationConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	rotateAt time.Time
+
+	millCh   chan struct{}
+	millOnce sync.Once
+	millWg   sync.WaitGroup
+
+	// now is replaceable for testing.
+	now func() time.Time
+}
+
+// NewRotatingFile opens (or creates) the log file at `path`, including its directory.
+func NewRotatingFile(path string, config RotationConfig) (*RotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("logwriter: path is empty")
+	}
+
+	r := &RotatingFile{
+		path:   path,
+		config: config,
+		now:    time.Now,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Write implements `io.Writer`. It rotates the file before writing `p` if the write would exceed
+// the maximum size or the rotation interval has elapsed.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// Rotate closes the current file, renames it with a timestamp and opens a new one, regardless of
+// the config. (example: on `SIGHUP`)
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rotate()
+}
+
+// Close closes the current file and waits for the background compression and cleanup to finish.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	if r.millCh != nil {
+		close(r.millCh)
+		r.millCh = nil
+	}
+	r.mu.Unlock()
+
+	r.millWg.Wait()
+
+	return err
+}
+
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.config.MaxSize > 0 && r.size > 0 && r.size+n > int64(r.config.MaxSize)*megabyte {
+		return true
+	}
+
+	return r.config.Interval > 0 && !r.now().Before(r.rotateAt)
+}
+
+// open opens the log file in append mode, creating the directory if needed.
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0764); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.nextRotation()
+
+	return nil
+}
+
+func (r *RotatingFile) nextRotation() {
+	if r.config.Interval > 0 {
+		r.rotateAt = r.now().Truncate(r.config.Interval).Add(r.config.Interval)
+	}
+}
+
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+
+	if _, err := os.Stat(r.path); err == nil {
+		if err := os.Rename(r.path, r.backupName(r.now())); err != nil {
+			return err
+		}
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.mill()
+
+	return nil
+}
+
+func (r *RotatingFile) backupName(t time.Time) string {
+	dir := filepath.Dir(r.path)
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(filepath.Base(r.path), ext)
+
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, t.Format(backupTimeFormat), ext))
+}
+
+// mill signals the background goroutine to compress and remove the rotated files. It must be called
+// with the lock held.
+func (r *RotatingFile) mill() {
+	if !r.config.Compress && r.config.MaxAge <= 0 && r.config.MaxBackups <= 0 {
+		return
+	}
+
+	r.millOnce.Do(func() {
+		r.millCh = make(chan struct{}, 1)
+		r.millWg.Add(1)
+		go r.millRun(r.millCh)
+	})
+
+	if r.millCh == nil {
+		return
+	}
+
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *RotatingFile) millRun(ch <-chan struct{}) {
+	defer r.millWg.Done()
+
+	for range ch {
+		// Errors are reported to stderr as there is nowhere else to write them.
+		if err := r.millFiles(); err != nil {
+			fmt.Fprintf(os.Stderr, "logwriter: %v\n", err)
+		}
+	}
+}
+
+type backup struct {
+	path      string
+	timestamp time.Time
+}
+
+// millFiles compresses the rotated files and removes the ones exceeding `MaxBackups` or `MaxAge`.
+func (r *RotatingFile) millFiles() error {
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []backup
+	if r.config.MaxBackups > 0 && len(backups) > r.config.MaxBackups {
+		remove = append(remove, backups[r.config.MaxBackups:]...)
+		backups = backups[:r.config.MaxBackups]
+	}
+
+	if r.config.MaxAge > 0 {
+		cutoff := r.now().Add(-r.config.MaxAge)
+		kept := backups[:0]
+		for _, b := range backups {
+			if b.timestamp.Before(cutoff) {
+				remove = append(remove, b)
+			} else {
+				kept = append(kept, b)
+			}
+		}
+		backups = kept
+	}
+
+	var errs []string
+	for _, b := range remove {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if r.config.Compress {
+		for _, b := range backups {
+			if strings.HasSuffix(b.path, ".gz") {
+				continue
+			}
+			if err := compressFile(b.path); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// backups returns the rotated files of the log, newest first.
+func (r *RotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(r.path)
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(filepath.Base(r.path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp = strings.TrimSuffix(stamp, ext)
+
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{path: filepath.Join(dir, name), timestamp: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].timestamp.After(backups[j].timestamp)
+	})
+
+	return backups, nil
+}
+
+// compressFile gzips `path` into `path.gz` and removes the original file.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+
+	return os.Remove(path)
+}
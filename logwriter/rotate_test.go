@@ -0,0 +1,189 @@
+package logwriter
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "access.log")
+
+	r, err := NewRotatingFile(path, RotationConfig{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.Local)
+	r.now = func() time.Time { return now }
+
+	line := []byte(strings.Repeat("a", megabyte-10) + "\n")
+	if _, err := r.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("second write\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(backups))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "second write\n" {
+		t.Fatalf("unexpected content of the current file: %q", content)
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "debug.log")
+
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	r := &RotatingFile{path: path, config: RotationConfig{Interval: time.Hour}, now: func() time.Time { return now }}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("first\n"))
+	now = now.Add(30 * time.Minute)
+	r.Write([]byte("second\n"))
+	now = now.Add(30 * time.Minute)
+	r.Write([]byte("third\n"))
+
+	backups, _ := r.backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(backups))
+	}
+
+	content, _ := os.ReadFile(backups[0].path)
+	if string(content) != "first\nsecond\n" {
+		t.Fatalf("unexpected content of the backup: %q", content)
+	}
+}
+
+func TestRotatingFileRetentionAndCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	// The clock is read by the background cleanup as well.
+	var mu sync.Mutex
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.Local)
+	r := &RotatingFile{
+		path:   path,
+		config: RotationConfig{MaxBackups: 2, MaxAge: 48 * time.Hour, Compress: true},
+		now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too old, removed by `MaxAge`.
+	old := r.backupName(r.now().Add(-72 * time.Hour))
+	if err := os.WriteFile(old, []byte("old\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		mu.Lock()
+		now = now.Add(time.Minute)
+		mu.Unlock()
+		r.Write([]byte("line\n"))
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wait for the background compression and cleanup.
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last rotation may still be queued when closing, so mill once more synchronously.
+	if err := r.millFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+
+	for _, b := range backups {
+		if !strings.HasSuffix(b.path, ".log.gz") {
+			t.Fatalf("expected a compressed backup, got %s", b.path)
+		}
+
+		f, err := os.Open(b.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(gz)
+		f.Close()
+		if string(content) != "line\n" {
+			t.Fatalf("unexpected content of %s: %q", b.path, content)
+		}
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed", old)
+	}
+}
+
+func TestNew(t *testing.T) {
+	w, err := New(Config{})
+	if err != nil || w != nil {
+		t.Fatalf("expected no writer without outputs, got %v %v", w, err)
+	}
+
+	if _, err := New(Config{Outputs: []string{"file"}}); err == nil {
+		t.Fatal("expected an error for the file output without a path")
+	}
+
+	if _, err := New(Config{Outputs: []string{"kafka"}}); err == nil {
+		t.Fatal("expected an error for an unknown output")
+	}
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	w, err = New(Config{Path: path, Outputs: []string{"file", "stderr"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "hello\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
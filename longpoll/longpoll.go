@@ -0,0 +1,292 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package longpoll holds a request until its data arrives, from a channel or redis pub/sub, or until the max
+// hold time, instead of sleeping and checking again. A poll answers the data as soon as it arrives, or `204
+// No Content` on timeout so that the client polls again. The held polls are released with a `204` when the
+// server shuts down so that they don't delay it.
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/response"
+	"github.com/retail-ai-inc/bean/shutdown"
+)
+
+var (
+	// ErrTimeout is returned by `Wait` when no data arrived before the max hold time.
+	ErrTimeout = errors.New("longpoll: timeout")
+	// ErrShutdown is returned by `Wait` when the server shuts down.
+	ErrShutdown = errors.New("longpoll: shutdown")
+)
+
+// Source waits for the data of a poll. It returns the data as soon as it arrives, or the error of `ctx`
+// when it's done.
+type Source func(ctx context.Context) (interface{}, error)
+
+// Config defines the config for `PollWithConfig`.
+type Config struct {
+	// MaxHold is how long a poll is held before answering `204 No Content`.
+	// Optional. Default value 30s.
+	MaxHold time.Duration
+
+	// Respond writes the response of the data.
+	// Optional. Default value `response.OK`.
+	Respond func(c echo.Context, data interface{}) error
+}
+
+// DefaultConfig is the default config of `Poll`.
+var DefaultConfig = Config{
+	MaxHold: 30 * time.Second,
+	Respond: response.OK,
+}
+
+// Poll holds the request until `source` returns its data with the default config.
+func Poll(c echo.Context, source Source) error {
+	return PollWithConfig(c, DefaultConfig, source)
+}
+
+// PollWithConfig holds the request until `source` returns its data and responds with it, or answers `204
+// No Content` after `config.MaxHold` or when the server shuts down. Nothing is written if the client has
+// gone away.
+func PollWithConfig(c echo.Context, config Config, source Source) error {
+	if config.Respond == nil {
+		config.Respond = DefaultConfig.Respond
+	}
+
+	route := c.Path()
+	connections.WithLabelValues(route).Inc()
+	defer connections.WithLabelValues(route).Dec()
+
+	data, err := Wait(c.Request().Context(), config.MaxHold, source)
+	switch {
+	case err == nil:
+		responses.WithLabelValues(route, "data").Inc()
+		return config.Respond(c, data)
+	case errors.Is(err, ErrTimeout):
+		responses.WithLabelValues(route, "timeout").Inc()
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, ErrShutdown):
+		responses.WithLabelValues(route, "shutdown").Inc()
+		c.Response().Header().Set(echo.HeaderConnection, "close")
+		return c.NoContent(http.StatusNoContent)
+	case c.Request().Context().Err() != nil:
+		responses.WithLabelValues(route, "canceled").Inc()
+		return nil
+	default:
+		responses.WithLabelValues(route, "error").Inc()
+		return err
+	}
+}
+
+// Wait calls `source` with a context which is done after `maxHold`, or when `ctx` is done or the server
+// shuts down. It returns `ErrTimeout`, `ErrShutdown` or the error of `ctx` if `source` returned because
+// its context was done. `maxHold` is `DefaultConfig.MaxHold` if it's not positive.
+func Wait(ctx context.Context, maxHold time.Duration, source Source) (interface{}, error) {
+	if maxHold <= 0 {
+		maxHold = DefaultConfig.MaxHold
+	}
+
+	stop, ok := hold()
+	if !ok {
+		return nil, ErrShutdown
+	}
+	defer held.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timer := time.NewTimer(maxHold)
+	defer timer.Stop()
+
+	var (
+		timedOut, stopped bool
+		mu                sync.Mutex
+		done              = make(chan struct{})
+	)
+	defer close(done)
+
+	go func() {
+		select {
+		case <-timer.C:
+			mu.Lock()
+			timedOut = true
+			mu.Unlock()
+		case <-stop:
+			mu.Lock()
+			stopped = true
+			mu.Unlock()
+		case <-done:
+			return
+		}
+		cancel()
+	}()
+
+	data, err := source(ctx)
+	if err == nil {
+		return data, nil
+	}
+
+	if ctx.Err() == nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch {
+	case stopped:
+		return nil, ErrShutdown
+	case timedOut:
+		return nil, ErrTimeout
+	}
+
+	return nil, err
+}
+
+// Channel returns a source which waits for the next value of `ch`. A closed channel is treated as a
+// timeout so that the client polls again.
+func Channel[T any](ch <-chan T) Source {
+	return func(ctx context.Context) (interface{}, error) {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return v, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Redis returns a source which subscribes to the redis pub/sub `channels` and waits for the next message,
+// the data is the payload of the message.
+func Redis(client redis.UniversalClient, channels ...string) Source {
+	return func(ctx context.Context) (interface{}, error) {
+		pubsub := client.Subscribe(ctx, channels...)
+		defer pubsub.Close()
+
+		// Wait for the subscription so that a message published from now on is received.
+		if _, err := pubsub.Receive(ctx); err != nil {
+			return nil, err
+		}
+
+		select {
+		case msg, ok := <-pubsub.Channel():
+			if !ok {
+				return nil, redis.ErrClosed
+			}
+			return msg.Payload, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+var (
+	stateMu  sync.Mutex
+	stopping = make(chan struct{})
+	stopped  bool
+	held     sync.WaitGroup
+
+	registerOnce sync.Once
+)
+
+// hold returns the channel closed when the server shuts down, or false if it's shutting down already. The
+// shutdown component "longpoll" and the metrics are registered by the first poll. A held poll must call
+// `held.Done` when it returns.
+func hold() (<-chan struct{}, bool) {
+	registerOnce.Do(func() {
+		// It releases the polls before the http server waits for them. The error is `shutdown.ErrStarted`
+		// if the shutdown has already started, the polls are then released by the http server.
+		_ = shutdown.Register(shutdown.Component{
+			Name:      "longpoll",
+			Stage:     shutdown.StageIntake,
+			DependsOn: []string{"http"},
+			Stop:      Shutdown,
+		})
+
+		// Reuse the collector registered with the same name, if any.
+		connections = helpers.RegisterCollector(prometheus.DefaultRegisterer, connections)
+		responses = helpers.RegisterCollector(prometheus.DefaultRegisterer, responses)
+	})
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if stopped {
+		return nil, false
+	}
+
+	held.Add(1)
+
+	return stopping, true
+}
+
+// Shutdown releases all the held polls with a `204 No Content` and makes the next polls return
+// immediately. It returns when the released polls have returned, or when `ctx` is done.
+func Shutdown(ctx context.Context) error {
+	stateMu.Lock()
+	if !stopped {
+		stopped = true
+		close(stopping)
+	}
+	stateMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		held.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	connections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bean",
+		Name:      "longpoll_connections",
+		Help:      "How many long polls are held, partitioned by route.",
+	}, []string{"route"})
+
+	responses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "longpoll_responses_total",
+		Help:      "How long polls ended, partitioned by route and result (data, timeout, shutdown, canceled, error).",
+	}, []string{"route", "result"})
+)
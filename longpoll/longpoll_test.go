@@ -0,0 +1,92 @@
+package longpoll
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newContext() (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/orders/1/status", nil), rec)
+	c.SetPath("/orders/:id/status")
+
+	return c, rec
+}
+
+func TestPoll(t *testing.T) {
+	ch := make(chan string, 1)
+	config := Config{MaxHold: time.Second}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ch <- "shipped"
+	}()
+
+	c, rec := newContext()
+	start := time.Now()
+	assert.NoError(t, PollWithConfig(c, config, Channel(ch)))
+	assert.Less(t, time.Since(start), config.MaxHold)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "shipped")
+
+	// Nothing arrives before the max hold time.
+	c, rec = newContext()
+	config.MaxHold = 20 * time.Millisecond
+	assert.NoError(t, PollWithConfig(c, config, Channel(ch)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// The error of the source is returned.
+	errSource := errors.New("source")
+	c, _ = newContext()
+	assert.Equal(t, errSource, PollWithConfig(c, config, func(ctx context.Context) (interface{}, error) {
+		return nil, errSource
+	}))
+}
+
+func TestWaitCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Wait(ctx, time.Second, Channel(make(chan int)))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestShutdown(t *testing.T) {
+	defer func() {
+		stopping = make(chan struct{})
+		stopped = false
+	}()
+
+	shutdowns := testutil.ToFloat64(responses.WithLabelValues("/orders/:id/status", "shutdown"))
+
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+
+		c, rec := newContext()
+		assert.NoError(t, PollWithConfig(c, Config{MaxHold: time.Minute}, Channel(make(chan int))))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "close", rec.Header().Get(echo.HeaderConnection))
+	}()
+
+	// Wait for the poll to be held.
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(connections.WithLabelValues("/orders/:id/status")) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, Shutdown(context.Background()))
+	<-polled
+
+	// The next polls return immediately.
+	_, err := Wait(context.Background(), time.Minute, Channel(make(chan int)))
+	assert.Equal(t, ErrShutdown, err)
+	assert.Equal(t, shutdowns+1, testutil.ToFloat64(responses.WithLabelValues("/orders/:id/status", "shutdown")))
+}
@@ -0,0 +1,283 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// SESConfig defines the config for `NewSESSender`.
+type SESConfig struct {
+	// Region of SES.
+	// Required.
+	Region string
+
+	// Credentials returns the credentials signing the requests.
+	// Optional. Default value the `AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY` and `AWS_SESSION_TOKEN`
+	// environment variables.
+	Credentials func(c context.Context) (helpers.AWSCredentials, error)
+
+	// Endpoint of the SES v2 API.
+	// Optional. Default value "https://email.<region>.amazonaws.com".
+	Endpoint string
+}
+
+// SESSender sends the messages as raw emails through the AWS SES v2 API.
+type SESSender struct {
+	client *http.Client
+	config SESConfig
+}
+
+// NewSESSender returns an SES sender, `client` is `http.DefaultClient` if nil.
+func NewSESSender(client *http.Client, config SESConfig) *SESSender {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if config.Credentials == nil {
+		config.Credentials = func(c context.Context) (helpers.AWSCredentials, error) {
+			creds := helpers.AWSCredentials{
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			}
+			if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+				return creds, errors.New("mail: AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is not set")
+			}
+			return creds, nil
+		}
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://email." + config.Region + ".amazonaws.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &SESSender{client: client, config: config}
+}
+
+// Send implements `Sender`.
+func (s *SESSender) Send(c context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// The raw content doesn't carry the `Bcc` recipients, they are set in the destination.
+	var req struct {
+		Destination struct {
+			ToAddresses  []string `json:"ToAddresses,omitempty"`
+			CcAddresses  []string `json:"CcAddresses,omitempty"`
+			BccAddresses []string `json:"BccAddresses,omitempty"`
+		} `json:"Destination"`
+		Content struct {
+			Raw struct {
+				Data string `json:"Data"`
+			} `json:"Raw"`
+		} `json:"Content"`
+	}
+	req.Destination.ToAddresses = msg.To
+	req.Destination.CcAddresses = msg.Cc
+	req.Destination.BccAddresses = msg.Bcc
+	req.Content.Raw.Data = base64.StdEncoding.EncodeToString(data)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, s.config.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	creds, err := s.config.Credentials(c)
+	if err != nil {
+		return err
+	}
+	helpers.SignAWSV4(httpReq, body, creds, s.config.Region, "ses", time.Now())
+
+	return do(s.client, httpReq, "ses")
+}
+
+// SendGridConfig defines the config for `NewSendGridSender`.
+type SendGridConfig struct {
+	// APIKey of SendGrid.
+	// Required.
+	APIKey string
+
+	// Endpoint of the SendGrid API.
+	// Optional. Default value "https://api.sendgrid.com".
+	Endpoint string
+}
+
+// SendGridSender sends the messages through the SendGrid v3 API.
+type SendGridSender struct {
+	client *http.Client
+	config SendGridConfig
+}
+
+// NewSendGridSender returns a SendGrid sender, `client` is `http.DefaultClient` if nil.
+func NewSendGridSender(client *http.Client, config SendGridConfig) *SendGridSender {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://api.sendgrid.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &SendGridSender{client: client, config: config}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Send implements `Sender`.
+func (s *SendGridSender) Send(c context.Context, msg *Message) error {
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		Type        string `json:"type,omitempty"`
+		Disposition string `json:"disposition"`
+	}
+	type personalization struct {
+		To  []sendGridAddress `json:"to,omitempty"`
+		Cc  []sendGridAddress `json:"cc,omitempty"`
+		Bcc []sendGridAddress `json:"bcc,omitempty"`
+	}
+
+	var req struct {
+		Personalizations []personalization `json:"personalizations"`
+		From             sendGridAddress   `json:"from"`
+		ReplyTo          *sendGridAddress  `json:"reply_to,omitempty"`
+		Subject          string            `json:"subject"`
+		Content          []content         `json:"content"`
+		Attachments      []attachment      `json:"attachments,omitempty"`
+		Headers          map[string]string `json:"headers,omitempty"`
+	}
+
+	var err error
+	var p personalization
+	if p.To, err = sendGridAddresses(msg.To); err != nil {
+		return err
+	}
+	if p.Cc, err = sendGridAddresses(msg.Cc); err != nil {
+		return err
+	}
+	if p.Bcc, err = sendGridAddresses(msg.Bcc); err != nil {
+		return err
+	}
+	req.Personalizations = []personalization{p}
+
+	from, err := sendGridAddresses([]string{msg.From})
+	if err != nil {
+		return err
+	}
+	req.From = from[0]
+
+	if msg.ReplyTo != "" {
+		replyTo, err := sendGridAddresses([]string{msg.ReplyTo})
+		if err != nil {
+			return err
+		}
+		req.ReplyTo = &replyTo[0]
+	}
+
+	req.Subject = msg.Subject
+	// The plain text must come first.
+	if msg.Text != "" {
+		req.Content = append(req.Content, content{"text/plain", msg.Text})
+	}
+	if msg.HTML != "" {
+		req.Content = append(req.Content, content{"text/html", msg.HTML})
+	}
+	for _, a := range msg.Attachments {
+		req.Attachments = append(req.Attachments, attachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			Filename:    a.Filename,
+			Type:        a.ContentType,
+			Disposition: "attachment",
+		})
+	}
+	req.Headers = msg.Headers
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, s.config.Endpoint+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+
+	return do(s.client, httpReq, "sendgrid")
+}
+
+func sendGridAddresses(addresses []string) ([]sendGridAddress, error) {
+	var list []sendGridAddress
+	for _, address := range addresses {
+		addr, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, &PermanentError{Err: errors.Wrapf(err, "mail: invalid address %q", address)}
+		}
+		list = append(list, sendGridAddress{Email: addr.Address, Name: addr.Name})
+	}
+
+	return list, nil
+}
+
+func do(client *http.Client, req *http.Request, provider string) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return statusError(provider, res, body)
+	}
+
+	return nil
+}
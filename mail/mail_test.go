@@ -0,0 +1,161 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/goview"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	bean.BeanLogger = e.Logger
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		From:        "Shop <no-reply@example.com>",
+		To:          []string{"a@example.com"},
+		Bcc:         []string{"hidden@example.com"},
+		Subject:     "ご注文",
+		Text:        "hello",
+		HTML:        "<p>hello</p>",
+		Attachments: []Attachment{{Filename: "receipt.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+	}
+
+	data, err := msg.Bytes()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.Equal(t, "ご注文", subject)
+	assert.Empty(t, parsed.Header.Get("Bcc"))
+	assert.Contains(t, parsed.Header.Get("Message-Id"), "@example.com>")
+
+	mediaType, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(parsed.Body, params["boundary"])
+
+	part, err := r.NextPart()
+	if assert.NoError(t, err) {
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		assert.Equal(t, "multipart/alternative", mediaType)
+	}
+
+	part, err = r.NextPart()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "receipt.pdf", part.FileName())
+	}
+
+	assert.Equal(t, []string{"a@example.com", "hidden@example.com"}, msg.Recipients())
+}
+
+type flakySender struct {
+	errs  []error
+	calls int
+}
+
+func (s *flakySender) Send(c context.Context, msg *Message) error {
+	s.calls++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestMailerRetry(t *testing.T) {
+	sender := &flakySender{errs: []error{errors.New("temporary"), errors.New("temporary")}}
+	m := New(sender, Config{From: "no-reply@example.com", MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	err := m.Send(context.Background(), &Message{To: []string{"a@example.com"}, Text: "hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sender.calls)
+
+	permanent := &PermanentError{Err: errors.New("rejected")}
+	sender = &flakySender{errs: []error{permanent}}
+	m = New(sender, Config{From: "no-reply@example.com", MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	err = m.Send(context.Background(), &Message{To: []string{"a@example.com"}, Text: "hello"})
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, sender.calls)
+
+	err = m.Send(context.Background(), &Message{To: []string{"not an address"}, Text: "hello"})
+	assert.Error(t, err)
+}
+
+func TestMailerTemplateAndRecorder(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "welcome.html"), []byte(`<p>Welcome {{.name}}</p>`), 0644))
+
+	recorder := NewRecorder()
+	m := New(recorder, Config{
+		From:  "no-reply@example.com",
+		Views: goview.New(goview.Config{Root: root, Extension: ".html"}),
+	})
+
+	err := m.SendAsync(context.Background(), &Message{
+		To:       []string{"a@example.com"},
+		Subject:  "Welcome",
+		Template: "welcome",
+		Data:     map[string]interface{}{"name": "Taro"},
+	}).Err()
+	assert.NoError(t, err)
+
+	if assert.Len(t, recorder.Messages(), 1) {
+		assert.Equal(t, "<p>Welcome Taro</p>", recorder.Last().HTML)
+	}
+
+	recorder.Reset()
+	assert.Nil(t, recorder.Last())
+}
+
+func TestSendGridSender(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		_ = json.NewDecoder(r.Body).Decode(&got)
+
+		if got["subject"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := NewSendGridSender(server.Client(), SendGridConfig{APIKey: "key", Endpoint: server.URL})
+
+	msg := &Message{From: "Shop <no-reply@example.com>", To: []string{"a@example.com"}, Subject: "hi", Text: "hello", HTML: "<p>hello</p>"}
+	assert.NoError(t, s.Send(context.Background(), msg))
+	assert.Equal(t, "Shop", got["from"].(map[string]interface{})["name"])
+	assert.Len(t, got["content"], 2)
+
+	msg.Subject = "bad"
+	var permanent *PermanentError
+	assert.ErrorAs(t, s.Send(context.Background(), msg), &permanent)
+}
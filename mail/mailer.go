@@ -0,0 +1,227 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mail sends the emails through SMTP, AWS SES or SendGrid, with the HTML bodies rendered from the
+// goview templates, a retry with backoff and an asynchronous sending in the goroutine pools:
+//
+//	mailer := mail.New(mail.NewSMTPSender(mail.SMTPConfig{Host: "smtp.example.com", Username: user, Password: pass}), mail.Config{
+//		From:  "Shop <no-reply@example.com>",
+//		Views: goview.New(goview.Config{Root: "views/mail", Extension: ".html"}),
+//		Pool:  "mail",
+//	})
+//
+//	mailer.SendAsync(c, &mail.Message{
+//		To:       []string{user.Email},
+//		Subject:  "Your order",
+//		Template: "order_confirmed",
+//		Data:     map[string]interface{}{"order": order},
+//	})
+//
+// Use a `Recorder` as the sender in the tests to assert the sent messages.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/goview"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// Sender delivers a message to the mail server or the API of a provider.
+type Sender interface {
+	Send(c context.Context, msg *Message) error
+}
+
+// PermanentError is an error of a sender which a retry can't fix. (example: a rejected recipient)
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Config defines the config for `New`.
+type Config struct {
+	// From is the sender of the messages without one.
+	// Optional. Default value "".
+	From string
+
+	// Views renders the `Template` of the messages.
+	// Optional. Default value nil, the messages can't have a template.
+	Views *goview.ViewEngine
+
+	// Retries is the number of retries of a failed sending, the permanent errors are not retried.
+	// Optional. Default value 3.
+	Retries int
+
+	// MinBackoff and MaxBackoff are passed to `helpers.JitterBackoff` to calculate the waiting time between
+	// two attempts.
+	// Optional. Default value 1s and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the deadline of an attempt.
+	// Optional. Default value 30s.
+	Timeout time.Duration
+
+	// Pool is the name of the goroutine pool of `SendAsync`.
+	// Optional. Default value "", a new goroutine per message.
+	Pool string
+}
+
+// Mailer sends the messages through a sender, safe for the concurrent use.
+type Mailer struct {
+	sender Sender
+	config Config
+}
+
+// New returns a mailer sending through `sender`.
+func New(sender Sender, config Config) *Mailer {
+	if config.Retries < 0 {
+		config.Retries = 0
+	} else if config.Retries == 0 {
+		config.Retries = 3
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &Mailer{sender: sender, config: config}
+}
+
+// Send renders the template of `msg` if any and sends it, retrying on a temporary error.
+func (m *Mailer) Send(c context.Context, msg *Message) error {
+	if err := m.prepare(msg); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt <= m.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-c.Done():
+				return errors.Wrapf(c.Err(), "mail: gave up after %d attempts, last error: %v", attempt, err)
+			case <-time.After(helpers.JitterBackoff(m.config.MinBackoff, m.config.MaxBackoff, attempt)):
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c, m.config.Timeout)
+		err = m.sender.Send(ctx, msg)
+		cancel()
+
+		var permanent *PermanentError
+		if err == nil || errors.As(err, &permanent) {
+			return err
+		}
+
+		bean.LoggerWithContext(c).Warnf("mail: attempt %d to send %q failed: %v", attempt+1, msg.Subject, err)
+	}
+
+	return err
+}
+
+// SendAsync sends `msg` in a safe goroutine, out of the lifetime of the request of `c` but with its request
+// ID. The error is logged, wait for the returned future to get it.
+func (m *Mailer) SendAsync(c context.Context, msg *Message) *async.Future[struct{}] {
+	ctx := context.Background()
+	if requestID := helpers.RequestIDFromContext(c); requestID != "" {
+		ctx = helpers.WithRequestID(ctx, requestID)
+	}
+
+	var pool []string
+	if m.config.Pool != "" {
+		pool = []string{m.config.Pool}
+	}
+
+	return async.Go(ctx, func(ctx context.Context) (struct{}, error) {
+		err := m.Send(ctx, msg)
+		if err != nil {
+			bean.LoggerWithContext(ctx).Errorf("mail: failed to send %q: %v", msg.Subject, err)
+		}
+		return struct{}{}, err
+	}, pool...)
+}
+
+// Render renders the goview template `name` with `data`.
+func (m *Mailer) Render(name string, data map[string]interface{}) (string, error) {
+	if m.config.Views == nil {
+		return "", errors.Errorf("mail: no views to render the template %s", name)
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	var buf bytes.Buffer
+	if err := m.config.Views.RenderWriter(&buf, name, data); err != nil {
+		return "", errors.Wrapf(err, "mail: failed to render the template %s", name)
+	}
+
+	return buf.String(), nil
+}
+
+// prepare sets the default sender, renders the template and validates the message.
+func (m *Mailer) prepare(msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.config.From
+	}
+
+	if msg.Template != "" && msg.HTML == "" {
+		html, err := m.Render(msg.Template, msg.Data)
+		if err != nil {
+			return err
+		}
+		msg.HTML = html
+	}
+
+	return msg.validate()
+}
+
+// statusError returns the error of a failed call to the API of a provider, permanent if the request
+// itself is wrong.
+func statusError(provider string, res *http.Response, body []byte) error {
+	err := errors.Errorf("mail: %s: %d %s", provider, res.StatusCode, bytes.TrimSpace(body))
+
+	if res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{Err: err}
+	}
+
+	return err
+}
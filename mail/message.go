@@ -0,0 +1,287 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is an email.
+type Message struct {
+	// From is `Mailer.Config.From` if empty.
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+	Subject string
+
+	// Text and HTML are the bodies of the email, at least one of them is required unless `Template` is set.
+	Text string
+	HTML string
+
+	// Template is the goview template rendered into `HTML` with `Data` by `Mailer.Send` if `HTML` is empty.
+	Template string
+	Data     map[string]interface{}
+
+	Attachments []Attachment
+
+	// Headers are added to the email. (example: `List-Unsubscribe`)
+	Headers map[string]string
+}
+
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Recipients returns the addresses of `To`, `Cc` and `Bcc`.
+func (m *Message) Recipients() []string {
+	var recipients []string
+	for _, addresses := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, address := range addresses {
+			if addr, err := mail.ParseAddress(address); err == nil {
+				recipients = append(recipients, addr.Address)
+			}
+		}
+	}
+
+	return recipients
+}
+
+// validate checks the addresses and the bodies of the message.
+func (m *Message) validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return errors.Wrapf(err, "mail: invalid from address %q", m.From)
+	}
+
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return errors.New("mail: no recipient")
+	}
+
+	for _, addresses := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, address := range addresses {
+			if _, err := mail.ParseAddress(address); err != nil {
+				return errors.Wrapf(err, "mail: invalid recipient %q", address)
+			}
+		}
+	}
+
+	if m.Text == "" && m.HTML == "" {
+		return errors.New("mail: the message has no body")
+	}
+
+	return nil
+}
+
+// Bytes returns the message in the RFC 5322 format, without the `Bcc` header.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", m.From)
+	if len(m.To) > 0 {
+		header.Set("To", strings.Join(m.To, ", "))
+	}
+	if len(m.Cc) > 0 {
+		header.Set("Cc", strings.Join(m.Cc, ", "))
+	}
+	if m.ReplyTo != "" {
+		header.Set("Reply-To", m.ReplyTo)
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-Id", messageID(m.From))
+	header.Set("Mime-Version", "1.0")
+	for name, value := range m.Headers {
+		header.Set(name, value)
+	}
+
+	bodyHeader, body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Attachments) == 0 {
+		for name, values := range bodyHeader {
+			header[name] = values
+		}
+		writeHeader(&buf, header)
+		buf.Write(body)
+
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	writeHeader(&buf, header)
+
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		writeBase64(part, a.Data)
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// body returns the header and the content of the text and/or HTML bodies.
+func (m *Message) body() (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+
+	if m.Text != "" && m.HTML != "" {
+		alternative := multipart.NewWriter(&buf)
+		header.Set("Content-Type", "multipart/alternative; boundary="+alternative.Boundary())
+
+		for _, body := range []struct{ contentType, content string }{
+			{"text/plain; charset=utf-8", m.Text},
+			{"text/html; charset=utf-8", m.HTML},
+		} {
+			part, err := alternative.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {body.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+			writeQuotedPrintable(part, body.content)
+		}
+
+		if err := alternative.Close(); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		return header, buf.Bytes(), nil
+	}
+
+	contentType, content := "text/plain; charset=utf-8", m.Text
+	if m.HTML != "" {
+		contentType, content = "text/html; charset=utf-8", m.HTML
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	writeQuotedPrintable(&buf, content)
+
+	return header, buf.Bytes(), nil
+}
+
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+func writeHeader(w io.Writer, header textproto.MIMEHeader) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		for _, value := range header[name] {
+			// A line break in a value would inject a header.
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, headerSanitizer.Replace(value))
+		}
+	}
+	buf.WriteString("\r\n")
+
+	_, _ = w.Write(buf.Bytes())
+}
+
+func writeQuotedPrintable(w io.Writer, content string) {
+	qp := quotedprintable.NewWriter(w)
+	_, _ = qp.Write([]byte(content))
+	_ = qp.Close()
+}
+
+// writeBase64 writes `data` in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		_, _ = w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	_, _ = w.Write([]byte(encoded + "\r\n"))
+}
+
+func parseAddress(address string) (string, error) {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", errors.Wrapf(err, "mail: invalid address %q", address)
+	}
+
+	return addr.Address, nil
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
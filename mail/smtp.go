@@ -0,0 +1,154 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// SMTPConfig defines the config for `NewSMTPSender`.
+type SMTPConfig struct {
+	// Host of the SMTP server.
+	// Required.
+	Host string
+
+	// Port of the SMTP server.
+	// Optional. Default value 465 if `ImplicitTLS` is on, otherwise 587.
+	Port int
+
+	// Username and Password authenticate with the PLAIN mechanism if the username is set.
+	// Optional. Default value "".
+	Username string
+	Password string
+
+	// ImplicitTLS connects with TLS from the start (SMTPS) instead of upgrading the connection by STARTTLS.
+	// Optional. Default value false.
+	ImplicitTLS bool
+}
+
+// SMTPSender sends the messages to an SMTP server, a connection per message.
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPSender returns an SMTP sender.
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	if config.Port == 0 {
+		config.Port = 587
+		if config.ImplicitTLS {
+			config.Port = 465
+		}
+	}
+
+	return &SMTPSender{config: config}
+}
+
+// Send implements `Sender`. A 5xx reply of the server is a `PermanentError`.
+func (s *SMTPSender) Send(c context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(c, "tcp", addr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if deadline, ok := c.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if s.config.ImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError(err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.config.ImplicitTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	from, err := parseAddress(msg.From)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	if err := client.Mail(from); err != nil {
+		return smtpError(err)
+	}
+
+	for _, rcpt := range msg.Recipients() {
+		if err := client.Rcpt(rcpt); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return smtpError(err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+
+	return smtpError(client.Quit())
+}
+
+// smtpError marks the 5xx replies as permanent.
+func smtpError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return &PermanentError{Err: errors.WithStack(err)}
+	}
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,271 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package masking
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Options of `Copy`.
+type Options struct {
+	// Tables to copy. They must be in the profile. Default value is all the tables of the profile.
+	Tables []string
+	// BatchSize is the number of rows inserted at once. Default value is 500.
+	BatchSize int
+	// Truncate deletes the rows of the destination tables before the copy.
+	Truncate bool
+}
+
+// Report proves which masked columns have no raw value of the source in the destination.
+type Report struct {
+	Profile string
+	Tables  []TableReport
+}
+
+// TableReport is the report of a table.
+type TableReport struct {
+	Table string
+	// Copied is the number of rows copied, 0 for `Verify`.
+	Copied  int
+	Columns []ColumnReport
+}
+
+// ColumnReport is the report of a masked column.
+type ColumnReport struct {
+	Column string
+	Rule   Rule
+	// Checked is the number of values of the destination checked.
+	Checked int
+	// Leaked is the number of values of the destination equal to a raw value of the source, or not NULL
+	// for the `null` rule.
+	Leaked int
+}
+
+// Passed returns true if no raw value has leaked.
+func (r *Report) Passed() bool {
+	for _, table := range r.Tables {
+		for _, column := range table.Columns {
+			if column.Leaked > 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+
+	result := "passed"
+	if !r.Passed() {
+		result = "FAILED"
+	}
+	fmt.Fprintf(&b, "masking profile %s: %s\n", r.Profile, result)
+
+	for _, table := range r.Tables {
+		fmt.Fprintf(&b, "%s: %d rows copied\n", table.Table, table.Copied)
+		for _, column := range table.Columns {
+			fmt.Fprintf(&b, "  %s (%s): %d checked, %d leaked\n", column.Column, column.Rule, column.Checked, column.Leaked)
+		}
+	}
+
+	return b.String()
+}
+
+// Copy copies the tables of `profile` from `src` to `dst` with their columns masked, then verifies them with
+// `Verify`. The destination tables must exist. An error is returned if a table is not in the profile, so
+// that no table is copied without a decision on its personal data.
+func Copy(c context.Context, src, dst *gorm.DB, profile *Profile, options Options) (*Report, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+
+	tables := options.Tables
+	if len(tables) == 0 {
+		tables = profile.tables()
+	}
+	for _, table := range tables {
+		if _, ok := profile.Rules(table); !ok {
+			return nil, errors.Errorf("masking: table %s is not in the profile %q", table, profile.Name)
+		}
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = 500
+	}
+
+	copied := make(map[string]int, len(tables))
+	for _, table := range tables {
+		n, err := copyTable(c, src, dst, profile, table, options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "masking: copy %s", table)
+		}
+		copied[table] = n
+	}
+
+	report, err := Verify(c, src, dst, profile, tables...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Tables {
+		report.Tables[i].Copied = copied[report.Tables[i].Table]
+	}
+
+	return report, nil
+}
+
+func copyTable(c context.Context, src, dst *gorm.DB, profile *Profile, table string, options Options) (int, error) {
+	dst = dst.WithContext(c)
+
+	if options.Truncate {
+		if err := dst.Exec("DELETE FROM ?", clause.Table{Name: table}).Error; err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	rows, err := src.WithContext(c).Table(table).Rows()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	copied := 0
+	batch := make([]map[string]interface{}, 0, options.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.Table(table).Create(&batch).Error; err != nil {
+			return errors.WithStack(err)
+		}
+		copied += len(batch)
+		batch = make([]map[string]interface{}, 0, options.BatchSize)
+		return nil
+	}
+
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := src.ScanRows(rows, &row); err != nil {
+			return copied, errors.WithStack(err)
+		}
+		profile.Mask(table, row)
+
+		batch = append(batch, row)
+		if len(batch) == options.BatchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, errors.WithStack(err)
+	}
+
+	return copied, flush()
+}
+
+// Verify checks that the masked columns of `tables`, by default all the tables of `profile`, have no raw
+// value of `src` in `dst`. The empty values are ignored. The columns without a rule are not checked.
+func Verify(c context.Context, src, dst *gorm.DB, profile *Profile, tables ...string) (*Report, error) {
+	if len(tables) == 0 {
+		tables = profile.tables()
+	}
+
+	report := &Report{Profile: profile.Name}
+	for _, table := range tables {
+		rules, _ := profile.Rules(table)
+
+		columns := make([]string, 0, len(rules))
+		for column := range rules {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		tableReport := TableReport{Table: table}
+		for _, column := range columns {
+			columnReport, err := verifyColumn(c, src, dst, table, column, rules[column])
+			if err != nil {
+				return nil, errors.Wrapf(err, "masking: verify %s.%s", table, column)
+			}
+			tableReport.Columns = append(tableReport.Columns, columnReport)
+		}
+		report.Tables = append(report.Tables, tableReport)
+	}
+
+	return report, nil
+}
+
+func verifyColumn(c context.Context, src, dst *gorm.DB, table, column string, rule Rule) (ColumnReport, error) {
+	report := ColumnReport{Column: column, Rule: rule}
+
+	var masked []sql.NullString
+	if err := dst.WithContext(c).Table(table).Pluck(column, &masked).Error; err != nil {
+		return report, errors.WithStack(err)
+	}
+
+	if rule.Strategy == Null {
+		for _, value := range masked {
+			report.Checked++
+			if value.Valid {
+				report.Leaked++
+			}
+		}
+		return report, nil
+	}
+
+	var raw []sql.NullString
+	if err := src.WithContext(c).Table(table).Pluck(column, &raw).Error; err != nil {
+		return report, errors.WithStack(err)
+	}
+
+	// Only the digests of the raw values are kept in memory.
+	digests := make(map[[sha256.Size]byte]struct{}, len(raw))
+	for _, value := range raw {
+		if value.Valid && value.String != "" {
+			digests[sha256.Sum256([]byte(value.String))] = struct{}{}
+		}
+	}
+
+	for _, value := range masked {
+		if !value.Valid || value.String == "" {
+			continue
+		}
+		report.Checked++
+		if _, ok := digests[sha256.Sum256([]byte(value.String))]; ok {
+			report.Leaked++
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,278 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package masking copies data into the lower environments, like staging and development, with the personal
+// data masked by a declarative profile, and verifies that no raw value of a masked column was copied.
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Strategy is how the values of a column are masked.
+type Strategy string
+
+const (
+	// Hash replaces a value with a salted hash, so that the joins on the column still work.
+	Hash Strategy = "hash"
+	// Fake replaces a value with a fake value of the kind of the rule, the same for the same value.
+	Fake Strategy = "fake"
+	// Null replaces a value with NULL.
+	Null Strategy = "null"
+)
+
+// The kinds of the fake values.
+const (
+	FakeText  = "text"
+	FakeName  = "name"
+	FakeEmail = "email"
+	FakePhone = "phone"
+)
+
+// Rule masks a column. In a profile it's written `hash`, `null` or `fake:<kind>`, e.g. `fake:email`.
+type Rule struct {
+	Strategy Strategy
+	// Fake is the kind of the fake values. Default value is `text`.
+	Fake string
+}
+
+// ParseRule parses the rule `s`.
+func ParseRule(s string) (Rule, error) {
+	strategy, kind, _ := strings.Cut(strings.TrimSpace(s), ":")
+	rule := Rule{Strategy: Strategy(strategy), Fake: kind}
+
+	switch rule.Strategy {
+	case Hash, Null:
+		if kind != "" {
+			return Rule{}, errors.Errorf("masking: rule %q: %s has no kind", s, strategy)
+		}
+	case Fake:
+		switch kind {
+		case "":
+			rule.Fake = FakeText
+		case FakeText, FakeName, FakeEmail, FakePhone:
+		default:
+			return Rule{}, errors.Errorf("masking: rule %q: unknown fake %q", s, kind)
+		}
+	default:
+		return Rule{}, errors.Errorf("masking: rule %q: unknown strategy %q", s, strategy)
+	}
+
+	return rule, nil
+}
+
+func (r Rule) String() string {
+	if r.Strategy == Fake {
+		return string(r.Strategy) + ":" + r.Fake
+	}
+	return string(r.Strategy)
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.WithStack(err)
+	}
+
+	rule, err := ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*r = rule
+
+	return nil
+}
+
+func (r *Rule) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return errors.WithStack(err)
+	}
+
+	rule, err := ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*r = rule
+
+	return nil
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// Profile declares the masking of the tables copied into an environment. Only the tables of the profile
+// can be copied; a table without rules is copied as it is.
+//
+//	name: staging
+//	salt: 8c1f...
+//	tables:
+//	  users:
+//	    email: fake:email
+//	    name: fake:name
+//	    phone: hash
+//	    birthday: null
+//	  products: {}
+type Profile struct {
+	Name string `json:"name" yaml:"name"`
+	// Salt of the hashes and the fake values. Keep it secret, otherwise the hashed values can be guessed.
+	// Required if a rule is `hash` or `fake`.
+	Salt   string                     `json:"salt" yaml:"salt"`
+	Tables map[string]map[string]Rule `json:"tables" yaml:"tables"`
+}
+
+// LoadProfile reads a profile from a JSON or a YAML file.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var profile Profile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &profile)
+	default:
+		err = json.Unmarshal(data, &profile)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "masking: %s", path)
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// Validate checks that the profile has tables and a salt if it's needed.
+func (p *Profile) Validate() error {
+	if len(p.Tables) == 0 {
+		return errors.Errorf("masking: profile %q has no tables", p.Name)
+	}
+
+	for table, rules := range p.Tables {
+		for column, rule := range rules {
+			if rule.Strategy == "" {
+				return errors.Errorf("masking: profile %q: %s.%s has no strategy", p.Name, table, column)
+			}
+			if rule.Strategy != Null && p.Salt == "" {
+				return errors.Errorf("masking: profile %q has no salt for %s.%s", p.Name, table, column)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rules returns the rules of `table`, and false if the table is not in the profile.
+func (p *Profile) Rules(table string) (map[string]Rule, bool) {
+	rules, ok := p.Tables[table]
+	return rules, ok
+}
+
+// Mask masks the columns of `row` of `table` in place. The NULL and the empty values are kept.
+func (p *Profile) Mask(table string, row map[string]interface{}) {
+	for column, rule := range p.Tables[table] {
+		value, ok := row[column]
+		if !ok || value == nil || stringValue(value) == "" {
+			continue
+		}
+		row[column] = p.mask(table, column, rule, value)
+	}
+}
+
+func (p *Profile) mask(table, column string, rule Rule, value interface{}) interface{} {
+	if rule.Strategy == Null {
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.Salt))
+	mac.Write([]byte(table + "." + column + "\x00" + stringValue(value)))
+	sum := mac.Sum(nil)
+
+	if rule.Strategy == Hash {
+		return hex.EncodeToString(sum[:16])
+	}
+
+	n := binary.BigEndian.Uint64(sum)
+	id := hex.EncodeToString(sum[:4])
+
+	switch rule.Fake {
+	case FakeName:
+		return firstNames[n%uint64(len(firstNames))] + " " + lastNames[(n>>32)%uint64(len(lastNames))]
+	case FakeEmail:
+		return "user-" + id + "@example.com"
+	case FakePhone:
+		// The 555-01XX numbers are reserved for the fictional use.
+		return fmt.Sprintf("555-01%02d-%04d", n%100, (n>>16)%10000)
+	default:
+		return "masked-" + id
+	}
+}
+
+// stringValue returns the text of a value scanned from a database.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// tables returns the tables of the profile in order.
+func (p *Profile) tables() []string {
+	tables := make([]string, 0, len(p.Tables))
+	for table := range p.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	return tables
+}
+
+var firstNames = []string{
+	"Alex", "Casey", "Charlie", "Drew", "Emery", "Finley", "Haru", "Jamie", "Jordan", "Kai",
+	"Morgan", "Noa", "Quinn", "Ren", "Riley", "Robin", "Sam", "Sora", "Taylor", "Yuki",
+}
+
+var lastNames = []string{
+	"Abe", "Baker", "Clark", "Davis", "Endo", "Fujita", "Garcia", "Hayashi", "Ito", "Kato",
+	"Lee", "Mori", "Nakamura", "Ogawa", "Parker", "Sato", "Suzuki", "Tanaka", "Walker", "Yamada",
+}
@@ -0,0 +1,155 @@
+package masking
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type user struct {
+	ID       uint
+	Name     string
+	Email    string
+	Phone    string
+	Birthday *string
+	Plan     string
+}
+
+func openDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&user{}))
+
+	return db
+}
+
+func testProfile() *Profile {
+	return &Profile{
+		Name: "staging",
+		Salt: "salt",
+		Tables: map[string]map[string]Rule{
+			"users": {
+				"name":     {Strategy: Fake, Fake: FakeName},
+				"email":    {Strategy: Fake, Fake: FakeEmail},
+				"phone":    {Strategy: Hash},
+				"birthday": {Strategy: Null},
+			},
+		},
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("fake:email")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Strategy: Fake, Fake: FakeEmail}, rule)
+
+	rule, err = ParseRule("fake")
+	require.NoError(t, err)
+	assert.Equal(t, "fake:text", rule.String())
+
+	for _, s := range []string{"", "hash:email", "fake:unknown", "drop"} {
+		_, err := ParseRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlFile := filepath.Join(dir, "staging.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("name: staging\nsalt: salt\ntables:\n  users:\n    email: fake:email\n    birthday: \"null\"\n  plans: {}\n"), 0o600))
+	profile, err := LoadProfile(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Strategy: Fake, Fake: FakeEmail}, profile.Tables["users"]["email"])
+	assert.Equal(t, Rule{Strategy: Null}, profile.Tables["users"]["birthday"])
+	assert.Equal(t, []string{"plans", "users"}, profile.tables())
+
+	jsonFile := filepath.Join(dir, "staging.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"name": "staging", "tables": {"users": {"phone": "hash"}}}`), 0o600))
+	_, err = LoadProfile(jsonFile)
+	assert.ErrorContains(t, err, "no salt")
+
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"tables": {"users": {"phone": "encrypt"}}}`), 0o600))
+	_, err = LoadProfile(jsonFile)
+	assert.ErrorContains(t, err, "unknown strategy")
+}
+
+func TestMask(t *testing.T) {
+	profile := testProfile()
+
+	row := map[string]interface{}{"name": "Taro Yamada", "email": "taro@example.jp", "phone": []byte("090-1234-5678"), "birthday": "1990-01-01", "plan": "gold"}
+	profile.Mask("users", row)
+
+	assert.NotEqual(t, "Taro Yamada", row["name"])
+	assert.True(t, strings.HasSuffix(row["email"].(string), "@example.com"))
+	assert.Len(t, row["phone"], 32)
+	assert.Nil(t, row["birthday"])
+	assert.Equal(t, "gold", row["plan"])
+
+	// The same value is masked the same way, so that the joins still work.
+	again := map[string]interface{}{"phone": "090-1234-5678"}
+	profile.Mask("users", again)
+	assert.Equal(t, row["phone"], again["phone"])
+
+	profile.Salt = "another"
+	profile.Mask("users", again)
+	assert.NotEqual(t, row["phone"], again["phone"])
+}
+
+func TestCopy(t *testing.T) {
+	src, dst := openDB(t, "masking_src"), openDB(t, "masking_dst")
+
+	birthday := "1990-01-01"
+	require.NoError(t, src.Create(&[]user{
+		{Name: "Taro Yamada", Email: "taro@example.jp", Phone: "090-1234-5678", Birthday: &birthday, Plan: "gold"},
+		{Name: "Hanako Sato", Email: "hanako@example.jp", Phone: "080-1234-5678", Plan: "free"},
+		{Name: "Jiro Ito", Email: "jiro@example.jp", Plan: "free"},
+	}).Error)
+
+	report, err := Copy(context.Background(), src, dst, testProfile(), Options{BatchSize: 2})
+	require.NoError(t, err)
+	assert.True(t, report.Passed(), report.String())
+	require.Len(t, report.Tables, 1)
+	assert.Equal(t, 3, report.Tables[0].Copied)
+	assert.Equal(t, ColumnReport{Column: "birthday", Rule: Rule{Strategy: Null}, Checked: 3}, report.Tables[0].Columns[0])
+	assert.Equal(t, ColumnReport{Column: "phone", Rule: Rule{Strategy: Hash}, Checked: 2}, report.Tables[0].Columns[3])
+	assert.Contains(t, report.String(), "masking profile staging: passed")
+
+	var users []user
+	require.NoError(t, dst.Order("id").Find(&users).Error)
+	require.Len(t, users, 3)
+	assert.Equal(t, uint(1), users[0].ID)
+	assert.Equal(t, "gold", users[0].Plan)
+	assert.Nil(t, users[0].Birthday)
+	assert.NotEqual(t, "taro@example.jp", users[0].Email)
+	assert.Empty(t, users[2].Phone)
+
+	// A raw value copied without the profile is reported.
+	require.NoError(t, dst.Model(&user{}).Where("id = ?", 2).Update("email", "hanako@example.jp").Error)
+	report, err = Verify(context.Background(), src, dst, testProfile())
+	require.NoError(t, err)
+	assert.False(t, report.Passed())
+	assert.Equal(t, 1, report.Tables[0].Columns[1].Leaked)
+	assert.Contains(t, report.String(), "FAILED")
+
+	// The copy can start again from an empty destination.
+	report, err = Copy(context.Background(), src, dst, testProfile(), Options{Truncate: true})
+	require.NoError(t, err)
+	assert.True(t, report.Passed())
+
+	_, err = Copy(context.Background(), src, dst, testProfile(), Options{Tables: []string{"orders"}})
+	assert.ErrorContains(t, err, "not in the profile")
+}
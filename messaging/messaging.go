@@ -0,0 +1,290 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package messaging publishes and consumes the messages of a broker, GCP Pub/Sub with the `pubsub`
+// adapter or AWS SQS/SNS with the `sqs` adapter, behind the same handlers:
+//
+//	sub := messaging.NewSubscriber(broker, messaging.SubscriberConfig{Concurrency: 20})
+//	sub.Use(messaging.Logging())
+//	err := sub.Run(ctx, "order-events", func(c context.Context, msg *messaging.Message) error {
+//		return orders.Handle(c, msg.Data)
+//	})
+//
+// A message is acked if its handler returns nil and nacked, to be redelivered by the broker, if it
+// returns an error or panics.
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// RequestIDAttribute is the attribute carrying the request ID of the publisher to the handlers.
+const RequestIDAttribute = "request_id"
+
+// Message is a message of a broker.
+type Message struct {
+	// ID is set by the broker.
+	ID         string
+	Data       []byte
+	Attributes map[string]string
+
+	// PublishedAt is set by the broker on receive.
+	PublishedAt time.Time
+
+	// AckID identifies the delivery to ack or nack. (example: the ack ID of Pub/Sub or the receipt handle
+	// of SQS)
+	AckID string
+
+	// DeliveryAttempt is the number of deliveries of the message if the broker reports it, 0 otherwise.
+	DeliveryAttempt int
+}
+
+// Broker is implemented by the adapters of the message brokers.
+type Broker interface {
+	// Publish sends `msgs` to `topic`, at most `MaxBatchSize` at a time.
+	Publish(c context.Context, topic string, msgs []*Message) error
+
+	// Pull waits for at most `max` messages of `subscription`, it may return none.
+	Pull(c context.Context, subscription string, max int) ([]*Message, error)
+
+	// Ack deletes the handled messages.
+	Ack(c context.Context, subscription string, msgs []*Message) error
+
+	// Nack makes the messages available for a redelivery right away.
+	Nack(c context.Context, subscription string, msgs []*Message) error
+
+	// MaxBatchSize is the number of messages a request of the broker can hold.
+	MaxBatchSize() int
+}
+
+// Handler handles a message.
+type Handler func(c context.Context, msg *Message) error
+
+// Middleware wraps the handlers of a subscriber.
+type Middleware func(next Handler) Handler
+
+// Publisher publishes the messages of the process in batches.
+type Publisher struct {
+	broker Broker
+}
+
+// NewPublisher returns a publisher to `broker`.
+func NewPublisher(broker Broker) *Publisher {
+	return &Publisher{broker: broker}
+}
+
+// Publish sends `msgs` to `topic`, split into batches of the broker. The request ID of `c` is added in
+// the `request_id` attribute of the messages which don't have it.
+func (p *Publisher) Publish(c context.Context, topic string, msgs ...*Message) error {
+	if requestID := helpers.RequestIDFromContext(c); requestID != "" {
+		for _, msg := range msgs {
+			if _, ok := msg.Attributes[RequestIDAttribute]; ok {
+				continue
+			}
+			if msg.Attributes == nil {
+				msg.Attributes = map[string]string{}
+			}
+			msg.Attributes[RequestIDAttribute] = requestID
+		}
+	}
+
+	size := p.broker.MaxBatchSize()
+	if size <= 0 {
+		size = len(msgs)
+	}
+
+	for start := 0; start < len(msgs); start += size {
+		end := start + size
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+
+		if err := p.broker.Publish(c, topic, msgs[start:end]); err != nil {
+			return errors.Wrapf(err, "messaging: failed to publish to %s", topic)
+		}
+	}
+
+	return nil
+}
+
+// SubscriberConfig defines the config for `NewSubscriber`.
+type SubscriberConfig struct {
+	// Concurrency is the number of messages handled at the same time.
+	// Optional. Default value 10.
+	Concurrency int
+
+	// BatchSize is the number of messages of a pull, capped by the broker.
+	// Optional. Default value `Concurrency`.
+	BatchSize int
+
+	// Pool is the name of the goroutine pool which executes the handlers.
+	// Optional. Default value "", a new goroutine per message.
+	Pool string
+
+	// Timeout is the deadline of a handler.
+	// Optional. Default value 60s.
+	Timeout time.Duration
+
+	// RetryInterval is the wait after a failed pull.
+	// Optional. Default value 1s.
+	RetryInterval time.Duration
+}
+
+// Subscriber pulls the messages of a subscription and passes them to a handler.
+type Subscriber struct {
+	broker      Broker
+	config      SubscriberConfig
+	middlewares []Middleware
+}
+
+// NewSubscriber returns a subscriber of `broker`.
+func NewSubscriber(broker Broker, config SubscriberConfig) *Subscriber {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 10
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = config.Concurrency
+	}
+	if max := broker.MaxBatchSize(); max > 0 && config.BatchSize > max {
+		config.BatchSize = max
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60 * time.Second
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+
+	return &Subscriber{broker: broker, config: config}
+}
+
+// Use adds middlewares wrapping the handler, the first one is the outermost. It must be called before `Run`.
+func (s *Subscriber) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// Run handles the messages of `subscription` until `c` is done, then waits for the running handlers.
+func (s *Subscriber) Run(c context.Context, subscription string, h Handler) error {
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+
+	for c.Err() == nil {
+		msgs, err := s.broker.Pull(c, subscription, s.config.BatchSize)
+		if err != nil {
+			if c.Err() != nil {
+				break
+			}
+
+			bean.Logger().Errorf("messaging: failed to pull %s: %v", subscription, err)
+
+			select {
+			case <-c.Done():
+			case <-time.After(s.config.RetryInterval):
+			}
+			continue
+		}
+
+		s.handle(subscription, msgs, h)
+	}
+
+	return nil
+}
+
+// handle runs the handler of each message and acks or nacks them, with a context which outlives the one of
+// `Run` so that a shutdown doesn't interrupt the running handlers.
+func (s *Subscriber) handle(subscription string, msgs []*Message, h Handler) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	failed := make([]bool, len(msgs))
+
+	g, _ := async.NewGroup(context.Background(), async.GroupConfig{
+		Limit:     s.config.Concurrency,
+		Pool:      s.config.Pool,
+		AllErrors: true,
+		Operation: "messaging",
+	})
+
+	for i, msg := range msgs {
+		i, msg := i, msg
+
+		g.Go(func(c context.Context) error {
+			// A panic is recovered, logged and sent to sentry by the group, its message is nacked.
+			returned := false
+			defer func() {
+				if !returned {
+					failed[i] = true
+				}
+			}()
+
+			if requestID := msg.Attributes[RequestIDAttribute]; requestID != "" {
+				c = helpers.WithRequestID(c, requestID)
+			}
+
+			c, cancel := context.WithTimeout(c, s.config.Timeout)
+			defer cancel()
+
+			err := h(c, msg)
+			returned = true
+
+			if err != nil {
+				failed[i] = true
+				bean.LoggerWithContext(c).Errorf("messaging: handler of %s failed on message %s: %v", subscription, msg.ID, err)
+			}
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	var acks, nacks []*Message
+	for i, msg := range msgs {
+		if failed[i] {
+			nacks = append(nacks, msg)
+		} else {
+			acks = append(acks, msg)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	if len(acks) > 0 {
+		if err := s.broker.Ack(ctx, subscription, acks); err != nil {
+			bean.Logger().Errorf("messaging: failed to ack %d messages of %s: %v", len(acks), subscription, err)
+		}
+	}
+	if len(nacks) > 0 {
+		if err := s.broker.Nack(ctx, subscription, nacks); err != nil {
+			bean.Logger().Errorf("messaging: failed to nack %d messages of %s: %v", len(nacks), subscription, err)
+		}
+	}
+}
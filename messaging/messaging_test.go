@@ -0,0 +1,160 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	bean.BeanLogger = e.Logger
+}
+
+type fakeBroker struct {
+	mu        sync.Mutex
+	batches   [][]*Message
+	pending   []*Message
+	acked     []string
+	nacked    []string
+	cancelRun context.CancelFunc
+}
+
+func (b *fakeBroker) Publish(c context.Context, topic string, msgs []*Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, msgs)
+	return nil
+}
+
+func (b *fakeBroker) Pull(c context.Context, subscription string, max int) ([]*Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) == 0 {
+		b.cancelRun()
+		return nil, nil
+	}
+
+	n := max
+	if n > len(b.pending) {
+		n = len(b.pending)
+	}
+	msgs := b.pending[:n]
+	b.pending = b.pending[n:]
+
+	return msgs, nil
+}
+
+func (b *fakeBroker) Ack(c context.Context, subscription string, msgs []*Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range msgs {
+		b.acked = append(b.acked, msg.ID)
+	}
+	return nil
+}
+
+func (b *fakeBroker) Nack(c context.Context, subscription string, msgs []*Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range msgs {
+		b.nacked = append(b.nacked, msg.ID)
+	}
+	return nil
+}
+
+func (b *fakeBroker) MaxBatchSize() int { return 2 }
+
+func TestPublisherPublish(t *testing.T) {
+	broker := &fakeBroker{}
+	p := NewPublisher(broker)
+
+	c := helpers.WithRequestID(context.Background(), "req-1")
+	err := p.Publish(c, "orders", &Message{Data: []byte("1")}, &Message{Data: []byte("2")}, &Message{Data: []byte("3")})
+	assert.NoError(t, err)
+
+	if assert.Len(t, broker.batches, 2) {
+		assert.Len(t, broker.batches[0], 2)
+		assert.Len(t, broker.batches[1], 1)
+		assert.Equal(t, "req-1", broker.batches[1][0].Attributes[RequestIDAttribute])
+	}
+}
+
+func TestSubscriberRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	broker := &fakeBroker{
+		cancelRun: cancel,
+		pending: []*Message{
+			{ID: "ok", Attributes: map[string]string{RequestIDAttribute: "req-1"}},
+			{ID: "failed"},
+			{ID: "panicked"},
+			{ID: "poison", DeliveryAttempt: 6},
+		},
+	}
+
+	s := NewSubscriber(broker, SubscriberConfig{Concurrency: 3})
+	s.Use(Logging(), MaxDeliveryAttempts(5))
+
+	var requestID string
+	err := s.Run(ctx, "orders", func(c context.Context, msg *Message) error {
+		switch msg.ID {
+		case "ok":
+			requestID = helpers.RequestIDFromContext(c)
+		case "failed":
+			return errors.New("failed")
+		case "panicked":
+			panic("boom")
+		case "poison":
+			t.Error("a poison message must not be handled")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "req-1", requestID)
+	assert.ElementsMatch(t, []string{"ok", "poison"}, broker.acked)
+	assert.ElementsMatch(t, []string{"failed", "panicked"}, broker.nacked)
+}
+
+func TestHistory(t *testing.T) {
+	async.SetHistory(async.NewMemoryHistory(10))
+	defer async.SetHistory(async.NewMemoryHistory(0))
+
+	h := History("orders")(func(c context.Context, msg *Message) error {
+		switch msg.ID {
+		case "fail":
+			return errors.New("order 42 not found")
+		case "panic":
+			panic("boom")
+		}
+		return nil
+	})
+
+	assert.NoError(t, h(context.Background(), &Message{ID: "ok", DeliveryAttempt: 1}))
+	assert.Error(t, h(context.Background(), &Message{ID: "fail", DeliveryAttempt: 3}))
+	assert.PanicsWithValue(t, "boom", func() { _ = h(context.Background(), &Message{ID: "panic"}) })
+
+	runs, err := async.History(async.HistoryQuery{Name: "orders"})
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 3) {
+		outcomes := map[async.Outcome]async.TaskRun{}
+		for _, run := range runs {
+			outcomes[run.Outcome] = run
+		}
+		assert.Equal(t, 3, outcomes[async.OutcomeFailed].Attempt)
+		assert.Equal(t, async.Fingerprint("order 1 not found"), outcomes[async.OutcomeFailed].Fingerprint)
+		assert.Equal(t, "boom", outcomes[async.OutcomePanicked].Error)
+		assert.Equal(t, async.KindQueue, outcomes[async.OutcomeSucceeded].Kind)
+	}
+}
@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+)
+
+// Logging logs the ID and the duration of each handled message, and the error if any.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(c context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(c, msg)
+
+			logger := bean.LoggerWithContext(c)
+			if err != nil {
+				logger.Warnf("messaging: message %s failed after %s (attempt %d): %v", msg.ID, time.Since(start), msg.DeliveryAttempt, err)
+			} else {
+				logger.Debugf("messaging: message %s handled in %s", msg.ID, time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+// History records each handled message as a run of the task `name` in the history of the async tasks, with
+// the delivery attempt. (see `async.History`)
+func History(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(c context.Context, msg *Message) (err error) {
+			run := async.TaskRun{Name: name, Kind: async.KindQueue, StartedAt: time.Now(), Attempt: msg.DeliveryAttempt}
+
+			// The panic is recorded, then recovered by the subscriber.
+			defer func() {
+				run.Duration = time.Since(run.StartedAt)
+				run.Outcome = async.OutcomeSucceeded
+
+				if r := recover(); r != nil {
+					run.Outcome, run.Error = async.OutcomePanicked, fmt.Sprint(r)
+					async.Record(run)
+					panic(r)
+				}
+
+				if err != nil {
+					run.Outcome, run.Error = async.OutcomeFailed, err.Error()
+				}
+				async.Record(run)
+			}()
+
+			return next(c, msg)
+		}
+	}
+}
+
+// MaxDeliveryAttempts acks a message without calling the handler once it was delivered `max` times, so that
+// a poison message doesn't block a broker without dead letter queue. The brokers which don't report the
+// attempts are not limited.
+func MaxDeliveryAttempts(max int) Middleware {
+	return func(next Handler) Handler {
+		return func(c context.Context, msg *Message) error {
+			if max > 0 && msg.DeliveryAttempt > max {
+				bean.LoggerWithContext(c).Errorf("messaging: message %s dropped after %d delivery attempts", msg.ID, max)
+				return nil
+			}
+
+			return next(c, msg)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package pubsub is the GCP Pub/Sub adapter of the messaging package, through the REST API.
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/messaging"
+)
+
+// Config defines the config for `NewBroker`.
+type Config struct {
+	// Project is the GCP project of the topics and subscriptions which are not full resource names.
+	// Required.
+	Project string
+
+	// Endpoint of the REST API. (example: the emulator)
+	// Optional. Default value "https://pubsub.googleapis.com/v1".
+	Endpoint string
+}
+
+// Broker implements `messaging.Broker` for Pub/Sub.
+type Broker struct {
+	client *http.Client
+	config Config
+}
+
+// NewBroker returns a Pub/Sub broker. `client` must authenticate the requests, for example the client of
+// `google.DefaultClient(ctx, "https://www.googleapis.com/auth/pubsub")` of golang.org/x/oauth2/google.
+func NewBroker(client *http.Client, config Config) *Broker {
+	if config.Endpoint == "" {
+		config.Endpoint = "https://pubsub.googleapis.com/v1"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &Broker{client: client, config: config}
+}
+
+type pubsubMessage struct {
+	Data       string            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type receivedMessage struct {
+	pubsubMessage
+	MessageID   string    `json:"messageId"`
+	PublishTime time.Time `json:"publishTime"`
+}
+
+// Publish implements `messaging.Broker`.
+func (b *Broker) Publish(c context.Context, topic string, msgs []*messaging.Message) error {
+	req := struct {
+		Messages []pubsubMessage `json:"messages"`
+	}{}
+	for _, msg := range msgs {
+		req.Messages = append(req.Messages, pubsubMessage{
+			Data:       base64.StdEncoding.EncodeToString(msg.Data),
+			Attributes: msg.Attributes,
+		})
+	}
+
+	var res struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	if err := b.call(c, b.resource("topics", topic)+":publish", req, &res); err != nil {
+		return err
+	}
+
+	for i, id := range res.MessageIDs {
+		if i < len(msgs) {
+			msgs[i].ID = id
+		}
+	}
+
+	return nil
+}
+
+// Pull implements `messaging.Broker`.
+func (b *Broker) Pull(c context.Context, subscription string, max int) ([]*messaging.Message, error) {
+	req := struct {
+		MaxMessages int `json:"maxMessages"`
+	}{max}
+
+	var res struct {
+		ReceivedMessages []struct {
+			AckID           string          `json:"ackId"`
+			Message         receivedMessage `json:"message"`
+			DeliveryAttempt int             `json:"deliveryAttempt"`
+		} `json:"receivedMessages"`
+	}
+	if err := b.call(c, b.resource("subscriptions", subscription)+":pull", req, &res); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*messaging.Message, 0, len(res.ReceivedMessages))
+	for _, received := range res.ReceivedMessages {
+		data, err := base64.StdEncoding.DecodeString(received.Message.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pubsub: invalid data of message %s", received.Message.MessageID)
+		}
+
+		msgs = append(msgs, &messaging.Message{
+			ID:              received.Message.MessageID,
+			Data:            data,
+			Attributes:      received.Message.Attributes,
+			PublishedAt:     received.Message.PublishTime,
+			AckID:           received.AckID,
+			DeliveryAttempt: received.DeliveryAttempt,
+		})
+	}
+
+	return msgs, nil
+}
+
+// Ack implements `messaging.Broker`.
+func (b *Broker) Ack(c context.Context, subscription string, msgs []*messaging.Message) error {
+	req := struct {
+		AckIDs []string `json:"ackIds"`
+	}{ackIDs(msgs)}
+
+	return b.call(c, b.resource("subscriptions", subscription)+":acknowledge", req, nil)
+}
+
+// Nack implements `messaging.Broker` by setting the ack deadline of the messages to 0.
+func (b *Broker) Nack(c context.Context, subscription string, msgs []*messaging.Message) error {
+	req := struct {
+		AckIDs             []string `json:"ackIds"`
+		AckDeadlineSeconds int      `json:"ackDeadlineSeconds"`
+	}{ackIDs(msgs), 0}
+
+	return b.call(c, b.resource("subscriptions", subscription)+":modifyAckDeadline", req, nil)
+}
+
+// MaxBatchSize implements `messaging.Broker`.
+func (b *Broker) MaxBatchSize() int {
+	return 1000
+}
+
+// resource returns the full name of a topic or a subscription, `name` is used as is if it's already one.
+func (b *Broker) resource(kind, name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		return name
+	}
+
+	return fmt.Sprintf("projects/%s/%s/%s", b.config.Project, kind, name)
+}
+
+func (b *Broker) call(c context.Context, path string, req, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, b.config.Endpoint+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := b.client.Do(httpReq)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode >= http.StatusMultipleChoices {
+		var apiErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(httpRes.Body).Decode(&apiErr)
+
+		return errors.Errorf("pubsub: %s: %d %s %s", path, httpRes.StatusCode, apiErr.Error.Status, apiErr.Error.Message)
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return errors.WithStack(json.NewDecoder(httpRes.Body).Decode(res))
+}
+
+func ackIDs(msgs []*messaging.Message) []string {
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.AckID
+	}
+
+	return ids
+}
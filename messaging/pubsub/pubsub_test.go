@@ -0,0 +1,57 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/retail-ai-inc/bean/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	var paths []string
+	var published map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/v1/projects/demo/topics/orders:publish":
+			_ = json.NewDecoder(r.Body).Decode(&published)
+			_, _ = w.Write([]byte(`{"messageIds":["m1"]}`))
+		case "/v1/projects/demo/subscriptions/orders-sub:pull":
+			_, _ = w.Write([]byte(`{"receivedMessages":[{"ackId":"a1","deliveryAttempt":2,
+				"message":{"data":"aGVsbG8=","attributes":{"k":"v"},"messageId":"m1","publishTime":"2022-01-01T00:00:00Z"}}]}`))
+		case "/v1/projects/demo/subscriptions/orders-sub:acknowledge":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","message":"unknown"}}`))
+		}
+	}))
+	defer server.Close()
+
+	b := NewBroker(server.Client(), Config{Project: "demo", Endpoint: server.URL + "/v1"})
+	ctx := context.Background()
+
+	msg := &messaging.Message{Data: []byte("hello"), Attributes: map[string]string{"k": "v"}}
+	assert.NoError(t, b.Publish(ctx, "orders", []*messaging.Message{msg}))
+	assert.Equal(t, "m1", msg.ID)
+	assert.Equal(t, "aGVsbG8=", published["messages"].([]interface{})[0].(map[string]interface{})["data"])
+
+	msgs, err := b.Pull(ctx, "orders-sub", 10)
+	if assert.NoError(t, err) && assert.Len(t, msgs, 1) {
+		assert.Equal(t, "hello", string(msgs[0].Data))
+		assert.Equal(t, "a1", msgs[0].AckID)
+		assert.Equal(t, 2, msgs[0].DeliveryAttempt)
+		assert.Equal(t, "v", msgs[0].Attributes["k"])
+	}
+
+	assert.NoError(t, b.Ack(ctx, "orders-sub", msgs))
+
+	err = b.Nack(ctx, "projects/other/subscriptions/x", msgs)
+	assert.ErrorContains(t, err, "NOT_FOUND")
+}
@@ -0,0 +1,416 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package sqs is the AWS SQS and SNS adapter of the messaging package. The messages are published to an
+// SNS topic if the topic is its ARN, otherwise to the SQS queue of the URL, and consumed from an SQS queue.
+// Enable the raw message delivery of the SNS subscriptions of the queues so that the handlers receive the
+// published data rather than the SNS envelope.
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/messaging"
+)
+
+// Config defines the config for `NewBroker`.
+type Config struct {
+	// Region of the queues and topics.
+	// Required.
+	Region string
+
+	// Credentials returns the credentials signing the requests.
+	// Optional. Default value the `AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY` and `AWS_SESSION_TOKEN`
+	// environment variables.
+	Credentials func(c context.Context) (helpers.AWSCredentials, error)
+
+	// SQSEndpoint of the SQS API.
+	// Optional. Default value "https://sqs.<region>.amazonaws.com".
+	SQSEndpoint string
+
+	// SNSEndpoint of the SNS API.
+	// Optional. Default value "https://sns.<region>.amazonaws.com".
+	SNSEndpoint string
+
+	// WaitTime is the long polling time of a pull, up to 20 seconds.
+	// Optional. Default value 20s.
+	WaitTime time.Duration
+}
+
+// Broker implements `messaging.Broker` for SQS and SNS.
+type Broker struct {
+	client *http.Client
+	config Config
+	now    func() time.Time
+}
+
+// NewBroker returns an SQS/SNS broker, `client` is `http.DefaultClient` if nil.
+func NewBroker(client *http.Client, config Config) *Broker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if config.Credentials == nil {
+		config.Credentials = envCredentials
+	}
+	if config.SQSEndpoint == "" {
+		config.SQSEndpoint = "https://sqs." + config.Region + ".amazonaws.com"
+	}
+	if config.SNSEndpoint == "" {
+		config.SNSEndpoint = "https://sns." + config.Region + ".amazonaws.com"
+	}
+	if config.WaitTime <= 0 || config.WaitTime > 20*time.Second {
+		config.WaitTime = 20 * time.Second
+	}
+
+	return &Broker{client: client, config: config, now: time.Now}
+}
+
+func envCredentials(c context.Context) (helpers.AWSCredentials, error) {
+	creds := helpers.AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, errors.New("sqs: AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is not set")
+	}
+
+	return creds, nil
+}
+
+type messageAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue"`
+}
+
+type batchResult struct {
+	Successful []struct {
+		ID        string `json:"Id"`
+		MessageID string `json:"MessageId"`
+	} `json:"Successful"`
+	Failed []struct {
+		ID      string `json:"Id"`
+		Code    string `json:"Code"`
+		Message string `json:"Message"`
+	} `json:"Failed"`
+}
+
+func (r batchResult) err(action string) error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+
+	failures := make([]string, len(r.Failed))
+	for i, f := range r.Failed {
+		failures[i] = fmt.Sprintf("%s: %s %s", f.ID, f.Code, f.Message)
+	}
+
+	return errors.Errorf("sqs: %s failed for %d entries: %s", action, len(r.Failed), strings.Join(failures, "; "))
+}
+
+// Publish implements `messaging.Broker`. The data of the messages must be UTF-8 text.
+func (b *Broker) Publish(c context.Context, topic string, msgs []*messaging.Message) error {
+	for _, msg := range msgs {
+		if !utf8.Valid(msg.Data) {
+			return errors.New("sqs: the data of a message must be UTF-8 text, encode the binary data")
+		}
+	}
+
+	if strings.HasPrefix(topic, "arn:aws:sns:") {
+		return b.publishSNS(c, topic, msgs)
+	}
+
+	type entry struct {
+		ID                string                      `json:"Id"`
+		MessageBody       string                      `json:"MessageBody"`
+		MessageAttributes map[string]messageAttribute `json:"MessageAttributes,omitempty"`
+	}
+
+	req := struct {
+		QueueURL string  `json:"QueueUrl"`
+		Entries  []entry `json:"Entries"`
+	}{QueueURL: topic}
+
+	for i, msg := range msgs {
+		e := entry{ID: strconv.Itoa(i), MessageBody: string(msg.Data)}
+		for name, value := range msg.Attributes {
+			if e.MessageAttributes == nil {
+				e.MessageAttributes = map[string]messageAttribute{}
+			}
+			e.MessageAttributes[name] = messageAttribute{DataType: "String", StringValue: value}
+		}
+		req.Entries = append(req.Entries, e)
+	}
+
+	var res batchResult
+	if err := b.callSQS(c, "SendMessageBatch", req, &res); err != nil {
+		return err
+	}
+
+	for _, s := range res.Successful {
+		if i, err := strconv.Atoi(s.ID); err == nil && i < len(msgs) {
+			msgs[i].ID = s.MessageID
+		}
+	}
+
+	return res.err("SendMessageBatch")
+}
+
+// Pull implements `messaging.Broker`, `subscription` is the URL of the queue.
+func (b *Broker) Pull(c context.Context, subscription string, max int) ([]*messaging.Message, error) {
+	if max > 10 {
+		max = 10
+	}
+
+	req := map[string]interface{}{
+		"QueueUrl":              subscription,
+		"MaxNumberOfMessages":   max,
+		"WaitTimeSeconds":       int(b.config.WaitTime / time.Second),
+		"MessageAttributeNames": []string{"All"},
+		"AttributeNames":        []string{"SentTimestamp", "ApproximateReceiveCount"},
+	}
+
+	var res struct {
+		Messages []struct {
+			MessageID         string                      `json:"MessageId"`
+			ReceiptHandle     string                      `json:"ReceiptHandle"`
+			Body              string                      `json:"Body"`
+			Attributes        map[string]string           `json:"Attributes"`
+			MessageAttributes map[string]messageAttribute `json:"MessageAttributes"`
+		} `json:"Messages"`
+	}
+	if err := b.callSQS(c, "ReceiveMessage", req, &res); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*messaging.Message, 0, len(res.Messages))
+	for _, m := range res.Messages {
+		msg := &messaging.Message{
+			ID:    m.MessageID,
+			Data:  []byte(m.Body),
+			AckID: m.ReceiptHandle,
+		}
+
+		if len(m.MessageAttributes) > 0 {
+			msg.Attributes = make(map[string]string, len(m.MessageAttributes))
+			for name, attr := range m.MessageAttributes {
+				msg.Attributes[name] = attr.StringValue
+			}
+		}
+		if ms, err := strconv.ParseInt(m.Attributes["SentTimestamp"], 10, 64); err == nil {
+			msg.PublishedAt = time.UnixMilli(ms)
+		}
+		msg.DeliveryAttempt, _ = strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// Ack implements `messaging.Broker` by deleting the messages.
+func (b *Broker) Ack(c context.Context, subscription string, msgs []*messaging.Message) error {
+	return b.batch(c, "DeleteMessageBatch", subscription, msgs, nil)
+}
+
+// Nack implements `messaging.Broker` by resetting the visibility timeout of the messages.
+func (b *Broker) Nack(c context.Context, subscription string, msgs []*messaging.Message) error {
+	visibility := 0
+	return b.batch(c, "ChangeMessageVisibilityBatch", subscription, msgs, &visibility)
+}
+
+// MaxBatchSize implements `messaging.Broker`.
+func (b *Broker) MaxBatchSize() int {
+	return 10
+}
+
+func (b *Broker) batch(c context.Context, action, queueURL string, msgs []*messaging.Message, visibility *int) error {
+	type entry struct {
+		ID                string `json:"Id"`
+		ReceiptHandle     string `json:"ReceiptHandle"`
+		VisibilityTimeout *int   `json:"VisibilityTimeout,omitempty"`
+	}
+
+	for start := 0; start < len(msgs); start += 10 {
+		end := start + 10
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+
+		req := struct {
+			QueueURL string  `json:"QueueUrl"`
+			Entries  []entry `json:"Entries"`
+		}{QueueURL: queueURL}
+
+		for i, msg := range msgs[start:end] {
+			req.Entries = append(req.Entries, entry{ID: strconv.Itoa(i), ReceiptHandle: msg.AckID, VisibilityTimeout: visibility})
+		}
+
+		var res batchResult
+		if err := b.callSQS(c, action, req, &res); err != nil {
+			return err
+		}
+		if err := res.err(action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Broker) publishSNS(c context.Context, topicARN string, msgs []*messaging.Message) error {
+	form := url.Values{
+		"Action":   {"PublishBatch"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {topicARN},
+	}
+
+	for i, msg := range msgs {
+		prefix := fmt.Sprintf("PublishBatchRequestEntries.member.%d.", i+1)
+		form.Set(prefix+"Id", strconv.Itoa(i))
+		form.Set(prefix+"Message", string(msg.Data))
+
+		n := 0
+		for name, value := range msg.Attributes {
+			n++
+			attr := fmt.Sprintf("%sMessageAttributes.entry.%d.", prefix, n)
+			form.Set(attr+"Name", name)
+			form.Set(attr+"Value.DataType", "String")
+			form.Set(attr+"Value.StringValue", value)
+		}
+	}
+
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, b.config.SNSEndpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := b.do(c, req, body, "sns")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Successful []struct {
+			ID        string `xml:"Id"`
+			MessageID string `xml:"MessageId"`
+		} `xml:"PublishBatchResult>Successful>member"`
+		Failed []struct {
+			ID      string `xml:"Id"`
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"PublishBatchResult>Failed>member"`
+		Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	decodeErr := xml.NewDecoder(res.Body).Decode(&result)
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("sns: PublishBatch: %d %s %s", res.StatusCode, result.Error.Code, result.Error.Message)
+	}
+	if decodeErr != nil {
+		return errors.WithStack(decodeErr)
+	}
+
+	for _, s := range result.Successful {
+		if i, err := strconv.Atoi(s.ID); err == nil && i < len(msgs) {
+			msgs[i].ID = s.MessageID
+		}
+	}
+
+	if len(result.Failed) > 0 {
+		failures := make([]string, len(result.Failed))
+		for i, f := range result.Failed {
+			failures[i] = fmt.Sprintf("%s: %s %s", f.ID, f.Code, f.Message)
+		}
+		return errors.Errorf("sns: PublishBatch failed for %d entries: %s", len(result.Failed), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (b *Broker) callSQS(c context.Context, action string, req, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, b.config.SQSEndpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	httpReq.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	httpRes, err := b.do(c, httpReq, body, "sqs")
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode >= http.StatusMultipleChoices {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(httpRes.Body).Decode(&apiErr)
+
+		return errors.Errorf("sqs: %s: %d %s %s", action, httpRes.StatusCode, apiErr.Type, apiErr.Message)
+	}
+
+	return errors.WithStack(json.NewDecoder(httpRes.Body).Decode(res))
+}
+
+func (b *Broker) do(c context.Context, req *http.Request, body []byte, service string) (*http.Response, error) {
+	creds, err := b.config.Credentials(c)
+	if err != nil {
+		return nil, err
+	}
+
+	helpers.SignAWSV4(req, body, creds, b.config.Region, service, b.now())
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,73 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	var targets []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+
+		target := r.Header.Get("X-Amz-Target")
+		targets = append(targets, target)
+
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		switch target {
+		case "AmazonSQS.SendMessageBatch":
+			_, _ = w.Write([]byte(`{"Successful":[{"Id":"0","MessageId":"m1"}],"Failed":[{"Id":"1","Code":"InvalidParameterValue","Message":"too big"}]}`))
+		case "AmazonSQS.ReceiveMessage":
+			assert.Equal(t, float64(10), req["MaxNumberOfMessages"])
+			_, _ = w.Write([]byte(`{"Messages":[{"MessageId":"m1","ReceiptHandle":"r1","Body":"hello",
+				"Attributes":{"SentTimestamp":"1640995200000","ApproximateReceiveCount":"3"},
+				"MessageAttributes":{"k":{"DataType":"String","StringValue":"v"}}}]}`))
+		case "AmazonSQS.DeleteMessageBatch":
+			_, _ = w.Write([]byte(`{"Successful":[{"Id":"0"}]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.sqs#InvalidAction","message":"unknown"}`))
+		}
+	}))
+	defer server.Close()
+
+	b := NewBroker(server.Client(), Config{
+		Region:      "ap-northeast-1",
+		SQSEndpoint: server.URL,
+		Credentials: func(c context.Context) (helpers.AWSCredentials, error) {
+			return helpers.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		},
+	})
+	ctx := context.Background()
+	queue := "https://sqs.ap-northeast-1.amazonaws.com/123/orders"
+
+	msgs := []*messaging.Message{{Data: []byte("1")}, {Data: []byte("2")}}
+	err := b.Publish(ctx, queue, msgs)
+	assert.ErrorContains(t, err, "InvalidParameterValue")
+	assert.Equal(t, "m1", msgs[0].ID)
+
+	assert.Error(t, b.Publish(ctx, queue, []*messaging.Message{{Data: []byte{0xff}}}))
+
+	received, err := b.Pull(ctx, queue, 50)
+	if assert.NoError(t, err) && assert.Len(t, received, 1) {
+		assert.Equal(t, "hello", string(received[0].Data))
+		assert.Equal(t, "r1", received[0].AckID)
+		assert.Equal(t, 3, received[0].DeliveryAttempt)
+		assert.Equal(t, "v", received[0].Attributes["k"])
+		assert.Equal(t, int64(1640995200), received[0].PublishedAt.Unix())
+	}
+
+	assert.NoError(t, b.Ack(ctx, queue, received))
+	assert.ErrorContains(t, b.Nack(ctx, queue, received), "InvalidAction")
+}
@@ -67,17 +67,72 @@ type (
 		// Optional. Default value false.
 		BodyDump bool
 
-		// MaskedParameters is a slice of parameters for which the user wants to mask the value in logs.
+		// MaskedParameters is a slice of parameters for which the user wants to mask the value in the request
+		// and response bodies. A parameter is a JSON path like `password`, `user.card.number` or `items[*].card`,
+		// where `*` matches every key or element, optionally followed by a strategy like `user.card.number:partial`.
 		// Optional. Default value [].
 		MaskedParameters []string
 
+		// MaskedHeaders is a slice of request and response headers for which the user wants to mask the value
+		// in logs, like `Authorization` or `Set-Cookie`.
+		// Optional. Default value [].
+		MaskedHeaders []string
+
+		// MaskStrategy is how the values are masked, `redact`, `hash` or `partial`.
+		// Optional. Default value "redact".
+		MaskStrategy string
+
 		// RequestHeader is a slice of HTTP request header parameters which user wants to log.
 		RequestHeader []string
 
-		accessLogTemplate *fasttemplate.Template
-		bodyDumpTemplate  *fasttemplate.Template
-		colorer           *color.Color
-		pool              *sync.Pool
+		// ResponseHeader is a slice of HTTP response header parameters which user wants to log in the body dump.
+		// Optional. Default value [].
+		ResponseHeader []string
+
+		// Enrichers append computed fields to the `fields` of the completion log or the body dump.
+		// Optional. Default value [].
+		Enrichers []AccessLogEnricher
+
+		// Classifier classifies the response into the `outcome` of the completion log or the body dump.
+		// Optional. Default value DefaultResponseClassifier.
+		Classifier ResponseClassifier
+
+		// CompletionLog writes a log after the request has been processed with the status, outcome and
+		// fields even when the body dumper is off. It's turned on automatically if any enricher or classifier is set.
+		// Optional. Default value false.
+		CompletionLog bool
+
+		// Optional. Default value DefaultLoggerConfig.CompletionLogFormat.
+		CompletionLogFormat string
+
+		// Format writes a single line per request after it has been processed, instead of the access log
+		// before the request and the completion log. It's one of the built-in formats `json`, `combined`
+		// and `tsv` or a custom template using the tags like `${latency_ms}`, `${tenant_id}`, `${user_id}`,
+		// `${bytes_in}` and `${bytes_out}`. The body dumper still writes its own line if it's on.
+		// Optional. Default value "".
+		Format string
+
+		// TenantHeader is the request header of the `${tenant_id}` tag, unless it's set by `SetLogTenantID`.
+		// Optional. Default value "X-Tenant-ID".
+		TenantHeader string
+
+		// UserIDClaim is the claim of the bearer token of the `${user_id}` tag, unless it's set by `SetLogUserID`.
+		// Optional. Default value "sub".
+		UserIDClaim string
+
+		// JWTSecret verifies the bearer token of the `${user_id}` tag.
+		// Optional. Default value `jwt.secret` of env.json.
+		JWTSecret string
+
+		accessLogTemplate     *fasttemplate.Template
+		bodyDumpTemplate      *fasttemplate.Template
+		completionLogTemplate *fasttemplate.Template
+		formatLogTemplate     *fasttemplate.Template
+		formatEscape          func(string) string
+		maskRules             []maskRule
+		maskedHeaders         map[string]struct{}
+		colorer               *color.Color
+		pool                  *sync.Pool
 	}
 
 	bodyDumpResponseWriter struct {
@@ -95,15 +150,21 @@ var (
 	bodyDumpFormat = `{"time":"${time_rfc3339_nano}","level":"DUMP","id":"${id}","uri":"${uri}","status":${status},` +
 		`"error":"${error}","latency":${latency},"latency_human":"${latency_human}",` +
 		`"bytes_in":${bytes_in},"request_body":${request_body},` +
-		`"bytes_out":${bytes_out},"response_body":${response_body},"request_header":${req_header}}` + "\n"
+		`"bytes_out":${bytes_out},"response_body":${response_body},"request_header":${req_header},` +
+		`"response_header":${res_header},` +
+		`"outcome":"${outcome}","fields":${fields}}` + "\n"
 
 	// DefaultLoggerConfig is the default Logger middleware config.
 	DefaultLoggerConfig = LoggerConfig{
-		Skipper:          middleware.DefaultSkipper,
-		AccessLogFormat:  accessLogFormat,
-		BodyDumpFormat:   bodyDumpFormat,
-		CustomTimeFormat: "2006-01-02 15:04:05.00000",
-		colorer:          color.New(),
+		Skipper:             middleware.DefaultSkipper,
+		AccessLogFormat:     accessLogFormat,
+		BodyDumpFormat:      bodyDumpFormat,
+		CompletionLogFormat: completionLogFormat,
+		CustomTimeFormat:    "2006-01-02 15:04:05.00000",
+		TenantHeader:        "X-Tenant-ID",
+		UserIDClaim:         "sub",
+		MaskStrategy:        MaskRedact,
+		colorer:             color.New(),
 	}
 )
 
@@ -119,12 +180,31 @@ func AccessLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 	if config.BodyDumpFormat == "" {
 		config.BodyDumpFormat = DefaultLoggerConfig.BodyDumpFormat
 	}
+	if config.CompletionLogFormat == "" {
+		config.CompletionLogFormat = DefaultLoggerConfig.CompletionLogFormat
+	}
 	if config.Output == nil {
 		config.Output = DefaultLoggerConfig.Output
 	}
+	if config.TenantHeader == "" {
+		config.TenantHeader = DefaultLoggerConfig.TenantHeader
+	}
+	if config.UserIDClaim == "" {
+		config.UserIDClaim = DefaultLoggerConfig.UserIDClaim
+	}
+	if config.MaskStrategy == "" {
+		config.MaskStrategy = DefaultLoggerConfig.MaskStrategy
+	}
 
 	config.accessLogTemplate = fasttemplate.New(config.AccessLogFormat, "${", "}")
 	config.bodyDumpTemplate = fasttemplate.New(config.BodyDumpFormat, "${", "}")
+	config.completionLogTemplate = fasttemplate.New(config.CompletionLogFormat, "${", "}")
+	config.formatLogTemplate, config.formatEscape = config.formatTemplate()
+	config.maskRules = parseMaskRules(config.MaskedParameters, config.MaskStrategy)
+	config.maskedHeaders = make(map[string]struct{}, len(config.MaskedHeaders))
+	for _, header := range config.MaskedHeaders {
+		config.maskedHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
 	config.colorer = color.New()
 	config.colorer.SetOutput(config.Output)
 	config.pool = &sync.Pool{
@@ -147,14 +227,52 @@ func AccessLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 				return next(c)
 			}
 
-			// Logging into the access log before processing the request.
-			if err = config.logAccess(c); err != nil {
+			// The formatted log is written after the request, with its status, latency and size.
+			var body *countingReader
+			if config.formatLogTemplate != nil {
+				if c.Request().Body != nil {
+					body = &countingReader{ReadCloser: c.Request().Body}
+					c.Request().Body = body
+				}
+			} else if err = config.logAccess(c); err != nil {
+				// Logging into the access log before processing the request.
 				return
 			}
 
 			// Skip the body dumper log if `bodyDump == false` means when the body dumper is off.
 			if !config.BodyDump {
-				return next(c)
+				if config.formatLogTemplate != nil {
+					start := time.Now()
+					if err = next(c); err != nil {
+						c.Error(err)
+					}
+
+					return config.logFormatted(c, start, time.Now(), bytesIn(c, body), err)
+				}
+
+				if !config.enrichEnabled() {
+					// The completion log is written only for a failed request with the breadcrumbs. Without
+					// them, the error is returned to the outer middlewares as usual.
+					start := time.Now()
+					if err = next(c); err != nil {
+						if len(Breadcrumbs(c)) == 0 {
+							return err
+						}
+						c.Error(err)
+					}
+					if len(failedBreadcrumbs(c)) == 0 {
+						return nil
+					}
+
+					return config.logCompletion(c, start, time.Now(), err)
+				}
+
+				start := time.Now()
+				if err = next(c); err != nil {
+					c.Error(err)
+				}
+
+				return config.logCompletion(c, start, time.Now(), err)
 			}
 
 			// IMPORTANT: Get a copy of the request body for body dumper.
@@ -179,6 +297,13 @@ func AccessLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 				c.Error(err)
 			}
 			stop := time.Now()
+
+			if config.formatLogTemplate != nil {
+				if err := config.logFormatted(c, start, stop, int64(len(reqBody)), err); err != nil {
+					return err
+				}
+			}
+
 			buf := config.pool.Get().(*bytes.Buffer)
 			buf.Reset()
 			defer config.pool.Put(buf)
@@ -255,37 +380,35 @@ func AccessLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 					return buf.WriteString(strconv.FormatInt(res.Size, 10))
 				case "request_body":
 					if len(reqBody) > 0 {
-						reqBody, err = maskSensitiveInfo(reqBody, config.MaskedParameters)
+						masked, err := maskJSON(reqBody, config.maskRules)
 						if err == nil {
-							return buf.Write(reqBody)
+							return buf.Write(masked)
 						}
 					}
 					return buf.WriteString(`null`)
 				case "response_body":
-					res_body := strings.TrimSuffix(resBody.String(), "\n")
-					if res_body != "" {
-						return buf.WriteString(res_body)
-					}
-					return buf.WriteString(`null`)
-				case "req_header":
-					if len(config.RequestHeader) > 0 {
-						reqHeader := make(map[string]interface{})
-						for _, param := range config.RequestHeader {
-							v := c.Request().Header.Get(param)
-							if v != "" {
-								reqHeader[param] = v
-							}
-						}
-						reqHeaderByte, err := json.Marshal(reqHeader)
-						if err == nil {
-							return buf.Write(reqHeaderByte)
+					res_body := bytes.TrimSuffix(resBody.Bytes(), []byte("\n"))
+					if len(res_body) > 0 {
+						// The body isn't valid JSON if it's not masked because it's not a JSON document.
+						masked, err := maskJSON(res_body, config.maskRules)
+						if err != nil && len(config.maskRules) > 0 {
+							return buf.WriteString(`null`)
 						}
+						return buf.Write(masked)
 					}
 					return buf.WriteString(`null`)
+				case "req_header":
+					return buf.Write(config.headersJSON(req.Header, config.RequestHeader))
+				case "res_header":
+					return buf.Write(config.headersJSON(res.Header(), config.ResponseHeader))
+				case "outcome":
+					return buf.WriteString(config.classify(c, writer.Status, err))
+				case "fields":
+					return buf.Write(config.collectFields(c))
 				default:
 					switch {
 					case strings.HasPrefix(tag, "header:"):
-						return buf.Write([]byte(c.Request().Header.Get(tag[7:])))
+						return buf.WriteString(config.headerValue(req.Header, tag[7:]))
 					case strings.HasPrefix(tag, "query:"):
 						return buf.Write([]byte(c.QueryParam(tag[6:])))
 					case strings.HasPrefix(tag, "form:"):
@@ -313,6 +436,19 @@ func AccessLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 	}
 }
 
+// bytesIn returns the size of the request body, which is the bytes read by the handler or the
+// `Content-Length` header if the handler didn't read the whole body.
+func bytesIn(c echo.Context, body *countingReader) int64 {
+	n := c.Request().ContentLength
+	if body != nil && body.n > n {
+		n = body.n
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
 func (config LoggerConfig) logAccess(c echo.Context) (err error) {
 	req := c.Request()
 	buf := config.pool.Get().(*bytes.Buffer)
@@ -360,24 +496,11 @@ func (config LoggerConfig) logAccess(c echo.Context) (err error) {
 			}
 			return buf.WriteString(cl)
 		case "req_header":
-			if len(config.RequestHeader) > 0 {
-				reqHeader := make(map[string]interface{})
-				for _, param := range config.RequestHeader {
-					v := c.Request().Header.Get(param)
-					if v != "" {
-						reqHeader[param] = v
-					}
-				}
-				reqHeaderByte, err := json.Marshal(reqHeader)
-				if err == nil {
-					return buf.Write(reqHeaderByte)
-				}
-			}
-			return buf.WriteString(`null`)
+			return buf.Write(config.headersJSON(req.Header, config.RequestHeader))
 		default:
 			switch {
 			case strings.HasPrefix(tag, "header:"):
-				return buf.Write([]byte(c.Request().Header.Get(tag[7:])))
+				return buf.WriteString(config.headerValue(req.Header, tag[7:]))
 			case strings.HasPrefix(tag, "query:"):
 				return buf.Write([]byte(c.QueryParam(tag[6:])))
 			case strings.HasPrefix(tag, "form:"):
@@ -418,24 +541,3 @@ func (w *bodyDumpResponseWriter) Flush() {
 func (w *bodyDumpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return w.ResponseWriter.(http.Hijacker).Hijack()
 }
-
-func maskSensitiveInfo(reqBody []byte, maskedParams []string) ([]byte, error) {
-	if len(maskedParams) == 0 {
-		return reqBody, nil
-	}
-
-	var unmarshaledRequest = make(map[string]interface{})
-	err := json.Unmarshal(reqBody, &unmarshaledRequest)
-	if err != nil {
-		return reqBody, err
-	}
-
-	for _, maskedParam := range maskedParams {
-		if _, ok := unmarshaledRequest[maskedParam]; ok {
-			unmarshaledRequest[maskedParam] = "****"
-		}
-	}
-	maskedRequestBody, _ := json.Marshal(unmarshaledRequest)
-
-	return maskedRequestBody, nil
-}
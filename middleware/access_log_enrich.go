@@ -0,0 +1,215 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Business outcomes returned by `DefaultResponseClassifier`.
+const (
+	OutcomeSuccess       = "success"
+	OutcomeRedirect      = "redirect"
+	OutcomeInvalidInput  = "invalid_input"
+	OutcomeUnauthorized  = "unauthorized"
+	OutcomeNotFound      = "not_found"
+	OutcomeConflict      = "conflict"
+	OutcomeThrottled     = "throttled"
+	OutcomeClientError   = "client_error"
+	OutcomeServerError   = "server_error"
+	OutcomeUnavailable   = "unavailable"
+	OutcomeClientAborted = "client_aborted"
+)
+
+const (
+	logFieldsKey  = "bean.accesslog.fields"
+	logOutcomeKey = "bean.accesslog.outcome"
+)
+
+// AccessLogEnricher appends computed fields to the access log of a request after the handler
+// has been executed. (example: business operation name, order ID, cache hit/miss, shard)
+type AccessLogEnricher func(c echo.Context, fields map[string]interface{})
+
+// ResponseClassifier classifies a response into a business outcome for downstream analytics.
+type ResponseClassifier func(c echo.Context, status int, err error) string
+
+var completionLogFormat = `{"time":"${time_rfc3339_nano}","level":"COMPLETE","id":"${id}","method":"${method}","uri":"${uri}",` +
+	`"status":${status},"outcome":"${outcome}","latency":${latency},"latency_human":"${latency_human}",` +
+	`"bytes_out":${bytes_out},"fields":${fields}}` + "\n"
+
+// SetLogField adds a field to the access log of the current request. It can be called from any handler,
+// service or repository which has the echo context.
+func SetLogField(c echo.Context, key string, value interface{}) {
+	fields, _ := c.Get(logFieldsKey).(map[string]interface{})
+	if fields == nil {
+		fields = make(map[string]interface{})
+		c.Set(logFieldsKey, fields)
+	}
+
+	fields[key] = value
+}
+
+// SetLogOutcome overrides the business outcome of the current request. (example: `out_of_stock`)
+func SetLogOutcome(c echo.Context, outcome string) {
+	c.Set(logOutcomeKey, outcome)
+}
+
+// DefaultResponseClassifier returns the outcome set by `SetLogOutcome` if any, otherwise it maps the HTTP
+// status code into a generic outcome.
+func DefaultResponseClassifier(c echo.Context, status int, err error) string {
+	if outcome, ok := c.Get(logOutcomeKey).(string); ok && outcome != "" {
+		return outcome
+	}
+
+	if c.Request().Context().Err() != nil {
+		return OutcomeClientAborted
+	}
+
+	switch {
+	case status >= 200 && status < 300:
+		return OutcomeSuccess
+	case status >= 300 && status < 400:
+		return OutcomeRedirect
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return OutcomeInvalidInput
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeUnauthorized
+	case status == http.StatusNotFound:
+		return OutcomeNotFound
+	case status == http.StatusConflict:
+		return OutcomeConflict
+	case status == http.StatusTooManyRequests:
+		return OutcomeThrottled
+	case status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return OutcomeUnavailable
+	case status >= 400 && status < 500:
+		return OutcomeClientError
+	}
+
+	return OutcomeServerError
+}
+
+// enrichEnabled reports whether the request outcome and fields need to be logged.
+func (config LoggerConfig) enrichEnabled() bool {
+	return config.CompletionLog || len(config.Enrichers) > 0 || config.Classifier != nil
+}
+
+// collectFields merges the fields set by `SetLogField`, the breadcrumbs of a failed request and the
+// enrichers into a JSON object.
+func (config LoggerConfig) collectFields(c echo.Context) []byte {
+	fields := make(map[string]interface{})
+	if set, ok := c.Get(logFieldsKey).(map[string]interface{}); ok {
+		for k, v := range set {
+			fields[k] = v
+		}
+	}
+	if crumbs := failedBreadcrumbs(c); len(crumbs) > 0 {
+		fields["breadcrumbs"] = crumbs
+	}
+
+	for _, enrich := range config.Enrichers {
+		enrich(c, fields)
+	}
+
+	if len(fields) == 0 {
+		return []byte(`null`)
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return []byte(`null`)
+	}
+
+	return b
+}
+
+func (config LoggerConfig) classify(c echo.Context, status int, err error) string {
+	classifier := config.Classifier
+	if classifier == nil {
+		classifier = DefaultResponseClassifier
+	}
+
+	// Outcome may contain invalid JSON e.g. `"`
+	b, _ := json.Marshal(classifier(c, status, err))
+	return string(b[1 : len(b)-1])
+}
+
+// logCompletion writes the completion log of a request when the body dumper is off.
+func (config LoggerConfig) logCompletion(c echo.Context, start, stop time.Time, err error) error {
+	req := c.Request()
+	res := c.Response()
+
+	buf := config.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer config.pool.Put(buf)
+
+	if _, tplErr := config.completionLogTemplate.ExecuteFunc(buf, func(w io.Writer, tag string) (int, error) {
+		switch tag {
+		case "time_rfc3339_nano":
+			return buf.WriteString(time.Now().Format(time.RFC3339Nano))
+		case "time_custom":
+			return buf.WriteString(time.Now().Format(config.CustomTimeFormat))
+		case "id":
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if id == "" {
+				id = res.Header().Get(echo.HeaderXRequestID)
+			}
+			return buf.WriteString(id)
+		case "method":
+			return buf.WriteString(req.Method)
+		case "uri":
+			return buf.WriteString(req.RequestURI)
+		case "path":
+			return buf.WriteString(c.Path())
+		case "status":
+			return buf.WriteString(strconv.Itoa(res.Status))
+		case "outcome":
+			return buf.WriteString(config.classify(c, res.Status, err))
+		case "latency":
+			return buf.WriteString(strconv.FormatInt(int64(stop.Sub(start)), 10))
+		case "latency_human":
+			return buf.WriteString(stop.Sub(start).String())
+		case "bytes_out":
+			return buf.WriteString(strconv.FormatInt(res.Size, 10))
+		case "fields":
+			return buf.Write(config.collectFields(c))
+		}
+		return 0, nil
+	}); tplErr != nil {
+		return tplErr
+	}
+
+	if config.Output == nil {
+		_, err = c.Logger().Output().Write(buf.Bytes())
+		return err
+	}
+	_, err = config.Output.Write(buf.Bytes())
+	return err
+}
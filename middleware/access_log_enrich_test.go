@@ -0,0 +1,155 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type completionLog struct {
+	Level   string
+	Method  string
+	URI     string
+	Status  int
+	Outcome string
+	Fields  map[string]interface{}
+}
+
+func serveCompletion(t *testing.T, config LoggerConfig, handler echo.HandlerFunc) []completionLog {
+	t.Helper()
+
+	out := new(bytes.Buffer)
+	config.Output = out
+
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(config))
+	e.GET("/orders", handler)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	var logs []completionLog
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var log completionLog
+		require.NoError(t, json.Unmarshal([]byte(line), &log), line)
+		logs = append(logs, log)
+	}
+
+	return logs
+}
+
+func TestDefaultResponseClassifier(t *testing.T) {
+	tests := []struct {
+		status  int
+		outcome string
+	}{
+		{http.StatusOK, OutcomeSuccess},
+		{http.StatusNoContent, OutcomeSuccess},
+		{http.StatusFound, OutcomeRedirect},
+		{http.StatusBadRequest, OutcomeInvalidInput},
+		{http.StatusUnprocessableEntity, OutcomeInvalidInput},
+		{http.StatusUnauthorized, OutcomeUnauthorized},
+		{http.StatusForbidden, OutcomeUnauthorized},
+		{http.StatusNotFound, OutcomeNotFound},
+		{http.StatusConflict, OutcomeConflict},
+		{http.StatusTooManyRequests, OutcomeThrottled},
+		{http.StatusTeapot, OutcomeClientError},
+		{http.StatusServiceUnavailable, OutcomeUnavailable},
+		{http.StatusGatewayTimeout, OutcomeUnavailable},
+		{http.StatusInternalServerError, OutcomeServerError},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		assert.Equal(t, tt.outcome, DefaultResponseClassifier(c, tt.status, nil), tt.status)
+	}
+
+	// The outcome set by the handler wins.
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	SetLogOutcome(c, "out_of_stock")
+	assert.Equal(t, "out_of_stock", DefaultResponseClassifier(c, http.StatusConflict, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), httptest.NewRecorder())
+	assert.Equal(t, OutcomeClientAborted, DefaultResponseClassifier(c, http.StatusOK, nil))
+}
+
+func TestAccessLogEnrichedFields(t *testing.T) {
+	config := LoggerConfig{
+		Enrichers: []AccessLogEnricher{func(c echo.Context, fields map[string]interface{}) {
+			fields["shard"] = 3
+		}},
+	}
+
+	logs := serveCompletion(t, config, func(c echo.Context) error {
+		SetLogField(c, "order_id", "A-1")
+		SetLogOutcome(c, "out_of_stock")
+		return c.NoContent(http.StatusConflict)
+	})
+	require.Len(t, logs, 2)
+
+	completion := logs[1]
+	assert.Equal(t, "COMPLETE", completion.Level)
+	assert.Equal(t, http.MethodGet, completion.Method)
+	assert.Equal(t, "/orders", completion.URI)
+	assert.Equal(t, http.StatusConflict, completion.Status)
+	assert.Equal(t, "out_of_stock", completion.Outcome)
+	assert.Equal(t, map[string]interface{}{"order_id": "A-1", "shard": float64(3)}, completion.Fields)
+
+	// A custom classifier replaces the default one.
+	config = LoggerConfig{Classifier: func(c echo.Context, status int, err error) string {
+		return `"quoted"`
+	}}
+	logs = serveCompletion(t, config, func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	require.Len(t, logs, 2)
+	assert.Equal(t, `"quoted"`, logs[1].Outcome)
+}
+
+func TestAccessLogCompletion(t *testing.T) {
+	// Without the body dumper, the completion log is only written when it's turned on.
+	logs := serveCompletion(t, LoggerConfig{}, func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+	assert.Len(t, logs, 1)
+
+	logs = serveCompletion(t, LoggerConfig{CompletionLog: true}, func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+	require.Len(t, logs, 2)
+	assert.Equal(t, "COMPLETE", logs[1].Level)
+	assert.Equal(t, http.StatusNotFound, logs[1].Status)
+	assert.Equal(t, OutcomeNotFound, logs[1].Outcome)
+	assert.Nil(t, logs[1].Fields)
+}
@@ -0,0 +1,293 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/spf13/viper"
+	"github.com/valyala/fasttemplate"
+)
+
+// Built-in formats of `LoggerConfig.Format`.
+const (
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatTSV      = "tsv"
+)
+
+const (
+	logTenantIDKey = "bean.accesslog.tenant_id"
+	logUserIDKey   = "bean.accesslog.user_id"
+)
+
+var accessLogFormats = map[string]string{
+	AccessLogFormatJSON: `{"time":"${time_rfc3339_nano}","level":"ACCESS","id":"${id}","remote_ip":"${remote_ip}",` +
+		`"host":"${host}","method":"${method}","uri":"${uri}","route":"${route}","protocol":"${protocol}",` +
+		`"status":${status},"latency":${latency},"latency_human":"${latency_human}","bytes_in":${bytes_in},` +
+		`"bytes_out":${bytes_out},"tenant_id":"${tenant_id}","user_id":"${user_id}","user_agent":"${user_agent}",` +
+		`"referer":"${referer}","error":"${error}","outcome":"${outcome}","fields":${fields}}` + "\n",
+
+	// The Apache combined log format, followed by the latency in milliseconds, the request ID and the tenant ID.
+	AccessLogFormatCombined: `${remote_ip} - ${user_id} [${time_clf}] "${method} ${uri} ${protocol}" ${status} ${bytes_out} ` +
+		`"${referer}" "${user_agent}" ${latency_ms} ${id} ${tenant_id}` + "\n",
+
+	AccessLogFormatTSV: "${time_rfc3339_nano}\t${id}\t${remote_ip}\t${method}\t${uri}\t${status}\t${latency_ms}\t" +
+		"${bytes_in}\t${bytes_out}\t${tenant_id}\t${user_id}\t${user_agent}\n",
+}
+
+// SetLogTenantID sets the `tenant_id` of the access log of the current request, otherwise it's read from
+// the `LoggerConfig.TenantHeader` request header.
+func SetLogTenantID(c echo.Context, tenantID interface{}) {
+	c.Set(logTenantIDKey, fmt.Sprint(tenantID))
+}
+
+// SetLogUserID sets the `user_id` of the access log of the current request, otherwise it's read from the
+// `LoggerConfig.UserIDClaim` claim of a valid JWT.
+func SetLogUserID(c echo.Context, userID interface{}) {
+	c.Set(logUserIDKey, fmt.Sprint(userID))
+}
+
+// formatTemplate returns the template of `Format` and the function escaping the values for it. The
+// values of a custom template are escaped as JSON strings if the template is a JSON object.
+func (config LoggerConfig) formatTemplate() (*fasttemplate.Template, func(string) string) {
+	if config.Format == "" {
+		return nil, nil
+	}
+
+	format, ok := accessLogFormats[strings.ToLower(config.Format)]
+	if !ok {
+		format = config.Format
+		if !strings.HasSuffix(format, "\n") {
+			format += "\n"
+		}
+	}
+
+	escape := escapePlain
+	switch {
+	case strings.EqualFold(config.Format, AccessLogFormatCombined):
+		escape = escapeCombined
+	case strings.EqualFold(config.Format, AccessLogFormatTSV):
+		escape = escapeTSV
+	case strings.HasPrefix(strings.TrimSpace(format), "{"):
+		escape = escapeJSON
+	}
+
+	return fasttemplate.New(format, "${", "}"), escape
+}
+
+// logFormatted writes the single line of a request in `Format` after the request has been processed.
+func (config LoggerConfig) logFormatted(c echo.Context, start, stop time.Time, bytesIn int64, err error) error {
+	req := c.Request()
+	res := c.Response()
+	escape := config.formatEscape
+
+	buf := config.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer config.pool.Put(buf)
+
+	if _, tplErr := config.formatLogTemplate.ExecuteFunc(buf, func(w io.Writer, tag string) (int, error) {
+		switch tag {
+		case "time_unix":
+			return buf.WriteString(strconv.FormatInt(stop.Unix(), 10))
+		case "time_unix_nano":
+			return buf.WriteString(strconv.FormatInt(stop.UnixNano(), 10))
+		case "time_rfc3339":
+			return buf.WriteString(stop.Format(time.RFC3339))
+		case "time_rfc3339_nano":
+			return buf.WriteString(stop.Format(time.RFC3339Nano))
+		case "time_clf":
+			return buf.WriteString(stop.Format("02/Jan/2006:15:04:05 -0700"))
+		case "time_custom":
+			return buf.WriteString(escape(stop.Format(config.CustomTimeFormat)))
+		case "id":
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if id == "" {
+				id = res.Header().Get(echo.HeaderXRequestID)
+			}
+			return buf.WriteString(escape(id))
+		case "remote_ip":
+			return buf.WriteString(escape(c.RealIP()))
+		case "host":
+			return buf.WriteString(escape(req.Host))
+		case "uri":
+			return buf.WriteString(escape(req.RequestURI))
+		case "method":
+			return buf.WriteString(escape(req.Method))
+		case "path":
+			p := req.URL.Path
+			if p == "" {
+				p = "/"
+			}
+			return buf.WriteString(escape(p))
+		case "route":
+			return buf.WriteString(escape(c.Path()))
+		case "protocol":
+			return buf.WriteString(escape(req.Proto))
+		case "referer":
+			return buf.WriteString(escape(req.Referer()))
+		case "user_agent":
+			return buf.WriteString(escape(req.UserAgent()))
+		case "status":
+			return buf.WriteString(strconv.Itoa(res.Status))
+		case "error":
+			if err != nil {
+				return buf.WriteString(escape(err.Error()))
+			}
+			return buf.WriteString(escape(""))
+		case "latency":
+			return buf.WriteString(strconv.FormatInt(int64(stop.Sub(start)), 10))
+		case "latency_ms":
+			return buf.WriteString(strconv.FormatFloat(float64(stop.Sub(start))/float64(time.Millisecond), 'f', 3, 64))
+		case "latency_human":
+			return buf.WriteString(escape(stop.Sub(start).String()))
+		case "bytes_in":
+			return buf.WriteString(strconv.FormatInt(bytesIn, 10))
+		case "bytes_out":
+			return buf.WriteString(strconv.FormatInt(res.Size, 10))
+		case "tenant_id":
+			return buf.WriteString(escape(config.tenantID(c)))
+		case "user_id":
+			return buf.WriteString(escape(config.userID(c)))
+		case "outcome":
+			classifier := config.Classifier
+			if classifier == nil {
+				classifier = DefaultResponseClassifier
+			}
+			return buf.WriteString(escape(classifier(c, res.Status, err)))
+		case "fields":
+			return buf.Write(config.collectFields(c))
+		default:
+			switch {
+			case strings.HasPrefix(tag, "header:"):
+				return buf.WriteString(escape(config.headerValue(req.Header, tag[7:])))
+			case strings.HasPrefix(tag, "query:"):
+				return buf.WriteString(escape(c.QueryParam(tag[6:])))
+			case strings.HasPrefix(tag, "cookie:"):
+				cookie, err := c.Cookie(tag[7:])
+				if err == nil {
+					return buf.WriteString(escape(cookie.Value))
+				}
+				return buf.WriteString(escape(""))
+			}
+		}
+		return 0, nil
+	}); tplErr != nil {
+		return tplErr
+	}
+
+	if config.Output == nil {
+		_, err = c.Logger().Output().Write(buf.Bytes())
+		return err
+	}
+	_, err = config.Output.Write(buf.Bytes())
+	return err
+}
+
+// tenantID returns the tenant ID set by `SetLogTenantID` or the value of the tenant header.
+func (config LoggerConfig) tenantID(c echo.Context) string {
+	if id, ok := c.Get(logTenantIDKey).(string); ok {
+		return id
+	}
+
+	return c.Request().Header.Get(config.TenantHeader)
+}
+
+// userID returns the user ID set by `SetLogUserID` or the `UserIDClaim` of the bearer token. The claim
+// of a token which is not signed with `jwt.secret` is not logged, so that a forged token can't
+// impersonate a user in the logs.
+func (config LoggerConfig) userID(c echo.Context) string {
+	if id, ok := c.Get(logUserIDKey).(string); ok {
+		return id
+	}
+
+	if helpers.ExtractJWTFromHeader(c) == "" {
+		return ""
+	}
+
+	secret := config.JWTSecret
+	if secret == "" {
+		secret = viper.GetString("jwt.secret")
+	}
+	if secret == "" {
+		return ""
+	}
+
+	claims := jwt.MapClaims{}
+	if err := helpers.DecodeJWT(c, claims, secret); err != nil {
+		return ""
+	}
+
+	switch id := claims[config.UserIDClaim].(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	case float64:
+		// The JSON numbers are decoded as float64.
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// countingReader counts the bytes of the request body read by the handler.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func escapePlain(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func escapeJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+func escapeTSV(s string) string {
+	return strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func escapeCombined(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer(`"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
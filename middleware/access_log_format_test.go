@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveFormatted(t *testing.T, config LoggerConfig, req *http.Request) string {
+	t.Helper()
+
+	out := new(bytes.Buffer)
+	config.Output = out
+
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(config))
+	e.POST("/orders/:id", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusCreated, string(body))
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	return out.String()
+}
+
+func TestAccessLogFormatJSON(t *testing.T) {
+	token, err := helpers.EncodeJWT(jwt.MapClaims{"sub": 42}, "s3cr3t")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader(`{"a":1}`))
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	req.Header.Set("X-Tenant-ID", "7")
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set("User-Agent", `agent "quoted"`)
+
+	line := serveFormatted(t, LoggerConfig{Format: AccessLogFormatJSON, JWTSecret: "s3cr3t"}, req)
+
+	var log map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(line), &log))
+	assert.Equal(t, "req-1", log["id"])
+	assert.Equal(t, "/orders/:id", log["route"])
+	assert.Equal(t, float64(http.StatusCreated), log["status"])
+	assert.Equal(t, float64(7), log["bytes_in"])
+	assert.Equal(t, float64(7), log["bytes_out"])
+	assert.Equal(t, "7", log["tenant_id"])
+	assert.Equal(t, "42", log["user_id"])
+	assert.Equal(t, `agent "quoted"`, log["user_agent"])
+	assert.Equal(t, OutcomeSuccess, log["outcome"])
+}
+
+func TestAccessLogFormatForgedToken(t *testing.T) {
+	token, _ := helpers.EncodeJWT(jwt.MapClaims{"sub": "admin"}, "forged")
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+	line := serveFormatted(t, LoggerConfig{Format: AccessLogFormatJSON, JWTSecret: "s3cr3t"}, req)
+	assert.Contains(t, line, `"user_id":""`)
+}
+
+func TestAccessLogFormatCombinedAndTSV(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("abc"))
+	line := serveFormatted(t, LoggerConfig{Format: AccessLogFormatCombined}, req)
+	assert.Regexp(t, `^192\.0\.2\.1 - - \[[^\]]+\] "POST /orders/1 HTTP/1\.1" 201 3 "-" "-" [0-9.]+ - -\n$`, line)
+
+	req = httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("abc"))
+	req.Header.Set("User-Agent", "a\tb")
+	line = serveFormatted(t, LoggerConfig{Format: AccessLogFormatTSV}, req)
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+	assert.Len(t, fields, 12)
+	assert.Equal(t, "201", fields[5])
+	assert.Equal(t, `a\tb`, fields[11])
+}
+
+func TestAccessLogFormatCustom(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("abc"))
+	req.Header.Set(echo.HeaderXRequestID, "req-2")
+
+	config := LoggerConfig{Format: "${method} ${route} ${status} ${bytes_in}/${bytes_out} ${tenant_id} ${user_id} ${id}"}
+
+	e := echo.New()
+	out := new(bytes.Buffer)
+	config.Output = out
+	e.Use(AccessLoggerWithConfig(config))
+	e.POST("/orders/:id", func(c echo.Context) error {
+		SetLogTenantID(c, 9)
+		SetLogUserID(c, "u1")
+		return c.String(http.StatusOK, "ok")
+	})
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "POST /orders/:id 200 3/2 9 u1 req-2\n", out.String())
+}
@@ -0,0 +1,221 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Strategies of `LoggerConfig.MaskStrategy`.
+const (
+	// MaskRedact replaces the value with "****".
+	MaskRedact = "redact"
+	// MaskHash replaces the value with the first 16 hex characters of its SHA-256, so that the logs of the
+	// same value can be correlated without revealing it.
+	MaskHash = "hash"
+	// MaskPartial keeps the last 4 characters of the value, like `************4242`.
+	MaskPartial = "partial"
+)
+
+const maskRedacted = "****"
+
+// maskRule masks the values at `path` of a JSON document. A `*` segment matches every key of an object
+// or every element of an array.
+type maskRule struct {
+	path     []string
+	strategy string
+}
+
+// parseMaskRules parses the masked parameters like `password`, `user.card.number`, `items[*].card` or
+// `user.card.number:partial` where the suffix overrides the default strategy.
+func parseMaskRules(params []string, strategy string) []maskRule {
+	rules := make([]maskRule, 0, len(params))
+	for _, param := range params {
+		rule := maskRule{strategy: strategy}
+
+		if i := strings.LastIndex(param, ":"); i >= 0 {
+			switch s := strings.ToLower(param[i+1:]); s {
+			case MaskRedact, MaskHash, MaskPartial:
+				rule.strategy = s
+				param = param[:i]
+			}
+		}
+
+		// `items[*].card` and `items[0].card` are the same as `items.*.card` and `items.0.card`.
+		param = strings.NewReplacer("[", ".", "]", "").Replace(param)
+		for _, segment := range strings.Split(param, ".") {
+			if segment != "" {
+				rule.path = append(rule.path, segment)
+			}
+		}
+
+		if len(rule.path) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// maskJSON masks the values of the JSON `body` matching the rules. The body is returned as it is if it's
+// not JSON or if no value matches.
+func maskJSON(body []byte, rules []maskRule) ([]byte, error) {
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return body, err
+	}
+
+	masked := false
+	for _, rule := range rules {
+		if maskPath(doc, rule.path, rule.strategy) {
+			masked = true
+		}
+	}
+
+	if !masked {
+		return body, nil
+	}
+
+	return json.Marshal(doc)
+}
+
+// maskPath masks the value at `path` in place and reports whether any value has been masked.
+func maskPath(node interface{}, path []string, strategy string) bool {
+	segment, last := path[0], len(path) == 1
+	masked := false
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if last {
+				n[key] = maskValue(value, strategy)
+				masked = true
+			} else if maskPath(value, path[1:], strategy) {
+				masked = true
+			}
+		}
+
+	case []interface{}:
+		for i, value := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				n[i] = maskValue(value, strategy)
+				masked = true
+			} else if maskPath(value, path[1:], strategy) {
+				masked = true
+			}
+		}
+	}
+
+	return masked
+}
+
+// maskValue masks a JSON value, the objects and arrays are masked as a whole.
+func maskValue(value interface{}, strategy string) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return maskRedacted
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	return maskString(s, strategy)
+}
+
+func maskString(s, strategy string) string {
+	switch strategy {
+	case MaskHash:
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])[:16]
+	case MaskPartial:
+		runes := []rune(s)
+		if len(runes) <= 4 {
+			return maskRedacted
+		}
+		return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+	}
+
+	return maskRedacted
+}
+
+// headerValue returns the value of a request or response header, masked if it's one of `MaskedHeaders`.
+func (config LoggerConfig) headerValue(header http.Header, name string) string {
+	v := header.Get(name)
+	if v == "" {
+		return v
+	}
+
+	if _, ok := config.maskedHeaders[http.CanonicalHeaderKey(name)]; ok {
+		return maskString(v, config.MaskStrategy)
+	}
+
+	return v
+}
+
+// headersJSON returns the headers `names` as a JSON object, or `null` if there is no name.
+func (config LoggerConfig) headersJSON(header http.Header, names []string) []byte {
+	if len(names) == 0 {
+		return []byte(`null`)
+	}
+
+	values := make(map[string]interface{})
+	for _, name := range names {
+		if v := config.headerValue(header, name); v != "" {
+			values[name] = v
+		}
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return []byte(`null`)
+	}
+
+	return b
+}
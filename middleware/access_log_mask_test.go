@@ -0,0 +1,131 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskJSON(t *testing.T) {
+	rules := parseMaskRules([]string{
+		"password",
+		"user.card.number:partial",
+		"items[*].secret",
+		"tokens.*",
+		"missing.path",
+		"user.email:hash",
+	}, MaskRedact)
+
+	body := []byte(`{"password":"p","user":{"card":{"number":"4242424242424242","cvc":123},"email":"a@b.c","id":7},` +
+		`"items":[{"secret":"s1","id":1},{"secret":{"nested":true}}],"tokens":{"a":"x","b":"y"}}`)
+
+	masked, err := maskJSON(body, rules)
+	assert.NoError(t, err)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(masked, &doc))
+
+	assert.Equal(t, "****", doc["password"])
+	user := doc["user"].(map[string]interface{})
+	assert.Equal(t, "************4242", user["card"].(map[string]interface{})["number"])
+	assert.Equal(t, float64(123), user["card"].(map[string]interface{})["cvc"])
+	assert.Len(t, user["email"], 16)
+	assert.NotContains(t, string(masked), "a@b.c")
+	assert.Equal(t, float64(7), user["id"])
+
+	items := doc["items"].([]interface{})
+	assert.Equal(t, "****", items[0].(map[string]interface{})["secret"])
+	assert.Equal(t, float64(1), items[0].(map[string]interface{})["id"])
+	assert.Equal(t, "****", items[1].(map[string]interface{})["secret"])
+	assert.Equal(t, map[string]interface{}{"a": "****", "b": "****"}, doc["tokens"])
+
+	// The body is kept as it is when nothing matches.
+	masked, err = maskJSON([]byte(`{"a": 1}`), rules)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a": 1}`, string(masked))
+
+	// A top level array.
+	masked, err = maskJSON([]byte(`[{"password":"p"}]`), parseMaskRules([]string{"*.password"}, MaskRedact))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"password":"****"}]`, string(masked))
+
+	_, err = maskJSON([]byte(`not json`), rules)
+	assert.Error(t, err)
+}
+
+func TestMaskString(t *testing.T) {
+	assert.Equal(t, "****", maskString("secret", MaskRedact))
+	assert.Equal(t, "****", maskString("abc", MaskPartial))
+	assert.Equal(t, "**cret", maskString("secret", MaskPartial))
+	assert.Equal(t, maskString("secret", MaskHash), maskString("secret", MaskHash))
+	assert.NotEqual(t, maskString("secret", MaskHash), maskString("secret2", MaskHash))
+}
+
+func TestAccessLogMasking(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(LoggerConfig{
+		Output:           out,
+		BodyDump:         true,
+		MaskedParameters: []string{"password", "user.token"},
+		MaskedHeaders:    []string{"authorization", "Set-Cookie"},
+		RequestHeader:    []string{"Authorization", "X-Client"},
+		ResponseHeader:   []string{"Set-Cookie"},
+	}))
+	e.POST("/login", func(c echo.Context) error {
+		c.Response().Header().Set("Set-Cookie", "session=abcdef")
+		return c.JSON(http.StatusOK, map[string]interface{}{"user": map[string]interface{}{"token": "t0k3n", "id": 1}})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"login":"me","password":"secret"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", "Bearer xyz")
+	req.Header.Set("X-Client", "ios")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	for _, line := range lines {
+		var log map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &log), line)
+		assert.Equal(t, map[string]interface{}{"Authorization": "****", "X-Client": "ios"}, log["request_header"])
+	}
+
+	dump := lines[1]
+	assert.NotContains(t, dump, "secret")
+	assert.NotContains(t, dump, "t0k3n")
+	assert.NotContains(t, dump, "abcdef")
+	assert.Contains(t, dump, `"request_body":{"login":"me","password":"****"}`)
+	assert.Contains(t, dump, `"response_body":{"user":{"id":1,"token":"****"}}`)
+	assert.Contains(t, dump, `"response_header":{"Set-Cookie":"****"}`)
+}
@@ -0,0 +1,170 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"math/rand"
+	"runtime/metrics"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+type (
+	// AllocSamplerConfig defines the config for AllocSampler middleware.
+	AllocSamplerConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SampleRate is the ratio of the requests whose allocations are recorded, between 0 and 1.
+		// Optional. Default value 0.01.
+		SampleRate float64
+
+		// Subsystem is the prefix of the metric names.
+		// Optional. Default value "echo".
+		Subsystem string
+
+		// LogFields adds `alloc_bytes` and `alloc_objects` to the access log of the sampled requests.
+		// Optional. Default value true.
+		LogFields *bool
+
+		// Registerer holds the metrics.
+		// Optional. Default value prometheus.DefaultRegisterer.
+		Registerer prometheus.Registerer
+	}
+
+	// AllocStats is the heap allocation of a sampled request.
+	AllocStats struct {
+		Bytes   uint64
+		Objects uint64
+	}
+)
+
+const allocStatsKey = "bean.alloc.stats"
+
+// Cumulative heap allocation counters of the runtime. Unlike `runtime.ReadMemStats`, reading them
+// doesn't stop the world so it is cheap enough for the request path.
+var allocMetricNames = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+// DefaultAllocSamplerConfig is the default AllocSampler middleware config.
+var DefaultAllocSamplerConfig = AllocSamplerConfig{
+	Skipper:    middleware.DefaultSkipper,
+	SampleRate: 0.01,
+	Subsystem:  "echo",
+}
+
+// AllocSampler returns a middleware which records the heap allocation of a sample of requests.
+func AllocSampler() echo.MiddlewareFunc {
+	return AllocSamplerWithConfig(DefaultAllocSamplerConfig)
+}
+
+// AllocSamplerWithConfig returns a middleware which records the heap allocation of a sample of requests
+// as the `request_alloc_bytes` and `request_alloc_objects` histograms and the access log fields, so
+// that the endpoints whose memory use, not latency, is the problem can be found.
+// IMPORTANT: The runtime counters are process wide, so the allocations of the concurrent requests are
+// included as well. A single value is an upper bound; compare the distributions of the endpoints instead.
+func AllocSamplerWithConfig(config AllocSamplerConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultAllocSamplerConfig.Skipper
+	}
+	if config.SampleRate <= 0 {
+		config.SampleRate = DefaultAllocSamplerConfig.SampleRate
+	}
+	if config.Subsystem == "" {
+		config.Subsystem = DefaultAllocSamplerConfig.Subsystem
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	logFields := config.LogFields == nil || *config.LogFields
+
+	allocBytes := helpers.RegisterCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: config.Subsystem,
+		Name:      "request_alloc_bytes",
+		Help:      "The heap bytes allocated while serving the sampled HTTP requests.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 11), // 1KiB ~ 1GiB
+	}, []string{"code", "method", "url"}))
+
+	allocObjects := helpers.RegisterCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: config.Subsystem,
+		Name:      "request_alloc_objects",
+		Help:      "The heap objects allocated while serving the sampled HTTP requests.",
+		Buckets:   prometheus.ExponentialBuckets(16, 4, 11),
+	}, []string{"code", "method", "url"}))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || rand.Float64() >= config.SampleRate {
+				return next(c)
+			}
+
+			before := readAllocs()
+			err := next(c)
+			after := readAllocs()
+
+			stats := AllocStats{
+				Bytes:   after.Bytes - before.Bytes,
+				Objects: after.Objects - before.Objects,
+			}
+			c.Set(allocStatsKey, stats)
+
+			status := strconv.Itoa(responseStatus(c, err))
+			allocBytes.WithLabelValues(status, c.Request().Method, c.Path()).Observe(float64(stats.Bytes))
+			allocObjects.WithLabelValues(status, c.Request().Method, c.Path()).Observe(float64(stats.Objects))
+
+			if logFields {
+				SetLogField(c, "alloc_bytes", stats.Bytes)
+				SetLogField(c, "alloc_objects", stats.Objects)
+			}
+
+			return err
+		}
+	}
+}
+
+// GetAllocStats returns the heap allocation of the request if it has been sampled.
+func GetAllocStats(c echo.Context) (AllocStats, bool) {
+	stats, ok := c.Get(allocStatsKey).(AllocStats)
+	return stats, ok
+}
+
+func readAllocs() AllocStats {
+	samples := make([]metrics.Sample, len(allocMetricNames))
+	for i, name := range allocMetricNames {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	var stats AllocStats
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		stats.Bytes = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		stats.Objects = samples[1].Value.Uint64()
+	}
+
+	return stats
+}
@@ -0,0 +1,67 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var allocSink [][]byte
+
+func TestAllocSampler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	e.Use(AllocSamplerWithConfig(AllocSamplerConfig{SampleRate: 1, Registerer: registry}))
+	e.GET("/alloc", func(c echo.Context) error {
+		allocSink = append(allocSink, make([]byte, 1<<20))
+		return c.String(http.StatusOK, "ok")
+	})
+
+	var stats AllocStats
+	var fields map[string]interface{}
+	e.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			stats, _ = GetAllocStats(c)
+			fields, _ = c.Get(logFieldsKey).(map[string]interface{})
+			return err
+		}
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/alloc", nil))
+
+	assert.GreaterOrEqual(t, stats.Bytes, uint64(1<<20))
+	assert.NotZero(t, stats.Objects)
+	assert.Equal(t, stats.Bytes, fields["alloc_bytes"])
+	count, err := testutil.GatherAndCount(registry, "echo_request_alloc_bytes")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
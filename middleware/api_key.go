@@ -0,0 +1,361 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+type (
+	// APIKeyAuthConfig defines the config for APIKeyAuth middleware.
+	APIKeyAuthConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// Store finds the identity of a key.
+		// Required.
+		Store KeyStore
+
+		// KeyLookup is a comma separated list of `<source>:<name>` to extract the key from the request.
+		// The sources are `header`, `query` and `cookie`. The first non empty value is used.
+		// Optional. Default value "header:X-API-Key".
+		KeyLookup string
+
+		// Scopes are required for every request passing the middleware. Use `RequireAPIKeyScopes` for a
+		// single route.
+		// Optional. Default value [].
+		Scopes []string
+
+		// Limiter enforces the `RateLimit` of the keys.
+		// Optional. Default value an in-memory limiter of the process.
+		Limiter RateLimiter
+	}
+
+	// APIKey is the identity of a machine to machine caller.
+	APIKey struct {
+		ID     string   `json:"id"`
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+
+		// RateLimit is the maximum number of requests per minute, 0 means unlimited.
+		RateLimit int `json:"rateLimit"`
+
+		// ExpiresAt is the time after which the key is rejected, nil means never.
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+		// Quota is enforced by `EnforceAPIKeyQuota`.
+		Quota APIKeyQuota `json:"quota"`
+	}
+
+	// APIKeyQuota limits the resources a key can use beyond the rate limit. A zero value means unlimited.
+	APIKeyQuota struct {
+		// MaxBodyBytes is the maximum size of a request body.
+		MaxBodyBytes int64 `json:"maxBodyBytes"`
+
+		// MaxPageSize caps the number of rows of a response. (see `APIKeyPageSize`)
+		MaxPageSize int `json:"maxPageSize"`
+
+		// DailyBytes is the budget of request and response bytes per UTC day.
+		DailyBytes int64 `json:"dailyBytes"`
+
+		// MaxConcurrent is the maximum number of requests in progress.
+		MaxConcurrent int `json:"maxConcurrent"`
+	}
+
+	// KeyStore finds the identity of an API key. It returns `ErrAPIKeyNotFound` for an unknown key.
+	KeyStore interface {
+		Find(ctx context.Context, key string) (*APIKey, error)
+	}
+
+	// RateLimiter reports whether one more request of the key is allowed in the current window.
+	RateLimiter interface {
+		Allow(ctx context.Context, keyID string, limit int) (bool, error)
+	}
+
+	apiKeyContextKey struct{}
+)
+
+const apiKeyKey = "bean.apikey"
+
+var (
+	ErrAPIKeyMissing      = errors.New("api key is missing")
+	ErrAPIKeyNotFound     = errors.New("api key is invalid")
+	ErrAPIKeyExpired      = errors.New("api key is expired")
+	ErrAPIKeyScope        = errors.New("api key doesn't have the required scopes")
+	ErrAPIKeyRateExceeded = errors.New("api key rate limit exceeded")
+)
+
+// DefaultAPIKeyAuthConfig is the default APIKeyAuth middleware config.
+var DefaultAPIKeyAuthConfig = APIKeyAuthConfig{
+	Skipper:   middleware.DefaultSkipper,
+	KeyLookup: "header:X-API-Key",
+}
+
+// HasScope reports whether the key has the scope. The scope `*` grants everything.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// APIKeyAuth returns a middleware which authenticates the requests by the `X-API-Key` header.
+func APIKeyAuth(store KeyStore) echo.MiddlewareFunc {
+	config := DefaultAPIKeyAuthConfig
+	config.Store = store
+	return APIKeyAuthWithConfig(config)
+}
+
+// APIKeyAuthWithConfig returns a middleware which authenticates the requests by an API key from the
+// `KeyStore`, checks the scopes and the rate limit of the key and attaches the key to the echo context
+// and the request context. Use `GetAPIKey` or `APIKeyFromContext` to get it in the handlers and services.
+func APIKeyAuthWithConfig(config APIKeyAuthConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo: api key auth middleware requires a key store")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultAPIKeyAuthConfig.Skipper
+	}
+	if config.KeyLookup == "" {
+		config.KeyLookup = DefaultAPIKeyAuthConfig.KeyLookup
+	}
+	if config.Limiter == nil {
+		config.Limiter = NewMemoryRateLimiter()
+	}
+
+	extractors := apiKeyExtractors(config.KeyLookup)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			var key string
+			for _, extract := range extractors {
+				if key = extract(c); key != "" {
+					break
+				}
+			}
+			if key == "" {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrAPIKeyMissing)
+			}
+
+			ctx := c.Request().Context()
+
+			apiKey, err := config.Store.Find(ctx, key)
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, err)
+			} else if err != nil {
+				return err
+			}
+
+			if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrAPIKeyExpired)
+			}
+
+			if err := checkAPIKeyScopes(apiKey, config.Scopes); err != nil {
+				return err
+			}
+
+			if apiKey.RateLimit > 0 {
+				allowed, err := config.Limiter.Allow(ctx, apiKey.ID, apiKey.RateLimit)
+				if err != nil {
+					return err
+				}
+				if !allowed {
+					c.Response().Header().Set("Retry-After", "60")
+					return berror.NewIgnorableAPIError(http.StatusTooManyRequests, berror.TOO_MANY_REQUESTS, ErrAPIKeyRateExceeded)
+				}
+			}
+
+			c.Set(apiKeyKey, apiKey)
+			c.SetRequest(c.Request().WithContext(context.WithValue(ctx, apiKeyContextKey{}, apiKey)))
+			SetLogField(c, "api_key_id", apiKey.ID)
+
+			return next(c)
+		}
+	}
+}
+
+// RequireAPIKeyScopes returns a middleware which checks the scopes of the key authenticated by `APIKeyAuth`.
+// Example:
+//
+//	e.POST("/orders", hdlrs.orderHdlr.Create, middleware.RequireAPIKeyScopes("orders:write"))
+func RequireAPIKeyScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			apiKey, ok := GetAPIKey(c)
+			if !ok {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrAPIKeyMissing)
+			}
+
+			if err := checkAPIKeyScopes(apiKey, scopes); err != nil {
+				return err
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// GetAPIKey returns the key authenticated by `APIKeyAuth`.
+func GetAPIKey(c echo.Context) (*APIKey, bool) {
+	apiKey, ok := c.Get(apiKeyKey).(*APIKey)
+	return apiKey, ok
+}
+
+// APIKeyFromContext returns the key authenticated by `APIKeyAuth` from the request context.
+func APIKeyFromContext(ctx context.Context) (*APIKey, bool) {
+	apiKey, ok := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return apiKey, ok
+}
+
+// HashAPIKey returns the SHA-256 hex digest of a key. The SQL and redis stores only keep the digests
+// so that a leaked database doesn't leak the keys.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func checkAPIKeyScopes(apiKey *APIKey, scopes []string) error {
+	for _, scope := range scopes {
+		if !apiKey.HasScope(scope) {
+			return berror.NewIgnorableAPIError(http.StatusForbidden, berror.UNAUTHORIZED_ACCESS, ErrAPIKeyScope)
+		}
+	}
+
+	return nil
+}
+
+func apiKeyExtractors(lookup string) []func(c echo.Context) string {
+	var extractors []func(c echo.Context) string
+
+	for _, source := range strings.Split(lookup, ",") {
+		parts := strings.SplitN(strings.TrimSpace(source), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		name := parts[1]
+		switch parts[0] {
+		case "header":
+			extractors = append(extractors, func(c echo.Context) string {
+				return c.Request().Header.Get(name)
+			})
+		case "query":
+			extractors = append(extractors, func(c echo.Context) string {
+				return c.QueryParam(name)
+			})
+		case "cookie":
+			extractors = append(extractors, func(c echo.Context) string {
+				cookie, err := c.Cookie(name)
+				if err != nil {
+					return ""
+				}
+				return cookie.Value
+			})
+		}
+	}
+
+	return extractors
+}
+
+// StaticKeyStore is a `KeyStore` of a fixed set of keys. (example: from env.json)
+type StaticKeyStore struct {
+	keys map[string]*APIKey
+}
+
+// NewStaticKeyStore returns a store of `keys` mapping the plain keys to their identity.
+func NewStaticKeyStore(keys map[string]APIKey) *StaticKeyStore {
+	s := &StaticKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for key, apiKey := range keys {
+		apiKey := apiKey
+		s.keys[HashAPIKey(key)] = &apiKey
+	}
+
+	return s
+}
+
+// Find implements `KeyStore`.
+func (s *StaticKeyStore) Find(ctx context.Context, key string) (*APIKey, error) {
+	apiKey, ok := s.keys[HashAPIKey(key)]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return apiKey, nil
+}
+
+// MemoryRateLimiter is a fixed window `RateLimiter` of one minute in the memory of the process.
+// Use `RedisRateLimiter` to share the limit between the replicas.
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	now     func() time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewMemoryRateLimiter returns a new in-memory rate limiter.
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{windows: make(map[string]*rateWindow), now: time.Now}
+}
+
+// Allow implements `RateLimiter`.
+func (l *MemoryRateLimiter) Allow(ctx context.Context, keyID string, limit int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := l.now().Truncate(time.Minute)
+
+	w, ok := l.windows[keyID]
+	if !ok || !w.start.Equal(start) {
+		w = &rateWindow{start: start}
+		l.windows[keyID] = w
+	}
+
+	if w.count >= limit {
+		return false, nil
+	}
+	w.count++
+
+	return true, nil
+}
@@ -0,0 +1,330 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+type (
+	// APIKeyQuotaConfig defines the config for EnforceAPIKeyQuota middleware.
+	APIKeyQuotaConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// Tracker counts the concurrent requests and the daily bytes of the keys.
+		// Optional. Default value an in-memory tracker of the process.
+		Tracker QuotaTracker
+	}
+
+	// QuotaTracker counts the usage of the keys for `EnforceAPIKeyQuota`.
+	QuotaTracker interface {
+		// AcquireSlot increments the requests in progress of the key and returns the count including this one.
+		AcquireSlot(ctx context.Context, keyID string) (int64, error)
+
+		// ReleaseSlot decrements the requests in progress of the key.
+		ReleaseSlot(ctx context.Context, keyID string) error
+
+		// AddBytes adds `n` bytes to the usage of the current UTC day and returns the total.
+		AddBytes(ctx context.Context, keyID string, n int64) (int64, error)
+	}
+)
+
+var (
+	ErrAPIKeyBodyTooLarge     = errors.New("api key request body quota exceeded")
+	ErrAPIKeyDailyBytes       = errors.New("api key daily bytes quota exceeded")
+	ErrAPIKeyConcurrencyQuota = errors.New("api key concurrent requests quota exceeded")
+)
+
+// EnforceAPIKeyQuota returns a middleware which enforces the `APIKeyQuota` of the key authenticated by `APIKeyAuth`
+// and reports the limits and the remaining usage in the `X-Quota-*` response headers.
+// The daily bytes are checked before the request and counted after it, so the last request of the day may
+// exceed the budget by its own size.
+// Example:
+//
+//	g := e.Group("/partner", middleware.APIKeyAuth(store), middleware.EnforceAPIKeyQuota(middleware.APIKeyQuotaConfig{
+//		Tracker: middleware.NewRedisQuotaTracker(client, ""),
+//	}))
+func EnforceAPIKeyQuota(config APIKeyQuotaConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Tracker == nil {
+		config.Tracker = NewMemoryQuotaTracker()
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			apiKey, ok := GetAPIKey(c)
+			if !ok {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrAPIKeyMissing)
+			}
+
+			quota := apiKey.Quota
+			ctx := c.Request().Context()
+			header := c.Response().Header()
+
+			if quota.MaxPageSize > 0 {
+				header.Set("X-Quota-Max-Page-Size", strconv.Itoa(quota.MaxPageSize))
+			}
+
+			if quota.MaxBodyBytes > 0 {
+				header.Set("X-Quota-Max-Body-Bytes", strconv.FormatInt(quota.MaxBodyBytes, 10))
+				if c.Request().ContentLength > quota.MaxBodyBytes {
+					return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrAPIKeyBodyTooLarge)
+				}
+			}
+
+			if quota.MaxConcurrent > 0 {
+				inFlight, err := config.Tracker.AcquireSlot(ctx, apiKey.ID)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if err := config.Tracker.ReleaseSlot(context.Background(), apiKey.ID); err != nil {
+						c.Logger().Error(err)
+					}
+				}()
+
+				header.Set("X-Quota-Concurrency-Limit", strconv.Itoa(quota.MaxConcurrent))
+				if inFlight > int64(quota.MaxConcurrent) {
+					header.Set("X-Quota-Concurrency-Remaining", "0")
+					return berror.NewIgnorableAPIError(http.StatusTooManyRequests, berror.TOO_MANY_REQUESTS, ErrAPIKeyConcurrencyQuota)
+				}
+				header.Set("X-Quota-Concurrency-Remaining", strconv.FormatInt(int64(quota.MaxConcurrent)-inFlight, 10))
+			}
+
+			if quota.DailyBytes > 0 {
+				used, err := config.Tracker.AddBytes(ctx, apiKey.ID, 0)
+				if err != nil {
+					return err
+				}
+
+				header.Set("X-Quota-Daily-Bytes-Limit", strconv.FormatInt(quota.DailyBytes, 10))
+				header.Set("X-Quota-Daily-Bytes-Remaining", strconv.FormatInt(max64(quota.DailyBytes-used, 0), 10))
+				if used >= quota.DailyBytes {
+					return berror.NewIgnorableAPIError(http.StatusTooManyRequests, berror.TOO_MANY_REQUESTS, ErrAPIKeyDailyBytes)
+				}
+			}
+
+			body := &quotaBody{ReadCloser: c.Request().Body, limit: quota.MaxBodyBytes}
+			c.Request().Body = body
+
+			err := next(c)
+
+			if quota.DailyBytes > 0 {
+				// The handler may not read the whole body.
+				reqBytes := max64(body.n, c.Request().ContentLength)
+				if _, err := config.Tracker.AddBytes(context.Background(), apiKey.ID, reqBytes+c.Response().Size); err != nil {
+					c.Logger().Error(err)
+				}
+			}
+
+			if errors.Is(err, ErrAPIKeyBodyTooLarge) {
+				return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrAPIKeyBodyTooLarge)
+			}
+
+			return err
+		}
+	}
+}
+
+// APIKeyPageSize caps a requested page size by the `MaxPageSize` of the key authenticated by `APIKeyAuth`.
+// Example:
+//
+//	limit := middleware.APIKeyPageSize(c, params.Limit)
+//	err := db.Limit(limit).Offset(params.Offset).Find(&orders).Error
+func APIKeyPageSize(c echo.Context, requested int) int {
+	apiKey, ok := GetAPIKey(c)
+	if !ok || apiKey.Quota.MaxPageSize <= 0 {
+		return requested
+	}
+
+	if requested <= 0 || requested > apiKey.Quota.MaxPageSize {
+		return apiKey.Quota.MaxPageSize
+	}
+
+	return requested
+}
+
+// quotaBody counts the bytes of a request body and fails when it exceeds the limit, for the requests
+// without a `Content-Length`.
+type quotaBody struct {
+	io.ReadCloser
+	limit int64
+	n     int64
+}
+
+func (b *quotaBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	if b.limit > 0 && b.n > b.limit {
+		return n, ErrAPIKeyBodyTooLarge
+	}
+
+	return n, err
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// MemoryQuotaTracker is a `QuotaTracker` in the memory of the process.
+// Use `RedisQuotaTracker` to share the quotas between the replicas.
+type MemoryQuotaTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]int64
+	bytes    map[string]int64
+	day      string
+	now      func() time.Time
+}
+
+// NewMemoryQuotaTracker returns a new in-memory quota tracker.
+func NewMemoryQuotaTracker() *MemoryQuotaTracker {
+	return &MemoryQuotaTracker{
+		inFlight: make(map[string]int64),
+		bytes:    make(map[string]int64),
+		now:      time.Now,
+	}
+}
+
+// AcquireSlot implements `QuotaTracker`.
+func (t *MemoryQuotaTracker) AcquireSlot(ctx context.Context, keyID string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight[keyID]++
+
+	return t.inFlight[keyID], nil
+}
+
+// ReleaseSlot implements `QuotaTracker`.
+func (t *MemoryQuotaTracker) ReleaseSlot(ctx context.Context, keyID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inFlight[keyID]--; t.inFlight[keyID] <= 0 {
+		delete(t.inFlight, keyID)
+	}
+
+	return nil
+}
+
+// AddBytes implements `QuotaTracker`.
+func (t *MemoryQuotaTracker) AddBytes(ctx context.Context, keyID string, n int64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Reset the usage of all the keys when the UTC day changes.
+	if day := quotaDay(t.now()); day != t.day {
+		t.day = day
+		t.bytes = make(map[string]int64)
+	}
+
+	t.bytes[keyID] += n
+
+	return t.bytes[keyID], nil
+}
+
+// RedisQuotaTracker is a `QuotaTracker` shared by all the replicas.
+type RedisQuotaTracker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisQuotaTracker returns a quota tracker storing the counters under `prefix`, "apikey:quota:" if
+// `prefix` is empty.
+func NewRedisQuotaTracker(client redis.UniversalClient, prefix string) *RedisQuotaTracker {
+	if prefix == "" {
+		prefix = "apikey:quota:"
+	}
+
+	return &RedisQuotaTracker{client: client, prefix: prefix}
+}
+
+// AcquireSlot implements `QuotaTracker`. The counter expires after 10 minutes without any request so that
+// the slots of a crashed process are not leaked forever.
+func (t *RedisQuotaTracker) AcquireSlot(ctx context.Context, keyID string) (int64, error) {
+	key := t.prefix + "conc:" + keyID
+
+	pipe := t.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 10*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// Decrement the counter only if it's still positive, it may have expired during a long request.
+var releaseSlotScript = redis.NewScript(`
+local v = tonumber(redis.call('GET', KEYS[1]))
+if v and v > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// ReleaseSlot implements `QuotaTracker`.
+func (t *RedisQuotaTracker) ReleaseSlot(ctx context.Context, keyID string) error {
+	return releaseSlotScript.Run(ctx, t.client, []string{t.prefix + "conc:" + keyID}).Err()
+}
+
+// AddBytes implements `QuotaTracker`.
+func (t *RedisQuotaTracker) AddBytes(ctx context.Context, keyID string, n int64) (int64, error) {
+	key := t.prefix + "bytes:" + keyID + ":" + quotaDay(time.Now())
+
+	pipe := t.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, n)
+	pipe.Expire(ctx, key, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func quotaDay(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
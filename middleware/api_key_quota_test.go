@@ -0,0 +1,127 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceAPIKeyQuota(t *testing.T) {
+	store := NewStaticKeyStore(map[string]APIKey{
+		"partner": {ID: "1", Quota: APIKeyQuota{MaxBodyBytes: 8, MaxPageSize: 50, DailyBytes: 10}},
+	})
+	tracker := NewMemoryQuotaTracker()
+
+	e := echo.New()
+	mw := APIKeyAuth(store)
+	quota := EnforceAPIKeyQuota(APIKeyQuotaConfig{Tracker: tracker})
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}
+
+	serve := func(body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "partner")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		return rec, mw(quota(func(c echo.Context) error {
+			assert.Equal(t, 50, APIKeyPageSize(c, 0))
+			assert.Equal(t, 20, APIKeyPageSize(c, 20))
+			assert.Equal(t, 50, APIKeyPageSize(c, 1000))
+			return handler(c)
+		}))(c)
+	}
+
+	_, err := serve("too large body")
+	if apiErr, ok := err.(*berror.APIError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.HTTPStatusCode)
+	}
+
+	rec, err := serve("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", rec.Header().Get("X-Quota-Daily-Bytes-Limit"))
+	assert.Equal(t, "10", rec.Header().Get("X-Quota-Daily-Bytes-Remaining"))
+	assert.Equal(t, "50", rec.Header().Get("X-Quota-Max-Page-Size"))
+
+	// 4 bytes of the request and 2 bytes of the response have been counted.
+	rec, err = serve("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "4", rec.Header().Get("X-Quota-Daily-Bytes-Remaining"))
+
+	_, err = serve("1234")
+	if apiErr, ok := err.(*berror.APIError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusTooManyRequests, apiErr.HTTPStatusCode)
+	}
+}
+
+func TestMemoryQuotaTrackerSlots(t *testing.T) {
+	tracker := NewMemoryQuotaTracker()
+
+	n, _ := tracker.AcquireSlot(context.Background(), "1")
+	assert.Equal(t, int64(1), n)
+	n, _ = tracker.AcquireSlot(context.Background(), "1")
+	assert.Equal(t, int64(2), n)
+
+	assert.NoError(t, tracker.ReleaseSlot(context.Background(), "1"))
+	assert.NoError(t, tracker.ReleaseSlot(context.Background(), "1"))
+	n, _ = tracker.AcquireSlot(context.Background(), "1")
+	assert.Equal(t, int64(1), n)
+}
+
+func TestRedisQuotaTrackerSlots(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewRedisQuotaTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "")
+	c := context.Background()
+
+	n, _ := tracker.AcquireSlot(c, "1")
+	assert.Equal(t, int64(1), n)
+	n, _ = tracker.AcquireSlot(c, "1")
+	assert.Equal(t, int64(2), n)
+
+	assert.NoError(t, tracker.ReleaseSlot(c, "1"))
+	assert.NoError(t, tracker.ReleaseSlot(c, "1"))
+	assert.NoError(t, tracker.ReleaseSlot(c, "1"))
+	v, _ := mr.Get("apikey:quota:conc:1")
+	assert.Equal(t, "0", v)
+
+	// The release of a slot acquired before the counter expired doesn't go negative.
+	tracker.AcquireSlot(c, "1")
+	mr.FastForward(10 * time.Minute)
+	assert.NoError(t, tracker.ReleaseSlot(c, "1"))
+	assert.False(t, mr.Exists("apikey:quota:conc:1"))
+
+	n, _ = tracker.AcquireSlot(c, "1")
+	assert.Equal(t, int64(1), n)
+}
@@ -0,0 +1,191 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// SQLKeyStore is a `KeyStore` of a MySQL table which holds the SHA-256 digests of the keys. (see `HashAPIKey`)
+//
+//	CREATE TABLE api_keys (
+//	    id          VARCHAR(64)  NOT NULL PRIMARY KEY,
+//	    name        VARCHAR(255) NOT NULL,
+//	    key_hash    CHAR(64)     NOT NULL UNIQUE,
+//	    scopes      TEXT         NOT NULL, -- comma separated
+//	    rate_limit  INT          NOT NULL DEFAULT 0,
+//	    expires_at  DATETIME     NULL,
+//	    revoked     TINYINT(1)   NOT NULL DEFAULT 0,
+//	    -- Optional quota columns, see `APIKeyQuota`.
+//	    max_body_bytes BIGINT    NOT NULL DEFAULT 0,
+//	    max_page_size  INT       NOT NULL DEFAULT 0,
+//	    daily_bytes    BIGINT    NOT NULL DEFAULT 0,
+//	    max_concurrent INT       NOT NULL DEFAULT 0
+//	);
+type SQLKeyStore struct {
+	db    *gorm.DB
+	table string
+}
+
+type sqlAPIKey struct {
+	ID        string
+	Name      string
+	KeyHash   string
+	Scopes    string
+	RateLimit int
+	ExpiresAt *time.Time
+	Revoked   bool
+
+	MaxBodyBytes  int64
+	MaxPageSize   int
+	DailyBytes    int64
+	MaxConcurrent int
+}
+
+// NewSQLKeyStore returns a store of the table, "api_keys" if `table` is empty.
+func NewSQLKeyStore(db *gorm.DB, table string) *SQLKeyStore {
+	if table == "" {
+		table = "api_keys"
+	}
+
+	return &SQLKeyStore{db: db, table: table}
+}
+
+// Find implements `KeyStore`.
+func (s *SQLKeyStore) Find(ctx context.Context, key string) (*APIKey, error) {
+	var row sqlAPIKey
+
+	err := s.db.WithContext(ctx).Table(s.table).Where("key_hash = ? AND revoked = ?", HashAPIKey(key), false).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	apiKey := &APIKey{
+		ID:        row.ID,
+		Name:      row.Name,
+		RateLimit: row.RateLimit,
+		ExpiresAt: row.ExpiresAt,
+		Quota: APIKeyQuota{
+			MaxBodyBytes:  row.MaxBodyBytes,
+			MaxPageSize:   row.MaxPageSize,
+			DailyBytes:    row.DailyBytes,
+			MaxConcurrent: row.MaxConcurrent,
+		},
+	}
+	for _, scope := range strings.Split(row.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			apiKey.Scopes = append(apiKey.Scopes, scope)
+		}
+	}
+
+	return apiKey, nil
+}
+
+// RedisKeyStore is a `KeyStore` of the JSON encoded `APIKey` values stored in redis under
+// `<prefix><SHA-256 digest of the key>`.
+type RedisKeyStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisKeyStore returns a store of the keys under `prefix`, "apikey:" if `prefix` is empty.
+func NewRedisKeyStore(client redis.UniversalClient, prefix string) *RedisKeyStore {
+	if prefix == "" {
+		prefix = "apikey:"
+	}
+
+	return &RedisKeyStore{client: client, prefix: prefix}
+}
+
+// Find implements `KeyStore`.
+func (s *RedisKeyStore) Find(ctx context.Context, key string) (*APIKey, error) {
+	data, err := s.client.Get(ctx, s.prefix+HashAPIKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var apiKey APIKey
+	if err := json.Unmarshal(data, &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// Save stores the identity of a key.
+func (s *RedisKeyStore) Save(ctx context.Context, key string, apiKey APIKey) error {
+	data, err := json.Marshal(apiKey)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if apiKey.ExpiresAt != nil {
+		ttl = time.Until(*apiKey.ExpiresAt)
+	}
+
+	return s.client.Set(ctx, s.prefix+HashAPIKey(key), data, ttl).Err()
+}
+
+// RedisRateLimiter is a fixed window `RateLimiter` of one minute shared by all the replicas.
+type RedisRateLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisRateLimiter returns a rate limiter storing the counters under `prefix`, "apikey:rate:" if
+// `prefix` is empty.
+func NewRedisRateLimiter(client redis.UniversalClient, prefix string) *RedisRateLimiter {
+	if prefix == "" {
+		prefix = "apikey:rate:"
+	}
+
+	return &RedisRateLimiter{client: client, prefix: prefix}
+}
+
+// Allow implements `RateLimiter`.
+func (l *RedisRateLimiter) Allow(ctx context.Context, keyID string, limit int) (bool, error) {
+	window := time.Now().Truncate(time.Minute).Unix()
+	key := l.prefix + keyID + ":" + strconv.FormatInt(window, 10)
+
+	pipe := l.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	return incr.Val() <= int64(limit), nil
+}
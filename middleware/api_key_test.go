@@ -0,0 +1,106 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	store := NewStaticKeyStore(map[string]APIKey{
+		"reader":  {ID: "1", Scopes: []string{"orders:read"}},
+		"limited": {ID: "2", Scopes: []string{"*"}, RateLimit: 1},
+		"expired": {ID: "3", ExpiresAt: &expired},
+	})
+
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		apiKey, _ := APIKeyFromContext(c.Request().Context())
+		return c.String(http.StatusOK, apiKey.ID)
+	}
+	mw := APIKeyAuthWithConfig(APIKeyAuthConfig{Store: store, KeyLookup: "header:X-API-Key,query:api_key"})
+
+	tests := []struct {
+		name   string
+		target string
+		key    string
+		scopes []string
+		status int
+	}{
+		{name: "missing", target: "/", status: http.StatusUnauthorized},
+		{name: "unknown", target: "/", key: "unknown", status: http.StatusUnauthorized},
+		{name: "expired", target: "/", key: "expired", status: http.StatusUnauthorized},
+		{name: "header", target: "/", key: "reader", scopes: []string{"orders:read"}, status: http.StatusOK},
+		{name: "query", target: "/?api_key=reader", status: http.StatusOK},
+		{name: "scope", target: "/", key: "reader", scopes: []string{"orders:write"}, status: http.StatusForbidden},
+		{name: "wildcard scope", target: "/", key: "limited", scopes: []string{"orders:write"}, status: http.StatusOK},
+		{name: "rate limit", target: "/", key: "limited", status: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := mw(RequireAPIKeyScopes(tt.scopes...)(handler))(c)
+
+			status := rec.Code
+			if apiErr, ok := err.(*berror.APIError); ok {
+				status = apiErr.HTTPStatusCode
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewMemoryRateLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := l.Allow(context.Background(), "1", 2)
+		assert.True(t, allowed)
+	}
+	allowed, _ := l.Allow(context.Background(), "1", 2)
+	assert.False(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, _ = l.Allow(context.Background(), "1", 2)
+	assert.True(t, allowed)
+}
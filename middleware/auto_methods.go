@@ -0,0 +1,177 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	broute "github.com/retail-ai-inc/bean/route"
+)
+
+// AutoMethodsConfig defines the config for AutoMethods middleware.
+type AutoMethodsConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Options answers the `OPTIONS` requests with the `Allow` header of the route table.
+	// Optional. Default value false.
+	Options bool
+
+	// Head answers the `HEAD` requests by the `GET` handler of the route without the body.
+	// Optional. Default value false.
+	Head bool
+
+	// Groups overrides `Options` and `Head` for the routes under a path prefix, like "/api". The longest
+	// matching prefix wins.
+	// Optional. Default value nil.
+	Groups map[string]AutoMethodsGroup
+}
+
+// AutoMethodsGroup is the `OPTIONS` and `HEAD` handling of a route group.
+type AutoMethodsGroup struct {
+	Options bool
+	Head    bool
+}
+
+// AutoMethods returns a pre-routing middleware which handles the `OPTIONS` and `HEAD` requests of the
+// routes which don't register these methods explicitly, instead of replying `405 Method Not Allowed`.
+// The CORS preflight requests are left to the CORS middleware.
+// IMPORTANT: It uses the route table of `route.Init`, so it must be registered by `e.Pre()`.
+func AutoMethods(config AutoMethodsConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if (req.Method != http.MethodOptions && req.Method != http.MethodHead) || config.Skipper(c) {
+				return next(c)
+			}
+
+			group := config.group(req.URL.Path)
+			methods := RouteMethods(req.URL.Path)
+			if len(methods) == 0 || containsMethod(methods, req.Method) {
+				return next(c)
+			}
+
+			switch req.Method {
+			case http.MethodOptions:
+				if !group.Options || req.Header.Get(echo.HeaderAccessControlRequestMethod) != "" {
+					return next(c)
+				}
+
+				c.Response().Header().Set(echo.HeaderAllow, strings.Join(allowHeader(methods, group), ", "))
+				return c.NoContent(http.StatusNoContent)
+
+			default:
+				if !group.Head || !containsMethod(methods, http.MethodGet) {
+					return next(c)
+				}
+
+				// IMPORTANT: echo routes the original request, so the method has to be changed in place.
+				// It's restored for the `http.Server` to finish the response as `HEAD`.
+				req.Method = http.MethodGet
+				defer func() { req.Method = http.MethodHead }()
+				c.Response().Writer = &headWriter{ResponseWriter: c.Response().Writer}
+
+				return next(c)
+			}
+		}
+	}
+}
+
+// RouteMethods returns the sorted methods of the registered routes matching the path, among the methods
+// of `http.allowedMethod` in `env.json`.
+func RouteMethods(path string) []string {
+	allowedMethod := sortedAllowedMethod()
+
+	var methods []string
+	for _, r := range broute.Routes {
+		// IMPORTANT - Just ignore unnecessary system route
+		if strings.Contains(r.Name, "glob..func1") {
+			continue
+		}
+
+		i := sort.SearchStrings(allowedMethod, r.Method)
+		if i >= len(allowedMethod) || allowedMethod[i] != r.Method {
+			continue
+		}
+
+		if _, ok := r.PathSegment.Match(path); ok && !containsMethod(methods, r.Method) {
+			methods = append(methods, r.Method)
+		}
+	}
+	sort.Strings(methods)
+
+	return methods
+}
+
+func (config AutoMethodsConfig) group(path string) AutoMethodsGroup {
+	group := AutoMethodsGroup{Options: config.Options, Head: config.Head}
+
+	longest := -1
+	for prefix, g := range config.Groups {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			group, longest = g, len(prefix)
+		}
+	}
+
+	return group
+}
+
+func allowHeader(methods []string, group AutoMethodsGroup) []string {
+	allow := append([]string{}, methods...)
+	if group.Head && containsMethod(methods, http.MethodGet) && !containsMethod(methods, http.MethodHead) {
+		allow = append(allow, http.MethodHead)
+	}
+	if !containsMethod(methods, http.MethodOptions) {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+
+	return allow
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headWriter drops the body of a `GET` handler answering a `HEAD` request.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
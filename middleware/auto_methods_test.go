@@ -0,0 +1,80 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	broute "github.com/retail-ai-inc/bean/route"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMethods(t *testing.T) {
+	viper.Set("http.allowedMethod", []string{"DELETE", "GET", "POST", "PUT"})
+
+	e := echo.New()
+	e.Pre(AutoMethods(AutoMethodsConfig{
+		Options: true,
+		Head:    true,
+		Groups:  map[string]AutoMethodsGroup{"/internal": {Options: true}},
+	}))
+	e.GET("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().Method+" "+c.Param("id"))
+	})
+	e.DELETE("/users/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.GET("/internal/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	broute.Init(e)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodOptions, "/users/1")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", rec.Header().Get(echo.HeaderAllow))
+
+	rec = serve(http.MethodHead, "/users/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Empty(t, rec.Body.String())
+
+	// The group doesn't answer HEAD.
+	rec = serve(http.MethodOptions, "/internal/health")
+	assert.Equal(t, "GET, OPTIONS", rec.Header().Get(echo.HeaderAllow))
+	rec = serve(http.MethodHead, "/internal/health")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// Unknown routes are left to the router.
+	rec = serve(http.MethodOptions, "/unknown")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,158 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// BasePathContextKey is the key of the base path of the request in the echo context.
+const BasePathContextKey = "basePath"
+
+// BasePathConfig defines the config for BasePath middleware.
+type BasePathConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Prefix the service is mounted under by the ingress, like "/api/catalog".
+	// Required.
+	Prefix string
+
+	// Rewritten is true if the proxy strips the prefix before forwarding the requests, then the paths
+	// without the prefix are served as is. Otherwise they are `404 Not Found`.
+	// Optional. Default value false.
+	Rewritten bool
+
+	// Unprefixed are the paths also served without the prefix, like the metrics endpoint scraped from
+	// the pod directly.
+	// Optional. Default value nil.
+	Unprefixed []string
+}
+
+// BasePath returns a pre-routing middleware which serves the routes under `Prefix`, so that the routes
+// are registered without it. The prefix is stripped from the request path before the routing and
+// added back to the `Location` header of the redirects, use `BasePathURL` for the other URLs sent to
+// the client. (example: the asset URLs of the templates)
+// IMPORTANT: It must be registered by `e.Pre()`.
+func BasePath(config BasePathConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	prefix := NormalizeBasePath(config.Prefix)
+
+	unprefixed := make(map[string]bool, len(config.Unprefixed))
+	for _, path := range config.Unprefixed {
+		unprefixed[path] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if prefix == "" {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			path, ok := stripBasePath(prefix, req.URL.Path)
+			if !ok && !config.Rewritten && !unprefixed[req.URL.Path] {
+				return echo.ErrNotFound
+			}
+			if ok {
+				req.URL.Path = path
+				if req.URL.RawPath != "" {
+					req.URL.RawPath, _ = stripBasePath(prefix, req.URL.RawPath)
+				}
+			}
+
+			c.Set(BasePathContextKey, prefix)
+
+			res := c.Response()
+			res.Before(func() {
+				if location := res.Header().Get(echo.HeaderLocation); location != "" {
+					res.Header().Set(echo.HeaderLocation, JoinBasePath(prefix, location))
+				}
+			})
+
+			return next(c)
+		}
+	}
+}
+
+// BasePathURL returns `path` under the base path of the request, `path` is returned as is if the
+// request is not served by `BasePath`.
+func BasePathURL(c echo.Context, path string) string {
+	prefix, _ := c.Get(BasePathContextKey).(string)
+	return JoinBasePath(prefix, path)
+}
+
+// JoinBasePath returns the absolute `path` under `prefix`. The URLs with a scheme or a host, the
+// relative paths and the paths already under `prefix` are returned as is.
+func JoinBasePath(prefix, path string) string {
+	prefix = NormalizeBasePath(prefix)
+	if prefix == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return path
+	}
+
+	// The query and the fragment are kept as is.
+	p := path
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	if _, ok := stripBasePath(prefix, p); ok {
+		return path
+	}
+	if p == "/" {
+		return prefix + path[1:]
+	}
+
+	return prefix + path
+}
+
+// NormalizeBasePath returns the base path with a leading slash and without a trailing one, "" for the
+// root.
+func NormalizeBasePath(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return "/" + prefix
+}
+
+// stripBasePath returns `path` without `prefix`, false if it's not under `prefix`.
+func stripBasePath(prefix, path string) (string, bool) {
+	if path == prefix {
+		return "/", true
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):], true
+	}
+
+	return path, false
+}
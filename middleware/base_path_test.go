@@ -0,0 +1,93 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePath(t *testing.T) {
+	newEcho := func(config BasePathConfig) *echo.Echo {
+		e := echo.New()
+		e.Pre(BasePath(config))
+		e.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, BasePathURL(c, "/static/app.css")) })
+		e.GET("/products/:id", func(c echo.Context) error { return c.String(http.StatusOK, c.Param("id")) })
+		e.GET("/old", func(c echo.Context) error { return c.Redirect(http.StatusMovedPermanently, "/products/1?ref=old") })
+		e.GET("/metrics", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		return e
+	}
+	serve := func(e *echo.Echo, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	e := newEcho(BasePathConfig{Prefix: "api/catalog/", Unprefixed: []string{"/metrics"}})
+
+	rec := serve(e, "/api/catalog/products/42")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "42", rec.Body.String())
+
+	rec = serve(e, "/api/catalog")
+	assert.Equal(t, "/api/catalog/static/app.css", rec.Body.String())
+
+	rec = serve(e, "/api/catalog/old")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/api/catalog/products/1?ref=old", rec.Header().Get(echo.HeaderLocation))
+
+	assert.Equal(t, http.StatusNotFound, serve(e, "/products/42").Code)
+	assert.Equal(t, http.StatusNotFound, serve(e, "/api/catalogue/products/42").Code)
+	assert.Equal(t, http.StatusOK, serve(e, "/metrics").Code)
+	assert.Equal(t, http.StatusOK, serve(e, "/api/catalog/metrics").Code)
+
+	// Behind a rewriting proxy the requests come without the prefix.
+	e = newEcho(BasePathConfig{Prefix: "/api/catalog", Rewritten: true})
+	assert.Equal(t, "42", serve(e, "/products/42").Body.String())
+	assert.Equal(t, "/api/catalog/products/1?ref=old", serve(e, "/old").Header().Get(echo.HeaderLocation))
+}
+
+func TestJoinBasePath(t *testing.T) {
+	tests := []struct {
+		prefix, path, want string
+	}{
+		{"/api", "/products", "/api/products"},
+		{"/api", "/", "/api"},
+		{"/api", "/?page=2", "/api?page=2"},
+		{"/api", "/api/products", "/api/products"},
+		{"/api", "/api?x=1", "/api?x=1"},
+		{"/api", "/apis", "/api/apis"},
+		{"/api", "products", "products"},
+		{"/api", "//cdn.example.com/app.js", "//cdn.example.com/app.js"},
+		{"/api", "https://example.com/", "https://example.com/"},
+		{"", "/products", "/products"},
+		{"/", "/products", "/products"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, JoinBasePath(tt.prefix, tt.path), tt.prefix+" "+tt.path)
+	}
+}
@@ -0,0 +1,107 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBreadcrumbs is the number of the latest breadcrumbs kept for the access log of a request.
+const maxBreadcrumbs = 50
+
+const breadcrumbsKey = "bean.breadcrumbs"
+
+// Breadcrumb is a business step of a request, like `cart: coupon applied`.
+type Breadcrumb struct {
+	Time     time.Time              `json:"time"`
+	Category string                 `json:"category"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+type breadcrumbs struct {
+	mu    sync.Mutex
+	items []Breadcrumb
+}
+
+// AddBreadcrumb records a business step of the current request. It's sent to the sentry hub of the
+// request if sentry is on, otherwise it's kept in the request and written to the `breadcrumbs` field
+// of the access log if the request fails with a 5xx status. It's safe to call from the goroutines of
+// the handler.
+func AddBreadcrumb(c echo.Context, category, message string, data map[string]interface{}) {
+	if c == nil {
+		return
+	}
+
+	if hub := sentryecho.GetHubFromContext(c); hub != nil {
+		hub.AddBreadcrumb(&sentry.Breadcrumb{
+			Category:  category,
+			Message:   message,
+			Data:      data,
+			Level:     sentry.LevelInfo,
+			Timestamp: time.Now(),
+		}, nil)
+		return
+	}
+
+	b, _ := c.Get(breadcrumbsKey).(*breadcrumbs)
+	if b == nil {
+		b = &breadcrumbs{}
+		c.Set(breadcrumbsKey, b)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) == maxBreadcrumbs {
+		b.items = append(b.items[:0], b.items[1:]...)
+	}
+	b.items = append(b.items, Breadcrumb{Time: time.Now(), Category: category, Message: message, Data: data})
+}
+
+// Breadcrumbs returns the breadcrumbs kept in the current request, the oldest first.
+func Breadcrumbs(c echo.Context) []Breadcrumb {
+	b, _ := c.Get(breadcrumbsKey).(*breadcrumbs)
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Breadcrumb(nil), b.items...)
+}
+
+// failedBreadcrumbs returns the breadcrumbs of the current request if it failed with a 5xx status.
+func failedBreadcrumbs(c echo.Context) []Breadcrumb {
+	if c.Response().Status < http.StatusInternalServerError {
+		return nil
+	}
+	return Breadcrumbs(c)
+}
@@ -0,0 +1,155 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveBreadcrumbs(t *testing.T, config LoggerConfig, status int) []string {
+	t.Helper()
+
+	out := new(bytes.Buffer)
+	config.Output = out
+
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(config))
+	e.GET("/checkout", func(c echo.Context) error {
+		AddBreadcrumb(c, "cart", "loaded", map[string]interface{}{"items": 2})
+		AddBreadcrumb(c, "payment", "authorized", nil)
+		if status >= http.StatusBadRequest {
+			return echo.NewHTTPError(status, "failed")
+		}
+		return c.NoContent(status)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checkout", nil))
+	assert.Equal(t, status, rec.Code)
+
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func TestBreadcrumbsInAccessLog(t *testing.T) {
+	lines := serveBreadcrumbs(t, LoggerConfig{}, http.StatusInternalServerError)
+	require.Len(t, lines, 2)
+
+	var log struct {
+		Status int
+		Fields struct {
+			Breadcrumbs []Breadcrumb
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &log))
+	assert.Equal(t, http.StatusInternalServerError, log.Status)
+	require.Len(t, log.Fields.Breadcrumbs, 2)
+	assert.Equal(t, "cart", log.Fields.Breadcrumbs[0].Category)
+	assert.Equal(t, "loaded", log.Fields.Breadcrumbs[0].Message)
+	assert.Equal(t, float64(2), log.Fields.Breadcrumbs[0].Data["items"])
+	assert.Equal(t, "authorized", log.Fields.Breadcrumbs[1].Message)
+
+	// A successful or client failed request doesn't write them.
+	assert.Len(t, serveBreadcrumbs(t, LoggerConfig{}, http.StatusOK), 1)
+	assert.Len(t, serveBreadcrumbs(t, LoggerConfig{}, http.StatusNotFound), 1)
+
+	lines = serveBreadcrumbs(t, LoggerConfig{Format: AccessLogFormatJSON}, http.StatusBadGateway)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"breadcrumbs":[{`)
+}
+
+func TestAccessLogReturnsHandlerError(t *testing.T) {
+	handlerErr := echo.NewHTTPError(http.StatusInternalServerError, "failed")
+
+	var got error
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			got = next(c)
+			return got
+		}
+	})
+	e.Use(AccessLoggerWithConfig(LoggerConfig{Output: new(bytes.Buffer)}))
+	e.GET("/", func(c echo.Context) error {
+		return handlerErr
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, handlerErr, got)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestBreadcrumbsLimit(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	for i := 0; i < maxBreadcrumbs+5; i++ {
+		AddBreadcrumb(c, "step", fmt.Sprint(i), nil)
+	}
+
+	crumbs := Breadcrumbs(c)
+	require.Len(t, crumbs, maxBreadcrumbs)
+	assert.Equal(t, "5", crumbs[0].Message)
+	assert.Equal(t, fmt.Sprint(maxBreadcrumbs+4), crumbs[maxBreadcrumbs-1].Message)
+}
+
+func TestBreadcrumbsToSentry(t *testing.T) {
+	var events []*sentry.Event
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Transport: &sentry.HTTPSyncTransport{},
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			events = append(events, event)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	previous := sentry.CurrentHub().Client()
+	sentry.CurrentHub().BindClient(client)
+	defer sentry.CurrentHub().BindClient(previous)
+
+	e := echo.New()
+	e.Use(sentryecho.New(sentryecho.Options{}))
+	e.GET("/", func(c echo.Context) error {
+		AddBreadcrumb(c, "cart", "loaded", nil)
+		assert.Empty(t, Breadcrumbs(c))
+		sentryecho.GetHubFromContext(c).CaptureException(errors.New("failed"))
+		return c.NoContent(http.StatusOK)
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Len(t, events, 1)
+	require.Len(t, events[0].Breadcrumbs, 1)
+	assert.Equal(t, "cart", events[0].Breadcrumbs[0].Category)
+}
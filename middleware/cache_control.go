@@ -0,0 +1,190 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CacheControlConfig defines the config for CacheControl middleware. The zero durations are omitted,
+// use `NoCache` to make the caches revalidate every time.
+type CacheControlConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// MaxAge is the `max-age` directive, how long the browsers and the shared caches reuse a response.
+	// Optional.
+	MaxAge time.Duration
+
+	// SMaxAge is the `s-maxage` directive, it overrides `MaxAge` for the shared caches like the CDNs.
+	// Optional.
+	SMaxAge time.Duration
+
+	// StaleWhileRevalidate is the `stale-while-revalidate` directive, how long a stale response is served
+	// while it's revalidated in the background.
+	// Optional.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the `stale-if-error` directive, how long a stale response is served when the origin fails.
+	// Optional.
+	StaleIfError time.Duration
+
+	// Public lets the shared caches store the response even if the request is authenticated.
+	// Optional. Default value false.
+	Public bool
+
+	// Private keeps the response in the browser cache only, it can't be used with `Public`.
+	// Optional. Default value false.
+	Private bool
+
+	// NoCache makes the caches revalidate the response before reusing it.
+	// Optional. Default value false.
+	NoCache bool
+
+	// NoStore forbids the caches to store the response.
+	// Optional. Default value false.
+	NoStore bool
+
+	// Immutable tells the browsers the response never changes while it's fresh.
+	// Optional. Default value false.
+	Immutable bool
+
+	// SurrogateMaxAge is the `max-age` of the `Surrogate-Control` header, which the CDNs like Fastly
+	// read instead of `Cache-Control` and remove from the response.
+	// Optional.
+	SurrogateMaxAge time.Duration
+
+	// Vary is the request headers the response depends on, like `Accept-Language`. They are added to the
+	// `Vary` header of all the responses, the other directives only to the successful ones.
+	// Optional.
+	Vary []string
+}
+
+// DefaultCacheControlConfig is the default CacheControl middleware config.
+var DefaultCacheControlConfig = CacheControlConfig{
+	Skipper: middleware.DefaultSkipper,
+}
+
+// CacheControl returns a middleware which sets the `Cache-Control` and `Surrogate-Control` headers of the
+// successful `GET` and `HEAD` responses, so that the CDN behavior is declared next to the route. The
+// headers set by the handler are kept, and the errors are never made cacheable.
+func CacheControl(config CacheControlConfig) echo.MiddlewareFunc {
+	if config.Public && config.Private {
+		panic("echo: cache control middleware can't be both public and private")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultCacheControlConfig.Skipper
+	}
+
+	cacheControl := config.CacheControl()
+	surrogateControl := ""
+	if config.SurrogateMaxAge > 0 {
+		surrogateControl = "max-age=" + seconds(config.SurrogateMaxAge)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			res := c.Response()
+			method := c.Request().Method
+			res.Before(func() {
+				header := res.Header()
+				for _, name := range config.Vary {
+					addVary(header, name)
+				}
+
+				if (method != http.MethodGet && method != http.MethodHead) || res.Status >= http.StatusBadRequest {
+					return
+				}
+				if cacheControl != "" && header.Get(echo.HeaderCacheControl) == "" {
+					header.Set(echo.HeaderCacheControl, cacheControl)
+				}
+				if surrogateControl != "" && header.Get("Surrogate-Control") == "" {
+					header.Set("Surrogate-Control", surrogateControl)
+				}
+			})
+
+			return next(c)
+		}
+	}
+}
+
+// CacheControl returns the `Cache-Control` header of the config, like `public, max-age=60, s-maxage=600`.
+func (config CacheControlConfig) CacheControl() string {
+	var directives []string
+	if config.Public {
+		directives = append(directives, "public")
+	}
+	if config.Private {
+		directives = append(directives, "private")
+	}
+	if config.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if config.NoStore {
+		directives = append(directives, "no-store")
+	}
+	if config.MaxAge > 0 {
+		directives = append(directives, "max-age="+seconds(config.MaxAge))
+	}
+	if config.SMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(config.SMaxAge))
+	}
+	if config.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(config.StaleWhileRevalidate))
+	}
+	if config.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(config.StaleIfError))
+	}
+	if config.Immutable {
+		directives = append(directives, "immutable")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// addVary adds `name` to the `Vary` header unless it's already there.
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values(echo.HeaderVary) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, name) {
+				return
+			}
+		}
+	}
+
+	header.Add(echo.HeaderVary, name)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
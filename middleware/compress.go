@@ -0,0 +1,358 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CompressConfig defines the config for Compress middleware.
+type CompressConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Level is the compression level of the encoders, from 1 (best speed) to 9 (best compression).
+	// Optional. Default value -1. (the default level of the encoder)
+	Level int
+
+	// MinSize is the minimum size of a response body to be compressed, the small bodies are not worth it.
+	// Optional. Default value 1024.
+	MinSize int
+
+	// SkipContentTypes are the prefixes of the content types which are never compressed, like the already
+	// compressed images. `text/event-stream` is always skipped to keep the server-sent events streaming.
+	// Optional. Default value `DefaultCompressConfig.SkipContentTypes`.
+	SkipContentTypes []string
+}
+
+// CompressionEncoder creates a writer compressing into `w`.
+type CompressionEncoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+// DefaultCompressConfig is the default Compress middleware config.
+var DefaultCompressConfig = CompressConfig{
+	Skipper: middleware.DefaultSkipper,
+	Level:   -1,
+	MinSize: 1024,
+	SkipContentTypes: []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip", "application/octet-stream", "application/pdf",
+	},
+}
+
+var (
+	compressionEncodersMu sync.RWMutex
+	// IMPORTANT: In order of preference when the client accepts several encodings with the same quality.
+	compressionEncoders = []struct {
+		encoding string
+		encoder  CompressionEncoder
+	}{
+		{"gzip", func(w io.Writer, level int) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) }},
+		{"deflate", func(w io.Writer, level int) (io.WriteCloser, error) { return flate.NewWriter(w, level) }},
+	}
+)
+
+// RegisterCompressionEncoder adds an encoding to the `Compress` middleware, it's preferred to the builtin
+// `gzip` and `deflate`. (example: `br` with a brotli library)
+func RegisterCompressionEncoder(encoding string, encoder CompressionEncoder) {
+	compressionEncodersMu.Lock()
+	defer compressionEncodersMu.Unlock()
+
+	for i, e := range compressionEncoders {
+		if e.encoding == encoding {
+			compressionEncoders[i].encoder = encoder
+			return
+		}
+	}
+
+	compressionEncoders = append([]struct {
+		encoding string
+		encoder  CompressionEncoder
+	}{{encoding, encoder}}, compressionEncoders...)
+}
+
+// Compress returns a middleware which compresses the response bodies with the best encoding accepted by
+// the client. (`Accept-Encoding` header)
+// IMPORTANT: Register it before the access logger, then the body dump logs the uncompressed body.
+func Compress(config CompressConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultCompressConfig.Skipper
+	}
+	if config.Level == 0 {
+		config.Level = DefaultCompressConfig.Level
+	}
+	if config.MinSize <= 0 {
+		config.MinSize = DefaultCompressConfig.MinSize
+	}
+	if len(config.SkipContentTypes) == 0 {
+		config.SkipContentTypes = DefaultCompressConfig.SkipContentTypes
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+
+			c.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+			encoding, encoder := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoder == nil {
+				return next(c)
+			}
+
+			w := &compressWriter{
+				ResponseWriter: c.Response().Writer,
+				config:         config,
+				encoding:       encoding,
+				encoder:        encoder,
+			}
+			c.Response().Writer = w
+			defer func() {
+				if err := w.Close(); err != nil {
+					c.Logger().Error(err)
+				}
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding returns the registered encoding with the highest quality in the `Accept-Encoding`
+// header, or nil if the client doesn't accept any.
+func negotiateEncoding(accept string) (string, CompressionEncoder) {
+	if accept == "" {
+		return "", nil
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				q = f
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	compressionEncodersMu.RLock()
+	defer compressionEncodersMu.RUnlock()
+
+	candidates := make([]int, 0, len(compressionEncoders))
+	for i, e := range compressionEncoders {
+		q, ok := qualities[e.encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	quality := func(i int) float64 {
+		if q, ok := qualities[compressionEncoders[i].encoding]; ok {
+			return q
+		}
+		return qualities["*"]
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return quality(candidates[a]) > quality(candidates[b])
+	})
+
+	e := compressionEncoders[candidates[0]]
+	return e.encoding, e.encoder
+}
+
+// compressWriter buffers the beginning of the body until it knows whether the response is worth
+// compressing, then either compresses or passes through the rest.
+type compressWriter struct {
+	http.ResponseWriter
+	config   CompressConfig
+	encoding string
+	encoder  CompressionEncoder
+
+	code     int
+	buf      bytes.Buffer
+	decided  bool
+	writer   io.WriteCloser // nil when the response is not compressed.
+	hijacked bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if !w.compressible() {
+			if err := w.decide(false); err != nil {
+				return 0, err
+			}
+		} else {
+			w.buf.Write(b)
+			if w.buf.Len() < w.config.MinSize {
+				return len(b), nil
+			}
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+			return len(b), nil
+		}
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered body, a response which is flushed before reaching `MinSize` is a stream and
+// is not compressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+
+	if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("compress: response writer doesn't support hijacking")
+	}
+	w.hijacked = true
+
+	return hijacker.Hijack()
+}
+
+// Close sends the rest of the buffered body and finishes the compressed stream.
+func (w *compressWriter) Close() error {
+	if w.hijacked {
+		return nil
+	}
+
+	if !w.decided {
+		if w.code == 0 && w.buf.Len() == 0 {
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+
+	return nil
+}
+
+func (w *compressWriter) compressible() bool {
+	switch w.code {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	header := w.Header()
+	if header.Get(echo.HeaderContentEncoding) != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(header.Get(echo.HeaderContentType))
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	for _, skip := range w.config.SkipContentTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	if compress {
+		header := w.Header()
+		header.Del(echo.HeaderContentLength)
+		header.Set(echo.HeaderContentEncoding, w.encoding)
+
+		writer, err := w.encoder(w.ResponseWriter, w.config.Level)
+		if err != nil {
+			return err
+		}
+		w.writer = writer
+	}
+
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+
+	return err
+}
@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"gzip, deflate":           "gzip",
+		"deflate;q=1, gzip;q=0.5": "deflate",
+		"gzip;q=0, deflate":       "deflate",
+		"*":                       "gzip",
+		"identity":                "",
+	}
+
+	for accept, expected := range tests {
+		encoding, _ := negotiateEncoding(accept)
+		assert.Equal(t, expected, encoding, accept)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("bean ", 1000)
+
+	e := echo.New()
+	e.Use(Compress(CompressConfig{}))
+	e.GET("/large", func(c echo.Context) error {
+		return c.String(http.StatusOK, large)
+	})
+	e.GET("/small", func(c echo.Context) error {
+		return c.String(http.StatusOK, "bean")
+	})
+	e.GET("/events", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := c.Response().Write([]byte(large))
+		return err
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/large")
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	r, err := gzip.NewReader(rec.Body)
+	if assert.NoError(t, err) {
+		body, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, large, string(body))
+	}
+
+	rec = serve("/small")
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "bean", rec.Body.String())
+
+	rec = serve("/events")
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, large, rec.Body.String())
+}
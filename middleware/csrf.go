@@ -0,0 +1,236 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/session"
+)
+
+// CSRF protection modes.
+const (
+	// CSRFModeCookie is the double-submit cookie pattern, the token is stored in a cookie and the
+	// client has to send the same value back in a header or a form field.
+	CSRFModeCookie = "cookie"
+
+	// CSRFModeSession is the synchronizer token pattern, the token is stored in the session.
+	// It requires the `session` middleware.
+	CSRFModeSession = "session"
+)
+
+// CSRFContextKey is the key of the CSRF token of the request in `echo.Context`.
+const CSRFContextKey = "csrf"
+
+const csrfSessionKey = "_csrf"
+
+// CSRFConfig defines the config for CSRF middleware.
+type CSRFConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Mode is the way to keep the token, `cookie` or `session`.
+	// Optional. Default value "cookie".
+	Mode string
+
+	// CookieName is the name of the cookie which keeps the token in the `cookie` mode.
+	// Optional. Default value "_csrf".
+	CookieName string
+
+	// HeaderName is the request header which carries the token.
+	// Optional. Default value "X-CSRF-Token".
+	HeaderName string
+
+	// FormField is the form field which carries the token if the header is empty.
+	// Optional. Default value "_csrf".
+	FormField string
+
+	// CookieDomain, CookiePath, CookieMaxAge (in seconds), CookieSecure and CookieSameSite (`lax`,
+	// `strict` or `none`) configure the cookie of the `cookie` mode.
+	// Optional. Default value none, none, 86400, false and "lax".
+	CookieDomain   string
+	CookiePath     string
+	CookieMaxAge   int
+	CookieSecure   bool
+	CookieSameSite string
+}
+
+// DefaultCSRFConfig is the default CSRF middleware config.
+var DefaultCSRFConfig = CSRFConfig{
+	Skipper:        middleware.DefaultSkipper,
+	Mode:           CSRFModeCookie,
+	CookieName:     "_csrf",
+	HeaderName:     echo.HeaderXCSRFToken,
+	FormField:      "_csrf",
+	CookieMaxAge:   86400,
+	CookieSameSite: "lax",
+}
+
+// ErrCSRFInvalid is returned when the token of an unsafe request is missing or doesn't match.
+var ErrCSRFInvalid = errors.New("invalid csrf token")
+
+// CSRF returns a Cross-Site Request Forgery protection middleware. The safe methods (GET, HEAD, OPTIONS
+// and TRACE) are only given a token, the other ones are rejected with `403 Forbidden` unless they send
+// the token back in the `HeaderName` header or the `FormField` form field. The token of the request can
+// be read by `CSRFToken` and rendered in a HTML form by the `csrfField` template function.
+func CSRF(config CSRFConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultCSRFConfig.Skipper
+	}
+	if config.Mode == "" {
+		config.Mode = DefaultCSRFConfig.Mode
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultCSRFConfig.CookieName
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = DefaultCSRFConfig.HeaderName
+	}
+	if config.FormField == "" {
+		config.FormField = DefaultCSRFConfig.FormField
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = DefaultCSRFConfig.CookieMaxAge
+	}
+	if config.CookieSameSite == "" {
+		config.CookieSameSite = DefaultCSRFConfig.CookieSameSite
+	}
+
+	switch config.Mode {
+	case CSRFModeCookie:
+		return middleware.CSRFWithConfig(middleware.CSRFConfig{
+			Skipper:        config.Skipper,
+			TokenLookup:    "header:" + config.HeaderName + ",form:" + config.FormField,
+			ContextKey:     CSRFContextKey,
+			CookieName:     config.CookieName,
+			CookieDomain:   config.CookieDomain,
+			CookiePath:     config.CookiePath,
+			CookieMaxAge:   config.CookieMaxAge,
+			CookieSecure:   config.CookieSecure,
+			CookieSameSite: csrfSameSite(config.CookieSameSite),
+			ErrorHandler: func(err error, c echo.Context) error {
+				return berror.NewIgnorableAPIError(http.StatusForbidden, berror.UNAUTHORIZED_ACCESS, ErrCSRFInvalid)
+			},
+		})
+	case CSRFModeSession:
+		return csrfSession(config)
+	default:
+		panic("echo: unknown csrf mode " + config.Mode)
+	}
+}
+
+// CSRFToken returns the CSRF token of the request or an empty string if the middleware is not used.
+func CSRFToken(c echo.Context) string {
+	token, _ := c.Get(CSRFContextKey).(string)
+	return token
+}
+
+// CSRFTemplateFuncs returns the template functions to render the CSRF token in a goview HTML template.
+// Example:
+//
+//	<form method="post">
+//		{{ csrfField .csrf }}
+//	</form>
+func CSRFTemplateFuncs(formField string) template.FuncMap {
+	if formField == "" {
+		formField = DefaultCSRFConfig.FormField
+	}
+
+	return template.FuncMap{
+		"csrfField": func(token string) template.HTML {
+			if token == "" {
+				return ""
+			}
+			return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(formField) +
+				`" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	}
+}
+
+func csrfSession(config CSRFConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			sess, err := session.Get(c)
+			if err != nil {
+				return err
+			}
+
+			token, _ := sess.Get(csrfSessionKey).(string)
+			if token == "" {
+				if token, err = newCSRFToken(); err != nil {
+					return err
+				}
+				sess.Set(csrfSessionKey, token)
+			}
+
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				clientToken := c.Request().Header.Get(config.HeaderName)
+				if clientToken == "" {
+					clientToken = c.FormValue(config.FormField)
+				}
+				if subtle.ConstantTimeCompare([]byte(token), []byte(clientToken)) != 1 {
+					return berror.NewIgnorableAPIError(http.StatusForbidden, berror.UNAUTHORIZED_ACCESS, ErrCSRFInvalid)
+				}
+			}
+
+			c.Set(CSRFContextKey, token)
+
+			return next(c)
+		}
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func csrfSameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
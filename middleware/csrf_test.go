@@ -0,0 +1,83 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFCookie(t *testing.T) {
+	e := echo.New()
+	mw := CSRF(CSRFConfig{})
+	handler := mw(func(c echo.Context) error {
+		return c.String(http.StatusOK, CSRFToken(c))
+	})
+
+	// A safe request gets the token in the cookie and the context.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(req, rec)))
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "_csrf", cookies[0].Name)
+		assert.Equal(t, cookies[0].Value, rec.Body.String())
+	}
+
+	// An unsafe request without the token is forbidden.
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookies[0])
+	err := handler(e.NewContext(req, httptest.NewRecorder()))
+	var apiErr *berror.APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusForbidden, apiErr.HTTPStatusCode)
+		assert.ErrorIs(t, apiErr.Err, ErrCSRFInvalid)
+	}
+
+	// The token is accepted from the header.
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookies[0])
+	req.Header.Set(echo.HeaderXCSRFToken, cookies[0].Value)
+	assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+
+	// The token is accepted from the form field.
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_csrf="+cookies[0].Value))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(cookies[0])
+	assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+}
+
+func TestCSRFTemplateFuncs(t *testing.T) {
+	field := CSRFTemplateFuncs("")["csrfField"].(func(string) template.HTML)
+
+	assert.Equal(t, template.HTML(`<input type="hidden" name="_csrf" value="a&lt;b">`), field("a<b"))
+	assert.Empty(t, field(""))
+}
@@ -0,0 +1,220 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+// DebugConfig defines the protection of the debug endpoints. At least one of the basic auth or the IP
+// allowlist is required, both are checked if both are set.
+type DebugConfig struct {
+	// Username and Password of the basic auth.
+	// Optional. Default value "", no basic auth.
+	Username string
+	Password string
+
+	// AllowIPs are the IPs or CIDRs allowed to call the endpoints, like the internal network. They are
+	// matched against the peer of the connection, or against the IP returned by `echo.Echo.IPExtractor`
+	// if it's set, like `echo.ExtractIPFromXFFHeader` with the trusted proxies. The `X-Forwarded-For`
+	// header is never trusted without it.
+	// Optional. Default value nil, any IP.
+	AllowIPs []string
+}
+
+// ErrDebugForbidden is returned when the IP of the caller is not in `DebugConfig.AllowIPs`.
+var ErrDebugForbidden = errors.New("debug endpoints are not allowed from this address")
+
+// RegisterDebugRoutes mounts the profiling and runtime endpoints:
+//
+//	/debug/pprof/...  the `net/http/pprof` profiles, like `go tool pprof http://host/debug/pprof/heap`
+//	/debug/vars       the `expvar` variables
+//	/debug/runtime    the goroutines, memory and GC statistics as JSON
+//
+// It returns an error without mounting anything if neither the basic auth nor the allowlist is set.
+func RegisterDebugRoutes(e *echo.Echo, config DebugConfig) error {
+	if config.Username == "" && len(config.AllowIPs) == 0 {
+		return errors.New("debug endpoints require a basic auth or an ip allowlist")
+	}
+
+	var middlewares []echo.MiddlewareFunc
+
+	if len(config.AllowIPs) > 0 {
+		networks, err := parseAllowIPs(config.AllowIPs)
+		if err != nil {
+			return err
+		}
+		middlewares = append(middlewares, allowIPs(networks))
+	}
+
+	if config.Username != "" {
+		middlewares = append(middlewares, middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(username), []byte(config.Username)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(config.Password)) == 1, nil
+		}))
+	}
+
+	g := e.Group("/debug", middlewares...)
+
+	// `pprof.Index` serves the named profiles (heap, goroutine, allocs...) under `/debug/pprof/`.
+	g.GET("/pprof", func(c echo.Context) error {
+		return c.Redirect(http.StatusMovedPermanently, BasePathURL(c, "/debug/pprof/"))
+	})
+	g.GET("/pprof/*", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	g.GET("/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	g.GET("/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.POST("/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	g.GET("/vars", echo.WrapHandler(expvar.Handler()))
+	g.GET("/runtime", runtimeStats)
+
+	return nil
+}
+
+// RuntimeStats is the body of `/debug/runtime`.
+type RuntimeStats struct {
+	GoVersion    string `json:"goVersion"`
+	NumCPU       int    `json:"numCpu"`
+	GOMAXPROCS   int    `json:"gomaxprocs"`
+	NumGoroutine int    `json:"numGoroutine"`
+	NumCgoCall   int64  `json:"numCgoCall"`
+	Memory       struct {
+		Alloc        uint64 `json:"alloc"`
+		TotalAlloc   uint64 `json:"totalAlloc"`
+		Sys          uint64 `json:"sys"`
+		HeapAlloc    uint64 `json:"heapAlloc"`
+		HeapInuse    uint64 `json:"heapInuse"`
+		HeapIdle     uint64 `json:"heapIdle"`
+		HeapReleased uint64 `json:"heapReleased"`
+		HeapObjects  uint64 `json:"heapObjects"`
+		StackInuse   uint64 `json:"stackInuse"`
+	} `json:"memory"`
+	GC struct {
+		NumGC        uint32    `json:"numGc"`
+		LastGC       time.Time `json:"lastGc"`
+		PauseTotal   string    `json:"pauseTotal"`
+		LastPause    string    `json:"lastPause"`
+		NextGC       uint64    `json:"nextGc"`
+		CPUFraction  float64   `json:"cpuFraction"`
+		NumForcedGC  uint32    `json:"numForcedGc"`
+		GOGCDisabled bool      `json:"gogcDisabled"`
+	} `json:"gc"`
+}
+
+func runtimeStats(c echo.Context) error {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var stats RuntimeStats
+	stats.GoVersion = runtime.Version()
+	stats.NumCPU = runtime.NumCPU()
+	stats.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	stats.NumGoroutine = runtime.NumGoroutine()
+	stats.NumCgoCall = runtime.NumCgoCall()
+
+	stats.Memory.Alloc = m.Alloc
+	stats.Memory.TotalAlloc = m.TotalAlloc
+	stats.Memory.Sys = m.Sys
+	stats.Memory.HeapAlloc = m.HeapAlloc
+	stats.Memory.HeapInuse = m.HeapInuse
+	stats.Memory.HeapIdle = m.HeapIdle
+	stats.Memory.HeapReleased = m.HeapReleased
+	stats.Memory.HeapObjects = m.HeapObjects
+	stats.Memory.StackInuse = m.StackInuse
+
+	stats.GC.NumGC = m.NumGC
+	if m.LastGC > 0 {
+		stats.GC.LastGC = time.Unix(0, int64(m.LastGC))
+	}
+	stats.GC.PauseTotal = time.Duration(m.PauseTotalNs).String()
+	stats.GC.LastPause = time.Duration(m.PauseNs[(m.NumGC+255)%256]).String()
+	stats.GC.NextGC = m.NextGC
+	stats.GC.CPUFraction = m.GCCPUFraction
+	stats.GC.NumForcedGC = m.NumForcedGC
+	stats.GC.GOGCDisabled = !m.EnableGC
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+func parseAllowIPs(allowIPs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(allowIPs))
+	for _, allowIP := range allowIPs {
+		if ip := net.ParseIP(allowIP); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(allowIP)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid debug allow ip %q", allowIP)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// allowIPs rejects the callers outside of the networks. `RealIP` falls back to the spoofable
+// `X-Forwarded-For` header without an `IPExtractor`, so the peer of the connection is used instead.
+func allowIPs(networks []*net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := net.ParseIP(trustedIP(c))
+			if ip != nil {
+				for _, network := range networks {
+					if network.Contains(ip) {
+						return next(c)
+					}
+				}
+			}
+
+			return berror.NewIgnorableAPIError(http.StatusForbidden, berror.UNAUTHORIZED_ACCESS, ErrDebugForbidden)
+		}
+	}
+}
+
+// trustedIP returns the IP of the caller returned by `echo.Echo.IPExtractor`, or the peer of the connection
+// if it's not set.
+func trustedIP(c echo.Context) string {
+	if c.Echo().IPExtractor != nil {
+		return c.RealIP()
+	}
+
+	return echo.ExtractIPDirect()(c.Request())
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterDebugRoutes(t *testing.T) {
+	e := echo.New()
+	assert.Error(t, RegisterDebugRoutes(e, DebugConfig{}))
+	assert.Error(t, RegisterDebugRoutes(e, DebugConfig{AllowIPs: []string{"not-an-ip"}}))
+
+	e = echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		if apiErr, ok := err.(*berror.APIError); ok {
+			_ = c.NoContent(apiErr.HTTPStatusCode)
+			return
+		}
+		e.DefaultHTTPErrorHandler(err, c)
+	}
+	assert.NoError(t, RegisterDebugRoutes(e, DebugConfig{
+		Username: "ops",
+		Password: "a-long-enough-password",
+		AllowIPs: []string{"10.0.0.0/8", "127.0.0.1"},
+	}))
+
+	request := func(ip, username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/runtime", nil)
+		req.RemoteAddr = ip + ":1234"
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, request("192.168.1.1", "ops", "a-long-enough-password").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("10.1.2.3", "ops", "wrong").Code)
+
+	rec := request("10.1.2.3", "ops", "a-long-enough-password")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var stats RuntimeStats
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Greater(t, stats.NumGoroutine, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.SetBasicAuth("ops", "a-long-enough-password")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine profile")
+
+	// A spoofed `X-Forwarded-For` header doesn't pass the allowlist.
+	req = httptest.NewRequest(http.MethodGet, "/debug/runtime", nil)
+	req.RemoteAddr = "192.168.1.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "10.1.2.3")
+	req.SetBasicAuth("ops", "a-long-enough-password")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// It's trusted from the proxies trusted by the IP extractor.
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(echo.TrustIPRange(&net.IPNet{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)}))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDebugPprofRedirect(t *testing.T) {
+	e := echo.New()
+	e.Pre(BasePath(BasePathConfig{Prefix: "/api"}))
+	assert.NoError(t, RegisterDebugRoutes(e, DebugConfig{AllowIPs: []string{"127.0.0.1"}}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/debug/pprof", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/api/debug/pprof/", rec.Header().Get(echo.HeaderLocation))
+}
@@ -0,0 +1,189 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+// DecompressConfig defines the config for Decompress middleware.
+type DecompressConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// MaxBodyBytes is the maximum size of a decompressed request body.
+	// Optional. Default value 10MB.
+	MaxBodyBytes int64
+
+	// MaxRatio is the maximum ratio of the decompressed size to the compressed size, so that a decompression
+	// bomb is rejected long before `MaxBodyBytes`. It's checked from 64KB of decompressed body on, the small JSON
+	// bodies are often very compressible.
+	// Optional. Default value 100.
+	MaxRatio int64
+}
+
+var (
+	ErrDecompressTooLarge    = errors.New("decompressed request body is too large")
+	ErrDecompressRatio       = errors.New("request body compression ratio is too high")
+	ErrDecompressInvalid     = errors.New("request body is not validly compressed")
+	ErrDecompressUnsupported = errors.New("request body content encoding is not supported")
+)
+
+// decompressRatioFloor is the decompressed size from which `MaxRatio` is checked.
+const decompressRatioFloor = 64 << 10
+
+// DefaultDecompressConfig is the default Decompress middleware config.
+var DefaultDecompressConfig = DecompressConfig{
+	Skipper:      middleware.DefaultSkipper,
+	MaxBodyBytes: 10 << 20,
+	MaxRatio:     100,
+}
+
+// Decompress returns a middleware which transparently decompresses the `gzip` and `deflate` request
+// bodies (`Content-Encoding` header) before they are bound. A body exceeding `MaxBodyBytes` or `MaxRatio` once
+// decompressed is rejected by a 413 `REQUEST_ENTITY_TOO_LARGE` error, an invalid body by a 400 and an
+// unknown encoding by a 415 `UNSUPPORTED_MEDIA_TYPE`.
+// IMPORTANT: The global `http.bodyLimit` still applies to the compressed body.
+func Decompress(config DecompressConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultDecompressConfig.Skipper
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultDecompressConfig.MaxBodyBytes
+	}
+	if config.MaxRatio <= 0 {
+		config.MaxRatio = DefaultDecompressConfig.MaxRatio
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+			if encoding == "" || encoding == "identity" || req.Body == nil || req.Body == http.NoBody {
+				return next(c)
+			}
+
+			compressed := &countingReader{ReadCloser: req.Body}
+			var r io.Reader
+			switch encoding {
+			case "gzip", "x-gzip":
+				gr, err := gzip.NewReader(compressed)
+				if err != nil {
+					return berror.NewIgnorableAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, ErrDecompressInvalid)
+				}
+				defer gr.Close()
+				r = gr
+			case "deflate":
+				r = newDeflateReader(compressed)
+			default:
+				return berror.NewIgnorableAPIError(http.StatusUnsupportedMediaType, berror.UNSUPPORTED_MEDIA_TYPE, ErrDecompressUnsupported)
+			}
+
+			req.Body = &decompressedBody{
+				Reader:     r,
+				Closer:     compressed,
+				compressed: compressed,
+				maxSize:    config.MaxBodyBytes,
+				maxRatio:   config.MaxRatio,
+			}
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+			req.ContentLength = -1
+
+			err := next(c)
+
+			switch {
+			case errors.Is(err, ErrDecompressTooLarge):
+				return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrDecompressTooLarge)
+			case errors.Is(err, ErrDecompressRatio):
+				return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrDecompressRatio)
+			case errors.Is(err, ErrDecompressInvalid):
+				return berror.NewIgnorableAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, ErrDecompressInvalid)
+			}
+
+			return err
+		}
+	}
+}
+
+// newDeflateReader reads the zlib format of the `deflate` encoding, or the raw deflate format some clients
+// send instead.
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+
+	return flate.NewReader(br)
+}
+
+// decompressedBody stops reading when the decompressed body exceeds the limits.
+type decompressedBody struct {
+	io.Reader
+	io.Closer
+	compressed *countingReader
+	n          int64
+	maxSize    int64
+	maxRatio   int64
+	err        error
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.Reader.Read(p)
+	b.n += int64(n)
+
+	switch {
+	case b.n > b.maxSize:
+		b.err = ErrDecompressTooLarge
+	case b.n > decompressRatioFloor && b.n > b.compressed.n*b.maxRatio:
+		b.err = ErrDecompressRatio
+	case err != nil && err != io.EOF:
+		b.err = ErrDecompressInvalid
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	return n, err
+}
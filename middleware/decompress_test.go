@@ -0,0 +1,120 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress(t *testing.T) {
+	compress := func(encoding string, body []byte) []byte {
+		buf := new(bytes.Buffer)
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(buf)
+		case "deflate":
+			w = zlib.NewWriter(buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+		}
+		_, _ = w.Write(body)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	call := func(config DecompressConfig, encoding string, body []byte) (string, error) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentEncoding, encoding)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+
+		var got string
+		err := Decompress(config)(func(c echo.Context) error {
+			assert.Empty(t, c.Request().Header.Get(echo.HeaderContentEncoding))
+			var m struct{ Event string }
+			if err := (&echo.DefaultBinder{}).BindBody(c, &m); err != nil {
+				return err
+			}
+			got = m.Event
+			return nil
+		})(c)
+
+		return got, err
+	}
+
+	assertAPIError := func(err error, status int, code berror.ErrorCode, cause error) {
+		t.Helper()
+		apiErr, ok := err.(*berror.APIError)
+		if assert.True(t, ok, "unexpected error %v", err) {
+			assert.Equal(t, status, apiErr.HTTPStatusCode)
+			assert.Equal(t, code, apiErr.GlobalErrCode)
+			assert.ErrorIs(t, apiErr.Err, cause)
+		}
+	}
+
+	body := []byte(`{"event":"order.paid"}`)
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		header := strings.TrimPrefix(encoding, "raw-")
+		got, err := call(DecompressConfig{}, header, compress(encoding, body))
+		assert.NoError(t, err, encoding)
+		assert.Equal(t, "order.paid", got, encoding)
+	}
+
+	// Without an encoding the body is untouched.
+	got, err := call(DecompressConfig{}, "", body)
+	assert.NoError(t, err)
+	assert.Equal(t, "order.paid", got)
+
+	padded := []byte(`{"event":"order.paid","pad":"` + strings.Repeat("a", 200<<10) + `"}`)
+	_, err = call(DecompressConfig{MaxBodyBytes: 100 << 10, MaxRatio: 10000}, "gzip", compress("gzip", padded))
+	assertAPIError(err, http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrDecompressTooLarge)
+
+	_, err = call(DecompressConfig{}, "gzip", compress("gzip", padded))
+	assertAPIError(err, http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrDecompressRatio)
+
+	got, err = call(DecompressConfig{MaxRatio: 10000}, "gzip", compress("gzip", padded))
+	assert.NoError(t, err)
+	assert.Equal(t, "order.paid", got)
+
+	_, err = call(DecompressConfig{}, "gzip", body)
+	assertAPIError(err, http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, ErrDecompressInvalid)
+
+	_, err = call(DecompressConfig{}, "gzip", compress("gzip", body)[:20])
+	assertAPIError(err, http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, ErrDecompressInvalid)
+
+	_, err = call(DecompressConfig{}, "br", body)
+	assertAPIError(err, http.StatusUnsupportedMediaType, berror.UNSUPPORTED_MEDIA_TYPE, ErrDecompressUnsupported)
+}
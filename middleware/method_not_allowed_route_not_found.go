@@ -37,9 +37,33 @@ import (
 var sortedAllowedMethodSlice []string
 var sortAllowedMethodOnce sync.Once
 
+// MethodNotAllowedAndRouteNotFoundConfig defines the config for MethodNotAllowedAndRouteNotFound middleware.
+type MethodNotAllowedAndRouteNotFoundConfig struct {
+	// AllowedMethods are the methods of the routes which are served, a route of another method is not found.
+	// Required.
+	AllowedMethods []string
+}
+
 // MethodNotAllowedAndRouteNotFound middleware will reply HTTP 405 if a wrong method been called for an API route.
 // This middleware will also return 404 if a page doesn't exist.
+// Deprecated: it reads `http.allowedMethod` from the global viper config, use `MethodNotAllowedAndRouteNotFoundWithConfig`.
 func MethodNotAllowedAndRouteNotFound() echo.MiddlewareFunc {
+	mw := methodNotAllowedAndRouteNotFound(sortedAllowedMethod)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc { return mw(next) }
+}
+
+// MethodNotAllowedAndRouteNotFoundWithConfig returns a MethodNotAllowedAndRouteNotFound middleware with config.
+func MethodNotAllowedAndRouteNotFoundWithConfig(config MethodNotAllowedAndRouteNotFoundConfig) echo.MiddlewareFunc {
+	methods := append([]string(nil), config.AllowedMethods...)
+	sort.Strings(methods)
+
+	mw := methodNotAllowedAndRouteNotFound(func() []string { return methods })
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc { return mw(next) }
+}
+
+func methodNotAllowedAndRouteNotFound(sortedAllowedMethod func() []string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
 			allowedMethod := sortedAllowedMethod()
@@ -86,6 +110,7 @@ func MethodNotAllowedAndRouteNotFound() echo.MiddlewareFunc {
 				}
 
 			} else if isRouteMatched && !isMethodMatched {
+				c.Response().Header().Set(echo.HeaderAllow, strings.Join(RouteMethods(c.Request().URL.Path), ", "))
 
 				if !strings.Contains(c.Request().Header.Get("Content-Type"), "application/json") {
 					return c.Render(http.StatusMethodNotAllowed, "errors/html/405", echo.Map{"stacktrace": nil})
@@ -0,0 +1,227 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+type (
+	// NonceConfig defines the config for Nonce middleware.
+	NonceConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// Store remembers the nonces already used.
+		// Required.
+		Store NonceStore
+
+		// NonceHeader is the header of the nonce, 16 to 128 characters of `[A-Za-z0-9._-]`.
+		// Optional. Default value "X-Nonce".
+		NonceHeader string
+
+		// TimestampHeader is the header of the time of the request in unix seconds.
+		// Optional. Default value "X-Timestamp".
+		TimestampHeader string
+
+		// MaxSkew is the accepted difference between the timestamp and the clock of the server.
+		// Optional. Default value 5 minutes.
+		MaxSkew time.Duration
+
+		// Scope returns the namespace of the nonces of the request, so that two clients can use the same nonce.
+		// Optional. Default value the ID of the API key of `APIKeyAuth` if any, otherwise a global namespace.
+		Scope func(c echo.Context) string
+	}
+
+	// NonceStore remembers the used nonces.
+	NonceStore interface {
+		// Claim records `nonce` for `ttl` and reports false if it was already recorded.
+		Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	}
+)
+
+var (
+	ErrNonceMissing  = errors.New("nonce or timestamp is missing")
+	ErrNonceInvalid  = errors.New("nonce or timestamp is invalid")
+	ErrNonceSkewed   = errors.New("timestamp is outside of the accepted window")
+	ErrNonceReplayed = errors.New("request is replayed")
+)
+
+var nonceFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{16,128}$`)
+
+// DefaultNonceConfig is the default Nonce middleware config.
+var DefaultNonceConfig = NonceConfig{
+	Skipper:         middleware.DefaultSkipper,
+	NonceHeader:     "X-Nonce",
+	TimestampHeader: "X-Timestamp",
+	MaxSkew:         5 * time.Minute,
+}
+
+// Nonce returns an anti-replay middleware for the selected routes, like the payment endpoints, with the
+// default config.
+func Nonce(store NonceStore) echo.MiddlewareFunc {
+	config := DefaultNonceConfig
+	config.Store = store
+	return NonceWithConfig(config)
+}
+
+// NonceWithConfig returns a middleware which rejects a request whose timestamp is older or newer than
+// `MaxSkew`, or whose nonce was already used. A nonce is remembered for twice `MaxSkew`, longer than any
+// accepted timestamp, so a replayed request is rejected either by the store or by its timestamp.
+// The replays are rejected by a 409 `REQUEST_REPLAYED` error, the other failures by a 401.
+func NonceWithConfig(config NonceConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo: nonce middleware requires a nonce store")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultNonceConfig.Skipper
+	}
+	if config.NonceHeader == "" {
+		config.NonceHeader = DefaultNonceConfig.NonceHeader
+	}
+	if config.TimestampHeader == "" {
+		config.TimestampHeader = DefaultNonceConfig.TimestampHeader
+	}
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = DefaultNonceConfig.MaxSkew
+	}
+	if config.Scope == nil {
+		config.Scope = apiKeyScope
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			nonce := c.Request().Header.Get(config.NonceHeader)
+			timestamp := c.Request().Header.Get(config.TimestampHeader)
+			if nonce == "" || timestamp == "" {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceMissing)
+			}
+
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || !nonceFormat.MatchString(nonce) {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceInvalid)
+			}
+
+			skew := time.Since(time.Unix(unix, 0))
+			if skew > config.MaxSkew || skew < -config.MaxSkew {
+				return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceSkewed)
+			}
+
+			key := nonce
+			if scope := config.Scope(c); scope != "" {
+				key = strings.ReplaceAll(scope, ":", "_") + ":" + nonce
+			}
+
+			claimed, err := config.Store.Claim(c.Request().Context(), key, 2*config.MaxSkew)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return berror.NewIgnorableAPIError(http.StatusConflict, berror.REQUEST_REPLAYED, ErrNonceReplayed)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// apiKeyScope returns the ID of the API key of the request if any.
+func apiKeyScope(c echo.Context) string {
+	if key, ok := GetAPIKey(c); ok {
+		return key.ID
+	}
+	return ""
+}
+
+// RedisNonceStore is a `NonceStore` shared by the replicas, the nonces are stored under `prefix`.
+type RedisNonceStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisNonceStore returns a store of the nonces under `prefix`, "nonce:" if `prefix` is empty.
+func NewRedisNonceStore(client redis.UniversalClient, prefix string) *RedisNonceStore {
+	if prefix == "" {
+		prefix = "nonce:"
+	}
+
+	return &RedisNonceStore{client: client, prefix: prefix}
+}
+
+// Claim implements `NonceStore`.
+func (s *RedisNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+}
+
+// MemoryNonceStore is a `NonceStore` of the process, for a single instance.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	claims int
+}
+
+// NewMemoryNonceStore returns an in-memory nonce store.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+// Claim implements `NonceStore`.
+func (s *MemoryNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Sweep the expired nonces from time to time so that the map doesn't grow forever.
+	s.claims++
+	if s.claims%1000 == 0 {
+		for n, expiresAt := range s.nonces {
+			if now.After(expiresAt) {
+				delete(s.nonces, n)
+			}
+		}
+	}
+
+	if expiresAt, ok := s.nonces[nonce]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+
+	return true, nil
+}
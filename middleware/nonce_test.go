@@ -0,0 +1,91 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonce(t *testing.T) {
+	e := echo.New()
+	mw := Nonce(NewMemoryNonceStore())
+	handler := mw(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	call := func(nonce string, at time.Time) error {
+		req := httptest.NewRequest(http.MethodPost, "/payments", nil)
+		if nonce != "" {
+			req.Header.Set("X-Nonce", nonce)
+			req.Header.Set("X-Timestamp", strconv.FormatInt(at.Unix(), 10))
+		}
+		return handler(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	assertAPIError := func(err error, status int, code berror.ErrorCode, cause error) {
+		t.Helper()
+		apiErr, ok := err.(*berror.APIError)
+		if assert.True(t, ok, "unexpected error %v", err) {
+			assert.Equal(t, status, apiErr.HTTPStatusCode)
+			assert.Equal(t, code, apiErr.GlobalErrCode)
+			assert.ErrorIs(t, apiErr.Err, cause)
+		}
+	}
+
+	now := time.Now()
+
+	assert.NoError(t, call("0123456789abcdef", now))
+	assertAPIError(call("0123456789abcdef", now), http.StatusConflict, berror.REQUEST_REPLAYED, ErrNonceReplayed)
+
+	assertAPIError(call("", now), http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceMissing)
+	assertAPIError(call("short", now), http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceInvalid)
+	assertAPIError(call("0123456789abcdeg", now.Add(-10*time.Minute)), http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceSkewed)
+	assertAPIError(call("0123456789abcdeh", now.Add(10*time.Minute)), http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, ErrNonceSkewed)
+}
+
+func TestNonceScope(t *testing.T) {
+	e := echo.New()
+	mw := Nonce(NewMemoryNonceStore())
+	handler := mw(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, id := range []string{"key-1", "key-2"} {
+		req := httptest.NewRequest(http.MethodPost, "/payments", nil)
+		req.Header.Set("X-Nonce", "0123456789abcdef")
+		req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(apiKeyKey, &APIKey{ID: id})
+
+		assert.NoError(t, handler(c), "the nonce of another key must be accepted")
+	}
+}
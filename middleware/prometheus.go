@@ -0,0 +1,253 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+type (
+	// PrometheusConfig defines the config for Prometheus middleware.
+	PrometheusConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// Subsystem is the prefix of the metric names.
+		// Optional. Default value "echo".
+		Subsystem string
+
+		// MetricsPath is the endpoint serving the metrics.
+		// Optional. Default value "/metrics".
+		MetricsPath string
+
+		// Exemplars attaches the sentry trace ID of sampled requests as an exemplar to the latency histogram
+		// so that a spike in Grafana can be linked to the traces. The exemplars are only exposed in the
+		// OpenMetrics format. (`Accept: application/openmetrics-text`)
+		// Optional. Default value false.
+		Exemplars bool
+
+		// Tenant returns the tenant of the request, the metrics then have a `tenant` label whose
+		// cardinality is bounded by `TenantLabels`. It's called once the handler has returned.
+		// Optional. Default value nil, no tenant label.
+		Tenant func(c echo.Context) string
+
+		// TenantLabels labels the busiest tenants individually and buckets the others.
+		// Optional. Default value `NewTenantLabels(DefaultTenantLabelsConfig)`.
+		TenantLabels *TenantLabels
+
+		// Registerer and Gatherer hold the metrics.
+		// Optional. Default value prometheus.DefaultRegisterer and prometheus.DefaultGatherer.
+		Registerer prometheus.Registerer
+		Gatherer   prometheus.Gatherer
+	}
+
+	// Prometheus collects the standard HTTP metrics. The metric names and labels are the same as
+	// `echo-contrib/prometheus` so that existing dashboards keep working.
+	Prometheus struct {
+		config PrometheusConfig
+
+		reqCnt               *prometheus.CounterVec
+		reqDur, reqSz, resSz *prometheus.HistogramVec
+	}
+)
+
+// DefaultPrometheusConfig is the default Prometheus middleware config.
+var DefaultPrometheusConfig = PrometheusConfig{
+	Skipper:     middleware.DefaultSkipper,
+	Subsystem:   "echo",
+	MetricsPath: "/metrics",
+}
+
+// NewPrometheus registers the HTTP metrics and returns a `Prometheus` instance.
+func NewPrometheus(config PrometheusConfig) *Prometheus {
+	if config.Skipper == nil {
+		config.Skipper = DefaultPrometheusConfig.Skipper
+	}
+	if config.Subsystem == "" {
+		config.Subsystem = DefaultPrometheusConfig.Subsystem
+	}
+	if config.MetricsPath == "" {
+		config.MetricsPath = DefaultPrometheusConfig.MetricsPath
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Gatherer == nil {
+		config.Gatherer = prometheus.DefaultGatherer
+	}
+	if config.Tenant != nil && config.TenantLabels == nil {
+		config.TenantLabels = NewTenantLabels(DefaultTenantLabelsConfig)
+	}
+
+	p := &Prometheus{config: config}
+
+	labels := func(names ...string) []string {
+		if config.Tenant != nil {
+			names = append(names, "tenant")
+		}
+		return names
+	}
+
+	p.reqCnt = helpers.RegisterCollector(config.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: config.Subsystem,
+		Name:      "requests_total",
+		Help:      "How many HTTP requests processed, partitioned by status code and HTTP method.",
+	}, labels("code", "method", "host", "url")))
+
+	p.reqDur = helpers.RegisterCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: config.Subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "The HTTP request latencies in seconds.",
+	}, labels("code", "method", "url")))
+
+	p.resSz = helpers.RegisterCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: config.Subsystem,
+		Name:      "response_size_bytes",
+		Help:      "The HTTP response sizes in bytes.",
+	}, labels("code", "method", "url")))
+
+	p.reqSz = helpers.RegisterCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: config.Subsystem,
+		Name:      "request_size_bytes",
+		Help:      "The HTTP request sizes in bytes.",
+	}, labels("code", "method", "url")))
+
+	return p
+}
+
+// Use adds the middleware and the metrics endpoint to the echo instance.
+func (p *Prometheus) Use(e *echo.Echo) {
+	e.Use(p.HandlerFunc)
+	e.GET(p.config.MetricsPath, p.MetricsHandler())
+}
+
+// MetricsHandler serves the metrics in the text or the OpenMetrics format depending on the `Accept` header.
+func (p *Prometheus) MetricsHandler() echo.HandlerFunc {
+	h := promhttp.HandlerFor(p.config.Gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	return func(c echo.Context) error {
+		h.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+// HandlerFunc defines handler function for middleware.
+func (p *Prometheus) HandlerFunc(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Path() == p.config.MetricsPath || p.config.Skipper(c) {
+			return next(c)
+		}
+
+		start := time.Now()
+		reqSz := computeApproximateRequestSize(c.Request())
+
+		err := next(c)
+
+		elapsed := float64(time.Since(start)) / float64(time.Second)
+		statusStr := strconv.Itoa(responseStatus(c, err))
+		method := c.Request().Method
+		url := c.Path()
+
+		values := []string{statusStr, method, url}
+		if p.config.Tenant != nil {
+			values = append(values, p.config.TenantLabels.Observe(p.config.Tenant(c)))
+		}
+
+		observer := p.reqDur.WithLabelValues(values...)
+		if traceID := p.exemplarTraceID(c); traceID != "" {
+			observer.(prometheus.ExemplarObserver).ObserveWithExemplar(elapsed, prometheus.Labels{"trace_id": traceID})
+		} else {
+			observer.Observe(elapsed)
+		}
+
+		p.reqCnt.WithLabelValues(append([]string{statusStr, method, c.Request().Host}, values[2:]...)...).Inc()
+		p.reqSz.WithLabelValues(values...).Observe(float64(reqSz))
+		p.resSz.WithLabelValues(values...).Observe(float64(c.Response().Size))
+
+		return err
+	}
+}
+
+// exemplarTraceID returns the trace ID of the request if it has been sampled by the `Tracer` middleware.
+func (p *Prometheus) exemplarTraceID(c echo.Context) string {
+	if !p.config.Exemplars {
+		return ""
+	}
+
+	span := sentry.TransactionFromContext(c.Request().Context())
+	if span == nil || span.Sampled != sentry.SampledTrue {
+		return ""
+	}
+
+	return span.TraceID.String()
+}
+
+// responseStatus returns the status code which will be sent to the client, including the one of
+// the error which hasn't been handled yet by the HTTP error handler.
+func responseStatus(c echo.Context, err error) int {
+	status := c.Response().Status
+	if err != nil {
+		var httpError *echo.HTTPError
+		if errors.As(err, &httpError) {
+			status = httpError.Code
+		}
+		if status == 0 || status == http.StatusOK {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	return status
+}
+
+func computeApproximateRequestSize(r *http.Request) int {
+	s := 0
+	if r.URL != nil {
+		s = len(r.URL.Path)
+	}
+
+	s += len(r.Method)
+	s += len(r.Proto)
+	for name, values := range r.Header {
+		s += len(name)
+		for _, value := range values {
+			s += len(value)
+		}
+	}
+	s += len(r.Host)
+
+	// N.B. r.Form and r.MultipartForm are assumed to be included in r.URL.
+
+	if r.ContentLength != -1 {
+		s += int(r.ContentLength)
+	}
+	return s
+}
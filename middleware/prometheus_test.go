@@ -0,0 +1,101 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusExemplars(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	p := NewPrometheus(PrometheusConfig{Exemplars: true, Registerer: registry, Gatherer: registry})
+	p.Use(e)
+	e.GET("/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong")
+	})
+
+	span := sentry.StartSpan(context.Background(), "http")
+	span.Sampled = sentry.SampledTrue
+	defer span.Finish()
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil).WithContext(span.Context())
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `echo_requests_total{code="200",host="example.com",method="GET",url="/ping"} 1`)
+
+	found := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "echo_request_duration_seconds_bucket") && strings.Contains(line, `# {trace_id="`+span.TraceID.String()+`"}`) {
+			found = true
+			break
+		}
+	}
+	assert.True(t, found, "exemplar with the trace ID not found:\n%s", body)
+}
+
+func TestPrometheusTenant(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	p := NewPrometheus(PrometheusConfig{
+		Registerer:   registry,
+		Gatherer:     registry,
+		Tenant:       func(c echo.Context) string { return c.Request().Header.Get("X-Tenant") },
+		TenantLabels: NewTenantLabels(TenantLabelsConfig{TopN: 1, Pinned: []string{"vip"}}),
+	})
+	p.Use(e)
+	e.GET("/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, "pong")
+	})
+
+	for _, tenant := range []string{"1", "2", "3", "vip"} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Tenant", tenant)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `echo_requests_total{code="200",host="example.com",method="GET",tenant="1",url="/ping"} 1`)
+	assert.Contains(t, body, `echo_requests_total{code="200",host="example.com",method="GET",tenant="other",url="/ping"} 2`)
+	assert.Contains(t, body, `echo_requests_total{code="200",host="example.com",method="GET",tenant="vip",url="/ping"} 1`)
+}
@@ -0,0 +1,114 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+// RateLimitConfig defines the config for RateLimit middleware.
+type RateLimitConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Limit is the maximum number of requests per minute of a caller.
+	// Required.
+	Limit int
+
+	// Limiter counts the requests.
+	// Optional. Default value an in-memory limiter of the process.
+	Limiter RateLimiter
+
+	// KeyFunc identifies the caller. The request is not limited if it returns an empty string.
+	// Optional. Default value the API key ID authenticated by `APIKeyAuth`, otherwise the peer of the
+	// connection or the IP returned by `echo.Echo.IPExtractor` if it's set. (see `DebugConfig.AllowIPs`)
+	KeyFunc func(c echo.Context) string
+
+	// Prefix separates the counters of the routes sharing the same limiter.
+	// Optional. Default value the method and the path of the route.
+	Prefix string
+}
+
+// ErrRateLimitExceeded is returned when a caller sends more requests than the limit.
+var ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
+// RateLimit returns a middleware which rejects the requests of a caller above `Limit` per minute with
+// `429 Too Many Requests`.
+func RateLimit(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Limit <= 0 {
+		panic("echo: rate limit middleware requires a positive limit")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Limiter == nil {
+		config.Limiter = NewMemoryRateLimiter()
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = rateLimitKey
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			key := config.KeyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+
+			prefix := config.Prefix
+			if prefix == "" {
+				prefix = c.Request().Method + " " + c.Path()
+			}
+
+			allowed, err := config.Limiter.Allow(c.Request().Context(), prefix+":"+key, config.Limit)
+			if err != nil {
+				return err
+			}
+			c.Response().Header().Set("X-RateLimit-Limit", strconv.Itoa(config.Limit))
+			if !allowed {
+				c.Response().Header().Set("Retry-After", "60")
+				return berror.NewIgnorableAPIError(http.StatusTooManyRequests, berror.TOO_MANY_REQUESTS, ErrRateLimitExceeded)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func rateLimitKey(c echo.Context) string {
+	if apiKey, ok := GetAPIKey(c); ok {
+		return "key:" + apiKey.ID
+	}
+
+	return "ip:" + trustedIP(c)
+}
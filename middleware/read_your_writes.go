@@ -0,0 +1,104 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+// ReadYourWritesConfig defines the config for ReadYourWrites middleware.
+type ReadYourWritesConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Tracker keeps the recent write markers.
+	// Required.
+	Tracker *dbdrivers.RecentWriteTracker
+
+	// Scope returns the sticky scope of the request, like a user or tenant ID. The request is not
+	// tracked if it returns an empty string.
+	// Required.
+	Scope func(c echo.Context) string
+
+	// IsWrite reports whether the request has written.
+	// Optional. Default value a successful request with a method other than GET, HEAD and OPTIONS.
+	IsWrite func(c echo.Context, err error) bool
+}
+
+// ReadYourWrites returns a middleware which marks the scope of every write request in redis and forces
+// the reads of the same scope to the primary until the marker expires, to prevent the stale reads of the
+// replica routing. The redis helpers, `SQLExecutor` and `MongoOps` of `dbdrivers` follow it automatically;
+// a repository routing its own reads should check `dbdrivers.IsPrimaryRead(ctx)`.
+func ReadYourWrites(config ReadYourWritesConfig) echo.MiddlewareFunc {
+	if config.Tracker == nil || config.Scope == nil {
+		panic("echo: read your writes middleware requires a tracker and a scope function")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.IsWrite == nil {
+		config.IsWrite = isSuccessfulWrite
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			scope := config.Scope(c)
+			if scope == "" {
+				return next(c)
+			}
+
+			ctx, err := config.Tracker.Context(c.Request().Context(), scope)
+			if err != nil {
+				c.Logger().Error(err)
+			}
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err = next(c)
+
+			if config.IsWrite(c, err) {
+				if err := config.Tracker.MarkWrite(c.Request().Context(), scope); err != nil {
+					c.Logger().Error(err)
+				}
+			}
+
+			return err
+		}
+	}
+}
+
+func isSuccessfulWrite(c echo.Context, err error) bool {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	return err == nil && c.Response().Status < http.StatusBadRequest
+}
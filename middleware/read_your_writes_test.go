@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := dbdrivers.NewRecentWriteTracker(&dbdrivers.RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}, time.Second)
+
+	e := echo.New()
+	e.Use(ReadYourWrites(ReadYourWritesConfig{
+		Tracker: tracker,
+		Scope:   func(c echo.Context) string { return c.Request().Header.Get("X-User") },
+	}))
+	primary := func(c echo.Context) error {
+		if dbdrivers.IsPrimaryRead(c.Request().Context()) {
+			return c.String(http.StatusOK, "primary")
+		}
+		return c.String(http.StatusOK, "replica")
+	}
+	e.GET("/", primary)
+	e.POST("/", primary)
+	e.PUT("/", func(c echo.Context) error { return echo.ErrBadRequest })
+
+	serve := func(method, user string) string {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "replica", serve(http.MethodGet, "alice"))
+
+	// A failed write doesn't set the primary read window.
+	serve(http.MethodPut, "alice")
+	assert.Equal(t, "replica", serve(http.MethodGet, "alice"))
+
+	assert.Equal(t, "replica", serve(http.MethodPost, "alice"))
+	assert.Equal(t, "primary", serve(http.MethodGet, "alice"))
+	assert.Equal(t, "replica", serve(http.MethodGet, "bob"))
+	assert.Equal(t, "replica", serve(http.MethodGet, ""))
+
+	mr.FastForward(time.Second)
+	assert.Equal(t, "replica", serve(http.MethodGet, "alice"))
+}
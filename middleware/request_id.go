@@ -0,0 +1,51 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// RequestID middleware sets the `X-Request-ID` header field if it doesn't exist and propagates the ID
+// into the request context (see `helpers.RequestIDFromContext`) for the context aware logger, the SQL
+// comments and the outbound requests of `httpclient`, and into the sentry scope as the `request_id` tag.
+// It must be used after the sentry middleware.
+func RequestID() echo.MiddlewareFunc {
+	return echomiddleware.RequestIDWithConfig(echomiddleware.RequestIDConfig{
+		Generator:        uuid.NewString,
+		RequestIDHandler: propagateRequestID,
+	})
+}
+
+func propagateRequestID(c echo.Context, id string) {
+	req := c.Request()
+	c.SetRequest(req.WithContext(helpers.WithRequestID(req.Context(), id)))
+
+	if hub := sentryecho.GetHubFromContext(c); hub != nil {
+		hub.Scope().SetTag("request_id", id)
+	}
+}
@@ -0,0 +1,293 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ResponseCacheConfig defines the config for ResponseCache middleware.
+type ResponseCacheConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// TTL is how long a response is served from the cache.
+	// Required.
+	TTL time.Duration
+
+	// Store keeps the cached responses.
+	// Optional. Default value an in-memory store of the process holding up to 10000 responses.
+	Store CacheStore
+
+	// KeyFunc returns the cache key of the request. The request is not cached if it returns an empty string.
+	// IMPORTANT: The default key doesn't contain the caller, don't use it for the responses which depend on
+	// the user.
+	// Optional. Default value the method and the URI of the request.
+	KeyFunc func(c echo.Context) string
+
+	// MaxBodyBytes is the maximum size of a cached response body.
+	// Optional. Default value 1MB.
+	MaxBodyBytes int
+}
+
+// CacheStore keeps the cached responses. `Get` returns `ErrCacheMiss` if the key doesn't exist.
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// ErrCacheMiss is returned by a `CacheStore` when the key doesn't exist or is expired.
+var ErrCacheMiss = errors.New("cache: key is missing")
+
+// DefaultResponseCacheConfig is the default ResponseCache middleware config.
+var DefaultResponseCacheConfig = ResponseCacheConfig{
+	Skipper:      middleware.DefaultSkipper,
+	MaxBodyBytes: 1 << 20,
+}
+
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// ResponseCache returns a middleware which serves the successful `GET` responses from the cache for `TTL`.
+// The `X-Cache` response header tells whether the response is a `HIT` or a `MISS`. The body is cached
+// before the compression of the outer middlewares, like `Gzip`, which compress the `HIT` responses again.
+func ResponseCache(config ResponseCacheConfig) echo.MiddlewareFunc {
+	if config.TTL <= 0 {
+		panic("echo: response cache middleware requires a positive ttl")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultResponseCacheConfig.Skipper
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryCacheStore(0)
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = responseCacheKey
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultResponseCacheConfig.MaxBodyBytes
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || c.Request().Method != http.MethodGet {
+				return next(c)
+			}
+
+			key := config.KeyFunc(c)
+			if key == "" {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+
+			if value, err := config.Store.Get(ctx, key); err == nil {
+				var cached cachedResponse
+				if err := json.Unmarshal(value, &cached); err == nil {
+					for name, values := range cached.Header {
+						c.Response().Header()[name] = values
+					}
+					c.Response().Header().Set("X-Cache", "HIT")
+					return c.Blob(cached.Status, cached.Header.Get(echo.HeaderContentType), cached.Body)
+				}
+			} else if !errors.Is(err, ErrCacheMiss) {
+				c.Logger().Error(err)
+			}
+
+			c.Response().Header().Set("X-Cache", "MISS")
+
+			w := &cacheWriter{ResponseWriter: c.Response().Writer, limit: config.MaxBodyBytes}
+			c.Response().Writer = w
+
+			if err := next(c); err != nil {
+				return err
+			}
+
+			if c.Response().Status != http.StatusOK || w.overflow {
+				return nil
+			}
+
+			// `Content-Encoding` is not kept, it's set by the compression of the outer middlewares.
+			header := http.Header{}
+			for _, name := range []string{echo.HeaderContentType, "Cache-Control", "ETag", "Last-Modified"} {
+				if value := c.Response().Header().Get(name); value != "" {
+					header.Set(name, value)
+				}
+			}
+
+			value, err := json.Marshal(cachedResponse{Status: c.Response().Status, Header: header, Body: w.body.Bytes()})
+			if err != nil {
+				return err
+			}
+			if err := config.Store.Set(ctx, key, value, config.TTL); err != nil {
+				c.Logger().Error(err)
+			}
+
+			return nil
+		}
+	}
+}
+
+func responseCacheKey(c echo.Context) string {
+	return c.Request().Method + " " + c.Request().URL.RequestURI()
+}
+
+// cacheWriter keeps a copy of the response body up to `limit` bytes.
+type cacheWriter struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// MemoryCacheStore is a `CacheStore` in the memory of the process. The expired entries are removed when
+// they are read or overwritten, and the least recently used one when the store is full.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	maxEntries int
+	now        func() time.Time
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCacheStore returns a new in-memory cache store holding up to `maxEntries` responses. (default 10000)
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	return &MemoryCacheStore{entries: make(map[string]*list.Element), lru: list.New(), maxEntries: maxEntries, now: time.Now}
+}
+
+// Get implements `CacheStore`.
+func (s *MemoryCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	entry := elem.Value.(*memoryCacheEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+		return nil, ErrCacheMiss
+	}
+	s.lru.MoveToFront(elem)
+
+	return entry.value, nil
+}
+
+// Set implements `CacheStore`.
+func (s *MemoryCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryCacheEntry{key: key, value: value, expiresAt: s.now().Add(ttl)}
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = entry
+		s.lru.MoveToFront(elem)
+		return nil
+	}
+
+	for s.lru.Len() >= s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+
+	return nil
+}
+
+// RedisCacheStore is a `CacheStore` shared by all the replicas.
+type RedisCacheStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCacheStore returns a cache store keeping the responses under `prefix`, "cache:" if `prefix`
+// is empty.
+func NewRedisCacheStore(client redis.UniversalClient, prefix string) *RedisCacheStore {
+	if prefix == "" {
+		prefix = "cache:"
+	}
+
+	return &RedisCacheStore{client: client, prefix: prefix}
+}
+
+// Get implements `CacheStore`.
+func (s *RedisCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+
+	return value, err
+}
+
+// Set implements `CacheStore`.
+func (s *RedisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
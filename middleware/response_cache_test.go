@@ -0,0 +1,103 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package middleware
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCacheCompressed(t *testing.T) {
+	large := strings.Repeat("bean ", 1000)
+
+	e := echo.New()
+	e.Use(Compress(CompressConfig{}))
+	e.GET("/large", func(c echo.Context) error {
+		return c.String(http.StatusOK, large)
+	}, ResponseCache(ResponseCacheConfig{TTL: time.Minute}))
+
+	serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("gzip")
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+
+	// The cached body is not compressed, it's compressed again for the clients accepting it.
+	rec = serve("")
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, large, rec.Body.String())
+
+	rec = serve("gzip")
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	r, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryCacheStore(2)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, s.Set(ctx, "b", []byte("2"), time.Minute))
+
+	// "a" is used more recently than "b", which is evicted.
+	_, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "c", []byte("3"), time.Minute))
+
+	_, err = s.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	value, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+	value, err = s.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(value))
+
+	now = now.Add(time.Minute)
+	_, err = s.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	assert.Equal(t, 1, s.lru.Len())
+}
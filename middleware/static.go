@@ -0,0 +1,161 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// StaticConfig defines the config for Static middleware.
+type StaticConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Root is the directory of the static files.
+	// Required.
+	Root string
+
+	// Prefix is the URL path under which the files are served.
+	// Optional. Default value "/".
+	Prefix string
+
+	// Index is the file served for a directory.
+	// Optional. Default value "index.html".
+	Index string
+
+	// SPA serves the root index file for the missing files which are not a registered route, for the
+	// single page applications using the history mode of their router.
+	// Optional. Default value false.
+	SPA bool
+
+	// MaxAge is the `Cache-Control` max age in seconds of the files except the index files, which are
+	// always revalidated so that a new deployment is picked up immediately.
+	// Optional. Default value 0. (no `Cache-Control` header)
+	MaxAge int
+
+	// Precompressed serves the `.br` or `.gz` file next to the requested one if the client accepts it.
+	// Optional. Default value false.
+	Precompressed bool
+}
+
+// DefaultStaticConfig is the default Static middleware config.
+var DefaultStaticConfig = StaticConfig{
+	Skipper: middleware.DefaultSkipper,
+	Prefix:  "/",
+	Index:   "index.html",
+}
+
+// precompressedEncodings are the supported encodings of the precompressed files, in order of preference.
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static returns a middleware which serves the files under `Root`. The registered routes always take
+// precedence over the files.
+func Static(config StaticConfig) echo.MiddlewareFunc {
+	if config.Root == "" {
+		panic("echo: static middleware requires a root directory")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultStaticConfig.Skipper
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultStaticConfig.Prefix
+	}
+	if config.Index == "" {
+		config.Index = DefaultStaticConfig.Index
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Skipper(c) || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			if !strings.HasPrefix(req.URL.Path, config.Prefix) || len(RouteMethods(req.URL.Path)) > 0 {
+				return next(c)
+			}
+
+			name := path.Clean("/" + strings.TrimPrefix(req.URL.Path, config.Prefix))
+			file := filepath.Join(config.Root, filepath.FromSlash(name))
+
+			info, err := os.Stat(file)
+			if err == nil && info.IsDir() {
+				file = filepath.Join(file, config.Index)
+				info, err = os.Stat(file)
+			}
+
+			if err != nil || info.IsDir() {
+				if !config.SPA || path.Ext(name) != "" {
+					return next(c)
+				}
+				file = filepath.Join(config.Root, config.Index)
+			}
+
+			if filepath.Base(file) == config.Index {
+				c.Response().Header().Set("Cache-Control", "no-cache")
+			} else if config.MaxAge > 0 {
+				c.Response().Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(config.MaxAge))
+			}
+
+			return serveStaticFile(c, file, config.Precompressed)
+		}
+	}
+}
+
+func serveStaticFile(c echo.Context, file string, precompressed bool) error {
+	if precompressed {
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+		accept := c.Request().Header.Get(echo.HeaderAcceptEncoding)
+		for _, p := range precompressedEncodings {
+			if !strings.Contains(accept, p.encoding) {
+				continue
+			}
+
+			if info, err := os.Stat(file + p.extension); err == nil && !info.IsDir() {
+				if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+					c.Response().Header().Set(echo.HeaderContentType, contentType)
+				}
+				c.Response().Header().Set(echo.HeaderContentEncoding, p.encoding)
+				return c.File(file + p.extension)
+			}
+		}
+	}
+
+	return c.File(file)
+}
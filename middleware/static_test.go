@@ -0,0 +1,73 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatic(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "assets"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<html></html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("plain"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "assets", "app.js.gz"), []byte("gzipped"), 0644))
+
+	e := echo.New()
+	e.Use(Static(StaticConfig{Root: root, SPA: true, MaxAge: 60, Precompressed: true}))
+
+	serve := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/assets/app.js")
+	assert.Equal(t, "plain", rec.Body.String())
+	assert.Equal(t, "public, max-age=60", rec.Header().Get("Cache-Control"))
+
+	rec = serve("/assets/app.js", echo.HeaderAcceptEncoding, "gzip, deflate")
+	assert.Equal(t, "gzipped", rec.Body.String())
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), "javascript")
+
+	// The history mode routes of the SPA fall back to the index.
+	rec = serve("/orders/1")
+	assert.Equal(t, "<html></html>", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	// A missing asset is not the index.
+	rec = serve("/assets/missing.js")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,174 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TenantLabelsConfig defines the config for `NewTenantLabels`.
+type TenantLabelsConfig struct {
+	// TopN is the number of the busiest tenants which have their own label, the others share `Other`.
+	// Optional. Default value 20.
+	TopN int
+
+	// Pinned are the tenants which always have their own label, on top of `TopN`.
+	// Optional. Default value nil.
+	Pinned []string
+
+	// Interval between two rankings of the tenants by their number of requests.
+	// Optional. Default value 10m.
+	Interval time.Duration
+
+	// Other is the label of the tenants which are not in the top.
+	// Optional. Default value "other".
+	Other string
+}
+
+// DefaultTenantLabelsConfig is the default config of `NewTenantLabels`.
+var DefaultTenantLabelsConfig = TenantLabelsConfig{
+	TopN:     20,
+	Interval: 10 * time.Minute,
+	Other:    "other",
+}
+
+// TenantLabels bounds the cardinality of the tenant label of the metrics: the `TopN` tenants with the
+// most requests during the last interval have their own label, the others are bucketed as `Other`. Until
+// the first ranking, the first `TopN` tenants seen have their own label. The ranking only changes once
+// per interval so that the series of a tenant don't flap.
+type TenantLabels struct {
+	config TenantLabelsConfig
+	pinned map[string]bool
+
+	mu       sync.Mutex
+	counts   map[string]uint64
+	top      map[string]bool
+	rankedAt time.Time
+	now      func() time.Time
+}
+
+// NewTenantLabels returns the tenant labels of `config`, the zero fields are set to the defaults.
+func NewTenantLabels(config TenantLabelsConfig) *TenantLabels {
+	if config.TopN <= 0 {
+		config.TopN = DefaultTenantLabelsConfig.TopN
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultTenantLabelsConfig.Interval
+	}
+	if config.Other == "" {
+		config.Other = DefaultTenantLabelsConfig.Other
+	}
+
+	l := &TenantLabels{
+		config: config,
+		pinned: make(map[string]bool, len(config.Pinned)),
+		counts: make(map[string]uint64),
+		top:    make(map[string]bool),
+		now:    time.Now,
+	}
+	for _, tenant := range config.Pinned {
+		l.pinned[tenant] = true
+	}
+	l.rankedAt = l.now()
+
+	return l
+}
+
+// Observe counts a request of `tenant` for the ranking and returns its label.
+func (l *TenantLabels) Observe(tenant string) string {
+	if tenant == "" || l.pinned[tenant] {
+		return tenant
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rank()
+	l.counts[tenant]++
+
+	// Fill the top with the first tenants seen until the first ranking.
+	if !l.top[tenant] && len(l.top) < l.config.TopN {
+		l.top[tenant] = true
+	}
+
+	return l.label(tenant)
+}
+
+// Label returns the label of `tenant` without counting a request, for the metrics which are not
+// requests. (example: the connection pools)
+func (l *TenantLabels) Label(tenant string) string {
+	if tenant == "" || l.pinned[tenant] {
+		return tenant
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rank()
+
+	return l.label(tenant)
+}
+
+func (l *TenantLabels) label(tenant string) string {
+	if l.top[tenant] {
+		return tenant
+	}
+
+	return l.config.Other
+}
+
+// rank recomputes the top tenants from the requests of the last interval once it's over.
+func (l *TenantLabels) rank() {
+	now := l.now()
+	if now.Sub(l.rankedAt) < l.config.Interval {
+		return
+	}
+	l.rankedAt = now
+
+	// A quiet interval keeps the previous top rather than emptying it.
+	if len(l.counts) == 0 {
+		return
+	}
+
+	tenants := make([]string, 0, len(l.counts))
+	for tenant := range l.counts {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if l.counts[tenants[i]] != l.counts[tenants[j]] {
+			return l.counts[tenants[i]] > l.counts[tenants[j]]
+		}
+		return tenants[i] < tenants[j]
+	})
+	if len(tenants) > l.config.TopN {
+		tenants = tenants[:l.config.TopN]
+	}
+
+	l.top = make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		l.top[tenant] = true
+	}
+	l.counts = make(map[string]uint64, len(l.counts))
+}
@@ -0,0 +1,61 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantLabels(t *testing.T) {
+	now := time.Now()
+	l := NewTenantLabels(TenantLabelsConfig{TopN: 2, Pinned: []string{"master"}, Interval: time.Minute})
+	l.now = func() time.Time { return now }
+	l.rankedAt = now
+
+	// The first tenants seen fill the top until the first ranking.
+	assert.Equal(t, "1", l.Observe("1"))
+	assert.Equal(t, "2", l.Observe("2"))
+	assert.Equal(t, "other", l.Observe("3"))
+	assert.Equal(t, "master", l.Observe("master"))
+	assert.Equal(t, "", l.Observe(""))
+
+	for i := 0; i < 5; i++ {
+		l.Observe("3")
+	}
+	l.Observe("2")
+
+	// The ranking doesn't change until the end of the interval.
+	assert.Equal(t, "other", l.Label("3"))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, "3", l.Label("3"))
+	assert.Equal(t, "2", l.Label("2"))
+	assert.Equal(t, "other", l.Label("1"))
+
+	// A quiet interval keeps the top.
+	now = now.Add(time.Minute)
+	assert.Equal(t, "3", l.Label("3"))
+}
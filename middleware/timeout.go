@@ -0,0 +1,152 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+// TimeoutConfig defines the config for Timeout middleware.
+type TimeoutConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Timeout is the default deadline of the requests.
+	// Required.
+	Timeout time.Duration
+
+	// Groups overrides `Timeout` for the routes under a path prefix, like "/reports". The longest matching
+	// prefix wins, a zero or negative timeout disables the deadline. (example: server-sent events)
+	// Optional. Default value nil.
+	Groups map[string]time.Duration
+
+	// StatusCode is the status of a timed out request, `504 Gateway Timeout` or `503 Service Unavailable`.
+	// Optional. Default value 504.
+	StatusCode int
+}
+
+// ErrRequestTimeout is returned when a request doesn't finish before its deadline.
+var ErrRequestTimeout = errors.New("request timeout")
+
+var (
+	routeTimeoutsMu sync.RWMutex
+	routeTimeouts   = make(map[string]time.Duration)
+)
+
+// RegisterRouteTimeout overrides the timeout of a single route, it has priority over `TimeoutConfig.Groups`.
+// `path` is the registered route path, like "/orders/:id".
+func RegisterRouteTimeout(method, path string, timeout time.Duration) {
+	routeTimeoutsMu.Lock()
+	defer routeTimeoutsMu.Unlock()
+
+	routeTimeouts[method+" "+path] = timeout
+}
+
+// Timeout returns a middleware which cancels the request context at the deadline, so that the gorm,
+// mongo and redis queries of the handler stop, and replies a retryable `APIError` if the handler
+// hasn't responded yet.
+// IMPORTANT: The handler is not preempted, a handler which doesn't use the request context keeps running
+// until it returns.
+func Timeout(config TimeoutConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.StatusCode == 0 {
+		config.StatusCode = http.StatusGatewayTimeout
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			timeout := config.timeout(c)
+			if timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) || c.Response().Committed {
+				return err
+			}
+
+			if hub := sentryecho.GetHubFromContext(c); hub != nil {
+				hub.AddBreadcrumb(&sentry.Breadcrumb{
+					Category: "http.timeout",
+					Message:  "request timed out after " + timeout.String(),
+					Level:    sentry.LevelWarning,
+					Data: map[string]interface{}{
+						"method": c.Request().Method,
+						"path":   c.Path(),
+					},
+				}, nil)
+			}
+
+			code := berror.TIMEOUT
+			if config.StatusCode == http.StatusServiceUnavailable {
+				code = berror.SERVICE_UNAVAILABLE
+			}
+
+			apiErr := berror.NewAPIError(config.StatusCode, code, ErrRequestTimeout)
+			apiErr.Retryable = true
+
+			return apiErr
+		}
+	}
+}
+
+func (config TimeoutConfig) timeout(c echo.Context) time.Duration {
+	routeTimeoutsMu.RLock()
+	timeout, ok := routeTimeouts[c.Request().Method+" "+c.Path()]
+	routeTimeoutsMu.RUnlock()
+	if ok {
+		return timeout
+	}
+
+	timeout = config.Timeout
+	longest := -1
+	for prefix, t := range config.Groups {
+		if strings.HasPrefix(c.Path(), prefix) && len(prefix) > longest {
+			timeout, longest = t, len(prefix)
+		}
+	}
+
+	return timeout
+}
@@ -0,0 +1,78 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	e := echo.New()
+	e.Use(Timeout(TimeoutConfig{
+		Timeout: 10 * time.Millisecond,
+		Groups:  map[string]time.Duration{"/stream": 0},
+	}))
+
+	slow := func(c echo.Context) error {
+		select {
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		case <-time.After(50 * time.Millisecond):
+			return c.NoContent(http.StatusOK)
+		}
+	}
+	e.GET("/slow", slow)
+	e.GET("/stream", slow)
+	e.GET("/report", slow)
+	RegisterRouteTimeout(http.MethodGet, "/report", time.Second)
+
+	var handled error
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		handled = err
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		handled = nil
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	serve("/slow")
+	var apiErr *berror.APIError
+	if assert.True(t, errors.As(handled, &apiErr)) {
+		assert.Equal(t, http.StatusGatewayTimeout, apiErr.HTTPStatusCode)
+		assert.True(t, apiErr.Retryable)
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/stream").Code)
+	assert.Equal(t, http.StatusOK, serve("/report").Code)
+}
@@ -32,8 +32,41 @@ import (
 	"github.com/spf13/viper"
 )
 
+// TracerConfig defines the config for Tracer middleware.
+type TracerConfig struct {
+	// SkipEndpoints are the regular expressions of the paths whose spans are not sampled.
+	// Optional. Default value nil.
+	SkipEndpoints []string
+}
+
 // Tracer attach a root sentry span context to the request.
+// Deprecated: it reads `sentry.skipTracesEndpoints` from the global viper config on every request, use
+// `TracerWithConfig`.
 func Tracer() echo.MiddlewareFunc {
+	mw := tracer(func() []*regexp.Regexp {
+		return compileEndpoints(viper.GetStringSlice("sentry.skipTracesEndpoints"))
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc { return mw(next) }
+}
+
+// TracerWithConfig returns a Tracer middleware with config.
+func TracerWithConfig(config TracerConfig) echo.MiddlewareFunc {
+	skip := compileEndpoints(config.SkipEndpoints)
+	mw := tracer(func() []*regexp.Regexp { return skip })
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc { return mw(next) }
+}
+
+func compileEndpoints(endpoints []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		res = append(res, regexp.MustCompile(endpoint))
+	}
+	return res
+}
+
+func tracer(skipEndpoints func() []*regexp.Regexp) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			var ctx = c.Request().Context()
@@ -51,9 +84,8 @@ func Tracer() echo.MiddlewareFunc {
 			span.Description = helpers.CurrFuncName()
 
 			// If `skipTracesEndpoints` has some path(s) then let's skip performance sample for those URI.
-			skipTracesEndpoints := viper.GetStringSlice("sentry.skipTracesEndpoints")
-			for _, endpoint := range skipTracesEndpoints {
-				if regexp.MustCompile(endpoint).MatchString(path) {
+			for _, endpoint := range skipEndpoints() {
+				if endpoint.MatchString(path) {
 					span.Sampled = sentry.SampledFalse
 					break
 				}
@@ -0,0 +1,507 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+type (
+	// VerifyConfig defines the config for VerifyHandler.
+	VerifyConfig struct {
+		// Skipper defines a function to skip the verification, only the old handler is run.
+		Skipper middleware.Skipper
+
+		// SampleRate is the ratio of the requests which are verified, between 0 and 1.
+		// Optional. Default value 1.
+		SampleRate float64
+
+		// Timeout of the new handler.
+		// Optional. Default value 10s.
+		Timeout time.Duration
+
+		// MaxBodyBytes is the maximum size of the request and response bodies to verify. The larger
+		// requests are not verified.
+		// Optional. Default value 1MB.
+		MaxBodyBytes int
+
+		// IgnoredPaths are the JSON paths not compared, like `meta.generated_at` or `items[*].updated_at`.
+		// Optional.
+		IgnoredPaths []string
+
+		// MaskedParameters are the JSON paths whose values are masked in the reported diffs, with the same
+		// syntax as `LoggerConfig.MaskedParameters`.
+		// Optional.
+		MaskedParameters []string
+
+		// MaskStrategy is how the values are masked, `redact`, `hash` or `partial`.
+		// Optional. Default value `redact`.
+		MaskStrategy string
+
+		// MaxDiffs is the maximum number of differences in a report.
+		// Optional. Default value 20.
+		MaxDiffs int
+
+		// Reporter receives the report of every verified request. The mismatches are logged as well.
+		// Optional.
+		Reporter func(report VerifyReport)
+
+		// Subsystem is the prefix of the metric names.
+		// Optional. Default value "echo".
+		Subsystem string
+
+		// Registerer holds the metrics.
+		// Optional. Default value prometheus.DefaultRegisterer.
+		Registerer prometheus.Registerer
+	}
+
+	// VerifyReport is the comparison of the old and the new responses of a request.
+	VerifyReport struct {
+		Method    string       `json:"method"`
+		Path      string       `json:"path"`
+		OldStatus int          `json:"old_status"`
+		NewStatus int          `json:"new_status"`
+		Diffs     []VerifyDiff `json:"diffs,omitempty"`
+		// Truncated is true if there are more than `MaxDiffs` differences.
+		Truncated bool `json:"truncated,omitempty"`
+		// Error is the error returned by the new handler, if any.
+		Error string `json:"error,omitempty"`
+	}
+
+	// VerifyDiff is a difference between the old and the new responses. `Path` is like `items.0.price`,
+	// the status and the non-JSON bodies are reported as `$status` and `$body`.
+	VerifyDiff struct {
+		Path string      `json:"path"`
+		Kind string      `json:"kind"`
+		Old  interface{} `json:"old,omitempty"`
+		New  interface{} `json:"new,omitempty"`
+	}
+)
+
+// Kinds of `VerifyDiff`.
+const (
+	DiffChanged = "changed"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// Results of the `verify_requests_total` metric.
+const (
+	verifyMatch    = "match"
+	verifyMismatch = "mismatch"
+	verifyError    = "error"
+)
+
+// DefaultVerifyConfig is the default VerifyHandler config.
+var DefaultVerifyConfig = VerifyConfig{
+	Skipper:      middleware.DefaultSkipper,
+	SampleRate:   1,
+	Timeout:      10 * time.Second,
+	MaxBodyBytes: 1 << 20,
+	MaskStrategy: MaskRedact,
+	MaxDiffs:     20,
+	Subsystem:    "echo",
+}
+
+// Match reports whether the new response is the same as the old one.
+func (r VerifyReport) Match() bool {
+	return len(r.Diffs) == 0
+}
+
+// VerifyHandler returns a handler which serves the response of `old` and compares the response of `new`
+// for the same request to it.
+func VerifyHandler(old, new echo.HandlerFunc) echo.HandlerFunc {
+	return VerifyHandlerWithConfig(old, new, DefaultVerifyConfig)
+}
+
+// VerifyHandlerWithConfig returns a handler which serves the response of `old` and, in the background,
+// runs `new` for the same request and compares the responses structurally so that a critical endpoint
+// can be refactored safely. The mismatches are logged with their masked values and counted by the
+// `verify_requests_total` metric. Example:
+//
+//	e.GET("/orders/:id", middleware.VerifyHandler(orderHandler.GetV1, orderHandler.GetV2))
+//
+// IMPORTANT: Both handlers are run for every verified request, only verify the read-only endpoints or
+// make `new` free of side effects. `new` is run with a copy of the request, the path parameters and
+// the request ID but without the other values set to the context by the middlewares.
+// If `old` returns an error, only the status codes are compared as its response is written later by
+// the HTTP error handler.
+func VerifyHandlerWithConfig(old, new echo.HandlerFunc, config VerifyConfig) echo.HandlerFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultVerifyConfig.Skipper
+	}
+	if config.SampleRate <= 0 {
+		config.SampleRate = DefaultVerifyConfig.SampleRate
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultVerifyConfig.Timeout
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultVerifyConfig.MaxBodyBytes
+	}
+	if config.MaskStrategy == "" {
+		config.MaskStrategy = DefaultVerifyConfig.MaskStrategy
+	}
+	if config.MaxDiffs <= 0 {
+		config.MaxDiffs = DefaultVerifyConfig.MaxDiffs
+	}
+	if config.Subsystem == "" {
+		config.Subsystem = DefaultVerifyConfig.Subsystem
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+
+	ignored := parseMaskRules(config.IgnoredPaths, MaskRedact)
+	masked := parseMaskRules(config.MaskedParameters, config.MaskStrategy)
+
+	verified := helpers.RegisterCollector(config.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: config.Subsystem,
+		Name:      "verify_requests_total",
+		Help:      "How many requests have been verified against a new handler, partitioned by the result.",
+	}, []string{"method", "url", "result"}))
+
+	return func(c echo.Context) error {
+		if config.Skipper(c) || rand.Float64() >= config.SampleRate {
+			return old(c)
+		}
+
+		req := c.Request()
+		if req.ContentLength > int64(config.MaxBodyBytes) {
+			return old(c)
+		}
+
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			b, err := io.ReadAll(io.LimitReader(req.Body, int64(config.MaxBodyBytes)+1))
+			if err != nil {
+				return err
+			}
+			body = b
+			req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(b), req.Body))
+			if len(b) > config.MaxBodyBytes {
+				return old(c)
+			}
+		}
+
+		// The request is copied before `old` is run, the context is reused by echo once it returns.
+		ctx, cancel := context.WithTimeout(helpers.WithRequestID(context.Background(), helpers.RequestIDFromContext(req.Context())), config.Timeout)
+		shadowReq := req.Clone(ctx)
+		shadowReq.Body = io.NopCloser(bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		shadow := c.Echo().NewContext(shadowReq, rec)
+		shadow.SetPath(c.Path())
+		shadow.SetParamNames(c.ParamNames()...)
+		shadow.SetParamValues(c.ParamValues()...)
+
+		w := &cacheWriter{ResponseWriter: c.Response().Writer, limit: config.MaxBodyBytes}
+		c.Response().Writer = w
+
+		err := old(c)
+
+		c.Response().Writer = w.ResponseWriter
+		oldStatus := responseStatus(c, err)
+		oldHeader := c.Response().Header().Clone()
+		var oldBody []byte
+		if err == nil && !w.overflow {
+			oldBody = append([]byte(nil), w.body.Bytes()...)
+		}
+		if err == nil && w.overflow {
+			cancel()
+			return nil
+		}
+
+		e := c.Echo()
+		method, path := req.Method, c.Path()
+
+		go func() {
+			defer cancel()
+
+			report := VerifyReport{Method: method, Path: path, OldStatus: oldStatus}
+
+			newErr := runShadow(e, shadow, new)
+			report.NewStatus = responseStatus(shadow, newErr)
+			if newErr != nil {
+				report.Error = newErr.Error()
+			}
+
+			if report.NewStatus != report.OldStatus {
+				report.Diffs = append(report.Diffs, VerifyDiff{Path: "$status", Kind: DiffChanged, Old: report.OldStatus, New: report.NewStatus})
+			}
+			if err == nil && newErr == nil {
+				d := &differ{max: config.MaxDiffs, masked: masked}
+				d.compareBodies(oldHeader, oldBody, rec.Header(), rec.Body.Bytes(), ignored)
+				report.Diffs = append(report.Diffs, d.diffs...)
+				report.Truncated = d.truncated
+			}
+
+			result := verifyMatch
+			if newErr != nil && err == nil {
+				result = verifyError
+			} else if !report.Match() {
+				result = verifyMismatch
+			}
+			verified.WithLabelValues(method, path, result).Inc()
+
+			if result != verifyMatch {
+				if b, err := json.Marshal(report); err == nil {
+					e.Logger.Warnf("verify: the new handler of %s %s doesn't match: %s", method, path, b)
+				}
+			}
+
+			if config.Reporter != nil {
+				config.Reporter(report)
+			}
+		}()
+
+		return err
+	}
+}
+
+// runShadow runs the new handler, a panic is reported as an internal server error.
+func runShadow(e *echo.Echo, c echo.Context, h echo.HandlerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = echo.NewHTTPError(http.StatusInternalServerError, r)
+		}
+	}()
+
+	return h(c)
+}
+
+// differ collects the structural differences of two JSON documents. The values are compared as they
+// are and masked only when they are reported.
+type differ struct {
+	diffs     []VerifyDiff
+	max       int
+	truncated bool
+	masked    []maskRule
+}
+
+func (d *differ) add(path []string, key, kind string, old, new interface{}) {
+	if len(d.diffs) >= d.max {
+		d.truncated = true
+		return
+	}
+
+	full := append(append([]string(nil), path...), key)
+	if key == "" {
+		full = full[:len(full)-1]
+	}
+
+	d.diffs = append(d.diffs, VerifyDiff{
+		Path: strings.Join(full, "."),
+		Kind: kind,
+		Old:  d.mask(full, old),
+		New:  d.mask(full, new),
+	})
+}
+
+// mask masks `value` at `path` if it or any of its descendants matches the masked parameters.
+func (d *differ) mask(path []string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	for _, rule := range d.masked {
+		if !matchPrefix(rule.path, path) {
+			continue
+		}
+		if len(rule.path) <= len(path) {
+			return maskValue(value, rule.strategy)
+		}
+		// A descendant is masked, the value is copied as the documents are compared after it.
+		value = copyJSON(value)
+		maskPath(value, rule.path[len(path):], rule.strategy)
+	}
+
+	return value
+}
+
+// matchPrefix reports whether the shorter of `rule` and `path` is a prefix of the other one.
+func matchPrefix(rule, path []string) bool {
+	for i := 0; i < len(rule) && i < len(path); i++ {
+		if rule[i] != "*" && rule[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = copyJSON(value)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, value := range v {
+			a[i] = copyJSON(value)
+		}
+		return a
+	}
+	return value
+}
+
+func (d *differ) compareBodies(oldHeader http.Header, oldBody []byte, newHeader http.Header, newBody []byte, ignored []maskRule) {
+	oldDoc, oldOK := decodeJSON(oldHeader, oldBody)
+	newDoc, newOK := decodeJSON(newHeader, newBody)
+	if !oldOK || !newOK {
+		if !bytes.Equal(oldBody, newBody) {
+			d.add(nil, "$body", DiffChanged, nil, nil)
+		}
+		return
+	}
+
+	for _, rule := range ignored {
+		removePath(oldDoc, rule.path)
+		removePath(newDoc, rule.path)
+	}
+
+	d.compare(nil, oldDoc, newDoc)
+}
+
+func (d *differ) compare(path []string, old, new interface{}) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(o)+len(n))
+		for key := range o {
+			keys = append(keys, key)
+		}
+		for key := range n {
+			if _, ok := o[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			ov, inOld := o[key]
+			nv, inNew := n[key]
+			switch {
+			case !inNew:
+				d.add(path, key, DiffRemoved, ov, nil)
+			case !inOld:
+				d.add(path, key, DiffAdded, nil, nv)
+			default:
+				d.compare(append(path[:len(path):len(path)], key), ov, nv)
+			}
+		}
+		return
+
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(o) || i < len(n); i++ {
+			key := strconv.Itoa(i)
+			switch {
+			case i >= len(n):
+				d.add(path, key, DiffRemoved, o[i], nil)
+			case i >= len(o):
+				d.add(path, key, DiffAdded, nil, n[i])
+			default:
+				d.compare(append(path[:len(path):len(path)], key), o[i], n[i])
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		d.add(path, "", DiffChanged, old, new)
+	}
+}
+
+// decodeJSON decodes the body if it's JSON, the numbers are kept as they are.
+func decodeJSON(header http.Header, body []byte) (interface{}, bool) {
+	if !strings.Contains(header.Get(echo.HeaderContentType), "json") {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+
+	return doc, true
+}
+
+// removePath removes the values at `path` in place.
+func removePath(node interface{}, path []string) {
+	segment, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if last {
+				delete(n, key)
+			} else {
+				removePath(value, path[1:])
+			}
+		}
+
+	case []interface{}:
+		for i, value := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				n[i] = nil
+			} else {
+				removePath(value, path[1:])
+			}
+		}
+	}
+}
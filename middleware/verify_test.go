@@ -0,0 +1,147 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveVerify(t *testing.T, old, new echo.HandlerFunc, config VerifyConfig, body string) (*httptest.ResponseRecorder, VerifyReport, *prometheus.Registry) {
+	t.Helper()
+
+	reports := make(chan VerifyReport, 1)
+	registry := prometheus.NewRegistry()
+	config.Registerer = registry
+	config.Reporter = func(report VerifyReport) { reports <- report }
+
+	e := echo.New()
+	e.POST("/orders/:id", VerifyHandlerWithConfig(old, new, config))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/42", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	select {
+	case report := <-reports:
+		return rec, report, registry
+	case <-time.After(time.Second):
+		t.Fatal("the new handler has not been verified")
+	}
+
+	return nil, VerifyReport{}, nil
+}
+
+func TestVerifyHandlerMatch(t *testing.T) {
+	handler := func(c echo.Context) error {
+		var in struct {
+			Qty int `json:"qty"`
+		}
+		if err := c.Bind(&in); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id"), "qty": in.Qty})
+	}
+
+	rec, report, registry := serveVerify(t, handler, handler, VerifyConfig{}, `{"qty":3}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"42","qty":3}`, rec.Body.String())
+	assert.True(t, report.Match())
+	assert.Equal(t, "/orders/:id", report.Path)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP echo_verify_requests_total How many requests have been verified against a new handler, partitioned by the result.
+# TYPE echo_verify_requests_total counter
+echo_verify_requests_total{method="POST",result="match",url="/orders/:id"} 1
+`), "echo_verify_requests_total"))
+}
+
+func TestVerifyHandlerMismatch(t *testing.T) {
+	old := func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"id":    c.Param("id"),
+			"total": 100,
+			"card":  map[string]string{"number": "4242424242424242"},
+			"meta":  map[string]string{"generated_at": "1"},
+			"items": []string{"a", "b"},
+		})
+	}
+	new := func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"id":    c.Param("id"),
+			"total": 110,
+			"card":  map[string]string{"number": "4111111111111111"},
+			"meta":  map[string]string{"generated_at": "2"},
+			"items": []string{"a"},
+			"note":  "new",
+		})
+	}
+
+	rec, report, _ := serveVerify(t, old, new, VerifyConfig{
+		IgnoredPaths:     []string{"meta.generated_at"},
+		MaskedParameters: []string{"card.number:partial"},
+	}, "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"total":100`)
+
+	require.False(t, report.Match())
+	assert.Equal(t, []VerifyDiff{
+		{Path: "card.number", Kind: DiffChanged, Old: "************4242", New: "************1111"},
+		{Path: "items.1", Kind: DiffRemoved, Old: "b"},
+		{Path: "note", Kind: DiffAdded, New: "new"},
+		{Path: "total", Kind: DiffChanged, Old: json.Number("100"), New: json.Number("110")},
+	}, report.Diffs)
+}
+
+func TestVerifyHandlerNewError(t *testing.T) {
+	old := func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}
+	new := func(c echo.Context) error {
+		panic("boom")
+	}
+
+	rec, report, registry := serveVerify(t, old, new, VerifyConfig{}, "")
+
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, http.StatusInternalServerError, report.NewStatus)
+	assert.Contains(t, report.Error, "boom")
+	assert.Equal(t, []VerifyDiff{{Path: "$status", Kind: DiffChanged, Old: http.StatusOK, New: http.StatusInternalServerError}}, report.Diffs)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP echo_verify_requests_total How many requests have been verified against a new handler, partitioned by the result.
+# TYPE echo_verify_requests_total counter
+echo_verify_requests_total{method="POST",result="error",url="/orders/:id"} 1
+`), "echo_verify_requests_total"))
+}
@@ -0,0 +1,340 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/url"
+)
+
+// Stages of a middleware in a `RouteChain`, in the order they are executed.
+const (
+	MiddlewareStagePre    = "pre"    // Executed before the router. (`echo.Pre`)
+	MiddlewareStageGlobal = "global" // Executed for every route. (`echo.Use`)
+	MiddlewareStageRoute  = "route"  // Executed for the route only. (the route options)
+)
+
+// MiddlewareInfo describes a middleware in the chain of a route.
+type MiddlewareInfo struct {
+	Name  string
+	Stage string
+
+	// BuiltIn is false for the middlewares added by the application. (`UseMiddlewares`, `WithMiddleware`)
+	BuiltIn bool
+
+	// Config is the effective config of the middleware, without the secrets.
+	Config map[string]interface{}
+
+	// Skipped is true if the route matches one of the `skipEndpoints` of the middleware.
+	Skipped bool
+}
+
+// RouteChain is the ordered list of the middlewares executed before the handler of a route.
+type RouteChain struct {
+	Method      string
+	Path        string
+	Name        string
+	Handler     string
+	Middlewares []MiddlewareInfo
+}
+
+type middlewareEntry struct {
+	info          MiddlewareInfo
+	skipEndpoints []string
+}
+
+type routeEntry struct {
+	handler     string
+	middlewares []MiddlewareInfo
+	timeout     *time.Duration
+}
+
+// The middlewares are recorded per echo instance as echo doesn't expose them.
+var (
+	middlewareChainsMu  sync.RWMutex
+	globalMiddlewares   = map[*echo.Echo][]middlewareEntry{}
+	routeMiddlewares    = map[*echo.Echo]map[string]routeEntry{}
+	disabledMiddlewares = map[*echo.Echo][]string{}
+)
+
+// MiddlewareToggle enables a built-in middleware in some environments only, the middleware is still
+// registered only if its own settings turn it on. (example: `access.on`)
+type MiddlewareToggle struct {
+	// On are the environments in which the middleware is enabled, it's disabled in the other ones.
+	// Optional. Default value nil, all the environments.
+	On []string
+
+	// Off are the environments in which the middleware is disabled.
+	// Optional. Default value nil.
+	Off []string
+}
+
+// Enabled returns true if the middleware is enabled in the environment `env`.
+func (t MiddlewareToggle) Enabled(env string) bool {
+	if helpers.HasStringInSlice(t.Off, env, nil) {
+		return false
+	}
+
+	return t.On == nil || helpers.HasStringInSlice(t.On, env, nil)
+}
+
+// middlewareToggle returns the toggle of the built-in middleware `name`. The names are case insensitive
+// as viper lowercases the keys of the maps.
+func middlewareToggle(name string) (MiddlewareToggle, bool) {
+	for n, toggle := range BeanConfig.Middlewares {
+		if strings.EqualFold(n, name) {
+			return toggle, true
+		}
+	}
+
+	return MiddlewareToggle{}, false
+}
+
+// toggledOff returns true if `middlewares.<name>` disables the built-in middleware `name` in the current
+// environment, and records it for `logMiddlewares`.
+func toggledOff(e *echo.Echo, name string) bool {
+	toggle, ok := middlewareToggle(name)
+	if !ok || toggle.Enabled(BeanConfig.Environment) {
+		return false
+	}
+
+	middlewareChainsMu.Lock()
+	defer middlewareChainsMu.Unlock()
+
+	disabledMiddlewares[e] = append(disabledMiddlewares[e], name)
+
+	return true
+}
+
+// useMiddleware adds a built-in middleware to `e` and records it for `MiddlewareChain`, unless it's
+// toggled off in the current environment.
+func useMiddleware(e *echo.Echo, name string, config map[string]interface{}, skipEndpoints []string, m echo.MiddlewareFunc) {
+	if toggledOff(e, name) {
+		return
+	}
+
+	recordMiddleware(e, MiddlewareInfo{Name: name, Stage: MiddlewareStageGlobal, BuiltIn: true, Config: config}, skipEndpoints)
+	e.Use(m)
+}
+
+// preMiddleware adds a built-in middleware executed before the router to `e` and records it for
+// `MiddlewareChain`, unless it's toggled off in the current environment.
+func preMiddleware(e *echo.Echo, name string, config map[string]interface{}, m echo.MiddlewareFunc) {
+	if toggledOff(e, name) {
+		return
+	}
+
+	recordMiddleware(e, MiddlewareInfo{Name: name, Stage: MiddlewareStagePre, BuiltIn: true, Config: config}, nil)
+	e.Pre(m)
+}
+
+// logMiddlewares logs the effective built-in middlewares of the environment and the ones disabled by
+// `middlewares`, and warns about the toggles which match no built-in middleware, a typo most likely.
+func (b *Bean) logMiddlewares() {
+	middlewareChainsMu.RLock()
+	var enabled []string
+	for _, entry := range globalMiddlewares[b.Echo] {
+		if entry.info.BuiltIn {
+			enabled = append(enabled, entry.info.Name)
+		}
+	}
+	disabled := append([]string(nil), disabledMiddlewares[b.Echo]...)
+	middlewareChainsMu.RUnlock()
+
+	b.Echo.Logger.Infof("middlewares of the %q environment: %s (disabled: %s)", BeanConfig.Environment,
+		strings.Join(enabled, ", "), strings.Join(disabled, ", "))
+
+	for name := range BeanConfig.Middlewares {
+		if strings.EqualFold(name, "BodyDump") {
+			continue
+		}
+		if !helpers.HasStringInSlice(enabled, name, strings.ToLower) && !helpers.HasStringInSlice(disabled, name, strings.ToLower) {
+			b.Echo.Logger.Warnf("middlewares: %q is not a registered built-in middleware, it may be turned off by its own settings", name)
+		}
+	}
+}
+
+func recordMiddleware(e *echo.Echo, info MiddlewareInfo, skipEndpoints []string) {
+	middlewareChainsMu.Lock()
+	defer middlewareChainsMu.Unlock()
+
+	globalMiddlewares[e] = append(globalMiddlewares[e], middlewareEntry{info: info, skipEndpoints: skipEndpoints})
+}
+
+// forgetMiddlewares removes the middlewares recorded for `e`, when its bean instance is stopped.
+func forgetMiddlewares(e *echo.Echo) {
+	middlewareChainsMu.Lock()
+	defer middlewareChainsMu.Unlock()
+
+	delete(globalMiddlewares, e)
+	delete(routeMiddlewares, e)
+	delete(disabledMiddlewares, e)
+}
+
+func recordRoute(e *echo.Echo, method, path string, entry routeEntry) {
+	middlewareChainsMu.Lock()
+	defer middlewareChainsMu.Unlock()
+
+	if routeMiddlewares[e] == nil {
+		routeMiddlewares[e] = map[string]routeEntry{}
+	}
+	routeMiddlewares[e][method+" "+path] = entry
+}
+
+// MiddlewareChain returns the middlewares executed, in order, before the handler of the route matching
+// `method` and `path`. The path can be the registered path, like `/users/:id`, or a request path, like
+// `/users/42`. The middlewares added directly on an echo group are not listed.
+func (b *Bean) MiddlewareChain(method, path string) (RouteChain, bool) {
+	var matched *echo.Route
+	for _, r := range b.Echo.Routes() {
+		if r.Method == method && r.Path == path {
+			matched = r
+			break
+		}
+	}
+
+	if matched == nil {
+		for _, r := range b.Echo.Routes() {
+			p := url.New(r.Path)
+			if _, ok := p.Match(path); ok && r.Method == method {
+				matched = r
+				break
+			}
+		}
+	}
+
+	if matched == nil {
+		return RouteChain{}, false
+	}
+
+	return b.middlewareChain(matched, path), true
+}
+
+// MiddlewareChains returns the middleware chain of every registered route, sorted by path and method.
+func (b *Bean) MiddlewareChains() []RouteChain {
+	routes := b.Echo.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+
+	chains := make([]RouteChain, 0, len(routes))
+	for _, r := range routes {
+		// `echo.Any` and the not found routes of echo are registered with the `echo.RouteNotFound` method.
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		chains = append(chains, b.middlewareChain(r, r.Path))
+	}
+
+	return chains
+}
+
+func (b *Bean) middlewareChain(r *echo.Route, path string) RouteChain {
+	middlewareChainsMu.RLock()
+	defer middlewareChainsMu.RUnlock()
+
+	route, ok := routeMiddlewares[b.Echo][r.Method+" "+r.Path]
+
+	chain := RouteChain{
+		Method:  r.Method,
+		Path:    r.Path,
+		Name:    r.Name,
+		Handler: route.handler,
+	}
+	if !ok {
+		// The echo name of a route registered without `Bean.Add` is the name of its handler.
+		chain.Handler = r.Name
+	}
+
+	// The middlewares added with `echo.Pre` are executed before those added with `echo.Use` whatever
+	// the order they were added.
+	for _, stage := range []string{MiddlewareStagePre, MiddlewareStageGlobal} {
+		for _, entry := range globalMiddlewares[b.Echo] {
+			if entry.info.Stage != stage {
+				continue
+			}
+
+			info := entry.info
+			info.Skipped = skipsEndpoint(entry.skipEndpoints, path)
+
+			// Show the route timeout instead of the global one.
+			if info.Name == "Timeout" && route.timeout != nil {
+				config := make(map[string]interface{}, len(info.Config)+1)
+				for k, v := range info.Config {
+					config[k] = v
+				}
+				config["routeTimeout"] = route.timeout.String()
+				info.Config = config
+			}
+
+			chain.Middlewares = append(chain.Middlewares, info)
+		}
+	}
+
+	chain.Middlewares = append(chain.Middlewares, route.middlewares...)
+
+	return chain
+}
+
+// skipsEndpoint reports whether `path` matches one of the `skipEndpoints` regular expressions, like
+// the skipper of the middlewares.
+func skipsEndpoint(skipEndpoints []string, path string) bool {
+	for _, endpoint := range skipEndpoints {
+		if re, err := regexp.Compile(endpoint); err == nil && re.MatchString(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closureSuffix matches the suffix of the anonymous functions, like `.func1.2`, and of the method values.
+var closureSuffix = regexp.MustCompile(`(\.func\d+(\.\d+)*|-fm)$`)
+
+// funcName returns the name of a function, like `main.(*handler).List`, without the suffix of the
+// closures returned by the middleware constructors.
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+
+	return closureSuffix.ReplaceAllString(f.Name(), "")
+}
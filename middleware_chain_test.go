@@ -0,0 +1,104 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return next
+}
+
+func TestBean_MiddlewareChain(t *testing.T) {
+	e := echo.New()
+	b := &Bean{Echo: e}
+
+	useMiddleware(e, "BodyLimit", map[string]interface{}{"bodyLimit": "1M"}, nil, func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	useMiddleware(e, "AccessLogger", nil, []string{"^/ping$"}, func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	useMiddleware(e, "Timeout", map[string]interface{}{"timeout": "5s"}, nil, func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	preMiddleware(e, "RemoveTrailingSlash", nil, func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	b.UseMiddlewares(testMiddleware)
+
+	b.RouteAuth = func(scopes ...string) echo.MiddlewareFunc { return testMiddleware }
+	b.GET("/users/:id", func(c echo.Context) error { return nil },
+		WithAuth("users:read"), WithRateLimit(60), WithTimeout(time.Second), WithMiddleware(testMiddleware),
+		WithName("users.show"))
+	b.GET("/ping", func(c echo.Context) error { return nil })
+
+	chain, ok := b.MiddlewareChain(http.MethodGet, "/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/:id", chain.Path)
+	assert.Equal(t, "users.show", chain.Name)
+	assert.Contains(t, chain.Handler, "TestBean_MiddlewareChain")
+
+	var names, stages []string
+	for _, m := range chain.Middlewares {
+		names = append(names, m.Name)
+		stages = append(stages, m.Stage)
+	}
+	assert.Equal(t, []string{
+		"RemoveTrailingSlash", "BodyLimit", "AccessLogger", "Timeout", "github.com/retail-ai-inc/bean.testMiddleware",
+		"Auth", "RateLimit", "github.com/retail-ai-inc/bean.testMiddleware",
+	}, names)
+	assert.Equal(t, []string{
+		MiddlewareStagePre, MiddlewareStageGlobal, MiddlewareStageGlobal, MiddlewareStageGlobal, MiddlewareStageGlobal,
+		MiddlewareStageRoute, MiddlewareStageRoute, MiddlewareStageRoute,
+	}, stages)
+
+	assert.False(t, chain.Middlewares[2].Skipped)
+	assert.Equal(t, "1s", chain.Middlewares[3].Config["routeTimeout"])
+	assert.False(t, chain.Middlewares[4].BuiltIn)
+	assert.Equal(t, []string{"users:read"}, chain.Middlewares[5].Config["scopes"])
+
+	chain, ok = b.MiddlewareChain(http.MethodGet, "/ping")
+	assert.True(t, ok)
+	assert.True(t, chain.Middlewares[2].Skipped)
+	assert.Nil(t, chain.Middlewares[3].Config["routeTimeout"])
+
+	_, ok = b.MiddlewareChain(http.MethodPost, "/ping")
+	assert.False(t, ok)
+
+	assert.Len(t, b.MiddlewareChains(), 2)
+}
+
+func TestFuncName(t *testing.T) {
+	assert.Equal(t, "github.com/retail-ai-inc/bean/middleware.RequireAPIKeyScopes", funcName(middleware.RequireAPIKeyScopes))
+	assert.Equal(t, "github.com/retail-ai-inc/bean/middleware.Tracer", funcName(middleware.Tracer()))
+	assert.Equal(t, "", funcName(nil))
+}
+
+func TestMiddlewareToggles(t *testing.T) {
+	defer func(config Config) { BeanConfig = config }(BeanConfig)
+	BeanConfig.Environment = "local"
+	BeanConfig.Middlewares = map[string]MiddlewareToggle{
+		"httpsredirect": {Off: []string{"local"}},
+		"Secure":        {Off: []string{"local", "test"}},
+		"BodyDump":      {On: []string{"staging"}},
+		"BodyLimit":     {On: []string{"local", "staging"}},
+	}
+
+	assert.False(t, BeanConfig.Middlewares["BodyDump"].Enabled("local"))
+	assert.True(t, BeanConfig.Middlewares["BodyDump"].Enabled("staging"))
+	assert.True(t, MiddlewareToggle{}.Enabled("production"))
+
+	e := echo.New()
+	b := &Bean{Echo: e}
+	preMiddleware(e, "HTTPSRedirect", nil, testMiddleware)
+	useMiddleware(e, "Secure", nil, nil, testMiddleware)
+	useMiddleware(e, "BodyLimit", nil, nil, testMiddleware)
+	assert.True(t, toggledOff(e, "BodyDump"))
+	b.GET("/ping", func(c echo.Context) error { return nil })
+
+	chain, ok := b.MiddlewareChain(http.MethodGet, "/ping")
+	assert.True(t, ok)
+	assert.Len(t, chain.Middlewares, 1)
+	assert.Equal(t, "BodyLimit", chain.Middlewares[0].Name)
+	assert.Equal(t, []string{"HTTPSRedirect", "Secure", "BodyDump"}, disabledMiddlewares[e])
+}
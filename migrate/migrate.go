@@ -0,0 +1,477 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package migrate applies versioned SQL migrations to the master and tenant MySQL databases.
+//
+// Migrations are read from a directory (or an embedded file system) where every version has an
+// `up` and an optional `down` file:
+//
+//	0001_create_users.up.sql
+//	0001_create_users.down.sql
+//	0002_add_users_email_index.up.sql
+//
+// The applied versions are recorded in the `schema_migrations` table of every database and a MySQL
+// named lock prevents two processes from migrating the same database at the same time. The lock is
+// named after the database, so the databases of the same server can be migrated concurrently.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLocked = errors.New("migrate: another process is migrating the database")
+	ErrDirty  = errors.New("migrate: database is dirty, fix it manually and use `Force`")
+)
+
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of a migration in a database.
+type Status struct {
+	Migration
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+// Config defines the config of a `Migrator`.
+type Config struct {
+	// Table records the applied versions. Optional. Default value `schema_migrations`.
+	Table string
+	// LockName is the MySQL named lock (`GET_LOCK`) taken while migrating, suffixed by `:<database>` as
+	// the named locks are server wide. Optional. Default value `bean_migrate`.
+	LockName string
+	// LockTimeout is how long to wait for the lock. Optional. Default value 30s.
+	LockTimeout time.Duration
+}
+
+// DefaultConfig is the default `Migrator` config.
+var DefaultConfig = Config{
+	Table:       "schema_migrations",
+	LockName:    "bean_migrate",
+	LockTimeout: 30 * time.Second,
+}
+
+// Migrator applies the migrations of a source to any number of databases.
+type Migrator struct {
+	config     Config
+	migrations []Migration
+}
+
+// New reads the migrations from `source` (example: `os.DirFS("migrations/tenant")` or an `embed.FS`).
+func New(source fs.FS, config Config) (*Migrator, error) {
+	if config.Table == "" {
+		config.Table = DefaultConfig.Table
+	}
+	if config.LockName == "" {
+		config.LockName = DefaultConfig.LockName
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = DefaultConfig.LockTimeout
+	}
+
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		m := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, errors.Errorf("migrate: version %d is used by `%s` and `%s`", version, migration.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrator := &Migrator{config: config}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, errors.Errorf("migrate: version %d (%s) has no up migration", migration.Version, migration.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *migration)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Migrations returns all the migrations ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// Up applies at most `steps` pending migrations, or all of them if `steps <= 0`.
+func (m *Migrator) Up(c context.Context, db *gorm.DB, steps int) (applied []Migration, err error) {
+	err = m.withLock(c, db, func(conn *sql.Conn) error {
+		records, err := m.records(c, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+
+			if _, ok := records[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(c, conn, migration, true); err != nil {
+				return err
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts at most `steps` applied migrations starting from the latest, or all of them if `steps <= 0`.
+func (m *Migrator) Down(c context.Context, db *gorm.DB, steps int) (reverted []Migration, err error) {
+	err = m.withLock(c, db, func(conn *sql.Conn) error {
+		records, err := m.records(c, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+
+			migration := m.migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return errors.Errorf("migrate: version %d (%s) has no down migration", migration.Version, migration.Name)
+			}
+
+			if err := m.apply(c, conn, migration, false); err != nil {
+				return err
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status returns the state of every migration in the database.
+func (m *Migrator) Status(c context.Context, db *gorm.DB) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withConn(c, db, func(conn *sql.Conn) error {
+		if err := m.ensureTable(c, conn); err != nil {
+			return err
+		}
+
+		records, err := m.records(c, conn)
+		if err != nil && err != ErrDirty {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if r, ok := records[migration.Version]; ok {
+				appliedAt := r.appliedAt
+				status.Applied = true
+				status.Dirty = r.dirty
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Force removes the dirty flag of `version` after the database has been fixed manually. If `applied`
+// is false then the version is removed from the table instead.
+func (m *Migrator) Force(c context.Context, db *gorm.DB, version uint64, applied bool) error {
+	return m.withLock(c, db, func(conn *sql.Conn) error {
+		var err error
+		if applied {
+			_, err = conn.ExecContext(c, fmt.Sprintf("UPDATE `%s` SET dirty = 0 WHERE version = ?", m.config.Table), version)
+		} else {
+			_, err = conn.ExecContext(c, fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.config.Table), version)
+		}
+
+		return errors.WithStack(err)
+	})
+}
+
+type record struct {
+	dirty     bool
+	appliedAt time.Time
+}
+
+// records returns the applied versions. It returns `ErrDirty` along with the records if a previous
+// migration failed in the middle.
+func (m *Migrator) records(c context.Context, conn *sql.Conn) (map[uint64]record, error) {
+	rows, err := conn.QueryContext(c, fmt.Sprintf("SELECT version, dirty, applied_at FROM `%s`", m.config.Table))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	records := make(map[uint64]record)
+	dirty := false
+
+	for rows.Next() {
+		var version uint64
+		var r record
+		if err := rows.Scan(&version, &r.dirty, &r.appliedAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		records[version] = r
+		dirty = dirty || r.dirty
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if dirty {
+		return records, ErrDirty
+	}
+
+	return records, nil
+}
+
+// apply runs a migration and records it. The version is marked dirty while the statements are running
+// because MySQL commits the DDL statements implicitly.
+func (m *Migrator) apply(c context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script := migration.Up
+	if !up {
+		script = migration.Down
+	}
+
+	var err error
+	if up {
+		_, err = conn.ExecContext(c, fmt.Sprintf("INSERT INTO `%s` (version, name, dirty, applied_at) VALUES (?, ?, 1, ?)", m.config.Table),
+			migration.Version, migration.Name, time.Now().UTC())
+	} else {
+		_, err = conn.ExecContext(c, fmt.Sprintf("UPDATE `%s` SET dirty = 1 WHERE version = ?", m.config.Table), migration.Version)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(c, stmt); err != nil {
+			return errors.Wrapf(err, "migrate: version %d (%s)", migration.Version, migration.Name)
+		}
+	}
+
+	if up {
+		_, err = conn.ExecContext(c, fmt.Sprintf("UPDATE `%s` SET dirty = 0 WHERE version = ?", m.config.Table), migration.Version)
+	} else {
+		_, err = conn.ExecContext(c, fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.config.Table), migration.Version)
+	}
+
+	return errors.WithStack(err)
+}
+
+func (m *Migrator) ensureTable(c context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(c, fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"version BIGINT UNSIGNED NOT NULL PRIMARY KEY, "+
+		"name VARCHAR(255) NOT NULL, "+
+		"dirty TINYINT(1) NOT NULL DEFAULT 0, "+
+		"applied_at DATETIME NOT NULL)", m.config.Table))
+
+	return errors.WithStack(err)
+}
+
+// withConn runs `fn` with a dedicated connection so that the named lock and the statements share the same session.
+func (m *Migrator) withConn(c context.Context, db *gorm.DB, fn func(conn *sql.Conn) error) error {
+	if db == nil {
+		return errors.New("migrate: database connection is nil")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	conn, err := sqlDB.Conn(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func (m *Migrator) withLock(c context.Context, db *gorm.DB, fn func(conn *sql.Conn) error) error {
+	return m.withConn(c, db, func(conn *sql.Conn) error {
+		var database sql.NullString
+		if err := conn.QueryRowContext(c, "SELECT DATABASE()").Scan(&database); err != nil {
+			return errors.WithStack(err)
+		}
+		lockName := m.lockName(database.String)
+
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(c, "SELECT GET_LOCK(?, ?)", lockName, int(m.config.LockTimeout.Seconds())).Scan(&locked); err != nil {
+			return errors.WithStack(err)
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return ErrLocked
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+		if err := m.ensureTable(c, conn); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+// lockName returns the named lock of `database`. MySQL limits the names to 64 characters, a longer
+// one is hashed.
+func (m *Migrator) lockName(database string) string {
+	name := m.config.LockName + ":" + database
+	if len(name) <= 64 {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitStatements splits a script on `;` ignoring the ones inside quotes and comments. Statements
+// which only contain comments are dropped, but the executable comments (`/*! ... */`) and the optimizer
+// hints (`/*+ ... */`) are kept as code.
+func splitStatements(script string) []string {
+	var stmts []string
+	var quote byte
+	start := 0
+	hasCode := false
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote != '`' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			hasCode = true
+		case ch == '#' || (ch == '-' && strings.HasPrefix(script[i:], "--")):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			if strings.HasPrefix(script[i:], "/*!") || strings.HasPrefix(script[i:], "/*+") {
+				hasCode = true
+			}
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case ch == ';':
+			if hasCode {
+				stmts = append(stmts, strings.TrimSpace(script[start:i]))
+			}
+			start = i + 1
+			hasCode = false
+		case ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r':
+			hasCode = true
+		}
+	}
+
+	if hasCode {
+		stmts = append(stmts, strings.TrimSpace(script[start:]))
+	}
+
+	return stmts
+}
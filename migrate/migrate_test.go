@@ -0,0 +1,217 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestNew(t *testing.T) {
+	source := fstest.MapFS{
+		"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email VARCHAR(255);")},
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":                  {Data: []byte("ignored")},
+	}
+
+	m, err := New(source, Config{})
+	assert.NoError(t, err)
+
+	migrations := m.Migrations()
+	if assert.Len(t, migrations, 2) {
+		assert.Equal(t, uint64(1), migrations[0].Version)
+		assert.Equal(t, "create_users", migrations[0].Name)
+		assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+		assert.Equal(t, uint64(2), migrations[1].Version)
+		assert.Empty(t, migrations[1].Down)
+	}
+
+	_, err = New(fstest.MapFS{"0001_only_down.down.sql": {Data: []byte("SELECT 1")}}, Config{})
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- Create the table; with a comment.
+CREATE TABLE a (name VARCHAR(10) DEFAULT 'x;y');
+/* block; comment */
+INSERT INTO a VALUES ("it\"s;");
+# trailing comment;
+`
+
+	assert.Equal(t, []string{
+		"-- Create the table; with a comment.\nCREATE TABLE a (name VARCHAR(10) DEFAULT 'x;y')",
+		"/* block; comment */\nINSERT INTO a VALUES (\"it\\\"s;\")",
+	}, splitStatements(script))
+
+	// The executable comments and the optimizer hints are kept.
+	script = "/*!40101 SET NAMES utf8mb4 */;\n/* dropped */;\nSELECT /*+ MAX_EXECUTION_TIME(1000) */ 1;"
+	assert.Equal(t, []string{
+		"/*!40101 SET NAMES utf8mb4 */",
+		"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1",
+	}, splitStatements(script))
+}
+
+func TestLockName(t *testing.T) {
+	m := &Migrator{config: Config{LockName: "bean_migrate"}}
+	assert.Equal(t, "bean_migrate:app", m.lockName("app"))
+
+	long := m.lockName(strings.Repeat("x", 64))
+	assert.Len(t, long, 64)
+	assert.NotEqual(t, long, m.lockName(strings.Repeat("y", 64)))
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, *gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	m, err := New(fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email VARCHAR(255);")},
+		"0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+	}, Config{})
+	require.NoError(t, err)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+	require.NoError(t, err)
+
+	return m, db, mock
+}
+
+// expectLock expects the named lock of the database `app` and the creation of the migration table.
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).WithArgs("bean_migrate:app", 30).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `schema_migrations`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectRecords(mock sqlmock.Sqlmock, records map[uint64]bool) {
+	rows := sqlmock.NewRows([]string{"version", "dirty", "applied_at"})
+	for version, dirty := range records {
+		rows.AddRow(version, dirty, time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, dirty, applied_at FROM `schema_migrations`")).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).WithArgs("bean_migrate:app").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUp(t *testing.T) {
+	m, db, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	expectRecords(mock, map[uint64]bool{1: false})
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `schema_migrations` (version, name, dirty, applied_at) VALUES (?, ?, 1, ?)")).
+		WithArgs(uint64(2), "add_email", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE users ADD email VARCHAR(255)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `schema_migrations` SET dirty = 0 WHERE version = ?")).
+		WithArgs(uint64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background(), db, 0)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, uint64(2), applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	m, db, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	expectRecords(mock, map[uint64]bool{1: false, 2: false})
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `schema_migrations` SET dirty = 1 WHERE version = ?")).
+		WithArgs(uint64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE users DROP email")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `schema_migrations` WHERE version = ?")).
+		WithArgs(uint64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	reverted, err := m.Down(context.Background(), db, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, uint64(2), reverted[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDirty(t *testing.T) {
+	m, db, mock := newTestMigrator(t)
+
+	// Nothing is applied on a dirty database.
+	expectLock(mock)
+	expectRecords(mock, map[uint64]bool{1: true})
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background(), db, 0)
+	assert.Equal(t, ErrDirty, err)
+	assert.Empty(t, applied)
+
+	// Until the version is forced.
+	expectLock(mock)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `schema_migrations` SET dirty = 0 WHERE version = ?")).
+		WithArgs(uint64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	assert.NoError(t, m.Force(context.Background(), db, 1, true))
+
+	expectLock(mock)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `schema_migrations` WHERE version = ?")).
+		WithArgs(uint64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	assert.NoError(t, m.Force(context.Background(), db, 1, false))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocked(t *testing.T) {
+	m, db, mock := newTestMigrator(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).WithArgs("bean_migrate:app", 30).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(0))
+
+	_, err := m.Up(context.Background(), db, 0)
+	assert.Equal(t, ErrLocked, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
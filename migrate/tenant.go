@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"gorm.io/gorm"
+)
+
+// Target is a database to migrate.
+type Target struct {
+	// Name is `master` or `tenant:<id>`.
+	Name     string
+	TenantID uint64
+	DB       *gorm.DB
+}
+
+// Result is the outcome of a migration on one target.
+type Result struct {
+	Target     Target
+	Migrations []Migration
+	Err        error
+}
+
+// MasterTarget returns the master MySQL database of `deps`.
+func MasterTarget(deps *bean.DBDeps) []Target {
+	if deps == nil || deps.MasterMySQLDB == nil {
+		return nil
+	}
+
+	return []Target{{Name: "master", DB: deps.MasterMySQLDB}}
+}
+
+// TenantTargets returns all tenant MySQL databases of `deps` ordered by tenant ID. The tenants restricted
+// to another region (see `dbdrivers.CheckResidency`) are skipped.
+func TenantTargets(deps *bean.DBDeps) []Target {
+	if deps == nil {
+		return nil
+	}
+
+	targets := make([]Target, 0, len(deps.TenantMySQLDBs))
+	for tenantID, db := range deps.TenantMySQLDBs {
+		if db == nil {
+			continue
+		}
+		if err := dbdrivers.CheckResidency(tenantID); err != nil {
+			bean.Logger().Warnf("migrate: skip tenant %d: %v", tenantID, err)
+			continue
+		}
+		targets = append(targets, Target{Name: fmt.Sprintf("tenant:%d", tenantID), TenantID: tenantID, DB: db})
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].TenantID < targets[j].TenantID })
+
+	return targets
+}
+
+// UpAll runs `Up` on every target. A failure on one tenant doesn't stop the others, check `Result.Err`.
+func (m *Migrator) UpAll(c context.Context, targets []Target, steps int) []Result {
+	return m.each(targets, func(t Target) ([]Migration, error) {
+		return m.Up(c, t.DB, steps)
+	})
+}
+
+// DownAll runs `Down` on every target.
+func (m *Migrator) DownAll(c context.Context, targets []Target, steps int) []Result {
+	return m.each(targets, func(t Target) ([]Migration, error) {
+		return m.Down(c, t.DB, steps)
+	})
+}
+
+// StatusAll returns the status of every target.
+func (m *Migrator) StatusAll(c context.Context, targets []Target) map[string][]Status {
+	statuses := make(map[string][]Status, len(targets))
+
+	for _, t := range targets {
+		status, err := m.Status(c, t.DB)
+		if err != nil {
+			bean.Logger().Errorf("migrate: %s: %v", t.Name, err)
+			continue
+		}
+		statuses[t.Name] = status
+	}
+
+	return statuses
+}
+
+func (m *Migrator) each(targets []Target, fn func(t Target) ([]Migration, error)) []Result {
+	results := make([]Result, 0, len(targets))
+
+	for _, t := range targets {
+		migrations, err := fn(t)
+		if err != nil {
+			bean.Logger().Errorf("migrate: %s: %v", t.Name, err)
+		}
+		results = append(results, Result{Target: t, Migrations: migrations, Err: err})
+	}
+
+	return results
+}
@@ -0,0 +1,143 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/shutdown"
+)
+
+// Module is a feature of a large application, like the orders or the catalog, with its own routes,
+// middlewares and lifecycle. Embed `BaseModule` to implement only what the module needs.
+// Example:
+//
+//	type ordersModule struct {
+//		bean.BaseModule
+//		hdlr handlers.OrderHandler
+//	}
+//
+//	func (m *ordersModule) Name() string { return "orders" }
+//
+//	func (m *ordersModule) Routes(g *bean.RouteGroup) {
+//		g.GET("", m.hdlr.List)
+//		g.POST("", m.hdlr.Create, bean.WithAuth("orders:write"))
+//	}
+type Module interface {
+	// Name is the unique name of the module.
+	Name() string
+
+	// Prefix of the routes of the module, "" for "/<name>" and "/" to mount them at the root.
+	Prefix() string
+
+	// Middlewares are executed for the routes of the module only, after the global ones.
+	Middlewares() []echo.MiddlewareFunc
+
+	// Routes registers the routes of the module into its group.
+	Routes(g *RouteGroup)
+
+	// Boot initializes the module before its routes are registered. (example: the services and the
+	// subscribers of the module)
+	Boot(c context.Context, b *Bean) error
+
+	// Shutdown stops the module in the drain stage of `Shutdown`, once the http server stops accepting
+	// requests. The modules stop in the reverse order of their registration.
+	Shutdown(c context.Context) error
+}
+
+// BaseModule implements the optional methods of `Module`, mounted at "/<name>" without middleware nor
+// lifecycle hooks.
+type BaseModule struct{}
+
+func (BaseModule) Prefix() string                        { return "" }
+func (BaseModule) Middlewares() []echo.MiddlewareFunc    { return nil }
+func (BaseModule) Boot(c context.Context, b *Bean) error { return nil }
+func (BaseModule) Shutdown(c context.Context) error      { return nil }
+
+// RegisterModules boots the modules then mounts their routes in order. The modules registered later
+// can use the earlier ones, so they are also stopped first. It stops at the first module which fails
+// to boot.
+func (b *Bean) RegisterModules(modules ...Module) error {
+	b.modulesMu.Lock()
+	defer b.modulesMu.Unlock()
+
+	for _, m := range modules {
+		name := m.Name()
+		if name == "" {
+			return fmt.Errorf("module %T has no name", m)
+		}
+
+		var dependsOn []string
+		for _, registered := range b.modules {
+			if registered.Name() == name {
+				return fmt.Errorf("module %q is already registered", name)
+			}
+			dependsOn = append(dependsOn, moduleComponent(registered.Name()))
+		}
+
+		if err := m.Boot(context.Background(), b); err != nil {
+			return fmt.Errorf("module %q boot failed: %w", name, err)
+		}
+
+		prefix := m.Prefix()
+		if prefix == "" {
+			prefix = "/" + name
+		}
+		prefix = strings.TrimSuffix(prefix, "/")
+
+		var opts []RouteOption
+		if mws := m.Middlewares(); len(mws) > 0 {
+			opts = append(opts, WithMiddleware(mws...))
+		}
+		m.Routes(b.Group(prefix, opts...))
+
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{
+			Name:      moduleComponent(name),
+			Stage:     shutdown.StageDrain,
+			DependsOn: dependsOn,
+			Stop:      m.Shutdown,
+		}); err != nil {
+			return fmt.Errorf("module %q: %w", name, err)
+		}
+
+		b.modules = append(b.modules, m)
+	}
+
+	return nil
+}
+
+// Modules returns the registered modules in order.
+func (b *Bean) Modules() []Module {
+	b.modulesMu.Lock()
+	defer b.modulesMu.Unlock()
+
+	return append([]Module(nil), b.modules...)
+}
+
+// moduleComponent returns the name of the shutdown component of a module.
+func moduleComponent(name string) string {
+	return "module." + name
+}
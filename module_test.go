@@ -0,0 +1,83 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testModule struct {
+	BaseModule
+	name    string
+	prefix  string
+	mws     []echo.MiddlewareFunc
+	booted  bool
+	bootErr error
+}
+
+func (m *testModule) Name() string                       { return m.name }
+func (m *testModule) Prefix() string                     { return m.prefix }
+func (m *testModule) Middlewares() []echo.MiddlewareFunc { return m.mws }
+func (m *testModule) Boot(c context.Context, b *Bean) error {
+	m.booted = true
+	return m.bootErr
+}
+
+func (m *testModule) Routes(g *RouteGroup) {
+	g.GET("/items", func(c echo.Context) error {
+		return c.String(http.StatusOK, m.name+" "+c.Response().Header().Get("X-Module"))
+	})
+}
+
+func TestBean_RegisterModules(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+
+	catalog := &testModule{name: "test-catalog", mws: []echo.MiddlewareFunc{
+		func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Response().Header().Set("X-Module", "catalog")
+				return next(c)
+			}
+		},
+	}}
+	orders := &testModule{name: "test-orders", prefix: "/api/orders/"}
+	require.NoError(t, b.RegisterModules(catalog, orders))
+	assert.True(t, catalog.booted)
+	assert.Equal(t, []Module{catalog, orders}, b.Modules())
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.Echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	assert.Equal(t, "test-catalog catalog", serve("/test-catalog/items").Body.String())
+	assert.Equal(t, "test-orders ", serve("/api/orders/items").Body.String())
+
+	// The later modules stop first.
+	waves, _ := b.ShutdownOrchestrator().Plan()
+	var order []string
+	for _, wave := range waves {
+		for _, name := range wave {
+			if name == "module.test-catalog" || name == "module.test-orders" {
+				order = append(order, name)
+			}
+		}
+	}
+	assert.Equal(t, []string{"module.test-orders", "module.test-catalog"}, order)
+
+	assert.EqualError(t, b.RegisterModules(&testModule{name: "test-orders"}), `module "test-orders" is already registered`)
+	assert.Error(t, b.RegisterModules(&testModule{}))
+
+	failing := &testModule{name: "test-failing", bootErr: errors.New("no database")}
+	assert.EqualError(t, b.RegisterModules(failing), `module "test-failing" boot failed: no database`)
+	assert.Len(t, b.Modules(), 2)
+	assert.Equal(t, http.StatusNotFound, serve("/test-failing/items").Code)
+}
@@ -0,0 +1,165 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package openapi
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The UIs served by `Register`.
+const (
+	UISwagger = "swagger"
+	UIRedoc   = "redoc"
+)
+
+// Config defines the endpoints of the document.
+type Config struct {
+	// Info is the title, description and version of the API.
+	Info Info
+
+	// Servers are the base URLs of the API.
+	// Optional. Default value nil, the host of the document.
+	Servers []Server
+
+	// BasePath is the prefix the server is mounted under by a proxy, like "/api/catalog". It's the
+	// server URL of the document if `Servers` is not set and the prefix of the document URL of the UI.
+	// Optional. Default value "".
+	BasePath string
+
+	// Path of the JSON document.
+	// Optional. Default value "/openapi.json".
+	Path string
+
+	// UI is `swagger` for the Swagger UI or `redoc` for Redoc, their assets are loaded from their CDN.
+	// Optional. Default value "", no UI.
+	UI string
+
+	// UIPath of the UI page.
+	// Optional. Default value "/docs".
+	UIPath string
+
+	// Skip are the path prefixes left out of the document, like `/debug`.
+	// Optional.
+	Skip []string
+
+	// Middlewares guard the endpoints, like a basic auth.
+	// Optional.
+	Middlewares []echo.MiddlewareFunc
+}
+
+// DefaultConfig is the default config of the endpoints.
+var DefaultConfig = Config{
+	Info:   Info{Title: "API", Version: "1.0.0"},
+	Path:   "/openapi.json",
+	UIPath: "/docs",
+}
+
+var uiTemplates = map[string]*template.Template{
+	UISwagger: template.Must(template.New(UISwagger).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{.Title}}</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = function () {
+			window.ui = SwaggerUIBundle({url: {{.Path}}, dom_id: "#swagger-ui"});
+		};
+	</script>
+</body>
+</html>
+`)),
+	UIRedoc: template.Must(template.New(UIRedoc).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{.Title}}</title>
+</head>
+<body>
+	<redoc spec-url="{{.Path}}"></redoc>
+	<script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`)),
+}
+
+// Register mounts the JSON document of the routes of `e` described by `spec`, and the UI if it's set.
+// The document is generated on each request, so it lists the routes added after `Register` as well.
+func Register(e *echo.Echo, spec *Spec, config Config) error {
+	if config.Info.Title == "" {
+		config.Info.Title = DefaultConfig.Info.Title
+	}
+	if config.Info.Version == "" {
+		config.Info.Version = DefaultConfig.Info.Version
+	}
+	if config.Path == "" {
+		config.Path = DefaultConfig.Path
+	}
+	if config.UIPath == "" {
+		config.UIPath = DefaultConfig.UIPath
+	}
+
+	ui := strings.ToLower(config.UI)
+	tpl, ok := uiTemplates[ui]
+	if ui != "" && !ok {
+		return fmt.Errorf("openapi ui %q must be %q or %q", config.UI, UISwagger, UIRedoc)
+	}
+
+	basePath := "/" + strings.Trim(config.BasePath, "/")
+	if basePath == "/" {
+		basePath = ""
+	}
+	if len(config.Servers) == 0 && basePath != "" {
+		config.Servers = []Server{{URL: basePath}}
+	}
+
+	skip := append([]string{config.Path}, config.Skip...)
+	if tpl != nil {
+		skip = append(skip, config.UIPath)
+	}
+
+	e.GET(config.Path, func(c echo.Context) error {
+		doc := spec.Generate(config.Info, e.Routes(), skip...)
+		doc.Servers = config.Servers
+		return c.JSON(http.StatusOK, doc)
+	}, config.Middlewares...)
+
+	if tpl != nil {
+		e.GET(config.UIPath, func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+			c.Response().WriteHeader(http.StatusOK)
+			return tpl.Execute(c.Response(), map[string]string{"Title": config.Info.Title, "Path": basePath + config.Path})
+		}, config.Middlewares...)
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// MockHeader is set to "true" on the mocked responses.
+const MockHeader = "X-Bean-Mock"
+
+// ErrNotImplemented is returned by the handlers which are not implemented yet, their responses are mocked
+// in the mock mode. (see `Mock`)
+var ErrNotImplemented = echo.NewHTTPError(http.StatusNotImplemented, "not implemented")
+
+// NotImplemented is the handler of the routes which are not implemented yet.
+func NotImplemented(c echo.Context) error {
+	return ErrNotImplemented
+}
+
+// LoadDocument reads a JSON or YAML document, like the design first document of an API.
+func LoadDocument(path string) (*Document, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// IMPORTANT: The YAML document is converted to JSON, so that the `json` tags of the document apply.
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, errors.Wrapf(err, "openapi: failed to parse %s", path)
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return nil, errors.Wrapf(err, "openapi: failed to convert %s", path)
+		}
+	}
+
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrapf(err, "openapi: failed to parse %s", path)
+	}
+
+	return &doc, nil
+}
+
+// MockConfig defines the config for `Mock`.
+type MockConfig struct {
+	// Document is a design first document, like the one of `LoadDocument`. Its operations without route are
+	// added to the routes with the `NotImplemented` handler, which is replaced when the route is added by the
+	// application. Its operations win over the ones of the spec.
+	// Optional. Default value nil, only the routes returning `ErrNotImplemented` are mocked.
+	Document *Document
+
+	// Skip are the path prefixes which are never mocked.
+	// Optional.
+	Skip []string
+}
+
+// Mock serves the responses of the routes returning `ErrNotImplemented` from their operation, so that the
+// clients can be built before the handlers. The response is the example of the lowest 2xx status, or a
+// value generated from its schema, and the client can ask for another status with the `Prefer: code=404`
+// header. It's meant for the development environments only.
+func Mock(e *echo.Echo, spec *Spec, config MockConfig) {
+	if config.Document != nil {
+		routes := map[string]bool{}
+		for _, route := range e.Routes() {
+			routes[route.Method+" "+route.Path] = true
+		}
+
+		for path, item := range config.Document.Paths {
+			echoPath := echoPath(path)
+			for method := range item {
+				method = strings.ToUpper(method)
+				if !methods[method] || routes[method+" "+echoPath] || skipped(echoPath, config.Skip) {
+					continue
+				}
+				e.Add(method, echoPath, NotImplemented)
+			}
+		}
+	}
+
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if !errors.Is(err, ErrNotImplemented) || skipped(c.Path(), config.Skip) {
+				return err
+			}
+
+			m := newMocker(spec.Generate(Info{}, e.Routes()), config.Document)
+			op := m.operation(c.Request().Method, c.Path())
+			if op == nil {
+				return err
+			}
+
+			return m.respond(c, op)
+		}
+	})
+}
+
+func skipped(path string, skip []string) bool {
+	for _, prefix := range skip {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// echoPath returns the echo path of an OpenAPI path, `/products/{id}` is `/products/:id`.
+func echoPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// mocker generates the responses of the operations of the generated and the design first documents.
+type mocker struct {
+	docs    []*Document
+	schemas map[string]*Schema
+}
+
+func newMocker(generated, design *Document) *mocker {
+	m := &mocker{schemas: map[string]*Schema{}}
+	for _, doc := range []*Document{design, generated} {
+		if doc == nil {
+			continue
+		}
+		m.docs = append(m.docs, doc)
+		if doc.Components == nil {
+			continue
+		}
+		for name, schema := range doc.Components.Schemas {
+			if _, ok := m.schemas[name]; !ok {
+				m.schemas[name] = schema
+			}
+		}
+	}
+	return m
+}
+
+// operation returns the operation of a route, the first document describing it wins.
+func (m *mocker) operation(method, path string) *Operation {
+	openAPIPath, _ := convertPath(path)
+	for _, doc := range m.docs {
+		if op := doc.Paths[openAPIPath][strings.ToLower(method)]; op != nil {
+			return op
+		}
+	}
+	return nil
+}
+
+func (m *mocker) respond(c echo.Context, op *Operation) error {
+	status, res := response(op, c.Request().Header.Get("Prefer"))
+	c.Response().Header().Set(MockHeader, "true")
+
+	if res == nil {
+		return c.NoContent(status)
+	}
+
+	media, ok := res.Content[echo.MIMEApplicationJSON]
+	if !ok {
+		for _, mt := range res.Content {
+			media, ok = mt, true
+			break
+		}
+	}
+	if !ok {
+		return c.NoContent(status)
+	}
+
+	body := media.Example
+	if body == nil {
+		body = m.fake(media.Schema, 0)
+	}
+
+	return c.JSON(status, body)
+}
+
+// response returns the response of the `code` of the `Prefer` header, or the lowest 2xx one, or the
+// default one as 200.
+func response(op *Operation, prefer string) (int, *Response) {
+	for _, pref := range strings.Split(prefer, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+		if name != "code" {
+			continue
+		}
+		if res, ok := op.Responses[value]; ok {
+			status, _ := strconv.Atoi(value)
+			return status, res
+		}
+	}
+
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			status, _ := strconv.Atoi(code)
+			return status, op.Responses[code]
+		}
+	}
+
+	if res, ok := op.Responses["default"]; ok {
+		return http.StatusOK, res
+	}
+
+	if len(codes) == 0 {
+		return http.StatusOK, nil
+	}
+
+	status, _ := strconv.Atoi(codes[0])
+	return status, op.Responses[codes[0]]
+}
+
+// fake returns a value of the schema, its examples, enums and bounds are used. The references are
+// followed up to 3 levels, so that the recursive schemas end.
+func (m *mocker) fake(s *Schema, depth int) interface{} {
+	if s == nil {
+		return nil
+	}
+
+	if s.Ref != "" {
+		if depth >= 3 {
+			return nil
+		}
+		return m.fake(m.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], depth+1)
+	}
+
+	if s.Example != nil {
+		return s.Example
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+
+	switch s.Type {
+	case "string":
+		return fakeString(s)
+	case "integer":
+		return int64(fakeNumber(s, 1))
+	case "number":
+		return fakeNumber(s, 1.5)
+	case "boolean":
+		return true
+	case "array":
+		return []interface{}{m.fake(s.Items, depth)}
+	case "object", "":
+		if s.Type == "" && len(s.Properties) == 0 && s.AdditionalProperties == nil {
+			return nil
+		}
+
+		object := map[string]interface{}{}
+		for name, property := range s.Properties {
+			object[name] = m.fake(property, depth)
+		}
+		if len(s.Properties) == 0 && s.AdditionalProperties != nil {
+			object["key"] = m.fake(s.AdditionalProperties, depth)
+		}
+		return object
+	}
+
+	return nil
+}
+
+func fakeString(s *Schema) string {
+	var value string
+	switch s.Format {
+	case "date-time":
+		value = "2006-01-02T15:04:05Z"
+	case "date":
+		value = "2006-01-02"
+	case "email":
+		value = "user@example.com"
+	case "uuid":
+		value = "00000000-0000-4000-8000-000000000000"
+	case "uri", "url":
+		value = "https://example.com"
+	case "byte":
+		value = "c3RyaW5n"
+	default:
+		value = "string"
+	}
+
+	if s.MinLength != nil && len(value) < *s.MinLength {
+		value += strings.Repeat("x", *s.MinLength-len(value))
+	}
+	if s.MaxLength != nil && len(value) > *s.MaxLength {
+		value = value[:*s.MaxLength]
+	}
+
+	return value
+}
+
+func fakeNumber(s *Schema, value float64) float64 {
+	if s.Minimum != nil && value < *s.Minimum {
+		value = *s.Minimum
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		value = *s.Maximum
+	}
+	return value
+}
@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Order struct {
+	ID     int64   `json:"id" example:"42"`
+	Status string  `json:"status" validate:"oneof=pending paid"`
+	Email  string  `json:"email"`
+	Items  []Money `json:"items"`
+	Parent *Order  `json:"parent,omitempty"`
+}
+
+const designDocument = `
+openapi: 3.0.3
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /customers/{id}:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              example:
+                id: c-1
+                name: Alice
+        "404":
+          description: Not Found
+`
+
+func serve(e *echo.Echo, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(designDocument), 0o600))
+	design, err := LoadDocument(path)
+	require.NoError(t, err)
+
+	e := echo.New()
+	spec := NewSpec()
+	e.GET("/orders/:id", NotImplemented)
+	spec.Describe(http.MethodGet, "/orders/:id", Doc{Responses: map[int]interface{}{http.StatusOK: Order{}}})
+	e.POST("/orders", NotImplemented)
+	spec.Describe(http.MethodPost, "/orders", Doc{
+		Responses: map[int]interface{}{http.StatusCreated: Order{}},
+		Examples:  map[int]interface{}{http.StatusCreated: map[string]interface{}{"id": 7}},
+	})
+	e.DELETE("/orders/:id", NotImplemented)
+	e.GET("/implemented", func(c echo.Context) error { return c.String(http.StatusOK, "real") })
+
+	Mock(e, spec, MockConfig{Document: design})
+
+	rec := serve(e, http.MethodGet, "/orders/1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(MockHeader))
+
+	var order map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+	assert.Equal(t, float64(42), order["id"])
+	assert.Equal(t, "pending", order["status"])
+	assert.Equal(t, "string", order["email"])
+	assert.Len(t, order["items"], 1)
+
+	rec = serve(e, http.MethodPost, "/orders", nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id":7}`, rec.Body.String())
+
+	rec = serve(e, http.MethodDelete, "/orders/1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	// The operations of the design document without route are mocked.
+	rec = serve(e, http.MethodGet, "/customers/c-1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"c-1","name":"Alice"}`, rec.Body.String())
+
+	rec = serve(e, http.MethodGet, "/customers/c-1", http.Header{"Prefer": {"code=404"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(e, http.MethodGet, "/implemented", nil)
+	assert.Equal(t, "real", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(MockHeader))
+}
+
+func TestMockReplacedByRoute(t *testing.T) {
+	e := echo.New()
+	Mock(e, NewSpec(), MockConfig{Document: &Document{Paths: map[string]PathItem{
+		"/customers": {"get": &Operation{Responses: map[string]*Response{"200": {Description: "OK"}}}},
+	}}})
+
+	e.GET("/customers", func(c echo.Context) error { return c.String(http.StatusOK, "real") })
+
+	rec := serve(e, http.MethodGet, "/customers", nil)
+	assert.Equal(t, "real", rec.Body.String())
+}
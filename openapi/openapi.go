@@ -0,0 +1,320 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package openapi generates the OpenAPI 3 document of the echo routes. The routes are always listed, so the
+// document stays in sync with the router, and they are described by the request and response structs
+// registered with `Spec.Describe`:
+//
+//	spec.Describe(http.MethodPost, "/products", openapi.Doc{
+//		Summary:   "Create a product",
+//		Tags:      []string{"products"},
+//		Request:   CreateProductRequest{},
+//		Responses: map[int]interface{}{http.StatusCreated: Product{}, http.StatusBadRequest: nil},
+//	})
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+	Tags       []Tag               `json:"tags,omitempty"`
+}
+
+// Info is the metadata of the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups the operations.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path by their lower case method.
+type PathItem map[string]*Operation
+
+// Operation is an API operation of a route.
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody is the body of a request.
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body.
+type MediaType struct {
+	Schema  *Schema     `json:"schema,omitempty"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+// Components holds the schemas of the named structs.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is the JSON schema of a value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+// Doc describes the operation of a route.
+type Doc struct {
+	// OperationID is the unique name of the operation, the clients generators use it as the method name.
+	// Optional. Default value the name of the route if it's set by the application.
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	// Request is a value of the request body type, like `CreateProductRequest{}`.
+	// Optional. Default value nil, no body.
+	Request interface{}
+
+	// Query is a value of a struct whose `query` tagged fields are the query parameters.
+	// Optional.
+	Query interface{}
+
+	// Responses are the values of the response body types by status, nil for a response without body.
+	// Optional. Default value a `default` response without schema.
+	Responses map[int]interface{}
+
+	// Examples are the example response bodies by status, they're the responses of the mock mode. (see `Mock`)
+	// Optional. Default value nil, the fields of the responses are examples of their `example` tag.
+	Examples map[int]interface{}
+}
+
+// Spec holds the docs of the routes. It's safe for concurrent use.
+type Spec struct {
+	mu   sync.RWMutex
+	docs map[string]Doc
+}
+
+// NewSpec returns an empty spec.
+func NewSpec() *Spec {
+	return &Spec{docs: map[string]Doc{}}
+}
+
+// Describe sets the doc of the route of `method` and `path`, the path is the echo path like `/products/:id`.
+func (s *Spec) Describe(method, path string, doc Doc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.docs[method+" "+path] = doc
+}
+
+// Doc returns the doc of a route, false if it's not described.
+func (s *Spec) Doc(method, path string) (Doc, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.docs[method+" "+path]
+	return doc, ok
+}
+
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodHead: true, http.MethodOptions: true,
+}
+
+// Generate returns the document of `routes`, the paths starting with one of `skip` are left out.
+func (s *Spec) Generate(info Info, routes []*echo.Route, skip ...string) *Document {
+	doc := &Document{OpenAPI: Version, Info: info, Paths: map[string]PathItem{}}
+	schemas := newSchemaBuilder()
+	tags := map[string]bool{}
+
+	routes = append([]*echo.Route(nil), routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+routes:
+	for _, route := range routes {
+		if !methods[route.Method] {
+			continue
+		}
+		for _, prefix := range skip {
+			if strings.HasPrefix(route.Path, prefix) {
+				continue routes
+			}
+		}
+
+		path, params := convertPath(route.Path)
+		d, _ := s.Doc(route.Method, route.Path)
+
+		op := &Operation{
+			OperationID: d.OperationID,
+			Summary:     d.Summary,
+			Description: d.Description,
+			Tags:        d.Tags,
+			Deprecated:  d.Deprecated,
+			Parameters:  params,
+			Responses:   map[string]*Response{},
+		}
+		if op.OperationID == "" && isOperationID(route.Name) {
+			op.OperationID = route.Name
+		}
+		for _, tag := range d.Tags {
+			tags[tag] = true
+		}
+
+		if d.Query != nil {
+			op.Parameters = append(op.Parameters, schemas.queryParameters(reflect.TypeOf(d.Query))...)
+		}
+
+		if d.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{echo.MIMEApplicationJSON: {Schema: schemas.schema(reflect.TypeOf(d.Request))}},
+			}
+		}
+
+		for status, body := range d.Responses {
+			res := &Response{Description: http.StatusText(status)}
+			if body != nil {
+				res.Content = map[string]MediaType{echo.MIMEApplicationJSON: {
+					Schema:  schemas.schema(reflect.TypeOf(body)),
+					Example: d.Examples[status],
+				}}
+			}
+			op.Responses[strconv.Itoa(status)] = res
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["default"] = &Response{Description: "Response"}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	if len(schemas.components) > 0 {
+		doc.Components = &Components{Schemas: schemas.components}
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+
+	return doc
+}
+
+// convertPath returns the OpenAPI path of an echo path, `/products/:id` is `/products/{id}`, and its
+// parameters. The `*` wildcard is the `wildcard` parameter.
+func convertPath(path string) (string, []Parameter) {
+	var params []Parameter
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var name string
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = segment[1:]
+		case segment == "*":
+			name = "wildcard"
+		default:
+			continue
+		}
+
+		segments[i] = "{" + name + "}"
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// isOperationID reports whether a route name is set by the application, echo names the routes by their
+// handler function, like `github.com/org/app/handlers.(*productHandler).List-fm`.
+func isOperationID(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/()*")
+}
@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency" validate:"required,oneof=JPY USD"`
+}
+
+type Base struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Product struct {
+	Base
+	Name     string            `json:"name" validate:"required,min=1,max=64" description:"Display name"`
+	Price    Money             `json:"price"`
+	Tags     []string          `json:"tags,omitempty"`
+	Attrs    map[string]string `json:"attrs"`
+	Parent   *Product          `json:"parent,omitempty"`
+	Discount *float64          `json:"discount"`
+	Image    []byte            `json:"image"`
+	internal string
+	Ignored  string `json:"-"`
+}
+
+type ListQuery struct {
+	Page  int    `query:"page" validate:"min=1"`
+	Sort  string `query:"sort" validate:"required,oneof=name price"`
+	Other string
+}
+
+func TestGenerate(t *testing.T) {
+	e := echo.New()
+	noop := func(c echo.Context) error { return nil }
+	e.GET("/products", noop).Name = "listProducts"
+	e.POST("/products", noop)
+	e.GET("/products/:id", noop)
+	e.GET("/files/*", noop)
+	e.GET("/debug/vars", noop)
+
+	spec := NewSpec()
+	spec.Describe(http.MethodGet, "/products", Doc{
+		Summary:   "List the products",
+		Tags:      []string{"products"},
+		Query:     ListQuery{},
+		Responses: map[int]interface{}{http.StatusOK: []Product{}},
+	})
+	spec.Describe(http.MethodPost, "/products", Doc{
+		OperationID: "createProduct",
+		Tags:        []string{"products", "admin"},
+		Request:     &Product{},
+		Responses:   map[int]interface{}{http.StatusCreated: Product{}, http.StatusBadRequest: nil},
+	})
+
+	doc := spec.Generate(Info{Title: "Shop", Version: "1.0.0"}, e.Routes(), "/debug")
+
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Len(t, doc.Paths, 3)
+	assert.Equal(t, []Tag{{Name: "admin"}, {Name: "products"}}, doc.Tags)
+
+	list := doc.Paths["/products"]["get"]
+	require.NotNil(t, list)
+	assert.Equal(t, "listProducts", list.OperationID)
+	require.Len(t, list.Parameters, 2)
+	assert.Equal(t, "page", list.Parameters[0].Name)
+	assert.Equal(t, float64(1), *list.Parameters[0].Schema.Minimum)
+	assert.False(t, list.Parameters[0].Required)
+	assert.True(t, list.Parameters[1].Required)
+	assert.Equal(t, []interface{}{"name", "price"}, list.Parameters[1].Schema.Enum)
+	assert.Equal(t, "#/components/schemas/Product", list.Responses["200"].Content[echo.MIMEApplicationJSON].Schema.Items.Ref)
+
+	create := doc.Paths["/products"]["post"]
+	assert.Equal(t, "createProduct", create.OperationID)
+	assert.Equal(t, "#/components/schemas/Product", create.RequestBody.Content[echo.MIMEApplicationJSON].Schema.Ref)
+	assert.Equal(t, "Bad Request", create.Responses["400"].Description)
+	assert.Nil(t, create.Responses["400"].Content)
+
+	get := doc.Paths["/products/{id}"]["get"]
+	assert.Empty(t, get.OperationID)
+	assert.Equal(t, []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, get.Parameters)
+	assert.Contains(t, get.Responses, "default")
+	assert.Contains(t, doc.Paths, "/files/{wildcard}")
+
+	product := doc.Components.Schemas["Product"]
+	require.NotNil(t, product)
+	assert.Equal(t, []string{"name"}, product.Required)
+	assert.ElementsMatch(t, []string{"id", "createdAt", "name", "price", "tags", "attrs", "parent", "discount", "image"}, keys(product.Properties))
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, product.Properties["createdAt"])
+	assert.Equal(t, "Display name", product.Properties["name"].Description)
+	assert.Equal(t, 64, *product.Properties["name"].MaxLength)
+	assert.Equal(t, "#/components/schemas/Product", product.Properties["parent"].Ref)
+	assert.True(t, product.Properties["discount"].Nullable)
+	assert.Equal(t, "byte", product.Properties["image"].Format)
+	assert.Equal(t, "string", product.Properties["attrs"].AdditionalProperties.Type)
+
+	money := doc.Components.Schemas["Money"]
+	assert.Equal(t, []interface{}{"JPY", "USD"}, money.Properties["currency"].Enum)
+	assert.Equal(t, "int64", money.Properties["amount"].Format)
+}
+
+func TestRegister(t *testing.T) {
+	e := echo.New()
+	spec := NewSpec()
+	require.NoError(t, Register(e, spec, Config{Info: Info{Title: "Shop"}, UI: UIRedoc}))
+	e.GET("/products", func(c echo.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc Document
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "Shop", doc.Info.Title)
+	assert.Equal(t, DefaultConfig.Info.Version, doc.Info.Version)
+	assert.Equal(t, []string{"/products"}, keys(doc.Paths))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), `<redoc spec-url="/openapi.json">`))
+
+	assert.Error(t, Register(echo.New(), spec, Config{UI: "rapidoc"}))
+}
+
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
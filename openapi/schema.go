@@ -0,0 +1,295 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType = reflect.TypeOf((*interface{ MarshalText() ([]byte, error) })(nil)).Elem()
+)
+
+// typeArgPkgPath matches the package path of a type argument of a generic type name.
+var typeArgPkgPath = regexp.MustCompile(`[\w./-]*/|\w+\.`)
+
+// schemaBuilder builds the schemas of the types, the named structs are in the components and referenced.
+type schemaBuilder struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	s := b.typeSchema(t)
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+
+	return s
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Kind() != reflect.Struct && reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+
+	// An interface is any value.
+	return &Schema{}
+}
+
+// component adds the schema of a named struct to the components and returns its name. The name is
+// qualified by the package if another type has the same name.
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+
+	name := componentName(t.Name())
+	if _, ok := b.components[name]; ok {
+		name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+	}
+
+	// Registered before the fields, so that a recursive struct references itself.
+	b.names[t] = name
+	b.components[name] = &Schema{}
+	*b.components[name] = *b.structSchema(t)
+
+	return name
+}
+
+// componentName returns the name of an instantiated generic type without the package paths of its type
+// arguments, `Envelope[github.com/example/models.Product]` is `Envelope_Product`.
+func componentName(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+
+	name = typeArgPkgPath.ReplaceAllString(name, "")
+	return strings.NewReplacer("[", "_", "]", "", ",", "_", "*", "", " ", "").Replace(name)
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+
+	return s
+}
+
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fs := b.schema(field.Type)
+		rules := validateRules(field.Tag.Get("validate"))
+		applyRules(fs, rules)
+		if desc := field.Tag.Get("description"); desc != "" && fs.Ref == "" {
+			fs.Description = desc
+		}
+		if example := field.Tag.Get("example"); example != "" && fs.Ref == "" {
+			fs.Example = enumValue(fs.Type, example)
+		}
+
+		s.Properties[name] = fs
+		if _, ok := rules["required"]; ok {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// queryParameters returns the parameters of the `query` tagged fields of a struct.
+func (b *schemaBuilder) queryParameters(t reflect.Type) []Parameter {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("query")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		s := b.schema(field.Type)
+		rules := validateRules(field.Tag.Get("validate"))
+		applyRules(s, rules)
+		_, required := rules["required"]
+
+		params = append(params, Parameter{
+			Name:        name,
+			In:          "query",
+			Description: field.Tag.Get("description"),
+			Required:    required,
+			Schema:      s,
+		})
+	}
+
+	return params
+}
+
+// validateRules returns the rules of a `validate` tag by name, like `required,min=1,oneof=a b`.
+func validateRules(tag string) map[string]string {
+	rules := map[string]string{}
+	if tag == "" {
+		return rules
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		rules[name] = param
+	}
+
+	return rules
+}
+
+// applyRules documents the `oneof`, `min` and `max` rules of the validator.
+func applyRules(s *Schema, rules map[string]string) {
+	if s.Ref != "" {
+		return
+	}
+
+	if oneof, ok := rules["oneof"]; ok {
+		for _, v := range strings.Fields(oneof) {
+			s.Enum = append(s.Enum, enumValue(s.Type, v))
+		}
+	}
+
+	for _, rule := range []string{"min", "max"} {
+		param, ok := rules[rule]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			continue
+		}
+
+		switch s.Type {
+		case "integer", "number":
+			if rule == "min" {
+				s.Minimum = &n
+			} else {
+				s.Maximum = &n
+			}
+		case "string":
+			l := int(n)
+			if rule == "min" {
+				s.MinLength = &l
+			} else {
+				s.MaxLength = &l
+			}
+		}
+	}
+}
+
+func enumValue(typ, v string) interface{} {
+	switch typ {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
@@ -0,0 +1,362 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package paginator parses the pagination parameters of a list endpoint and applies them to a gorm query
+// or a mongo find. Two modes are supported:
+//
+//	GET /orders?page=2&limit=20     offset pagination, with an optional total count
+//	GET /orders?cursor=...&limit=20 keyset pagination on a unique key, the cursor is opaque to the client
+//
+// The paginator only receives a `*gorm.DB` or a `*mongo.Collection`, so the tenant databases work the same
+// way as the master one.
+package paginator
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/response"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Config defines the pagination of an endpoint.
+type Config struct {
+	// DefaultLimit is the page size if the `limit` parameter is missing.
+	// Optional. Default value 20.
+	DefaultLimit int
+
+	// MaxLimit is the maximum page size.
+	// Optional. Default value 100.
+	MaxLimit int
+
+	// Key is the unique column or mongo field of the keyset pagination, the rows are sorted by it.
+	// Optional. Default value "id" for gorm and "_id" for mongo.
+	Key string
+
+	// Desc sorts the rows by `Key` in the descending order, like the newest first.
+	// Optional. Default value false.
+	Desc bool
+
+	// CountTotal runs a count query for the total of the offset pagination.
+	// Optional. Default value false.
+	CountTotal bool
+}
+
+// DefaultConfig is the default pagination config.
+var DefaultConfig = Config{
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// Names of the query parameters.
+const (
+	PageParam   = "page"
+	LimitParam  = "limit"
+	CursorParam = "cursor"
+)
+
+var (
+	ErrInvalidPage   = errors.New("paginator: page must be a positive integer")
+	ErrInvalidLimit  = errors.New("paginator: limit must be a positive integer")
+	ErrInvalidCursor = errors.New("paginator: cursor is not valid")
+	ErrPageAndCursor = errors.New("paginator: page and cursor can't be used together")
+)
+
+// Paginator is the parsed pagination of a request.
+type Paginator struct {
+	Page   int
+	Limit  int
+	Cursor interface{} // The key of the last row of the previous page, nil for the first page.
+
+	cursorMode bool
+	config     Config
+}
+
+// Parse validates the pagination parameters of the request. It returns a `400 Bad Request` `APIError`
+// if they are not valid.
+func Parse(c echo.Context, config Config) (*Paginator, error) {
+	p, err := ParseValues(c.QueryParam(PageParam), c.QueryParam(LimitParam), c.QueryParam(CursorParam), c.QueryParams().Has(CursorParam), config)
+	if err != nil {
+		return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, err)
+	}
+
+	return p, nil
+}
+
+// ParseValues is same as `Parse` with the raw parameters. `cursorMode` selects the keyset pagination even
+// if the cursor is empty, for the first page.
+func ParseValues(page, limit, cursor string, cursorMode bool, config Config) (*Paginator, error) {
+	if config.DefaultLimit <= 0 {
+		config.DefaultLimit = DefaultConfig.DefaultLimit
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = DefaultConfig.MaxLimit
+	}
+
+	p := &Paginator{Page: 1, Limit: config.DefaultLimit, cursorMode: cursorMode, config: config}
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			return nil, ErrInvalidLimit
+		}
+		if l > config.MaxLimit {
+			l = config.MaxLimit
+		}
+		p.Limit = l
+	}
+
+	if cursorMode && page != "" {
+		return nil, ErrPageAndCursor
+	}
+
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidPage
+		}
+		p.Page = n
+	}
+
+	if cursor != "" {
+		value, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		p.Cursor = value
+	}
+
+	return p, nil
+}
+
+// IsCursor reports whether it's a keyset pagination.
+func (p *Paginator) IsCursor() bool {
+	return p.cursorMode
+}
+
+// Offset returns the number of rows to skip of the offset pagination.
+func (p *Paginator) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Find executes the query of `db` for a page into `dest`, a pointer to a slice of models.
+// Example:
+//
+//	var orders []Order
+//	meta, err := p.Find(db.Where("status = ?", status), &orders)
+//	...
+//	return response.Paginated(c, orders, *meta)
+func (p *Paginator) Find(db *gorm.DB, dest interface{}) (*response.Meta, error) {
+	key := p.key("id")
+	meta := &response.Meta{Limit: p.Limit}
+
+	if p.cursorMode {
+		if p.Cursor != nil {
+			if p.config.Desc {
+				db = db.Where(clause.Lt{Column: clause.Column{Name: key}, Value: p.Cursor})
+			} else {
+				db = db.Where(clause.Gt{Column: clause.Column{Name: key}, Value: p.Cursor})
+			}
+		}
+	} else {
+		meta.Page = p.Page
+
+		if p.config.CountTotal {
+			var total int64
+			if err := db.Session(&gorm.Session{}).Model(dest).Count(&total).Error; err != nil {
+				return nil, err
+			}
+			meta.Total = &total
+		}
+
+		db = db.Offset(p.Offset())
+	}
+
+	err := db.Order(clause.OrderByColumn{Column: clause.Column{Name: key}, Desc: p.config.Desc}).
+		Limit(p.Limit + 1).Find(dest).Error
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := p.trim(dest, meta)
+	if err != nil || !last.IsValid() || !p.cursorMode || !meta.HasMore {
+		return meta, err
+	}
+
+	s, err := schema.Parse(dest, schemaCache, db.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	field := s.LookUpField(key)
+	if field == nil {
+		return nil, errors.New("paginator: unknown key " + key)
+	}
+	value, _ := field.ValueOf(reflect.Indirect(last))
+
+	meta.NextCursor, err = EncodeCursor(value)
+
+	return meta, err
+}
+
+// FindMongo executes `filter` on the collection for a page into `dest`, a pointer to a slice of documents.
+func (p *Paginator) FindMongo(ctx context.Context, coll *mongo.Collection, filter interface{}, dest interface{}) (*response.Meta, error) {
+	key := p.key("_id")
+	meta := &response.Meta{Limit: p.Limit}
+
+	order := 1
+	if p.config.Desc {
+		order = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: key, Value: order}}).SetLimit(int64(p.Limit + 1))
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	if p.cursorMode {
+		if p.Cursor != nil {
+			op := "$gt"
+			if p.config.Desc {
+				op = "$lt"
+			}
+			filter = bson.M{"$and": bson.A{filter, bson.M{key: bson.M{op: p.Cursor}}}}
+		}
+	} else {
+		meta.Page = p.Page
+
+		if p.config.CountTotal {
+			total, err := coll.CountDocuments(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+			meta.Total = &total
+		}
+
+		opts.SetSkip(int64(p.Offset()))
+	}
+
+	cur, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, dest); err != nil {
+		return nil, err
+	}
+
+	last, err := p.trim(dest, meta)
+	if err != nil || !last.IsValid() || !p.cursorMode || !meta.HasMore {
+		return meta, err
+	}
+
+	raw, err := bson.Marshal(last.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	value, ok := doc[key]
+	if !ok {
+		return nil, errors.New("paginator: unknown key " + key)
+	}
+
+	meta.NextCursor, err = EncodeCursor(value)
+
+	return meta, err
+}
+
+// EncodeCursor returns the opaque cursor of a key value.
+func EncodeCursor(value interface{}) (string, error) {
+	b, err := bson.Marshal(bson.M{"k": value})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor returns the key value of a cursor created by `EncodeCursor`. Only the scalar values are
+// accepted, so that a forged cursor can't inject a query operator. A time is returned as `time.Time` in UTC.
+func DecodeCursor(cursor string) (interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	switch v := doc["k"].(type) {
+	case string, int32, int64, float64, primitive.ObjectID:
+		return v, nil
+	case primitive.DateTime:
+		return v.Time().UTC(), nil
+	default:
+		return nil, ErrInvalidCursor
+	}
+}
+
+var schemaCache = &sync.Map{}
+
+func (p *Paginator) key(def string) string {
+	if p.config.Key != "" {
+		return p.config.Key
+	}
+
+	return def
+}
+
+// trim removes the extra row fetched to know whether there is a next page and returns the last row.
+func (p *Paginator) trim(dest interface{}, meta *response.Meta) (reflect.Value, error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, errors.New("paginator: dest must be a pointer to a slice")
+	}
+	rv = rv.Elem()
+
+	if rv.Len() > p.Limit {
+		meta.HasMore = true
+		rv.Set(rv.Slice(0, p.Limit))
+	}
+	if rv.Len() == 0 {
+		return reflect.Value{}, nil
+	}
+
+	return rv.Index(rv.Len() - 1), nil
+}
@@ -0,0 +1,97 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package paginator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestParseValues(t *testing.T) {
+	p, err := ParseValues("3", "500", "", false, Config{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, p.Page)
+		assert.Equal(t, 100, p.Limit)
+		assert.Equal(t, 200, p.Offset())
+		assert.False(t, p.IsCursor())
+	}
+
+	_, err = ParseValues("0", "", "", false, Config{})
+	assert.Equal(t, ErrInvalidPage, err)
+	_, err = ParseValues("", "-1", "", false, Config{})
+	assert.Equal(t, ErrInvalidLimit, err)
+	_, err = ParseValues("2", "", "", true, Config{})
+	assert.Equal(t, ErrPageAndCursor, err)
+	_, err = ParseValues("", "", "not a cursor", true, Config{})
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestCursor(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	id := primitive.NewObjectID()
+
+	for _, value := range []interface{}{int64(42), "order-42", id, now} {
+		cursor, err := EncodeCursor(value)
+		assert.NoError(t, err)
+
+		decoded, err := DecodeCursor(cursor)
+		assert.NoError(t, err)
+		assert.Equal(t, value, decoded)
+	}
+
+	// A query operator can't be smuggled in a cursor.
+	cursor, _ := EncodeCursor(map[string]interface{}{"$ne": nil})
+	_, err := DecodeCursor(cursor)
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestFind_SQL(t *testing.T) {
+	type order struct {
+		ID     int64
+		Status string
+	}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cursor, _ := EncodeCursor(int64(42))
+	p, _ := ParseValues("", "10", cursor, true, Config{Desc: true})
+
+	var orders []order
+	var sql string
+	db.Callback().Query().After("gorm:query").Register("test:sql", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+
+	meta, err := p.Find(db.Where("status = ?", "paid"), &orders)
+	assert.NoError(t, err)
+	assert.False(t, meta.HasMore)
+	assert.Equal(t, "SELECT * FROM `orders` WHERE status = ? AND `id` < ? ORDER BY `id` DESC LIMIT 11", sql)
+}
@@ -0,0 +1,306 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"database/sql"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/retail-ai-inc/bean/gopool"
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/retail-ai-inc/bean/middleware"
+	"go.mongodb.org/mongo-driver/event"
+	"gorm.io/gorm"
+)
+
+// The tenant label of the master connections.
+const masterTenantLabel = "master"
+
+var (
+	mysqlOpenDesc      = newPoolDesc("mysql_pool_open_connections", "Established MySQL connections, in use and idle.", "tenant")
+	mysqlInUseDesc     = newPoolDesc("mysql_pool_in_use_connections", "MySQL connections currently in use.", "tenant")
+	mysqlIdleDesc      = newPoolDesc("mysql_pool_idle_connections", "Idle MySQL connections.", "tenant")
+	mysqlMaxOpenDesc   = newPoolDesc("mysql_pool_max_open_connections", "Maximum number of open MySQL connections, 0 is unlimited.", "tenant")
+	mysqlWaitCountDesc = newPoolDesc("mysql_pool_wait_count_total", "Total number of MySQL connections waited for.", "tenant")
+	mysqlWaitDurDesc   = newPoolDesc("mysql_pool_wait_duration_seconds_total", "Total time blocked waiting for a new MySQL connection.", "tenant")
+
+	redisTotalDesc    = newPoolDesc("redis_pool_total_connections", "Redis connections in the pool.", "tenant")
+	redisIdleDesc     = newPoolDesc("redis_pool_idle_connections", "Idle redis connections in the pool.", "tenant")
+	redisHitsDesc     = newPoolDesc("redis_pool_hits_total", "Times a free redis connection was found in the pool.", "tenant")
+	redisMissesDesc   = newPoolDesc("redis_pool_misses_total", "Times a free redis connection was not found in the pool.", "tenant")
+	redisTimeoutsDesc = newPoolDesc("redis_pool_timeouts_total", "Times a wait for a redis connection timed out.", "tenant")
+
+	gopoolRunningDesc  = newPoolDesc("gopool_running_goroutines", "Running goroutines of the pool.", "pool")
+	gopoolCapacityDesc = newPoolDesc("gopool_capacity", "Capacity of the pool, -1 is unlimited.", "pool")
+	gopoolWaitingDesc  = newPoolDesc("gopool_waiting_tasks", "Tasks waiting for a free goroutine of the pool.", "pool")
+	gopoolQueueDesc    = newPoolDesc("gopool_queue_length", "Maximum number of tasks waiting for a free goroutine of the pool, 0 is unlimited.", "pool")
+
+	badgerLSMSizeDesc    = newPoolDesc("badger_lsm_size_bytes", "Size of the LSM tree of the memory database.")
+	badgerVlogSizeDesc   = newPoolDesc("badger_vlog_size_bytes", "Size of the value log of the memory database.")
+	badgerLevelTableDesc = newPoolDesc("badger_lsm_level_tables", "Number of tables per level of the LSM tree.", "level")
+	badgerLevelSizeDesc  = newPoolDesc("badger_lsm_level_size_bytes", "Size per level of the LSM tree.", "level")
+)
+
+var (
+	mongoConnectionsDesc      = newPoolDesc("mongo_pool_connections", "Mongo connections in the pool, in use and idle.", "tenant")
+	mongoInUseDesc            = newPoolDesc("mongo_pool_in_use_connections", "Mongo connections currently checked out of the pool.", "tenant")
+	mongoCheckOutFailuresDesc = newPoolDesc("mongo_pool_checkout_failures_total", "Times a mongo connection couldn't be checked out of the pool, partitioned by reason. (example: timeout)", "tenant", "reason")
+)
+
+// mongoPoolStats are the statistics of the pool of a mongo connection, kept from the driver events.
+type mongoPoolStats struct {
+	connections int64
+	inUse       int64
+	failures    map[string]uint64
+}
+
+var (
+	// The mongo pools by tenant, labelled at every scrape as the label of a tenant can change.
+	mongoPoolsMu sync.Mutex
+	mongoPools   = map[string]*mongoPoolStats{}
+
+	// tenantLabels bounds the tenant label of the pool metrics with the ranking of the HTTP metrics, nil
+	// if tenant mode or prometheus is off.
+	tenantLabels *middleware.TenantLabels
+
+	poolMetricsOnce sync.Once
+)
+
+func newPoolDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName("bean", "", name), help, labels, nil)
+}
+
+// poolCollector reads the statistics of the database and goroutine pools at every scrape, so that the
+// tenants connected later and the pools registered after the start are included.
+type poolCollector struct {
+	b *Bean
+}
+
+func (p poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		mysqlOpenDesc, mysqlInUseDesc, mysqlIdleDesc, mysqlMaxOpenDesc, mysqlWaitCountDesc, mysqlWaitDurDesc,
+		mongoConnectionsDesc, mongoInUseDesc, mongoCheckOutFailuresDesc,
+		redisTotalDesc, redisIdleDesc, redisHitsDesc, redisMissesDesc, redisTimeoutsDesc,
+		gopoolRunningDesc, gopoolCapacityDesc, gopoolWaitingDesc, gopoolQueueDesc,
+		badgerLSMSizeDesc, badgerVlogSizeDesc, badgerLevelTableDesc, badgerLevelSizeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (p poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if deps := p.b.DBConn; deps != nil {
+		mysql := map[string]sql.DBStats{}
+		addMySQL(mysql, masterTenantLabel, deps.MasterMySQLDB)
+		for tenantID, db := range deps.TenantMySQLDBs {
+			addMySQL(mysql, tenantLabel(strconv.FormatUint(tenantID, 10)), db)
+		}
+		for tenant, stats := range mysql {
+			collectMySQL(ch, tenant, stats)
+		}
+
+		redisStats := map[string]redis.PoolStats{}
+		for _, conn := range deps.MasterRedisDB {
+			addRedis(redisStats, masterTenantLabel, conn)
+		}
+		for tenantID, conn := range deps.TenantRedisDBs {
+			addRedis(redisStats, tenantLabel(strconv.FormatUint(tenantID, 10)), conn)
+		}
+		for tenant, stats := range redisStats {
+			collectRedis(ch, tenant, stats)
+		}
+
+		if deps.MemoryDB != nil {
+			lsm, vlog := deps.MemoryDB.Size()
+			ch <- prometheus.MustNewConstMetric(badgerLSMSizeDesc, prometheus.GaugeValue, float64(lsm))
+			ch <- prometheus.MustNewConstMetric(badgerVlogSizeDesc, prometheus.GaugeValue, float64(vlog))
+
+			for _, level := range deps.MemoryDB.Levels() {
+				l := strconv.Itoa(level.Level)
+				ch <- prometheus.MustNewConstMetric(badgerLevelTableDesc, prometheus.GaugeValue, float64(level.NumTables), l)
+				ch <- prometheus.MustNewConstMetric(badgerLevelSizeDesc, prometheus.GaugeValue, float64(level.Size), l)
+			}
+		}
+	}
+
+	collectMongo(ch)
+
+	for _, stats := range gopool.AllStats() {
+		ch <- prometheus.MustNewConstMetric(gopoolRunningDesc, prometheus.GaugeValue, float64(stats.Running), stats.Name)
+		ch <- prometheus.MustNewConstMetric(gopoolCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity), stats.Name)
+		ch <- prometheus.MustNewConstMetric(gopoolWaitingDesc, prometheus.GaugeValue, float64(stats.Waiting), stats.Name)
+		ch <- prometheus.MustNewConstMetric(gopoolQueueDesc, prometheus.GaugeValue, float64(stats.QueueLength), stats.Name)
+	}
+}
+
+// tenantLabel returns the label of a tenant of the pool metrics, "other" if it's not one of the busiest
+// tenants of the HTTP metrics.
+func tenantLabel(tenant string) string {
+	if tenantLabels == nil || tenant == masterTenantLabel {
+		return tenant
+	}
+
+	return tenantLabels.Label(tenant)
+}
+
+// requestTenant returns the tenant of the request for the HTTP metrics, "" if the bean instance has no
+// `TenantID`.
+func requestTenant(c echo.Context) string {
+	b := Of(c.Echo())
+	if b == nil || b.TenantID == nil {
+		return ""
+	}
+
+	return strconv.FormatUint(b.TenantID(c), 10)
+}
+
+// addMySQL adds the statistics of the pool of `db` to the ones of `tenant`, the tenants sharing a label
+// are summed up.
+func addMySQL(stats map[string]sql.DBStats, tenant string, db *gorm.DB) {
+	if db == nil {
+		return
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	s, total := sqlDB.Stats(), stats[tenant]
+	total.OpenConnections += s.OpenConnections
+	total.InUse += s.InUse
+	total.Idle += s.Idle
+	total.MaxOpenConnections += s.MaxOpenConnections
+	total.WaitCount += s.WaitCount
+	total.WaitDuration += s.WaitDuration
+	stats[tenant] = total
+}
+
+func collectMySQL(ch chan<- prometheus.Metric, tenant string, stats sql.DBStats) {
+	ch <- prometheus.MustNewConstMetric(mysqlOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections), tenant)
+	ch <- prometheus.MustNewConstMetric(mysqlInUseDesc, prometheus.GaugeValue, float64(stats.InUse), tenant)
+	ch <- prometheus.MustNewConstMetric(mysqlIdleDesc, prometheus.GaugeValue, float64(stats.Idle), tenant)
+	ch <- prometheus.MustNewConstMetric(mysqlMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections), tenant)
+	ch <- prometheus.MustNewConstMetric(mysqlWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount), tenant)
+	ch <- prometheus.MustNewConstMetric(mysqlWaitDurDesc, prometheus.CounterValue, stats.WaitDuration.Seconds(), tenant)
+}
+
+// addRedis adds the statistics of the pool of `conn` to the ones of `tenant`.
+func addRedis(stats map[string]redis.PoolStats, tenant string, conn *dbdrivers.RedisDBConn) {
+	if conn == nil || conn.Client() == nil {
+		return
+	}
+
+	s, total := conn.Client().PoolStats(), stats[tenant]
+	total.TotalConns += s.TotalConns
+	total.IdleConns += s.IdleConns
+	total.Hits += s.Hits
+	total.Misses += s.Misses
+	total.Timeouts += s.Timeouts
+	stats[tenant] = total
+}
+
+func collectRedis(ch chan<- prometheus.Metric, tenant string, stats redis.PoolStats) {
+	ch <- prometheus.MustNewConstMetric(redisTotalDesc, prometheus.GaugeValue, float64(stats.TotalConns), tenant)
+	ch <- prometheus.MustNewConstMetric(redisIdleDesc, prometheus.GaugeValue, float64(stats.IdleConns), tenant)
+	ch <- prometheus.MustNewConstMetric(redisHitsDesc, prometheus.CounterValue, float64(stats.Hits), tenant)
+	ch <- prometheus.MustNewConstMetric(redisMissesDesc, prometheus.CounterValue, float64(stats.Misses), tenant)
+	ch <- prometheus.MustNewConstMetric(redisTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts), tenant)
+}
+
+// mongoPoolMonitor keeps the statistics of the mongo pool of a connection from the driver events, since
+// the driver doesn't expose the statistics of its pools.
+func mongoPoolMonitor(tenant string) *event.PoolMonitor {
+	mongoPoolsMu.Lock()
+	stats, ok := mongoPools[tenant]
+	if !ok {
+		stats = &mongoPoolStats{failures: map[string]uint64{}}
+		mongoPools[tenant] = stats
+	}
+	mongoPoolsMu.Unlock()
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			mongoPoolsMu.Lock()
+			defer mongoPoolsMu.Unlock()
+
+			switch e.Type {
+			case event.ConnectionCreated:
+				stats.connections++
+			case event.ConnectionClosed:
+				stats.connections--
+			case event.GetSucceeded:
+				stats.inUse++
+			case event.ConnectionReturned:
+				stats.inUse--
+			case event.GetFailed:
+				stats.failures[e.Reason]++
+			}
+		},
+	}
+}
+
+func collectMongo(ch chan<- prometheus.Metric) {
+	mongoPoolsMu.Lock()
+	total := map[string]*mongoPoolStats{}
+	for tenant, stats := range mongoPools {
+		label := tenantLabel(tenant)
+		t, ok := total[label]
+		if !ok {
+			t = &mongoPoolStats{failures: map[string]uint64{}}
+			total[label] = t
+		}
+
+		t.connections += stats.connections
+		t.inUse += stats.inUse
+		for reason, n := range stats.failures {
+			t.failures[reason] += n
+		}
+	}
+	mongoPoolsMu.Unlock()
+
+	for tenant, stats := range total {
+		ch <- prometheus.MustNewConstMetric(mongoConnectionsDesc, prometheus.GaugeValue, float64(stats.connections), tenant)
+		ch <- prometheus.MustNewConstMetric(mongoInUseDesc, prometheus.GaugeValue, float64(stats.inUse), tenant)
+		for reason, n := range stats.failures {
+			ch <- prometheus.MustNewConstMetric(mongoCheckOutFailuresDesc, prometheus.CounterValue, float64(n), tenant, reason)
+		}
+	}
+}
+
+// registerPoolMetrics registers the pool metrics into the default prometheus registry, served by the
+// `/metrics` endpoint. It must be called before the database connections are initialized for the mongo
+// pool events.
+func (b *Bean) registerPoolMetrics() {
+	poolMetricsOnce.Do(func() {
+		dbdrivers.MongoPoolMonitor = mongoPoolMonitor
+
+		// A collector registered with the same name is kept.
+		helpers.RegisterCollector(prometheus.DefaultRegisterer, poolCollector{b: b})
+	})
+}
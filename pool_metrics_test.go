@@ -0,0 +1,81 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/retail-ai-inc/bean/gopool"
+	"github.com/retail-ai-inc/bean/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestPoolCollector(t *testing.T) {
+	pool, err := ants.NewPool(4)
+	assert.NoError(t, err)
+	assert.NoError(t, gopool.Register("metrics_test", pool))
+	defer gopool.UnregisterAllPools()
+
+	collector := poolCollector{b: &Bean{DBConn: &DBDeps{}}}
+
+	expected := `
+# HELP bean_gopool_capacity Capacity of the pool, -1 is unlimited.
+# TYPE bean_gopool_capacity gauge
+bean_gopool_capacity{pool="metrics_test"} 4
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "bean_gopool_capacity"))
+}
+
+func TestMongoPoolMonitor(t *testing.T) {
+	defer func() { mongoPools = map[string]*mongoPoolStats{} }()
+
+	monitor := mongoPoolMonitor("42")
+
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	monitor.Event(&event.PoolEvent{Type: event.GetSucceeded})
+	monitor.Event(&event.PoolEvent{Type: event.GetFailed, Reason: event.ReasonTimedOut})
+
+	collector := poolCollector{b: &Bean{}}
+
+	expected := `
+# HELP bean_mongo_pool_connections Mongo connections in the pool, in use and idle.
+# TYPE bean_mongo_pool_connections gauge
+bean_mongo_pool_connections{tenant="42"} 2
+# HELP bean_mongo_pool_in_use_connections Mongo connections currently checked out of the pool.
+# TYPE bean_mongo_pool_in_use_connections gauge
+bean_mongo_pool_in_use_connections{tenant="42"} 1
+# HELP bean_mongo_pool_checkout_failures_total Times a mongo connection couldn't be checked out of the pool, partitioned by reason. (example: timeout)
+# TYPE bean_mongo_pool_checkout_failures_total counter
+bean_mongo_pool_checkout_failures_total{reason="timeout",tenant="42"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"bean_mongo_pool_connections", "bean_mongo_pool_in_use_connections", "bean_mongo_pool_checkout_failures_total"))
+}
+
+func TestPoolTenantLabels(t *testing.T) {
+	defer func() {
+		mongoPools = map[string]*mongoPoolStats{}
+		tenantLabels = nil
+	}()
+
+	tenantLabels = middleware.NewTenantLabels(middleware.TenantLabelsConfig{TopN: 1})
+	tenantLabels.Observe("1")
+
+	for _, tenant := range []string{masterTenantLabel, "1", "2", "3"} {
+		mongoPoolMonitor(tenant).Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	}
+
+	expected := `
+# HELP bean_mongo_pool_connections Mongo connections in the pool, in use and idle.
+# TYPE bean_mongo_pool_connections gauge
+bean_mongo_pool_connections{tenant="1"} 1
+bean_mongo_pool_connections{tenant="master"} 1
+bean_mongo_pool_connections{tenant="other"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(poolCollector{b: &Bean{}}, strings.NewReader(expected), "bean_mongo_pool_connections"))
+}
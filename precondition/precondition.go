@@ -0,0 +1,190 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package precondition ties the ETag of a resource to its optimistic locking version column, so that
+// the HTTP conditional requests (`If-Match`) protect the updates against the lost update problem:
+//
+//	func (h *orderHandler) Update(c echo.Context) error {
+//		version, err := precondition.IfMatch(c)
+//		if err != nil {
+//			return err
+//		}
+//		...
+//		newVersion, err := precondition.UpdateVersion(db.Model(&Order{}).Where("id = ?", id), version, updates)
+//		if err != nil {
+//			return err // 412 Precondition Failed with the latest ETag if the version is stale.
+//		}
+//		precondition.SetETag(c, newVersion)
+//		...
+//	}
+package precondition
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"gorm.io/gorm"
+)
+
+// VersionColumn is the optimistic locking column of the tables, an integer incremented by every update.
+var VersionColumn = "version"
+
+// AnyVersion is returned by `IfMatch` for `If-Match: *`, `UpdateVersion` doesn't check the version then.
+const AnyVersion int64 = -1
+
+var (
+	ErrPreconditionRequired = errors.New("precondition: If-Match header is required")
+	ErrInvalidETag          = errors.New("precondition: If-Match header is not a valid ETag")
+)
+
+// StaleVersionError is returned when the version of the client is not the current one anymore.
+type StaleVersionError struct {
+	Current int64
+}
+
+func (e *StaleVersionError) Error() string {
+	return "precondition: version is stale, the current version is " + strconv.FormatInt(e.Current, 10)
+}
+
+// ETag returns the strong ETag of a version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ParseETag returns the version of an ETag created by `ETag`.
+func ParseETag(etag string) (int64, error) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, ErrInvalidETag
+	}
+
+	version, err := strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrInvalidETag
+	}
+
+	return version, nil
+}
+
+// SetETag sets the `ETag` response header of the version.
+func SetETag(c echo.Context, version int64) {
+	c.Response().Header().Set("ETag", ETag(version))
+}
+
+// IfMatch returns the version of the `If-Match` request header. It fails with `428 Precondition Required`
+// if the header is missing and `412 Precondition Failed` if it's not a single strong ETag.
+func IfMatch(c echo.Context) (int64, error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if header == "" {
+		return 0, berror.NewIgnorableAPIError(http.StatusPreconditionRequired, berror.PRECONDITION_REQUIRED, ErrPreconditionRequired)
+	}
+
+	if header == "*" {
+		return AnyVersion, nil
+	}
+
+	version, err := ParseETag(header)
+	if err != nil {
+		return 0, berror.NewIgnorableAPIError(http.StatusPreconditionFailed, berror.PRECONDITION_FAILED, err)
+	}
+
+	return version, nil
+}
+
+// Check compares the `If-Match` request header with the current version of a resource, for the stores
+// which can't use `UpdateVersion`. It returns a `StaleVersionError` if they don't match.
+func Check(c echo.Context, current int64) error {
+	version, err := IfMatch(c)
+	if err != nil {
+		return err
+	}
+
+	if version != AnyVersion && version != current {
+		return &StaleVersionError{Current: current}
+	}
+
+	return nil
+}
+
+// UpdateVersion updates the row selected by `db` if its version is still `expected`, increments the version
+// and returns the new one. It returns a `StaleVersionError` with the current version if the row has been
+// updated by someone else, or `gorm.ErrRecordNotFound` if the row doesn't exist.
+// Example:
+//
+//	version, err := precondition.UpdateVersion(db.Model(&Order{}).Where("id = ?", id), 3, map[string]interface{}{
+//		"status": "shipped",
+//	})
+func UpdateVersion(db *gorm.DB, expected int64, updates map[string]interface{}) (int64, error) {
+	// IMPORTANT: A new session is required to reuse the conditions of `db` in the second query.
+	tx := db.Session(&gorm.Session{})
+
+	values := make(map[string]interface{}, len(updates)+1)
+	for column, value := range updates {
+		values[column] = value
+	}
+	values[VersionColumn] = gorm.Expr(VersionColumn + " + 1")
+
+	update := tx
+	if expected != AnyVersion {
+		update = update.Where(VersionColumn+" = ?", expected)
+	}
+
+	result := update.Updates(values)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 && expected != AnyVersion {
+		return expected + 1, nil
+	}
+
+	var versions []int64
+	if err := tx.Pluck(VersionColumn, &versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	if result.RowsAffected == 0 {
+		return 0, &StaleVersionError{Current: versions[0]}
+	}
+
+	return versions[0], nil
+}
+
+// ErrorHanderFunc responds `412 Precondition Failed` with the ETag of the current version to a
+// `StaleVersionError`, so that the client can fetch the latest state and retry.
+func ErrorHanderFunc(err error, c echo.Context) (bool, error) {
+	var staleErr *StaleVersionError
+	if !errors.As(err, &staleErr) {
+		return false, nil
+	}
+
+	SetETag(c, staleErr.Current)
+
+	return berror.APIErrorHanderFunc(berror.NewIgnorableAPIError(http.StatusPreconditionFailed, berror.PRECONDITION_FAILED, err), c)
+}
@@ -0,0 +1,92 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package precondition
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfMatch(t *testing.T) {
+	e := echo.New()
+
+	tests := []struct {
+		header  string
+		version int64
+		status  int
+	}{
+		{header: `"3"`, version: 3},
+		{header: `*`, version: AnyVersion},
+		{header: ``, status: http.StatusPreconditionRequired},
+		{header: `W/"3"`, status: http.StatusPreconditionFailed},
+		{header: `"abc"`, status: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("If-Match", tt.header)
+		}
+
+		version, err := IfMatch(e.NewContext(req, httptest.NewRecorder()))
+		if tt.status == 0 {
+			assert.NoError(t, err, tt.header)
+			assert.Equal(t, tt.version, version, tt.header)
+			continue
+		}
+
+		var apiErr *berror.APIError
+		if assert.True(t, errors.As(err, &apiErr), tt.header) {
+			assert.Equal(t, tt.status, apiErr.HTTPStatusCode, tt.header)
+		}
+	}
+}
+
+func TestCheckAndErrorHanderFunc(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", nil)
+	req.Header.Set("If-Match", ETag(2))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	assert.NoError(t, Check(c, 2))
+
+	err := Check(c, 5)
+	assert.Equal(t, &StaleVersionError{Current: 5}, err)
+
+	ok, err := ErrorHanderFunc(err, c)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, `"5"`, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Body.String(), string(berror.PRECONDITION_FAILED))
+
+	ok, _ = ErrorHanderFunc(errors.New("other"), c)
+	assert.False(t, ok)
+}
@@ -0,0 +1,193 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/retail-ai-inc/bean/helpers"
+	"github.com/spf13/viper"
+)
+
+// Checks of `Preflight`, which can be disabled with `preflight.skipChecks`.
+const (
+	PreflightSecret         = "secret"
+	PreflightJWTSecret      = "jwt_secret"
+	PreflightTLS            = "tls"
+	PreflightCORS           = "cors"
+	PreflightDebugEndpoints = "debug_endpoints"
+	PreflightDebugLogs      = "debug_logs"
+)
+
+// Secrets shorter than this are considered guessable.
+const preflightMinSecretLength = 16
+
+// Well known placeholder values which must never reach a deployed environment.
+var preflightDefaultSecrets = []string{"secret", "changeme", "change-me", "default", "password", "{{ .Secret }}", "{{ .JWTSecret }}"}
+
+// PreflightIssue is an insecure configuration found by `Preflight`.
+type PreflightIssue struct {
+	Check   string
+	Message string
+}
+
+func (i PreflightIssue) String() string {
+	return i.Check + ": " + i.Message
+}
+
+// Preflight returns the insecure settings of the config. The JWT secret is read from `jwt.secret` by viper
+// if the `jwt` section exists. `ServeAt` refuses to start with an issue in the environments listed in
+// `preflight.strictEnvironments` and logs a warning in the others.
+func Preflight(config Config) []PreflightIssue {
+	skip := make(map[string]bool, len(config.Preflight.SkipChecks))
+	for _, check := range config.Preflight.SkipChecks {
+		skip[check] = true
+	}
+
+	production := config.IsProduction()
+
+	var issues []PreflightIssue
+	add := func(check, format string, args ...interface{}) {
+		if !skip[check] {
+			issues = append(issues, PreflightIssue{Check: check, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if problem := weakSecret(config.Secret); problem != "" {
+		add(PreflightSecret, "`secret` %s", problem)
+	}
+
+	if viper.IsSet("jwt") {
+		if problem := weakSecret(viper.GetString("jwt.secret")); problem != "" {
+			add(PreflightJWTSecret, "`jwt.secret` %s", problem)
+		}
+	}
+
+	if config.Session.On {
+		for _, key := range config.Session.Keys {
+			if problem := weakSecret(key.Secret); problem != "" {
+				add(PreflightSecret, "`session.keys` %s secret %s", key.ID, problem)
+			}
+		}
+	}
+
+	if production && !config.HTTP.SSL.On {
+		add(PreflightTLS, "`http.ssl.on` is false in the %q environment, skip this check if TLS is terminated by a proxy", config.Environment)
+	}
+
+	if config.HTTP.CORS.AllowCredentials {
+		wildcard := len(config.HTTP.CORS.AllowOrigins) == 0 && len(config.HTTP.CORS.AllowOriginPatterns) == 0 && CORSAllowOriginFunc == nil
+		for _, origin := range config.HTTP.CORS.AllowOrigins {
+			if origin == "*" {
+				wildcard = true
+			}
+		}
+		if wildcard {
+			add(PreflightCORS, "`http.cors.allowCredentials` is true with any origin allowed, list the trusted origins in `http.cors.allowOrigins`")
+		}
+	}
+
+	if config.Database.Memory.On && config.Database.Memory.DelKeyAPI.EndPoint != "" && config.Database.Memory.DelKeyAPI.AuthBearerToken == "" {
+		add(PreflightDebugEndpoints, "`%s` deletes the memory database keys without authentication, set `database.memory.delKeyAPI.authBearerToken`",
+			config.Database.Memory.DelKeyAPI.EndPoint)
+	}
+
+	if config.Debug.Pprof.On && config.Debug.Pprof.Username != "" {
+		if problem := weakSecret(config.Debug.Pprof.Password); problem != "" {
+			add(PreflightDebugEndpoints, "`debug.pprof.password` %s", problem)
+		}
+	}
+
+	if production && config.OpenAPI.On && config.OpenAPI.Username == "" {
+		add(PreflightDebugEndpoints, "`openapi` serves the API document without authentication in the %q environment, set `openapi.username`", config.Environment)
+	}
+
+	if production {
+		if config.Database.MySQL.Debug {
+			add(PreflightDebugLogs, "`database.mysql.debug` logs all the SQL queries with their values in the %q environment", config.Environment)
+		}
+		if config.Sentry.Debug {
+			add(PreflightDebugLogs, "`sentry.debug` is true in the %q environment", config.Environment)
+		}
+	}
+
+	return issues
+}
+
+// preflight logs the issues of `Preflight` and refuses to start in the strict environments.
+func (b *Bean) preflight() {
+	issues := Preflight(b.Config)
+	if len(issues) == 0 {
+		return
+	}
+
+	strict := helpers.HasStringInSlice(b.Config.Preflight.strictEnvironments(), b.Config.Environment, nil)
+	for _, issue := range issues {
+		if strict {
+			b.Echo.Logger.Error("insecure configuration: ", issue)
+		} else {
+			b.Echo.Logger.Warn("insecure configuration: ", issue)
+		}
+	}
+
+	if strict {
+		b.Echo.Logger.Fatalf("refusing to start %s in the %q environment with %d insecure configuration(s)",
+			b.Config.ProjectName, b.Config.Environment, len(issues))
+	}
+}
+
+// IsProduction reports whether the environment is one of `preflight.productionEnvironments`.
+func (config Config) IsProduction() bool {
+	environments := config.Preflight.ProductionEnvironments
+	if len(environments) == 0 {
+		environments = []string{"production", "prod"}
+	}
+
+	return helpers.HasStringInSlice(environments, config.Environment, nil)
+}
+
+// strictEnvironments defaults to the production environments.
+func (p PreflightConfig) strictEnvironments() []string {
+	if p.StrictEnvironments != nil {
+		return p.StrictEnvironments
+	}
+	if len(p.ProductionEnvironments) > 0 {
+		return p.ProductionEnvironments
+	}
+
+	return []string{"production", "prod"}
+}
+
+func weakSecret(secret string) string {
+	switch {
+	case secret == "":
+		return "is empty"
+	case helpers.HasStringInSlice(preflightDefaultSecrets, strings.ToLower(secret), nil):
+		return "is a well known default value"
+	case len(secret) < preflightMinSecretLength:
+		return fmt.Sprintf("is shorter than %d characters", preflightMinSecretLength)
+	}
+
+	return ""
+}
@@ -0,0 +1,48 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"testing"
+
+	"github.com/retail-ai-inc/bean/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreflight(t *testing.T) {
+	checks := func(issues []PreflightIssue) []string {
+		names := []string{}
+		for _, issue := range issues {
+			names = append(names, issue.Check)
+		}
+		return names
+	}
+
+	var config Config
+	config.Environment = "production"
+	config.Secret = "changeme"
+	config.HTTP.CORS.AllowCredentials = true
+	config.Database.MySQL.Debug = true
+
+	assert.Equal(t, []string{PreflightSecret, PreflightTLS, PreflightCORS, PreflightDebugLogs}, checks(Preflight(config)))
+
+	config.Secret = "a-long-enough-random-secret"
+	config.HTTP.CORS.AllowOrigins = []string{"https://example.com"}
+	config.Preflight.SkipChecks = []string{PreflightTLS}
+	assert.Equal(t, []string{PreflightDebugLogs}, checks(Preflight(config)))
+
+	config.OpenAPI.On = true
+	assert.Equal(t, []string{PreflightDebugEndpoints, PreflightDebugLogs}, checks(Preflight(config)))
+	config.OpenAPI.Username = "docs"
+	assert.Equal(t, []string{PreflightDebugLogs}, checks(Preflight(config)))
+
+	// The production only checks are skipped in the other environments.
+	config.Environment = "local"
+	assert.Empty(t, Preflight(config))
+
+	config.Session.On = true
+	config.Session.Keys = []session.Key{{ID: "k1", Secret: "a-long-enough-random-secret"}, {ID: "k0", Secret: "short"}}
+	assert.Equal(t, []string{PreflightSecret}, checks(Preflight(config)))
+	config.Session.On = false
+	assert.Equal(t, []string{"production", "prod"}, config.Preflight.strictEnvironments())
+}
@@ -0,0 +1,343 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package probabilistic provides the bloom/cuckoo filters and the HyperLogLog counters for the membership
+// checks and the unique counting on high cardinality data, like the dedup of the events or the unique
+// visitors of a page, where an exact set would cost too much memory.
+package probabilistic
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+var (
+	// ErrModuleUnavailable is returned when the RedisBloom module is not loaded in the redis server.
+	ErrModuleUnavailable = errors.New("probabilistic: redis bloom module is not available")
+)
+
+// Kinds of the redis filters.
+const (
+	// KindBloom is the classic bloom filter, the members can't be removed.
+	KindBloom = "bloom"
+	// KindCuckoo is a cuckoo filter, the members can be removed with `Remove`.
+	KindCuckoo = "cuckoo"
+)
+
+// Filter is a set where `Exists` may return a false positive with a probability close to the error rate
+// of the filter but never a false negative.
+type Filter interface {
+	// Add adds the item and reports whether it was not already in the filter.
+	Add(c context.Context, item string) (bool, error)
+	// Exists reports whether the item may be in the filter.
+	Exists(c context.Context, item string) (bool, error)
+}
+
+// FilterConfig holds the sizing of a filter.
+type FilterConfig struct {
+	// Capacity is the expected number of items. Default value is 100000.
+	Capacity uint64
+	// ErrorRate is the wanted false positive probability. Default value is 0.01. Only for the bloom filters.
+	ErrorRate float64
+	// Kind is `KindBloom` or `KindCuckoo`. Default value is `KindBloom`. Only for the redis filters.
+	Kind string
+	// Prefix is prepended to the redis key. Default value is `dbdrivers.GetRedisCachePrefix() + ":filter"`.
+	Prefix string
+}
+
+func (config *FilterConfig) setDefaults() {
+	if config.Capacity == 0 {
+		config.Capacity = 100000
+	}
+	if config.ErrorRate <= 0 || config.ErrorRate >= 1 {
+		config.ErrorRate = 0.01
+	}
+	if config.Kind == "" {
+		config.Kind = KindBloom
+	}
+	if config.Prefix == "" {
+		config.Prefix = dbdrivers.GetRedisCachePrefix() + ":filter"
+	}
+}
+
+// NewFilter returns the redis filter `name` if the RedisBloom module is available in the server, else an
+// in-memory bloom filter of the same size which is local to the process.
+func NewFilter(c context.Context, redisConn *dbdrivers.RedisDBConn, name string, config FilterConfig) (Filter, error) {
+	filter, err := NewRedisFilter(c, redisConn, name, config)
+	if errors.Is(err, ErrModuleUnavailable) {
+		config.setDefaults()
+		return NewBloomFilter(config.Capacity, config.ErrorRate), nil
+	}
+
+	return filter, err
+}
+
+// RedisFilter is a bloom or cuckoo filter stored in redis by the RedisBloom module, shared by all the
+// instances of the service.
+type RedisFilter struct {
+	redis *dbdrivers.RedisDBConn
+	key   string
+	kind  string
+}
+
+// NewRedisFilter reserves the filter `name` in redis if it doesn't exist yet. It returns
+// `ErrModuleUnavailable` if the RedisBloom module is not loaded.
+func NewRedisFilter(c context.Context, redisConn *dbdrivers.RedisDBConn, name string, config FilterConfig) (*RedisFilter, error) {
+	config.setDefaults()
+
+	f := &RedisFilter{redis: redisConn, key: config.Prefix + ":" + name, kind: config.Kind}
+
+	var args []interface{}
+	switch config.Kind {
+	case KindBloom:
+		args = []interface{}{"BF.RESERVE", f.key, config.ErrorRate, config.Capacity}
+	case KindCuckoo:
+		args = []interface{}{"CF.RESERVE", f.key, config.Capacity}
+	default:
+		return nil, errors.Errorf("probabilistic: unknown filter kind %q", config.Kind)
+	}
+
+	if err := redisConn.Client().Do(c, args...).Err(); err != nil {
+		msg := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(msg, "unknown command"):
+			return nil, ErrModuleUnavailable
+		case strings.Contains(msg, "item exists"):
+			// Already reserved by another instance, the existing filter is used as is.
+		default:
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return f, nil
+}
+
+// Add adds the item and reports whether it was not already in the filter.
+func (f *RedisFilter) Add(c context.Context, item string) (bool, error) {
+	cmd := "BF.ADD"
+	if f.kind == KindCuckoo {
+		cmd = "CF.ADDNX"
+	}
+
+	added, err := f.redis.Client().Do(c, cmd, f.key, item).Bool()
+	return added, errors.WithStack(err)
+}
+
+// AddMulti adds several items in one round trip and reports for each of them whether it was not already
+// in the filter.
+func (f *RedisFilter) AddMulti(c context.Context, items ...string) ([]bool, error) {
+	if f.kind == KindCuckoo {
+		// `CF.ADDNX` has no multi variant.
+		return f.each(c, "CF.ADDNX", items)
+	}
+
+	return f.multi(c, "BF.MADD", items)
+}
+
+// Exists reports whether the item may be in the filter.
+func (f *RedisFilter) Exists(c context.Context, item string) (bool, error) {
+	cmd := "BF.EXISTS"
+	if f.kind == KindCuckoo {
+		cmd = "CF.EXISTS"
+	}
+
+	exists, err := f.redis.Client().Do(c, cmd, f.key, item).Bool()
+	return exists, errors.WithStack(err)
+}
+
+// ExistsMulti checks several items in one round trip.
+func (f *RedisFilter) ExistsMulti(c context.Context, items ...string) ([]bool, error) {
+	if f.kind == KindCuckoo {
+		return f.multi(c, "CF.MEXISTS", items)
+	}
+
+	return f.multi(c, "BF.MEXISTS", items)
+}
+
+// Remove removes one occurrence of the item from a cuckoo filter. Removing an item which was never added
+// can remove another item sharing its fingerprint, so only remove what you know you added.
+func (f *RedisFilter) Remove(c context.Context, item string) (bool, error) {
+	if f.kind != KindCuckoo {
+		return false, errors.New("probabilistic: only a cuckoo filter supports remove")
+	}
+
+	removed, err := f.redis.Client().Do(c, "CF.DEL", f.key, item).Bool()
+	return removed, errors.WithStack(err)
+}
+
+// Clear deletes the filter. It must be reserved again with `NewRedisFilter` before use.
+func (f *RedisFilter) Clear(c context.Context) error {
+	return errors.WithStack(f.redis.Client().Del(c, f.key).Err())
+}
+
+func (f *RedisFilter) multi(c context.Context, cmd string, items []string) ([]bool, error) {
+	if len(items) == 0 {
+		return []bool{}, nil
+	}
+
+	args := make([]interface{}, 0, len(items)+2)
+	args = append(args, cmd, f.key)
+	for _, item := range items {
+		args = append(args, item)
+	}
+
+	result, err := f.redis.Client().Do(c, args...).Int64Slice()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bools := make([]bool, len(result))
+	for i, r := range result {
+		bools[i] = r == 1
+	}
+
+	return bools, nil
+}
+
+func (f *RedisFilter) each(c context.Context, cmd string, items []string) ([]bool, error) {
+	cmds := make([]*redis.Cmd, len(items))
+
+	_, err := f.redis.Client().Pipelined(c, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			cmds[i] = pipe.Do(c, cmd, f.key, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bools := make([]bool, len(cmds))
+	for i, cmd := range cmds {
+		if bools[i], err = cmd.Bool(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return bools, nil
+}
+
+// BloomFilter is an in-memory bloom filter, safe for the concurrent use. It's local to the process, use
+// a `RedisFilter` when the instances of a service must share the same set.
+type BloomFilter struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	m      uint64 // Number of bits.
+	k      uint64 // Number of hash functions.
+	counts uint64
+}
+
+// NewBloomFilter returns a bloom filter sized for `capacity` items with a false positive probability
+// of `errorRate`.
+func NewBloomFilter(capacity uint64, errorRate float64) *BloomFilter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		errorRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add adds the item and reports whether it was not already in the filter. The error is always nil.
+func (b *BloomFilter) Add(_ context.Context, item string) (bool, error) {
+	h1, h2 := bloomHashes(item)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	added := false
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		word, mask := pos/64, uint64(1)<<(pos%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+
+	if added {
+		b.counts++
+	}
+
+	return added, nil
+}
+
+// Exists reports whether the item may be in the filter. The error is always nil.
+func (b *BloomFilter) Exists(_ context.Context, item string) (bool, error) {
+	h1, h2 := bloomHashes(item)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(uint64(1)<<(pos%64)) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Len returns the approximate number of items added.
+func (b *BloomFilter) Len() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.counts
+}
+
+// bloomHashes returns the two hashes of the Kirsch-Mitzenmacher double hashing, the i-th hash function
+// of the filter is `h1 + i*h2`.
+func bloomHashes(item string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(item))
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[i+8])
+	}
+
+	// An odd `h2` never shares a factor 2 with the number of bits, so the positions don't cycle early.
+	return h1, h2 | 1
+}
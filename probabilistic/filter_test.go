@@ -0,0 +1,53 @@
+package probabilistic
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	c := context.Background()
+	filter := NewBloomFilter(10000, 0.01)
+
+	for i := 0; i < 10000; i++ {
+		_, err := filter.Add(c, "item-"+strconv.Itoa(i))
+		assert.NoError(t, err)
+	}
+
+	// No false negative.
+	for i := 0; i < 10000; i++ {
+		exists, _ := filter.Exists(c, "item-"+strconv.Itoa(i))
+		if !exists {
+			t.Fatalf("item-%d must exist", i)
+		}
+	}
+
+	added, _ := filter.Add(c, "item-0")
+	assert.False(t, added)
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if exists, _ := filter.Exists(c, "other-"+strconv.Itoa(i)); exists {
+			falsePositives++
+		}
+	}
+
+	// 1% expected, allow some variance.
+	assert.Less(t, falsePositives, 200)
+}
+
+func TestRedisFilterEachError(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	require.NoError(t, mr.Server().Register("CF.ADDNX", func(peer *server.Peer, cmd string, args []string) {
+		peer.WriteBulk("unexpected")
+	}))
+
+	f := &RedisFilter{redis: conn, key: "filter", kind: KindCuckoo}
+	_, err := f.AddMulti(context.Background(), "a", "b")
+	assert.Error(t, err)
+}
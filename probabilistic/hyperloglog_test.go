@@ -0,0 +1,62 @@
+package probabilistic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisConn(t *testing.T) (*dbdrivers.RedisDBConn, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return &dbdrivers.RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}, mr
+}
+
+func TestHyperLogLog(t *testing.T) {
+	conn, mr := newTestRedisConn(t)
+	c := context.Background()
+
+	visitors := NewHyperLogLog(conn, "visitors")
+	monday, tuesday := visitors.Scope("monday"), visitors.Scope("tuesday")
+	assert.Equal(t, visitors.Key()+":monday", monday.Key())
+
+	changed, err := monday.Add(c, "alice", "bob", "alice")
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = monday.Add(c, "bob")
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = monday.Add(c)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// miniredis sums the counts of the keys of PFCOUNT instead of their union, so the scopes are disjoint.
+	_, err = tuesday.Add(c, "carol", "dave")
+	require.NoError(t, err)
+
+	count, err := monday.Count(c)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	count, err = monday.CountUnion(c, tuesday)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+	assert.False(t, mr.Exists(visitors.Key()))
+
+	require.NoError(t, visitors.Merge(c, monday, tuesday))
+	require.NoError(t, visitors.Merge(c, monday))
+	count, err = visitors.Count(c)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+
+	require.NoError(t, visitors.Clear(c))
+	count, err = visitors.Count(c)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
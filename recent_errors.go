@@ -0,0 +1,100 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RecentError is a server error kept in memory for the admin UI.
+type RecentError struct {
+	Time      time.Time
+	Method    string
+	Path      string
+	RequestID string
+	Status    int
+	Error     string
+}
+
+// How many server errors `RecentErrors` keeps.
+const recentErrorsSize = 100
+
+var (
+	recentErrorsMu sync.Mutex
+	recentErrors   = make([]RecentError, 0, recentErrorsSize)
+	recentErrorsAt int // Next slot to overwrite once the buffer is full.
+)
+
+// RecentErrors returns the last server errors of the process, the newest first.
+func RecentErrors() []RecentError {
+	recentErrorsMu.Lock()
+	defer recentErrorsMu.Unlock()
+
+	list := make([]RecentError, 0, len(recentErrors))
+	for i := 1; i <= len(recentErrors); i++ {
+		list = append(list, recentErrors[(recentErrorsAt-i+len(recentErrors))%len(recentErrors)])
+	}
+
+	return list
+}
+
+// recordRecentError keeps the error if the response is a server error.
+func recordRecentError(c echo.Context, err error) {
+	status := c.Response().Status
+	if c.Response().Committed && status < http.StatusInternalServerError {
+		return
+	}
+	if !c.Response().Committed {
+		status = http.StatusInternalServerError
+	}
+
+	requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	}
+
+	e := RecentError{
+		Time:      time.Now(),
+		Method:    c.Request().Method,
+		Path:      c.Request().URL.Path,
+		RequestID: requestID,
+		Status:    status,
+		Error:     err.Error(),
+	}
+
+	recentErrorsMu.Lock()
+	defer recentErrorsMu.Unlock()
+
+	if len(recentErrors) < recentErrorsSize {
+		recentErrors = append(recentErrors, e)
+		recentErrorsAt = len(recentErrors) % recentErrorsSize
+		return
+	}
+
+	recentErrors[recentErrorsAt] = e
+	recentErrorsAt = (recentErrorsAt + 1) % recentErrorsSize
+}
@@ -0,0 +1,35 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentErrors(t *testing.T) {
+	e := echo.New()
+
+	for i := 0; i < recentErrorsSize+5; i++ {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/orders/"+strconv.Itoa(i), nil), httptest.NewRecorder())
+		recordRecentError(c, errors.New("fake"))
+	}
+
+	// A client error is not kept.
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/missing", nil), rec)
+	_ = c.NoContent(http.StatusNotFound)
+	recordRecentError(c, errors.New("not found"))
+
+	list := RecentErrors()
+	assert.Len(t, list, recentErrorsSize)
+	assert.Equal(t, "/orders/104", list[0].Path)
+	assert.Equal(t, "/orders/5", list[len(list)-1].Path)
+	assert.Equal(t, http.StatusInternalServerError, list[0].Status)
+}
@@ -0,0 +1,277 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package refdata keeps the slowly changing reference data, like the store list, the category tree or
+// the tax tables, in memory. The datasets are loaded at the warmup, refreshed on a schedule or by an
+// event, and read without a lock. A failed refresh keeps serving the last good value.
+//
+// Treat the loaded value as immutable, a refresh replaces it:
+//
+//	var stores = refdata.Register("stores", func(c context.Context) ([]Store, error) {
+//		var stores []Store
+//		err := db.WithContext(c).Find(&stores).Error
+//		return stores, err
+//	}, refdata.Config{Interval: 10 * time.Minute, Required: true})
+//
+//	func Stores() []Store {
+//		return stores.Get()
+//	}
+package refdata
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+)
+
+// Loader returns the whole dataset.
+type Loader[T any] func(c context.Context) (T, error)
+
+// Config defines how a dataset is loaded.
+type Config struct {
+	// Interval refreshes the dataset on a schedule, with a jitter of up to 10% so that the replicas don't
+	// hit the database at the same time. Zero or negative means refreshed only by `Refresh`.
+	// Optional. Default value 0.
+	Interval time.Duration
+
+	// Timeout is the deadline of a load.
+	// Optional. Default value 30s.
+	Timeout time.Duration
+
+	// Required makes `Warmup` fail if the dataset can't be loaded, so that the server doesn't start without it.
+	// Optional. Default value false.
+	Required bool
+}
+
+// Dataset is a registered reference dataset of `T`, safe for the concurrent use.
+type Dataset[T any] struct {
+	dataset *dataset
+}
+
+// dataset is the untyped dataset kept by the registry, so that `Warmup`, `Start` and `Refresh` handle
+// the datasets of all the types.
+type dataset struct {
+	name   string
+	loader func(c context.Context) (interface{}, error)
+	config Config
+
+	value    atomic.Value // snapshot
+	loadMu   sync.Mutex   // Only one load at a time, a concurrent refresh waits for the running one.
+	failures int64
+}
+
+type snapshot struct {
+	value    interface{}
+	loadedAt time.Time
+}
+
+var (
+	datasetsMu sync.RWMutex
+	datasets   = make(map[string]*dataset)
+)
+
+// Register registers a dataset, it's loaded by `Warmup`. It panics if the name is already registered,
+// like a duplicated route.
+func Register[T any](name string, loader Loader[T], config Config) *Dataset[T] {
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	datasetsMu.Lock()
+	defer datasetsMu.Unlock()
+
+	if _, dup := datasets[name]; dup {
+		panic("refdata: Register called twice for dataset " + name)
+	}
+
+	d := &dataset{name: name, config: config, loader: func(c context.Context) (interface{}, error) {
+		return loader(c)
+	}}
+	datasets[name] = d
+
+	return &Dataset[T]{dataset: d}
+}
+
+// Name returns the name of the dataset.
+func (d *Dataset[T]) Name() string {
+	return d.dataset.name
+}
+
+// Get returns the last loaded value, or the zero value if the dataset was never loaded.
+func (d *Dataset[T]) Get() T {
+	s, _ := d.dataset.value.Load().(snapshot)
+	value, _ := s.value.(T)
+	return value
+}
+
+// LoadedAt returns when the value was loaded, or the zero time if the dataset was never loaded.
+func (d *Dataset[T]) LoadedAt() time.Time {
+	s, _ := d.dataset.value.Load().(snapshot)
+	return s.loadedAt
+}
+
+// Refresh loads the dataset again and replaces the value if the load succeeds.
+func (d *Dataset[T]) Refresh(c context.Context) error {
+	return d.dataset.refresh(c)
+}
+
+// Failures returns the number of consecutive failed loads, for the health checks.
+func (d *Dataset[T]) Failures() int64 {
+	return atomic.LoadInt64(&d.dataset.failures)
+}
+
+func (d *dataset) refresh(c context.Context) error {
+	d.loadMu.Lock()
+	defer d.loadMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c, d.config.Timeout)
+	defer cancel()
+
+	value, err := d.load(ctx)
+	if err != nil {
+		atomic.AddInt64(&d.failures, 1)
+		return errors.Wrapf(err, "refdata: failed to load %q", d.name)
+	}
+
+	atomic.StoreInt64(&d.failures, 0)
+	d.value.Store(snapshot{value: value, loadedAt: time.Now()})
+
+	return nil
+}
+
+func (d *dataset) load(c context.Context) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("loader panicked: %v", r)
+		}
+	}()
+
+	return d.loader(c)
+}
+
+// Refresh reloads a dataset by name, for the event driven refreshes. (example: a message telling that
+// the category tree was updated)
+func Refresh(c context.Context, name string) error {
+	datasetsMu.RLock()
+	d, ok := datasets[name]
+	datasetsMu.RUnlock()
+
+	if !ok {
+		return errors.Errorf("refdata: unknown dataset %q", name)
+	}
+
+	return d.refresh(c)
+}
+
+// Warmup loads all the registered datasets concurrently. It returns the errors of the required datasets
+// only, the failures of the others are logged and they are loaded again by the schedule.
+func Warmup(c context.Context) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		messages []string
+	)
+
+	for _, d := range all() {
+		wg.Add(1)
+		go func(d *dataset) {
+			defer wg.Done()
+
+			err := d.refresh(c)
+			if err == nil {
+				return
+			}
+
+			if !d.config.Required {
+				logError(err)
+				return
+			}
+
+			mu.Lock()
+			messages = append(messages, err.Error())
+			mu.Unlock()
+		}(d)
+	}
+	wg.Wait()
+
+	if len(messages) > 0 {
+		sort.Strings(messages)
+		return errors.Errorf("refdata: warmup failed: %v", messages)
+	}
+
+	return nil
+}
+
+// Start refreshes the datasets with an `Interval` on their schedule until the context is canceled. The
+// jobs are executed safely using `async.Execute` so a panic will not crash the application.
+func Start(c context.Context) {
+	for _, d := range all() {
+		if d.config.Interval <= 0 {
+			continue
+		}
+
+		d := d
+		async.Execute(func() {
+			for {
+				jitter := time.Duration(rand.Int63n(int64(d.config.Interval)/10 + 1))
+				t := time.NewTimer(d.config.Interval + jitter)
+
+				select {
+				case <-c.Done():
+					t.Stop()
+					return
+				case <-t.C:
+					if err := d.refresh(c); err != nil {
+						logError(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func all() []*dataset {
+	datasetsMu.RLock()
+	defer datasetsMu.RUnlock()
+
+	list := make([]*dataset, 0, len(datasets))
+	for _, d := range datasets {
+		list = append(list, d)
+	}
+
+	return list
+}
+
+func logError(err error) {
+	if logger := bean.Logger(); logger != nil {
+		logger.Error(err)
+	}
+
+	bean.SentryCaptureException(nil, err)
+}
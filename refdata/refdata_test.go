@@ -0,0 +1,43 @@
+package refdata
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataset(t *testing.T) {
+	c := context.Background()
+
+	version := 0
+	fail := false
+	d := Register("test_taxes", func(context.Context) (map[string]float64, error) {
+		if fail {
+			return nil, errors.New("db down")
+		}
+		version++
+		return map[string]float64{"standard": 0.1 * float64(version)}, nil
+	}, Config{Required: true})
+
+	assert.Nil(t, d.Get())
+	assert.True(t, d.LoadedAt().IsZero())
+
+	assert.NoError(t, Warmup(c))
+	assert.Equal(t, map[string]float64{"standard": 0.1}, d.Get())
+
+	// A failed refresh keeps the last good value.
+	fail = true
+	assert.Error(t, Refresh(c, "test_taxes"))
+	assert.Equal(t, int64(1), d.Failures())
+	assert.Equal(t, map[string]float64{"standard": 0.1}, d.Get())
+
+	fail = false
+	assert.NoError(t, Refresh(c, "test_taxes"))
+	assert.Equal(t, int64(0), d.Failures())
+	assert.Equal(t, map[string]float64{"standard": 0.2}, d.Get())
+
+	assert.Panics(t, func() { Register[int]("test_taxes", nil, Config{}) })
+	assert.Error(t, Refresh(c, "unknown"))
+}
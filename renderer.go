@@ -0,0 +1,152 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/echoview"
+)
+
+// DefaultRenderer is the name of the goview renderer of the `views` directory, used by the routes which
+// don't select another one.
+const DefaultRenderer = "goview"
+
+const rendererContextKey = "bean.renderer"
+
+// RendererFunc adapts a function to `echo.Renderer`, like a templ component lookup:
+//
+//	b.RegisterRenderer("templ", bean.RendererFunc(func(w io.Writer, name string, data interface{}, c echo.Context) error {
+//		return pages[name](data).Render(c.Request().Context(), w)
+//	}))
+type RendererFunc func(w io.Writer, name string, data interface{}, c echo.Context) error
+
+// Render calls f(w, name, data, c).
+func (f RendererFunc) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return f(w, name, data, c)
+}
+
+// renderers is the `echo.Renderer` of the echo instance of bean, it renders with the renderer selected
+// by the route or with the default one.
+type renderers struct {
+	mu        sync.RWMutex
+	renderers map[string]echo.Renderer
+}
+
+func newRenderers(defaultRenderer echo.Renderer) *renderers {
+	return &renderers{renderers: map[string]echo.Renderer{DefaultRenderer: defaultRenderer}}
+}
+
+func (r *renderers) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	engine, _ := c.Get(rendererContextKey).(string)
+	if engine == "" {
+		engine = DefaultRenderer
+	}
+
+	renderer := r.get(engine)
+	if renderer == nil {
+		return fmt.Errorf("renderer %q is not registered", engine)
+	}
+
+	return renderer.Render(w, name, data, c)
+}
+
+func (r *renderers) get(name string) echo.Renderer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.renderers[name]
+}
+
+func (r *renderers) set(name string, renderer echo.Renderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.renderers[name] = renderer
+}
+
+func (r *renderers) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.renderers))
+	for name := range r.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// echoRenderers returns the renderers of the echo instance, the renderer set directly to `Echo.Renderer`
+// becomes the default one.
+func (b *Bean) echoRenderers() *renderers {
+	if r, ok := b.Echo.Renderer.(*renderers); ok {
+		return r
+	}
+
+	r := newRenderers(b.Echo.Renderer)
+	if b.Echo.Renderer == nil {
+		delete(r.renderers, DefaultRenderer)
+	}
+	b.Echo.Renderer = r
+
+	return r
+}
+
+// RegisterRenderer adds a template engine, like jet or pongo2 for the admin pages, which the routes select
+// by `WithRenderer(name)`. Registering `DefaultRenderer` replaces the goview renderer for all the other routes.
+func (b *Bean) RegisterRenderer(name string, renderer echo.Renderer) {
+	b.echoRenderers().set(name, renderer)
+}
+
+// Renderer returns the renderer registered by `name`, nil if there isn't any.
+func (b *Bean) Renderer(name string) echo.Renderer {
+	return b.echoRenderers().get(name)
+}
+
+// Renderers returns the names of the registered renderers, sorted.
+func (b *Bean) Renderers() []string {
+	return b.echoRenderers().names()
+}
+
+// SelectRenderer returns a middleware rendering the views of the routes with the renderer registered by
+// `name`, for the echo groups. The bean routes use `WithRenderer`.
+func SelectRenderer(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(rendererContextKey, name)
+			return next(c)
+		}
+	}
+}
+
+// goviewRenderer returns the default goview renderer, nil if it has been replaced.
+func (b *Bean) goviewRenderer() *echoview.ViewEngine {
+	views, _ := b.Renderer(DefaultRenderer).(*echoview.ViewEngine)
+	return views
+}
@@ -0,0 +1,46 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBean_Renderers(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+	b.Echo.Renderer = RendererFunc(func(w io.Writer, name string, data interface{}, c echo.Context) error {
+		_, err := fmt.Fprintf(w, "goview:%s:%v", name, data)
+		return err
+	})
+	b.RegisterRenderer("jet", RendererFunc(func(w io.Writer, name string, data interface{}, c echo.Context) error {
+		_, err := fmt.Fprintf(w, "jet:%s:%v", name, data)
+		return err
+	}))
+	assert.Equal(t, []string{DefaultRenderer, "jet"}, b.Renderers())
+
+	page := func(c echo.Context) error {
+		return c.Render(http.StatusOK, "page", 1)
+	}
+	b.GET("/", page)
+	admin := b.Group("/admin", WithRenderer("jet"))
+	admin.GET("/", page)
+	b.GET("/missing", page, WithRenderer("pongo2"))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.Echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, "goview:page:1", serve("/").Body.String())
+	assert.Equal(t, "jet:page:1", serve("/admin/").Body.String())
+	assert.Equal(t, http.StatusInternalServerError, serve("/missing").Code)
+	assert.Nil(t, b.Renderer("pongo2"))
+}
@@ -0,0 +1,322 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	berror "github.com/retail-ai-inc/bean/error"
+)
+
+var (
+	ErrInvalidSignature = errors.New("report: invalid download signature")
+	ErrLinkExpired      = errors.New("report: download link expired")
+)
+
+// Artifact is a rendered report file.
+type Artifact struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Delivery sends an artifact somewhere. Deliveries of a schedule run in order, so a `StorageDelivery`
+// placed before an `EmailDelivery` lets the email contain the signed link (`Run.Link`).
+type Delivery interface {
+	Deliver(c context.Context, run *Run, artifact *Artifact) error
+}
+
+// Storage keeps the rendered artifacts. Implement it for S3, GCS, etc.
+type Storage interface {
+	Put(c context.Context, key string, data []byte, contentType string) error
+	Get(c context.Context, key string) (data []byte, contentType string, err error)
+}
+
+// LocalStorage stores the artifacts in a local directory.
+type LocalStorage struct {
+	Dir string
+}
+
+// Put implements the `Storage.Put` function.
+func (s LocalStorage) Put(c context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.WriteFile(path, data, 0o644))
+}
+
+// Get implements the `Storage.Get` function. The content type is guessed from the file extension.
+func (s LocalStorage) Get(c context.Context, key string) ([]byte, string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return data, mime.TypeByExtension(filepath.Ext(path)), nil
+}
+
+func (s LocalStorage) path(key string) (string, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.Dir)+string(filepath.Separator)) {
+		return "", errors.Errorf("report: invalid storage key `%s`", key)
+	}
+
+	return path, nil
+}
+
+// ResidentStorage routes the artifacts of the tenants with a data residency (see `dbdrivers.Residency`)
+// to the storage of their region. The keys start with the tenant ID, as the ones of `StorageDelivery`.
+type ResidentStorage struct {
+	// Default stores the artifacts of the tenants without a residency, or without a storage in their
+	// region if they are not restricted.
+	Default Storage
+	// Regions are the storages per region.
+	Regions map[string]Storage
+}
+
+// Put implements the `Storage.Put` function.
+func (s ResidentStorage) Put(c context.Context, key string, data []byte, contentType string) error {
+	storage, err := s.storage(key)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(c, key, data, contentType)
+}
+
+// Get implements the `Storage.Get` function.
+func (s ResidentStorage) Get(c context.Context, key string) ([]byte, string, error) {
+	storage, err := s.storage(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return storage.Get(c, key)
+}
+
+func (s ResidentStorage) storage(key string) (Storage, error) {
+	prefix, _, _ := strings.Cut(key, "/")
+	tenantID, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("report: invalid storage key `%s`", key)
+	}
+
+	residency, ok := dbdrivers.TenantResidency(tenantID)
+	if ok {
+		if storage, ok := s.Regions[residency.Region]; ok && storage != nil {
+			return storage, nil
+		}
+
+		if residency.Restricted {
+			return nil, errors.Wrapf(dbdrivers.ErrResidency, "report: no storage in the region `%s` of tenant %d",
+				residency.Region, tenantID)
+		}
+	}
+
+	if s.Default == nil {
+		return nil, errors.Errorf("report: no storage for tenant %d", tenantID)
+	}
+
+	return s.Default, nil
+}
+
+// URLSigner signs the download links of the stored artifacts using HMAC-SHA256.
+type URLSigner struct {
+	Secret string
+	// BaseURL is the absolute URL of the route using `DownloadHandler`. (example: https://example.com/reports/download)
+	BaseURL string
+}
+
+// Sign returns a link to `key` valid until `expires`.
+func (s URLSigner) Sign(key string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	q := url.Values{}
+	q.Set("key", key)
+	q.Set("expires", exp)
+	q.Set("signature", s.signature(key, exp))
+
+	return s.BaseURL + "?" + q.Encode()
+}
+
+// Verify checks the signature and the expiry of a link.
+func (s URLSigner) Verify(key, expires, signature string) error {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, expires))) {
+		return ErrInvalidSignature
+	}
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > exp {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+func (s URLSigner) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadHandler serves the artifacts from `storage` after verifying the signed link.
+func DownloadHandler(storage Storage, signer URLSigner) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.QueryParam("key")
+
+		if err := signer.Verify(key, c.QueryParam("expires"), c.QueryParam("signature")); err != nil {
+			return berror.NewAPIError(http.StatusForbidden, berror.UNAUTHORIZED_ACCESS, err)
+		}
+
+		data, contentType, err := storage.Get(c.Request().Context(), key)
+		if err != nil {
+			return berror.NewAPIError(http.StatusNotFound, berror.RESOURCE_NOT_FOUND, err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(key)))
+
+		return c.Blob(http.StatusOK, contentType, data)
+	}
+}
+
+// StorageDelivery puts the artifact into a storage and sets `Run.Link` to a signed link.
+type StorageDelivery struct {
+	Storage Storage
+	Signer  URLSigner
+	// LinkExpiry is the validity of the signed link. Default value is 7 days.
+	LinkExpiry time.Duration
+}
+
+// Deliver implements the `Delivery` interface.
+func (d StorageDelivery) Deliver(c context.Context, run *Run, artifact *Artifact) error {
+	key := fmt.Sprintf("%d/%s/%s/%s", run.TenantID, run.Report, run.ID, artifact.Filename)
+
+	if err := d.Storage.Put(c, key, artifact.Data, artifact.ContentType); err != nil {
+		return err
+	}
+
+	expiry := d.LinkExpiry
+	if expiry <= 0 {
+		expiry = 7 * 24 * time.Hour
+	}
+
+	run.StorageKey = key
+	run.Link = d.Signer.Sign(key, time.Now().Add(expiry))
+
+	return nil
+}
+
+// EmailDelivery sends the artifact using SMTP. If a previous delivery has set `Run.Link` then
+// the link is included in the body and the file is only attached when `Attach` is true.
+type EmailDelivery struct {
+	Addr    string // SMTP server `host:port`.
+	Auth    smtp.Auth
+	From    string
+	To      []string
+	Subject string // Default value is the report title and the run date.
+	Attach  bool
+}
+
+// Deliver implements the `Delivery` interface.
+func (d EmailDelivery) Deliver(c context.Context, run *Run, artifact *Artifact) error {
+	subject := d.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("%s (%s)", run.Title, run.StartedAt.Format("2006-01-02"))
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		d.From, strings.Join(d.To, ", "), mime.QEncoding.Encode("utf-8", subject), mw.Boundary())
+
+	text := fmt.Sprintf("%s\r\n\r\nRows: %d\r\n", run.Title, run.Rows)
+	if run.Link != "" {
+		text += "Download: " + run.Link + "\r\n"
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	part.Write([]byte(text))
+
+	if run.Link == "" || d.Attach {
+		part, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {artifact.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, artifact.Filename)},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(artifact.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := mw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(smtp.SendMail(d.Addr, d.Auth, d.From, d.To, body.Bytes()))
+}
@@ -0,0 +1,337 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the output format of a report.
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+	FormatPDF  Format = "pdf"
+)
+
+// Exporter renders a table into a file format.
+type Exporter interface {
+	ContentType() string
+	Export(w io.Writer, title string, table *Table) error
+}
+
+var (
+	exporters = map[Format]Exporter{
+		FormatCSV:  csvExporter{},
+		FormatXLSX: xlsxExporter{},
+		FormatPDF:  pdfExporter{},
+	}
+	exportersMu sync.RWMutex
+)
+
+// RegisterExporter adds or replaces the exporter of a format. Use it to plug a richer XLSX or PDF
+// library than the built-in ones.
+func RegisterExporter(format Format, exporter Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+
+	exporters[format] = exporter
+}
+
+func getExporter(format Format) (Exporter, error) {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+
+	exporter, ok := exporters[format]
+	if !ok {
+		return nil, errors.Errorf("report format `%s` is not supported", format)
+	}
+
+	return exporter, nil
+}
+
+type csvExporter struct{}
+
+func (csvExporter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvExporter) Export(w io.Writer, title string, table *Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(table.Columns); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cw.WriteAll(table.Rows); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// xlsxExporter writes a minimal single sheet workbook using inline strings.
+type xlsxExporter struct{}
+
+func (xlsxExporter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (xlsxExporter) Export(w io.Writer, title string, table *Table) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name, body string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheetName(title)) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(table)},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(zw.Close())
+}
+
+func xlsxSheet(table *Table) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	writeRow := func(r int, values []string) {
+		b.WriteString(`<row r="` + strconv.Itoa(r) + `">`)
+		for i, v := range values {
+			ref := xlsxColumn(i) + strconv.Itoa(r)
+			if _, err := strconv.ParseFloat(v, 64); err == nil && r > 1 {
+				b.WriteString(`<c r="` + ref + `"><v>` + v + `</v></c>`)
+			} else {
+				b.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t>` + xmlEscape(v) + `</t></is></c>`)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+
+	writeRow(1, table.Columns)
+	for i, row := range table.Rows {
+		writeRow(i+2, row)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+
+	return b.String()
+}
+
+// xlsxColumn converts a zero based column index to the spreadsheet letters. (example: 0 => A, 27 => AB)
+func xlsxColumn(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+
+	return name
+}
+
+func sheetName(title string) string {
+	name := strings.NewReplacer("[", "", "]", "", ":", "", "*", "", "?", "", "/", "", `\`, "").Replace(title)
+	if name == "" {
+		name = "Sheet1"
+	}
+	if len(name) > 31 {
+		name = name[:31]
+	}
+
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// pdfExporter writes a plain text table using the standard Courier font. It only supports the latin1
+// characters, register another exporter for rich layouts.
+type pdfExporter struct{}
+
+const (
+	pdfPageWidth    = 842 // A4 landscape.
+	pdfPageHeight   = 595
+	pdfMargin       = 36
+	pdfFontSize     = 8
+	pdfLineHeight   = 10
+	pdfMaxCellWidth = 30
+)
+
+func (pdfExporter) ContentType() string { return "application/pdf" }
+
+func (pdfExporter) Export(w io.Writer, title string, table *Table) error {
+	lines := pdfTableLines(title, table)
+	linesPerPage := (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+
+	var pages [][]string
+	for len(lines) > 0 {
+		n := linesPerPage
+		if n > len(lines) {
+			n = len(lines)
+		}
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+	if len(pages) == 0 {
+		pages = append(pages, []string{title})
+	}
+
+	// Object layout: 1 catalog, 2 pages, 3 font, then a page and a content stream object per page.
+	var buf bytes.Buffer
+	var offsets []int
+
+	writeObj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+
+	writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			content.WriteString("(" + pdfEscape(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+
+		writeObj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+i*2))
+		writeObj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return errors.WithStack(err)
+}
+
+func pdfTableLines(title string, table *Table) []string {
+	widths := make([]int, len(table.Columns))
+	measure := func(values []string) {
+		for i, v := range values {
+			if i < len(widths) && len([]rune(v)) > widths[i] {
+				widths[i] = len([]rune(v))
+			}
+		}
+	}
+	measure(table.Columns)
+	for _, row := range table.Rows {
+		measure(row)
+	}
+
+	format := func(values []string) string {
+		cells := make([]string, len(widths))
+		for i, width := range widths {
+			if width > pdfMaxCellWidth {
+				width = pdfMaxCellWidth
+			}
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			r := []rune(v)
+			if len(r) > width {
+				r = append(r[:width-1], '~')
+			}
+			cells[i] = string(r) + strings.Repeat(" ", width-len(r))
+		}
+		return strings.Join(cells, " | ")
+	}
+
+	header := format(table.Columns)
+	lines := []string{title, "", header, strings.Repeat("-", len([]rune(header)))}
+	for _, row := range table.Rows {
+		lines = append(lines, format(row))
+	}
+
+	return lines
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r > 0xff:
+			b.WriteRune('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+
+	return b.String()
+}
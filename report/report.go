@@ -0,0 +1,102 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package report renders named reports to CSV, XLSX or PDF on a per tenant schedule, delivers them by
+// email or to a storage with a signed download link and keeps the history of every run.
+package report
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Table is the result of a report query. All values are already formatted as strings.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Query fetches the data of a report for a tenant. `params` comes from the schedule.
+type Query func(c context.Context, tenantID uint64, params map[string]string) (*Table, error)
+
+// Report is a named report definition.
+type Report struct {
+	Name  string
+	Title string
+	Query Query
+}
+
+var (
+	reports   = make(map[string]Report)
+	reportsMu sync.RWMutex
+)
+
+// Register declares a report so that it can be scheduled or run by name.
+func Register(report Report) error {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	if report.Name == "" || report.Query == nil {
+		return errors.New("report name and query are required")
+	}
+
+	if _, ok := reports[report.Name]; ok {
+		return errors.Errorf("report `%s` is already registered", report.Name)
+	}
+
+	if report.Title == "" {
+		report.Title = report.Name
+	}
+
+	reports[report.Name] = report
+
+	return nil
+}
+
+// Reports returns the registered report names.
+func Reports() []string {
+	reportsMu.RLock()
+	defer reportsMu.RUnlock()
+
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func getReport(name string) (Report, error) {
+	reportsMu.RLock()
+	defer reportsMu.RUnlock()
+
+	report, ok := reports[name]
+	if !ok {
+		return Report{}, errors.Errorf("report `%s` is not registered", name)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package report
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	s := Schedule{Every: 24 * time.Hour, At: 6 * time.Hour}
+
+	now := time.Date(2022, 3, 1, 5, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2022, 3, 1, 6, 0, 0, 0, time.UTC), s.Next(now))
+
+	now = time.Date(2022, 3, 1, 6, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2022, 3, 2, 6, 0, 0, 0, time.UTC), s.Next(now))
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AB", xlsxColumn(27))
+}
+
+func TestURLSigner(t *testing.T) {
+	signer := URLSigner{Secret: "secret", BaseURL: "https://example.com/reports/download"}
+
+	link, err := url.Parse(signer.Sign("1/sales/report.csv", time.Now().Add(time.Hour)))
+	assert.NoError(t, err)
+
+	q := link.Query()
+	assert.NoError(t, signer.Verify(q.Get("key"), q.Get("expires"), q.Get("signature")))
+	assert.Equal(t, ErrInvalidSignature, signer.Verify("2/sales/report.csv", q.Get("expires"), q.Get("signature")))
+
+	link, _ = url.Parse(signer.Sign("1/sales/report.csv", time.Now().Add(-time.Hour)))
+	q = link.Query()
+	assert.Equal(t, ErrLinkExpired, signer.Verify(q.Get("key"), q.Get("expires"), q.Get("signature")))
+}
+
+func TestScheduledLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lockKey := dbdrivers.GetRedisCachePrefix() + ":report:lock:daily"
+
+	var runs int
+	var lockTTL time.Duration
+	require.NoError(t, Register(Report{Name: "locked", Query: func(c context.Context, tenantID uint64, params map[string]string) (*Table, error) {
+		runs++
+		lockTTL = mr.TTL(lockKey)
+		return &Table{Columns: []string{"id"}}, nil
+	}}))
+
+	conn := &dbdrivers.RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	scheduler := NewScheduler(Config{Redis: conn})
+	schedule := Schedule{ID: "daily", Report: "locked", Format: FormatCSV, Every: 24 * time.Hour}
+	at := schedule.Next(time.Now())
+
+	// Another replica skips the same run time, the lock is released after the run.
+	scheduler.runScheduled(context.Background(), due{Schedule: schedule, at: at})
+	scheduler.runScheduled(context.Background(), due{Schedule: schedule, at: at})
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, 12*time.Hour, lockTTL)
+	assert.Empty(t, lockKeys(mr))
+
+	// The next run time is skipped while another replica runs the schedule.
+	at = at.Add(schedule.Every)
+	lock, err := conn.Lock(context.Background(), lockKey, time.Hour)
+	require.NoError(t, err)
+	scheduler.runScheduled(context.Background(), due{Schedule: schedule, at: at})
+	assert.Equal(t, 1, runs)
+
+	require.NoError(t, lock.Release(context.Background()))
+	scheduler.runScheduled(context.Background(), due{Schedule: schedule, at: at})
+	assert.Equal(t, 2, runs)
+
+	// The lock of a short interval doesn't expire before the other replicas check it.
+	schedule.Every = time.Millisecond
+	scheduler.runScheduled(context.Background(), due{Schedule: schedule, at: at.Add(time.Millisecond)})
+	assert.Equal(t, 3, runs)
+	assert.Equal(t, minLockTTL, lockTTL)
+}
+
+// lockKeys returns the keys of the locks, without their fencing counters.
+func lockKeys(mr *miniredis.Miniredis) []string {
+	var keys []string
+	for _, key := range mr.Keys() {
+		if mr.Exists(key + ":fencing") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,427 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+// RunStatus is the state of a report run.
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+)
+
+// Run is one execution of a report.
+type Run struct {
+	ID         string     `json:"id"`
+	ScheduleID string     `json:"scheduleId,omitempty"`
+	Report     string     `json:"report"`
+	Title      string     `json:"title"`
+	TenantID   uint64     `json:"tenantId"`
+	Format     Format     `json:"format"`
+	Status     RunStatus  `json:"status"`
+	Rows       int        `json:"rows"`
+	Size       int        `json:"size"`
+	StorageKey string     `json:"storageKey,omitempty"`
+	Link       string     `json:"link,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Schedule runs a report for a tenant periodically. The run times are aligned on `Every` in UTC and
+// shifted by `At`. (example: `Every: 24 * time.Hour, At: 6 * time.Hour` runs every day at 06:00 UTC)
+type Schedule struct {
+	ID         string
+	Report     string
+	TenantID   uint64
+	Format     Format
+	Params     map[string]string
+	Every      time.Duration
+	At         time.Duration
+	Deliveries []Delivery
+}
+
+// Next returns the first run time of the schedule strictly after `t`.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.UTC()
+	next := t.Truncate(s.Every).Add(s.At)
+	for !next.After(t) {
+		next = next.Add(s.Every)
+	}
+
+	return next
+}
+
+// History keeps the report runs.
+type History interface {
+	Save(c context.Context, run *Run) error
+	// List returns the latest runs of a report for a tenant, newest first.
+	List(c context.Context, report string, tenantID uint64, limit int) ([]Run, error)
+}
+
+// MemoryHistory keeps the latest `Max` runs of every report and tenant in memory.
+type MemoryHistory struct {
+	Max int
+
+	mu   sync.RWMutex
+	runs map[string][]Run
+}
+
+// NewMemoryHistory returns a history keeping `max` runs per report and tenant.
+func NewMemoryHistory(max int) *MemoryHistory {
+	if max <= 0 {
+		max = 100
+	}
+
+	return &MemoryHistory{Max: max, runs: make(map[string][]Run)}
+}
+
+// Save implements the `History.Save` function.
+func (h *MemoryHistory) Save(c context.Context, run *Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := fmt.Sprintf("%s:%d", run.Report, run.TenantID)
+	runs := h.runs[key]
+
+	for i := range runs {
+		if runs[i].ID == run.ID {
+			runs[i] = *run
+			return nil
+		}
+	}
+
+	runs = append([]Run{*run}, runs...)
+	if len(runs) > h.Max {
+		runs = runs[:h.Max]
+	}
+	h.runs[key] = runs
+
+	return nil
+}
+
+// List implements the `History.List` function.
+func (h *MemoryHistory) List(c context.Context, report string, tenantID uint64, limit int) ([]Run, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	runs := h.runs[fmt.Sprintf("%s:%d", report, tenantID)]
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return append([]Run(nil), runs...), nil
+}
+
+// Config defines the config of a `Scheduler`.
+type Config struct {
+	// History keeps the runs. Default value is a `MemoryHistory`.
+	History History
+	// CheckInterval is how often the due schedules are checked. Default value is 1 minute.
+	CheckInterval time.Duration
+	// PoolName is the goroutine pool used to run the reports. Optional.
+	PoolName string
+	// Redis, if set, is used to take a lock for every run so that only one replica runs a schedule. Optional.
+	Redis *dbdrivers.RedisDBConn
+	// OnFailure is called when a run fails. Default value logs the error and sends it to sentry.
+	OnFailure func(c context.Context, run *Run, err error)
+	// Logger logs the errors of the scheduler. Default value the logger of the bean instance of the context
+	// of `Start`, or the global logger of bean. (see `bean.FromContext`)
+	Logger echo.Logger
+}
+
+// minLockTTL is the minimum TTL of the lock of a scheduled run, half of the interval of a short schedule
+// would expire before the other replicas check it.
+const minLockTTL = time.Minute
+
+// Scheduler runs the scheduled reports.
+type Scheduler struct {
+	config Config
+
+	mu        sync.Mutex
+	schedules map[string]*scheduled
+}
+
+type scheduled struct {
+	Schedule
+	next time.Time
+}
+
+// due is a run time of a schedule.
+type due struct {
+	Schedule
+	at time.Time
+}
+
+// NewScheduler returns a `Scheduler`.
+func NewScheduler(config Config) *Scheduler {
+	if config.History == nil {
+		config.History = NewMemoryHistory(0)
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Minute
+	}
+	if config.OnFailure == nil {
+		config.OnFailure = func(c context.Context, run *Run, err error) {
+			logger(c, config.Logger).Errorf("report: %s for tenant %d failed: %v", run.Report, run.TenantID, err)
+			bean.SentryCaptureException(nil, err)
+		}
+	}
+
+	return &Scheduler{config: config, schedules: make(map[string]*scheduled)}
+}
+
+// logger returns `l` if it's set, otherwise the logger of the bean instance of the context, or the global one.
+func logger(c context.Context, l echo.Logger) echo.Logger {
+	if l != nil {
+		return l
+	}
+	if b := bean.FromContext(c); b != nil {
+		return b.Logger()
+	}
+
+	return bean.Logger()
+}
+
+// Add adds or replaces a schedule.
+func (s *Scheduler) Add(schedule Schedule) error {
+	if _, err := getReport(schedule.Report); err != nil {
+		return err
+	}
+	if _, err := getExporter(schedule.Format); err != nil {
+		return err
+	}
+	if schedule.Every <= 0 {
+		return errors.New("report: schedule interval must be positive")
+	}
+	if schedule.ID == "" {
+		schedule.ID = fmt.Sprintf("%s:%d:%s", schedule.Report, schedule.TenantID, schedule.Format)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules[schedule.ID] = &scheduled{Schedule: schedule, next: schedule.Next(time.Now())}
+
+	return nil
+}
+
+// Remove removes a schedule.
+func (s *Scheduler) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.schedules, id)
+}
+
+// History returns the latest runs of a report for a tenant.
+func (s *Scheduler) History(c context.Context, report string, tenantID uint64, limit int) ([]Run, error) {
+	return s.config.History.List(c, report, tenantID, limit)
+}
+
+// Start checks the due schedules in every `CheckInterval` until the context is done.
+func (s *Scheduler) Start(c context.Context) {
+	async.Execute(func() {
+		t := time.NewTicker(s.config.CheckInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case now := <-t.C:
+				for _, run := range s.due(now) {
+					run := run
+					async.Execute(func() {
+						s.runScheduled(c, run)
+					}, s.poolNames()...)
+				}
+			}
+		}
+	})
+}
+
+// Run renders the report and delivers it immediately. The run is recorded in the history.
+func (s *Scheduler) Run(c context.Context, schedule Schedule) (*Run, error) {
+	report, err := getReport(schedule.Report)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ID:         uuid.NewString(),
+		ScheduleID: schedule.ID,
+		Report:     report.Name,
+		Title:      report.Title,
+		TenantID:   schedule.TenantID,
+		Format:     schedule.Format,
+		Status:     RunRunning,
+		StartedAt:  time.Now(),
+	}
+	s.save(c, run)
+
+	err = s.execute(c, report, schedule, run)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+
+	if err != nil {
+		run.Status = RunFailed
+		run.Error = err.Error()
+		s.save(c, run)
+		s.config.OnFailure(c, run, err)
+
+		return run, err
+	}
+
+	run.Status = RunSucceeded
+	s.save(c, run)
+
+	return run, nil
+}
+
+func (s *Scheduler) execute(c context.Context, report Report, schedule Schedule, run *Run) error {
+	exporter, err := getExporter(schedule.Format)
+	if err != nil {
+		return err
+	}
+
+	table, err := report.Query(c, schedule.TenantID, schedule.Params)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := exporter.Export(&buf, report.Title, table); err != nil {
+		return err
+	}
+
+	run.Rows = len(table.Rows)
+	run.Size = buf.Len()
+
+	artifact := &Artifact{
+		Filename:    fmt.Sprintf("%s_%s.%s", report.Name, run.StartedAt.UTC().Format("20060102T150405Z"), schedule.Format),
+		ContentType: exporter.ContentType(),
+		Data:        buf.Bytes(),
+	}
+
+	for _, delivery := range schedule.Deliveries {
+		if err := delivery.Deliver(c, run, artifact); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) runScheduled(c context.Context, run due) {
+	if s.config.Redis == nil {
+		_, _ = s.Run(c, run.Schedule)
+		return
+	}
+
+	// IMPORTANT: The lock is held during the run and the run time is recorded before it's released, so that
+	// the other replicas neither run the schedule at the same time nor run the same run time again.
+	prefix := dbdrivers.GetRedisCachePrefix() + ":report:"
+	ttl := run.Every / 2
+	if ttl < minLockTTL {
+		ttl = minLockTTL
+	}
+
+	lock, err := s.config.Redis.Lock(c, prefix+"lock:"+run.ID, ttl)
+	if err != nil {
+		if err != dbdrivers.ErrRedisLockNotObtained {
+			logger(c, s.config.Logger).Error(err)
+		}
+		return
+	}
+	defer func() {
+		if err := lock.Release(c); err != nil && err != dbdrivers.ErrRedisLockNotHeld {
+			logger(c, s.config.Logger).Error(err)
+		}
+	}()
+
+	lastKey := prefix + "last:" + run.ID
+	last, err := s.config.Redis.Client().Get(c, lastKey).Int64()
+	if err != nil && err != redis.Nil {
+		logger(c, s.config.Logger).Error(errors.WithStack(err))
+		return
+	}
+	if last >= run.at.UnixNano() {
+		return
+	}
+
+	_, _ = s.Run(c, run.Schedule)
+
+	if err := s.config.Redis.Client().Set(c, lastKey, run.at.UnixNano(), 2*run.Every+ttl).Err(); err != nil {
+		logger(c, s.config.Logger).Error(errors.WithStack(err))
+	}
+}
+
+func (s *Scheduler) due(now time.Time) []due {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []due
+	for _, schedule := range s.schedules {
+		if !now.Before(schedule.next) {
+			runs = append(runs, due{Schedule: schedule.Schedule, at: schedule.next})
+			schedule.next = schedule.Next(now)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+
+	return runs
+}
+
+func (s *Scheduler) save(c context.Context, run *Run) {
+	if err := s.config.History.Save(c, run); err != nil {
+		logger(c, s.config.Logger).Error(err)
+	}
+}
+
+func (s *Scheduler) poolNames() []string {
+	if s.config.PoolName == "" {
+		return nil
+	}
+	return []string{s.config.PoolName}
+}
@@ -0,0 +1,391 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package reservation provides an optimistic, inventory-style reservation helper. Quantities are
+// reserved atomically in redis (using lua scripts) with a TTL and later either confirmed inside a
+// MySQL transaction or released back to the available stock. Reservations which are neither confirmed
+// nor released before their TTL elapsed are returned to the stock by the reconciler.
+package reservation
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean"
+	"github.com/retail-ai-inc/bean/async"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientStock   = errors.New("reservation: insufficient stock")
+	ErrStockNotInitialized = errors.New("reservation: stock is not initialized")
+	ErrNotFound            = errors.New("reservation: reservation not found or already expired")
+)
+
+// Reservation represents a quantity of a SKU which is held for a limited time.
+type Reservation struct {
+	ID        string
+	SKU       string
+	Quantity  int64
+	ExpiresAt time.Time
+}
+
+// Config holds the settings of a `Reserver`.
+type Config struct {
+	// Prefix is prepended to all redis keys as a hash tag (`{<prefix>}:...`), so that the lua scripts
+	// work in redis cluster mode as all the keys are in the same slot.
+	// Default value is `dbdrivers.GetRedisCachePrefix() + ":reservation"`.
+	Prefix string
+	// TTL is the lifetime of a reservation if it is not confirmed or released. Default value is 15 minutes.
+	TTL time.Duration
+	// ReconcileBatchSize is the number of expired reservations released per reconcile round. Default value is 100.
+	ReconcileBatchSize int64
+}
+
+// Reserver reserves, confirms and releases quantities using redis for the hot path and MySQL for the
+// final (confirmed) state.
+type Reserver struct {
+	redis  *dbdrivers.RedisDBConn
+	db     *gorm.DB
+	config Config
+}
+
+// Reserve the quantity if there are enough available stock.
+// KEYS[1] = stock key, KEYS[2] = reservation key, KEYS[3] = expiry index key
+// ARGV[1] = quantity, ARGV[2] = sku, ARGV[3] = expire at (unix ms), ARGV[4] = reservation id
+var reserveScript = redis.NewScript(`
+local avail = redis.call('GET', KEYS[1])
+if not avail then
+	return -1
+end
+if tonumber(avail) < tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DECRBY', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[2], 'sku', ARGV[2], 'qty', ARGV[1], 'exp', ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// Put the reserved quantity back into the stock and remove the reservation.
+// KEYS[1] = stock key, KEYS[2] = reservation key, KEYS[3] = expiry index key
+// ARGV[1] = reservation id, ARGV[2] = only release if expired before (unix ms, 0 means always)
+var releaseScript = redis.NewScript(`
+local qty = redis.call('HGET', KEYS[2], 'qty')
+if not qty then
+	redis.call('ZREM', KEYS[3], ARGV[1])
+	return 0
+end
+local exp = tonumber(redis.call('HGET', KEYS[2], 'exp'))
+if tonumber(ARGV[2]) > 0 and exp > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], qty)
+redis.call('DEL', KEYS[2])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return 1
+`)
+
+// Remove the reservation without giving the quantity back to the stock. Returns the quantity or -1.
+// KEYS[1] = reservation key, KEYS[2] = expiry index key
+// ARGV[1] = reservation id
+var claimScript = redis.NewScript(`
+local qty = redis.call('HGET', KEYS[1], 'qty')
+if not qty then
+	return -1
+end
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return tonumber(qty)
+`)
+
+// New returns a `Reserver` using the redis connection for reservations and the gorm connection
+// for confirming the reservation transactionally. Both connections can be master or tenant connections.
+func New(redisConn *dbdrivers.RedisDBConn, db *gorm.DB, config Config) *Reserver {
+	if config.Prefix == "" {
+		config.Prefix = dbdrivers.GetRedisCachePrefix() + ":reservation"
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = 15 * time.Minute
+	}
+
+	if config.ReconcileBatchSize <= 0 {
+		config.ReconcileBatchSize = 100
+	}
+
+	return &Reserver{
+		redis:  redisConn,
+		db:     db,
+		config: config,
+	}
+}
+
+// SetStock sets the available (not reserved) quantity of a SKU. Usually it is called when the
+// inventory is loaded from MySQL or when the stock has been replenished.
+func (r *Reserver) SetStock(c context.Context, sku string, quantity int64) error {
+	if err := r.redis.Client().Set(c, r.stockKey(sku), quantity, 0).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Available returns the available (not reserved) quantity of a SKU.
+func (r *Reserver) Available(c context.Context, sku string) (int64, error) {
+	quantity, err := r.redis.Client().Get(c, r.stockKey(sku)).Int64()
+	if err == redis.Nil {
+		return 0, ErrStockNotInitialized
+	} else if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return quantity, nil
+}
+
+// Reserve atomically holds `quantity` of a SKU for the configured TTL. It returns `ErrInsufficientStock`
+// if there is not enough available stock.
+func (r *Reserver) Reserve(c context.Context, sku string, quantity int64) (*Reservation, error) {
+	if quantity <= 0 {
+		return nil, errors.New("reservation: quantity must be greater than 0")
+	}
+
+	res := &Reservation{
+		ID:        uuid.NewString(),
+		SKU:       sku,
+		Quantity:  quantity,
+		ExpiresAt: time.Now().Add(r.config.TTL),
+	}
+
+	result, err := reserveScript.Run(c, r.redis.Client(),
+		[]string{r.stockKey(sku), r.reservationKey(res.ID), r.expiryKey()},
+		quantity, sku, res.ExpiresAt.UnixMilli(), res.ID,
+	).Int()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	switch result {
+	case -1:
+		return nil, ErrStockNotInitialized
+	case 0:
+		return nil, ErrInsufficientStock
+	}
+
+	return res, nil
+}
+
+// Get returns a reservation which is neither confirmed nor released yet.
+func (r *Reserver) Get(c context.Context, id string) (*Reservation, error) {
+	fields, err := r.redis.Client().HGetAll(c, r.reservationKey(id)).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	quantity, _ := strconv.ParseInt(fields["qty"], 10, 64)
+	expireAt, _ := strconv.ParseInt(fields["exp"], 10, 64)
+
+	return &Reservation{
+		ID:        id,
+		SKU:       fields["sku"],
+		Quantity:  quantity,
+		ExpiresAt: time.UnixMilli(expireAt),
+	}, nil
+}
+
+// Confirm turns a reservation into a permanent state change. The reservation is claimed in redis first
+// (so that the reconciler can not release it anymore) and then `fn` is executed inside a MySQL transaction,
+// example: decrement the inventory table and insert the order lines. If `fn` returns an error or panics,
+// the transaction is rolled back and the reservation is restored with its original expiry.
+func (r *Reserver) Confirm(c context.Context, id string, fn func(tx *gorm.DB, res *Reservation) error) (err error) {
+	res, err := r.Get(c, id)
+	if err != nil {
+		return err
+	}
+
+	quantity, err := claimScript.Run(c, r.redis.Client(), []string{r.reservationKey(id), r.expiryKey()}, id).Int64()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if quantity < 0 {
+		return ErrNotFound
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.restore(c, res)
+			panic(p)
+		}
+
+		if err != nil {
+			r.restore(c, res)
+		}
+	}()
+
+	return r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return fn(tx, res)
+	})
+}
+
+// Release gives the reserved quantity back to the available stock. Releasing an unknown or already
+// released reservation returns `ErrNotFound`.
+func (r *Reserver) Release(c context.Context, id string) error {
+	released, err := r.release(c, id, 0)
+	if err != nil {
+		return err
+	}
+
+	if !released {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Reconcile releases all the reservations which are expired and returns the number of released reservations.
+func (r *Reserver) Reconcile(c context.Context) (int, error) {
+	var count int
+
+	for {
+		now := time.Now().UnixMilli()
+
+		ids, err := r.redis.Client().ZRangeByScore(c, r.expiryKey(), &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now, 10),
+			Count: r.config.ReconcileBatchSize,
+		}).Result()
+		if err != nil {
+			return count, errors.WithStack(err)
+		}
+
+		if len(ids) == 0 {
+			return count, nil
+		}
+
+		for _, id := range ids {
+			released, err := r.release(c, id, now)
+			if err != nil {
+				return count, err
+			}
+
+			if released {
+				count++
+			}
+		}
+
+		if int64(len(ids)) < r.config.ReconcileBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// StartReconciler runs `Reconcile` in every `interval` until the context is canceled. The job is
+// executed safely using `async.Execute` so a panic will not crash the application.
+func (r *Reserver) StartReconciler(c context.Context, interval time.Duration) {
+	async.Execute(func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-t.C:
+				count, err := r.Reconcile(c)
+				if err != nil {
+					bean.LoggerWithContext(c).Error(err)
+				}
+
+				if count > 0 {
+					bean.LoggerWithContext(c).Infof("reservation: released %d expired reservation(s)", count)
+				}
+			}
+		}
+	})
+}
+
+func (r *Reserver) release(c context.Context, id string, expiredBefore int64) (bool, error) {
+	sku, err := r.redis.Client().HGet(c, r.reservationKey(id), "sku").Result()
+	if err == redis.Nil {
+		// Clean up the dangling index entry if any.
+		if err := r.redis.Client().ZRem(c, r.expiryKey(), id).Err(); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		return false, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	result, err := releaseScript.Run(c, r.redis.Client(),
+		[]string{r.stockKey(sku), r.reservationKey(id), r.expiryKey()},
+		id, expiredBefore,
+	).Int()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return result == 1, nil
+}
+
+// restore puts back a claimed reservation when the confirmation failed. It is not canceled with `c`,
+// which is only used for the logger.
+func (r *Reserver) restore(c context.Context, res *Reservation) {
+	ctx := context.Background()
+
+	_, err := r.redis.Client().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.reservationKey(res.ID), "sku", res.SKU, "qty", res.Quantity, "exp", res.ExpiresAt.UnixMilli())
+		pipe.ZAdd(ctx, r.expiryKey(), &redis.Z{Score: float64(res.ExpiresAt.UnixMilli()), Member: res.ID})
+		return nil
+	})
+	if err != nil {
+		bean.LoggerWithContext(c).Error(errors.WithStack(err))
+	}
+}
+
+func (r *Reserver) stockKey(sku string) string {
+	return r.hashTag() + ":stock:" + sku
+}
+
+func (r *Reserver) reservationKey(id string) string {
+	return r.hashTag() + ":res:" + id
+}
+
+func (r *Reserver) expiryKey() string {
+	return r.hashTag() + ":expiry"
+}
+
+// hashTag keeps all the keys in the same redis cluster slot, the scripts use the stock, a reservation
+// and the expiry index together.
+func (r *Reserver) hashTag() string {
+	return "{" + r.config.Prefix + "}"
+}
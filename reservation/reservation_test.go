@@ -0,0 +1,123 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestReserver(t *testing.T, config Config) (*Reserver, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	conn := &dbdrivers.RedisDBConn{Host: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	return New(conn, db, config), mr
+}
+
+func TestReserveAndRelease(t *testing.T) {
+	r, mr := newTestReserver(t, Config{Prefix: "shop"})
+	c := context.Background()
+
+	_, err := r.Reserve(c, "sku1", 1)
+	assert.Equal(t, ErrStockNotInitialized, err)
+
+	require.NoError(t, r.SetStock(c, "sku1", 5))
+	res, err := r.Reserve(c, "sku1", 3)
+	require.NoError(t, err)
+
+	available, err := r.Available(c, "sku1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), available)
+
+	_, err = r.Reserve(c, "sku1", 3)
+	assert.Equal(t, ErrInsufficientStock, err)
+
+	// All the keys share the same hash tag.
+	assert.True(t, mr.Exists("{shop}:stock:sku1"))
+	assert.True(t, mr.Exists("{shop}:res:"+res.ID))
+	assert.True(t, mr.Exists("{shop}:expiry"))
+
+	got, err := r.Get(c, res.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "sku1", got.SKU)
+	assert.Equal(t, int64(3), got.Quantity)
+
+	require.NoError(t, r.Release(c, res.ID))
+	assert.Equal(t, ErrNotFound, r.Release(c, res.ID))
+
+	available, err = r.Available(c, "sku1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), available)
+}
+
+func TestConfirm(t *testing.T) {
+	r, _ := newTestReserver(t, Config{})
+	c := context.Background()
+
+	require.NoError(t, r.SetStock(c, "sku1", 5))
+	res, err := r.Reserve(c, "sku1", 2)
+	require.NoError(t, err)
+
+	// A failed confirmation restores the reservation.
+	err = r.Confirm(c, res.ID, func(tx *gorm.DB, res *Reservation) error {
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	_, err = r.Get(c, res.ID)
+	assert.NoError(t, err)
+
+	var confirmed *Reservation
+	require.NoError(t, r.Confirm(c, res.ID, func(tx *gorm.DB, res *Reservation) error {
+		confirmed = res
+		return nil
+	}))
+	assert.Equal(t, int64(2), confirmed.Quantity)
+
+	// The quantity is not given back to the stock.
+	_, err = r.Get(c, res.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, r.Release(c, res.ID))
+	available, err := r.Available(c, "sku1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), available)
+}
+
+func TestReconcile(t *testing.T) {
+	r, _ := newTestReserver(t, Config{TTL: time.Millisecond, ReconcileBatchSize: 1})
+	c := context.Background()
+
+	require.NoError(t, r.SetStock(c, "sku1", 5))
+	for i := 0; i < 3; i++ {
+		_, err := r.Reserve(c, "sku1", 1)
+		require.NoError(t, err)
+	}
+
+	// A reservation which has not expired yet is kept.
+	r.config.TTL = time.Hour
+	kept, err := r.Reserve(c, "sku1", 1)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	count, err := r.Reconcile(c)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	available, err := r.Available(c, "sku1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), available)
+
+	_, err = r.Get(c, kept.ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,190 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package response provides the helpers to return the same JSON envelope from all the handlers:
+//
+//	{"code": "000000", "message": "OK", "data": {...}, "meta": {...}}
+//
+// `code` is the `GlobalErrCode` of the `APIError` machinery, `API_SUCCESS` for a successful response.
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	sentryecho "github.com/getsentry/sentry-go/echo"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/degrade"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/validator"
+	"github.com/spf13/viper"
+)
+
+// Envelope is the body of all the JSON responses.
+type Envelope struct {
+	Code    berror.ErrorCode `json:"code"`
+	Message string           `json:"message"`
+	Data    interface{}      `json:"data,omitempty"`
+	Meta    *Meta            `json:"meta,omitempty"`
+
+	// Warnings lists the features of the response which are degraded. (see the `degrade` package)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TypedEnvelope is the `Envelope` of a `T` data, it describes the response body of a typed route in the
+// OpenAPI document. (see `bean.GET`)
+type TypedEnvelope[T any] struct {
+	Code     berror.ErrorCode `json:"code"`
+	Message  string           `json:"message"`
+	Data     T                `json:"data,omitempty"`
+	Meta     *Meta            `json:"meta,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// Meta describes the page of a paginated response. Set `Page` and `Total` for an offset pagination and
+// `NextCursor` for a cursor pagination. (see the `paginator` package)
+type Meta struct {
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// JSON sends an envelope with a custom status and code.
+func JSON(c echo.Context, status int, code berror.ErrorCode, message string, data interface{}, meta *Meta) error {
+	return c.JSON(status, Envelope{
+		Code:     code,
+		Message:  message,
+		Data:     data,
+		Meta:     meta,
+		Warnings: degrade.Warnings(c),
+	})
+}
+
+// OK sends `data` with `200 OK`.
+func OK(c echo.Context, data interface{}) error {
+	return JSON(c, http.StatusOK, berror.API_SUCCESS, http.StatusText(http.StatusOK), data, nil)
+}
+
+// Created sends the created resource with `201 Created`.
+func Created(c echo.Context, data interface{}) error {
+	return JSON(c, http.StatusCreated, berror.API_SUCCESS, http.StatusText(http.StatusCreated), data, nil)
+}
+
+// Accepted sends `data` with `202 Accepted`, for the requests which are processed asynchronously.
+func Accepted(c echo.Context, data interface{}) error {
+	return JSON(c, http.StatusAccepted, berror.API_SUCCESS, http.StatusText(http.StatusAccepted), data, nil)
+}
+
+// Paginated sends a page of `items` with `200 OK`.
+// Example:
+//
+//	return response.Paginated(c, orders, response.Meta{NextCursor: next, HasMore: next != ""})
+func Paginated(c echo.Context, items interface{}, meta Meta) error {
+	return JSON(c, http.StatusOK, berror.API_SUCCESS, http.StatusText(http.StatusOK), items, &meta)
+}
+
+// Error sends the envelope of an error. The status and the code of an `APIError` are kept, the field
+// errors of a `ValidationError` are sent as the data and any other error is an internal server error
+// whose message is hidden from the client.
+func Error(c echo.Context, err error) error {
+	status, code, message, data := errorEnvelope(c, err)
+	return JSON(c, status, code, message, data, nil)
+}
+
+// ErrorHanderFunc sends all the errors in the envelope, it replaces the JSON responses of the error
+// handlers of the `error` package:
+//
+//	b.UseErrorHandlerFuncs(response.ErrorHanderFunc)
+func ErrorHanderFunc(err error, c echo.Context) (bool, error) {
+	var apiErr *berror.APIError
+	if !errors.As(err, &apiErr) {
+		if dbErr := berror.MapDBError(err); dbErr != nil {
+			if dbErr.Retryable && dbErr.HTTPStatusCode == http.StatusServiceUnavailable {
+				c.Response().Header().Set("Retry-After", "1")
+			}
+			err = dbErr
+		}
+	}
+
+	status, _, _, _ := errorEnvelope(c, err)
+
+	if status >= http.StatusNotFound {
+		c.Logger().Error(err)
+	}
+
+	ignorable := errors.As(err, &apiErr) && apiErr.Ignorable
+	if status >= http.StatusInternalServerError && !ignorable && viper.GetBool("sentry.on") {
+		if hub := sentryecho.GetHubFromContext(c); hub != nil {
+			hub.CaptureException(err)
+		}
+	}
+
+	return true, Error(c, err)
+}
+
+func errorEnvelope(c echo.Context, err error) (int, berror.ErrorCode, string, interface{}) {
+	var apiErr *berror.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode, apiErr.GlobalErrCode, apiErr.Error(), nil
+	}
+
+	var validationErr *validator.ValidationError
+	if errors.As(err, &validationErr) {
+		fields := validationErr.Fields(validator.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))...)
+		return http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, http.StatusText(http.StatusBadRequest), fields
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code, httpErrorCode(httpErr.Code), fmt.Sprint(httpErr.Message), nil
+	}
+
+	return http.StatusInternalServerError, berror.INTERNAL_SERVER_ERROR, http.StatusText(http.StatusInternalServerError), nil
+}
+
+func httpErrorCode(status int) berror.ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return berror.PROBLEM_PARSING_JSON
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return berror.UNAUTHORIZED_ACCESS
+	case http.StatusNotFound:
+		return berror.RESOURCE_NOT_FOUND
+	case http.StatusMethodNotAllowed:
+		return berror.METHOD_NOT_ALLOWED
+	case http.StatusConflict:
+		return berror.RESOURCE_CONFLICT
+	case http.StatusRequestEntityTooLarge:
+		return berror.REQUEST_ENTITY_TOO_LARGE
+	case http.StatusTooManyRequests:
+		return berror.TOO_MANY_REQUESTS
+	case http.StatusServiceUnavailable:
+		return berror.SERVICE_UNAVAILABLE
+	case http.StatusGatewayTimeout:
+		return berror.TIMEOUT
+	default:
+		return berror.UNKNOWN_ERROR_CODE
+	}
+}
@@ -0,0 +1,101 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package response
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	total := int64(42)
+
+	tests := []struct {
+		name   string
+		send   func(c echo.Context) error
+		status int
+		body   string
+	}{
+		{
+			name:   "ok",
+			send:   func(c echo.Context) error { return OK(c, map[string]int{"id": 1}) },
+			status: http.StatusOK,
+			body:   `{"code":"000000","message":"OK","data":{"id":1}}`,
+		},
+		{
+			name:   "created",
+			send:   func(c echo.Context) error { return Created(c, map[string]int{"id": 1}) },
+			status: http.StatusCreated,
+			body:   `{"code":"000000","message":"Created","data":{"id":1}}`,
+		},
+		{
+			name:   "paginated",
+			send:   func(c echo.Context) error { return Paginated(c, []int{1, 2}, Meta{Total: &total, HasMore: true}) },
+			status: http.StatusOK,
+			body:   `{"code":"000000","message":"OK","data":[1,2],"meta":{"total":42,"hasMore":true}}`,
+		},
+		{
+			name: "api error",
+			send: func(c echo.Context) error {
+				return Error(c, berror.NewAPIError(http.StatusConflict, berror.RESOURCE_CONFLICT, errors.New("duplicated")))
+			},
+			status: http.StatusConflict,
+			body:   `{"code":"100007","message":"duplicated"}`,
+		},
+		{
+			name:   "internal error",
+			send:   func(c echo.Context) error { return Error(c, errors.New("secret")) },
+			status: http.StatusInternalServerError,
+			body:   `{"code":"100004","message":"Internal Server Error"}`,
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		assert.NoError(t, tt.send(c), tt.name)
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		assert.JSONEq(t, tt.body, rec.Body.String(), tt.name)
+	}
+}
+
+func TestErrorHanderFunc(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	ok, err := ErrorHanderFunc(context.DeadlineExceeded, c)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.JSONEq(t, `{"code":"100099","message":"context deadline exceeded"}`, rec.Body.String())
+}
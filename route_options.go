@@ -0,0 +1,409 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/middleware"
+	"github.com/retail-ai-inc/bean/openapi"
+)
+
+// RouteOption declares a cross-cutting behavior of a route next to the route itself.
+// Example:
+//
+//	b.GET("/products", hdlrs.productHdlr.List, bean.WithCache(5*time.Minute), bean.WithRateLimit(600))
+//	b.POST("/products", hdlrs.productHdlr.Create, bean.WithAuth("products:write"), bean.WithBodyLimit("2M"))
+type RouteOption func(o *routeOptions)
+
+type routeOptions struct {
+	name        string
+	auth        bool
+	scopes      []string
+	cacheTTL    time.Duration
+	cacheKey    func(c echo.Context) string
+	cacheCtrl   *middleware.CacheControlConfig
+	vary        []string
+	rateLimit   int
+	bodyLimit   string
+	decompress  *middleware.DecompressConfig
+	renderer    string
+	doc         *openapi.Doc
+	contract    *routeContract
+	timeout     *time.Duration
+	middlewares []echo.MiddlewareFunc
+}
+
+// WithName sets the name of the route.
+func WithName(name string) RouteOption {
+	return func(o *routeOptions) {
+		o.name = name
+	}
+}
+
+// WithAuth requires an authenticated caller having all the scopes. (see `Bean.RouteAuth`)
+func WithAuth(scopes ...string) RouteOption {
+	return func(o *routeOptions) {
+		o.auth = true
+		o.scopes = append(o.scopes, scopes...)
+	}
+}
+
+// WithCache serves the successful `GET` responses of the route from the cache for `ttl`.
+// (see `middleware.ResponseCache`) The responses are cached by the method and the URI of the request, so
+// a route having `WithAuth` also requires `WithCacheKey` to not serve the response of a user to another.
+func WithCache(ttl time.Duration) RouteOption {
+	return func(o *routeOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithCacheKey sets the cache key of `WithCache`, the response is not cached if it returns an empty string.
+// Example:
+//
+//	b.GET("/me/orders", hdlrs.orderHdlr.List, bean.WithAuth("orders:read"), bean.WithCache(time.Minute),
+//		bean.WithCacheKey(func(c echo.Context) string {
+//			return userID(c) + ":" + c.Request().URL.RequestURI()
+//		}))
+func WithCacheKey(keyFunc func(c echo.Context) string) RouteOption {
+	return func(o *routeOptions) {
+		o.cacheKey = keyFunc
+	}
+}
+
+// WithCacheControl declares the `Cache-Control` and `Surrogate-Control` headers of the successful responses
+// of the route, the last one wins if it's set on both the group and the route. (see `middleware.CacheControl`)
+// Example:
+//
+//	bean.WithCacheControl(middleware.CacheControlConfig{Public: true, MaxAge: time.Minute, SMaxAge: time.Hour})
+func WithCacheControl(config middleware.CacheControlConfig) RouteOption {
+	return func(o *routeOptions) {
+		o.cacheCtrl = &config
+	}
+}
+
+// WithVary adds the request headers the responses of the route depend on to the `Vary` header.
+func WithVary(headers ...string) RouteOption {
+	return func(o *routeOptions) {
+		o.vary = append(o.vary, headers...)
+	}
+}
+
+// WithRateLimit limits the requests of a caller to `perMinute`. (see `middleware.RateLimit`)
+func WithRateLimit(perMinute int) RouteOption {
+	return func(o *routeOptions) {
+		o.rateLimit = perMinute
+	}
+}
+
+// WithBodyLimit overrides `http.bodyLimit` of `env.json` for the route, like "10M". It can only make
+// the limit smaller because the global limit is checked first.
+func WithBodyLimit(limit string) RouteOption {
+	return func(o *routeOptions) {
+		o.bodyLimit = limit
+	}
+}
+
+// WithDecompress decompresses the `gzip` and `deflate` request bodies of the route up to `maxBodyBytes`,
+// like a partner webhook. If `http.decompression` of `env.json` is on, its limits are checked first.
+// (see `middleware.Decompress`)
+func WithDecompress(maxBodyBytes int64) RouteOption {
+	return func(o *routeOptions) {
+		o.decompress = &middleware.DecompressConfig{MaxBodyBytes: maxBodyBytes}
+	}
+}
+
+// WithTimeout overrides `http.timeout` of `env.json` for the route, a zero timeout disables the deadline.
+// (see `middleware.Timeout`)
+func WithTimeout(timeout time.Duration) RouteOption {
+	return func(o *routeOptions) {
+		o.timeout = &timeout
+	}
+}
+
+// WithRenderer renders the views of the route with the renderer registered by `name`, see `Bean.RegisterRenderer`.
+// Set it on a route group to render a whole section, like the admin pages, with another template engine.
+func WithRenderer(name string) RouteOption {
+	return func(o *routeOptions) {
+		o.renderer = name
+	}
+}
+
+// WithDoc describes the route in the OpenAPI document, if `openapi.on` of `env.json` is true.
+// Example:
+//
+//	b.POST("/products", hdlrs.productHdlr.Create, bean.WithDoc(openapi.Doc{
+//		Summary:   "Create a product",
+//		Request:   CreateProductRequest{},
+//		Responses: map[int]interface{}{http.StatusCreated: Product{}},
+//	}))
+func WithDoc(doc openapi.Doc) RouteOption {
+	return func(o *routeOptions) {
+		o.doc = &doc
+	}
+}
+
+// WithMiddleware adds route specific middlewares, they are executed after the other options.
+func WithMiddleware(m ...echo.MiddlewareFunc) RouteOption {
+	return func(o *routeOptions) {
+		o.middlewares = append(o.middlewares, m...)
+	}
+}
+
+// GET registers a new GET route with the options.
+func (b *Bean) GET(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return b.Add(http.MethodGet, path, h, opts...)
+}
+
+// POST registers a new POST route with the options.
+func (b *Bean) POST(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return b.Add(http.MethodPost, path, h, opts...)
+}
+
+// PUT registers a new PUT route with the options.
+func (b *Bean) PUT(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return b.Add(http.MethodPut, path, h, opts...)
+}
+
+// PATCH registers a new PATCH route with the options.
+func (b *Bean) PATCH(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return b.Add(http.MethodPatch, path, h, opts...)
+}
+
+// DELETE registers a new DELETE route with the options.
+func (b *Bean) DELETE(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return b.Add(http.MethodDelete, path, h, opts...)
+}
+
+// Add registers a new route with the options. The middlewares of the options are always composed in
+// the same order whatever the order of the options:
+//
+//	auth -> rate limit -> body limit -> decompress -> cache control -> cache -> contract -> `WithMiddleware` -> handler
+//
+// so that an unauthenticated request never consumes the rate limit and a cached response is still
+// protected by the auth and the rate limit.
+func (b *Bean) Add(method, path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	o := &routeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.timeout != nil {
+		middleware.RegisterRouteTimeout(method, path, *o.timeout)
+	}
+
+	var m []echo.MiddlewareFunc
+	var infos []MiddlewareInfo
+
+	if o.auth {
+		auth := b.RouteAuth
+		if auth == nil {
+			auth = middleware.RequireAPIKeyScopes
+		}
+		m = append(m, auth(o.scopes...))
+		infos = append(infos, routeMiddlewareInfo("Auth", map[string]interface{}{
+			"func":   funcName(auth),
+			"scopes": o.scopes,
+		}))
+	}
+
+	if o.rateLimit > 0 {
+		m = append(m, middleware.RateLimit(middleware.RateLimitConfig{
+			Limit:   o.rateLimit,
+			Limiter: b.routeRateLimiter(),
+			Prefix:  method + " " + path,
+		}))
+		infos = append(infos, routeMiddlewareInfo("RateLimit", map[string]interface{}{
+			"perMinute": o.rateLimit,
+		}))
+	}
+
+	if o.bodyLimit != "" {
+		m = append(m, echomiddleware.BodyLimit(o.bodyLimit))
+		infos = append(infos, routeMiddlewareInfo("BodyLimit", map[string]interface{}{
+			"bodyLimit": o.bodyLimit,
+		}))
+	}
+
+	if o.decompress != nil {
+		m = append(m, middleware.Decompress(*o.decompress))
+		infos = append(infos, routeMiddlewareInfo("Decompress", map[string]interface{}{
+			"maxBodyBytes": o.decompress.MaxBodyBytes,
+		}))
+	}
+
+	if o.cacheCtrl != nil || len(o.vary) > 0 {
+		config := middleware.CacheControlConfig{}
+		if o.cacheCtrl != nil {
+			config = *o.cacheCtrl
+		}
+		config.Vary = append(append([]string(nil), config.Vary...), o.vary...)
+
+		m = append(m, middleware.CacheControl(config))
+		infos = append(infos, routeMiddlewareInfo("CacheControl", map[string]interface{}{
+			"cacheControl": config.CacheControl(),
+			"vary":         config.Vary,
+		}))
+	}
+
+	if o.cacheTTL > 0 {
+		if o.auth && o.cacheKey == nil {
+			panic(fmt.Sprintf("bean: the cached route %s %s requires WithCacheKey because of WithAuth", method, path))
+		}
+
+		m = append(m, middleware.ResponseCache(middleware.ResponseCacheConfig{
+			TTL:     o.cacheTTL,
+			Store:   b.routeCacheStore(),
+			KeyFunc: o.cacheKey,
+		}))
+		infos = append(infos, routeMiddlewareInfo("ResponseCache", map[string]interface{}{
+			"ttl": o.cacheTTL.String(),
+		}))
+	}
+
+	if o.renderer != "" {
+		m = append(m, SelectRenderer(o.renderer))
+		infos = append(infos, routeMiddlewareInfo("Renderer", map[string]interface{}{
+			"name": o.renderer,
+		}))
+	}
+
+	if o.contract != nil && b.Config.HTTP.Contracts.On {
+		m = append(m, b.contractMiddleware(method, path, o.contract))
+		infos = append(infos, routeMiddlewareInfo("Contract", map[string]interface{}{
+			"request":  fmt.Sprint(o.contract.request),
+			"response": fmt.Sprint(o.contract.response),
+		}))
+	}
+
+	m = append(m, o.middlewares...)
+	for _, mw := range o.middlewares {
+		infos = append(infos, MiddlewareInfo{Name: funcName(mw), Stage: MiddlewareStageRoute})
+	}
+
+	r := b.Echo.Add(method, path, h, m...)
+	if o.name != "" {
+		r.Name = o.name
+	}
+
+	if o.doc != nil && OpenAPI != nil {
+		OpenAPI.Describe(method, path, *o.doc)
+	}
+
+	recordRoute(b.Echo, method, path, routeEntry{
+		handler:     funcName(h),
+		middlewares: infos,
+		timeout:     o.timeout,
+	})
+
+	return r
+}
+
+// RouteGroup registers the routes under a path prefix with the options shared by the group, like the
+// caching directives of a CDN facing API. The options of a route are applied after the group ones.
+// Example:
+//
+//	cdn := middleware.CacheControlConfig{Public: true, MaxAge: time.Minute, SMaxAge: time.Hour}
+//	catalog := b.Group("/catalog", bean.WithCacheControl(cdn), bean.WithVary("Accept-Language"))
+//	catalog.GET("/products", hdlrs.productHdlr.List)
+type RouteGroup struct {
+	bean   *Bean
+	prefix string
+	opts   []RouteOption
+}
+
+// Group returns a route group of `prefix` with the options.
+func (b *Bean) Group(prefix string, opts ...RouteOption) *RouteGroup {
+	return &RouteGroup{bean: b, prefix: prefix, opts: opts}
+}
+
+// Group returns a sub group of `prefix` inheriting the options of the group.
+func (g *RouteGroup) Group(prefix string, opts ...RouteOption) *RouteGroup {
+	return &RouteGroup{bean: g.bean, prefix: g.prefix + prefix, opts: append(append([]RouteOption(nil), g.opts...), opts...)}
+}
+
+// GET registers a new GET route of the group.
+func (g *RouteGroup) GET(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.Add(http.MethodGet, path, h, opts...)
+}
+
+// POST registers a new POST route of the group.
+func (g *RouteGroup) POST(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.Add(http.MethodPost, path, h, opts...)
+}
+
+// PUT registers a new PUT route of the group.
+func (g *RouteGroup) PUT(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.Add(http.MethodPut, path, h, opts...)
+}
+
+// PATCH registers a new PATCH route of the group.
+func (g *RouteGroup) PATCH(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.Add(http.MethodPatch, path, h, opts...)
+}
+
+// DELETE registers a new DELETE route of the group.
+func (g *RouteGroup) DELETE(path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.Add(http.MethodDelete, path, h, opts...)
+}
+
+// Add registers a new route of the group, see `Bean.Add`.
+func (g *RouteGroup) Add(method, path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route {
+	return g.bean.Add(method, g.prefix+path, h, append(append([]RouteOption(nil), g.opts...), opts...)...)
+}
+
+func routeMiddlewareInfo(name string, config map[string]interface{}) MiddlewareInfo {
+	return MiddlewareInfo{Name: name, Stage: MiddlewareStageRoute, BuiltIn: true, Config: config}
+}
+
+// routeRateLimiter returns `Bean.RouteRateLimiter`, defaulting to the master redis to share the
+// limits between the replicas or to the memory of the process.
+func (b *Bean) routeRateLimiter() middleware.RateLimiter {
+	if b.RouteRateLimiter == nil {
+		if client := b.masterRedisClient(); client != nil {
+			b.RouteRateLimiter = middleware.NewRedisRateLimiter(client, "route:rate:")
+		} else {
+			b.RouteRateLimiter = middleware.NewMemoryRateLimiter()
+		}
+	}
+
+	return b.RouteRateLimiter
+}
+
+// routeCacheStore returns `Bean.RouteCacheStore`, defaulting to the master redis or to the memory of
+// the process.
+func (b *Bean) routeCacheStore() middleware.CacheStore {
+	if b.RouteCacheStore == nil {
+		if client := b.masterRedisClient(); client != nil {
+			b.RouteCacheStore = middleware.NewRedisCacheStore(client, "route:cache:")
+		} else {
+			b.RouteCacheStore = middleware.NewMemoryCacheStore(0)
+		}
+	}
+
+	return b.RouteCacheStore
+}
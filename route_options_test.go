@@ -0,0 +1,140 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBean_RouteOptions(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+
+	calls := 0
+	b.GET("/products", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusOK, calls)
+	}, WithRateLimit(2), WithCache(time.Minute), WithName("products.list"))
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.Echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+		return rec
+	}
+
+	rec := serve()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "1\n", rec.Body.String())
+
+	rec = serve()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "1\n", rec.Body.String())
+
+	// The rate limit is checked before the cache.
+	rec = serve()
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Empty(t, rec.Header().Get("X-Cache"))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, "products.list", b.Echo.Routes()[0].Name)
+}
+
+func TestBean_RouteCacheKey(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+	b.RouteAuth = func(scopes ...string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set("user", c.Request().Header.Get("X-User"))
+				return next(c)
+			}
+		}
+	}
+
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("user").(string))
+	}
+
+	assert.Panics(t, func() {
+		b.GET("/me", handler, WithAuth(), WithCache(time.Minute))
+	})
+
+	b.GET("/me", handler, WithAuth(), WithCache(time.Minute), WithCacheKey(func(c echo.Context) string {
+		return c.Get("user").(string) + ":" + c.Request().URL.RequestURI()
+	}))
+
+	serve := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		b.Echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, "alice", serve("alice").Body.String())
+	rec := serve("bob")
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "bob", rec.Body.String())
+	rec = serve("alice")
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "alice", rec.Body.String())
+}
+
+func TestBean_RouteGroupCacheControl(t *testing.T) {
+	b := &Bean{Echo: echo.New()}
+
+	catalog := b.Group("/catalog", WithCacheControl(middleware.CacheControlConfig{
+		Public:               true,
+		MaxAge:               time.Minute,
+		SMaxAge:              time.Hour,
+		StaleWhileRevalidate: 30 * time.Second,
+		SurrogateMaxAge:      24 * time.Hour,
+	}), WithVary("Accept-Language"))
+
+	catalog.GET("/products", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	catalog.GET("/cart", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, WithCacheControl(middleware.CacheControlConfig{Private: true, NoCache: true}), WithVary("Cookie"))
+	catalog.GET("/missing", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+	catalog.Group("/v2").POST("/products", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.Echo.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/catalog/products")
+	assert.Equal(t, "public, max-age=60, s-maxage=3600, stale-while-revalidate=30", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, "max-age=86400", rec.Header().Get("Surrogate-Control"))
+	assert.Equal(t, []string{"Accept-Language"}, rec.Header().Values(echo.HeaderVary))
+
+	rec = serve(http.MethodGet, "/catalog/cart")
+	assert.Equal(t, "private, no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Empty(t, rec.Header().Get("Surrogate-Control"))
+	assert.Equal(t, []string{"Accept-Language", "Cookie"}, rec.Header().Values(echo.HeaderVary))
+
+	// The errors and the unsafe methods are never cacheable.
+	rec = serve(http.MethodGet, "/catalog/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, "Accept-Language", rec.Header().Get(echo.HeaderVary))
+
+	rec = serve(http.MethodPost, "/catalog/v2/products")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get(echo.HeaderCacheControl))
+}
@@ -0,0 +1,215 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AWSConfig is the config of the AWS Secrets Manager provider.
+type AWSConfig struct {
+	// Optional. Default value is the region of the ARN of the secret, or the `AWS_REGION` or
+	// `AWS_DEFAULT_REGION` environment variable.
+	Region string
+	// Optional. Default value is "https://secretsmanager.<region>.amazonaws.com".
+	Endpoint string
+	// Credentials returns the credentials signing the requests.
+	// Optional. Default value reads the `AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY` and `AWS_SESSION_TOKEN`
+	// environment variables, or the credentials of the ECS task role.
+	Credentials func(c context.Context) (AWSCredentials, error)
+}
+
+// AWSCredentials are the credentials of an IAM user or role.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// NewAWS returns the provider reading the current version of the secret of the name or ARN of the path.
+// (example: "secretRef://aws/prod/mysql#password")
+func NewAWS(config AWSConfig) Provider {
+	credentials := config.Credentials
+	if credentials == nil {
+		credentials = defaultAWSCredentials
+	}
+
+	return ProviderFunc(func(c context.Context, path string) (string, error) {
+		region := config.Region
+		if arn := strings.Split(path, ":"); region == "" && len(arn) > 3 && arn[0] == "arn" {
+			region = arn[3]
+		}
+		if region == "" {
+			region = valueOrEnv(os.Getenv("AWS_REGION"), "AWS_DEFAULT_REGION")
+		}
+		if region == "" {
+			return "", errors.New("aws region is not set")
+		}
+
+		endpoint := config.Endpoint
+		if endpoint == "" {
+			endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+		}
+
+		creds, err := credentials(c)
+		if err != nil {
+			return "", err
+		}
+
+		payload, err := json.Marshal(map[string]string{"SecretId": path})
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		req, err := http.NewRequestWithContext(c, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(payload))
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+		signV4(req, payload, creds, region, "secretsmanager", time.Now())
+
+		var body struct {
+			SecretString *string
+			SecretBinary string
+		}
+		if err := doJSON(req, &body); err != nil {
+			return "", err
+		}
+
+		if body.SecretString != nil {
+			return *body.SecretString, nil
+		}
+
+		data, err := base64.StdEncoding.DecodeString(body.SecretBinary)
+		return string(data), errors.WithStack(err)
+	})
+}
+
+func defaultAWSCredentials(c context.Context) (AWSCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return AWSCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	if uri == "" {
+		return AWSCredentials{}, errors.New("aws credentials are not set")
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet, "http://169.254.170.2"+uri, nil)
+	if err != nil {
+		return AWSCredentials{}, errors.WithStack(err)
+	}
+
+	var body struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+	}
+	if err := doJSON(req, &body); err != nil {
+		return AWSCredentials{}, errors.Wrap(err, "failed to get the credentials of the task role")
+	}
+
+	return AWSCredentials{AccessKeyID: body.AccessKeyID, SecretAccessKey: body.SecretAccessKey, SessionToken: body.Token}, nil
+}
+
+// signV4 signs the request with the signature version 4 of AWS, all the headers of the request are signed.
+func signV4(req *http.Request, payload []byte, creds AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.Query().Encode(), canonicalHeaders.String(), signedHeaders, sha256Hex(payload),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
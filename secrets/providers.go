@@ -0,0 +1,231 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// envProvider returns the environment variable of the path. (example: "secretRef://env/MYSQL_PASSWORD")
+type envProvider struct{}
+
+func (envProvider) Fetch(c context.Context, path string) (string, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return "", errors.Errorf("environment variable %s is not set", path)
+	}
+	return value, nil
+}
+
+// fileProvider returns the content of the file of the absolute path, without the trailing newline.
+// (example: "secretRef://file/run/secrets/mysql_password")
+type fileProvider struct{}
+
+func (fileProvider) Fetch(c context.Context, path string) (string, error) {
+	b, err := os.ReadFile("/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// VaultConfig is the config of the HashiCorp Vault provider.
+type VaultConfig struct {
+	// Optional. Default value is the `VAULT_ADDR` environment variable.
+	Addr string
+	// Optional. Default value is the `VAULT_TOKEN` environment variable.
+	Token string
+	// Optional. Default value is the `VAULT_NAMESPACE` environment variable.
+	Namespace string
+}
+
+// NewVault returns the provider reading the secrets of the path of the Vault API, the data of the KV
+// version 2 secrets is unwrapped. (example: "secretRef://vault/secret/data/mysql#password")
+func NewVault(config VaultConfig) Provider {
+	return ProviderFunc(func(c context.Context, path string) (string, error) {
+		addr := valueOrEnv(config.Addr, "VAULT_ADDR")
+		if addr == "" {
+			return "", errors.New("vault address is not set")
+		}
+
+		req, err := http.NewRequestWithContext(c, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		req.Header.Set("X-Vault-Token", valueOrEnv(config.Token, "VAULT_TOKEN"))
+		if namespace := valueOrEnv(config.Namespace, "VAULT_NAMESPACE"); namespace != "" {
+			req.Header.Set("X-Vault-Namespace", namespace)
+		}
+
+		var body struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		if err := doJSON(req, &body); err != nil {
+			return "", err
+		}
+
+		data := body.Data
+		if _, ok := data["metadata"]; ok {
+			if inner, ok := data["data"]; ok {
+				if err := json.Unmarshal(inner, &data); err != nil {
+					return "", errors.WithStack(err)
+				}
+			}
+		}
+
+		b, err := json.Marshal(data)
+		return string(b), errors.WithStack(err)
+	})
+}
+
+// GCPConfig is the config of the Google Cloud Secret Manager provider.
+type GCPConfig struct {
+	// Optional. Default value is "https://secretmanager.googleapis.com".
+	Endpoint string
+	// Token returns the OAuth access token of the requests.
+	// Optional. Default value is the token of the service account of the metadata server.
+	Token func(c context.Context) (string, error)
+}
+
+// NewGCP returns the provider accessing the secret version of the path, the latest version if the path
+// has no version. (example: "secretRef://gcp/projects/my-project/secrets/mysql/versions/latest")
+func NewGCP(config GCPConfig) Provider {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+
+	token := config.Token
+	if token == nil {
+		token = (&metadataToken{}).get
+	}
+
+	return ProviderFunc(func(c context.Context, path string) (string, error) {
+		if !strings.Contains(path, "/versions/") {
+			path += "/versions/latest"
+		}
+
+		accessToken, err := token(c)
+		if err != nil {
+			return "", err
+		}
+
+		req, err := http.NewRequestWithContext(c, http.MethodGet, strings.TrimRight(endpoint, "/")+"/v1/"+path+":access", nil)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		var body struct {
+			Payload struct {
+				Data string `json:"data"`
+			} `json:"payload"`
+		}
+		if err := doJSON(req, &body); err != nil {
+			return "", err
+		}
+
+		data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+		return string(data), errors.WithStack(err)
+	})
+}
+
+// metadataToken caches the access token of the metadata server of Google Cloud until it expires.
+type metadataToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (t *metadataToken) get(c context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	host := valueOrEnv("", "GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := doJSON(req, &body); err != nil {
+		return "", errors.Wrap(err, "failed to get the token of the metadata server")
+	}
+
+	// IMPORTANT: Renew the token a minute before it expires.
+	t.token = body.AccessToken
+	t.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+
+	return t.token, nil
+}
+
+func doJSON(req *http.Request, dst interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	return errors.WithStack(json.Unmarshal(b, dst))
+}
+
+func valueOrEnv(value, env string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
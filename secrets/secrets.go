@@ -0,0 +1,315 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package secrets resolves the references to the secrets in the config, like the database credentials,
+// from the secret stores. A reference is written as
+//
+//	secretRef://<provider>/<path>[#<field>]
+//
+// where the provider is "env", "file", "vault", "aws", "gcp" or a provider added with `Register`, and the
+// optional field extracts a field of a JSON secret. (example: "secretRef://aws/prod/mysql#password")
+//
+// The values of `Watch` are re-fetched by `Refresh`, so the connections can be refreshed when the secrets
+// are rotated.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme is the prefix of the references to the secrets.
+const Scheme = "secretRef://"
+
+// Provider fetches the secrets of a secret store.
+type Provider interface {
+	// Fetch returns the secret of the path, the path is the part of the reference after the provider name.
+	Fetch(c context.Context, path string) (string, error)
+}
+
+// ProviderFunc is a function implementing `Provider`.
+type ProviderFunc func(c context.Context, path string) (string, error)
+
+func (f ProviderFunc) Fetch(c context.Context, path string) (string, error) {
+	return f(c, path)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+func init() {
+	Register("env", envProvider{})
+	Register("file", fileProvider{})
+	Configure(Config{})
+}
+
+// Register adds the provider of a name, it replaces the provider of the same name.
+func Register(name string, provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = provider
+}
+
+// Config is the config of the built-in secret stores, the zero values fall back to the standard
+// environment variables of the stores.
+type Config struct {
+	// Optional. Default value is 5m, the interval of `Start` re-fetching the secrets.
+	RefreshInterval time.Duration
+	Vault           VaultConfig
+	AWS             AWSConfig
+	GCP             GCPConfig
+}
+
+// Configure registers the "vault", "aws" and "gcp" providers of the config.
+func Configure(config Config) {
+	Register("vault", NewVault(config.Vault))
+	Register("aws", NewAWS(config.AWS))
+	Register("gcp", NewGCP(config.GCP))
+}
+
+// IsRef returns true if the value is a reference to a secret.
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// Resolve returns the secret of the reference, or the value itself if it's not a reference.
+func Resolve(c context.Context, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+
+	name, path, field, err := parseRef(value)
+	if err != nil {
+		return "", err
+	}
+
+	providersMu.RLock()
+	provider, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return "", errors.Errorf("secrets: unknown provider %q of %s", name, value)
+	}
+
+	secret, err := provider.Fetch(c, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "secrets: failed to fetch %s", value)
+	}
+
+	if field == "" {
+		return secret, nil
+	}
+
+	return jsonField(secret, field, value)
+}
+
+func parseRef(ref string) (name, path, field string, err error) {
+	rest := strings.TrimPrefix(ref, Scheme)
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		rest, field = rest[:i], rest[i+1:]
+	}
+
+	name, path, ok := strings.Cut(rest, "/")
+	if !ok || name == "" || path == "" {
+		return "", "", "", errors.Errorf("secrets: invalid reference %s, it must be %s<provider>/<path>[#<field>]", ref, Scheme)
+	}
+
+	return name, path, field, nil
+}
+
+// jsonField returns a field of a JSON object, the values which are not strings are returned as JSON.
+func jsonField(secret, field, ref string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", errors.Wrapf(err, "secrets: %s is not a JSON object", ref)
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return "", errors.Errorf("secrets: field %q of %s not found", field, ref)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return string(b), nil
+	}
+}
+
+// Value is a secret kept up to date by `Refresh`, the values which are not references never change.
+type Value struct {
+	ref      string
+	mu       sync.RWMutex
+	value    string
+	onChange []func(value string)
+}
+
+var (
+	watchedMu sync.Mutex
+	watched   []*Value
+)
+
+// Watch resolves the value, the secret is re-fetched by `Refresh` if it's a reference.
+func Watch(c context.Context, value string) (*Value, error) {
+	secret, err := Resolve(c, value)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Value{value: secret}
+	if IsRef(value) {
+		v.ref = value
+		watchedMu.Lock()
+		watched = append(watched, v)
+		watchedMu.Unlock()
+	}
+
+	return v, nil
+}
+
+// Static returns the value which is not a reference, as it is.
+func Static(value string) *Value {
+	return &Value{value: value}
+}
+
+// Get returns the current secret.
+func (v *Value) Get() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.value
+}
+
+// Rotating returns true if the value is a reference, which may change on `Refresh`.
+func (v *Value) Rotating() bool {
+	return v.ref != ""
+}
+
+// OnChange adds a function called with the new secret when it changes.
+func (v *Value) OnChange(fn func(value string)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onChange = append(v.onChange, fn)
+}
+
+func (v *Value) set(value string) bool {
+	v.mu.Lock()
+	if v.value == value {
+		v.mu.Unlock()
+		return false
+	}
+	v.value = value
+	onChange := append([]func(string){}, v.onChange...)
+	v.mu.Unlock()
+
+	for _, fn := range onChange {
+		fn(value)
+	}
+	return true
+}
+
+// Refresh re-fetches the secrets of `Watch` and calls the `OnChange` functions of the changed ones. The
+// secrets failing to be fetched keep their previous value.
+func Refresh(c context.Context) error {
+	watchedMu.Lock()
+	values := append([]*Value{}, watched...)
+	watchedMu.Unlock()
+
+	var errs []string
+	for _, v := range values {
+		secret, err := Resolve(c, v.ref)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		v.set(secret)
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Start refreshes the secrets every interval until the returned function is called, the errors are
+// passed to `onError`.
+func Start(interval time.Duration, onError func(err error)) (stop func()) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c, cancelRefresh := context.WithTimeout(ctx, interval)
+				if err := Refresh(c); err != nil && onError != nil {
+					onError(err)
+				}
+				cancelRefresh()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// Watching returns true if any secret is re-fetched by `Refresh`.
+func Watching() bool {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+	return len(watched) > 0
+}
+
+// String hides the secret in the logs.
+func (v *Value) String() string {
+	if v.ref != "" {
+		return v.ref
+	}
+	return "***"
+}
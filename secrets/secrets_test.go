@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	c := context.Background()
+	t.Setenv("BEAN_TEST_SECRET", `{"username":"bean","password":"s3cret","port":3306}`)
+
+	file := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0o600))
+
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "secretRef://env/BEAN_TEST_SECRET#password", want: "s3cret"},
+		{value: "secretRef://env/BEAN_TEST_SECRET#port", want: "3306"},
+		{value: "secretRef://file" + file, want: "from-file"},
+		{value: "secretRef://env/BEAN_TEST_MISSING", err: "environment variable BEAN_TEST_MISSING is not set"},
+		{value: "secretRef://env/BEAN_TEST_SECRET#missing", err: `field "missing"`},
+		{value: "secretRef://unknown/path", err: `unknown provider "unknown"`},
+		{value: "secretRef://env", err: "invalid reference"},
+	}
+
+	for _, tt := range tests {
+		got, err := Resolve(c, tt.value)
+		if tt.err != "" {
+			assert.ErrorContains(t, err, tt.err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
+
+func TestWatchRefresh(t *testing.T) {
+	c := context.Background()
+	current := "v1"
+	Register("test", ProviderFunc(func(c context.Context, path string) (string, error) {
+		return path + "-" + current, nil
+	}))
+
+	static, err := Watch(c, "plain")
+	assert.NoError(t, err)
+	assert.False(t, static.Rotating())
+	assert.Equal(t, "plain", static.Get())
+
+	value, err := Watch(c, "secretRef://test/password")
+	assert.NoError(t, err)
+	assert.True(t, value.Rotating())
+	assert.True(t, Watching())
+	assert.Equal(t, "password-v1", value.Get())
+	assert.Equal(t, "secretRef://test/password", value.String())
+
+	var changes []string
+	value.OnChange(func(v string) { changes = append(changes, v) })
+
+	assert.NoError(t, Refresh(c))
+	assert.Empty(t, changes)
+
+	current = "v2"
+	assert.NoError(t, Refresh(c))
+	assert.Equal(t, []string{"password-v2"}, changes)
+	assert.Equal(t, "password-v2", value.Get())
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/mysql", r.URL.Path)
+		assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		_, _ = io.WriteString(w, `{"data":{"data":{"password":"s3cret"},"metadata":{"version":2}}}`)
+	}))
+	defer srv.Close()
+
+	Register("vault", NewVault(VaultConfig{Addr: srv.URL, Token: "token"}))
+	defer Configure(Config{})
+
+	password, err := Resolve(context.Background(), "secretRef://vault/secret/data/mysql#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", password)
+}
+
+func TestGCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/projects/p/secrets/mysql/versions/latest:access", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		_, _ = io.WriteString(w, `{"payload":{"data":"`+base64.StdEncoding.EncodeToString([]byte("s3cret"))+`"}}`)
+	}))
+	defer srv.Close()
+
+	provider := NewGCP(GCPConfig{Endpoint: srv.URL, Token: func(context.Context) (string, error) {
+		return "token", nil
+	}})
+
+	password, err := provider.Fetch(context.Background(), "projects/p/secrets/mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", password)
+}
+
+func TestAWS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"SecretId":"prod/mysql"}`, string(body))
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/ap-northeast-1/secretsmanager/aws4_request")
+		_, _ = io.WriteString(w, `{"SecretString":"{\"password\":\"s3cret\"}"}`)
+	}))
+	defer srv.Close()
+
+	Register("aws", NewAWS(AWSConfig{
+		Region:   "ap-northeast-1",
+		Endpoint: srv.URL,
+		Credentials: func(context.Context) (AWSCredentials, error) {
+			return AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		},
+	}))
+	defer Configure(Config{})
+
+	password, err := Resolve(context.Background(), "secretRef://aws/prod/mysql#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", password)
+}
+
+// TestSignV4 checks the "get-vanilla" case of the signature version 4 test suite of AWS.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
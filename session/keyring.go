@@ -0,0 +1,233 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// Key is a named secret of a key ring. The AES-256 key is derived from the secret by SHA-256, so the
+// secret can be any random string of 32 characters or more.
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// KeyProvider returns the current keys of a key ring, the first one encrypts and all of them decrypt. It's
+// the hook of a secrets provider, like a secrets manager lookup.
+type KeyProvider func(ctx context.Context) ([]Key, error)
+
+var (
+	// ErrNoKeys is returned if a key ring is given no key.
+	ErrNoKeys = errors.New("session: key ring has no key")
+	// ErrDecrypt is returned if a value isn't encrypted by any key of the ring.
+	ErrDecrypt = errors.New("session: value can't be decrypted")
+)
+
+var keyIDFormat = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var (
+	decryptTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "session_decrypt_total",
+		Help:      "How many session cookies were decrypted, partitioned by key and result (ok, failed). The old keys still in use are not safe to drop yet.",
+	}, []string{"key", "result"})
+
+	metricsOnce sync.Once
+)
+
+// registerMetrics registers the key ring metrics into the default prometheus registry when the first
+// key ring is created, so that they are served by the `/metrics` endpoint.
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		decryptTotal = helpers.RegisterCollector(prometheus.DefaultRegisterer, decryptTotal)
+	})
+}
+
+// KeyRing encrypts the session cookies with its primary key and decrypts them with any of its keys, so
+// that the keys are rotated without logging everyone out:
+//
+//  1. Add the new key after the current one, every replica can now decrypt it.
+//  2. Move the new key first, the cookies are encrypted by it and re-encrypted on their next request.
+//  3. Drop the old key once `bean_session_decrypt_total` doesn't count it anymore, or after the max age.
+//
+// It's safe for concurrent use.
+type KeyRing struct {
+	mu      sync.RWMutex
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyRing returns a key ring of `keys`, the first one is the primary key.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	registerMetrics()
+
+	r := &KeyRing{}
+	if err := r.SetKeys(keys...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// SetKeys replaces the keys of the ring, the first one is the primary key.
+func (r *KeyRing) SetKeys(keys ...Key) error {
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for _, key := range keys {
+		if !keyIDFormat.MatchString(key.ID) {
+			return fmt.Errorf("session: key ID %q must be 1 to 32 characters of [A-Za-z0-9_-]", key.ID)
+		}
+		if key.Secret == "" {
+			return fmt.Errorf("session: key %s has no secret", key.ID)
+		}
+		if _, ok := aeads[key.ID]; ok {
+			return fmt.Errorf("session: key ID %s is duplicated", key.ID)
+		}
+
+		sum := sha256.Sum256([]byte(key.Secret))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		aeads[key.ID] = aead
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.primary = keys[0].ID
+	r.aeads = aeads
+
+	return nil
+}
+
+// Refresh replaces the keys of the ring with the ones of `provider`.
+func (r *KeyRing) Refresh(ctx context.Context, provider KeyProvider) error {
+	keys, err := provider(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.SetKeys(keys...)
+}
+
+// Watch refreshes the keys of the ring from `provider` every `interval` until `ctx` is done, `onError` is
+// called with the failed refreshes and the ring keeps its keys.
+func (r *KeyRing) Watch(ctx context.Context, provider KeyProvider, interval time.Duration, onError func(error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := r.Refresh(ctx, provider); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Primary returns the ID of the key encrypting the values.
+func (r *KeyRing) Primary() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.primary
+}
+
+// Encrypt returns `<key ID>.<base64 of the nonce and the ciphertext>` of `value` encrypted by the primary
+// key. `aad` is authenticated with it, like the cookie name, so that the value can't be moved elsewhere.
+func (r *KeyRing) Encrypt(value, aad []byte) (string, error) {
+	r.mu.RLock()
+	id, aead := r.primary, r.aeads[r.primary]
+	r.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return id + "." + base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, value, aad)), nil
+}
+
+// Decrypt returns the value of `Encrypt` and the ID of the key which encrypted it. It returns `ErrDecrypt`
+// if the key isn't in the ring anymore or the value has been tampered with.
+func (r *KeyRing) Decrypt(encrypted string, aad []byte) ([]byte, string, error) {
+	id, data, ok := strings.Cut(encrypted, ".")
+	if !ok {
+		decryptTotal.WithLabelValues("", "failed").Inc()
+		return nil, "", ErrDecrypt
+	}
+
+	r.mu.RLock()
+	aead := r.aeads[id]
+	r.mu.RUnlock()
+
+	if aead == nil {
+		// The unknown IDs are not counted by their value, which the client controls.
+		decryptTotal.WithLabelValues("", "failed").Inc()
+		return nil, "", ErrDecrypt
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		decryptTotal.WithLabelValues(id, "failed").Inc()
+		return nil, "", ErrDecrypt
+	}
+
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		decryptTotal.WithLabelValues(id, "failed").Inc()
+		return nil, "", ErrDecrypt
+	}
+
+	decryptTotal.WithLabelValues(id, "ok").Inc()
+
+	return value, id, nil
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing(t *testing.T) {
+	ring, err := NewKeyRing(Key{ID: "k1", Secret: "first secret of the session keys"})
+	require.NoError(t, err)
+
+	encrypted, err := ring.Encrypt([]byte("id"), []byte("cookie"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "k1."))
+
+	// Rotate, the old key still decrypts.
+	require.NoError(t, ring.SetKeys(Key{ID: "k2", Secret: "second secret of the session keys"}, Key{ID: "k1", Secret: "first secret of the session keys"}))
+	assert.Equal(t, "k2", ring.Primary())
+
+	ok := testutil.ToFloat64(decryptTotal.WithLabelValues("k1", "ok"))
+	value, keyID, err := ring.Decrypt(encrypted, []byte("cookie"))
+	require.NoError(t, err)
+	assert.Equal(t, "id", string(value))
+	assert.Equal(t, "k1", keyID)
+	assert.Equal(t, ok+1, testutil.ToFloat64(decryptTotal.WithLabelValues("k1", "ok")))
+
+	_, _, err = ring.Decrypt(encrypted, []byte("other"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, _, err = ring.Decrypt(encrypted[:len(encrypted)-2], []byte("cookie"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, _, err = ring.Decrypt("plain", []byte("cookie"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// The dropped key doesn't decrypt anymore.
+	require.NoError(t, ring.Refresh(context.Background(), func(ctx context.Context) ([]Key, error) {
+		return []Key{{ID: "k2", Secret: "second secret of the session keys"}}, nil
+	}))
+	_, _, err = ring.Decrypt(encrypted, []byte("cookie"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	assert.Error(t, ring.Refresh(context.Background(), func(ctx context.Context) ([]Key, error) {
+		return nil, errors.New("secrets provider is down")
+	}))
+	assert.Equal(t, "k2", ring.Primary())
+
+	assert.ErrorIs(t, ring.SetKeys(), ErrNoKeys)
+	assert.Error(t, ring.SetKeys(Key{ID: "k.1", Secret: "s"}))
+	assert.Error(t, ring.SetKeys(Key{ID: "k1"}))
+	assert.Error(t, ring.SetKeys(Key{ID: "k1", Secret: "a"}, Key{ID: "k1", Secret: "b"}))
+}
+
+func TestMiddlewareKeyRing(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	k1 := Key{ID: "k1", Secret: "first secret of the session keys"}
+	k2 := Key{ID: "k2", Secret: "second secret of the session keys"}
+	ring, err := NewKeyRing(k1)
+	require.NoError(t, err)
+
+	store := NewBadgerStore(db, "")
+	e := echo.New()
+	e.Use(Middleware(Config{Store: store, KeyRing: ring}))
+	e.POST("/login", func(c echo.Context) error {
+		if err := Set(c, "userId", 1); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/me", func(c echo.Context) error {
+		s, err := Get(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, s.Get("userId"))
+	})
+
+	serve := func(method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/login")
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, strings.HasPrefix(cookies[0].Value, "k1."))
+
+	id, _, err := ring.Decrypt(cookies[0].Value, []byte("bean_session"))
+	require.NoError(t, err)
+
+	// The plain session ID isn't accepted.
+	rec = serve(http.MethodGet, "/me", &http.Cookie{Name: "bean_session", Value: string(id)})
+	assert.Equal(t, "null\n", rec.Body.String())
+
+	rec = serve(http.MethodGet, "/me", cookies...)
+	assert.Equal(t, "1\n", rec.Body.String())
+	assert.Empty(t, rec.Result().Cookies())
+
+	// After the rotation, the cookie is re-encrypted by the new primary key.
+	require.NoError(t, ring.SetKeys(k2, k1))
+	rec = serve(http.MethodGet, "/me", cookies...)
+	assert.Equal(t, "1\n", rec.Body.String())
+	rotated := rec.Result().Cookies()
+	require.Len(t, rotated, 1)
+	assert.True(t, strings.HasPrefix(rotated[0].Value, "k2."))
+
+	require.NoError(t, ring.SetKeys(k2))
+	rec = serve(http.MethodGet, "/me", rotated...)
+	assert.Equal(t, "1\n", rec.Body.String())
+}
@@ -0,0 +1,387 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package session provides cookie based server side sessions stored in redis or the memory database.
+//
+//	e.Use(session.Middleware(session.Config{Store: session.NewRedisStore(client, "")}))
+//
+//	func (handler *userHandler) Login(c echo.Context) error {
+//		...
+//		// Renew the ID on login to prevent the session fixation.
+//		if err := session.RenewID(c); err != nil {
+//			return err
+//		}
+//		return session.Set(c, "userId", user.ID)
+//	}
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Config defines the config for the session middleware.
+type Config struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Store keeps the session values.
+	// Required.
+	Store Store
+
+	// CookieName is the name of the cookie holding the session ID.
+	// Optional. Default value "bean_session".
+	CookieName string
+
+	// Domain and Path of the cookie.
+	// Optional. Default value "" and "/".
+	Domain string
+	Path   string
+
+	// MaxAge is the lifetime of a session after the last save, or after the last request if `Rolling` is on.
+	// Optional. Default value 24h.
+	MaxAge time.Duration
+
+	// Secure sends the cookie over HTTPS only.
+	// Optional. Default value false.
+	Secure bool
+
+	// HTTPOnly hides the cookie from javascript.
+	// Optional. Default value true.
+	HTTPOnly *bool
+
+	// SameSite is "lax", "strict" or "none".
+	// Optional. Default value "lax".
+	SameSite string
+
+	// Rolling extends the expiry of the session on every request, not only when it is modified.
+	// Optional. Default value false.
+	Rolling bool
+
+	// KeyRing encrypts the session ID of the cookie. A cookie encrypted by an old key of the ring is
+	// re-encrypted by the primary key on its next request.
+	// IMPORTANT: Turning it on ends the sessions of the plain cookies.
+	// Optional. Default value nil. (the cookie holds the plain session ID)
+	KeyRing *KeyRing
+}
+
+// DefaultConfig is the default session middleware config.
+var DefaultConfig = Config{
+	Skipper:    middleware.DefaultSkipper,
+	CookieName: "bean_session",
+	Path:       "/",
+	MaxAge:     24 * time.Hour,
+	SameSite:   "lax",
+}
+
+// ErrNoSession is returned by the helpers if the session middleware is not used for the route.
+var ErrNoSession = errors.New("session: middleware is not configured")
+
+const contextKey = "bean.session"
+
+// Session holds the values of a client between the requests. The values are JSON encoded in the store,
+// so a number is read back as `float64` and a struct as `map[string]interface{}`.
+type Session struct {
+	ID     string
+	Values map[string]interface{}
+
+	state *state
+}
+
+// state is the per-request state shared by the middleware and the helpers.
+type state struct {
+	config    *Config
+	c         echo.Context
+	session   *Session
+	loaded    bool
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldID     string
+	// reencrypt is true if the cookie was encrypted by an old key of the ring.
+	reencrypt bool
+}
+
+// Get returns the value of a key, nil if it doesn't exist.
+func (s *Session) Get(key string) interface{} {
+	return s.Values[key]
+}
+
+// Set sets the value of a key.
+func (s *Session) Set(key string, value interface{}) {
+	s.Values[key] = value
+	s.state.modified = true
+}
+
+// Delete deletes a key.
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+	s.state.modified = true
+}
+
+// Middleware returns a middleware which loads the session of the cookie on the first use of the helpers
+// and saves it right before the response is written.
+func Middleware(config Config) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo: session middleware requires a store")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultConfig.Skipper
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultConfig.CookieName
+	}
+	if config.Path == "" {
+		config.Path = DefaultConfig.Path
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultConfig.MaxAge
+	}
+	if config.SameSite == "" {
+		config.SameSite = DefaultConfig.SameSite
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			st := &state{config: &config, c: c}
+			c.Set(contextKey, st)
+
+			c.Response().Before(func() {
+				if err := st.commit(); err != nil {
+					c.Logger().Error(err)
+				}
+			})
+
+			return next(c)
+		}
+	}
+}
+
+// Get returns the session of the request, a new one if the client doesn't have a valid session.
+func Get(c echo.Context) (*Session, error) {
+	st, ok := c.Get(contextKey).(*state)
+	if !ok {
+		return nil, ErrNoSession
+	}
+
+	if err := st.load(); err != nil {
+		return nil, err
+	}
+
+	return st.session, nil
+}
+
+// Set sets the value of a key in the session of the request.
+func Set(c echo.Context, key string, value interface{}) error {
+	s, err := Get(c)
+	if err != nil {
+		return err
+	}
+
+	s.Set(key, value)
+
+	return nil
+}
+
+// Destroy deletes the session of the request from the store and expires the cookie. (example: logout)
+func Destroy(c echo.Context) error {
+	s, err := Get(c)
+	if err != nil {
+		return err
+	}
+
+	s.state.destroyed = true
+
+	return nil
+}
+
+// RenewID gives the session of the request a new ID while keeping the values. It should be called when
+// the privilege level changes (example: login) to prevent the session fixation.
+func RenewID(c echo.Context) error {
+	s, err := Get(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	if !s.state.isNew && s.state.oldID == "" {
+		s.state.oldID = s.ID
+	}
+	s.ID = id
+	s.state.modified = true
+
+	return nil
+}
+
+func (st *state) load() error {
+	if st.loaded {
+		return nil
+	}
+
+	ctx := st.c.Request().Context()
+
+	if id := st.cookieID(); id != "" {
+		values, err := st.config.Store.Load(ctx, id)
+		if err == nil {
+			st.session = &Session{ID: id, Values: values, state: st}
+			st.loaded = true
+			return nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	// The cookie is missing, expired or forged, start a new session with a new ID.
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	st.session = &Session{ID: id, Values: map[string]interface{}{}, state: st}
+	st.loaded = true
+	st.isNew = true
+
+	return nil
+}
+
+// commit saves or deletes the session and writes the cookie. Nothing is written for a new session without
+// any value so that the anonymous requests don't fill the store.
+func (st *state) commit() error {
+	if !st.loaded {
+		return nil
+	}
+
+	ctx := context.Background()
+	s := st.session
+
+	if st.oldID != "" {
+		if err := st.config.Store.Delete(ctx, st.oldID); err != nil {
+			return err
+		}
+	}
+
+	if st.destroyed {
+		st.c.SetCookie(st.cookie("", -1))
+		if st.isNew {
+			return nil
+		}
+		return st.config.Store.Delete(ctx, s.ID)
+	}
+
+	if st.isNew && len(s.Values) == 0 {
+		return nil
+	}
+
+	if !st.modified && !st.config.Rolling && !st.reencrypt {
+		return nil
+	}
+
+	if err := st.config.Store.Save(ctx, s.ID, s.Values, st.config.MaxAge); err != nil {
+		return err
+	}
+
+	value := s.ID
+	if st.config.KeyRing != nil {
+		encrypted, err := st.config.KeyRing.Encrypt([]byte(s.ID), []byte(st.config.CookieName))
+		if err != nil {
+			return err
+		}
+		value = encrypted
+	}
+
+	st.c.SetCookie(st.cookie(value, int(st.config.MaxAge.Seconds())))
+
+	return nil
+}
+
+// cookieID returns the session ID of the cookie, empty if there isn't any or it can't be decrypted.
+func (st *state) cookieID() string {
+	cookie, err := st.c.Cookie(st.config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+
+	if st.config.KeyRing == nil {
+		return cookie.Value
+	}
+
+	id, keyID, err := st.config.KeyRing.Decrypt(cookie.Value, []byte(st.config.CookieName))
+	if err != nil {
+		return ""
+	}
+	st.reencrypt = keyID != st.config.KeyRing.Primary()
+
+	return string(id)
+}
+
+func (st *state) cookie(value string, maxAge int) *http.Cookie {
+	httpOnly := st.config.HTTPOnly == nil || *st.config.HTTPOnly
+
+	return &http.Cookie{
+		Name:     st.config.CookieName,
+		Value:    value,
+		Domain:   st.config.Domain,
+		Path:     st.config.Path,
+		MaxAge:   maxAge,
+		Secure:   st.config.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(st.config.SameSite),
+	}
+}
+
+func sameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// newID returns a random session ID of 256 bits.
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,107 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	e.Use(Middleware(Config{Store: NewBadgerStore(db, "")}))
+	e.POST("/login", func(c echo.Context) error {
+		if err := RenewID(c); err != nil {
+			return err
+		}
+		if err := Set(c, "userId", 1); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/me", func(c echo.Context) error {
+		s, err := Get(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, s.Get("userId"))
+	})
+	e.POST("/logout", func(c echo.Context) error {
+		if err := Destroy(c); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// An anonymous request doesn't create a session.
+	rec := serve(http.MethodGet, "/me")
+	assert.Equal(t, "null\n", rec.Body.String())
+	assert.Empty(t, rec.Result().Cookies())
+
+	rec = serve(http.MethodPost, "/login")
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "bean_session", cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	}
+
+	rec = serve(http.MethodGet, "/me", cookies...)
+	assert.Equal(t, "1\n", rec.Body.String())
+
+	rec = serve(http.MethodPost, "/logout", cookies...)
+	if assert.Len(t, rec.Result().Cookies(), 1) {
+		assert.True(t, rec.Result().Cookies()[0].MaxAge < 0)
+	}
+
+	rec = serve(http.MethodGet, "/me", cookies...)
+	assert.Equal(t, "null\n", rec.Body.String())
+}
+
+func TestGetWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	_, err := Get(c)
+	assert.ErrorIs(t, err, ErrNoSession)
+}
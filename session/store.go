@@ -0,0 +1,195 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+// ErrNotFound is returned by a store if the session doesn't exist or has expired.
+var ErrNotFound = errors.New("session: not found")
+
+// Store keeps the session values.
+type Store interface {
+	Load(ctx context.Context, id string) (map[string]interface{}, error)
+	Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// RedisStore stores the sessions in redis under `<prefix><id>`.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore returns a redis store, the prefix is "session:" if `prefix` is empty.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "session:"
+	}
+
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Load implements `Store`.
+func (s *RedisStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeValues(data)
+}
+
+// Save implements `Store`.
+func (s *RedisStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.prefix+id, data, ttl).Err()
+}
+
+// Delete implements `Store`.
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id).Err()
+}
+
+// BadgerStore stores the sessions in the memory database. The sessions are not shared between the
+// replicas, so it is only suitable for a single instance or as a fallback without redis.
+type BadgerStore struct {
+	db     *badger.DB
+	prefix string
+}
+
+// NewBadgerStore returns a memory database store, the prefix is "session:" if `prefix` is empty.
+func NewBadgerStore(db *badger.DB, prefix string) *BadgerStore {
+	if prefix == "" {
+		prefix = "session:"
+	}
+
+	return &BadgerStore{db: db, prefix: prefix}
+}
+
+// Load implements `Store`.
+func (s *BadgerStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	var data []byte
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(s.prefix + id))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeValues(data)
+}
+
+// Save implements `Store`.
+func (s *BadgerStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(s.prefix+id), data).WithTTL(ttl))
+	})
+}
+
+// Delete implements `Store`.
+func (s *BadgerStore) Delete(ctx context.Context, id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(s.prefix + id))
+	})
+}
+
+// KVStore stores the sessions in the local key value database of any engine. Like `BadgerStore`, the
+// sessions are not shared between the replicas.
+type KVStore struct {
+	kv     dbdrivers.KV
+	prefix string
+}
+
+// NewKVStore returns a local key value database store, the prefix is "session:" if `prefix` is empty.
+func NewKVStore(kv dbdrivers.KV, prefix string) *KVStore {
+	if prefix == "" {
+		prefix = "session:"
+	}
+
+	return &KVStore{kv: kv, prefix: prefix}
+}
+
+// Load implements `Store`.
+func (s *KVStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	data, err := s.kv.Get(s.prefix + id)
+	if errors.Is(err, dbdrivers.ErrKVNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeValues(data)
+}
+
+// Save implements `Store`.
+func (s *KVStore) Save(ctx context.Context, id string, values map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(s.prefix+id, data, ttl)
+}
+
+// Delete implements `Store`.
+func (s *KVStore) Delete(ctx context.Context, id string) error {
+	return s.kv.Delete(s.prefix + id)
+}
+
+func decodeValues(data []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
@@ -0,0 +1,529 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package shutdown stops the subsystems of the server in dependency order: stop the intake of new work
+// (http server, consumers, schedulers), drain the workers, flush the logs and the metrics then close the
+// databases. Every stage has its own timeout so that a stuck component doesn't eat the time of the next
+// stages, and the report tells which components didn't stop cleanly.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage is the step of the shutdown in which a component stops, the stages run one after another.
+type Stage int
+
+const (
+	// StageIntake stops accepting new work. (example: the http server, the consumers, the schedulers)
+	StageIntake Stage = iota
+	// StageDrain waits for the work in progress. (example: the goroutine pools, the workers)
+	StageDrain
+	// StageFlush flushes the buffered data. (example: the logs, the metrics, the sentry events)
+	StageFlush
+	// StageClose closes the connections. (example: the database pools, the log files)
+	StageClose
+)
+
+var stageNames = []string{"intake", "drain", "flush", "close"}
+
+func (s Stage) String() string {
+	if s < StageIntake || s > StageClose {
+		return fmt.Sprintf("stage(%d)", int(s))
+	}
+	return stageNames[s]
+}
+
+// ParseStage returns the stage of the name, "intake", "drain", "flush" or "close".
+func ParseStage(name string) (Stage, error) {
+	for i, n := range stageNames {
+		if strings.EqualFold(name, n) {
+			return Stage(i), nil
+		}
+	}
+	return 0, fmt.Errorf("shutdown: unknown stage %q", name)
+}
+
+// DefaultStageTimeout is the timeout of a stage which is not set by `SetTimeout`.
+const DefaultStageTimeout = 10 * time.Second
+
+var (
+	// ErrStarted is returned by `Register` once the shutdown has started.
+	ErrStarted = errors.New("shutdown: already started")
+	// ErrCycle is returned by `Plan` when the dependencies of the components form a cycle.
+	ErrCycle = errors.New("shutdown: dependency cycle")
+)
+
+// Component is a subsystem stopped by the orchestrator.
+type Component struct {
+	// Required.
+	Name string
+
+	// Stage in which the component stops.
+	// Optional. Default value `StageIntake`.
+	Stage Stage
+
+	// DependsOn are the names of the components used by this component, they stop after it. A dependency
+	// must be in the same or a later stage, an unknown name is ignored so that a component can depend on
+	// an optional one.
+	// Optional. Default value nil.
+	DependsOn []string
+
+	// Stop stops the component, it must return when `ctx` is done.
+	// Required.
+	Stop func(ctx context.Context) error
+}
+
+// Result is how a component stopped.
+type Result struct {
+	Name     string
+	Stage    Stage
+	Duration time.Duration
+	// Err is the error returned by `Stop`, the recovered panic or the error of the context if it timed out.
+	Err error
+	// TimedOut is true if `Stop` didn't return before the timeout of the stage, it may still be running.
+	TimedOut bool
+}
+
+// Report is the result of a shutdown.
+type Report struct {
+	Results  []Result
+	Duration time.Duration
+	// Err is the error of `Plan`, the shutdown still stops all the components stage by stage.
+	Err error
+}
+
+// Failed returns the results of the components which didn't stop cleanly.
+func (r Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Clean returns true if all the components stopped without an error.
+func (r Report) Clean() bool {
+	return r.Err == nil && len(r.Failed()) == 0
+}
+
+func (r Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "shutdown: %d components stopped in %s", len(r.Results), r.Duration.Round(time.Millisecond))
+	if r.Err != nil {
+		fmt.Fprintf(&sb, ", %v", r.Err)
+	}
+	for _, result := range r.Failed() {
+		state := "failed"
+		if result.TimedOut {
+			state = "timed out"
+		}
+		fmt.Fprintf(&sb, "; %s/%s %s after %s: %v", result.Stage, result.Name, state, result.Duration.Round(time.Millisecond), result.Err)
+	}
+	return sb.String()
+}
+
+// Orchestrator stops the registered components stage by stage. Within a stage the components stop in
+// waves, a component stops once all the components depending on it are stopped and the components of
+// the same wave stop concurrently.
+type Orchestrator struct {
+	mu         sync.Mutex
+	components map[string]Component
+	timeouts   map[Stage]time.Duration
+	started    bool
+	done       chan struct{}
+	report     Report
+	children   map[string]*Orchestrator
+}
+
+// New returns an empty orchestrator.
+func New() *Orchestrator {
+	return &Orchestrator{
+		components: make(map[string]Component),
+		timeouts:   make(map[Stage]time.Duration),
+		done:       make(chan struct{}),
+		children:   make(map[string]*Orchestrator),
+	}
+}
+
+// Register adds the component, a component of the same name is replaced.
+func (o *Orchestrator) Register(component Component) error {
+	if component.Name == "" {
+		return errors.New("shutdown: component name is required")
+	}
+	if component.Stop == nil {
+		return fmt.Errorf("shutdown: component %q has no stop function", component.Name)
+	}
+	if component.Stage < StageIntake || component.Stage > StageClose {
+		return fmt.Errorf("shutdown: component %q has an unknown %s", component.Name, component.Stage)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.started {
+		return ErrStarted
+	}
+	o.components[component.Name] = component
+
+	return nil
+}
+
+// Unregister removes the component. (example: a consumer which is stopped before the shutdown)
+func (o *Orchestrator) Unregister(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.components, name)
+}
+
+// SetTimeout sets how long the components of the stage have to stop, a non-positive timeout restores
+// `DefaultStageTimeout`.
+func (o *Orchestrator) SetTimeout(stage Stage, timeout time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if timeout <= 0 {
+		delete(o.timeouts, stage)
+		return
+	}
+	o.timeouts[stage] = timeout
+}
+
+// Attach stops the components of `child` with the components of the orchestrator, their names prefixed by
+// `prefix`, like the components of the bean instances of a process which would collide otherwise. The
+// dependencies between the components of the child are kept and a component of the orchestrator depending
+// on a name of the child, like "http", depends on the prefixed component of every child. The stages use
+// the timeouts of the orchestrator. A child shut down on its own before is skipped.
+func (o *Orchestrator) Attach(prefix string, child *Orchestrator) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.started {
+		return ErrStarted
+	}
+	o.children[prefix] = child
+
+	return nil
+}
+
+// Detach removes the child attached with `prefix`.
+func (o *Orchestrator) Detach(prefix string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.children, prefix)
+}
+
+// Plan returns the names of the components of every stop wave in order. The waves of a stage which can't
+// be ordered, because of `ErrCycle` or a dependency in an earlier stage, are returned with the error.
+func (o *Orchestrator) Plan() ([][]string, error) {
+	o.mu.Lock()
+	components, _ := o.merge(false)
+	o.mu.Unlock()
+
+	waves, _, err := plan(components)
+	return waves, err
+}
+
+// Shutdown stops all the components and returns the report. It runs once, the next calls wait for the
+// first one and return its report.
+func (o *Orchestrator) Shutdown(ctx context.Context) Report {
+	o.mu.Lock()
+	if o.started {
+		o.mu.Unlock()
+		select {
+		case <-o.done:
+		case <-ctx.Done():
+			return Report{Err: ctx.Err()}
+		}
+		return o.report
+	}
+	o.started = true
+	components, claimed := o.merge(true)
+	timeouts := make(map[Stage]time.Duration, len(o.timeouts))
+	for stage, timeout := range o.timeouts {
+		timeouts[stage] = timeout
+	}
+	o.mu.Unlock()
+
+	start := time.Now()
+	waves, stages, err := plan(components)
+	report := Report{Err: err}
+
+	for stage := StageIntake; stage <= StageClose; stage++ {
+		timeout, ok := timeouts[stage]
+		if !ok {
+			timeout = DefaultStageTimeout
+		}
+
+		stageCtx, cancel := context.WithTimeout(ctx, timeout)
+		for i, wave := range waves {
+			if stages[i] != stage {
+				continue
+			}
+			// IMPORTANT: The waves after a timed out one are still called with the done context, so that
+			// they can release what doesn't need to wait. (example: closing the files)
+			report.Results = append(report.Results, stopWave(stageCtx, components, wave)...)
+		}
+		cancel()
+	}
+
+	report.Duration = time.Since(start)
+
+	o.mu.Lock()
+	o.report = report
+	o.mu.Unlock()
+	close(o.done)
+
+	// The children shut down with the orchestrator report their own components.
+	for prefix, child := range claimed {
+		childReport := Report{Duration: report.Duration, Err: report.Err}
+		for _, result := range report.Results {
+			if strings.HasPrefix(result.Name, prefix) {
+				childReport.Results = append(childReport.Results, result)
+			}
+		}
+
+		child.mu.Lock()
+		child.report = childReport
+		child.mu.Unlock()
+		close(child.done)
+	}
+
+	return report
+}
+
+// merge returns the components of the orchestrator and of its children not shut down yet, the children are
+// marked as started if `claim` is true. `o.mu` must be held.
+func (o *Orchestrator) merge(claim bool) (map[string]Component, map[string]*Orchestrator) {
+	components := make(map[string]Component, len(o.components))
+	for name, component := range o.components {
+		components[name] = component
+	}
+
+	claimed := make(map[string]*Orchestrator)
+	prefixed := make(map[string][]string)
+	for prefix, child := range o.children {
+		child.mu.Lock()
+		if child.started {
+			child.mu.Unlock()
+			continue
+		}
+		if claim {
+			child.started = true
+			claimed[prefix] = child
+		}
+
+		for name, component := range child.components {
+			component.Name = prefix + name
+			dependsOn := make([]string, len(component.DependsOn))
+			for i, dep := range component.DependsOn {
+				if _, ok := child.components[dep]; ok {
+					dep = prefix + dep
+				}
+				dependsOn[i] = dep
+			}
+			component.DependsOn = dependsOn
+
+			components[component.Name] = component
+			prefixed[name] = append(prefixed[name], component.Name)
+		}
+		child.mu.Unlock()
+	}
+
+	for name := range o.components {
+		component := components[name]
+		var dependsOn []string
+		for _, dep := range component.DependsOn {
+			dependsOn = append(dependsOn, prefixed[dep]...)
+		}
+		if len(dependsOn) > 0 {
+			component.DependsOn = append(append([]string(nil), component.DependsOn...), dependsOn...)
+			components[name] = component
+		}
+	}
+
+	return components, claimed
+}
+
+func stopWave(ctx context.Context, components map[string]Component, wave []string) []Result {
+	results := make([]Result, len(wave))
+
+	var wg sync.WaitGroup
+	for i, name := range wave {
+		wg.Add(1)
+		go func(i int, component Component) {
+			defer wg.Done()
+			results[i] = stop(ctx, component)
+		}(i, components[name])
+	}
+	wg.Wait()
+
+	return results
+}
+
+func stop(ctx context.Context, component Component) Result {
+	start := time.Now()
+	result := Result{Name: component.Name, Stage: component.Stage}
+
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errc <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		errc <- component.Stop(ctx)
+	}()
+
+	select {
+	case result.Err = <-errc:
+	case <-ctx.Done():
+		result.Err = ctx.Err()
+		result.TimedOut = true
+	}
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+// plan orders the components into waves and returns the stage of every wave.
+func plan(components map[string]Component) ([][]string, []Stage, error) {
+	var (
+		waves  [][]string
+		stages []Stage
+		errs   []string
+		cycle  bool
+	)
+
+	for stage := StageIntake; stage <= StageClose; stage++ {
+		// The number of the components of the stage depending on a component, which must stop first.
+		dependents := make(map[string]int)
+		var pending []string
+		for name, component := range components {
+			if component.Stage != stage {
+				continue
+			}
+			pending = append(pending, name)
+			if _, ok := dependents[name]; !ok {
+				dependents[name] = 0
+			}
+			for _, dep := range component.DependsOn {
+				d, ok := components[dep]
+				if !ok || d.Stage > stage {
+					continue
+				}
+				if d.Stage < stage {
+					errs = append(errs, fmt.Sprintf("%s (%s) depends on %s which stops earlier (%s)", name, stage, dep, d.Stage))
+					continue
+				}
+				dependents[dep]++
+			}
+		}
+		sort.Strings(pending)
+
+		for len(pending) > 0 {
+			var wave, rest []string
+			for _, name := range pending {
+				if dependents[name] == 0 {
+					wave = append(wave, name)
+				} else {
+					rest = append(rest, name)
+				}
+			}
+
+			if len(wave) == 0 {
+				// Stop the components of the cycle together rather than not at all.
+				errs = append(errs, fmt.Sprintf("cycle of %s in %s", strings.Join(rest, ", "), stage))
+				cycle = true
+				wave, rest = rest, nil
+			}
+
+			for _, name := range wave {
+				for _, dep := range components[name].DependsOn {
+					if d, ok := components[dep]; ok && d.Stage == stage {
+						dependents[dep]--
+					}
+				}
+			}
+
+			waves = append(waves, wave)
+			stages = append(stages, stage)
+			pending = rest
+		}
+	}
+
+	if cycle {
+		return waves, stages, fmt.Errorf("%w: %s", ErrCycle, strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		return waves, stages, fmt.Errorf("shutdown: %s", strings.Join(errs, "; "))
+	}
+
+	return waves, stages, nil
+}
+
+var defaultOrchestrator = New()
+
+// Register adds the component to the default orchestrator.
+func Register(component Component) error {
+	return defaultOrchestrator.Register(component)
+}
+
+// Attach attaches the child orchestrator to the default orchestrator.
+func Attach(prefix string, child *Orchestrator) error {
+	return defaultOrchestrator.Attach(prefix, child)
+}
+
+// Detach detaches the child orchestrator from the default orchestrator.
+func Detach(prefix string) {
+	defaultOrchestrator.Detach(prefix)
+}
+
+// Unregister removes the component from the default orchestrator.
+func Unregister(name string) {
+	defaultOrchestrator.Unregister(name)
+}
+
+// SetTimeout sets the timeout of the stage of the default orchestrator.
+func SetTimeout(stage Stage, timeout time.Duration) {
+	defaultOrchestrator.SetTimeout(stage, timeout)
+}
+
+// Plan returns the stop waves of the default orchestrator.
+func Plan() ([][]string, error) {
+	return defaultOrchestrator.Plan()
+}
+
+// Shutdown stops the components of the default orchestrator.
+func Shutdown(ctx context.Context) Report {
+	return defaultOrchestrator.Shutdown(ctx)
+}
@@ -0,0 +1,161 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		stopped []string
+	)
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	o := New()
+	require.NoError(t, o.Register(Component{Name: "logs", Stage: StageClose, Stop: record("logs")}))
+	require.NoError(t, o.Register(Component{Name: "mysql", Stage: StageClose, DependsOn: []string{"logs"}, Stop: record("mysql")}))
+	require.NoError(t, o.Register(Component{Name: "pool", Stage: StageDrain, DependsOn: []string{"mysql"}, Stop: record("pool")}))
+	require.NoError(t, o.Register(Component{Name: "consumer", DependsOn: []string{"http", "pool", "optional"}, Stop: record("consumer")}))
+	require.NoError(t, o.Register(Component{Name: "http", Stop: record("http")}))
+	require.NoError(t, o.Register(Component{Name: "metrics", Stage: StageFlush, Stop: record("metrics")}))
+
+	waves, err := o.Plan()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"consumer"}, {"http"}, {"pool"}, {"metrics"}, {"mysql"}, {"logs"}}, waves)
+
+	report := o.Shutdown(context.Background())
+	assert.True(t, report.Clean())
+	assert.Equal(t, []string{"consumer", "http", "pool", "metrics", "mysql", "logs"}, stopped)
+	assert.Len(t, report.Results, 6)
+
+	// The next calls return the same report without stopping the components again.
+	assert.Equal(t, report, o.Shutdown(context.Background()))
+	assert.Len(t, stopped, 6)
+	assert.ErrorIs(t, o.Register(Component{Name: "late", Stop: record("late")}), ErrStarted)
+}
+
+func TestShutdownReport(t *testing.T) {
+	o := New()
+	o.SetTimeout(StageDrain, 20*time.Millisecond)
+
+	block := make(chan struct{})
+	defer close(block)
+	require.NoError(t, o.Register(Component{Name: "stuck", Stage: StageDrain, Stop: func(context.Context) error {
+		<-block
+		return nil
+	}}))
+	require.NoError(t, o.Register(Component{Name: "after", Stage: StageDrain, DependsOn: []string{"stuck"}, Stop: func(context.Context) error { return nil }}))
+	require.NoError(t, o.Register(Component{Name: "failing", Stage: StageFlush, Stop: func(context.Context) error { return errors.New("broken pipe") }}))
+	require.NoError(t, o.Register(Component{Name: "panicking", Stage: StageClose, Stop: func(context.Context) error { panic("boom") }}))
+
+	var closeErr error
+	require.NoError(t, o.Register(Component{Name: "db", Stage: StageClose, Stop: func(c context.Context) error {
+		closeErr = c.Err()
+		return nil
+	}}))
+
+	report := o.Shutdown(context.Background())
+	assert.False(t, report.Clean())
+	assert.NoError(t, closeErr, "the next stage has its own timeout")
+
+	failed := report.Failed()
+	require.Len(t, failed, 3)
+	assert.Equal(t, "stuck", failed[0].Name)
+	assert.True(t, failed[0].TimedOut)
+	assert.ErrorIs(t, failed[0].Err, context.DeadlineExceeded)
+	assert.Equal(t, "failing", failed[1].Name)
+	assert.Equal(t, "panicking", failed[2].Name)
+	assert.EqualError(t, failed[2].Err, "panic: boom")
+
+	assert.Contains(t, report.String(), "drain/stuck timed out")
+	assert.Contains(t, report.String(), "flush/failing failed")
+}
+
+func TestPlanErrors(t *testing.T) {
+	noop := func(context.Context) error { return nil }
+
+	o := New()
+	require.NoError(t, o.Register(Component{Name: "a", DependsOn: []string{"b"}, Stop: noop}))
+	require.NoError(t, o.Register(Component{Name: "b", DependsOn: []string{"a"}, Stop: noop}))
+	waves, err := o.Plan()
+	assert.ErrorIs(t, err, ErrCycle)
+	assert.Equal(t, [][]string{{"a", "b"}}, waves)
+
+	o = New()
+	require.NoError(t, o.Register(Component{Name: "db", Stage: StageClose, DependsOn: []string{"http"}, Stop: noop}))
+	require.NoError(t, o.Register(Component{Name: "http", Stop: noop}))
+	_, err = o.Plan()
+	assert.EqualError(t, err, "shutdown: db (close) depends on http which stops earlier (intake)")
+
+	assert.Error(t, o.Register(Component{Name: "nameless"}))
+	assert.Error(t, o.Register(Component{Stop: noop}))
+	assert.Error(t, o.Register(Component{Name: "x", Stage: Stage(9), Stop: noop}))
+
+	stage, err := ParseStage("Flush")
+	assert.NoError(t, err)
+	assert.Equal(t, StageFlush, stage)
+	_, err = ParseStage("later")
+	assert.Error(t, err)
+}
+
+func TestAttach(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		stopped []string
+	)
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	o := New()
+	require.NoError(t, o.Register(Component{Name: "logs", Stage: StageClose, Stop: record("logs")}))
+	require.NoError(t, o.Register(Component{Name: "longpoll", DependsOn: []string{"http"}, Stop: record("longpoll")}))
+
+	// Two instances registering the same names.
+	children := map[string]*Orchestrator{"a/": New(), "b/": New(), "c/": New()}
+	for prefix, child := range children {
+		require.NoError(t, child.Register(Component{Name: "http", Stop: record(prefix + "http")}))
+		require.NoError(t, child.Register(Component{Name: "databases", Stage: StageClose, DependsOn: []string{"logs"}, Stop: record(prefix + "databases")}))
+		require.NoError(t, o.Attach(prefix, child))
+	}
+
+	// A child stopped on its own is not stopped again.
+	children["c/"].Shutdown(context.Background())
+	mu.Lock()
+	stopped = nil
+	mu.Unlock()
+
+	waves, err := o.Plan()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"longpoll"}, {"a/http", "b/http"}, {"a/databases", "b/databases"}, {"logs"}}, waves)
+
+	report := o.Shutdown(context.Background())
+	assert.True(t, report.Clean())
+	assert.Len(t, stopped, 6)
+	assert.Equal(t, "longpoll", stopped[0])
+	assert.Equal(t, "logs", stopped[5])
+
+	childReport := children["a/"].Shutdown(context.Background())
+	require.Len(t, childReport.Results, 2)
+	assert.ErrorIs(t, children["a/"].Register(Component{Name: "late", Stop: record("late")}), ErrStarted)
+	assert.ErrorIs(t, o.Attach("d/", New()), ErrStarted)
+}
@@ -0,0 +1,410 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GCSConfig defines the config for `NewGCS`.
+type GCSConfig struct {
+	// Bucket of the files.
+	// Required.
+	Bucket string
+
+	// CredentialsFile is the JSON key file of a service account. The signed URLs require it.
+	// Optional. Default value the `GOOGLE_APPLICATION_CREDENTIALS` environment variable, or the service
+	// account of the metadata server if it's not set either.
+	CredentialsFile string
+
+	// Endpoint of the Cloud Storage API, like the one of an emulator.
+	// Optional. Default value "https://storage.googleapis.com".
+	Endpoint string
+}
+
+// GCS stores the files in a Cloud Storage bucket through the JSON API.
+type GCS struct {
+	client *http.Client
+	config GCSConfig
+
+	// The service account signing the URLs and the tokens, nil without `CredentialsFile`.
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURI    string
+}
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// NewGCS returns a Cloud Storage filesystem. If `client` is nil, the requests are authorized by the
+// service account of `CredentialsFile` or of the metadata server.
+func NewGCS(client *http.Client, config GCSConfig) (*GCS, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("storage: gcs bucket is empty")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://storage.googleapis.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	if config.CredentialsFile == "" {
+		config.CredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	g := &GCS{client: client, config: config}
+
+	if config.CredentialsFile != "" {
+		data, err := os.ReadFile(config.CredentialsFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := g.parseKey(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.client == nil {
+		g.client = &http.Client{Transport: &gcsTransport{
+			base:    http.DefaultTransport,
+			fetch:   g.fetchToken,
+			refresh: time.Minute,
+		}}
+	}
+
+	return g, nil
+}
+
+// Put implements `Filesystem`. The content is streamed by a multipart upload with its metadata.
+func (g *GCS) Put(c context.Context, key string, r io.Reader, opts PutOptions) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	metadata, err := json.Marshal(map[string]string{
+		"name":         key,
+		"contentType":  contentType,
+		"cacheControl": opts.CacheControl,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(func() error {
+			part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+			if err != nil {
+				return err
+			}
+			if _, err := part.Write(metadata); err != nil {
+				return err
+			}
+
+			part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, r); err != nil {
+				return err
+			}
+
+			return mw.Close()
+		}())
+	}()
+
+	u := g.config.Endpoint + "/upload/storage/v1/b/" + url.PathEscape(g.config.Bucket) + "/o?uploadType=multipart"
+	req, err := http.NewRequestWithContext(c, http.MethodPost, u, pr)
+	if err != nil {
+		pr.Close()
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+
+	resp, err := g.do(req, key)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// gcsObject is an object of the JSON API.
+type gcsObject struct {
+	Name        string    `json:"name"`
+	Size        string    `json:"size"`
+	ContentType string    `json:"contentType"`
+	Updated     time.Time `json:"updated"`
+	ETag        string    `json:"etag"`
+}
+
+func (o gcsObject) info() FileInfo {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	return FileInfo{Key: o.Name, Size: size, ContentType: o.ContentType, ModTime: o.Updated, ETag: o.ETag}
+}
+
+// Get implements `Filesystem`.
+func (g *GCS) Get(c context.Context, key string) (File, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var object gcsObject
+	if err := g.doJSON(c, http.MethodGet, g.objectURL(key), key, &object); err != nil {
+		return nil, err
+	}
+
+	return &remoteFile{c: c, info: object.info(), open: func(c context.Context, offset int64) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(c, http.MethodGet, g.objectURL(key)+"?alt=media", nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		}
+
+		resp, err := g.do(req, key)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}}, nil
+}
+
+// Delete implements `Filesystem`.
+func (g *GCS) Delete(c context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = g.doJSON(c, http.MethodDelete, g.objectURL(key), key, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// List implements `Filesystem`.
+func (g *GCS) List(c context.Context, prefix string) ([]FileInfo, error) {
+	var infos []FileInfo
+
+	query := url.Values{"prefix": {prefix}}
+	for {
+		var result struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		u := g.config.Endpoint + "/storage/v1/b/" + url.PathEscape(g.config.Bucket) + "/o?" + query.Encode()
+		if err := g.doJSON(c, http.MethodGet, u, prefix, &result); err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Items {
+			infos = append(infos, object.info())
+		}
+
+		if result.NextPageToken == "" {
+			return infos, nil
+		}
+		query.Set("pageToken", result.NextPageToken)
+	}
+}
+
+// SignedURL implements `Filesystem`, the URL is a V4 signed `GET` URL valid up to 7 days. It requires
+// the key of a service account in `CredentialsFile`.
+func (g *GCS) SignedURL(c context.Context, key string, expires time.Duration) (string, error) {
+	if g.privateKey == nil {
+		return "", errors.New("storage: gcs signed URL requires the key of a service account")
+	}
+
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(g.config.Endpoint)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now().UTC()
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+	escapedPath := "/" + s3Escape(g.config.Bucket) + "/" + s3Escape(key)
+
+	query := map[string]string{
+		"X-Goog-Algorithm":     "GOOG4-RSA-SHA256",
+		"X-Goog-Credential":    g.clientEmail + "/" + scope,
+		"X-Goog-Date":          now.Format("20060102T150405Z"),
+		"X-Goog-Expires":       strconv.Itoa(int(expires / time.Second)),
+		"X-Goog-SignedHeaders": "host",
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = url.QueryEscape(name) + "=" + strings.ReplaceAll(url.QueryEscape(query[name]), "+", "%20")
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		escapedPath,
+		canonicalQuery,
+		"host:" + endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "GOOG4-RSA-SHA256\n" + query["X-Goog-Date"] + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return endpoint.Scheme + "://" + endpoint.Host + escapedPath + "?" + canonicalQuery +
+		"&X-Goog-Signature=" + hex.EncodeToString(signature), nil
+}
+
+// parseKey reads the email and the private key of a service account key file.
+func (g *GCS) parseKey(data []byte) error {
+	var account struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return errors.WithStack(err)
+	}
+	if account.Type != "service_account" {
+		return errors.Errorf("storage: gcs credentials of type %q are not supported, use a service account key", account.Type)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return errors.New("storage: gcs service account has no PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("storage: gcs service account key is not RSA")
+	}
+
+	g.clientEmail = account.ClientEmail
+	g.privateKey = rsaKey
+	g.tokenURI = account.TokenURI
+
+	return nil
+}
+
+func (g *GCS) objectURL(key string) string {
+	return g.config.Endpoint + "/storage/v1/b/" + url.PathEscape(g.config.Bucket) + "/o/" + url.PathEscape(key)
+}
+
+// do sends the request and returns the response if its status is successful.
+func (g *GCS) do(req *http.Request, key string) (*http.Response, error) {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, errors.Errorf("storage: gcs %s %s failed with %s: %s", req.Method, key, resp.Status, data)
+	}
+
+	return resp, nil
+}
+
+func (g *GCS) doJSON(c context.Context, method, u, key string, v interface{}) error {
+	req, err := http.NewRequestWithContext(c, method, u, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := g.do(req, key)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		return nil
+	}
+
+	return errors.WithStack(json.NewDecoder(resp.Body).Decode(v))
+}
@@ -0,0 +1,147 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// The token of the default service account of the metadata server on GCE, GKE, Cloud Run, etc.
+const gcsMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcsToken is an OAuth2 access token of the Google APIs.
+type gcsToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// fetchToken exchanges a JWT signed by the service account for an access token, or gets the token of
+// the metadata server if there is no service account key.
+func (g *GCS) fetchToken(c context.Context) (gcsToken, error) {
+	var req *http.Request
+	var err error
+
+	if g.privateKey != nil {
+		now := time.Now()
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   g.clientEmail,
+			"scope": gcsScope,
+			"aud":   g.tokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}).SignedString(g.privateKey)
+		if err != nil {
+			return gcsToken{}, errors.WithStack(err)
+		}
+
+		form := url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		req, err = http.NewRequestWithContext(c, http.MethodPost, g.tokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return gcsToken{}, errors.WithStack(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequestWithContext(c, http.MethodGet, gcsMetadataTokenURL, nil)
+		if err != nil {
+			return gcsToken{}, errors.WithStack(err)
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gcsToken{}, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return gcsToken{}, errors.Errorf("storage: gcs token request failed with %s: %s", resp.Status, data)
+	}
+
+	var token gcsToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return gcsToken{}, errors.WithStack(err)
+	}
+
+	return token, nil
+}
+
+// gcsTransport authorizes the requests with an access token, fetched again `refresh` before it expires.
+type gcsTransport struct {
+	base    http.RoundTripper
+	fetch   func(c context.Context) (gcsToken, error)
+	refresh time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (t *gcsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.accessToken(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// A `RoundTripper` must not modify the request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *gcsTransport) accessToken(c context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Add(t.refresh).Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	token, err := t.fetch(c)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = token.AccessToken
+	t.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return t.token, nil
+}
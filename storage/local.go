@@ -0,0 +1,305 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// LocalConfig defines the config for `NewLocal`.
+type LocalConfig struct {
+	// Root is the directory of the files.
+	// Required.
+	Root string
+
+	// BaseURL is where `LocalHandler` is served, like "https://example.com/files".
+	// Required for the signed URLs.
+	BaseURL string
+
+	// SigningKey signs the URLs.
+	// Required for the signed URLs.
+	SigningKey string
+}
+
+// Local stores the files under a directory of the local disk.
+type Local struct {
+	config LocalConfig
+}
+
+// The files being written are kept in this directory of the root until they are complete.
+const localTempDir = ".tmp"
+
+// NewLocal returns a local filesystem, the root directory is created if it doesn't exist.
+func NewLocal(config LocalConfig) (*Local, error) {
+	if config.Root == "" {
+		return nil, errors.New("storage: local root is empty")
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	if err := os.MkdirAll(filepath.Join(config.Root, localTempDir), 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Local{config: config}, nil
+}
+
+// Put implements `Filesystem`. The file is written to a temporary file first, so that the readers never
+// see a partial file.
+func (l *Local) Put(c context.Context, key string, r io.Reader, opts PutOptions) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(l.config.Root, localTempDir), "put-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, contextReader{c: c, r: r}); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(tmp.Name(), name))
+}
+
+// Get implements `Filesystem`.
+func (l *Local) Get(c context.Context, key string) (File, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, ErrNotExist
+	}
+
+	key, _ = cleanKey(key)
+
+	return &localFile{File: f, info: localInfo(key, stat)}, nil
+}
+
+// Delete implements `Filesystem`.
+func (l *Local) Delete(c context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// List implements `Filesystem`.
+func (l *Local) List(c context.Context, prefix string) ([]FileInfo, error) {
+	var infos []FileInfo
+
+	err := filepath.WalkDir(l.config.Root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(l.config.Root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if key == localTempDir || (key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, localInfo(key, stat))
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return infos, nil
+}
+
+// SignedURL implements `Filesystem`, the URL is verified by `LocalHandler`.
+func (l *Local) SignedURL(c context.Context, key string, expires time.Duration) (string, error) {
+	if l.config.BaseURL == "" || l.config.SigningKey == "" {
+		return "", errors.New("storage: local base URL or signing key is empty")
+	}
+
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", l.sign(key, expiresAt))
+
+	return l.config.BaseURL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Verify checks the signature and the expiry of a URL returned by `SignedURL`.
+func (l *Local) Verify(key string, query url.Values) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := query.Get("expires")
+	unix, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		return errors.New("storage: signed URL has no expiry")
+	}
+	if time.Now().Unix() > unix {
+		return errors.New("storage: signed URL has expired")
+	}
+
+	if l.config.SigningKey == "" || !hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(key, expiresAt))) {
+		return errors.New("storage: signed URL has an invalid signature")
+	}
+
+	return nil
+}
+
+// LocalHandler serves the files of the signed URLs of `l`, the key is the `*` path parameter. Example:
+//
+//	e.GET("/files/*", storage.LocalHandler(local))
+func LocalHandler(l *Local) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key, err := url.PathUnescape(c.Param("*"))
+		if err != nil {
+			return echo.ErrNotFound
+		}
+
+		if err := l.Verify(key, c.QueryParams()); err != nil {
+			return echo.NewHTTPError(http.StatusForbidden).SetInternal(err)
+		}
+
+		return Serve(c, l, key)
+	}
+}
+
+func (l *Local) sign(key, expiresAt string) string {
+	mac := hmac.New(sha256.New, []byte(l.config.SigningKey))
+	mac.Write([]byte(key + "\n" + expiresAt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if key == localTempDir || strings.HasPrefix(key, localTempDir+"/") {
+		return "", errors.Errorf("storage: key %q is reserved", key)
+	}
+
+	return filepath.Join(l.config.Root, filepath.FromSlash(key)), nil
+}
+
+func localInfo(key string, stat fs.FileInfo) FileInfo {
+	return FileInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     stat.ModTime(),
+	}
+}
+
+type localFile struct {
+	*os.File
+	info FileInfo
+}
+
+func (f *localFile) Info() FileInfo {
+	return f.info
+}
+
+// contextReader stops reading once the context is done, so that a canceled upload isn't stored.
+type contextReader struct {
+	c context.Context
+	r io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.c.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,412 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// S3Config defines the config for `NewS3`.
+type S3Config struct {
+	// Bucket of the files.
+	// Required.
+	Bucket string
+
+	// Region of the bucket.
+	// Required.
+	Region string
+
+	// Endpoint of the S3 API, like the one of MinIO.
+	// Optional. Default value "https://s3.<region>.amazonaws.com".
+	Endpoint string
+
+	// PathStyle puts the bucket in the path instead of the host of the URLs.
+	// Optional. Default value false.
+	PathStyle bool
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials signing the requests.
+	// Optional. Default value the `AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY` and `AWS_SESSION_TOKEN`
+	// environment variables.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of the parts of the multipart uploads, the files smaller than it are uploaded
+	// in a single request. It's also the memory used by an upload.
+	// Optional. Default value 8MB, the minimum is 5MB.
+	PartSize int
+}
+
+// S3 stores the files in an S3 bucket through the REST API.
+type S3 struct {
+	client   *http.Client
+	config   S3Config
+	endpoint *url.URL
+	creds    helpers.AWSCredentials
+}
+
+const (
+	s3MinPartSize     = 5 << 20
+	s3DefaultPartSize = 8 << 20
+)
+
+// NewS3 returns an S3 filesystem, `client` is `http.DefaultClient` if nil.
+func NewS3(client *http.Client, config S3Config) (*S3, error) {
+	if config.Bucket == "" || config.Region == "" {
+		return nil, errors.New("storage: s3 bucket or region is empty")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if config.PartSize == 0 {
+		config.PartSize = s3DefaultPartSize
+	}
+	if config.PartSize < s3MinPartSize {
+		config.PartSize = s3MinPartSize
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	creds := helpers.AWSCredentials{
+		AccessKeyID:     config.AccessKeyID,
+		SecretAccessKey: config.SecretAccessKey,
+		SessionToken:    config.SessionToken,
+	}
+	if creds.AccessKeyID == "" {
+		creds = helpers.AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("storage: AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is not set")
+	}
+
+	return &S3{client: client, config: config, endpoint: endpoint, creds: creds}, nil
+}
+
+// Put implements `Filesystem`. The content is uploaded in a single request if it's smaller than
+// `PartSize`, otherwise by a multipart upload so that its size doesn't need to be known.
+func (s *S3) Put(c context.Context, key string, r io.Reader, opts PutOptions) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, s.config.PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp, err := s.do(c, http.MethodPut, key, nil, s.putHeader(key, opts), buf[:n])
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.putMultipart(c, key, r, opts, buf)
+}
+
+func (s *S3) putMultipart(c context.Context, key string, r io.Reader, opts PutOptions, buf []byte) error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(c, http.MethodPost, key, url.Values{"uploads": {""}}, s.putHeader(key, opts), nil, &initiated); err != nil {
+		return err
+	}
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+
+	err := func() error {
+		n := len(buf)
+		for number := 1; n > 0; number++ {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": upload["uploadId"]}
+			resp, err := s.do(c, http.MethodPut, key, query, nil, buf[:n])
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			complete.Parts = append(complete.Parts, part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+			n, err = io.ReadFull(r, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return errors.WithStack(err)
+			}
+		}
+
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The completion can fail with a successful status and an error in the body.
+		var result struct {
+			XMLName xml.Name
+			Code    string
+			Message string
+		}
+		if err := s.doXML(c, http.MethodPost, key, upload, nil, body, &result); err != nil {
+			return err
+		}
+		if result.XMLName.Local == "Error" {
+			return errors.Errorf("storage: s3 multipart upload of %s failed: %s %s", key, result.Code, result.Message)
+		}
+
+		return nil
+	}()
+	if err != nil {
+		// The uploaded parts are charged until the upload is aborted.
+		if resp, abortErr := s.do(context.Background(), http.MethodDelete, key, upload, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get implements `Filesystem`.
+func (s *S3) Get(c context.Context, key string) (File, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(c, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := FileInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &remoteFile{c: c, info: info, open: func(c context.Context, offset int64) (io.ReadCloser, error) {
+		header := http.Header{}
+		if offset > 0 {
+			header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		}
+		resp, err := s.do(c, http.MethodGet, key, nil, header, nil)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}}, nil
+}
+
+// Delete implements `Filesystem`.
+func (s *S3) Delete(c context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(c, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// List implements `Filesystem`.
+func (s *S3) List(c context.Context, prefix string) ([]FileInfo, error) {
+	var infos []FileInfo
+
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		var result struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key          string
+				LastModified time.Time
+				ETag         string
+				Size         int64
+			}
+		}
+		if err := s.doXML(c, http.MethodGet, "", query, nil, nil, &result); err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			infos = append(infos, FileInfo{
+				Key:         object.Key,
+				Size:        object.Size,
+				ContentType: mime.TypeByExtension(path.Ext(object.Key)),
+				ModTime:     object.LastModified,
+				ETag:        strings.Trim(object.ETag, `"`),
+			})
+		}
+
+		if !result.IsTruncated {
+			return infos, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// SignedURL implements `Filesystem`, the URL is a presigned `GET` URL valid up to 7 days.
+func (s *S3) SignedURL(c context.Context, key string, expires time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return helpers.PresignAWSV4(http.MethodGet, s.url(key, nil), s.creds, s.config.Region, "s3", time.Now(), expires), nil
+}
+
+func (s *S3) putHeader(key string, opts PutOptions) http.Header {
+	header := http.Header{}
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if opts.CacheControl != "" {
+		header.Set("Cache-Control", opts.CacheControl)
+	}
+
+	return header
+}
+
+// url returns the URL of the object `key`, or of the bucket if `key` is empty.
+func (s *S3) url(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+
+	escaped := s3Escape(key)
+	if s.config.PathStyle {
+		u.Path += "/" + s.config.Bucket + "/" + key
+		u.RawPath = s.endpoint.EscapedPath() + "/" + s3Escape(s.config.Bucket) + "/" + escaped
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path += "/" + key
+		u.RawPath = s.endpoint.EscapedPath() + "/" + escaped
+	}
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	return &u
+}
+
+// do sends a signed request and returns the response if its status is successful.
+func (s *S3) do(c context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c, method, s.url(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	helpers.SignAWSV4(req, body, s.creds, s.config.Region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, errors.Errorf("storage: s3 %s %s failed with %s: %s", method, key, resp.Status, data)
+	}
+
+	return resp, nil
+}
+
+func (s *S3) doXML(c context.Context, method, key string, query url.Values, header http.Header, body []byte, v interface{}) error {
+	resp, err := s.do(c, method, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return errors.WithStack(xml.NewDecoder(resp.Body).Decode(v))
+}
+
+// s3Escape escapes the key like the AWS signature version 4 expects, everything but the unreserved
+// characters and the slashes.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{ch})))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,264 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package storage stores the files of the application on the local disk, S3 or GCS behind the same
+// `Filesystem` interface.
+package storage
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// Filesystem stores the files by their slash separated keys, like `avatars/42.png`.
+type Filesystem interface {
+	// Put stores the content of `r` at `key`, the existing file is replaced.
+	Put(c context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get opens the file at `key`, it returns `ErrNotExist` if it doesn't exist.
+	Get(c context.Context, key string) (File, error)
+	// Delete removes the file at `key`, it doesn't fail if the file doesn't exist.
+	Delete(c context.Context, key string) error
+	// SignedURL returns a URL from which anyone can download the file until it expires.
+	SignedURL(c context.Context, key string, expires time.Duration) (string, error)
+	// List returns the files whose key starts with `prefix`, sorted by key.
+	List(c context.Context, prefix string) ([]FileInfo, error)
+}
+
+// File is a stored file opened by `Filesystem.Get`. The remote files are read lazily by ranges, so
+// seeking doesn't download the skipped content.
+type File interface {
+	io.ReadSeekCloser
+	Info() FileInfo
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	// ETag identifies the content of the file, without quotes. It is empty for the local files.
+	ETag string
+}
+
+// PutOptions are the metadata of a stored file.
+type PutOptions struct {
+	// ContentType of the file. The local files always use the type of their extension.
+	// Optional. Default value the type of the key extension.
+	ContentType string
+	// CacheControl is the `Cache-Control` header of the file when it's downloaded from the signed URL.
+	// It's ignored by the local files.
+	// Optional.
+	CacheControl string
+}
+
+// Drivers of `Config.Driver`.
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+	DriverGCS   = "gcs"
+)
+
+// ErrNotExist is returned when a file doesn't exist.
+var ErrNotExist = errors.New("storage: file does not exist")
+
+// Config selects and configures the driver of `New`.
+type Config struct {
+	// Driver is `local`, `s3` or `gcs`.
+	// Required.
+	Driver string
+	Local  LocalConfig
+	S3     S3Config
+	GCS    GCSConfig
+}
+
+// New returns the filesystem of the configured driver.
+func New(config Config) (Filesystem, error) {
+	switch strings.ToLower(config.Driver) {
+	case DriverLocal:
+		return NewLocal(config.Local)
+	case DriverS3:
+		return NewS3(nil, config.S3)
+	case DriverGCS:
+		return NewGCS(nil, config.GCS)
+	}
+
+	return nil, errors.Errorf("storage: unknown driver %q", config.Driver)
+}
+
+// PutMultipart streams the files of the multipart request to `fs` as they are read from the request body,
+// instead of buffering them on the disk like `echo.Context.FormFile`. `keyFunc` returns the key of each
+// file part, the part is skipped if it returns an empty string. The form values are not available in
+// the context afterwards, send them before the files or read them from `keyFunc`.
+func PutMultipart(c echo.Context, fs Filesystem, keyFunc func(part *multipart.Part) string) ([]FileInfo, error) {
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
+	var infos []FileInfo
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return infos, nil
+		}
+		if err != nil {
+			return infos, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+
+		if part.FileName() == "" {
+			continue
+		}
+		key := keyFunc(part)
+		if key == "" {
+			continue
+		}
+
+		info := FileInfo{Key: key, ContentType: part.Header.Get(echo.HeaderContentType)}
+		counter := &countingReader{Reader: part}
+		if err := fs.Put(c.Request().Context(), key, counter, PutOptions{ContentType: info.ContentType}); err != nil {
+			return infos, err
+		}
+		info.Size = counter.n
+		infos = append(infos, info)
+	}
+}
+
+// Serve writes the file at `key` to the response with the support of the range, `If-None-Match` and
+// `If-Modified-Since` requests. It returns `echo.ErrNotFound` if the file doesn't exist.
+func Serve(c echo.Context, fs Filesystem, key string) error {
+	f, err := fs.Get(c.Request().Context(), key)
+	if errors.Is(err, ErrNotExist) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := f.Info()
+	header := c.Response().Header()
+	if info.ContentType != "" {
+		header.Set(echo.HeaderContentType, info.ContentType)
+	}
+	if info.ETag != "" {
+		header.Set("ETag", `"`+info.ETag+`"`)
+	}
+
+	http.ServeContent(c.Response(), c.Request(), path.Base(key), info.ModTime, f)
+
+	return nil
+}
+
+// cleanKey returns the key without the leading slash and the `.` and `..` segments, so that it can't
+// escape the root of the local filesystem.
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if key == "" {
+		return "", errors.New("storage: key is empty")
+	}
+
+	return key, nil
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// remoteFile reads a remote file by ranges, the range from the current offset to the end is requested
+// on the first read after a seek.
+type remoteFile struct {
+	c      context.Context
+	info   FileInfo
+	open   func(c context.Context, offset int64) (io.ReadCloser, error)
+	body   io.ReadCloser
+	offset int64
+}
+
+func (f *remoteFile) Info() FileInfo {
+	return f.info
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.info.Size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		body, err := f.open(f.c, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative offset")
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+
+	err := f.body.Close()
+	f.body = nil
+
+	return err
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	fs, err := NewLocal(LocalConfig{Root: root})
+	require.NoError(t, err)
+
+	c := context.Background()
+	require.NoError(t, fs.Put(c, "avatars/1.png", strings.NewReader("one"), PutOptions{}))
+	require.NoError(t, fs.Put(c, "/avatars/../avatars/2.png", strings.NewReader("two"), PutOptions{}))
+	require.NoError(t, fs.Put(c, "../../docs/a.txt", strings.NewReader("doc"), PutOptions{}))
+
+	// The keys can't escape the root.
+	_, err = os.Stat(filepath.Join(root, "docs", "a.txt"))
+	assert.NoError(t, err)
+
+	f, err := fs.Get(c, "avatars/2.png")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "two", string(data))
+	assert.Equal(t, FileInfo{Key: "avatars/2.png", Size: 3, ContentType: "image/png", ModTime: f.Info().ModTime}, f.Info())
+
+	infos, err := fs.List(c, "avatars/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"avatars/1.png", "avatars/2.png"}, keys(infos))
+
+	infos, err = fs.List(c, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"avatars/1.png", "avatars/2.png", "docs/a.txt"}, keys(infos))
+
+	require.NoError(t, fs.Delete(c, "avatars/1.png"))
+	require.NoError(t, fs.Delete(c, "avatars/1.png"))
+	_, err = fs.Get(c, "avatars/1.png")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	assert.Error(t, fs.Put(c, ".tmp/x", strings.NewReader("x"), PutOptions{}))
+}
+
+func TestLocalHandler(t *testing.T) {
+	fs, err := NewLocal(LocalConfig{Root: t.TempDir(), BaseURL: "http://example.com/files/", SigningKey: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, fs.Put(context.Background(), "docs/hello world.txt", strings.NewReader("hello, world"), PutOptions{}))
+
+	e := echo.New()
+	e.GET("/files/*", LocalHandler(fs))
+
+	signed, err := fs.SignedURL(context.Background(), "docs/hello world.txt", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signed, "http://example.com/files/docs/hello%20world.txt?expires="))
+
+	u, _ := url.Parse(signed)
+
+	req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	req.Header.Set("Range", "bytes=7-")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "world", rec.Body.String())
+	assert.Equal(t, "bytes 7-11/12", rec.Header().Get("Content-Range"))
+
+	query := u.Query()
+	query.Set("signature", strings.Repeat("0", 64))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.EscapedPath()+"?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	expired, err := fs.SignedURL(context.Background(), "docs/hello world.txt", -time.Minute)
+	require.NoError(t, err)
+	u, _ = url.Parse(expired)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestPutMultipart(t *testing.T) {
+	fs, err := NewLocal(LocalConfig{Root: t.TempDir()})
+	require.NoError(t, err)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "photos")
+	w, _ := mw.CreateFormFile("photo", "a.jpg")
+	w.Write([]byte("jpeg"))
+	w, _ = mw.CreateFormFile("ignored", "b.jpg")
+	w.Write([]byte("skipped"))
+	mw.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	infos, err := PutMultipart(c, fs, func(part *multipart.Part) string {
+		if part.FormName() != "photo" {
+			return ""
+		}
+		return "photos/" + part.FileName()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []FileInfo{{Key: "photos/a.jpg", Size: 4, ContentType: "application/octet-stream"}}, infos)
+
+	stored, err := fs.List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"photos/a.jpg"}, keys(stored))
+}
+
+// fakeS3 is an S3 bucket in memory, which only supports the requests sent by `S3`.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	types    map[string]string
+	parts    map[string][][]byte
+	requests []string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, types: map[string]string{}, parts: map[string][][]byte{}}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		type object struct {
+			Key  string
+			Size int64
+		}
+		var result struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []object
+		}
+		var names []string
+		for name := range s.objects {
+			if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("continuation-token") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) > 1 {
+			names = names[:1]
+			result.IsTruncated = true
+			result.NextContinuationToken = names[0]
+		}
+		for _, name := range names {
+			result.Contents = append(result.Contents, object{Key: name, Size: int64(len(s.objects[name]))})
+		}
+		xml.NewEncoder(w).Encode(result)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.types[key] = r.Header.Get("Content-Type")
+		w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		data, _ := io.ReadAll(r.Body)
+		s.parts[key] = append(s.parts[key], data)
+		w.Header().Set("ETag", `"part"`)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.objects[key] = bytes.Join(s.parts[key], nil)
+		w.Write([]byte(`<CompleteMultipartUploadResult><Key>` + key + `</Key></CompleteMultipartUploadResult>`))
+
+	case r.Method == http.MethodPut:
+		s.objects[key], _ = io.ReadAll(r.Body)
+		s.types[key] = r.Header.Get("Content-Type")
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", s.types[key])
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(data))
+
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	fs, err := NewS3(server.Client(), S3Config{
+		Bucket: "bucket", Region: "us-east-1", Endpoint: server.URL, PathStyle: true,
+		AccessKeyID: "AKID", SecretAccessKey: "secret", PartSize: s3MinPartSize,
+	})
+	require.NoError(t, err)
+
+	c := context.Background()
+	require.NoError(t, fs.Put(c, "docs/small file.txt", strings.NewReader("hello, world"), PutOptions{}))
+	assert.Equal(t, "text/plain; charset=utf-8", fake.types["docs/small file.txt"])
+
+	large := bytes.Repeat([]byte("x"), s3MinPartSize+10)
+	require.NoError(t, fs.Put(c, "docs/large.bin", bytes.NewReader(large), PutOptions{ContentType: "application/x-large"}))
+	assert.Equal(t, large, fake.objects["docs/large.bin"])
+	assert.Len(t, fake.parts["docs/large.bin"], 2)
+	assert.Equal(t, "application/x-large", fake.types["docs/large.bin"])
+
+	f, err := fs.Get(c, "docs/small file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), f.Info().Size)
+	assert.Equal(t, "etag", f.Info().ETag)
+	_, err = f.Seek(7, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "world", string(data))
+
+	_, err = fs.Get(c, "docs/missing.txt")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	infos, err := fs.List(c, "docs/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/large.bin", "docs/small file.txt"}, keys(infos))
+
+	require.NoError(t, fs.Delete(c, "docs/large.bin"))
+	assert.NotContains(t, fake.objects, "docs/large.bin")
+
+	signed, err := fs.SignedURL(c, "docs/small file.txt", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signed, server.URL+"/bucket/docs/small%20file.txt?X-Amz-Algorithm=AWS4-HMAC-SHA256"))
+	assert.Contains(t, signed, "&X-Amz-Expires=3600&")
+}
+
+func TestS3VirtualHostURL(t *testing.T) {
+	fs, err := NewS3(nil, S3Config{Bucket: "bucket", Region: "ap-northeast-1", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://bucket.s3.ap-northeast-1.amazonaws.com/a%2Bb/c%28d%29.txt", fs.url("a+b/c(d).txt", nil).String())
+}
+
+func TestGCS(t *testing.T) {
+	objects := map[string]gcsObject{}
+	contents := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			mr := multipart.NewReader(r.Body, params["boundary"])
+
+			part, _ := mr.NextPart()
+			var object gcsObject
+			json.NewDecoder(part).Decode(&object)
+			part, _ = mr.NextPart()
+			data, _ := io.ReadAll(part)
+
+			object.Size = "12"
+			object.ETag = "etag"
+			objects[object.Name] = object
+			contents[object.Name] = data
+			json.NewEncoder(w).Encode(object)
+
+		case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/bucket/o":
+			var result struct {
+				Items []gcsObject `json:"items"`
+			}
+			for name, object := range objects {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					result.Items = append(result.Items, object)
+				}
+			}
+			json.NewEncoder(w).Encode(result)
+
+		case strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")
+			object, ok := objects[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			switch {
+			case r.Method == http.MethodDelete:
+				delete(objects, name)
+			case r.URL.Query().Get("alt") == "media":
+				http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(contents[name]))
+			default:
+				json.NewEncoder(w).Encode(object)
+			}
+		}
+	}))
+	defer server.Close()
+
+	fs, err := NewGCS(server.Client(), GCSConfig{Bucket: "bucket", Endpoint: server.URL})
+	require.NoError(t, err)
+
+	c := context.Background()
+	require.NoError(t, fs.Put(c, "docs/a b.txt", strings.NewReader("hello, world"), PutOptions{CacheControl: "no-cache"}))
+	assert.Equal(t, "text/plain; charset=utf-8", objects["docs/a b.txt"].ContentType)
+
+	f, err := fs.Get(c, "docs/a b.txt")
+	require.NoError(t, err)
+	_, err = f.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "world", string(data))
+
+	infos, err := fs.List(c, "docs/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/a b.txt"}, keys(infos))
+
+	require.NoError(t, fs.Delete(c, "docs/a b.txt"))
+	require.NoError(t, fs.Delete(c, "docs/a b.txt"))
+	_, err = fs.Get(c, "docs/a b.txt")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = fs.SignedURL(c, "docs/a b.txt", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestGCSSignedURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "bean@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+	file := filepath.Join(t.TempDir(), "key.json")
+	require.NoError(t, os.WriteFile(file, credentials, 0o600))
+
+	fs, err := NewGCS(nil, GCSConfig{Bucket: "bucket", CredentialsFile: file})
+	require.NoError(t, err)
+
+	signed, err := fs.SignedURL(context.Background(), "docs/a b.txt", time.Hour)
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "storage.googleapis.com", u.Host)
+	assert.Equal(t, "/bucket/docs/a%20b.txt", u.EscapedPath())
+	assert.Equal(t, "GOOG4-RSA-SHA256", u.Query().Get("X-Goog-Algorithm"))
+	assert.True(t, strings.HasPrefix(u.Query().Get("X-Goog-Credential"), "bean@example.iam.gserviceaccount.com/"))
+	assert.Equal(t, "3600", u.Query().Get("X-Goog-Expires"))
+	assert.Len(t, u.Query().Get("X-Goog-Signature"), 512)
+}
+
+func TestGCSTransport(t *testing.T) {
+	fetched := 0
+	var authorization string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &gcsTransport{
+		base: http.DefaultTransport,
+		fetch: func(c context.Context) (gcsToken, error) {
+			fetched++
+			return gcsToken{AccessToken: "token", ExpiresIn: 3600}, nil
+		},
+		refresh: time.Minute,
+	}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, 1, fetched)
+	assert.Equal(t, "Bearer token", authorization)
+}
+
+func keys(infos []FileInfo) []string {
+	keys := make([]string, len(infos))
+	for i, info := range infos {
+		keys[i] = info.Key
+	}
+	return keys
+}
@@ -0,0 +1,402 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package suggest provides a search-as-you-type (autocomplete) helper. Every term is indexed per tenant
+// into redis sorted sets, one set per prefix, so that a suggestion query is a single ZREVRANGE call.
+package suggest
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/spf13/cobra"
+)
+
+// Item is a term which can be suggested. Higher `Score` comes first.
+type Item struct {
+	Term  string
+	Score float64
+}
+
+// Suggestion is a single result of a query.
+type Suggestion struct {
+	Term        string  `json:"term"`
+	Highlighted string  `json:"highlighted"`
+	Score       float64 `json:"score"`
+}
+
+// Loader streams all the items of a tenant (example: from a MySQL table) by calling `yield` for each row.
+type Loader func(c context.Context, tenantID uint64, yield func(Item) error) error
+
+// Config defines the config of a `Suggester`.
+type Config struct {
+	// Name of the index, example: `products`. Required.
+	Name string
+	// Prefix is prepended to all redis keys. Default value is `dbdrivers.GetRedisCachePrefix() + ":suggest"`.
+	Prefix string
+	// MinPrefixLength is the minimum number of characters needed to query. Default value is 1.
+	MinPrefixLength int
+	// MaxPrefixLength is the maximum number of indexed characters. Default value is 20.
+	MaxPrefixLength int
+	// Limit is the default (and maximum) number of returned suggestions. Default value is 10.
+	Limit int
+	// HighlightTag is the HTML tag wrapped around the matched part of the term. Default value is `em`.
+	HighlightTag string
+}
+
+// Suggester maintains and queries the prefix indexes.
+type Suggester struct {
+	conn   func(tenantID uint64) (*dbdrivers.RedisDBConn, error)
+	config Config
+}
+
+// New returns a `Suggester`. `conn` resolves the redis connection of a tenant, example: `b.DBConn.RedisConn`.
+func New(conn func(tenantID uint64) (*dbdrivers.RedisDBConn, error), config Config) *Suggester {
+	if config.Prefix == "" {
+		config.Prefix = dbdrivers.GetRedisCachePrefix() + ":suggest"
+	}
+	if config.MinPrefixLength <= 0 {
+		config.MinPrefixLength = 1
+	}
+	if config.MaxPrefixLength <= 0 {
+		config.MaxPrefixLength = 20
+	}
+	if config.Limit <= 0 {
+		config.Limit = 10
+	}
+	if config.HighlightTag == "" {
+		config.HighlightTag = "em"
+	}
+
+	return &Suggester{conn: conn, config: config}
+}
+
+// Add indexes (or updates the score of) the items for a tenant.
+func (s *Suggester) Add(c context.Context, tenantID uint64, items ...Item) error {
+	conn, err := s.conn(tenantID)
+	if err != nil {
+		return err
+	}
+
+	version, err := s.version(c, conn, tenantID)
+	if err != nil {
+		return err
+	}
+
+	return s.add(c, conn, tenantID, version, items)
+}
+
+// Remove deletes the terms from the index of a tenant.
+func (s *Suggester) Remove(c context.Context, tenantID uint64, terms ...string) error {
+	conn, err := s.conn(tenantID)
+	if err != nil {
+		return err
+	}
+
+	version, err := s.version(c, conn, tenantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, term := range terms {
+			for _, p := range s.prefixes(term) {
+				pipe.ZRem(c, s.indexKey(tenantID, version, p), term)
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Query returns the best suggestions of a tenant which start with `q`. `limit` <= 0 means the configured limit.
+func (s *Suggester) Query(c context.Context, tenantID uint64, q string, limit int) ([]Suggestion, error) {
+	q = normalize(q)
+	if utf8.RuneCountInString(q) < s.config.MinPrefixLength {
+		return []Suggestion{}, nil
+	}
+
+	if limit <= 0 || limit > s.config.Limit {
+		limit = s.config.Limit
+	}
+
+	conn, err := s.conn(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.version(c, conn, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := s.indexKey(tenantID, version, truncate(q, s.config.MaxPrefixLength))
+
+	// Fetch a bit more than the limit when the query is longer than the indexed prefixes.
+	fetch := int64(limit)
+	if utf8.RuneCountInString(q) > s.config.MaxPrefixLength {
+		fetch = int64(limit * 5)
+	}
+
+	zs, err := conn.Reader(c).ZRevRangeWithScores(c, key, 0, fetch-1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, errors.WithStack(err)
+	}
+
+	suggestions := make([]Suggestion, 0, len(zs))
+	for _, z := range zs {
+		term, _ := z.Member.(string)
+		if !strings.HasPrefix(normalize(term), q) {
+			continue
+		}
+
+		suggestions = append(suggestions, Suggestion{
+			Term:        term,
+			Highlighted: s.highlight(term, q),
+			Score:       z.Score,
+		})
+
+		if len(suggestions) == limit {
+			break
+		}
+	}
+
+	return suggestions, nil
+}
+
+// Rebuild re-creates the whole index of a tenant from the `loader`. The new index is written under a new
+// version and switched atomically, so queries keep working during the rebuild. Old keys are removed afterwards.
+func (s *Suggester) Rebuild(c context.Context, tenantID uint64, loader Loader) error {
+	conn, err := s.conn(tenantID)
+	if err != nil {
+		return err
+	}
+
+	oldVersion, err := s.version(c, conn, tenantID)
+	if err != nil {
+		return err
+	}
+
+	newVersion := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	batch := make([]Item, 0, 500)
+	err = loader(c, tenantID, func(item Item) error {
+		batch = append(batch, item)
+		if len(batch) < cap(batch) {
+			return nil
+		}
+
+		err := s.add(c, conn, tenantID, newVersion, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.add(c, conn, tenantID, newVersion, batch); err != nil {
+		return err
+	}
+
+	if err := conn.Client().Set(c, s.versionKey(tenantID), newVersion, 0).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.deleteVersion(c, conn, tenantID, oldVersion)
+}
+
+// Handler returns an echo handler serving `GET ?q=...&limit=...`. `tenant` extracts the tenant ID
+// from the request (return 0 when tenant mode is off). Each client (by real IP) is allowed at most
+// `maxPerSecond` queries per second to absorb the bursts generated by typing; pass 0 to disable it.
+func (s *Suggester) Handler(tenant func(c echo.Context) uint64, maxPerSecond int64) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		tenantID := tenant(c)
+
+		if maxPerSecond > 0 {
+			conn, err := s.conn(tenantID)
+			if err != nil {
+				return err
+			}
+
+			window := strconv.FormatInt(time.Now().Unix(), 10)
+			count, err := conn.IncrWithExpiry(ctx, s.config.Prefix+":"+s.config.Name+":rate:"+c.RealIP()+":"+window, 1, 2*time.Second)
+			if err != nil {
+				return err
+			}
+
+			if count > maxPerSecond {
+				return berror.NewIgnorableAPIError(http.StatusTooManyRequests, berror.TOO_MANY_REQUESTS, errors.New("too many suggestion requests"))
+			}
+		}
+
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+		suggestions, err := s.Query(ctx, tenantID, c.QueryParam("q"), limit)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"suggestions": suggestions,
+		})
+	}
+}
+
+// NewRebuildCommand returns a cobra command which rebuilds the index for all the tenants returned by `tenants`.
+// Example: `rootCmd.AddCommand(suggest.NewRebuildCommand(s, tenants, loader))` then run `./app suggest-rebuild`.
+func NewRebuildCommand(s *Suggester, tenants func() []uint64, loader Loader) *cobra.Command {
+	return &cobra.Command{
+		Use:   "suggest-rebuild",
+		Short: "Rebuild the `" + s.config.Name + "` suggestion index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, tenantID := range tenants() {
+				if err := s.Rebuild(cmd.Context(), tenantID, loader); err != nil {
+					return err
+				}
+				cmd.Printf("suggestion index `%s` rebuilt for tenant %d\n", s.config.Name, tenantID)
+			}
+			return nil
+		},
+	}
+}
+
+func (s *Suggester) add(c context.Context, conn *dbdrivers.RedisDBConn, tenantID uint64, version string, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	_, err := conn.Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			for _, p := range s.prefixes(item.Term) {
+				pipe.ZAdd(c, s.indexKey(tenantID, version, p), &redis.Z{Score: item.Score, Member: item.Term})
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s *Suggester) deleteVersion(c context.Context, conn *dbdrivers.RedisDBConn, tenantID uint64, version string) error {
+	iter := conn.Client().Scan(c, 0, s.indexKey(tenantID, version, "*"), 500).Iterator()
+
+	keys := make([]string, 0, 500)
+	for iter.Next(c) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			if err := conn.Client().Unlink(c, keys...).Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			keys = keys[:0]
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(keys) > 0 {
+		if err := conn.Client().Unlink(c, keys...).Err(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Suggester) version(c context.Context, conn *dbdrivers.RedisDBConn, tenantID uint64) (string, error) {
+	version, err := conn.Client().Get(c, s.versionKey(tenantID)).Result()
+	if err == redis.Nil {
+		return "0", nil
+	} else if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return version, nil
+}
+
+// prefixes returns all the indexed prefixes of a term.
+func (s *Suggester) prefixes(term string) []string {
+	runes := []rune(normalize(term))
+	if len(runes) > s.config.MaxPrefixLength {
+		runes = runes[:s.config.MaxPrefixLength]
+	}
+
+	prefixes := make([]string, 0, len(runes))
+	for i := s.config.MinPrefixLength; i <= len(runes); i++ {
+		prefixes = append(prefixes, string(runes[:i]))
+	}
+
+	return prefixes
+}
+
+// highlight wraps the matched prefix of the term with the highlight tag. The term is HTML escaped. `q` is
+// normalized, so the leading spaces of the term are skipped and the runes are counted once lower cased.
+func (s *Suggester) highlight(term, q string) string {
+	trimmed := strings.TrimLeftFunc(term, unicode.IsSpace)
+	lead := term[:len(term)-len(trimmed)]
+
+	n, end := utf8.RuneCountInString(q), 0
+	for i, r := range trimmed {
+		if n <= 0 {
+			break
+		}
+		n -= utf8.RuneCountInString(strings.ToLower(string(r)))
+		end = i + utf8.RuneLen(r)
+	}
+
+	return html.EscapeString(lead) + "<" + s.config.HighlightTag + ">" + html.EscapeString(trimmed[:end]) +
+		"</" + s.config.HighlightTag + ">" + html.EscapeString(trimmed[end:])
+}
+
+func (s *Suggester) indexKey(tenantID uint64, version, prefix string) string {
+	return s.config.Prefix + ":" + s.config.Name + ":" + strconv.FormatUint(tenantID, 10) + ":" + version + ":" + prefix
+}
+
+func (s *Suggester) versionKey(tenantID uint64) string {
+	return s.config.Prefix + ":" + s.config.Name + ":" + strconv.FormatUint(tenantID, 10) + ":version"
+}
+
+func normalize(term string) string {
+	return strings.ToLower(strings.TrimSpace(term))
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package suggest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggester_prefixes(t *testing.T) {
+	s := New(nil, Config{Name: "test", MinPrefixLength: 2, MaxPrefixLength: 4})
+
+	assert.Equal(t, []string{"ap", "app", "appl"}, s.prefixes(" Apple "))
+	assert.Equal(t, []string{}, s.prefixes("a"))
+	assert.Equal(t, []string{"りん", "りんご"}, s.prefixes("りんご"))
+}
+
+func TestSuggester_highlight(t *testing.T) {
+	s := New(nil, Config{Name: "test"})
+
+	assert.Equal(t, "<em>App</em>le", s.highlight("Apple", "app"))
+	assert.Equal(t, "<em>&lt;b</em>&gt;", s.highlight("<b>", "<b"))
+	assert.Equal(t, "<em>A</em>", s.highlight("A", "abc"))
+	assert.Equal(t, "  <em>App</em>le ", s.highlight("  Apple ", "app"))
+	assert.Equal(t, "\t<em>りん</em>ご", s.highlight("\tりんご", "りん"))
+}
+
+func TestSuggester_Query(t *testing.T) {
+	primary, replica := miniredis.RunT(t), miniredis.RunT(t)
+	conn := &dbdrivers.RedisDBConn{
+		Host: redis.NewClient(&redis.Options{Addr: primary.Addr()}),
+		Read: map[uint64]*redis.Client{0: redis.NewClient(&redis.Options{Addr: replica.Addr()})},
+	}
+	s := New(func(uint64) (*dbdrivers.RedisDBConn, error) { return conn, nil }, Config{Name: "test", Prefix: "test"})
+
+	c := context.Background()
+	require.NoError(t, s.Add(c, 1, Item{Term: "Apple", Score: 1}, Item{Term: " Apricot", Score: 2}, Item{Term: "Banana", Score: 3}))
+
+	// The replica hasn't got the index yet.
+	suggestions, err := s.Query(c, 1, "ap", 0)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+
+	suggestions, err = s.Query(dbdrivers.WithPrimaryRead(c), 1, " AP", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Suggestion{
+		{Term: " Apricot", Highlighted: " <em>Ap</em>ricot", Score: 2},
+		{Term: "Apple", Highlighted: "<em>Ap</em>ple", Score: 1},
+	}, suggestions)
+
+	suggestions, err = s.Query(dbdrivers.WithPrimaryRead(c), 1, "ap", 1)
+	require.NoError(t, err)
+	assert.Len(t, suggestions, 1)
+}
@@ -0,0 +1,362 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/fsnotify/fsnotify"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/shutdown"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig returns the TLS config of the server from `http.ssl`: the certificates of `certFile` and
+// `privFile`, reloaded when they change if `reload` is true, or the certificates of ACME, e.g. Let's Encrypt,
+// if `autocert.on` is true. The clients must present a certificate signed by `mtls.clientCAFile` if `mtls.on`
+// is true. The watchers and the servers it starts are stopped by the shutdown.
+func (b *Bean) TLSConfig() (*tls.Config, error) {
+	ssl := b.Config.HTTP.SSL
+
+	config := &tls.Config{
+		MinVersion: ssl.MinTLSVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	switch {
+	case ssl.Autocert.On:
+		manager, err := b.autocertManager()
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = manager.GetCertificate
+		config.NextProtos = append(config.NextProtos, acme.ALPNProto)
+
+	case ssl.Reload:
+		reloader, err := newCertReloader(ssl.CertFile, ssl.PrivFile, ssl.MTLS.ClientCAFile, b.Logger())
+		if err != nil {
+			return nil, err
+		}
+		if err := b.ShutdownOrchestrator().Register(shutdown.Component{Name: "tls", Stage: shutdown.StageClose, Stop: reloader.stop}); err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.certificate
+
+		// The client CAs are reloaded with the certificate.
+		if ssl.MTLS.On {
+			config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				c := config.Clone()
+				c.GetConfigForClient = nil
+				c.ClientCAs = reloader.clientCAs()
+				return c, nil
+			}
+		}
+
+	default:
+		cert, err := tls.LoadX509KeyPair(ssl.CertFile, ssl.PrivFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if ssl.MTLS.On {
+		clientAuth, err := clientAuthType(ssl.MTLS.VerifyMode)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = clientAuth
+
+		if config.ClientCAs, err = loadCertPool(ssl.MTLS.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// ClientCertificate returns the verified certificate of the client of a mutual TLS connection, nil if the
+// client has not presented one.
+func ClientCertificate(c echo.Context) *x509.Certificate {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// autocertManager returns the ACME manager of `http.ssl.autocert`, with its certificates and account key in
+// the badger database of `cacheDir`. If `httpPort` is set, it serves the HTTP challenges there and redirects
+// the other requests to HTTPS.
+func (b *Bean) autocertManager() (*autocert.Manager, error) {
+	config := b.Config.HTTP.SSL.Autocert
+	if len(config.Hosts) == 0 {
+		return nil, errors.New("autocert: `http.ssl.autocert.hosts` is empty")
+	}
+	if config.CacheDir == "" {
+		return nil, errors.New("autocert: `http.ssl.autocert.cacheDir` is empty")
+	}
+
+	db, err := badger.Open(badger.DefaultOptions(config.CacheDir).WithLogger(nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "autocert")
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Hosts...),
+		Cache:      &BadgerCertCache{DB: db},
+		Email:      config.Email,
+	}
+	if config.DirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: config.DirectoryURL}
+	}
+
+	components := []shutdown.Component{{Name: "autocert", Stage: shutdown.StageClose, Stop: func(context.Context) error {
+		return db.Close()
+	}}}
+
+	if config.HTTPPort != "" {
+		s := &http.Server{Addr: b.Config.HTTP.Host + ":" + config.HTTPPort, Handler: manager.HTTPHandler(nil)}
+		components = append(components, shutdown.Component{Name: "autocert-http", Stage: shutdown.StageIntake, Stop: s.Shutdown})
+
+		go func() {
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				b.Logger().Error("autocert: ", err)
+			}
+		}()
+	}
+
+	for _, component := range components {
+		if err := b.ShutdownOrchestrator().Register(component); err != nil {
+			return nil, err
+		}
+	}
+
+	return manager, nil
+}
+
+// BadgerCertCache keeps the certificates of autocert in a badger database.
+type BadgerCertCache struct {
+	DB *badger.DB
+	// Prefix of the keys.
+	// Optional. Default value "autocert:".
+	Prefix string
+}
+
+func (c *BadgerCertCache) key(name string) []byte {
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = "autocert:"
+	}
+	return []byte(prefix + name)
+}
+
+// Get implements `autocert.Cache`.
+func (c *BadgerCertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	var data []byte
+
+	err := c.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(c.key(name))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return data, err
+}
+
+// Put implements `autocert.Cache`.
+func (c *BadgerCertCache) Put(ctx context.Context, name string, data []byte) error {
+	return c.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(c.key(name), data)
+	})
+}
+
+// Delete implements `autocert.Cache`.
+func (c *BadgerCertCache) Delete(ctx context.Context, name string) error {
+	return c.DB.Update(func(txn *badger.Txn) error {
+		return txn.Delete(c.key(name))
+	})
+}
+
+// certReloader serves the certificate of its files, and loads them again when they change. A certificate
+// which fails to load is logged and the previous one is kept.
+type certReloader struct {
+	certFile, keyFile, caFile string
+	logger                    echo.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	watcher *fsnotify.Watcher
+}
+
+func newCertReloader(certFile, keyFile, caFile string, logger echo.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r.watcher = watcher
+
+	// Watch the directories, so that the symbolic links of the kubernetes secrets are followed when they are
+	// swapped.
+	dirs := map[string]bool{}
+	for _, file := range []string{certFile, keyFile, caFile} {
+		if file == "" || dirs[filepath.Dir(file)] {
+			continue
+		}
+		dirs[filepath.Dir(file)] = true
+
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	go r.watch()
+
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		if pool, err = loadCertPool(r.caFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.pool = &cert, pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the files after the writes have settled, the certificate and its key are often written one
+// after the other.
+func (r *certReloader) watch() {
+	var reload <-chan time.Time
+
+	for {
+		select {
+		case _, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			reload = time.After(500 * time.Millisecond)
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			r.logger.Error("tls: ", err)
+		case <-reload:
+			reload = nil
+			if err := r.load(); err != nil {
+				r.logger.Error("tls: the certificate is not reloaded: ", err)
+				continue
+			}
+			r.logger.Info("tls: certificate reloaded")
+		}
+	}
+}
+
+func (r *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+func (r *certReloader) clientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.pool
+}
+
+func (r *certReloader) stop(context.Context) error {
+	return r.watcher.Close()
+}
+
+// loadCertPool returns the pool of the PEM certificates of `file`.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	if file == "" {
+		return nil, errors.New("tls: `http.ssl.mtls.clientCAFile` is empty")
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("tls: no certificate in %s", file)
+	}
+
+	return pool, nil
+}
+
+// clientAuthType returns the verification of the client certificates of `http.ssl.mtls.verifyMode`.
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case "", "require":
+		return tls.RequireAndVerifyClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	default:
+		return tls.NoClientCert, errors.Errorf("tls: unknown `http.ssl.mtls.verifyMode` %q", mode)
+	}
+}
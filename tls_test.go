@@ -0,0 +1,224 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert returns a certificate of `name` signed by `parent`, or a CA if `parent` is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	}
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func newTLSBean(t *testing.T) (*Bean, string) {
+	dir := t.TempDir()
+
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	b := &Bean{Echo: e}
+	b.Config.HTTP.SSL.On = true
+	b.Config.HTTP.SSL.CertFile = filepath.Join(dir, "cert.pem")
+	b.Config.HTTP.SSL.PrivFile = filepath.Join(dir, "key.pem")
+	b.Config.HTTP.SSL.MinTLSVersion = tls.VersionTLS12
+
+	return b, dir
+}
+
+func TestTLSConfig(t *testing.T) {
+	b, _ := newTLSBean(t)
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "localhost", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+
+	config, err := b.TLSConfig()
+	require.NoError(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	b.Config.HTTP.SSL.PrivFile = ""
+	_, err = b.TLSConfig()
+	assert.Error(t, err)
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	b, _ := newTLSBean(t)
+	b.Config.HTTP.SSL.Reload = true
+	defer b.Shutdown(context.Background())
+
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "old.example.com", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+
+	config, err := b.TLSConfig()
+	require.NoError(t, err)
+
+	commonName := func() string {
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "old.example.com", commonName())
+
+	// A broken certificate is not served.
+	require.NoError(t, os.WriteFile(b.Config.HTTP.SSL.CertFile, []byte("broken"), 0o600))
+	time.Sleep(700 * time.Millisecond)
+	assert.Equal(t, "old.example.com", commonName())
+
+	newTestCert(t, "new.example.com", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+	assert.Eventually(t, func() bool { return commonName() == "new.example.com" }, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestMutualTLS(t *testing.T) {
+	b, dir := newTLSBean(t)
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "localhost", ca).write(t, b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
+	ca.write(t, filepath.Join(dir, "ca.pem"), "")
+
+	b.Config.HTTP.SSL.MTLS.On = true
+	b.Config.HTTP.SSL.MTLS.ClientCAFile = filepath.Join(dir, "ca.pem")
+
+	config, err := b.TLSConfig()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	b.Echo.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, ClientCertificate(c).Subject.CommonName)
+	})
+	server := httptest.NewUnstartedServer(b.Echo)
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, ServerName: "localhost"}}}
+	}
+
+	resp, err := client(newTestCert(t, "orders-service", ca).tls()).Get(server.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "orders-service", string(body))
+
+	// Without a certificate, or with a certificate of another CA.
+	_, err = client().Get(server.URL)
+	assert.Error(t, err)
+	_, err = client(newTestCert(t, "intruder", newTestCert(t, "other-ca", nil)).tls()).Get(server.URL)
+	assert.Error(t, err)
+
+	b.Config.HTTP.SSL.MTLS.VerifyMode = "optional"
+	_, err = b.TLSConfig()
+	assert.ErrorContains(t, err, "verifyMode")
+}
+
+func TestAutocertConfig(t *testing.T) {
+	b, dir := newTLSBean(t)
+	b.Config.HTTP.SSL.Autocert.On = true
+
+	_, err := b.TLSConfig()
+	assert.ErrorContains(t, err, "hosts")
+
+	b.Config.HTTP.SSL.Autocert.Hosts = []string{"example.com"}
+	b.Config.HTTP.SSL.Autocert.CacheDir = filepath.Join(dir, "autocert")
+	defer b.Shutdown(context.Background())
+
+	config, err := b.TLSConfig()
+	require.NoError(t, err)
+	assert.Contains(t, config.NextProtos, "acme-tls/1")
+	assert.Empty(t, config.Certificates)
+
+	// The hosts out of the whitelist are refused.
+	_, err = config.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.com"})
+	assert.Error(t, err)
+}
+
+func TestBadgerCertCache(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cache := &BadgerCertCache{DB: db}
+	ctx := context.Background()
+
+	_, err = cache.Get(ctx, "example.com")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+
+	require.NoError(t, cache.Put(ctx, "example.com", []byte("cert")))
+	data, err := cache.Get(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "cert", string(data))
+
+	require.NoError(t, cache.Delete(ctx, "example.com"))
+	_, err = cache.Get(ctx, "example.com")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+}
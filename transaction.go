@@ -0,0 +1,376 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// TxConfig defines the config for `TransactionalWithConfig` and `MongoTransactionalWithConfig`.
+type TxConfig struct {
+	// MaxAttempts is the maximum number of times the transaction will be executed, including the first one.
+	// Optional. Default value 3.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff are passed to `helpers.JitterBackoff` to calculate the waiting time
+	// between two attempts. Optional. Default value 50ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// IsRetryable decides whether a failed attempt should be retried or not.
+	// Optional. Default value `IsRetryableTxError`.
+	IsRetryable func(err error) bool
+
+	// SQLOptions is passed to gorm when the SQL transaction begins. (example: isolation level)
+	// Optional. Default value nil.
+	SQLOptions *sql.TxOptions
+}
+
+// DefaultTxConfig is the default config of the transaction helpers.
+var DefaultTxConfig = TxConfig{
+	MaxAttempts: 3,
+	MinBackoff:  50 * time.Millisecond,
+	MaxBackoff:  1 * time.Second,
+	IsRetryable: IsRetryableTxError,
+}
+
+// MySQL error numbers which means the whole transaction can be safely executed again.
+const (
+	mysqlErrCheckRead       = 1020 // Record has changed since last read. (serialization failure)
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrLockDeadlock    = 1213
+)
+
+// Error labels of the mongo server for the transactions.
+const (
+	mongoLabelTransientTx   = "TransientTransactionError"
+	mongoLabelUnknownCommit = "UnknownTransactionCommitResult"
+)
+
+// Reasons of the `bean_tx_retries_total` metric.
+const (
+	TxRetryDeadlock      = "deadlock"
+	TxRetryLockWait      = "lock_wait_timeout"
+	TxRetrySerialization = "serialization"
+	TxRetryTransient     = "transient"
+	TxRetryOther         = "other"
+)
+
+var (
+	txRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "tx_retries_total",
+		Help:      "How many transactions have been retried, partitioned by operation and reason.",
+	}, []string{"operation", "reason"})
+
+	txExhausted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "tx_retries_exhausted_total",
+		Help:      "How many transactions failed with a retryable error after the maximum number of attempts.",
+	}, []string{"operation"})
+
+	txMetricsOnce sync.Once
+)
+
+// Transactional begins a SQL transaction bound to the context `c`, executes `fn` and commits.
+// If `fn` returns an error or panics then the transaction is rolled back. If the transaction failed
+// because of a deadlock or any other transient error then it will be retried using `helpers.JitterBackoff`.
+// Example:
+//
+//	err := bean.Transactional(c.Request().Context(), db, func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return tx.Model(&stock).Update("Quantity", gorm.Expr("Quantity - ?", order.Quantity)).Error
+//	})
+func Transactional(c context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return TransactionalWithConfig(c, db, DefaultTxConfig, fn)
+}
+
+// TransactionalWithConfig is same as `Transactional` with a custom config.
+func TransactionalWithConfig(c context.Context, db *gorm.DB, config TxConfig, fn func(tx *gorm.DB) error) error {
+	if db == nil {
+		return errors.New("bean: transactional database connection is nil")
+	}
+
+	var sqlOpts []*sql.TxOptions
+	if config.SQLOptions != nil {
+		sqlOpts = append(sqlOpts, config.SQLOptions)
+	}
+
+	return runTransaction(c, "db.sql.transaction", config, func(ctx context.Context) error {
+		return db.WithContext(ctx).Transaction(fn, sqlOpts...)
+	})
+}
+
+// MongoTransactional starts a mongo session, executes `fn` inside a transaction and commits it.
+// If `fn` returns an error or panics then the transaction is aborted. Transient transaction errors
+// (labeled by the server) are retried using `helpers.JitterBackoff`. When the result of the commit is
+// unknown, only the commit is retried, because executing `fn` again would apply its writes twice.
+func MongoTransactional(c context.Context, client *mongo.Client, fn func(sc mongo.SessionContext) error) error {
+	return MongoTransactionalWithConfig(c, client, DefaultTxConfig, fn)
+}
+
+// MongoTransactionalWithConfig is same as `MongoTransactional` with a custom config.
+func MongoTransactionalWithConfig(c context.Context, client *mongo.Client, config TxConfig, fn func(sc mongo.SessionContext) error) error {
+	if client == nil {
+		return errors.New("bean: transactional mongo client is nil")
+	}
+
+	config = config.withDefaults()
+
+	return runTransaction(c, "db.mongo.transaction", config, func(ctx context.Context) error {
+		session, err := client.StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+
+		return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) (err error) {
+			if err = session.StartTransaction(); err != nil {
+				return err
+			}
+
+			defer func() {
+				if p := recover(); p != nil {
+					_ = session.AbortTransaction(context.Background())
+					panic(p)
+				}
+
+				if err != nil {
+					_ = session.AbortTransaction(context.Background())
+				}
+			}()
+
+			if err = fn(sc); err != nil {
+				return err
+			}
+
+			return commitMongoTransaction(sc, session, config)
+		})
+	})
+}
+
+// RetryTx executes `fn` again with `helpers.JitterBackoff` while it fails with a retryable error, for the
+// code which manages its own transaction. (example: `db.Transaction` with nested savepoints)
+// `fn` must execute the whole transaction, a retry inside an open transaction doesn't help.
+// Example:
+//
+//	err := bean.RetryTx(ctx, bean.DefaultTxConfig, func(ctx context.Context) error {
+//		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+//			...
+//		})
+//	})
+func RetryTx(c context.Context, config TxConfig, fn func(ctx context.Context) error) error {
+	return runTransaction(c, "db.transaction.retry", config, fn)
+}
+
+// IsRetryableTxError reports whether the transaction failed because of a transient error, like a
+// deadlock, lock wait timeout or serialization failure in MySQL or a `TransientTransactionError` in mongo.
+// An `UnknownTransactionCommitResult` is not, the commit may have been applied. (see `MongoTransactional`)
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrLockDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout ||
+			mysqlErr.Number == mysqlErrCheckRead
+	}
+
+	var mongoErr mongo.ServerError
+	if errors.As(err, &mongoErr) {
+		return mongoErr.HasErrorLabel(mongoLabelTransientTx)
+	}
+
+	return false
+}
+
+// runTransaction executes `attempt` until it succeeds, fails with a non-retryable error or the maximum
+// number of attempts is reached. A sentry span is started for the whole transaction and a breadcrumb is
+// added to the hub for every rollback.
+func runTransaction(c context.Context, operation string, config TxConfig, attempt func(ctx context.Context) error) (err error) {
+	config = config.withDefaults()
+
+	ctx := c
+	if txSentryOn(c) {
+		span := sentry.StartSpan(c, operation)
+		span.Description = helpers.CurrFuncName()
+		defer span.Finish()
+		ctx = span.Context()
+	}
+
+	for i := 0; i < config.MaxAttempts; i++ {
+		err = attempt(ctx)
+		if err == nil {
+			return nil
+		}
+
+		retryable := config.IsRetryable(err)
+		addTxBreadcrumb(ctx, operation, i+1, retryable, err)
+
+		if !retryable {
+			return err
+		}
+
+		// Don't need to wait when no retries left.
+		if i == config.MaxAttempts-1 {
+			txMetrics()
+			txExhausted.WithLabelValues(operation).Inc()
+			return err
+		}
+
+		txMetrics()
+		txRetries.WithLabelValues(operation, txRetryReason(err)).Inc()
+
+		select {
+		case <-time.After(helpers.JitterBackoff(config.MinBackoff, config.MaxBackoff, i)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// commitMongoTransaction commits the transaction of `session`. The commit alone is retried while the server
+// labels its result as unknown, the transaction may already be committed and `fn` must not be executed again.
+func commitMongoTransaction(sc mongo.SessionContext, session mongo.Session, config TxConfig) (err error) {
+	for i := 0; i < config.MaxAttempts; i++ {
+		err = session.CommitTransaction(sc)
+
+		var mongoErr mongo.ServerError
+		if !errors.As(err, &mongoErr) || !mongoErr.HasErrorLabel(mongoLabelUnknownCommit) {
+			return err
+		}
+
+		if i == config.MaxAttempts-1 {
+			break
+		}
+
+		select {
+		case <-time.After(helpers.JitterBackoff(config.MinBackoff, config.MaxBackoff, i)):
+		case <-sc.Done():
+			return sc.Err()
+		}
+	}
+
+	return err
+}
+
+// withDefaults returns a copy of the config with the zero values replaced by `DefaultTxConfig`.
+func (config TxConfig) withDefaults() TxConfig {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultTxConfig.MaxAttempts
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultTxConfig.MinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultTxConfig.MaxBackoff
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = DefaultTxConfig.IsRetryable
+	}
+
+	return config
+}
+
+// txSentryOn reports whether sentry is enabled in the config of the bean instance of `ctx`, or in the global
+// config if `ctx` doesn't carry one.
+func txSentryOn(ctx context.Context) bool {
+	if b := FromContext(ctx); b != nil {
+		return b.Config.Sentry.On
+	}
+
+	return BeanConfig.Sentry.On
+}
+
+// txRetryReason classifies a retryable error for the `bean_tx_retries_total` metric.
+func txRetryReason(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrLockDeadlock:
+			return TxRetryDeadlock
+		case mysqlErrLockWaitTimeout:
+			return TxRetryLockWait
+		case mysqlErrCheckRead:
+			return TxRetrySerialization
+		}
+	}
+
+	var mongoErr mongo.ServerError
+	if errors.As(err, &mongoErr) {
+		return TxRetryTransient
+	}
+
+	return TxRetryOther
+}
+
+// txMetrics registers the transaction metrics into the default prometheus registry on the first retry,
+// so that they are served by the `/metrics` endpoint without polluting the registry of the projects
+// which never retry.
+func txMetrics() {
+	txMetricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		txRetries = helpers.RegisterCollector(prometheus.DefaultRegisterer, txRetries)
+		txExhausted = helpers.RegisterCollector(prometheus.DefaultRegisterer, txExhausted)
+	})
+}
+
+// addTxBreadcrumb adds the rollback to the sentry hub of `ctx`. It's skipped without one, because the
+// global hub is shared by all the requests.
+func addTxBreadcrumb(ctx context.Context, operation string, attempt int, retryable bool, err error) {
+	if !txSentryOn(ctx) {
+		return
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		return
+	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: operation,
+		Message:  fmt.Sprintf("transaction rolled back (attempt %d)", attempt),
+		Level:    sentry.LevelWarning,
+		Data: map[string]interface{}{
+			"error":     err.Error(),
+			"retryable": retryable,
+		},
+	}, nil)
+}
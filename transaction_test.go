@@ -0,0 +1,131 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	assert.False(t, IsRetryableTxError(nil))
+	assert.False(t, IsRetryableTxError(errors.New("fake")))
+	assert.True(t, IsRetryableTxError(&mysql.MySQLError{Number: 1213, Message: "deadlock"}))
+	assert.True(t, IsRetryableTxError(&mysql.MySQLError{Number: 1205, Message: "lock wait timeout"}))
+	assert.False(t, IsRetryableTxError(&mysql.MySQLError{Number: 1062, Message: "duplicate entry"}))
+	assert.True(t, IsRetryableTxError(mongo.CommandError{Labels: []string{"TransientTransactionError"}}))
+	assert.False(t, IsRetryableTxError(mongo.CommandError{Labels: []string{"UnknownTransactionCommitResult"}}))
+}
+
+func TestRunTransactionRetry(t *testing.T) {
+	config := TxConfig{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+	}
+
+	attempts := 0
+	err := runTransaction(context.Background(), "test", config, func(ctx context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return &mysql.MySQLError{Number: 1213, Message: "deadlock"}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	err = runTransaction(context.Background(), "test", config, func(ctx context.Context) error {
+		attempts++
+		return errors.New("fake")
+	})
+	assert.EqualError(t, err, "fake")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryTxMetrics(t *testing.T) {
+	config := TxConfig{
+		MaxAttempts: 2,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+	}
+
+	retries := testutil.ToFloat64(txRetries.WithLabelValues("db.transaction.retry", TxRetrySerialization))
+	exhausted := testutil.ToFloat64(txExhausted.WithLabelValues("db.transaction.retry"))
+
+	attempts := 0
+	err := RetryTx(context.Background(), config, func(ctx context.Context) error {
+		attempts++
+		return &mysql.MySQLError{Number: 1020, Message: "record has changed since last read"}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, retries+1, testutil.ToFloat64(txRetries.WithLabelValues("db.transaction.retry", TxRetrySerialization)))
+	assert.Equal(t, exhausted+1, testutil.ToFloat64(txExhausted.WithLabelValues("db.transaction.retry")))
+}
+
+func TestAddTxBreadcrumb(t *testing.T) {
+	defer func(config Config) { BeanConfig = config }(BeanConfig)
+	BeanConfig.Sentry.On = true
+
+	breadcrumbs := func(hub *sentry.Hub) []*sentry.Breadcrumb {
+		return hub.Scope().ApplyToEvent(&sentry.Event{}, nil).Breadcrumbs
+	}
+
+	hub := sentry.NewHub(nil, sentry.NewScope())
+	addTxBreadcrumb(sentry.SetHubOnContext(context.Background(), hub), "db.transaction", 1, true, errors.New("deadlock"))
+	if crumbs := breadcrumbs(hub); assert.Len(t, crumbs, 1) {
+		assert.Equal(t, "db.transaction", crumbs[0].Category)
+		assert.Equal(t, "deadlock", crumbs[0].Data["error"])
+	}
+
+	// Without a hub in the context, the global hub is left untouched.
+	global := len(breadcrumbs(sentry.CurrentHub()))
+	addTxBreadcrumb(context.Background(), "db.transaction", 1, true, errors.New("deadlock"))
+	assert.Len(t, breadcrumbs(sentry.CurrentHub()), global)
+}
+
+func TestMongoTransactionalUnknownCommitResult(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("commit retried alone", func(mt *mtest.T) {
+		unknown := mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    50,
+			Name:    "MaxTimeMSExpired",
+			Message: "operation exceeded time limit",
+			Labels:  []string{"UnknownTransactionCommitResult"},
+		})
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), unknown, mtest.CreateSuccessResponse())
+
+		config := TxConfig{MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+		calls := 0
+		err := MongoTransactionalWithConfig(context.Background(), mt.Client, config, func(sc mongo.SessionContext) error {
+			calls++
+			_, err := mt.Coll.InsertOne(sc, bson.M{"name": "order"})
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+
+		commits := 0
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "commitTransaction" {
+				commits++
+			}
+		}
+		assert.Equal(t, 2, commits)
+	})
+}
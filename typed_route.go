@@ -0,0 +1,187 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/openapi"
+	"github.com/retail-ai-inc/bean/response"
+)
+
+// Router registers the routes with the options, it's implemented by `Bean` and `RouteGroup`.
+type Router interface {
+	Add(method, path string, h echo.HandlerFunc, opts ...RouteOption) *echo.Route
+}
+
+// TypedHandler handles the bound and validated request `Req` of a typed route and returns the data of the
+// response.
+type TypedHandler[Req, Resp any] func(c echo.Context, req Req) (Resp, error)
+
+// GET registers a typed GET route, see `Handle`.
+// Example:
+//
+//	type getProductRequest struct {
+//		ID uint64 `param:"id" json:"-" validate:"required"`
+//	}
+//
+//	bean.GET(b, "/products/:id", func(c echo.Context, req getProductRequest) (*models.Product, error) {
+//		return productSvc.GetProduct(c.Request().Context(), req.ID)
+//	})
+func GET[Req, Resp any](r Router, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	return Handle(r, http.MethodGet, path, h, opts...)
+}
+
+// POST registers a typed POST route, see `Handle`.
+func POST[Req, Resp any](r Router, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	return Handle(r, http.MethodPost, path, h, opts...)
+}
+
+// PUT registers a typed PUT route, see `Handle`.
+func PUT[Req, Resp any](r Router, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	return Handle(r, http.MethodPut, path, h, opts...)
+}
+
+// PATCH registers a typed PATCH route, see `Handle`.
+func PATCH[Req, Resp any](r Router, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	return Handle(r, http.MethodPatch, path, h, opts...)
+}
+
+// DELETE registers a typed DELETE route, see `Handle`.
+func DELETE[Req, Resp any](r Router, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	return Handle(r, http.MethodDelete, path, h, opts...)
+}
+
+// Handle registers a typed route. The request `Req`, a struct, is bound from the path parameters (`param`
+// tag), the query parameters (`query` tag) and the JSON body with `Echo.Binder`, then validated with
+// `Echo.Validator`. The returned data is sent in the `response.Envelope` with `201 Created` for a POST and
+// `200 OK` otherwise, unless the handler has already written the response. The binding errors are
+// `PROBLEM_PARSING_JSON` API errors and the other errors go to the error handlers as usual.
+//
+// The route is described in the OpenAPI document with `Req` and `Resp`, the fields set by `WithDoc` win.
+// Its contract is `Req` and the envelope of `Resp` unless it's set by `WithContract`.
+func Handle[Req, Resp any](r Router, method, path string, h TypedHandler[Req, Resp], opts ...RouteOption) *echo.Route {
+	opts = append(append([]RouteOption(nil), opts...), withTypedDoc[Req, Resp](method), withTypedContract[Req, Resp](method))
+	return r.Add(method, path, Typed(method, h), opts...)
+}
+
+// Typed returns the `echo.HandlerFunc` of a typed handler of `method`, to register it without `Handle`.
+func Typed[Req, Resp any](method string, h TypedHandler[Req, Resp]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req Req
+		if err := bindTyped(c, &req); err != nil {
+			return berror.NewAPIError(http.StatusBadRequest, berror.PROBLEM_PARSING_JSON, err)
+		}
+
+		if isStruct[Req]() && c.Echo().Validator != nil {
+			if err := c.Validate(req); err != nil {
+				return err
+			}
+		}
+
+		resp, err := h(c, req)
+		if err != nil {
+			return err
+		}
+		if c.Response().Committed {
+			return nil
+		}
+
+		if method == http.MethodPost {
+			return response.Created(c, resp)
+		}
+		return response.OK(c, resp)
+	}
+}
+
+func bindTyped[Req any](c echo.Context, req *Req) error {
+	if !isStruct[Req]() {
+		return nil
+	}
+
+	// IMPORTANT: `binder.CustomBinder` only decodes the JSON body, the parameters are bound here.
+	params := &echo.DefaultBinder{}
+	if err := params.BindPathParams(c, req); err != nil {
+		return err
+	}
+	if err := params.BindQueryParams(c, req); err != nil {
+		return err
+	}
+
+	if c.Request().ContentLength == 0 {
+		return nil
+	}
+	return c.Echo().Binder.Bind(req, c)
+}
+
+func isStruct[T any]() bool {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return t.Kind() == reflect.Struct
+}
+
+// withTypedDoc completes the doc of a typed route with its request and response types.
+func withTypedDoc[Req, Resp any](method string) RouteOption {
+	return func(o *routeOptions) {
+		var doc openapi.Doc
+		if o.doc != nil {
+			doc = *o.doc
+		}
+
+		if isStruct[Req]() {
+			var req Req
+			if doc.Query == nil {
+				doc.Query = req
+			}
+			if doc.Request == nil && (method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch) {
+				doc.Request = req
+			}
+		}
+
+		if doc.Responses == nil {
+			status := http.StatusOK
+			if method == http.MethodPost {
+				status = http.StatusCreated
+			}
+			doc.Responses = map[int]interface{}{status: response.TypedEnvelope[Resp]{}}
+		}
+
+		o.doc = &doc
+	}
+}
+
+// withTypedContract sets the contract of a typed route to its request and response types.
+func withTypedContract[Req, Resp any](method string) RouteOption {
+	return func(o *routeOptions) {
+		if o.contract != nil {
+			return
+		}
+
+		o.contract = &routeContract{response: reflect.TypeOf(response.TypedEnvelope[Resp]{})}
+		if isStruct[Req]() && (method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch) {
+			o.contract.request = reflect.TypeOf((*Req)(nil)).Elem()
+		}
+	}
+}
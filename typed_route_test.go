@@ -0,0 +1,102 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	validatorV10 "github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/binder"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/openapi"
+	"github.com/retail-ai-inc/bean/response"
+	"github.com/retail-ai-inc/bean/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type typedProduct struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+type updateTypedProductRequest struct {
+	ID     uint64 `param:"id" json:"-"`
+	DryRun bool   `query:"dryRun" json:"-"`
+	Name   string `json:"name" validate:"required"`
+	Price  int    `json:"price" validate:"min=0"`
+}
+
+func TestHandle(t *testing.T) {
+	OpenAPI = openapi.NewSpec()
+	defer func() { OpenAPI = nil }()
+
+	e := echo.New()
+	e.Binder = &binder.CustomBinder{}
+	e.Validator = &validator.DefaultValidator{Validator: validatorV10.New()}
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		_, _ = response.ErrorHanderFunc(err, c)
+	}
+	b := &Bean{Echo: e}
+
+	var dryRun bool
+	api := b.Group("/api")
+	PUT(api, "/products/:id", func(c echo.Context, req updateTypedProductRequest) (typedProduct, error) {
+		dryRun = req.DryRun
+		return typedProduct{ID: req.ID, Name: req.Name, Price: req.Price}, nil
+	}, WithDoc(openapi.Doc{Summary: "Update a product"}))
+	POST(b, "/products", func(c echo.Context, req updateTypedProductRequest) (*typedProduct, error) {
+		return nil, berror.NewAPIError(http.StatusConflict, berror.API_DATA_VALIDATION_FAILED, errors.New("duplicated name"))
+	})
+	GET(b, "/ping", func(c echo.Context, _ struct{}) (string, error) {
+		return "pong", nil
+	})
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPut, "/api/products/42?dryRun=true", `{"name":"Apple","price":120}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"code":"000000","message":"OK","data":{"id":42,"name":"Apple","price":120}}`, rec.Body.String())
+	assert.True(t, dryRun)
+
+	rec = serve(http.MethodPut, "/api/products/42", `{"price":120}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"`+string(berror.API_DATA_VALIDATION_FAILED)+`"`)
+
+	rec = serve(http.MethodPut, "/api/products/apple", `{"name":"Apple"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"`+string(berror.PROBLEM_PARSING_JSON)+`"`)
+
+	rec = serve(http.MethodPost, "/products", `{"name":"Apple"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serve(http.MethodGet, "/ping", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"code":"000000","message":"OK","data":"pong"}`, rec.Body.String())
+
+	doc := OpenAPI.Generate(openapi.Info{Title: "Shop"}, e.Routes())
+	put := doc.Paths["/api/products/{id}"]["put"]
+	require.NotNil(t, put)
+	assert.Equal(t, "Update a product", put.Summary)
+	assert.Equal(t, "#/components/schemas/updateTypedProductRequest", put.RequestBody.Content[echo.MIMEApplicationJSON].Schema.Ref)
+	require.Len(t, put.Parameters, 2)
+	assert.Equal(t, "dryRun", put.Parameters[1].Name)
+	assert.Equal(t, "#/components/schemas/TypedEnvelope_typedProduct", put.Responses["200"].Content[echo.MIMEApplicationJSON].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/typedProduct", doc.Components.Schemas["TypedEnvelope_typedProduct"].Properties["data"].Ref)
+	assert.Contains(t, doc.Paths["/products"]["post"].Responses, "201")
+	assert.Nil(t, doc.Paths["/ping"]["get"].RequestBody)
+}
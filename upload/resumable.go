@@ -0,0 +1,603 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/storage"
+)
+
+// TusVersion is the version of the tus protocol implemented by `Resumable`.
+const TusVersion = "1.0.0"
+
+// StatusChecksumMismatch is the status of a chunk whose `Upload-Checksum` doesn't match its content.
+const StatusChecksumMismatch = 460
+
+// ErrChecksum is the reason of a rejected chunk whose checksum doesn't match.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// ResumableConfig defines the rules of `Resumable`.
+type ResumableConfig struct {
+	// Filesystem stores the chunks and the assembled files.
+	// Required.
+	Filesystem storage.Filesystem
+
+	// Sessions keeps the state of the uploads. Use a `RedisSessionStore` when the service has several replicas.
+	// Optional. Default value a `MemorySessionStore`.
+	Sessions SessionStore
+
+	// MaxSize is the maximum size of a file in bytes.
+	// Optional. Default value 1GB.
+	MaxSize int64
+
+	// ChunkSize is the maximum size of the body of a `PATCH` request in bytes.
+	// Optional. Default value 8MB.
+	ChunkSize int64
+
+	// Expiration is how long an upload can be resumed after its creation.
+	// Optional. Default value 24 hours.
+	Expiration time.Duration
+
+	// PartsPrefix is the key prefix of the chunks in `Filesystem`.
+	// Optional. Default value "uploads/.parts/".
+	PartsPrefix string
+
+	// Extensions are the accepted extensions of the "filename" metadata, like ".mp4".
+	// Optional. Default value nil, all the extensions are accepted.
+	Extensions []string
+
+	// MIMETypes are the accepted types sniffed from the assembled content, like "video/*".
+	// Optional. Default value nil, all the types are accepted.
+	MIMETypes []string
+
+	// KeyFunc returns the key of the assembled file.
+	// Optional. Default value "uploads/" followed by the ID of the session.
+	KeyFunc func(s *Session) string
+
+	// OnComplete is called after the file is assembled, in the request of the last chunk. An error fails
+	// the request but the upload stays completed.
+	// Optional.
+	OnComplete func(c echo.Context, s *Session) error
+}
+
+// DefaultResumableConfig is the default config of `NewResumable`.
+var DefaultResumableConfig = ResumableConfig{
+	MaxSize:     1 << 30,
+	ChunkSize:   8 << 20,
+	Expiration:  24 * time.Hour,
+	PartsPrefix: "uploads/.parts/",
+}
+
+// Resumable serves the core, creation, checksum, expiration and termination parts of the tus protocol
+// (https://tus.io/protocols/resumable-upload), so that the clients on a poor network, like the devices
+// of the stores, upload the large files in chunks and resume an interrupted upload from the last
+// received chunk. Each chunk is stored in `Filesystem` as soon as it's received, then the chunks are
+// assembled into the final file after the last one. A chunk interrupted in the middle is discarded, the
+// client gets the offset to resume from with a `HEAD` request.
+type Resumable struct {
+	config ResumableConfig
+}
+
+// NewResumable returns the handlers of the resumable uploads, register them with `Resumable.Mount`.
+// Example:
+//
+//	uploads := upload.NewResumable(upload.ResumableConfig{
+//		Filesystem: bean.Storage,
+//		Sessions:   upload.NewRedisSessionStore(redisClient, ""),
+//		MIMETypes:  []string{"video/*"},
+//		OnComplete: hdlrs.videoHdlr.Uploaded,
+//	})
+//	uploads.Mount(b.Echo.Group("/videos/uploads", middleware.RequireAPIKeyScopes("videos:write")))
+func NewResumable(config ResumableConfig) *Resumable {
+	if config.Sessions == nil {
+		config.Sessions = NewMemorySessionStore()
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultResumableConfig.MaxSize
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultResumableConfig.ChunkSize
+	}
+	if config.Expiration <= 0 {
+		config.Expiration = DefaultResumableConfig.Expiration
+	}
+	if config.PartsPrefix == "" {
+		config.PartsPrefix = DefaultResumableConfig.PartsPrefix
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(s *Session) string {
+			return "uploads/" + s.ID
+		}
+	}
+
+	return &Resumable{config: config}
+}
+
+// Mount registers the endpoints of the protocol on the group, the URL of an upload is the path of the
+// group followed by the ID of the session.
+func (r *Resumable) Mount(g *echo.Group) {
+	g.OPTIONS("", r.options)
+	g.POST("", r.create)
+	g.HEAD("/:id", r.head)
+	g.PATCH("/:id", r.patch)
+	g.DELETE("/:id", r.terminate)
+}
+
+// Session returns the session of an upload, like to check its checksum.
+func (r *Resumable) Session(c context.Context, id string) (*Session, error) {
+	return r.config.Sessions.Get(c, id)
+}
+
+// Purge deletes the chunks of the sessions which have expired, run it periodically.
+func (r *Resumable) Purge(c context.Context) error {
+	infos, err := r.config.Filesystem.List(c, r.config.PartsPrefix)
+	if err != nil {
+		return err
+	}
+
+	expired := map[string]bool{}
+	for _, info := range infos {
+		id, _, _ := strings.Cut(strings.TrimPrefix(info.Key, r.config.PartsPrefix), "/")
+		if _, ok := expired[id]; !ok {
+			_, err := r.config.Sessions.Get(c, id)
+			if err != nil && !errors.Is(err, ErrSessionNotFound) {
+				return err
+			}
+			expired[id] = err != nil
+		}
+		if expired[id] {
+			if err := r.config.Filesystem.Delete(c, info.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Resumable) options(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set("Tus-Resumable", TusVersion)
+	header.Set("Tus-Version", TusVersion)
+	header.Set("Tus-Extension", "creation,checksum,expiration,termination")
+	header.Set("Tus-Max-Size", strconv.FormatInt(r.config.MaxSize, 10))
+	header.Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (r *Resumable) create(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	length, err := strconv.ParseInt(c.Request().Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return invalid(errors.New("Upload-Length is invalid"))
+	}
+	if length > r.config.MaxSize {
+		return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrTooLarge)
+	}
+
+	metadata, err := parseMetadata(c.Request().Header.Get("Upload-Metadata"))
+	if err != nil {
+		return invalid(err)
+	}
+	if len(r.config.Extensions) > 0 {
+		filename := filepath.Base(metadata["filename"])
+		if !contains(r.config.Extensions, strings.ToLower(filepath.Ext(filename))) {
+			return rejected(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, ErrExtension, filename)
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	session := &Session{
+		ID:        id,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(r.config.Expiration),
+	}
+	if err := r.config.Sessions.Save(c.Request().Context(), session); err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+id)
+	header.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	// An empty file is complete as soon as it's created.
+	if length == 0 {
+		if err := r.complete(c, session); err != nil {
+			return err
+		}
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func (r *Resumable) head(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	session, err := r.session(c)
+	if err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	header.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	if len(session.Metadata) > 0 {
+		header.Set("Upload-Metadata", formatMetadata(session.Metadata))
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (r *Resumable) patch(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+	req := c.Request()
+	if req.Header.Get(echo.HeaderContentType) != "application/offset+octet-stream" {
+		return berror.NewIgnorableAPIError(http.StatusUnsupportedMediaType, berror.UNSUPPORTED_MEDIA_TYPE,
+			errors.New("Content-Type must be application/offset+octet-stream"))
+	}
+
+	session, err := r.session(c)
+	if err != nil {
+		return err
+	}
+
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return invalid(errors.New("Upload-Offset is invalid"))
+	}
+	if offset != session.Offset {
+		return conflict(session.Offset)
+	}
+
+	checksum, err := parseChecksum(req.Header.Get("Upload-Checksum"))
+	if err != nil {
+		return invalid(err)
+	}
+
+	// The chunks of an upload interrupted after the last chunk are assembled by an empty `PATCH`.
+	if session.Offset < session.Length {
+		if session, err = r.receive(c, session, checksum); err != nil {
+			return err
+		}
+	}
+	if session.Offset == session.Length && !session.Completed() {
+		if err := r.complete(c, session); err != nil {
+			return err
+		}
+	}
+
+	c.Response().Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Response().Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// receive stores the body of the request as the next chunk of the session.
+func (r *Resumable) receive(c echo.Context, session *Session, checksum *chunkChecksum) (*Session, error) {
+	ctx := c.Request().Context()
+
+	limit := session.Length - session.Offset
+	if limit > r.config.ChunkSize {
+		limit = r.config.ChunkSize
+	}
+
+	suffix, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	// IMPORTANT: the key of the chunk is unique, so that a concurrent request at the same offset never
+	// replaces the chunk of the request which wins the offset.
+	part := fmt.Sprintf("%s%s/%020d-%s", r.config.PartsPrefix, session.ID, session.Offset, suffix[:8])
+
+	body := &chunkReader{r: c.Request().Body, limit: limit}
+	var reader io.Reader = body
+	if checksum != nil {
+		reader = io.TeeReader(body, checksum.hash)
+	}
+
+	if err := r.config.Filesystem.Put(ctx, part, reader, storage.PutOptions{ContentType: "application/octet-stream"}); err != nil {
+		r.discard(ctx, part)
+		if body.tooLarge {
+			return nil, berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrTooLarge)
+		}
+		// The connection of the client has been interrupted, it resumes from the current offset.
+		return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, errors.WithStack(err))
+	}
+
+	if checksum != nil && !checksum.matches() {
+		r.discard(ctx, part)
+		return nil, berror.NewIgnorableAPIError(StatusChecksumMismatch, berror.API_DATA_VALIDATION_FAILED, ErrChecksum)
+	}
+	if body.n == 0 {
+		r.discard(ctx, part)
+		return session, nil
+	}
+
+	advanced, err := r.config.Sessions.Advance(ctx, session.ID, session.Offset, body.n, part)
+	if err != nil {
+		r.discard(ctx, part)
+		if errors.Is(err, ErrOffsetMismatch) {
+			if current, err := r.config.Sessions.Get(ctx, session.ID); err == nil {
+				return nil, conflict(current.Offset)
+			}
+			return nil, conflict(session.Offset)
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, echo.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return advanced, nil
+}
+
+// complete assembles the chunks of the session into its file and deletes them.
+func (r *Resumable) complete(c echo.Context, session *Session) error {
+	ctx := c.Request().Context()
+
+	// The first 512 bytes are enough to sniff the type.
+	var head bytes.Buffer
+	sniffer := &limitedBuffer{Buffer: &head, limit: 512}
+	if len(session.Parts) > 0 {
+		if err := r.copyParts(ctx, session.Parts[:1], sniffer); err != nil {
+			return err
+		}
+	}
+	session.ContentType = http.DetectContentType(head.Bytes())
+	if len(r.config.MIMETypes) > 0 && !matchMIMEType(r.config.MIMETypes, session.ContentType) {
+		r.terminateSession(ctx, session)
+		return rejected(http.StatusUnsupportedMediaType, berror.UNSUPPORTED_MEDIA_TYPE, ErrMIMEType, session.Metadata["filename"])
+	}
+
+	key := r.config.KeyFunc(session)
+	hasher := sha256.New()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.copyParts(ctx, session.Parts, io.MultiWriter(pw, hasher)))
+	}()
+	err := r.config.Filesystem.Put(ctx, key, pr, storage.PutOptions{ContentType: session.ContentType})
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	session.Key = key
+	session.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	parts := session.Parts
+	session.Parts = nil
+	if err := r.config.Sessions.Save(ctx, session); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		r.discard(ctx, part)
+	}
+
+	if r.config.OnComplete != nil {
+		return r.config.OnComplete(c, session)
+	}
+	return nil
+}
+
+// copyParts writes the content of the chunks to `w` in order.
+func (r *Resumable) copyParts(c context.Context, parts []string, w io.Writer) error {
+	for _, part := range parts {
+		f, err := r.config.Filesystem.Get(c, part)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (r *Resumable) terminate(c echo.Context) error {
+	if err := checkTusVersion(c); err != nil {
+		return err
+	}
+
+	session, err := r.session(c)
+	if err != nil {
+		return err
+	}
+	r.terminateSession(c.Request().Context(), session)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// terminateSession deletes the session and its chunks, the assembled file is kept.
+func (r *Resumable) terminateSession(c context.Context, session *Session) {
+	_ = r.config.Sessions.Delete(c, session.ID)
+	for _, part := range session.Parts {
+		r.discard(c, part)
+	}
+}
+
+// discard deletes a chunk, a failure only leaves the chunk to `Purge`.
+func (r *Resumable) discard(c context.Context, part string) {
+	_ = r.config.Filesystem.Delete(c, part)
+}
+
+func (r *Resumable) session(c echo.Context) (*Session, error) {
+	session, err := r.config.Sessions.Get(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	return session, err
+}
+
+func checkTusVersion(c echo.Context) error {
+	c.Response().Header().Set("Tus-Resumable", TusVersion)
+
+	if c.Request().Header.Get("Tus-Resumable") != TusVersion {
+		c.Response().Header().Set("Tus-Version", TusVersion)
+		return berror.NewIgnorableAPIError(http.StatusPreconditionFailed, berror.PRECONDITION_FAILED,
+			errors.Errorf("Tus-Resumable must be %s", TusVersion))
+	}
+	return nil
+}
+
+func invalid(err error) error {
+	return berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, err)
+}
+
+// conflict tells the client to resume from `offset`.
+func conflict(offset int64) error {
+	return berror.NewIgnorableAPIError(http.StatusConflict, berror.RESOURCE_CONFLICT,
+		errors.Errorf("Upload-Offset must be %d", offset))
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseMetadata parses the `Upload-Metadata` header, the comma separated keys followed by a space and
+// their base64 value.
+func parseMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Upload-Metadata has an empty key")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Errorf("Upload-Metadata %q is not base64", key)
+		}
+		metadata[key] = string(decoded)
+	}
+
+	return metadata, nil
+}
+
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+type chunkChecksum struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+func (c *chunkChecksum) matches() bool {
+	return bytes.Equal(c.hash.Sum(nil), c.expected)
+}
+
+// parseChecksum parses the `Upload-Checksum` header, the algorithm followed by a space and the base64 checksum.
+func parseChecksum(header string) (*chunkChecksum, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	algorithm, value, _ := strings.Cut(header, " ")
+	expected, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("Upload-Checksum is not base64")
+	}
+
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return &chunkChecksum{hash: md5.New(), expected: expected}, nil
+	case "sha1":
+		return &chunkChecksum{hash: sha1.New(), expected: expected}, nil
+	case "sha256":
+		return &chunkChecksum{hash: sha256.New(), expected: expected}, nil
+	}
+
+	return nil, errors.Errorf("Upload-Checksum algorithm %q is not supported", algorithm)
+}
+
+// chunkReader reads the body of a chunk and fails if it's bigger than `limit`.
+type chunkReader struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	tooLarge bool
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		r.tooLarge = true
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,216 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResumableServer(t *testing.T, config ResumableConfig) (*echo.Echo, storage.Filesystem) {
+	t.Helper()
+
+	fs, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	require.NoError(t, err)
+	config.Filesystem = fs
+
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		status := http.StatusInternalServerError
+		var apiErr *berror.APIError
+		var httpErr *echo.HTTPError
+		if errors.As(err, &apiErr) {
+			status = apiErr.HTTPStatusCode
+		} else if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		}
+		_ = c.NoContent(status)
+	}
+	NewResumable(config).Mount(e.Group("/uploads"))
+
+	return e, fs
+}
+
+func tusRequest(e *echo.Echo, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", TusVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func patchChunk(e *echo.Echo, location string, offset, body string, headers ...string) *httptest.ResponseRecorder {
+	h := map[string]string{
+		echo.HeaderContentType: "application/offset+octet-stream",
+		"Upload-Offset":        offset,
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		h[headers[i]] = headers[i+1]
+	}
+	return tusRequest(e, http.MethodPatch, location, body, h)
+}
+
+func TestResumable(t *testing.T) {
+	var completed *Session
+	e, fs := newResumableServer(t, ResumableConfig{
+		ChunkSize:  8,
+		Extensions: []string{".txt"},
+		MIMETypes:  []string{"text/plain"},
+		KeyFunc:    func(s *Session) string { return "docs/" + s.Metadata["filename"] },
+		OnComplete: func(c echo.Context, s *Session) error {
+			completed = s
+			return nil
+		},
+	})
+
+	rec := tusRequest(e, http.MethodOptions, "/uploads", "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "creation,checksum,expiration,termination", rec.Header().Get("Tus-Extension"))
+
+	content := "hello resumable world"
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+
+	rec = tusRequest(e, http.MethodPost, "/uploads", "", map[string]string{"Upload-Length": "21"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the extension of the filename is checked")
+	rec = tusRequest(e, http.MethodPost, "/uploads", "", map[string]string{"Upload-Length": "21", "Tus-Resumable": "0.2.0", "Upload-Metadata": metadata})
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = tusRequest(e, http.MethodPost, "/uploads", "", map[string]string{"Upload-Length": "21", "Upload-Metadata": metadata})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get(echo.HeaderLocation)
+	assert.True(t, strings.HasPrefix(location, "/uploads/"))
+	assert.NotEmpty(t, rec.Header().Get("Upload-Expires"))
+
+	sum := sha1.Sum([]byte(content[:8]))
+	rec = patchChunk(e, location, "0", content[:8], "Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "8", rec.Header().Get("Upload-Offset"))
+
+	// A retried chunk at an old offset is told where to resume from.
+	rec = patchChunk(e, location, "0", content[:8])
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = patchChunk(e, location, "8", content[8:16], "Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	assert.Equal(t, StatusChecksumMismatch, rec.Code)
+	rec = patchChunk(e, location, "8", content[8:])
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "the chunk is bigger than the chunk size")
+
+	rec = tusRequest(e, http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "8", rec.Header().Get("Upload-Offset"))
+	assert.Equal(t, "21", rec.Header().Get("Upload-Length"))
+	assert.Equal(t, metadata, rec.Header().Get("Upload-Metadata"))
+
+	rec = patchChunk(e, location, "8", content[8:16])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Nil(t, completed)
+	rec = patchChunk(e, location, "16", content[16:])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "21", rec.Header().Get("Upload-Offset"))
+
+	require.NotNil(t, completed)
+	digest := sha256.Sum256([]byte(content))
+	assert.Equal(t, "docs/a.txt", completed.Key)
+	assert.Equal(t, hex.EncodeToString(digest[:]), completed.Checksum)
+	assert.Equal(t, "text/plain; charset=utf-8", completed.ContentType)
+
+	f, err := fs.Get(context.Background(), "docs/a.txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, content, string(data))
+
+	// The chunks are deleted once assembled.
+	parts, err := fs.List(context.Background(), DefaultResumableConfig.PartsPrefix)
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+
+	rec = tusRequest(e, http.MethodDelete, location, "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = tusRequest(e, http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestResumableRejectsType(t *testing.T) {
+	e, fs := newResumableServer(t, ResumableConfig{MIMETypes: []string{"image/*"}})
+
+	rec := tusRequest(e, http.MethodPost, "/uploads", "", map[string]string{"Upload-Length": "4"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get(echo.HeaderLocation)
+
+	rec = patchChunk(e, location, "0", "text")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	parts, err := fs.List(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+	rec = tusRequest(e, http.MethodHead, location, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestResumablePurge(t *testing.T) {
+	fs, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	require.NoError(t, err)
+	sessions := NewMemorySessionStore()
+	r := NewResumable(ResumableConfig{Filesystem: fs, Sessions: sessions})
+
+	ctx := context.Background()
+	require.NoError(t, sessions.Save(ctx, &Session{ID: "live", Length: 10, ExpiresAt: time.Now().Add(time.Hour)}))
+	for _, key := range []string{"uploads/.parts/live/0", "uploads/.parts/gone/0", "uploads/.parts/gone/5"} {
+		require.NoError(t, fs.Put(ctx, key, strings.NewReader("chunk"), storage.PutOptions{}))
+	}
+
+	require.NoError(t, r.Purge(ctx))
+
+	parts, err := fs.List(ctx, "uploads/.parts/")
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "uploads/.parts/live/0", parts[0].Key)
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	store := NewRedisSessionStore(client, "")
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	session := &Session{ID: "s1", Length: 10, Metadata: map[string]string{"filename": "a.txt"}, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.Save(ctx, session))
+
+	advanced, err := store.Advance(ctx, "s1", 0, 4, "part-0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), advanced.Offset)
+
+	_, err = store.Advance(ctx, "s1", 0, 4, "part-0-again")
+	assert.ErrorIs(t, err, ErrOffsetMismatch)
+
+	got, err := store.Get(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"part-0"}, got.Parts)
+	assert.Equal(t, "a.txt", got.Metadata["filename"])
+
+	require.NoError(t, store.Delete(ctx, "s1"))
+	_, err = store.Advance(ctx, "s1", 4, 6, "part-4")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
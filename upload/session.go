@@ -0,0 +1,248 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// The errors of a `SessionStore`.
+var (
+	ErrSessionNotFound = errors.New("upload session not found")
+	ErrOffsetMismatch  = errors.New("upload offset mismatch")
+)
+
+// Session is the state of a resumable upload. (see `Resumable`)
+type Session struct {
+	ID string `json:"id"`
+	// Length is the size of the whole file in bytes.
+	Length int64 `json:"length"`
+	// Offset is the number of bytes received.
+	Offset int64 `json:"offset"`
+	// Metadata is sent by the client when the upload is created, like "filename".
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Parts are the keys of the received chunks in the order of their offset.
+	Parts     []string  `json:"parts,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Key of the assembled file, set when the upload is completed.
+	Key string `json:"key,omitempty"`
+	// ContentType is sniffed from the content of the assembled file.
+	ContentType string `json:"contentType,omitempty"`
+	// Checksum is the hex encoded SHA-256 of the assembled file, for the end to end check of the client.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Completed returns true if the file has been assembled.
+func (s *Session) Completed() bool {
+	return s.Key != ""
+}
+
+// SessionStore keeps the upload sessions until they expire, shared by the replicas with `RedisSessionStore`.
+type SessionStore interface {
+	// Save creates or replaces the session until its `ExpiresAt`.
+	Save(c context.Context, s *Session) error
+	// Get returns the session, `ErrSessionNotFound` if it doesn't exist or has expired.
+	Get(c context.Context, id string) (*Session, error)
+	// Advance appends the chunk `part` of `n` bytes written at `offset`. It returns `ErrOffsetMismatch` if
+	// the offset of the session is not `offset` anymore, like after a concurrent request.
+	Advance(c context.Context, id string, offset, n int64, part string) (*Session, error)
+	// Delete removes the session, it doesn't fail if the session doesn't exist.
+	Delete(c context.Context, id string) error
+}
+
+// RedisSessionStore is a `SessionStore` shared by the replicas, the sessions are stored under `prefix`.
+type RedisSessionStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisSessionStore returns a store of the sessions under `prefix`, "upload:" if `prefix` is empty.
+func NewRedisSessionStore(client redis.UniversalClient, prefix string) *RedisSessionStore {
+	if prefix == "" {
+		prefix = "upload:"
+	}
+
+	return &RedisSessionStore{client: client, prefix: prefix}
+}
+
+// Save implements `SessionStore`.
+func (s *RedisSessionStore) Save(c context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(s.client.Set(c, s.prefix+session.ID, data, time.Until(session.ExpiresAt)).Err())
+}
+
+// Get implements `SessionStore`.
+func (s *RedisSessionStore) Get(c context.Context, id string) (*Session, error) {
+	return s.get(c, s.client, id)
+}
+
+func (s *RedisSessionStore) get(c context.Context, cmd redis.Cmdable, id string) (*Session, error) {
+	data, err := cmd.Get(c, s.prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &session, nil
+}
+
+// Advance implements `SessionStore`, the offset is compared and set in a redis transaction.
+func (s *RedisSessionStore) Advance(c context.Context, id string, offset, n int64, part string) (*Session, error) {
+	var session *Session
+
+	err := s.client.Watch(c, func(tx *redis.Tx) error {
+		var err error
+		if session, err = s.get(c, tx, id); err != nil {
+			return err
+		}
+		if session.Offset != offset {
+			return ErrOffsetMismatch
+		}
+		session.Offset += n
+		session.Parts = append(session.Parts, part)
+
+		data, err := json.Marshal(session)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.Set(c, s.prefix+id, data, time.Until(session.ExpiresAt))
+			return nil
+		})
+		return err
+	}, s.prefix+id)
+
+	// The key has been changed by another request between the read and the write.
+	if err == redis.TxFailedErr {
+		return nil, ErrOffsetMismatch
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return session, nil
+}
+
+// Delete implements `SessionStore`.
+func (s *RedisSessionStore) Delete(c context.Context, id string) error {
+	return errors.WithStack(s.client.Del(c, s.prefix+id).Err())
+}
+
+// MemorySessionStore is a `SessionStore` of the process, for a single instance.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore returns an in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+// Save implements `SessionStore`.
+func (s *MemorySessionStore) Save(c context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Sweep the expired sessions so that the map doesn't grow forever.
+	now := time.Now()
+	for id, existing := range s.sessions {
+		if now.After(existing.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+
+	s.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+// Get implements `SessionStore`.
+func (s *MemorySessionStore) Get(c context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+
+	session = copySession(&session)
+	return &session, nil
+}
+
+// Advance implements `SessionStore`.
+func (s *MemorySessionStore) Advance(c context.Context, id string, offset, n int64, part string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	if session.Offset != offset {
+		return nil, ErrOffsetMismatch
+	}
+
+	session = copySession(&session)
+	session.Offset += n
+	session.Parts = append(session.Parts, part)
+	s.sessions[id] = session
+
+	session = copySession(&session)
+	return &session, nil
+}
+
+// Delete implements `SessionStore`.
+func (s *MemorySessionStore) Delete(c context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// copySession returns a copy of the session not sharing its parts with the stored one.
+func copySession(s *Session) Session {
+	session := *s
+	session.Parts = append([]string(nil), s.Parts...)
+	return session
+}
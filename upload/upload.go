@@ -0,0 +1,391 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package upload reads the files of a multipart request into temporary files, validates their size,
+// extension, sniffed type and image dimensions, scans them and hands them off to `storage`.
+// The large files are uploaded in resumable chunks with the tus protocol of `Resumable`.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// The decoders of `image.DecodeConfig` for the dimension checks.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/storage"
+)
+
+// Config defines the rules of `Parse`.
+type Config struct {
+	// MaxSize is the maximum size of a file in bytes.
+	// Optional. Default value 10MB.
+	MaxSize int64
+
+	// MaxFiles is the maximum number of files.
+	// Optional. Default value 10.
+	MaxFiles int
+
+	// MaxValueBytes is the maximum size of all the form values which are not files.
+	// Optional. Default value 1MB.
+	MaxValueBytes int64
+
+	// Fields are the form fields of the files. The files of the other fields are rejected.
+	// Optional. Default value nil, all the fields are accepted.
+	Fields []string
+
+	// Extensions are the accepted file name extensions, like ".jpg".
+	// Optional. Default value nil, all the extensions are accepted.
+	Extensions []string
+
+	// MIMETypes are the accepted types sniffed from the content, like "image/png" or "image/*". The type
+	// sent by the client is never trusted.
+	// Optional. Default value nil, all the types are accepted.
+	MIMETypes []string
+
+	// MinWidth, MinHeight, MaxWidth and MaxHeight are the dimensions of the images in pixels. When one of
+	// them is set, the images must be a GIF, a JPEG or a PNG.
+	// Optional. Default value 0, the dimension is not checked.
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+
+	// Scanner scans the files for viruses after the other checks.
+	// Optional.
+	Scanner Scanner
+
+	// TempDir is the directory of the temporary files.
+	// Optional. Default value `os.TempDir()`.
+	TempDir string
+}
+
+// Scanner scans an uploaded file, like a client of ClamAV. It returns an error wrapping `ErrInfected` to
+// reject the file, any other error fails the upload with a 500.
+type Scanner interface {
+	Scan(c context.Context, f *File) error
+}
+
+// ScannerFunc is a function implementing `Scanner`.
+type ScannerFunc func(c context.Context, f *File) error
+
+// Scan implements `Scanner`.
+func (fn ScannerFunc) Scan(c context.Context, f *File) error {
+	return fn(c, f)
+}
+
+// The reasons of a rejected upload, wrapped in the `Err` of the returned `*berror.APIError`.
+var (
+	ErrTooLarge      = errors.New("file is too large")
+	ErrTooManyFiles  = errors.New("too many files")
+	ErrField         = errors.New("unexpected file field")
+	ErrExtension     = errors.New("file extension is not allowed")
+	ErrMIMEType      = errors.New("file type is not allowed")
+	ErrDimensions    = errors.New("image dimensions are not allowed")
+	ErrInvalidImage  = errors.New("image is invalid")
+	ErrInfected      = errors.New("file is infected")
+	ErrValueTooLarge = errors.New("form values are too large")
+)
+
+// DefaultConfig is the default config of `Parse`.
+var DefaultConfig = Config{
+	MaxSize:       10 << 20,
+	MaxFiles:      10,
+	MaxValueBytes: 1 << 20,
+}
+
+// File is an uploaded file stored in a temporary file until `Upload.Remove`.
+type File struct {
+	// Field is the form field of the file.
+	Field string
+	// Filename is the base name sent by the client, don't use it as a key without sanitizing it.
+	Filename string
+	// Ext is the lower case extension of `Filename`, like ".jpg".
+	Ext  string
+	Size int64
+	// ContentType is sniffed from the content, not the one sent by the client.
+	ContentType string
+	// Width and Height are the dimensions of a GIF, JPEG or PNG image, 0 otherwise.
+	Width  int
+	Height int
+
+	path string
+}
+
+// Open opens the temporary file.
+func (f *File) Open() (*os.File, error) {
+	file, err := os.Open(f.path)
+	return file, errors.WithStack(err)
+}
+
+// Store puts the file at `key` of `fs` with its sniffed type.
+func (f *File) Store(c context.Context, fs storage.Filesystem, key string) error {
+	file, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return fs.Put(c, key, file, storage.PutOptions{ContentType: f.ContentType})
+}
+
+// Upload is a parsed multipart request.
+type Upload struct {
+	Files  []*File
+	Values url.Values
+}
+
+// File returns the first file of the form field, nil if there is none.
+func (u *Upload) File(field string) *File {
+	for _, f := range u.Files {
+		if f.Field == field {
+			return f
+		}
+	}
+	return nil
+}
+
+// Store puts all the files to `fs` at the keys returned by `keyFunc`, a file is skipped if its key is
+// empty.
+func (u *Upload) Store(c context.Context, fs storage.Filesystem, keyFunc func(f *File) string) ([]storage.FileInfo, error) {
+	var infos []storage.FileInfo
+	for _, f := range u.Files {
+		key := keyFunc(f)
+		if key == "" {
+			continue
+		}
+		if err := f.Store(c, fs, key); err != nil {
+			return infos, err
+		}
+		infos = append(infos, storage.FileInfo{Key: key, Size: f.Size, ContentType: f.ContentType})
+	}
+
+	return infos, nil
+}
+
+// Remove deletes the temporary files.
+func (u *Upload) Remove() {
+	for _, f := range u.Files {
+		os.Remove(f.path)
+	}
+}
+
+// Parse streams the files of the multipart request into temporary files, without buffering them in
+// memory, and validates them. The rejected uploads are `*berror.APIError` with a 4xx status, so that
+// the handler can just return the error. Example:
+//
+//	u, err := upload.Parse(c, upload.Config{MIMETypes: []string{"image/*"}, MaxWidth: 4096, MaxHeight: 4096})
+//	if err != nil {
+//		return err
+//	}
+//	defer u.Remove()
+//	err = u.File("avatar").Store(c.Request().Context(), bean.Storage, "avatars/"+userID)
+func Parse(c echo.Context, config Config) (*Upload, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultConfig.MaxSize
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultConfig.MaxFiles
+	}
+	if config.MaxValueBytes <= 0 {
+		config.MaxValueBytes = DefaultConfig.MaxValueBytes
+	}
+
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, errors.WithStack(err))
+	}
+
+	u := &Upload{Values: url.Values{}}
+	valueBytes := config.MaxValueBytes
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return u, nil
+		}
+		if err != nil {
+			u.Remove()
+			return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, errors.WithStack(err))
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, valueBytes+1))
+			if err != nil {
+				u.Remove()
+				return nil, berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, errors.WithStack(err))
+			}
+			valueBytes -= int64(len(value))
+			if valueBytes < 0 {
+				u.Remove()
+				return nil, berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrValueTooLarge)
+			}
+			u.Values.Add(part.FormName(), string(value))
+			continue
+		}
+
+		if len(u.Files) >= config.MaxFiles {
+			u.Remove()
+			return nil, berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrTooManyFiles)
+		}
+
+		f := &File{
+			Field:    part.FormName(),
+			Filename: filepath.Base(part.FileName()),
+		}
+		f.Ext = strings.ToLower(filepath.Ext(f.Filename))
+
+		err = config.receive(c.Request().Context(), part, f)
+		if f.path != "" {
+			u.Files = append(u.Files, f)
+		}
+		if err != nil {
+			u.Remove()
+			return nil, err
+		}
+	}
+}
+
+// receive writes the part to a temporary file and validates it.
+func (config Config) receive(c context.Context, r io.Reader, f *File) error {
+	if len(config.Fields) > 0 && !contains(config.Fields, f.Field) {
+		return rejected(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, ErrField, f.Field)
+	}
+	if len(config.Extensions) > 0 && !contains(config.Extensions, f.Ext) {
+		return rejected(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, ErrExtension, f.Filename)
+	}
+
+	tmp, err := os.CreateTemp(config.TempDir, "bean-upload-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	f.path = tmp.Name()
+	defer tmp.Close()
+
+	// The first 512 bytes are enough to sniff the type.
+	var head bytes.Buffer
+	n, err := io.Copy(tmp, io.TeeReader(io.LimitReader(r, config.MaxSize+1), &limitedBuffer{Buffer: &head, limit: 512}))
+	if err != nil {
+		return berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, errors.WithStack(err))
+	}
+	if n > config.MaxSize {
+		return rejected(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE, ErrTooLarge, f.Filename)
+	}
+	f.Size = n
+
+	f.ContentType = http.DetectContentType(head.Bytes())
+	if len(config.MIMETypes) > 0 && !matchMIMEType(config.MIMETypes, f.ContentType) {
+		return rejected(http.StatusUnsupportedMediaType, berror.UNSUPPORTED_MEDIA_TYPE, ErrMIMEType, f.Filename)
+	}
+
+	if config.MinWidth > 0 || config.MinHeight > 0 || config.MaxWidth > 0 || config.MaxHeight > 0 {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+		cfg, _, err := image.DecodeConfig(tmp)
+		if err != nil {
+			return rejected(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, ErrInvalidImage, f.Filename)
+		}
+		f.Width, f.Height = cfg.Width, cfg.Height
+
+		if cfg.Width < config.MinWidth || cfg.Height < config.MinHeight ||
+			(config.MaxWidth > 0 && cfg.Width > config.MaxWidth) || (config.MaxHeight > 0 && cfg.Height > config.MaxHeight) {
+			return rejected(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, ErrDimensions, f.Filename)
+		}
+	}
+
+	if config.Scanner != nil {
+		if err := tmp.Sync(); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := config.Scanner.Scan(c, f); err != nil {
+			if errors.Is(err, ErrInfected) {
+				return berror.NewAPIError(http.StatusUnprocessableEntity, berror.FILE_REJECTED, errors.Wrap(err, f.Filename))
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rejected(status int, code berror.ErrorCode, reason error, name string) error {
+	return berror.NewIgnorableAPIError(status, code, errors.Wrap(reason, name))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMIMEType matches the sniffed type, without its parameters, with the accepted types like "image/*".
+func matchMIMEType(accepted []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range accepted {
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitedBuffer keeps the first `limit` bytes written to it.
+type limitedBuffer struct {
+	*bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
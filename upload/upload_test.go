@@ -0,0 +1,155 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type part struct {
+	field, filename string
+	content         []byte
+}
+
+func newContext(t *testing.T, parts ...part) echo.Context {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			require.NoError(t, mw.WriteField(p.field, string(p.content)))
+			continue
+		}
+		w, err := mw.CreateFormFile(p.field, p.filename)
+		require.NoError(t, err)
+		w.Write(p.content)
+	}
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return b.Bytes()
+}
+
+func assertRejected(t *testing.T, err error, status int, reason error) {
+	t.Helper()
+
+	var apiErr *berror.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, status, apiErr.HTTPStatusCode)
+	assert.ErrorIs(t, apiErr.Err, reason)
+}
+
+func TestParse(t *testing.T) {
+	c := newContext(t,
+		part{field: "title", content: []byte("holiday")},
+		part{field: "photo", filename: "../../a.PNG", content: pngImage(t, 40, 30)},
+	)
+
+	u, err := Parse(c, Config{
+		Extensions: []string{".png"},
+		MIMETypes:  []string{"image/*"},
+		MaxWidth:   100,
+		MaxHeight:  100,
+		TempDir:    t.TempDir(),
+	})
+	require.NoError(t, err)
+	defer u.Remove()
+
+	assert.Equal(t, "holiday", u.Values.Get("title"))
+
+	f := u.File("photo")
+	require.NotNil(t, f)
+	assert.Equal(t, "a.PNG", f.Filename)
+	assert.Equal(t, ".png", f.Ext)
+	assert.Equal(t, "image/png", f.ContentType)
+	assert.Equal(t, 40, f.Width)
+	assert.Equal(t, 30, f.Height)
+
+	fs, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	require.NoError(t, err)
+	infos, err := u.Store(context.Background(), fs, func(f *File) string { return "photos/1" + f.Ext })
+	require.NoError(t, err)
+	assert.Equal(t, []storage.FileInfo{{Key: "photos/1.png", Size: f.Size, ContentType: "image/png"}}, infos)
+
+	stored, err := fs.Get(context.Background(), "photos/1.png")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(stored)
+	stored.Close()
+	assert.Equal(t, f.Size, int64(len(data)))
+
+	u.Remove()
+	_, err = os.Stat(f.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseRejects(t *testing.T) {
+	dir := t.TempDir()
+	text := []byte("just some text")
+
+	_, err := Parse(newContext(t, part{field: "doc", filename: "a.txt", content: bytes.Repeat(text, 10)}), Config{MaxSize: 20, TempDir: dir})
+	assertRejected(t, err, http.StatusRequestEntityTooLarge, ErrTooLarge)
+
+	_, err = Parse(newContext(t, part{field: "doc", filename: "a.exe", content: text}), Config{Extensions: []string{".txt"}, TempDir: dir})
+	assertRejected(t, err, http.StatusBadRequest, ErrExtension)
+
+	// The type is sniffed, renaming a text file doesn't make it an image.
+	_, err = Parse(newContext(t, part{field: "doc", filename: "a.png", content: text}), Config{MIMETypes: []string{"image/png"}, TempDir: dir})
+	assertRejected(t, err, http.StatusUnsupportedMediaType, ErrMIMEType)
+
+	_, err = Parse(newContext(t, part{field: "photo", filename: "a.png", content: pngImage(t, 200, 10)}), Config{MaxWidth: 100, TempDir: dir})
+	assertRejected(t, err, http.StatusBadRequest, ErrDimensions)
+
+	_, err = Parse(newContext(t, part{field: "photo", filename: "a.png", content: text}), Config{MinWidth: 1, TempDir: dir})
+	assertRejected(t, err, http.StatusBadRequest, ErrInvalidImage)
+
+	_, err = Parse(newContext(t, part{field: "other", filename: "a.txt", content: text}), Config{Fields: []string{"doc"}, TempDir: dir})
+	assertRejected(t, err, http.StatusBadRequest, ErrField)
+
+	_, err = Parse(newContext(t, part{field: "a", filename: "a.txt", content: text}, part{field: "b", filename: "b.txt", content: text}), Config{MaxFiles: 1, TempDir: dir})
+	assertRejected(t, err, http.StatusRequestEntityTooLarge, ErrTooManyFiles)
+
+	scanner := ScannerFunc(func(c context.Context, f *File) error {
+		file, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		if bytes.Contains(data, []byte("EICAR")) {
+			return errors.Wrap(ErrInfected, "EICAR test signature")
+		}
+		return nil
+	})
+	_, err = Parse(newContext(t, part{field: "doc", filename: "a.txt", content: []byte("EICAR")}), Config{Scanner: scanner, TempDir: dir})
+	assertRejected(t, err, http.StatusUnprocessableEntity, ErrInfected)
+
+	// The temporary files of the rejected uploads are removed.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
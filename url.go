@@ -0,0 +1,185 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/middleware"
+)
+
+// ErrRouteNotFound is returned by `URLFor` when no route has the name.
+var ErrRouteNotFound = errors.New("route not found")
+
+// The echo instance of the last `NewEcho`, whose routes are used by `URLFor` without a request and by
+// the template funcs.
+var (
+	urlEcho   *echo.Echo
+	urlEchoMu sync.RWMutex
+)
+
+// URLFor returns the path of the route named `name`, see `WithName`, with `http.basePath` of the bean
+// instance serving `c`, or of `BeanConfig` if `c` is nil or not served by a bean instance. The params
+// replace the path parameters in order and a last `url.Values` param is the query string. `c` can be
+// nil outside of a request. (example: a background job)
+// Example:
+//
+//	b.GET("/orders/:id", hdlrs.orderHdlr.Show, bean.WithName("orders.show"))
+//
+//	target, err := bean.URLFor(c, "orders.show", order.ID, url.Values{"tab": {"items"}})
+//	// "/api/shop/orders/42?tab=items"
+func URLFor(c echo.Context, name string, params ...interface{}) (string, error) {
+	var e *echo.Echo
+	if c != nil {
+		e = c.Echo()
+	} else {
+		urlEchoMu.RLock()
+		e = urlEcho
+		urlEchoMu.RUnlock()
+	}
+	if e == nil {
+		return "", errors.New("url for " + name + ": no echo instance, call `New` first")
+	}
+
+	var query url.Values
+	if n := len(params); n > 0 {
+		if q, ok := params[n-1].(url.Values); ok {
+			query = q
+			params = params[:n-1]
+		}
+	}
+
+	var path string
+	found := false
+	for _, r := range e.Routes() {
+		if r.Name == name {
+			path, found = r.Path, true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+	}
+
+	path, err := reversePath(path, params)
+	if err != nil {
+		return "", fmt.Errorf("url for %s: %w", name, err)
+	}
+
+	path = middleware.JoinBasePath(urlConfig(c).HTTP.BasePath, path)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	return path, nil
+}
+
+// AbsoluteURLFor returns the URL of the named route with the scheme and the host of `http.externalURL`,
+// or of the request if it's not set, for the links of the emails and the webhooks. The config is resolved
+// like `URLFor`.
+func AbsoluteURLFor(c echo.Context, name string, params ...interface{}) (string, error) {
+	path, err := URLFor(c, name, params...)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(urlConfig(c).HTTP.ExternalURL, "/")
+	if base == "" {
+		if c == nil {
+			return "", errors.New("absolute url for " + name + ": `http.externalURL` is not set")
+		}
+		base = c.Scheme() + "://" + c.Request().Host
+	}
+
+	return base + path, nil
+}
+
+// urlConfig returns the config of the bean instance serving `c`, or the global one otherwise.
+func urlConfig(c echo.Context) *Config {
+	if c != nil {
+		if b := Of(c.Echo()); b != nil {
+			return &b.Config
+		}
+	}
+
+	return &BeanConfig
+}
+
+// reversePath replaces the `:param` and the `*` segments of an echo path by the params, escaped.
+func reversePath(path string, params []interface{}) (string, error) {
+	segments := strings.Split(path, "/")
+
+	n := 0
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && segment != "*" {
+			continue
+		}
+		if n >= len(params) {
+			return "", fmt.Errorf("missing the parameter %q", segment)
+		}
+
+		value := fmt.Sprint(params[n])
+		if segment == "*" {
+			// The wildcard matches the rest of the path, its slashes are kept.
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+		n++
+	}
+	if n < len(params) {
+		return "", fmt.Errorf("%d parameters for %d path parameters", len(params), n)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// urlTemplateFuncs returns the `url` template func, which adds `http.basePath` to an absolute path like
+// `{{ url "/static/app.css" }}`, the `basePath` one and the `urlFor` and `absoluteURLFor` ones building
+// the URLs of the named routes like `{{ urlFor "orders.show" .Order.ID }}`.
+func urlTemplateFuncs(basePath string) map[string]interface{} {
+	basePath = middleware.NormalizeBasePath(basePath)
+	return map[string]interface{}{
+		"url": func(path string) string {
+			return middleware.JoinBasePath(basePath, path)
+		},
+		"basePath": func() string {
+			return basePath
+		},
+		"urlFor": func(name string, params ...interface{}) (string, error) {
+			return URLFor(nil, name, params...)
+		},
+		"absoluteURLFor": func(name string, params ...interface{}) (string, error) {
+			return AbsoluteURLFor(nil, name, params...)
+		},
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLFor(t *testing.T) {
+	defer func(config Config) { BeanConfig = config }(BeanConfig)
+	BeanConfig.HTTP.BasePath = "/api/shop"
+
+	b := &Bean{Echo: echo.New()}
+	noop := func(c echo.Context) error { return nil }
+	b.GET("/orders/:id/items/:item", noop, WithName("orders.item"))
+	b.GET("/files/*", noop, WithName("files"))
+	b.Group("/admin").GET("", noop, WithName("admin"))
+
+	c := b.Echo.NewContext(httptest.NewRequest(http.MethodGet, "http://shop.local/api/shop/orders", nil), httptest.NewRecorder())
+
+	path, err := URLFor(c, "orders.item", 42, "a b", url.Values{"tab": {"items"}})
+	require.NoError(t, err)
+	assert.Equal(t, "/api/shop/orders/42/items/a%20b?tab=items", path)
+
+	path, err = URLFor(c, "files", "docs/guide v2.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "/api/shop/files/docs/guide%20v2.pdf", path)
+
+	path, err = URLFor(c, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "/api/shop/admin", path)
+
+	_, err = URLFor(c, "orders.item", 42)
+	assert.EqualError(t, err, `url for orders.item: missing the parameter ":item"`)
+	_, err = URLFor(c, "admin", 1)
+	assert.Error(t, err)
+	_, err = URLFor(c, "orders.list")
+	assert.ErrorIs(t, err, ErrRouteNotFound)
+
+	abs, err := AbsoluteURLFor(c, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "http://shop.local/api/shop/admin", abs)
+
+	// Without a request, like in an email job, the routes of the last echo instance and `http.externalURL` are used.
+	urlEchoMu.Lock()
+	urlEcho = b.Echo
+	urlEchoMu.Unlock()
+	_, err = AbsoluteURLFor(nil, "admin")
+	assert.Error(t, err)
+
+	BeanConfig.HTTP.ExternalURL = "https://shop.example.com/"
+	abs, err = AbsoluteURLFor(nil, "orders.item", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "https://shop.example.com/api/shop/orders/1/items/2", abs)
+
+	funcs := urlTemplateFuncs(BeanConfig.HTTP.BasePath)
+	path, err = funcs["urlFor"].(func(string, ...interface{}) (string, error))("admin")
+	require.NoError(t, err)
+	assert.Equal(t, "/api/shop/admin", path)
+
+	// The config of the bean instance serving the request wins over the global one.
+	instance := &Bean{Echo: b.Echo}
+	instance.Config.HTTP.BasePath = "/tenant"
+	instance.Config.HTTP.ExternalURL = "https://tenant.example.com"
+	register(instance)
+	abs, err = AbsoluteURLFor(c, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "https://tenant.example.com/tenant/admin", abs)
+
+	// A stopped instance is forgotten.
+	assert.True(t, instance.Shutdown(context.Background()).Clean())
+	assert.Nil(t, Of(b.Echo))
+	_, err = URLFor(nil, "admin")
+	assert.Error(t, err)
+}
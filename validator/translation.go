@@ -0,0 +1,219 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	"github.com/go-playground/locales/id"
+	"github.com/go-playground/locales/ja"
+	"github.com/go-playground/locales/nl"
+	"github.com/go-playground/locales/pt_BR"
+	"github.com/go-playground/locales/ru"
+	"github.com/go-playground/locales/tr"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	esTranslations "github.com/go-playground/validator/v10/translations/es"
+	frTranslations "github.com/go-playground/validator/v10/translations/fr"
+	idTranslations "github.com/go-playground/validator/v10/translations/id"
+	jaTranslations "github.com/go-playground/validator/v10/translations/ja"
+	nlTranslations "github.com/go-playground/validator/v10/translations/nl"
+	ptBRTranslations "github.com/go-playground/validator/v10/translations/pt_BR"
+	ruTranslations "github.com/go-playground/validator/v10/translations/ru"
+	trTranslations "github.com/go-playground/validator/v10/translations/tr"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// TranslationFunc registers the messages of a locale into the validator.
+type TranslationFunc func(v *validator.Validate, trans ut.Translator) error
+
+type localeTranslation struct {
+	locale   func() locales.Translator
+	register TranslationFunc
+}
+
+var (
+	localeTranslationsMu sync.RWMutex
+
+	// localeTranslations holds the locales which can be used by `Translator.RegisterLocale`.
+	localeTranslations = map[string]localeTranslation{
+		"en":    {en.New, enTranslations.RegisterDefaultTranslations},
+		"es":    {es.New, esTranslations.RegisterDefaultTranslations},
+		"fr":    {fr.New, frTranslations.RegisterDefaultTranslations},
+		"id":    {id.New, idTranslations.RegisterDefaultTranslations},
+		"ja":    {ja.New, jaTranslations.RegisterDefaultTranslations},
+		"nl":    {nl.New, nlTranslations.RegisterDefaultTranslations},
+		"pt_BR": {pt_BR.New, ptBRTranslations.RegisterDefaultTranslations},
+		"ru":    {ru.New, ruTranslations.RegisterDefaultTranslations},
+		"tr":    {tr.New, trTranslations.RegisterDefaultTranslations},
+		"zh":    {zh.New, zhTranslations.RegisterDefaultTranslations},
+	}
+)
+
+// RegisterLocaleTranslation makes a locale available for `Translator.RegisterLocale`, or replaces the
+// default messages of a builtin locale. `name` must be same as the `Locale()` of the locale.
+func RegisterLocaleTranslation(name string, locale func() locales.Translator, register TranslationFunc) {
+	localeTranslationsMu.Lock()
+	defer localeTranslationsMu.Unlock()
+
+	localeTranslations[name] = localeTranslation{locale, register}
+}
+
+// Translator translates the validation errors into the locale of the client.
+type Translator struct {
+	validate *validator.Validate
+	uni      *ut.UniversalTranslator
+}
+
+// NewTranslator returns a translator for the validator `v` with the messages of `defaultLocale`, which is
+// used when none of the locales of the client is registered.
+func NewTranslator(v *validator.Validate, defaultLocale string) (*Translator, error) {
+	_, lt, err := findLocaleTranslation(defaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Translator{validate: v, uni: ut.New(lt.locale())}
+	if err := t.RegisterLocale(defaultLocale); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// RegisterLocale registers the default messages of a locale. (example: `ja`)
+func (t *Translator) RegisterLocale(name string) error {
+	name, lt, err := findLocaleTranslation(name)
+	if err != nil {
+		return err
+	}
+
+	if _, found := t.uni.GetTranslator(name); !found {
+		if err := t.uni.AddTranslator(lt.locale(), true); err != nil {
+			return err
+		}
+	}
+
+	trans, _ := t.uni.GetTranslator(name)
+
+	return lt.register(t.validate, trans)
+}
+
+// Override replaces the message of a validation tag in a registered locale. `{0}` in the message is
+// replaced by the field name and `{1}` by the parameter of the tag.
+// Example:
+//
+//	translator.Override("ja", "required", "{0}を入力してください")
+func (t *Translator) Override(name, tag, message string) error {
+	if key, _, err := findLocaleTranslation(name); err == nil {
+		name = key
+	}
+
+	trans, found := t.uni.GetTranslator(name)
+	if !found {
+		return fmt.Errorf("validator: locale %q is not registered", name)
+	}
+
+	return t.validate.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+		return ut.Add(tag, message, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		msg, err := ut.T(fe.Tag(), fe.Field(), fe.Param())
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	})
+}
+
+// Find returns the translator of the first registered locale in `names`, or the default one.
+func (t *Translator) Find(names ...string) ut.Translator {
+	trans, _ := t.uni.FindTranslator(names...)
+	return trans
+}
+
+func findLocaleTranslation(name string) (string, localeTranslation, error) {
+	localeTranslationsMu.RLock()
+	defer localeTranslationsMu.RUnlock()
+
+	if lt, ok := localeTranslations[name]; ok {
+		return name, lt, nil
+	}
+
+	// The keys of a config map are lowercased by viper. (example: `pt_br`)
+	for key, lt := range localeTranslations {
+		if strings.EqualFold(key, name) {
+			return key, lt, nil
+		}
+	}
+
+	return "", localeTranslation{}, fmt.Errorf("validator: locale %q is not supported", name)
+}
+
+// ParseAcceptLanguage returns the locales of an `Accept-Language` header in the order of preference,
+// with the same notation as the translations. (example: `ja-JP,ja;q=0.9,en;q=0.8` => [ja_JP ja en])
+func ParseAcceptLanguage(header string) []string {
+	type lang struct {
+		name string
+		q    float64
+	}
+
+	var langs []lang
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name == "" || name == "*" {
+			continue
+		}
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				q = v
+			}
+		}
+
+		langs = append(langs, lang{strings.ReplaceAll(name, "-", "_"), q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	names := make([]string, 0, len(langs))
+	for _, l := range langs {
+		if l.q > 0 {
+			names = append(names, l.name)
+		}
+	}
+
+	return names
+}
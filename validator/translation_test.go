@@ -0,0 +1,71 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"ja_JP", "ja", "en"}, ParseAcceptLanguage("en;q=0.8, ja-JP,ja;q=0.9"))
+	assert.Equal(t, []string{}, ParseAcceptLanguage("*, fr;q=0"))
+}
+
+func TestValidationErrorFields(t *testing.T) {
+	v := validator.New()
+
+	translator, err := NewTranslator(v, "en")
+	assert.NoError(t, err)
+	assert.NoError(t, translator.RegisterLocale("ja"))
+	assert.NoError(t, translator.Override("en", "max", "{0} is too long, up to {1} characters"))
+	assert.Error(t, translator.Override("fr", "max", "{0}"))
+	assert.Error(t, translator.RegisterLocale("xx"))
+
+	params := struct {
+		Name string `validate:"required"`
+		Code string `validate:"max=3"`
+	}{Code: "abcd"}
+
+	dv := &DefaultValidator{Validator: v, Translator: translator}
+	ve, ok := dv.Validate(params).(*ValidationError)
+	assert.True(t, ok)
+
+	assert.Equal(t, []FieldError{
+		{Field: "name", Code: "name_required", Rule: "required", Message: "Name is a required field"},
+		{Field: "code", Code: "code_max_3", Rule: "max", Param: "3", Message: "Code is too long, up to 3 characters"},
+	}, ve.Fields("de", "en"))
+
+	fields := ve.Fields("ja")
+	assert.Equal(t, "Nameは必須フィールドです", fields[0].Message)
+
+	// The message is omitted without a translator.
+	ve.Translator = nil
+	assert.Empty(t, ve.Fields()[0].Message)
+	out, err := json.Marshal(ve.Fields()[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "message")
+}
@@ -26,7 +26,9 @@
 // 	    "errors": [
 // 	        {
 // 	            "field": "name",
-// 	            "code": "name_required"
+// 	            "code": "name_required",
+// 	            "rule": "required",
+// 	            "message": "Name is a required field"
 // 	        }
 // 	    ]
 // 	}
@@ -36,6 +38,7 @@ package validator
 import (
 	"strings"
 
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -44,11 +47,26 @@ type ValidatorFunc func(*validator.Validate) error
 // ValidationError implements the builtin `error` interface and extends custom output function.
 type ValidationError struct {
 	Err error
+
+	// Translator localizes the messages of `Fields`. It can be nil.
+	Translator *Translator
+}
+
+// FieldError is the structured output of a validation error.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // DefaultValidator implements the Echo#Validator interface.
 type DefaultValidator struct {
 	Validator *validator.Validate
+
+	// Translator localizes the messages of the validation errors. Optional.
+	Translator *Translator
 }
 
 // Validate implements the `Echo#Validator.Validate` function.
@@ -58,7 +76,7 @@ func (dv *DefaultValidator) Validate(data interface{}) error {
 		if err, ok := err.(*validator.InvalidValidationError); ok {
 			panic(err)
 		}
-		return &ValidationError{err}
+		return &ValidationError{Err: err, Translator: dv.Translator}
 	}
 	return nil
 }
@@ -73,84 +91,122 @@ func (ve *ValidationError) ErrCollection() []map[string]string {
 		// Lowercase the field name
 		fieldname := strings.ToLower(err.StructField())
 
-		switch err.Tag() {
+		errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": errorCode(fieldname, err)})
+	}
+
+	return errorCollection
+}
+
+// Fields formats the validation errors with the messages translated into the first registered locale
+// in `locales`, or the default locale of the translator. (example: the locales of `Accept-Language`)
+// The message is omitted if there is no translator, because the raw validator error exposes the Go types.
+func (ve *ValidationError) Fields(locales ...string) []FieldError {
+	var trans ut.Translator
+	if ve.Translator != nil {
+		trans = ve.Translator.Find(locales...)
+	}
+
+	fields := []FieldError{}
+
+	for _, err := range ve.Err.(validator.ValidationErrors) {
+
+		// Lowercase the field name
+		fieldname := strings.ToLower(err.StructField())
+
+		var message string
+		if trans != nil {
+			message = err.Translate(trans)
+		}
 
-		case "required":
+		fields = append(fields, FieldError{
+			Field:   fieldname,
+			Code:    errorCode(fieldname, err),
+			Rule:    err.Tag(),
+			Param:   err.Param(),
+			Message: message,
+		})
+	}
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_required"})
+	return fields
+}
 
-		case "email":
+// errorCode returns the machine readable code of a validation error. (example: `name_required`)
+func errorCode(fieldname string, err validator.FieldError) string {
+	switch err.Tag() {
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_not_email"})
+	case "required":
 
-		case "uuid":
+		return fieldname + "_required"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_not_uuid"})
+	case "email":
 
-		case "max":
+		return fieldname + "_not_email"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_max_" + err.Param()})
+	case "uuid":
 
-		case "min":
+		return fieldname + "_not_uuid"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_min_" + err.Param()})
+	case "max":
 
-		case "len":
+		return fieldname + "_max_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_length_" + err.Param()})
+	case "min":
 
-		case "eqfield":
+		return fieldname + "_min_" + err.Param()
 
-			// <field2>_not_same_<field1>
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_not_same_" + strings.ToLower(err.Param())})
+	case "len":
 
-		case "alpha":
+		return fieldname + "_length_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_alpha_only"})
+	case "eqfield":
 
-		case "numeric":
+		// <field2>_not_same_<field1>
+		return fieldname + "_not_same_" + strings.ToLower(err.Param())
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_numeric_only"})
+	case "alpha":
 
-		case "number":
+		return fieldname + "_alpha_only"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_number_only"})
+	case "numeric":
 
-		case "eq":
+		return fieldname + "_numeric_only"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_eq_" + err.Param()})
+	case "number":
 
-		case "ne":
+		return fieldname + "_number_only"
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_ne_" + err.Param()})
+	case "eq":
 
-		case "gt":
+		return fieldname + "_eq_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_gt_" + err.Param()})
+	case "ne":
 
-		case "lt":
+		return fieldname + "_ne_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_lt_" + err.Param()})
+	case "gt":
 
-		case "gte":
+		return fieldname + "_gt_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_gte_" + err.Param()})
+	case "lt":
 
-		case "lte":
+		return fieldname + "_lt_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_lte_" + err.Param()})
+	case "gte":
 
-		case "oneof":
+		return fieldname + "_gte_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_oneof_" + err.Param()})
+	case "lte":
 
-		default:
+		return fieldname + "_lte_" + err.Param()
 
-			errorCollection = append(errorCollection, map[string]string{"field": fieldname, "code": fieldname + "_invalid"})
-		}
-	}
+	case "oneof":
 
-	return errorCollection
+		return fieldname + "_oneof_" + err.Param()
+
+	default:
+
+		return fieldname + "_invalid"
+	}
 }
 
 // Error implements the builtin `error.Error` function.
@@ -0,0 +1,76 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package webhook
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/helpers"
+)
+
+// The results of the deliveries of the metrics.
+const (
+	resultProcessed = "processed"
+	resultFailed    = "failed"
+	resultIgnored   = "ignored"
+	resultDuplicate = "duplicate"
+	resultRejected  = "rejected"
+)
+
+var (
+	deliveriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bean",
+		Name:      "webhook_deliveries_total",
+		Help:      "How many webhook deliveries were received, partitioned by provider, event type and result (processed, failed, ignored, duplicate, rejected).",
+	}, []string{"provider", "event_type", "result"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bean",
+		Name:      "webhook_handler_duration_seconds",
+		Help:      "How long the webhook handlers took, partitioned by provider and event type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "event_type"})
+
+	metricsOnce sync.Once
+)
+
+// registerMetrics registers the webhook metrics into the default prometheus registry when the first
+// receiver is created, so that they are served by the `/metrics` endpoint.
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		// Reuse the collector registered with the same name, if any.
+		deliveriesTotal = helpers.RegisterCollector(prometheus.DefaultRegisterer, deliveriesTotal)
+		handlerDuration = helpers.RegisterCollector(prometheus.DefaultRegisterer, handlerDuration)
+	})
+}
+
+// observe counts a delivery, the handled ones with their duration. The rejected deliveries have no event
+// type.
+func observe(provider, eventType, result string, duration time.Duration) {
+	deliveriesTotal.WithLabelValues(provider, eventType, result).Inc()
+	if result == resultProcessed || result == resultFailed {
+		handlerDuration.WithLabelValues(provider, eventType).Observe(duration.Seconds())
+	}
+}
@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Signature verifies the signature of the requests of a provider.
+type Signature interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// SignatureFunc is a function implementing `Signature`.
+type SignatureFunc func(r *http.Request, body []byte) error
+
+func (f SignatureFunc) Verify(r *http.Request, body []byte) error {
+	return f(r, body)
+}
+
+// HMACConfig defines the config for `HMAC`.
+type HMACConfig struct {
+	// Header holds the signature. (example: "X-Hub-Signature-256")
+	// Required.
+	Header string
+
+	// Prefix is removed from the header before the comparison. (example: "sha256=")
+	// Optional. Default value "".
+	Prefix string
+
+	// Secrets are the shared secrets, the request is valid if one of them matches, so that a secret can be
+	// rotated without rejecting the deliveries.
+	// Required.
+	Secrets []string
+
+	// Base64 is true if the signature is encoded in base64 instead of hex.
+	// Optional. Default value false.
+	Base64 bool
+
+	// TimestampHeader holds the time of the request in unix seconds, it's signed as "<timestamp>.<body>"
+	// and the requests older than `Tolerance` are rejected against the replays.
+	// Optional. Default value "", the body only is signed.
+	TimestampHeader string
+
+	// Tolerance is the maximum age of a request with `TimestampHeader`.
+	// Optional. Default value 5m.
+	Tolerance time.Duration
+}
+
+// HMAC returns the signature scheme of the HMAC-SHA256 of the body.
+func HMAC(config HMACConfig) Signature {
+	if config.Tolerance <= 0 {
+		config.Tolerance = 5 * time.Minute
+	}
+
+	return SignatureFunc(func(r *http.Request, body []byte) error {
+		header := r.Header.Get(config.Header)
+		if header == "" || !strings.HasPrefix(header, config.Prefix) {
+			return errors.Wrap(ErrInvalidSignature, "missing "+config.Header)
+		}
+
+		var signature []byte
+		var err error
+		if config.Base64 {
+			signature, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(header, config.Prefix))
+		} else {
+			signature, err = hex.DecodeString(strings.TrimPrefix(header, config.Prefix))
+		}
+		if err != nil {
+			return errors.Wrap(ErrInvalidSignature, err.Error())
+		}
+
+		signed := body
+		if config.TimestampHeader != "" {
+			timestamp := r.Header.Get(config.TimestampHeader)
+			sec, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				return errors.Wrap(ErrInvalidSignature, "invalid "+config.TimestampHeader)
+			}
+			if age := time.Since(time.Unix(sec, 0)); age > config.Tolerance || age < -config.Tolerance {
+				return errors.Wrap(ErrInvalidSignature, "expired "+config.TimestampHeader)
+			}
+			signed = append([]byte(timestamp+"."), body...)
+		}
+
+		for _, secret := range config.Secrets {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		}
+
+		return ErrInvalidSignature
+	})
+}
@@ -0,0 +1,141 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+)
+
+var ErrDeliveryNotFound = errors.New("webhook: delivery not found")
+
+// Store keeps the deliveries by ID, for the replay and the deduplication.
+type Store interface {
+	Save(c context.Context, delivery *Delivery) error
+	// Get returns `ErrDeliveryNotFound` if the delivery doesn't exist.
+	Get(c context.Context, id string) (*Delivery, error)
+}
+
+// MemoryStore keeps the deliveries in the process memory, the oldest ones are removed when the number of
+// deliveries exceeds `Max`.
+type MemoryStore struct {
+	Max int
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	order      []string
+}
+
+// NewMemoryStore returns a store keeping at most `max` deliveries.
+func NewMemoryStore(max int) *MemoryStore {
+	if max <= 0 {
+		max = 1000
+	}
+
+	return &MemoryStore{Max: max, deliveries: map[string]*Delivery{}}
+}
+
+// Save implements the `Store.Save` function.
+func (s *MemoryStore) Save(_ context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		s.order = append(s.order, delivery.ID)
+	}
+
+	cp := *delivery
+	s.deliveries[delivery.ID] = &cp
+
+	for len(s.order) > s.Max {
+		delete(s.deliveries, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return nil
+}
+
+// Get implements the `Store.Get` function.
+func (s *MemoryStore) Get(_ context.Context, id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+
+	cp := *delivery
+	return &cp, nil
+}
+
+// RedisStore keeps the deliveries in redis for `TTL`, so that they are shared by all the replicas.
+type RedisStore struct {
+	redis  *dbdrivers.RedisDBConn
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a redis store keeping the deliveries for `ttl`, 7 days if it's 0. The keys are
+// prefixed by `dbdrivers.GetRedisCachePrefix() + ":webhook"`.
+func NewRedisStore(redisConn *dbdrivers.RedisDBConn, ttl time.Duration) *RedisStore {
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	return &RedisStore{redis: redisConn, prefix: dbdrivers.GetRedisCachePrefix() + ":webhook:", ttl: ttl}
+}
+
+// Save implements the `Store.Save` function.
+func (s *RedisStore) Save(c context.Context, delivery *Delivery) error {
+	b, err := json.Marshal(delivery)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(s.redis.Client().Set(c, s.prefix+delivery.ID, b, s.ttl).Err())
+}
+
+// Get implements the `Store.Get` function.
+func (s *RedisStore) Get(c context.Context, id string) (*Delivery, error) {
+	b, err := s.redis.Client().Get(c, s.prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var delivery Delivery
+	if err := json.Unmarshal(b, &delivery); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &delivery, nil
+}
@@ -0,0 +1,403 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package webhook receives the webhooks of the providers, like the payment or the git hosting services.
+// The signatures of the requests are verified, the raw payloads are stored to be replayed and the events
+// are routed to typed handlers through the middlewares of the `messaging` package:
+//
+//	recv := webhook.NewReceiver(webhook.ReceiverConfig{})
+//	recv.Register(webhook.Provider{
+//		Name:      "github",
+//		Signature: webhook.HMAC(webhook.HMACConfig{Header: "X-Hub-Signature-256", Prefix: "sha256=", Secrets: secrets}),
+//		EventType: webhook.HeaderEventType("X-GitHub-Event"),
+//	})
+//	recv.Use(messaging.Logging())
+//	webhook.On(recv, "github", "push", func(c context.Context, event webhook.Event[PushEvent]) error {
+//		return builds.Start(c, event.Data.Ref)
+//	})
+//	e.POST("/webhooks/github", recv.Handler("github"))
+//
+// A delivery is answered with 200 once its handler returns nil, and with 500 so that the provider retries
+// if the handler fails.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/messaging"
+)
+
+// The attributes of the messages passed to the middlewares.
+const (
+	ProviderAttribute  = "webhook_provider"
+	EventTypeAttribute = "webhook_event_type"
+)
+
+// AnyEvent is the event type of the handlers of the events without their own handler.
+const AnyEvent = "*"
+
+var (
+	ErrUnknownProvider  = errors.New("webhook: unknown provider")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrNoEventType      = errors.New("webhook: event type not found")
+)
+
+// Provider is a sender of webhooks.
+type Provider struct {
+	// Required.
+	Name string
+
+	// Signature verifies that the requests come from the provider.
+	// Required.
+	Signature Signature
+
+	// EventType returns the type of the event of a delivery. (example: `HeaderEventType("X-GitHub-Event")`)
+	// Required.
+	EventType func(header http.Header, body []byte) (string, error)
+
+	// DeliveryID returns the ID of a delivery given by the provider, a delivery already processed is not
+	// handled again. (example: the `X-GitHub-Delivery` header)
+	// Optional. Default value is a new UUID per request, without deduplication.
+	DeliveryID func(header http.Header, body []byte) string
+}
+
+// HeaderEventType returns the event type of the header.
+func HeaderEventType(name string) func(header http.Header, body []byte) (string, error) {
+	return func(header http.Header, _ []byte) (string, error) {
+		if eventType := header.Get(name); eventType != "" {
+			return eventType, nil
+		}
+		return "", ErrNoEventType
+	}
+}
+
+// JSONEventType returns the event type of a string field of the JSON body, the nested fields are
+// separated by dots. (example: "data.type")
+func JSONEventType(field string) func(header http.Header, body []byte) (string, error) {
+	path := strings.Split(field, ".")
+	return func(_ http.Header, body []byte) (string, error) {
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		for _, key := range path {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", ErrNoEventType
+			}
+			value = object[key]
+		}
+
+		if eventType, ok := value.(string); ok && eventType != "" {
+			return eventType, nil
+		}
+		return "", ErrNoEventType
+	}
+}
+
+// Delivery is a request of a provider.
+type Delivery struct {
+	ID         string      `json:"id"`
+	Provider   string      `json:"provider"`
+	EventType  string      `json:"eventType"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	ReceivedAt time.Time   `json:"receivedAt"`
+
+	// Status is "received", "processed", "ignored" or "failed", with the `Error` of the last attempt.
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
+
+// The statuses of the deliveries.
+const (
+	StatusReceived  = "received"
+	StatusProcessed = "processed"
+	StatusIgnored   = "ignored"
+	StatusFailed    = "failed"
+)
+
+// Event is an event of a delivery, with its data decoded from the JSON body.
+type Event[T any] struct {
+	Delivery *Delivery
+	Data     T
+}
+
+// ReceiverConfig defines the config for `NewReceiver`.
+type ReceiverConfig struct {
+	// Store keeps the deliveries for the replay and the deduplication.
+	// Optional. Default value `NewMemoryStore(1000)`.
+	Store Store
+
+	// MaxBodySize is the maximum size of a request body.
+	// Optional. Default value 1MB.
+	MaxBodySize int64
+}
+
+// Receiver routes the deliveries of the registered providers to the handlers of their events.
+type Receiver struct {
+	config      ReceiverConfig
+	mu          sync.RWMutex
+	providers   map[string]*Provider
+	handlers    map[string]map[string]messaging.Handler
+	middlewares []messaging.Middleware
+}
+
+// NewReceiver returns a receiver without provider.
+func NewReceiver(config ReceiverConfig) *Receiver {
+	if config.Store == nil {
+		config.Store = NewMemoryStore(1000)
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	registerMetrics()
+
+	return &Receiver{
+		config:    config,
+		providers: map[string]*Provider{},
+		handlers:  map[string]map[string]messaging.Handler{},
+	}
+}
+
+// Register adds a provider, it panics if the provider is invalid or already registered.
+func (r *Receiver) Register(provider Provider) {
+	if provider.Name == "" || provider.Signature == nil || provider.EventType == nil {
+		panic("webhook: the provider requires `Name`, `Signature` and `EventType`")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[provider.Name]; ok {
+		panic("webhook: provider " + provider.Name + " is already registered")
+	}
+	r.providers[provider.Name] = &provider
+	r.handlers[provider.Name] = map[string]messaging.Handler{}
+}
+
+// Use adds middlewares wrapping the handlers, the first one is the outermost.
+func (r *Receiver) Use(middlewares ...messaging.Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// On routes the events of a type of a provider to `fn`, with the JSON body decoded into `T`. The event
+// type `AnyEvent` handles the events without their own handler. It panics if the provider is not
+// registered.
+func On[T any](r *Receiver, provider, eventType string, fn func(c context.Context, event Event[T]) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	handlers, ok := r.handlers[provider]
+	if !ok {
+		panic("webhook: provider " + provider + " is not registered")
+	}
+
+	handlers[eventType] = func(c context.Context, msg *messaging.Message) error {
+		delivery, _ := DeliveryFromContext(c)
+		event := Event[T]{Delivery: delivery}
+		if err := json.Unmarshal(msg.Data, &event.Data); err != nil {
+			return errors.Wrapf(err, "webhook: failed to decode the %s event of %s", eventType, provider)
+		}
+		return fn(c, event)
+	}
+}
+
+// Handler returns the handler of the requests of a provider.
+func (r *Receiver) Handler(provider string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r.mu.RLock()
+		p, ok := r.providers[provider]
+		r.mu.RUnlock()
+		if !ok {
+			return berror.NewAPIError(http.StatusNotFound, berror.RESOURCE_NOT_FOUND, errors.Wrap(ErrUnknownProvider, provider))
+		}
+
+		req := c.Request()
+		body, err := io.ReadAll(io.LimitReader(req.Body, r.config.MaxBodySize+1))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if int64(len(body)) > r.config.MaxBodySize {
+			return berror.NewIgnorableAPIError(http.StatusRequestEntityTooLarge, berror.REQUEST_ENTITY_TOO_LARGE,
+				errors.Errorf("webhook: body of %s exceeds %d bytes", provider, r.config.MaxBodySize))
+		}
+
+		if err := p.Signature.Verify(req, body); err != nil {
+			observe(provider, "", resultRejected, 0)
+			return berror.NewIgnorableAPIError(http.StatusUnauthorized, berror.UNAUTHORIZED_ACCESS, err)
+		}
+
+		eventType, err := p.EventType(req.Header, body)
+		if err != nil {
+			observe(provider, "", resultRejected, 0)
+			return berror.NewIgnorableAPIError(http.StatusBadRequest, berror.API_DATA_VALIDATION_FAILED, err)
+		}
+
+		ctx := req.Context()
+		delivery := &Delivery{
+			Provider:   provider,
+			EventType:  eventType,
+			Header:     req.Header.Clone(),
+			Body:       body,
+			ReceivedAt: time.Now(),
+			Status:     StatusReceived,
+		}
+		if p.DeliveryID != nil {
+			delivery.ID = p.DeliveryID(req.Header, body)
+		}
+
+		if delivery.ID != "" {
+			stored, err := r.config.Store.Get(ctx, provider+":"+delivery.ID)
+			if err != nil && !errors.Is(err, ErrDeliveryNotFound) {
+				return err
+			}
+			if stored != nil {
+				if stored.Status == StatusProcessed || stored.Status == StatusIgnored {
+					observe(provider, r.eventLabel(provider, eventType), resultDuplicate, 0)
+					return c.NoContent(http.StatusOK)
+				}
+
+				// IMPORTANT: The retries of a failed delivery keep counting its attempts.
+				delivery.Attempts = stored.Attempts
+			}
+		} else {
+			delivery.ID = uuid.NewString()
+		}
+		delivery.ID = provider + ":" + delivery.ID
+
+		if err := r.config.Store.Save(ctx, delivery); err != nil {
+			return err
+		}
+
+		if err := r.dispatch(ctx, delivery); err != nil {
+			return errors.Wrapf(err, "webhook: delivery %s failed", delivery.ID)
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// Replay handles a stored delivery again, without verifying its signature.
+func (r *Receiver) Replay(c context.Context, id string) error {
+	delivery, err := r.config.Store.Get(c, id)
+	if err != nil {
+		return err
+	}
+
+	return r.dispatch(c, delivery)
+}
+
+// dispatch passes the delivery to the handler of its event and saves the result.
+func (r *Receiver) dispatch(c context.Context, delivery *Delivery) error {
+	r.mu.RLock()
+	handlers := r.handlers[delivery.Provider]
+	h, ok := handlers[delivery.EventType]
+	if !ok {
+		h, ok = handlers[AnyEvent]
+	}
+	middlewares := r.middlewares
+	r.mu.RUnlock()
+
+	eventLabel := r.eventLabel(delivery.Provider, delivery.EventType)
+	start := time.Now()
+	delivery.Attempts++
+
+	var err error
+	if ok {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+
+		err = h(withDelivery(c, delivery), &messaging.Message{
+			ID:   delivery.ID,
+			Data: delivery.Body,
+			Attributes: map[string]string{
+				ProviderAttribute:  delivery.Provider,
+				EventTypeAttribute: delivery.EventType,
+			},
+			PublishedAt:     delivery.ReceivedAt,
+			DeliveryAttempt: delivery.Attempts,
+		})
+	}
+
+	now := time.Now()
+	delivery.ProcessedAt = &now
+	delivery.Error = ""
+	switch {
+	case !ok:
+		delivery.Status = StatusIgnored
+		observe(delivery.Provider, eventLabel, resultIgnored, 0)
+	case err != nil:
+		delivery.Status, delivery.Error = StatusFailed, err.Error()
+		observe(delivery.Provider, eventLabel, resultFailed, time.Since(start))
+	default:
+		delivery.Status = StatusProcessed
+		observe(delivery.Provider, eventLabel, resultProcessed, time.Since(start))
+	}
+
+	if saveErr := r.config.Store.Save(c, delivery); saveErr != nil && err == nil {
+		return saveErr
+	}
+
+	return err
+}
+
+// eventLabel is the event type of the metrics, the types without handler are labeled "other" so that the
+// provider can't create the series.
+func (r *Receiver) eventLabel(provider, eventType string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.handlers[provider][eventType]; ok {
+		return eventType
+	}
+	return "other"
+}
+
+type deliveryContextKey struct{}
+
+func withDelivery(c context.Context, delivery *Delivery) context.Context {
+	return context.WithValue(c, deliveryContextKey{}, delivery)
+}
+
+// DeliveryFromContext returns the delivery handled with the context, for the middlewares.
+func DeliveryFromContext(c context.Context) (*Delivery, bool) {
+	delivery, ok := c.Value(deliveryContextKey{}).(*Delivery)
+	return delivery, ok
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/retail-ai-inc/bean/dbdrivers"
+	berror "github.com/retail-ai-inc/bean/error"
+	"github.com/retail-ai-inc/bean/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+type pushEvent struct {
+	Ref string `json:"ref"`
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newReceiver() *Receiver {
+	recv := NewReceiver(ReceiverConfig{})
+	recv.Register(Provider{
+		Name:      "github",
+		Signature: HMAC(HMACConfig{Header: "X-Hub-Signature-256", Prefix: "sha256=", Secrets: []string{"old", "new"}}),
+		EventType: HeaderEventType("X-GitHub-Event"),
+		DeliveryID: func(header http.Header, _ []byte) string {
+			return header.Get("X-GitHub-Delivery")
+		},
+	})
+	return recv
+}
+
+func deliver(recv *Receiver, event, id, body, signature string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", id)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	rec := httptest.NewRecorder()
+
+	err := recv.Handler("github")(echo.New().NewContext(req, rec))
+	return rec, err
+}
+
+func TestReceiver(t *testing.T) {
+	recv := newReceiver()
+
+	var attributes map[string]string
+	recv.Use(func(next messaging.Handler) messaging.Handler {
+		return func(c context.Context, msg *messaging.Message) error {
+			attributes = msg.Attributes
+			return next(c, msg)
+		}
+	})
+
+	var refs []string
+	On(recv, "github", "push", func(c context.Context, event Event[pushEvent]) error {
+		assert.Equal(t, "github:1", event.Delivery.ID)
+		refs = append(refs, event.Data.Ref)
+		return nil
+	})
+
+	processed := testutil.ToFloat64(deliveriesTotal.WithLabelValues("github", "push", resultProcessed))
+
+	body := `{"ref":"refs/heads/main"}`
+	rec, err := deliver(recv, "push", "1", body, sign("new", body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"refs/heads/main"}, refs)
+	assert.Equal(t, map[string]string{ProviderAttribute: "github", EventTypeAttribute: "push"}, attributes)
+	assert.Equal(t, processed+1, testutil.ToFloat64(deliveriesTotal.WithLabelValues("github", "push", resultProcessed)))
+
+	// The redelivery of a processed delivery is not handled again.
+	rec, err = deliver(recv, "push", "1", body, sign("old", body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, refs, 1)
+
+	// The events without handler are stored and ignored.
+	_, err = deliver(recv, "issues", "2", `{}`, sign("new", `{}`))
+	assert.NoError(t, err)
+	stored, err := recv.config.Store.Get(context.Background(), "github:2")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusIgnored, stored.Status)
+
+	_, err = deliver(recv, "push", "3", body, sign("wrong", body))
+	var apiErr *berror.APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusUnauthorized, apiErr.HTTPStatusCode)
+	}
+
+	assert.NoError(t, recv.Replay(context.Background(), "github:1"))
+	assert.Len(t, refs, 2)
+	stored, _ = recv.config.Store.Get(context.Background(), "github:1")
+	assert.Equal(t, 2, stored.Attempts)
+}
+
+func TestReceiverFailure(t *testing.T) {
+	recv := newReceiver()
+
+	fail := true
+	On(recv, "github", AnyEvent, func(c context.Context, event Event[map[string]interface{}]) error {
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	body := `{"action":"opened"}`
+	_, err := deliver(recv, "issues", "1", body, sign("new", body))
+	assert.ErrorContains(t, err, "boom")
+
+	stored, _ := recv.config.Store.Get(context.Background(), "github:1")
+	assert.Equal(t, StatusFailed, stored.Status)
+	assert.Equal(t, "boom", stored.Error)
+
+	// The retry of the provider is handled again.
+	fail = false
+	_, err = deliver(recv, "issues", "1", body, sign("new", body))
+	assert.NoError(t, err)
+	stored, _ = recv.config.Store.Get(context.Background(), "github:1")
+	assert.Equal(t, StatusProcessed, stored.Status)
+	assert.Equal(t, 2, stored.Attempts)
+}
+
+func TestHMACTimestamp(t *testing.T) {
+	signature := HMAC(HMACConfig{Header: "X-Signature", Secrets: []string{"secret"}, TimestampHeader: "X-Timestamp"})
+
+	body := `{}`
+	request := func(at time.Time) *http.Request {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(timestamp + "." + body))
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+		return req
+	}
+
+	assert.NoError(t, signature.Verify(request(time.Now()), []byte(body)))
+	assert.ErrorIs(t, signature.Verify(request(time.Now().Add(-time.Hour)), []byte(body)), ErrInvalidSignature)
+}
+
+func TestJSONEventType(t *testing.T) {
+	eventType := JSONEventType("data.type")
+
+	got, err := eventType(nil, []byte(`{"data":{"type":"invoice.paid"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice.paid", got)
+
+	_, err = eventType(nil, []byte(`{"data":"invoice.paid"}`))
+	assert.ErrorIs(t, err, ErrNoEventType)
+}
+
+func TestRedisStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	store := NewRedisStore(&dbdrivers.RedisDBConn{Host: client}, time.Hour)
+	c := context.Background()
+
+	_, err := store.Get(c, "github:1")
+	assert.ErrorIs(t, err, ErrDeliveryNotFound)
+
+	assert.NoError(t, store.Save(c, &Delivery{ID: "github:1", Provider: "github", Body: []byte(`{}`)}))
+	delivery, err := store.Get(c, "github:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{}`), delivery.Body)
+}